@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/audit"
+	"github.com/spf13/cobra"
+)
+
+func newAuditCmd(opts *globalOptions) *cobra.Command {
+	var (
+		logFile string
+		output  string
+	)
+	cmd := &cobra.Command{
+		Use:   "audit <file>",
+		Short: "Show what happened to a file according to the audit log",
+		Long: `Show the audit trail of every file whose name contains the given text:
+when it was detected, its checksum, the upload attempts and task, the created
+document and where the file went afterwards.
+
+The audit log is written while watching when audit_log is configured.
+'audit verify' checks that it was not modified.`,
+		Example: `  paperless-uploader audit invoice-2024-03`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid output format %q: must be table or json", output)
+			}
+			f, err := openAuditLog(opts, logFile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			records, err := fileHistory(f, args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read audit log: %v", err)
+			}
+			if output == "json" {
+				return writeJSON(cmd.OutOrStdout(), records)
+			}
+			if len(records) == 0 {
+				return fmt.Errorf("no audit records for %q", args[0])
+			}
+			return writeAuditTable(cmd.OutOrStdout(), records)
+		},
+	}
+	cmd.PersistentFlags().StringVar(&logFile, "log-file", "", "audit log to read (default: audit_log from the config)")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	cmd.AddCommand(newAuditVerifyCmd(opts, &logFile))
+	return cmd
+}
+
+func newAuditVerifyCmd(opts *globalOptions, logFile *string) *cobra.Command {
+	var publicKey string
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check that the audit log was not modified",
+		Long: `Check the hash chain of the audit log: every record must carry the hash of
+the record before it and match its own hash, so changed, removed, inserted or
+reordered records are reported with their line.
+
+With --public-key, or when audit_signing_key is configured, every record must
+also be signed with the key. Records removed from the end of the log can only
+be detected by comparing the last sequence number and hash printed here with
+a copy kept elsewhere.`,
+		Example: `  paperless-uploader audit verify --public-key audit.pub`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := openAuditLog(opts, *logFile)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			keyFile := publicKey
+			if keyFile == "" {
+				if cfg, err := loadConfigFile(opts.configFile); err == nil {
+					keyFile = cfg.AuditSigningKey
+				}
+			}
+			var pub ed25519.PublicKey
+			if keyFile != "" {
+				if pub, err = audit.LoadVerifyKey(keyFile); err != nil {
+					return fmt.Errorf("invalid public key: %v", err)
+				}
+			}
+
+			v, err := audit.Verify(f, pub)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if v.Unchained > 0 {
+				fmt.Fprintf(out, "%d lines written before chaining are not covered\n", v.Unchained)
+			}
+			if v.Truncated > 0 {
+				fmt.Fprintf(out, "%d lines were cut short by a crash\n", v.Truncated)
+			}
+			if pub != nil {
+				fmt.Fprintf(out, "Verified %d records, all signed\n", v.Records)
+			} else {
+				fmt.Fprintf(out, "Verified %d records\n", v.Records)
+			}
+			if v.Records > 0 {
+				fmt.Fprintf(out, "Last record: %d, hash %s\n", v.LastSeq, v.LastHash)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&publicKey, "public-key", "", "Ed25519 public key in PEM form the records must be signed with (default: derived from audit_signing_key)")
+	return cmd
+}
+
+// openAuditLog opens logFile, or the configured audit log if it is empty.
+func openAuditLog(opts *globalOptions, logFile string) (*os.File, error) {
+	if logFile == "" {
+		cfg, err := loadConfigFile(opts.configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %v", err)
+		}
+		logFile = cfg.AuditLog
+	}
+	if logFile == "" {
+		return nil, fmt.Errorf("no audit log configured: set audit_log or use --log-file")
+	}
+	f, err := os.Open(logFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	return f, nil
+}
+
+// fileHistory returns the records of the files whose name contains name,
+// including the records written after they were moved or renamed.
+func fileHistory(r io.Reader, name string) ([]audit.Record, error) {
+	name = strings.ToLower(name)
+	matches := func(path string) bool {
+		return path != "" && strings.Contains(strings.ToLower(filepath.Base(path)), name)
+	}
+	var records []audit.Record
+	ids := map[string]bool{}
+	err := audit.Read(r, func(rec audit.Record) {
+		if matches(rec.File) || matches(rec.Dest) {
+			ids[rec.ID] = true
+		}
+		if ids[rec.ID] {
+			records = append(records, rec)
+		}
+	})
+	return records, err
+}
+
+func writeAuditTable(out io.Writer, records []audit.Record) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tID\tEVENT\tFILE\tDETAILS")
+	for _, r := range records {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", r.Time.Local().Format(time.DateTime), r.ID, r.Event, r.File, auditDetails(r))
+	}
+	return tw.Flush()
+}
+
+// auditDetails summarizes the event specific fields of r.
+func auditDetails(r audit.Record) string {
+	var details []string
+	if r.SHA256 != "" {
+		details = append(details, "sha256="+r.SHA256)
+	}
+	if r.Attempt > 0 {
+		details = append(details, fmt.Sprintf("attempt=%d", r.Attempt+1))
+	}
+	if r.TaskID != "" {
+		details = append(details, "task="+r.TaskID)
+	}
+	if r.DocumentID != 0 {
+		details = append(details, fmt.Sprintf("document=%d", r.DocumentID))
+	}
+	if r.Dest != "" {
+		details = append(details, "to="+r.Dest)
+	}
+	if r.Error != "" {
+		details = append(details, "error="+r.Error)
+	}
+	return strings.Join(details, " ")
+}
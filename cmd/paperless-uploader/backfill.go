@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/backfill"
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/state"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+func newBackfillCmd(opts *globalOptions) *cobra.Command {
+	var (
+		tags           []string
+		concurrency    int
+		rate           float64
+		statePath      string
+		reportPath     string
+		skipDuplicates bool
+	)
+	cmd := &cobra.Command{
+		Use:   "backfill <directory>",
+		Short: "Import a large directory of historical documents",
+		Long: `Import a large directory of historical documents, e.g. an archive of tens of
+thousands of scans, recursively.
+
+Every file is checkpointed in a state file, or in the state store with the
+bbolt or sqlite state_backend, as soon as it is done, so an
+interrupted backfill continues where it stopped when run again; files that
+failed or changed since are uploaded again. Files whose content Paperless
+already has, or that duplicate another file of the directory, are skipped;
+with document_index configured, the local mirror is asked instead of the
+server.
+Uploads run with --concurrency at once, limited to --rate per second. Hidden
+files and directories are left out.
+
+A progress bar is shown on terminals. At the end a CSV report with the result
+of every file is written to --report, and the command exits with a non-zero
+status if any file failed.`,
+		Example: `  paperless-uploader backfill /mnt/archive --tag archive --concurrency 8 --rate 5`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := args[0]
+			if info, err := os.Stat(dir); err != nil {
+				return err
+			} else if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			if concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+			if rate < 0 {
+				return fmt.Errorf("--rate must not be negative")
+			}
+			cfg, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+			journal, statePath, closeJournal, err := openJournal(cfg, "backfill", dir, statePath)
+			if err != nil {
+				return err
+			}
+			defer closeJournal()
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Scanning %s...\n", dir)
+			files, err := backfill.Scan(dir)
+			if err != nil {
+				return err
+			}
+			if opts.dryRun {
+				var todo int
+				for _, f := range files {
+					if _, done := journal.Done(f); !done {
+						todo++
+					}
+				}
+				fmt.Fprintf(out, "[dry-run] Would upload up to %d of %d files with tags %v\n", todo, len(files), append(append([]string{}, cfg.Tags...), tags...))
+				return nil
+			}
+
+			tagIDs, err := resolveTagIDs(client, cfg.Tags)
+			if err != nil {
+				return err
+			}
+			adHocIDs, err := ensureTags(client, tags, true)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Backfilling %d files; progress is kept in %s\n", len(files), statePath)
+			bar := newProgressBar(cmd.ErrOrStderr(), "Backfill")
+			b := &backfill.Backfill{
+				Client:         client,
+				Options:        paperless.UploadOptions{Tags: mergeIDs(tagIDs, adHocIDs)},
+				Journal:        journal,
+				Concurrency:    concurrency,
+				Rate:           rate,
+				SkipDuplicates: skipDuplicates,
+				Progress:       bar.update,
+			}
+			if skipDuplicates && cfg.DocumentIndex.Path != "" {
+				index, err := openIndex(cfg)
+				if err != nil {
+					return err
+				}
+				defer index.Close()
+				refreshIndex(cmd.Context(), index, client)
+				b.Index = index
+			}
+			records, runErr := b.Run(cmd.Context(), files)
+			bar.finish()
+
+			if err := writeBackfillReport(reportPath, records); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Report written to %s\n", reportPath)
+			if runErr != nil {
+				return fmt.Errorf("backfill interrupted after %d of %d files; run it again to continue", len(records), len(files))
+			}
+			var failed int
+			for _, r := range records {
+				if r.Status == backfill.StatusFailed {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d files failed", failed, len(files))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "add a tag by name to every document (repeatable)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "number of concurrent uploads")
+	cmd.Flags().Float64Var(&rate, "rate", 0, "maximum uploads per second (0: unlimited)")
+	cmd.Flags().StringVar(&statePath, "state", "", "state file recording the progress (default: the state store with the bbolt or sqlite state_backend, else one file per directory in the user cache directory)")
+	cmd.Flags().StringVar(&reportPath, "report", "backfill-report.csv", "CSV file the results are written to")
+	cmd.Flags().BoolVar(&skipDuplicates, "skip-duplicates", true, "skip files whose content is already in Paperless")
+	return cmd
+}
+
+// openJournal opens the journal checkpointing a command of the kind, e.g.
+// "backfill", importing dir, and returns where it is kept and a function
+// closing it. The bbolt and sqlite stores keep the checkpoints of all
+// directories; the JSON store leaves them in a file per directory, unless
+// statePath names one.
+func openJournal(cfg *config.Config, kind, dir, statePath string) (*backfill.Journal, string, func(), error) {
+	if statePath == "" && cfg.StateBackend != "" && cfg.StateBackend != state.BackendJSON {
+		store, path, err := openState(cfg)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			store.Close()
+			return nil, "", nil, err
+		}
+		journal, err := backfill.OpenStoreJournal(store, kind+":"+abs)
+		if err != nil {
+			store.Close()
+			return nil, "", nil, fmt.Errorf("failed to open state store: %v", err)
+		}
+		return journal, path, func() { journal.Close(); store.Close() }, nil
+	}
+	if statePath == "" {
+		var err error
+		if statePath, err = defaultJournalPath(kind, dir); err != nil {
+			return nil, "", nil, err
+		}
+	}
+	journal, err := backfill.OpenJournal(statePath)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to open state file: %v", err)
+	}
+	return journal, statePath, func() { journal.Close() }, nil
+}
+
+// defaultJournalPath returns the state file of a command of the kind
+// importing dir, named after its absolute path.
+func defaultJournalPath(kind, dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("no cache directory for the state file, use --state: %v", err)
+	}
+	sum := sha256.Sum256([]byte(abs))
+	name := config.Namespaced(kind) + "-" + hex.EncodeToString(sum[:8]) + ".jsonl"
+	return filepath.Join(cache, "paperless-uploader", name), nil
+}
+
+// writeBackfillReport writes the CSV report of a backfill or migration.
+func writeBackfillReport(path string, records []backfill.Record) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	if err := backfill.WriteReport(f, records); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	return f.Close()
+}
+
+// progressBar shows the progress of a backfill on a terminal, and logs it
+// periodically otherwise.
+type progressBar struct {
+	out io.Writer
+	// label prefixes the logged progress.
+	label    string
+	terminal bool
+	start    time.Time
+	last     time.Time
+	progress backfill.Progress
+}
+
+const (
+	progressWidth = 30
+	// progressLogInterval is how often the progress is logged when the
+	// output is not a terminal.
+	progressLogInterval = 30 * time.Second
+)
+
+func newProgressBar(out io.Writer, label string) *progressBar {
+	f, ok := out.(*os.File)
+	return &progressBar{out: out, label: label, terminal: ok && isatty.IsTerminal(f.Fd()), start: time.Now()}
+}
+
+// update is called with every change of the progress.
+func (p *progressBar) update(progress backfill.Progress) {
+	p.progress = progress
+	interval := progressLogInterval
+	if p.terminal {
+		interval = 100 * time.Millisecond
+	}
+	if progress.Done < progress.Total && time.Since(p.last) < interval {
+		return
+	}
+	p.last = time.Now()
+	if p.terminal {
+		fmt.Fprintf(p.out, "\r%s", p.line())
+	} else {
+		logging.Infof("%s: %s", p.label, p.line())
+	}
+}
+
+// finish ends the bar.
+func (p *progressBar) finish() {
+	if p.terminal {
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *progressBar) line() string {
+	pr := p.progress
+	filled := progressWidth
+	percent := 100.0
+	if pr.Total > 0 {
+		filled = progressWidth * pr.Done / pr.Total
+		percent = 100 * float64(pr.Done) / float64(pr.Total)
+	}
+	line := fmt.Sprintf("[%s%s] %d/%d (%.1f%%) %d uploaded, %d duplicates, %d failed",
+		strings.Repeat("=", filled), strings.Repeat(" ", progressWidth-filled),
+		pr.Done, pr.Total, percent, pr.Uploaded, pr.Duplicates, pr.Failed)
+	if eta, ok := p.eta(); ok {
+		line += ", " + eta.Round(time.Second).String() + " left"
+	}
+	return line
+}
+
+// eta estimates the time left from the files done in this run.
+func (p *progressBar) eta() (time.Duration, bool) {
+	pr := p.progress
+	done := pr.Done - pr.Resumed
+	if done == 0 || pr.Done >= pr.Total {
+		return 0, false
+	}
+	perFile := time.Since(p.start) / time.Duration(done)
+	return perFile * time.Duration(pr.Total-pr.Done), true
+}
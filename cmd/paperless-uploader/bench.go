@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/bench"
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+func newBenchCmd(opts *globalOptions) *cobra.Command {
+	var (
+		count       int
+		size        string
+		concurrency int
+		rate        float64
+		tags        []string
+		taskTimeout time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Measure how fast Paperless ingests documents",
+		Long: `Measure how fast Paperless ingests documents, to size the concurrency and rate
+of a large backfill.
+
+--count synthetic single page PDFs of --size are generated in a temporary
+directory and uploaded with --concurrency at once, limited to --rate per
+second, like backfill does. Every consumption task is then waited for. The
+upload and end-to-end throughput and the percentiles of the upload and
+task-completion latency are printed.
+
+The documents are really created, tagged with --tag: run the benchmark
+against a test instance, or delete them afterwards. With --task-timeout 0
+the consumption is not waited for and only the uploads are measured.`,
+		Example: `  paperless-uploader bench --count 50 --size 2MB --concurrency 4`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if count < 1 {
+				return fmt.Errorf("--count must be at least 1")
+			}
+			if concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+			if rate < 0 {
+				return fmt.Errorf("--rate must not be negative")
+			}
+			docSize, err := config.ParseSize(size)
+			if err != nil {
+				return fmt.Errorf("invalid --size: %v", err)
+			}
+			_, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if opts.dryRun {
+				fmt.Fprintf(out, "[dry-run] Would upload %d documents of %s with concurrency %d and tags %v\n", count, formatBytes(uint64(docSize)), concurrency, tags)
+				return nil
+			}
+
+			dir, err := os.MkdirTemp("", "paperless-uploader-bench-")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(dir)
+			run := strconv.FormatInt(time.Now().Unix(), 36)
+			files, err := bench.Generate(dir, run, count, docSize)
+			if err != nil {
+				return err
+			}
+			tagIDs, err := ensureTags(client, tags, true)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(out, "Uploading %d documents of %s with concurrency %d...\n", count, formatBytes(uint64(docSize)), concurrency)
+			b := &bench.Bench{
+				Client:      client,
+				Options:     paperless.UploadOptions{Tags: tagIDs},
+				Concurrency: concurrency,
+				Rate:        rate,
+				TaskTimeout: taskTimeout,
+				Progress:    benchProgress(cmd.ErrOrStderr()),
+			}
+			result, runErr := b.Run(cmd.Context(), files)
+			printBenchResult(out, result, taskTimeout > 0)
+			if runErr != nil {
+				return fmt.Errorf("benchmark interrupted after %d of %d documents", len(result.Samples), count)
+			}
+			if failed := len(result.Samples) - len(result.Succeeded()); failed > 0 {
+				return fmt.Errorf("%d of %d documents failed", failed, count)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&count, "count", 20, "number of documents to upload")
+	cmd.Flags().StringVar(&size, "size", "1MB", "size of each document, e.g. 500KB or 2MB")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "number of concurrent uploads")
+	cmd.Flags().Float64Var(&rate, "rate", 0, "maximum uploads per second (0: unlimited)")
+	cmd.Flags().StringArrayVar(&tags, "tag", []string{"benchmark"}, "tag by name added to every document, created if missing (repeatable)")
+	cmd.Flags().DurationVar(&taskTimeout, "task-timeout", 10*time.Minute, "how long to wait for each document to be consumed (0: don't wait)")
+	return cmd
+}
+
+// benchProgress returns a progress callback that updates a line on
+// terminals and does nothing otherwise.
+func benchProgress(w io.Writer) func(done, total int) {
+	f, ok := w.(*os.File)
+	if !ok || !isatty.IsTerminal(f.Fd()) {
+		return nil
+	}
+	return func(done, total int) {
+		fmt.Fprintf(w, "\r%d/%d documents done", done, total)
+		if done == total {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+func printBenchResult(out io.Writer, r bench.Result, waited bool) {
+	ok := r.Succeeded()
+	fmt.Fprintf(out, "Documents:      %d succeeded, %d failed\n", len(ok), len(r.Samples)-len(ok))
+	for _, s := range r.Samples {
+		if s.Err != nil {
+			fmt.Fprintf(out, "  %s: %v\n", s.File, s.Err)
+		}
+	}
+	if len(ok) == 0 {
+		return
+	}
+	printThroughput(out, "Upload:", len(ok), r.Bytes(), r.Uploaded)
+	printLatency(out, "Upload latency:", r.UploadLatency())
+	if waited {
+		printThroughput(out, "End to end:", len(ok), r.Bytes(), r.Elapsed)
+		printLatency(out, "Task latency:", r.ConsumeLatency())
+	}
+}
+
+func printThroughput(out io.Writer, label string, docs int, bytes int64, d time.Duration) {
+	secs := d.Seconds()
+	if secs <= 0 {
+		return
+	}
+	fmt.Fprintf(out, "%-15s %s, %.2f documents/s, %s/s\n", label, d.Round(time.Millisecond),
+		float64(docs)/secs, formatBytes(uint64(float64(bytes)/secs)))
+}
+
+func printLatency(out io.Writer, label string, l bench.Latency) {
+	fmt.Fprintf(out, "%-15s p50 %s, p95 %s, max %s\n", label,
+		l.P50.Round(time.Millisecond), l.P95.Round(time.Millisecond), l.Max.Round(time.Millisecond))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/fetch"
+	"github.com/c-yco/go-paperless-uploader/internal/mqtt"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+const (
+	// defaultScanTimeout bounds scan profiles without a timeout.
+	defaultScanTimeout = 5 * time.Minute
+	// maxFetchSize limits documents uploaded by URL.
+	maxFetchSize = 256 << 20
+)
+
+// newMQTTCommands creates the MQTT commands configured by cfg, controlling
+// w.
+func newMQTTCommands(cfg config.MQTT, folders []watcher.Folder, w *watcher.Watcher) (mqtt.Commands, error) {
+	dest := folders[0].Path
+	if cfg.Folder != "" {
+		var err error
+		if dest, err = watchedFolder(folders, cfg.Folder); err != nil {
+			return mqtt.Commands{}, fmt.Errorf("invalid mqtt.folder: %v", err)
+		}
+	}
+	profiles := make(map[string]config.ScanProfile)
+	var names []string
+	for _, p := range cfg.ScanProfiles {
+		if p.Name == "" || len(p.Command) == 0 {
+			return mqtt.Commands{}, fmt.Errorf("mqtt scan profiles need a name and a command")
+		}
+		if _, ok := profiles[p.Name]; ok {
+			return mqtt.Commands{}, fmt.Errorf("duplicate mqtt scan profile %s", p.Name)
+		}
+		folder := folders[0].Path
+		if p.Folder != "" {
+			var err error
+			if folder, err = watchedFolder(folders, p.Folder); err != nil {
+				return mqtt.Commands{}, fmt.Errorf("invalid folder of mqtt scan profile %s: %v", p.Name, err)
+			}
+		}
+		p.Folder = folder
+		profiles[p.Name] = p
+		names = append(names, p.Name)
+	}
+	var uploadDirs []string
+	for _, dir := range cfg.UploadPaths {
+		abs, err := filepath.Abs(dir)
+		if err == nil {
+			abs, err = filepath.EvalSymlinks(abs)
+		}
+		if err != nil {
+			return mqtt.Commands{}, fmt.Errorf("invalid mqtt.upload_paths: %v", err)
+		}
+		uploadDirs = append(uploadDirs, abs)
+	}
+
+	// Scans run one at a time as they usually share a scanner.
+	var scanning sync.Mutex
+	return mqtt.Commands{
+		Controller: w,
+		Profiles:   names,
+		Scan: func(ctx context.Context, name string) error {
+			p, ok := profiles[name]
+			if !ok {
+				return fmt.Errorf("unknown scan profile %s", name)
+			}
+			scanning.Lock()
+			defer scanning.Unlock()
+			return runScanProfile(ctx, p)
+		},
+		Upload: func(ctx context.Context, ref string) (string, error) {
+			if strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+				return fetch.Download(ctx, nil, ref, nil, maxFetchSize, fetch.ToDir(dest))
+			}
+			return uploadLocalFile(ref, uploadDirs, dest)
+		},
+	}, nil
+}
+
+// runScanProfile runs the command of a scan profile in its folder.
+func runScanProfile(ctx context.Context, p config.ScanProfile) error {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = defaultScanTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Dir = p.Folder
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		msg := strings.TrimSpace(string(out))
+		if len(msg) > 512 {
+			msg = "..." + msg[len(msg)-512:]
+		}
+		if msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// uploadLocalFile copies the file at path into dest, provided it is within
+// one of the allowed directories.
+func uploadLocalFile(path string, allowed []string, dest string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err == nil {
+		abs, err = filepath.EvalSymlinks(abs)
+	}
+	if err != nil {
+		return "", err
+	}
+	permitted := false
+	for _, dir := range allowed {
+		if rel, err := filepath.Rel(dir, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			permitted = true
+			break
+		}
+	}
+	if !permitted {
+		return "", fmt.Errorf("%s is not within mqtt.upload_paths", path)
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil {
+		return "", err
+	} else if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	return watcher.Deliver(dest, filepath.Base(abs), f)
+}
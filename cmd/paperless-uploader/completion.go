@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/spf13/cobra"
+)
+
+func newCompletionCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion bash|zsh|fish|powershell",
+		Short: "Generate a shell completion script",
+		Long: `Generate a shell completion script. Tag names are completed from the
+configured Paperless server.
+
+  bash:       source <(paperless-uploader completion bash)
+  zsh:        paperless-uploader completion zsh > "${fpath[1]}/_paperless-uploader"
+  fish:       paperless-uploader completion fish | source
+  powershell: paperless-uploader completion powershell | Out-String | Invoke-Expression`,
+		Args:                  cobra.ExactArgs(1),
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		DisableFlagsInUseLine: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			root := cmd.Root()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletionV2(out, true)
+			case "zsh":
+				return root.GenZshCompletion(out)
+			case "fish":
+				return root.GenFishCompletion(out, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(out)
+			default:
+				return fmt.Errorf("unsupported shell %q: must be bash, zsh, fish or powershell", args[0])
+			}
+		},
+	}
+}
+
+// completeTagNames completes tag names from the Paperless server. Errors are
+// reported to the shell as no completions.
+func completeTagNames(opts *globalOptions) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		// Loading through opts would log the configuration into the
+		// completion output.
+		cfg, err := loadConfigFile(opts.configFile)
+		if err != nil {
+			cobra.CompErrorln(err.Error())
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		tags, err := paperless.NewClient(cfg.PaperlessURL, cfg.APIKey).GetTags()
+		if err != nil {
+			cobra.CompErrorln(err.Error())
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var names []string
+		for _, tag := range tags {
+			names = append(names, tag.Name)
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// registerTagCompletion enables tag name completion for the --tag flag of
+// cmd.
+func registerTagCompletion(cmd *cobra.Command, opts *globalOptions) {
+	if err := cmd.RegisterFlagCompletionFunc("tag", completeTagNames(opts)); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to register tag completion: %v\n", err)
+	}
+}
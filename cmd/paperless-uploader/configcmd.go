@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+func newConfigCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Create and inspect the configuration",
+	}
+	cmd.AddCommand(newConfigInitCmd(), newConfigPathCmd(opts))
+	return cmd
+}
+
+func newConfigInitCmd() *cobra.Command {
+	var force bool
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create an example config.yaml file in the current directory",
+		Long:  "Create an example config.yaml file in the current directory, or config-<name>.yaml with --instance.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := config.FileName()
+			if _, err := os.Stat(name); err == nil && !force {
+				return fmt.Errorf("%s already exists. Use --force to overwrite", name)
+			}
+			if err := os.WriteFile(name, []byte(exampleConfig), 0644); err != nil {
+				return fmt.Errorf("failed to write config file: %v", err)
+			}
+			if force {
+				logging.Infof("Overwrote existing %s with example configuration.", name)
+			} else {
+				logging.Infof("Created example %s. Please edit it with your details.", name)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&force, "force", false, "overwrite an existing config file")
+	return cmd
+}
+
+func newConfigPathCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "path",
+		Short: "Print the config file that would be used",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := opts.configFile
+			if path == "" {
+				path = config.Find()
+			}
+			if path == "" {
+				return fmt.Errorf("no config file found in %v", config.SearchPaths())
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), path)
+			return nil
+		},
+	}
+}
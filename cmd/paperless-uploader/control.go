@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/control"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/systemd"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/spf13/cobra"
+)
+
+// errReload cancels a watch run to restart it with the reloaded
+// configuration.
+var errReload = errors.New("configuration reloaded")
+
+// controller serves the control socket of the watch command and restarts
+// its run when the configuration is reloaded.
+type controller struct {
+	*control.Server
+	configFile string
+	dryRun     bool
+
+	mu     sync.Mutex
+	w      *watcher.Watcher
+	cfg    *config.Config
+	client *paperless.Client
+	cancel context.CancelCauseFunc
+	// paused carries the paused state of a watcher over to the one started
+	// by a reload.
+	paused bool
+	// retrying serializes retries of the failed folder.
+	retrying sync.Mutex
+}
+
+func newController(path string, opts *globalOptions) *controller {
+	c := &controller{Server: control.NewServer(path), configFile: opts.configFile, dryRun: opts.dryRun}
+	c.Reload = c.reload
+	c.RetryFailed = c.retryFailed
+	return c
+}
+
+// run calls run, again after every reload, until it returns for another
+// reason.
+func (c *controller) run(ctx context.Context, run func(context.Context) error) error {
+	for {
+		runCtx, cancel := context.WithCancelCause(ctx)
+		c.mu.Lock()
+		c.cancel = cancel
+		c.mu.Unlock()
+		err := run(runCtx)
+		reload := errors.Is(context.Cause(runCtx), errReload) && ctx.Err() == nil
+		cancel(nil)
+		if !reload {
+			return err
+		}
+		logging.Infof("Restarting with the reloaded configuration")
+	}
+}
+
+// attach makes w, running with cfg and client, the watcher managed through
+// the socket.
+func (c *controller) attach(w *watcher.Watcher, cfg *config.Config, client *paperless.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		w.Pause()
+	}
+	c.w, c.cfg, c.client = w, cfg, client
+	c.SetWatcher(w)
+}
+
+// detach is called when the watcher of attach stopped.
+func (c *controller) detach() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = c.w.Status().Paused
+	c.w, c.cfg, c.client = nil, nil, nil
+	c.SetWatcher(nil)
+}
+
+// reload validates the configuration file and restarts the watch run with
+// it.
+func (c *controller) reload() error {
+	if _, err := loadConfigFile(c.configFile); err != nil {
+		return fmt.Errorf("invalid configuration, keeping the current one: %v", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel == nil {
+		return errors.New("the watcher is not running")
+	}
+	if _, err := systemd.Notify("RELOADING=1"); err != nil {
+		logging.Warnf("Failed to notify systemd: %v", err)
+	}
+	c.cancel(errReload)
+	return nil
+}
+
+// retryFailed uploads the files in the failed folder with the
+// configuration of the running watcher.
+func (c *controller) retryFailed() (control.RetryResult, error) {
+	c.mu.Lock()
+	cfg, client := c.cfg, c.client
+	c.mu.Unlock()
+	if cfg == nil {
+		return control.RetryResult{}, errors.New("the watcher is restarting")
+	}
+	c.retrying.Lock()
+	defer c.retrying.Unlock()
+	result, err := retryAllFailed(cfg, client, c.dryRun, logging.Infof)
+	if err != nil {
+		return control.RetryResult{}, err
+	}
+	remote := control.RetryResult{Succeeded: result.Succeeded, Failed: []control.RetryFailure{}}
+	for _, f := range result.Failed {
+		remote.Failed = append(remote.Failed, control.RetryFailure{Path: f.Path, Error: f.Err.Error()})
+	}
+	return remote, nil
+}
+
+// fromRetryResult converts the result of a retry by the running watcher.
+func fromRetryResult(remote *control.RetryResult) *uploadResult {
+	result := &uploadResult{Succeeded: remote.Succeeded}
+	for _, f := range remote.Failed {
+		result.fail(f.Path, errors.New(f.Error))
+	}
+	return result
+}
+
+// controlClient returns a client for the control socket of the configured
+// instance. The rest of the configuration is not validated, so that a
+// reload can report what is wrong with it.
+func controlClient(opts *globalOptions) (*control.Client, error) {
+	configMu.Lock()
+	cfg, err := config.LoadFile(opts.configFile)
+	configMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %v", err)
+	}
+	if cfg.ControlSocket == "" {
+		return nil, fmt.Errorf("control_socket is not configured")
+	}
+	return control.NewClient(cfg.ControlSocket), nil
+}
+
+// newControlCmd creates a command running fn against the control socket.
+func newControlCmd(opts *globalOptions, use, short, long string, fn func(c *control.Client, out io.Writer) error) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long + "\n\nThe running watcher is reached through control_socket.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := controlClient(opts)
+			if err != nil {
+				return err
+			}
+			return fn(client, cmd.OutOrStdout())
+		},
+	}
+}
+
+func newPauseCmd(opts *globalOptions) *cobra.Command {
+	return newControlCmd(opts, "pause", "Pause the uploads of the running watcher",
+		`Pause the uploads of the running watcher. The upload in progress completes;
+new files are still detected and queued until 'resume'.`,
+		func(c *control.Client, out io.Writer) error {
+			if _, err := c.Pause(); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Processing paused.")
+			return nil
+		})
+}
+
+func newResumeCmd(opts *globalOptions) *cobra.Command {
+	return newControlCmd(opts, "resume", "Resume the uploads of the running watcher",
+		"Resume the uploads of the running watcher after 'pause'.",
+		func(c *control.Client, out io.Writer) error {
+			if _, err := c.Resume(); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Processing resumed.")
+			return nil
+		})
+}
+
+func newRescanCmd(opts *globalOptions) *cobra.Command {
+	return newControlCmd(opts, "rescan", "Make the running watcher rescan its folders",
+		`Make the running watcher look for files in its folders that it did not pick
+up, e.g. because they were copied in while it was stopped.`,
+		func(c *control.Client, out io.Writer) error {
+			if err := c.Rescan(); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Rescan triggered.")
+			return nil
+		})
+}
+
+func newFlushCmd(opts *globalOptions) *cobra.Command {
+	return newControlCmd(opts, "flush", "Upload the files the running watcher holds back",
+		`Queue the files the running watcher holds back for their settle delay or
+until their next retry for upload right away.`,
+		func(c *control.Client, out io.Writer) error {
+			n, err := c.Flush()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Queued %d files for upload.\n", n)
+			return nil
+		})
+}
+
+func newReloadCmd(opts *globalOptions) *cobra.Command {
+	return newControlCmd(opts, "reload", "Make the running watcher reload its configuration",
+		`Make the running watcher load its configuration file again and restart with
+it. An invalid configuration is reported and the running watcher keeps the
+current one. The upload in progress completes first; files still waiting
+are picked up again by the restarted watcher. control_socket and run_as only
+change with a restart of the service, as do ports below 1024 once run_as
+dropped the privileges.`,
+		func(c *control.Client, out io.Writer) error {
+			if err := c.Reload(); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Configuration reloaded.")
+			return nil
+		})
+}
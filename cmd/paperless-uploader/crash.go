@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+)
+
+// fatal prints err, with the registered secrets redacted, and exits.
+func fatal(err error) {
+	log.Fatalf("Error: %s", logging.Redact(err.Error()))
+}
+
+// reportPanic recovers a panic of the main goroutine and prints it with the
+// registered secrets redacted, instead of the runtime printing it as is.
+func reportPanic() {
+	if r := recover(); r != nil {
+		fmt.Fprintf(os.Stderr, "panic: %s\n\n%s", logging.Redact(fmt.Sprint(r)), logging.Redact(string(debug.Stack())))
+		os.Exit(2)
+	}
+}
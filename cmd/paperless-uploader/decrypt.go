@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/c-yco/go-paperless-uploader/internal/atrest"
+	"github.com/spf13/cobra"
+)
+
+func newDecryptCmd(opts *globalOptions) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "decrypt FILE.enc...",
+		Short: "Decrypt files from the processed and failed folders",
+		Long: `Decrypt files that were encrypted with encryption.key_file when moved to
+processed_folder or failed_folder. Each file is written without its ".enc"
+suffix next to the encrypted one, or into --output. The encrypted files are
+kept.`,
+		Example: `  paperless-uploader decrypt processed/invoice.pdf.enc --output ~/Downloads`,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+			key, err := encryptionKey(cfg)
+			if err != nil {
+				return err
+			}
+			if key == nil {
+				return fmt.Errorf("encryption.key_file is not configured")
+			}
+			for _, path := range args {
+				if !strings.HasSuffix(path, atrest.Suffix) {
+					return fmt.Errorf("%s does not end in %s", path, atrest.Suffix)
+				}
+				dest := strings.TrimSuffix(path, atrest.Suffix)
+				if output != "" {
+					dest = filepath.Join(output, filepath.Base(dest))
+				}
+				if opts.dryRun {
+					fmt.Fprintf(cmd.OutOrStdout(), "[dry-run] Would decrypt %s to %s\n", path, dest)
+					continue
+				}
+				if err := atrest.DecryptFile(key, path, dest); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Decrypted %s to %s\n", path, dest)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "directory to write the decrypted files to (default: next to the encrypted files)")
+	return cmd
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/spf13/cobra"
+)
+
+// Thresholds used by the doctor checks.
+const (
+	minInotifyWatches = 8192
+	minFreeSpace      = 500 << 20 // bytes
+	maxClockSkew      = time.Minute
+	certExpiryWarning = 14 * 24 * time.Hour
+)
+
+type checkState int
+
+const (
+	checkPass checkState = iota
+	checkWarn
+	checkFail
+	checkSkip
+)
+
+func (s checkState) String() string {
+	return [...]string{"PASS", "WARN", "FAIL", "SKIP"}[s]
+}
+
+// checkResult is the outcome of a single doctor check.
+type checkResult struct {
+	name   string
+	state  checkState
+	detail string
+	hint   string
+}
+
+// doctor runs the diagnostics against a loaded configuration.
+type doctor struct {
+	cfg     *config.Config
+	client  *paperless.Client
+	path    string
+	results []checkResult
+}
+
+func (d *doctor) add(name string, state checkState, detail, hint string) {
+	d.results = append(d.results, checkResult{name: name, state: state, detail: detail, hint: hint})
+}
+
+func newDoctorCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnose common setup problems",
+		Long: `Check the configuration and environment for common problems: connectivity
+to Paperless, the TLS certificate chain, the API token, the Paperless version,
+inotify limits, folder permissions, clock skew and free disk space.
+
+Every check prints PASS, WARN, FAIL or SKIP, with a hint on how to fix
+problems. The command exits with a non-zero status if any check fails.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d := &doctor{path: opts.configFile}
+			if d.path == "" {
+				d.path = config.Find()
+			}
+			cfg, err := loadConfigFile(opts.configFile)
+			if err != nil {
+				d.add("Configuration", checkFail, err.Error(), "run 'paperless-uploader config init' or pass --config")
+				return d.report(cmd.OutOrStdout())
+			}
+			d.cfg = cfg
+			d.client = newClient(cfg)
+
+			d.checkConfig()
+			if d.checkConnectivity() {
+				d.checkTLS()
+				d.checkToken()
+				d.checkClock()
+			}
+			d.checkInotify()
+			d.checkFolders()
+			d.checkDiskSpace()
+			d.checkContentExtraction()
+			return d.report(cmd.OutOrStdout())
+		},
+	}
+}
+
+func (d *doctor) report(out io.Writer) error {
+	var failed int
+	for _, r := range d.results {
+		fmt.Fprintf(out, "[%s] %s: %s\n", r.state, r.name, r.detail)
+		if r.hint != "" && (r.state == checkWarn || r.state == checkFail) {
+			fmt.Fprintf(out, "       hint: %s\n", r.hint)
+		}
+		if r.state == checkFail {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(d.results))
+	}
+	return nil
+}
+
+func (d *doctor) checkConfig() {
+	if d.path == "" {
+		d.add("Configuration", checkWarn, "no config file found, using defaults and environment", fmt.Sprintf("create one with 'paperless-uploader config init' in one of %v", config.SearchPaths()))
+	} else {
+		d.add("Configuration", checkPass, d.path, "")
+	}
+	if d.cfg.APIKey == "" || d.cfg.APIKey == "your-api-key" {
+		d.add("API key", checkFail, "api_key is not set", "set api_key in the config file or UPLOADER_API_KEY")
+	}
+}
+
+// paperlessURL parses the configured URL, adding the default port.
+func (d *doctor) paperlessURL() (*url.URL, string, error) {
+	u, err := url.Parse(d.cfg.PaperlessURL)
+	if err != nil || u.Host == "" {
+		return nil, "", fmt.Errorf("invalid paperless_url %q", d.cfg.PaperlessURL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, addr, nil
+}
+
+func (d *doctor) checkConnectivity() bool {
+	_, addr, err := d.paperlessURL()
+	if err != nil {
+		d.add("Connectivity", checkFail, err.Error(), "paperless_url must look like http://paperless.local:8000")
+		return false
+	}
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		d.add("Connectivity", checkFail, err.Error(), "check that Paperless is running and that the host name, port and firewall allow the connection")
+		return false
+	}
+	conn.Close()
+	d.add("Connectivity", checkPass, "connected to "+addr, "")
+	return true
+}
+
+func (d *doctor) checkTLS() {
+	u, addr, err := d.paperlessURL()
+	if err != nil {
+		return
+	}
+	if u.Scheme != "https" {
+		d.add("TLS", checkSkip, "paperless_url does not use https", "")
+		return
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: u.Hostname()})
+	if err != nil {
+		d.add("TLS", checkFail, err.Error(), "install the CA that signed the Paperless certificate or fix the certificate's host names")
+		return
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	leaf := certs[0]
+	detail := fmt.Sprintf("%s issued by %s, %d certificate(s) in chain, expires %s", leaf.Subject.CommonName, leaf.Issuer.CommonName, len(certs), leaf.NotAfter.Format("2006-01-02"))
+	if time.Until(leaf.NotAfter) < certExpiryWarning {
+		d.add("TLS", checkWarn, detail, "renew the Paperless certificate soon")
+		return
+	}
+	d.add("TLS", checkPass, detail, "")
+}
+
+func (d *doctor) checkToken() {
+	if err := d.client.Ping(); err != nil {
+		hint := "check that paperless_url points at the Paperless web server"
+		if strings.Contains(err.Error(), "401") || strings.Contains(err.Error(), "403") {
+			hint = "create a new API token in Paperless under your profile and update api_key"
+		}
+		d.add("API token", checkFail, err.Error(), hint)
+		return
+	}
+	d.add("API token", checkPass, "accepted by the server", "")
+
+	version, err := d.client.GetServerVersion()
+	if err != nil {
+		d.add("Paperless version", checkWarn, err.Error(), "upgrade to a current Paperless-ngx release")
+		return
+	}
+	d.add("Paperless version", checkPass, "Paperless-ngx "+version, "")
+
+	caps, err := d.client.Negotiate()
+	if err != nil {
+		d.add("API version", checkWarn, err.Error(), "upgrade to a current Paperless-ngx release")
+		return
+	}
+	detail := fmt.Sprintf("using API version %d", caps.APIVersion)
+	if caps.APIVersion == 0 {
+		detail = "the server did not report its API versions"
+	}
+	if missing := caps.Missing(); len(missing) > 0 {
+		d.add("API version", checkWarn, detail+"; no "+strings.Join(missing, ", "), "upgrade Paperless-ngx to use these features")
+		return
+	}
+	d.add("API version", checkPass, detail, "")
+}
+
+func (d *doctor) checkClock() {
+	resp, err := d.client.HTTPClient.Get(d.cfg.PaperlessURL + "/api/")
+	if err != nil {
+		d.add("Clock skew", checkSkip, err.Error(), "")
+		return
+	}
+	resp.Body.Close()
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		d.add("Clock skew", checkSkip, "server did not send a Date header", "")
+		return
+	}
+	skew := time.Since(serverTime).Round(time.Second)
+	if skew < 0 {
+		skew = -skew
+	}
+	detail := fmt.Sprintf("local clock differs from the server by %s", skew)
+	if skew > maxClockSkew {
+		d.add("Clock skew", checkWarn, detail, "synchronise the clocks with NTP; the skew affects created dates and TLS validation")
+		return
+	}
+	d.add("Clock skew", checkPass, detail, "")
+}
+
+func (d *doctor) checkInotify() {
+	data, err := os.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		d.add("Inotify limits", checkSkip, "not available on this system", "")
+		return
+	}
+	watches, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		d.add("Inotify limits", checkSkip, "could not parse max_user_watches", "")
+		return
+	}
+	detail := fmt.Sprintf("max_user_watches=%d", watches)
+	if watches < minInotifyWatches {
+		d.add("Inotify limits", checkWarn, detail, fmt.Sprintf("raise the limit, e.g. sysctl fs.inotify.max_user_watches=%d", minInotifyWatches*8))
+		return
+	}
+	d.add("Inotify limits", checkPass, detail, "")
+}
+
+// checkContentExtraction checks that the text extraction commands are
+// installed if rules match the content of files.
+func (d *doctor) checkContentExtraction() {
+	needed := false
+	for _, r := range d.cfg.Rules {
+		needed = needed || r.Match.Content != ""
+	}
+	if !needed {
+		return
+	}
+	x := d.cfg.ContentExtraction
+	for _, command := range [][]string{x.PDFCommand, x.ScannedPDFCommand, x.ImageCommand} {
+		if len(command) == 0 {
+			continue
+		}
+		name := "Content extraction " + command[0]
+		if path, err := exec.LookPath(command[0]); err != nil {
+			d.add(name, checkFail, "not found", "install it or change content_extraction")
+		} else {
+			d.add(name, checkPass, path, "")
+		}
+	}
+}
+
+func (d *doctor) checkFolders() {
+	for _, folder := range d.cfg.WatchFolders() {
+		d.checkFolder("Watch folder "+folder.Path, folder.Path)
+	}
+	if d.cfg.PostUploadAction == "move" {
+		d.checkFolder("Processed folder "+d.cfg.ProcessedFolder, d.cfg.ProcessedFolder)
+	}
+}
+
+// checkFolder checks that dir is a writable directory. Missing directories
+// are created by the watcher, so only their parent must be writable.
+func (d *doctor) checkFolder(name, dir string) {
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		parent := filepath.Dir(filepath.Clean(dir))
+		if err := checkWritable(parent); err != nil {
+			d.add(name, checkFail, "does not exist and cannot be created: "+err.Error(), "create the folder or fix the permissions of "+parent)
+			return
+		}
+		d.add(name, checkWarn, "does not exist yet", "it will be created on start")
+		return
+	}
+	if err != nil {
+		d.add(name, checkFail, err.Error(), "fix the folder permissions")
+		return
+	}
+	if !info.IsDir() {
+		d.add(name, checkFail, "is not a directory", "point the setting at a directory")
+		return
+	}
+	if err := checkWritable(dir); err != nil {
+		d.add(name, checkFail, "not writable: "+err.Error(), "grant the user running the uploader write access")
+		return
+	}
+	d.add(name, checkPass, "readable and writable", "")
+}
+
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".paperless-uploader-doctor-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+func (d *doctor) checkDiskSpace() {
+	for _, folder := range d.cfg.WatchFolders() {
+		name := "Disk space " + folder.Path
+		dir := folder.Path
+		if _, err := os.Stat(dir); err != nil {
+			dir = filepath.Dir(filepath.Clean(dir))
+		}
+		free, err := diskFree(dir)
+		if err != nil {
+			d.add(name, checkSkip, err.Error(), "")
+			continue
+		}
+		detail := fmt.Sprintf("%s free", formatBytes(free))
+		if free < minFreeSpace {
+			d.add(name, checkWarn, detail, "free up space; scanners and the move action need room for new files")
+			continue
+		}
+		d.add(name, checkPass, detail, "")
+	}
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/spf13/cobra"
+)
+
+func newDocumentsCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "documents",
+		Aliases: []string{"docs"},
+		Short:   "Find documents in Paperless",
+	}
+	cmd.AddCommand(
+		newDocumentsSearchCmd(opts),
+		newDocumentsDownloadCmd(opts),
+	)
+	return cmd
+}
+
+func newDocumentsSearchCmd(opts *globalOptions) *cobra.Command {
+	var (
+		tags          []string
+		correspondent string
+		documentType  string
+		createdAfter  string
+		createdBefore string
+		limit         int
+		output        string
+	)
+	cmd := &cobra.Command{
+		Use:   "search [query]",
+		Short: "Search documents by full text query and filters",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid output format %q: must be table or json", output)
+			}
+			for _, date := range []string{createdAfter, createdBefore} {
+				if date == "" {
+					continue
+				}
+				if _, err := time.Parse("2006-01-02", date); err != nil {
+					return fmt.Errorf("invalid date %q: expected YYYY-MM-DD", date)
+				}
+			}
+
+			_, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+
+			filter := paperless.DocumentFilter{
+				CreatedAfter:  createdAfter,
+				CreatedBefore: createdBefore,
+				Limit:         limit,
+			}
+			if len(args) == 1 {
+				filter.Query = args[0]
+			}
+			if filter.TagIDs, err = lookupTagIDs(client, tags); err != nil {
+				return err
+			}
+			if filter.CorrespondentID, err = lookupCorrespondent(client, correspondent); err != nil {
+				return err
+			}
+			if filter.DocumentTypeID, err = lookupDocumentType(client, documentType); err != nil {
+				return err
+			}
+
+			docs, err := client.ListDocuments(filter)
+			if err != nil {
+				return fmt.Errorf("failed to search documents: %v", err)
+			}
+			if output == "json" {
+				return writeJSON(cmd.OutOrStdout(), docs)
+			}
+			return writeDocumentTable(cmd.OutOrStdout(), client, docs)
+		},
+	}
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "only documents with this tag (repeatable)")
+	registerTagCompletion(cmd, opts)
+	cmd.Flags().StringVar(&correspondent, "correspondent", "", "only documents from this correspondent")
+	cmd.Flags().StringVar(&documentType, "document-type", "", "only documents of this type")
+	cmd.Flags().StringVar(&createdAfter, "created-after", "", "only documents created on or after this date (YYYY-MM-DD)")
+	cmd.Flags().StringVar(&createdBefore, "created-before", "", "only documents created on or before this date (YYYY-MM-DD)")
+	cmd.Flags().IntVar(&limit, "limit", 25, "maximum number of documents to show (0 for all)")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	return cmd
+}
+
+func writeDocumentTable(out io.Writer, client *paperless.Client, docs []paperless.Document) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tCREATED\tTITLE\tLINK")
+	for _, doc := range docs {
+		created := doc.Created
+		if len(created) > 10 {
+			created = created[:10]
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", doc.ID, created, doc.Title, client.DocumentURL(doc.ID))
+	}
+	return tw.Flush()
+}
+
+// lookupTagIDs resolves tag names or IDs, failing on unknown tags.
+func lookupTagIDs(client *paperless.Client, names []string) ([]int, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	tags, err := client.GetTags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags from Paperless: %v", err)
+	}
+	var ids []int
+	for _, name := range names {
+		tag, ok := findTag(tags, name)
+		if !ok {
+			return nil, fmt.Errorf("tag %q not found", name)
+		}
+		ids = append(ids, tag.ID)
+	}
+	return ids, nil
+}
+
+// lookupCorrespondent resolves a correspondent name or ID. An empty name
+// returns nil.
+func lookupCorrespondent(client *paperless.Client, name string) (*int, error) {
+	if name == "" {
+		return nil, nil
+	}
+	items, err := client.GetCorrespondents()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get correspondents from Paperless: %v", err)
+	}
+	for _, item := range items {
+		if matchesNameOrID(item.ID, item.Name, name) {
+			return &item.ID, nil
+		}
+	}
+	return nil, fmt.Errorf("correspondent %q not found", name)
+}
+
+// lookupDocumentType resolves a document type name or ID. An empty name
+// returns nil.
+func lookupDocumentType(client *paperless.Client, name string) (*int, error) {
+	if name == "" {
+		return nil, nil
+	}
+	items, err := client.GetDocumentTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document types from Paperless: %v", err)
+	}
+	for _, item := range items {
+		if matchesNameOrID(item.ID, item.Name, name) {
+			return &item.ID, nil
+		}
+	}
+	return nil, fmt.Errorf("document type %q not found", name)
+}
+
+// lookupStoragePath resolves a storage path name or ID. An empty name
+// returns nil.
+func lookupStoragePath(client *paperless.Client, name string) (*int, error) {
+	if name == "" {
+		return nil, nil
+	}
+	items, err := client.GetStoragePaths()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage paths from Paperless: %v", err)
+	}
+	for _, item := range items {
+		if matchesNameOrID(item.ID, item.Name, name) {
+			return &item.ID, nil
+		}
+	}
+	return nil, fmt.Errorf("storage path %q not found", name)
+}
+
+func matchesNameOrID(id int, name, nameOrID string) bool {
+	if n, err := strconv.Atoi(nameOrID); err == nil && n == id {
+		return true
+	}
+	return strings.EqualFold(name, nameOrID)
+}
+
+func newDocumentsDownloadCmd(opts *globalOptions) *cobra.Command {
+	var (
+		archive  bool
+		original bool
+		output   string
+		all      bool
+		tags     []string
+	)
+	cmd := &cobra.Command{
+		Use:   "download [id...]",
+		Short: "Download documents by ID, or all documents matching filters",
+		Long: `Download documents by ID, or all documents matching filters with --all.
+
+By default the archived version is downloaded when Paperless has one. With a
+single ID, --output may name the destination file; otherwise it is the
+directory the files are written to (created if necessary). Files already in
+the directory are not overwritten: a document whose file name is taken, e.g.
+by another document of the same name, is reported as failed.`,
+		Example: `  paperless-uploader documents download 42 -o invoice.pdf
+  paperless-uploader documents download --tag invoice --all -o exports/`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if archive && original {
+				return fmt.Errorf("--archive and --original are mutually exclusive")
+			}
+			if len(args) > 0 && all {
+				return fmt.Errorf("document IDs cannot be combined with --all")
+			}
+			if len(args) == 0 && !all {
+				return fmt.Errorf("either document IDs or --all is required")
+			}
+			if len(tags) > 0 && !all {
+				return fmt.Errorf("--tag requires --all")
+			}
+
+			var ids []int
+			for _, arg := range args {
+				id, err := strconv.Atoi(arg)
+				if err != nil {
+					return fmt.Errorf("invalid document ID %q", arg)
+				}
+				ids = append(ids, id)
+			}
+
+			_, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+
+			if all {
+				tagIDs, err := lookupTagIDs(client, tags)
+				if err != nil {
+					return err
+				}
+				docs, err := client.ListDocuments(paperless.DocumentFilter{TagIDs: tagIDs})
+				if err != nil {
+					return fmt.Errorf("failed to list documents: %v", err)
+				}
+				for _, doc := range docs {
+					ids = append(ids, doc.ID)
+				}
+			}
+
+			// A single download may be written to an explicit file name.
+			toFile := len(ids) == 1 && output != "" && !all
+			if info, err := os.Stat(output); err == nil && info.IsDir() {
+				toFile = false
+			}
+			if !toFile && output != "" {
+				if err := os.MkdirAll(output, 0755); err != nil {
+					return fmt.Errorf("failed to create output directory: %v", err)
+				}
+			}
+
+			var failed int
+			for _, id := range ids {
+				path, err := downloadDocument(client, id, original, output, toFile)
+				if err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%v\n", err)
+					failed++
+					continue
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Downloaded document %d to %s\n", id, path)
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed to download %d of %d documents", failed, len(ids))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&archive, "archive", false, "download the archived (OCRed) version (default)")
+	cmd.Flags().BoolVar(&original, "original", false, "download the original file")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "destination file or directory (default: current directory)")
+	cmd.Flags().BoolVar(&all, "all", false, "download all documents matching the filters")
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "with --all, only documents with this tag (repeatable)")
+	registerTagCompletion(cmd, opts)
+	return cmd
+}
+
+// downloadDocument writes a document to output, which is the destination
+// file when toFile is set and the destination directory otherwise. Existing
+// files in the directory are not overwritten.
+func downloadDocument(client *paperless.Client, id int, original bool, output string, toFile bool) (string, error) {
+	body, filename, err := client.DownloadDocument(id, original)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	path := output
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !toFile {
+		path = filepath.Join(output, filename)
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, 0666)
+	if errors.Is(err, fs.ErrExist) {
+		return "", fmt.Errorf("not downloading document %d: %s already exists", id, path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", path, err)
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return path, nil
+}
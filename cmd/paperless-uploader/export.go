@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/export"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/spf13/cobra"
+)
+
+func newExportCmd(opts *globalOptions) *cobra.Command {
+	var (
+		tags          []string
+		correspondent string
+		documentType  string
+		createdAfter  string
+		createdBefore string
+		layout        string
+		original      bool
+		prune         bool
+	)
+	cmd := &cobra.Command{
+		Use:   "export [directory]",
+		Short: "Back up the documents in Paperless into a local folder",
+		Long: `Back up the documents in Paperless, or those matching the filters, into a
+local folder, by default export.dir.
+
+Documents are filed by --layout, a template of their path without extension,
+by default by correspondent and year. The archived (OCRed) versions are
+exported unless --original is given. A state file in the folder records the
+exported documents, so later exports only download documents added or
+changed since; documents whose path changed are moved. With --prune,
+exported documents that were deleted from Paperless are removed.
+
+The command exits with a non-zero status if any document failed; those are
+retried by the next export.`,
+		Example: `  paperless-uploader export /mnt/backup/paperless
+  paperless-uploader export /mnt/backup/taxes --tag taxes --original \
+    --layout '{{.Year}}/{{.Correspondent}} {{.Title}}'`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, date := range []string{createdAfter, createdBefore} {
+				if date == "" {
+					continue
+				}
+				if _, err := time.Parse("2006-01-02", date); err != nil {
+					return fmt.Errorf("invalid date %q: expected YYYY-MM-DD", date)
+				}
+			}
+			cfg, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+			e := &export.Exporter{
+				Client:   client,
+				Dir:      cfg.Export.Dir,
+				Layout:   cfg.Export.Layout,
+				Original: cfg.Export.Original,
+				Prune:    cfg.Export.Prune,
+				Filter: paperless.DocumentFilter{
+					CreatedAfter:  createdAfter,
+					CreatedBefore: createdBefore,
+				},
+			}
+			if len(args) == 1 {
+				e.Dir = args[0]
+			}
+			if e.Dir == "" {
+				return fmt.Errorf("no export directory given and export.dir is not configured")
+			}
+			if cmd.Flags().Changed("layout") {
+				e.Layout = layout
+			}
+			if cmd.Flags().Changed("original") {
+				e.Original = original
+			}
+			if cmd.Flags().Changed("prune") {
+				e.Prune = prune
+			}
+			if e.Filter.TagIDs, err = lookupTagIDs(client, tags); err != nil {
+				return err
+			}
+			if e.Filter.CorrespondentID, err = lookupCorrespondent(client, correspondent); err != nil {
+				return err
+			}
+			if e.Filter.DocumentTypeID, err = lookupDocumentType(client, documentType); err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			e.Progress = func(id int, path string, removed bool, err error) {
+				switch {
+				case err != nil:
+					logging.Errorf("Failed to export document %d: %v", id, err)
+				case removed:
+					fmt.Fprintf(out, "Removed document %d: %s\n", id, path)
+				default:
+					fmt.Fprintf(out, "Exported document %d: %s\n", id, path)
+				}
+			}
+			stats, err := e.Run(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("export failed: %v", err)
+			}
+			fmt.Fprintf(out, "Export to %s done: %d exported, %d unchanged, %d removed, %d failed\n",
+				e.Dir, stats.Exported, stats.Unchanged, stats.Removed, stats.Failed)
+			if stats.Failed > 0 {
+				return fmt.Errorf("%d documents failed to export", stats.Failed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "only documents with this tag (repeatable)")
+	registerTagCompletion(cmd, opts)
+	cmd.Flags().StringVar(&correspondent, "correspondent", "", "only documents from this correspondent")
+	cmd.Flags().StringVar(&documentType, "document-type", "", "only documents of this type")
+	cmd.Flags().StringVar(&createdAfter, "created-after", "", "only documents created on or after this date (YYYY-MM-DD)")
+	cmd.Flags().StringVar(&createdBefore, "created-before", "", "only documents created on or before this date (YYYY-MM-DD)")
+	cmd.Flags().StringVar(&layout, "layout", export.DefaultLayout, "template of the path of a document, without extension")
+	cmd.Flags().BoolVar(&original, "original", false, "export the original files instead of the archived versions")
+	cmd.Flags().BoolVar(&prune, "prune", false, "remove exported documents that were deleted from Paperless")
+	return cmd
+}
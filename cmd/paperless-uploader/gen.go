@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+func newGenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "gen",
+		Short:  "Generate documentation",
+		Hidden: true,
+	}
+	cmd.AddCommand(newGenManCmd())
+	return cmd
+}
+
+func newGenManCmd() *cobra.Command {
+	var (
+		dir     string
+		section string
+	)
+	cmd := &cobra.Command{
+		Use:   "man",
+		Short: "Generate man pages for all commands",
+		Long: `Generate a man page for every command and its flags, e.g. for distribution
+packages:
+
+  paperless-uploader gen man --dir /usr/share/man/man1`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("failed to create %s: %v", dir, err)
+			}
+			root := cmd.Root()
+			root.DisableAutoGenTag = true
+			header := &doc.GenManHeader{
+				Title:   "PAPERLESS-UPLOADER",
+				Section: section,
+				Source:  "paperless-uploader " + version,
+				Manual:  "Paperless Uploader Manual",
+			}
+			if err := doc.GenManTree(root, header, dir); err != nil {
+				return fmt.Errorf("failed to generate man pages: %v", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Wrote man pages to %s\n", dir)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&dir, "dir", "d", "man", "directory to write the man pages to")
+	cmd.Flags().StringVar(&section, "section", "1", "man page section")
+	return cmd
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/c-yco/go-paperless-uploader/internal/server"
+	"github.com/spf13/cobra"
+)
+
+func newHealthcheckCmd(opts *globalOptions) *cobra.Command {
+	var statusAddr string
+	cmd := &cobra.Command{
+		Use:   "healthcheck",
+		Short: "Exit 0 if the watcher is running and Paperless is reachable",
+		Long: `Check the health of a running instance, for use as a Docker HEALTHCHECK or
+Kubernetes probe.
+
+The command queries the local status endpoint (status_listen) to confirm the
+watcher is running and checks that the Paperless API is reachable with the
+configured API key. It exits with a non-zero status if either check fails.
+Without a status endpoint only the API is checked.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfigFile(opts.configFile)
+			if err != nil {
+				return fmt.Errorf("failed to load configuration: %v", err)
+			}
+			if statusAddr == "" {
+				statusAddr = cfg.StatusListen
+			}
+
+			if statusAddr != "" {
+				status, err := server.FetchStatus(statusAddr)
+				if err != nil {
+					return fmt.Errorf("unhealthy: %v", err)
+				}
+				if !status.Watching {
+					return fmt.Errorf("unhealthy: watcher is not running")
+				}
+			}
+
+			if err := newClient(cfg).Ping(); err != nil {
+				return fmt.Errorf("unhealthy: Paperless API not reachable: %v", err)
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), "healthy")
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&statusAddr, "status-addr", "", "address of the status endpoint (default: status_listen from the config)")
+	return cmd
+}
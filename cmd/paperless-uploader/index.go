@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/docindex"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/spf13/cobra"
+)
+
+func newIndexCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Query the local mirror of the documents in Paperless",
+		Long: `Query the local mirror of the titles and checksums of the documents in
+Paperless, configured with document_index. The watch command refreshes it
+periodically.`,
+	}
+	cmd.AddCommand(newIndexRefreshCmd(opts), newIndexLookupCmd(opts))
+	return cmd
+}
+
+func newIndexRefreshCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "refresh",
+		Short: "Fetch the documents added or changed since the last refresh",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+			index, err := openIndex(cfg)
+			if err != nil {
+				return err
+			}
+			defer index.Close()
+			stats, err := index.Refresh(cmd.Context(), client)
+			if err != nil {
+				return fmt.Errorf("failed to refresh the document index: %v", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Document index refreshed: %d updated, %d removed, %d documents\n", stats.Updated, stats.Removed, stats.Total)
+			return nil
+		},
+	}
+}
+
+func newIndexLookupCmd(opts *globalOptions) *cobra.Command {
+	var refresh bool
+	cmd := &cobra.Command{
+		Use:   "lookup <file>...",
+		Short: "Tell whether files were uploaded to Paperless already",
+		Long: `Tell whether files were uploaded to Paperless already, by the checksums of
+the originals in the document index. No request is made unless --refresh
+is given, so this works while Paperless is unreachable.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+			index, err := openIndex(cfg)
+			if err != nil {
+				return err
+			}
+			defer index.Close()
+			if refresh {
+				refreshIndex(cmd.Context(), index, client)
+			}
+			out := cmd.OutOrStdout()
+			if refreshed, err := index.Refreshed(); err != nil {
+				return err
+			} else if refreshed.IsZero() {
+				fmt.Fprintln(out, "The document index was never refreshed; run 'index refresh' first.")
+			} else {
+				fmt.Fprintf(out, "Document index refreshed %s ago.\n", time.Since(refreshed).Round(time.Second))
+			}
+			for _, path := range args {
+				if err := lookupFile(out, index, client, path); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&refresh, "refresh", false, "refresh the index first, if Paperless is reachable")
+	return cmd
+}
+
+// lookupFile prints the documents uploaded from the file at path.
+func lookupFile(out io.Writer, index *docindex.Index, client *paperless.Client, path string) error {
+	sum, err := md5File(path)
+	if err != nil {
+		return err
+	}
+	docs, err := index.Lookup(sum)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		fmt.Fprintf(out, "%s: not in Paperless\n", path)
+		return nil
+	}
+	for _, doc := range docs {
+		fmt.Fprintf(out, "%s: document %d %q %s\n", path, doc.ID, doc.Title, client.DocumentURL(doc.ID))
+	}
+	return nil
+}
+
+// openIndex opens the configured document index.
+func openIndex(cfg *config.Config) (*docindex.Index, error) {
+	if cfg.DocumentIndex.Path == "" {
+		return nil, fmt.Errorf("document_index.path is not configured")
+	}
+	return docindex.Open(cfg.DocumentIndex.Path)
+}
+
+// refreshIndex refreshes index, logging the outcome. The index is still
+// usable, if stale, when the refresh fails.
+func refreshIndex(ctx context.Context, index *docindex.Index, client *paperless.Client) {
+	stats, err := index.Refresh(ctx, client)
+	if err != nil {
+		if ctx.Err() == nil {
+			logging.Warnf("Failed to refresh the document index, using the local copy: %v", err)
+		}
+		return
+	}
+	if stats.Updated > 0 || stats.Removed > 0 {
+		logging.Infof("Document index refreshed: %d updated, %d removed, %d documents", stats.Updated, stats.Removed, stats.Total)
+	}
+}
+
+// runIndexRefresh refreshes index every interval until ctx is cancelled.
+func runIndexRefresh(ctx context.Context, index *docindex.Index, client *paperless.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		refreshIndex(ctx, index, client)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// md5File returns the MD5 checksum Paperless keeps of original files.
+func md5File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
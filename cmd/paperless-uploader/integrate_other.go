@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "github.com/spf13/cobra"
+
+// addIntegrateCmd registers the desktop integration commands. Explorer
+// integration is only available on Windows.
+func addIntegrateCmd(root *cobra.Command, opts *globalOptions) {}
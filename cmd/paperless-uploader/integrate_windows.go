@@ -0,0 +1,217 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/windows/registry"
+)
+
+// shellVerbKey returns the registry key, below HKEY_CURRENT_USER, of the
+// Explorer context menu entry of the selected instance.
+func shellVerbKey() string {
+	return `Software\Classes\*\shell\` + config.Namespaced("PaperlessUploader")
+}
+
+// shellEntryName returns the label of the Send To entry.
+func shellEntryName() string {
+	name := "Paperless"
+	if instance := config.Instance(); instance != "" {
+		name += " (" + instance + ")"
+	}
+	return name
+}
+
+// sendToPath returns the path of the shortcut in the Send To folder.
+func sendToPath() (string, error) {
+	appData := os.Getenv("APPDATA")
+	if appData == "" {
+		return "", errors.New("APPDATA is not set")
+	}
+	return filepath.Join(appData, "Microsoft", "Windows", "SendTo", shellEntryName()+".lnk"), nil
+}
+
+// powershell runs a PowerShell script.
+var powershell = func(script string) error {
+	out, err := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("powershell: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// addIntegrateCmd registers the desktop integration commands.
+func addIntegrateCmd(root *cobra.Command, opts *globalOptions) {
+	cmd := &cobra.Command{
+		Use:   "integrate",
+		Short: "Integrate with the desktop",
+	}
+	shell := &cobra.Command{
+		Use:   "shell",
+		Short: "Manage the Explorer Send To and context menu entries",
+	}
+
+	var pick bool
+	install := &cobra.Command{
+		Use:   "install",
+		Short: "Add Explorer entries uploading the selected files",
+		Long: `Add a "Paperless" entry to the Send To menu and a "Send to Paperless" entry to
+the context menu of files in Explorer for the current user. Both run 'upload'
+with the current config file on the selected files; the Send To entry uploads
+all of them at once. The console window stays open when an upload fails.
+
+With --pick the tags, correspondent and document type are chosen in the
+console window before uploading.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath, err := serviceConfigPath(opts)
+			if err != nil {
+				return err
+			}
+			exe, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			if configPath == "" {
+				logging.Warnf("No config file found; uploads will search %v", config.SearchPaths())
+			}
+			if err := installShellIntegration(exe, configPath, shellUploadArgs(configPath, pick)); err != nil {
+				return fmt.Errorf("failed to install shell integration: %v", err)
+			}
+			return nil
+		},
+	}
+	install.Flags().BoolVar(&pick, "pick", false, "choose tags, correspondent and document type for each upload")
+
+	uninstall := &cobra.Command{
+		Use:     "uninstall",
+		Aliases: []string{"remove"},
+		Short:   "Remove the Explorer entries",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := removeShellIntegration(); err != nil {
+				return fmt.Errorf("failed to remove shell integration: %v", err)
+			}
+			return nil
+		},
+	}
+
+	shell.AddCommand(install, uninstall)
+	cmd.AddCommand(shell)
+	root.AddCommand(cmd)
+}
+
+// shellUploadArgs returns the arguments of the upload command run by the
+// Explorer entries, without the files.
+func shellUploadArgs(configPath string, pick bool) []string {
+	args := []string{"upload", "--keep-open-on-error"}
+	if pick {
+		args = append(args, "--pick")
+	}
+	if configPath != "" {
+		args = append(args, "--config", configPath)
+	}
+	if name := config.Instance(); name != "" {
+		args = append(args, "--instance", name)
+	}
+	return args
+}
+
+// commandLine joins args into a Windows command line.
+func commandLine(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = syscall.EscapeArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// psQuote quotes s as a PowerShell string literal.
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// installShellIntegration writes the Send To shortcut and the context menu
+// entry, replacing existing ones.
+func installShellIntegration(exe, configPath string, args []string) error {
+	path, err := sendToPath()
+	if err != nil {
+		return err
+	}
+	workDir := filepath.Dir(exe)
+	if configPath != "" {
+		workDir = filepath.Dir(configPath)
+	}
+	script := fmt.Sprintf(`$s = (New-Object -ComObject WScript.Shell).CreateShortcut(%s)
+$s.TargetPath = %s
+$s.Arguments = %s
+$s.WorkingDirectory = %s
+$s.IconLocation = %s
+$s.Description = 'Upload to Paperless'
+$s.Save()`, psQuote(path), psQuote(exe), psQuote(commandLine(args...)), psQuote(workDir), psQuote(exe+",0"))
+	if err := powershell(script); err != nil {
+		return err
+	}
+	logging.Infof("Wrote %s", path)
+
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, shellVerbKey(), registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	for name, value := range map[string]string{
+		"":                 "Send to " + shellEntryName(),
+		"Icon":             exe,
+		"MultiSelectModel": "Player",
+	} {
+		if err := key.SetStringValue(name, value); err != nil {
+			return err
+		}
+	}
+	command, _, err := registry.CreateKey(registry.CURRENT_USER, shellVerbKey()+`\command`, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer command.Close()
+	if err := command.SetStringValue("", commandLine(append([]string{exe}, args...)...)+` "%1"`); err != nil {
+		return err
+	}
+	logging.Infof(`Wrote HKEY_CURRENT_USER\%s`, shellVerbKey())
+	return nil
+}
+
+// removeShellIntegration deletes the Send To shortcut and the context menu
+// entry. It fails if neither is installed.
+func removeShellIntegration() error {
+	path, err := sendToPath()
+	if err != nil {
+		return err
+	}
+	found := false
+	if err := os.Remove(path); err == nil {
+		found = true
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	for _, key := range []string{shellVerbKey() + `\command`, shellVerbKey()} {
+		if err := registry.DeleteKey(registry.CURRENT_USER, key); err == nil {
+			found = true
+		} else if !errors.Is(err, registry.ErrNotExist) {
+			return err
+		}
+	}
+	if !found {
+		return errors.New("shell integration is not installed")
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package main
+
+import (
+	"testing"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellUploadArgs(t *testing.T) {
+	args := shellUploadArgs(`C:\Users\Jo Doe\config.yaml`, true)
+	assert.Equal(t, []string{"upload", "--keep-open-on-error", "--pick", "--config", `C:\Users\Jo Doe\config.yaml`}, args)
+	assert.Equal(t, `C:\paperless-uploader.exe upload --keep-open-on-error --pick --config "C:\Users\Jo Doe\config.yaml"`,
+		commandLine(append([]string{`C:\paperless-uploader.exe`}, args...)...))
+
+	defer config.SetInstance("")
+	assert.NoError(t, config.SetInstance("scanner"))
+	assert.Equal(t, []string{"upload", "--keep-open-on-error", "--instance", "scanner"}, shellUploadArgs("", false))
+	assert.Equal(t, `Software\Classes\*\shell\PaperlessUploader-scanner`, shellVerbKey())
+	assert.Equal(t, "Paperless (scanner)", shellEntryName())
+}
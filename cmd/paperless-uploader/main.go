@@ -1,209 +1,537 @@
 package main
 
 import (
-	"flag"
-	"fmt"
+	"context"
 	"log"
-	"os"
-	"path/filepath"
-	"time"
-
-	"github.com/c-yco/go-paperless-uploader/internal/config"
-	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
-	"github.com/fsnotify/fsnotify"
 )
 
 const exampleConfig = `paperless_url: "http://localhost:8000"
 api_key: "your-api-key"
+# failover lists further URLs of the same Paperless, e.g. its Tailscale
+# address for laptops away from home. When paperless_url cannot be reached,
+# they are tried in order, and paperless_url is tried again every
+# retry_primary. Document links keep using paperless_url.
+# failover:
+#   urls: ["https://paperless.tailnet.ts.net"]
+#   retry_primary: "1m"
 watch_folder: "consume"
 # post_upload_action can be 'delete', 'move', or left empty to do nothing.
 post_upload_action: ""
 # processed_folder is where files are moved to if post_upload_action is 'move'.
 processed_folder: "processed"
+# failed_folder receives files that could not be uploaded after all retries.
+# Use 'paperless-uploader retry-failed' to upload them again.
+# failed_folder: "failed"
+# settle_delay is how long to wait after a new file is detected before uploading it.
+settle_delay: "1s"
+# folders can be used instead of watch_folder to watch several directories.
+# Each entry may override settle_delay and tags, and api_key to upload the
+# documents as another Paperless user, e.g. one folder per family member, so
+# that they own them. Tags are looked up with the top-level api_key.
+# folders:
+#   - path: "consume"
+#   - path: "scanner"
+#     settle_delay: "10s"
+#     tags: ["scanner"]
+#   - path: "consume-alice"
+#     api_key: "alices-api-key"
+# tls pins the certificate of Paperless: besides being trusted, the server's
+# certificate or one of its issuers must match one of the certificate
+# fingerprints (pinned_cert_sha256, hex as printed by 'openssl x509 -noout
+# -fingerprint -sha256') or public key fingerprints (pinned_spki_sha256,
+# base64 as for HPKP). Add the pin of the next certificate before renewing.
+# min_version "1.3" requires TLS 1.3, and cipher_suites limits TLS 1.2 to the
+# named suites; those of TLS 1.3 are fixed.
+# tls:
+#   pinned_cert_sha256: ["AB:CD:..."]
+#   pinned_spki_sha256: ["sha256/..."]
+#   min_version: "1.2"
+#   cipher_suites: ["TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384", "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"]
+# proxy reaches Paperless through an HTTP or SOCKS5 proxy, e.g. an SSH dynamic
+# forward ('ssh -D 1080 jumphost') or Tor. socks5h resolves the host name on
+# the proxy. Without it the HTTPS_PROXY and NO_PROXY variables apply.
+# proxy: "socks5h://127.0.0.1:1080"
+# headers are sent with every request to Paperless, e.g. the service token of
+# Cloudflare Access or the credentials an Authelia or Traefik forward-auth
+# proxy expects. The values of credential headers (names containing auth,
+# cookie, token, key, secret, password or session, e.g. Authorization or
+# X-Api-Key) are redacted from the logs like the API key.
+# headers:
+#   CF-Access-Client-Id: "<id>.access"
+#   CF-Access-Client-Secret: "<secret>"
+# encryption encrypts the files moved to processed_folder and failed_folder,
+# and those waiting in spool_dir, with AES-256-GCM; they get the suffix ".enc". Create the key with
+# 'openssl rand -hex 32 > key' and keep a copy: without it the files are lost.
+# 'paperless-uploader decrypt' restores them; retry-failed decrypts on its own.
+# encryption:
+#   key_file: "/etc/paperless-uploader/encryption.key"
+# status_listen enables a local status endpoint used by 'healthcheck' and 'status'.
+# status_listen: "127.0.0.1:8765"
+# metrics_listen serves Prometheus metrics on /metrics; it may share the
+# status_listen address.
+# metrics_listen: "127.0.0.1:9464"
+# Both endpoints also serve /healthz and /readyz. /readyz fails when the
+# watcher isn't running or Paperless hasn't been reached for ready_timeout.
+# ready_timeout: "5m"
+# control_socket lets 'status', 'pause', 'resume', 'rescan', 'flush', 'reload'
+# and 'retry-failed' manage the running watcher without a restart. It is a unix
+# socket accessible to the user and group of the service, or on Windows the
+# name of a named pipe accessible to administrators and the service account.
+# control_socket: "/run/paperless-uploader/control.sock"
+# control_socket: "paperless-uploader"
+# log_summary_interval logs the uploads, failures, bytes and average upload
+# time per folder at this interval, as a heartbeat of quiet instances ("0"
+# disables it). The summary notification lists the folders as well.
+# log_summary_interval: "24h"
+# pushgateway receives the run metrics of one-shot 'upload' runs (documents
+# uploaded and failed, duration, success), e.g. when started from cron.
+# pushgateway:
+#   url: "http://pushgateway:9091"
+#   job: "paperless_uploader"
+#   instance: "scanner-pc"      # default: the host name
+# Failed uploads are retried max_retries times, waiting retry_delay before the
+# first retry and doubling the delay after each further attempt.
+# max_retries: 3
+# retry_delay: "30s"
+# Documents Paperless will not accept fail right away, without retries, and
+# go to failed_folder: those it rejected as invalid, too large (HTTP 413) or
+# of an unsupported type, and those exceeding upload_limits. Rejections by
+# size or type are remembered, so later files like them fail before being
+# sent. Paperless does not report its limits, so they can be given here;
+# mime_types are patterns, "default" being the types Paperless consumes
+# without Tika.
+# upload_limits:
+#   max_size: "100M"
+#   mime_types: [default, "application/vnd.openxmlformats-officedocument.*"]
+# filename_pattern derives metadata from file names (without extension) using
+# the named groups title, created, correspondent, document_type, storage_path,
+# tags and asn. title_template builds the title from those groups and the
+# fields filename, ext and folder. Both may be overridden per folder.
+# Try them with 'paperless-uploader rules test <filename>'.
+# filename_pattern: '^(?P<created>\d{4}-\d{2}-\d{2})_(?P<correspondent>[^_]+)_(?P<title>.+)$'
+# title_template: "{{.correspondent}} {{.title}}"
+# rules then route files by what they match: the file name, the watch folder
+# (by path or name), the size, the mime type, the date parsed by
+# filename_pattern, the sender of mailed files (smtp_receiver) or the remote
+# path of files downloaded over sftp or rclone. Patterns are globs; a rule
+# applies when all of its conditions match. Every matching rule sets its
+# title (a template like title_template that can also use correspondent,
+# sender and remote), correspondent, document_type, storage_path, adds its
+# tags and may replace post_upload_action with delete, move or keep, until a
+# rule with 'stop' matched. 'rules test' shows the rules a file matches.
+# rules:
+#   - name: "bank statements"
+#     match:
+#       sender: "*@bank.example"
+#       mime_type: "application/pdf"
+#     set:
+#       correspondent: "Bank"
+#       document_type: "Statement"
+#       tags: ["finance"]
+#       title: "{{.correspondent}} statement {{.created}}"
+#     stop: true
+#   - name: "large photos"
+#     match:
+#       folder: "phone"
+#       mime_type: "image/*"
+#       min_size: "5M"
+#     set:
+#       tags: ["photo"]
+#       post_upload_action: "keep"
+# 'content' matches a regular expression, ignoring case, against the text of
+# the file, read with local tools before the upload: pdftotext for PDFs and
+# tesseract for images by default. Its named groups can be used in the title.
+#   - name: "utility bills"
+#     match:
+#       content: 'DE89 ?3704 ?0044|Stadtwerke'
+#     set:
+#       correspondent: "Stadtwerke"
+#       title: "Stadtwerke {{.created}}"
+# content_extraction sets the commands reading the text. They print it on
+# standard output; "{file}" is replaced by the path of the file. PDFs without
+# a text layer, e.g. plain scans, are read by 'scanned_pdf_command' if set.
+# Files larger than 'max_size' are not read.
+# content_extraction:
+#   pdf_command: ["pdftotext", "-l", "5", "{file}", "-"]
+#   scanned_pdf_command: ["sh", "-c", "pdftoppm -r 200 -l 2 -png \"$0\" | tesseract stdin stdout", "{file}"]
+#   image_command: ["tesseract", "{file}", "stdout", "-l", "deu+eng"]
+#   timeout: "1m"
+#   max_size: "50M"
 # A list of tags to apply to the document.
 # tags:
 #  - tag1
 #  - tag2
+# retention sets how long 'paperless-uploader purge' keeps files in the
+# processed and failed folders, e.g. "90d", "2w" or "36h".
+# retention:
+#   processed: "90d"
+#   failed: "30d"
+# tracing exports OpenTelemetry traces of the upload pipeline over OTLP/HTTP.
+# Without an endpoint the OTEL_EXPORTER_OTLP_* environment variables are used.
+# tracing:
+#   enabled: true
+#   endpoint: "localhost:4318"
+#   insecure: true
+#   sample_ratio: 1.0
+# notifications are sent while watching. Each backend chooses the events it
+# receives (failure, upload, summary and outage, sent when Paperless goes
+# down and recovers; failures and outages by default) and may override the
+# message templates (text/template; fields: .Name, .File, .Folder, .Error,
+# .Attempts, .TaskID, .Summary, and .Recovered and .Duration for outages).
+# notifications:
+#   summary_interval: "24h"
+#   # Wait for Paperless to consume uploads so notifications link to them.
+#   document_links: true
+#   ntfy:
+#     url: "https://ntfy.sh"
+#     topic: "paperless-uploads"
+#     token: ""
+#     priority: "default"
+#     failure_priority: "high"
+#     events: [failure, summary]
+#     templates:
+#       failure: "{{.Name}} could not be uploaded: {{.Error}}"
+#   gotify:
+#     url: "https://gotify.example.com"
+#     token: "application-token"
+#     priority: 5
+#     failure_priority: 8
+#     events: [failure, upload]
+#   telegram:
+#     token: "123456:bot-token"
+#     chat_id: "-1001234567890"
+#   pushover:
+#     token: "application-token"
+#     user: "user-key"
+#     events: [failure, upload]
+#   # Slack, Discord or Mattermost incoming webhooks. batch_interval (available
+#   # for every backend) combines the notifications of that interval into one
+#   # message.
+#   webhooks:
+#     - name: "office"
+#       format: "slack"
+#       url: "https://hooks.slack.com/services/..."
+#       events: [failure, upload]
+#       batch_interval: "5m"
+#   # Email alerts; add "summary" to the events for a digest every
+#   # summary_interval.
+#   email:
+#     host: "smtp.example.com"
+#     port: 587
+#     tls: "starttls"               # starttls, tls (implicit, port 465) or none
+#     username: "uploader@example.com"
+#     password: "secret"
+#     from: "Paperless Uploader <uploader@example.com>"
+#     to: ["office@example.com"]
+#     events: [failure, summary]
+# receipts writes <file>.uploaded.json next to moved (or unmoved) originals
+# once Paperless created the document, containing its ID and link, the
+# SHA-256 of the file and the tags it was uploaded with, so that the archive
+# can be reconciled against Paperless later. The document ID and link are
+# logged either way when receipts or audit_log are enabled. Receipts of
+# earlier versions, named <file>.receipt.json, are still skipped and purged.
+# receipts: true
+# error_reports writes <file>.error.json next to files that failed for good
+# (in failed_folder if they are moved there), with the error, the HTTP
+# status and response body of Paperless, every attempt and the config file.
+# The report is removed once the file is uploaded.
+# error_reports: true
+# verify_checksum defers deleting originals (post_upload_action: delete)
+# until Paperless created the document and the checksum of the original it
+# stored matches the file. Files that do not match, or that Paperless
+# rejected, are moved to failed_folder or left in place instead.
+# verify_checksum: true
+# on_duplicate decides what happens to files Paperless does not consume
+# because it already has the document. The post-upload action then waits
+# until Paperless consumed the file. 'success' runs the post-upload action
+# anyway, 'move' moves the file to duplicates_folder, 'reupload' uploads it
+# again with "(duplicate of #ID)" appended to the title (only PDFs, whose
+# checksum is changed by appending a comment), and 'fail' moves it to
+# failed_folder or leaves it in place. Empty runs the post-upload action
+# right away and only logs the rejection.
+# on_duplicate: "move"
+# duplicates_folder: "duplicates"
+# after_consumption sets what Paperless does not accept with the upload once
+# it created the document: notes, custom field values (converted to the type
+# of the field; an empty value clears it), the owner and the permissions.
+# Notes and values are templates with the fields .File, .Path, .Folder and
+# .DocumentID; users, groups and custom fields are given by name.
+# after_consumption:
+#   notes: ["Uploaded from {{.Path}}"]
+#   custom_fields:
+#     source: "{{.Folder}}"
+#     reviewed: "false"
+#   owner: "alice"
+#   view_groups: ["family"]
+#   change_users: ["bob"]
+# consume_fallback copies files into a Paperless consume directory (e.g. a
+# mounted SMB share) once the API has been unreachable for 'after', so
+# ingestion continues during API outages. Files are retried until then even
+# beyond max_retries, and the API is tried first for every file. Copies are
+# consumed without metadata or tags.
+# consume_fallback:
+#   dir: "/mnt/paperless/consume"
+#   after: "10m"
+# circuit_breaker holds uploads once 'threshold' uploads in a row failed
+# because Paperless is unreachable or answers with a server error, instead
+# of failing every queued file. The outage is logged and notified once, the
+# server is checked every 'probe_interval', and uploads resume when it
+# answers. Files wait for consume_fallback while it is configured. A
+# threshold of 0 disables it.
+# circuit_breaker:
+#   threshold: 5
+#   probe_interval: "30s"
+# dedup_window skips files byte-identical to one uploaded within the window,
+# e.g. double scans or files re-created by a sync loop, without asking
+# Paperless. Skipped files get the post_upload_action as if uploaded.
+# dedup_window: "48h"
+# state_file keeps what is remembered across restarts, such as the checksums
+# for dedup_window (default: in the user cache directory). state_backend
+# selects its format: json (a plain file, the default), bbolt (a single
+# process may open it at a time) or sqlite. With bbolt or sqlite, backfill
+# also keeps its checkpoints there unless --state is given.
+# state_backend: "json"
+# state_file: "/var/lib/paperless-uploader/state.json"
+# spool_dir keeps accepting files while Paperless is down: files whose
+# upload fails because the server is unreachable (or that arrive while the
+# circuit breaker is open) are stored there with their resolved metadata,
+# moved out of the watch folder unless post_upload_action leaves them in
+# place. Once the server answers again, also after a restart, they are
+# uploaded one at a time in the order they arrived and then moved to
+# processed_folder or deleted. It takes precedence over consume_fallback.
+# spool_dir: "/var/lib/paperless-uploader/spool"
+# document_index keeps a local SQLite mirror of the titles and checksums of
+# the documents in Paperless, refreshed incrementally every
+# 'refresh_interval' by the watch command. 'index lookup <file>' answers
+# whether a file was uploaded already from it, also while Paperless is
+# unreachable, and backfill skips duplicates without asking the server.
+# document_index:
+#   path: "/var/lib/paperless-uploader/documents.db"
+#   refresh_interval: "15m"
+# folder_lock lets instances on several machines watch the same shared
+# folder, e.g. two NAS nodes, and upload every file once: before uploading a
+# file, an instance claims it with a <file>.claim.json marker naming it, and
+# the others skip claimed files. Files left in place keep a marker recording
+# their upload. The claims of an instance that stopped are taken over after
+# 'timeout' when the file is found again, e.g. on the next start or rescan.
+# 'instance' must differ between the instances and defaults to the host name.
+# folder_lock:
+#   enabled: true
+#   instance: "nas1"
+#   timeout: "10m"
+# export sets the defaults of the export command, which backs up the
+# documents in Paperless into 'dir', downloading only those added or changed
+# since the last export. 'layout' is the path of a document in 'dir' without
+# extension, with the fields .ID, .Title, .Correspondent, .DocumentType,
+# .StoragePath, .Created (YYYY-MM-DD), .Year, .Month, .Day, .ASN and
+# .OriginalName; empty path elements are left out. 'original' exports the
+# original files instead of the archived (OCRed) versions, and 'prune'
+# removes exported documents that were deleted from Paperless.
+# export:
+#   dir: "/mnt/backup/paperless"
+#   layout: "{{.Correspondent}}/{{.Year}}/{{.Created}} {{.Title}}"
+#   original: false
+#   prune: false
+# audit_log records every step of every file (detected, hashed, uploaded,
+# consumed as document, moved or deleted) as JSON lines; 'audit <file>' shows
+# the history of a file. Every record carries the hash of the one before, so
+# 'audit verify' detects changed, removed or reordered records. Keep the last
+# hash it prints elsewhere to also detect records removed from the end.
+# audit_log: "/var/lib/paperless-uploader/audit.jsonl"
+# audit_signing_key additionally signs every record with an Ed25519 key
+# created with 'openssl genpkey -algorithm ed25519 -out audit.key'; 'audit
+# verify --public-key' checks the signatures with the key from
+# 'openssl pkey -in audit.key -pubout'.
+# audit_signing_key: "/etc/paperless-uploader/audit.key"
+# mqtt publishes the watcher status (state, queue depth, uploads, failures)
+# as JSON on <topic_prefix>/state, with Home Assistant discovery payloads.
+# mqtt:
+#   broker: "tcp://homeassistant.local:1883"
+#   username: "paperless"
+#   password: "secret"
+#   client_id: "paperless-uploader"     # default with --instance: paperless-uploader-<name>
+#   topic_prefix: "paperless-uploader"  # default with --instance: paperless-uploader-<name>
+#   discovery: true
+#   discovery_prefix: "homeassistant"
+#   interval: "30s"
+#   # commands subscribes to <command_topic>/{rescan,pause,resume,scan,upload}
+#   # (default command_topic: <topic_prefix>/command) and publishes the
+#   # outcome on <topic_prefix>/command_result. scan takes a profile name,
+#   # upload a URL or a path within upload_paths; files go to folder (default:
+#   # the first watch folder). With discovery, Home Assistant gets a button per
+#   # command and scan profile. Scan profiles run their command in their folder.
+#   commands: true
+#   upload_paths: ["/srv/shared/scans"]
+#   scan_profiles:
+#     - name: "duplex"
+#       command: ["scanimage", "--source", "ADF Duplex", "--format", "pdf", "--batch=scan-%d.pdf"]
+#       folder: "consume"
+#       timeout: "5m"
+# screenshots is a desktop mode converting new screenshots (watch) and images
+# copied to the clipboard (clipboard; needs wl-paste or xclip on Linux) to
+# PDFs in folder (default: the first watch folder), uploaded with tags. The
+# screenshot folder defaults to the one used by the operating system; the
+# screenshots themselves are kept.
+# screenshots:
+#   watch: true
+#   screenshot_folder: "/home/me/Pictures/Screenshots"
+#   clipboard: true
+#   poll_interval: "2s"
+#   tags: ["screenshot"]
+#   folder: "consume"
+# removable_drives imports documents from USB drives and memory cards plugged
+# in while 'watch' runs, e.g. after scanning to a stick at the copier: the
+# given paths on the drive (default: all of it) are searched for files with
+# the given extensions, which are uploaded and left on the drive. With
+# mark_imported, uploaded files are listed in .paperless-imported on the drive
+# and skipped the next time it is plugged in. Drives are those mounted below
+# /media or /run/media on Linux, in /Volumes on macOS and removable drive
+# letters on Windows.
+# removable_drives:
+#   enabled: true
+#   paths: ["SCANS", "DCIM"]
+#   extensions: ["pdf", "jpg", "jpeg", "png", "tif", "tiff"]
+#   mark_imported: true
+#   tags: ["usb"]
+# smtp_receiver accepts mail from scanners that can only "scan to email" and
+# drops the attachments into a watch folder, chosen by sender. Mail from other
+# senders goes to folder (default: the first watch folder) unless
+# reject_unknown_senders is set. There is no authentication: listen on a
+# trusted network only.
+# smtp_receiver:
+#   listen: ":2525"
+#   max_message_size: "32M"
+#   routes:
+#     - sender: "*@scanner.lan"
+#       folder: "scanner"
+#   reject_unknown_senders: true
+# ftp_receiver is an FTP server for scanners that can only "scan to FTP". Each
+# user's uploads go to its folder (default: folder, or the first watch
+# folder); listings are always empty and nothing can be downloaded. With
+# tls_cert and tls_key clients may use explicit FTPS (AUTH TLS), require_tls
+# rejects plain logins. Open passive_ports as well when behind a firewall or
+# in a container, and set public_host to the address clients connect to if
+# it differs.
+# ftp_receiver:
+#   listen: ":2121"
+#   passive_ports: "50000-50100"
+#   public_host: "192.168.1.10"
+#   max_file_size: "256M"
+#   tls_cert: "/etc/paperless-uploader/ftp.crt"
+#   tls_key: "/etc/paperless-uploader/ftp.key"
+#   users:
+#     - username: "scanner"
+#       password: "secret"
+#       folder: "scanner"
+# upload_receiver accepts documents posted to POST /upload as multipart form
+# data by phones, shortcuts or browser extensions, with the header
+# "Authorization: Bearer <token>". Optional form fields title, created,
+# correspondent, document_type, storage_path, tags and asn replace the
+# metadata derived from the file name. Files are stored in folder (default:
+# the first watch folder). listen may equal status_listen; put a reverse
+# proxy with TLS in front when it is reachable from outside.
+# POST /fetch takes a JSON body {"url": "https://...", "headers": {...},
+# "username": "...", "password": "..."} plus the same optional metadata fields
+# and downloads the document into folder, e.g. for bookmarklets that have a
+# link to an invoice rather than the file.
+# upload_receiver:
+#   listen: ":8766"
+#   token: "a-long-random-string"
+#   max_file_size: "256M"
+# web_ui serves a web page for uploading documents by drag and drop, with tags,
+# correspondent and document type chosen from Paperless, a live view of the
+# activity and buttons to retry failed files. Uploads are stored in folder
+# (default: the first watch folder). Set username and password unless only
+# you can reach listen; use a reverse proxy with TLS for access from outside.
+# web_ui:
+#   listen: "127.0.0.1:8767"
+#   username: "family"
+#   password: "secret"
+#   max_file_size: "256M"
+# grpc serves the gRPC API defined in pkg/uploaderpb/uploader.proto: streamed
+# uploads with metadata, status, a stream of file events, pause/resume and
+# rescan. Clients send "authorization: Bearer <token>" metadata. Without
+# tls_cert and tls_key the connection is not encrypted: listen on a trusted
+# network only.
+# grpc:
+#   listen: ":9090"
+#   token: "a-long-random-string"
+#   tls_cert: "/etc/paperless-uploader/grpc.crt"
+#   tls_key: "/etc/paperless-uploader/grpc.key"
+#   max_file_size: "256M"
+# google_drive downloads the files added to a Drive folder into a temporary
+# directory, uploads them with the settings of folder (default: the first
+# watch folder) and, once uploaded, moves them to processed_folder_id. Share the folder with a service account and give its
+# JSON key as credentials_file, or authorize as a user with client_id,
+# client_secret and refresh_token. Folder IDs are the last part of the
+# folder's URL.
+# google_drive:
+#   folder_id: "1AbCdEfGhIjKlMnOpQrStUvWxYz"
+#   processed_folder_id: "1ZyXwVuTsRqPoNmLkJiHgFeDcBa"
+#   credentials_file: "service-account.json"
+#   poll_interval: "1m"
+# sftp downloads the files in remote_path on an SFTP server, e.g. the outbox
+# of a scanner that can only push over SFTP, into a temporary directory and
+# uploads them with the settings of folder (default: the first watch folder).
+# A file is downloaded once its size and modification time did not change
+# between two polls. Uploaded files are deleted on the server,
+# or moved to processed_path if set. Authenticate with password or
+# private_key_file (with passphrase if encrypted); the host key is checked
+# against known_hosts_file or the host_key fingerprint as printed by
+# 'ssh-keygen -lf'.
+# sftp:
+#   host: "nas.lan:22"
+#   username: "scanner"
+#   private_key_file: "/etc/paperless-uploader/id_ed25519"
+#   known_hosts_file: "/etc/paperless-uploader/known_hosts"
+#   remote_path: "/scans/outbox"
+#   processed_path: "/scans/done"
+#   poll_interval: "1m"
+# rclone downloads the files in remote, which may be any remote configured in
+# rclone (Dropbox, OneDrive, S3, WebDAV, ...), through the remote control API
+# of a running 'rclone rcd --rc-serve --rc-user rc --rc-pass secret'. A file
+# is downloaded once its size and modification time did not change between
+# two polls, kept in download_dir (default: a temporary directory) while it
+# is uploaded with tags, then deleted on the remote or moved to processed.
+# rclone:
+#   url: "http://localhost:5572"
+#   username: "rc"
+#   password: "secret"
+#   remote: "dropbox:Scans"
+#   processed: "dropbox:Scans/done"
+#   poll_interval: "1m"
+#   tags: ["dropbox"]
+# memory_budget keeps 'watch' within this much memory (K, M or G suffix) for
+# small NAS and Raspberry Pi boxes: the Go runtime collects garbage harder as
+# memory use approaches it, and the files waiting for upload are capped (1 per
+# 4M of budget, 8 to 1024); further files are picked up once the backlog has
+# drained. Uploads are always streamed from disk.
+# memory_budget: "256M"
+# run_as switches 'watch' to this user (and group) once the endpoints are
+# listening, when started as root, e.g. to bind a port below 1024 or to read
+# a protected audit_signing_key. The state store, audit log and document index
+# are opened as this user, so it needs write access to them. Names or numeric
+# IDs; Unix only.
+# run_as:
+#   user: "paperless"
+#   group: "scanner"
+# include merges additional files, directories or globs (relative to this file).
+# Any *.yaml files in a conf.d directory next to this file are merged last, so
+# conf.d is only read along with a config file. Later files override earlier
+# ones, except that folders, rules, mqtt.scan_profiles, smtp_receiver.routes,
+# ftp_receiver.users and notifications.webhooks are appended to, so every file
+# can add its own.
+# include:
+#   - "profiles/*.yaml"
 `
 
 var (
 	logFatal = log.Fatalf //nolint:unused // used in tests
 )
 
-func runApp() error {
-	// Command-line flags
-	filePath := flag.String("file", "", "The path to the document to upload")
-	watch := flag.Bool("watch", true, "Watch a directory for new files and upload them")
-	createConfig := flag.Bool("create-config", false, "Create an example config.yaml file and exit")
-	force := flag.Bool("force", false, "Force overwrite of existing config file")
-	flag.Parse()
-
-	if *createConfig {
-		if _, err := os.Stat("config.yaml"); err == nil && !*force {
-			return fmt.Errorf("config.yaml already exists. Use --force to overwrite")
-		}
-		if err := os.WriteFile("config.yaml", []byte(exampleConfig), 0644); err != nil {
-			return fmt.Errorf("failed to write config file: %v", err)
-		}
-		if *force {
-			log.Println("Overwrote existing config.yaml with example configuration.")
-		} else {
-			log.Println("Created example config.yaml. Please edit it with your details.")
-		}
-		return nil
-	}
-
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		return fmt.Errorf("failed to load configuration: %v", err)
-	}
-
-	// Create a new Paperless client
-	client := paperless.NewClient(cfg.PaperlessURL, cfg.APIKey)
-
-	// Get all tags from Paperless
-	allTags, err := client.GetTags()
-	if err != nil {
-		return fmt.Errorf("failed to get tags from Paperless: %v", err)
-	}
-
-	// Create a map of tag names to tag IDs for quick lookup
-	tagMap := make(map[string]int)
-	for _, tag := range allTags {
-		tagMap[tag.Name] = tag.ID
-	}
-
-	// Convert configured tag names to tag IDs
-	var tagIDs []int
-	for _, tagName := range cfg.Tags {
-		if id, ok := tagMap[tagName]; ok {
-			tagIDs = append(tagIDs, id)
-		} else {
-			log.Printf("Warning: Tag '%s' not found in Paperless and will be ignored.", tagName)
-		}
-	}
-
-	// Log the configuration for debugging
-	apiKeyForLogging := ""
-	if len(cfg.APIKey) > 4 {
-		apiKeyForLogging = "..." + cfg.APIKey[len(cfg.APIKey)-4:]
-	} else {
-		apiKeyForLogging = "(too short to be valid)"
-	}
-	log.Printf("Loaded configuration: URL=[%s], APIKey=[%s], WatchFolder=[%s], PostUploadAction=[%s], ProcessedFolder=[%s], Tags=[%v]", cfg.PaperlessURL, apiKeyForLogging, cfg.WatchFolder, cfg.PostUploadAction, cfg.ProcessedFolder, cfg.Tags)
-
-	if *watch {
-		log.Printf("Watching directory: %s", cfg.WatchFolder)
-		return watchDirectory(cfg, client, tagIDs)
-	} else if *filePath != "" {
-		// Upload the document
-		fmt.Printf("Uploading %s to Paperless...\n", *filePath)
-		if err := client.UploadDocument(*filePath, tagIDs); err != nil {
-			return fmt.Errorf("failed to upload document: %v", err)
-		}
-		fmt.Println("Document uploaded successfully!")
-	} else {
-		return fmt.Errorf("either the -file flag or the -watch flag is required")
-	}
-	return nil
-}
-
-func watchDirectory(cfg *config.Config, client *paperless.Client, tagIDs []int) error {
-	// Create the watch folder if it doesn't exist
-	if _, err := os.Stat(cfg.WatchFolder); os.IsNotExist(err) {
-		log.Printf("Watch folder '%s' not found, creating it.", cfg.WatchFolder)
-		if err := os.MkdirAll(cfg.WatchFolder, 0755); err != nil {
-			return fmt.Errorf("failed to create watch folder: %v", err)
-		}
-	}
-
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err := watcher.Close(); err != nil {
-			log.Printf("Error closing watcher: %v", err)
-		}
-	}()
-
-	done := make(chan bool)
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
-				if event.Op&fsnotify.Create == fsnotify.Create {
-					log.Println("New file detected:", event.Name)
-					// Wait a moment for the file to be fully written
-					time.Sleep(1 * time.Second)
-					if err := client.UploadDocument(event.Name, tagIDs); err != nil {
-						log.Printf("Failed to upload document %s: %v", event.Name, err)
-					} else {
-						log.Printf("Successfully uploaded %s", event.Name)
-						handlePostUpload(cfg, event.Name)
-					}
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					return
-				}
-				log.Println("error:", err)
-			}
-		}
-	}()
-
-	err = watcher.Add(cfg.WatchFolder)
-	if err != nil {
-		return err
-	}
-
-	// Also process existing files in the directory
-	err = filepath.Walk(cfg.WatchFolder, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() {
-			if err := client.UploadDocument(path, tagIDs); err != nil {
-				log.Printf("Failed to upload existing document %s: %v", path, err)
-			} else {
-				log.Printf("Successfully uploaded existing file %s", path)
-				handlePostUpload(cfg, path)
-			}
-		}
-		return nil
-	})
-	if err != nil {
-		log.Printf("Error processing existing files: %v", err)
-	}
-
-	<-done
-	return nil
-}
-
-func handlePostUpload(cfg *config.Config, filePath string) {
-	switch cfg.PostUploadAction {
-	case "delete":
-		if err := os.Remove(filePath); err != nil {
-			log.Printf("Failed to delete file %s: %v", filePath, err)
-		} else {
-			log.Printf("Deleted file %s", filePath)
-		}
-	case "move":
-		if _, err := os.Stat(cfg.ProcessedFolder); os.IsNotExist(err) {
-			if err := os.MkdirAll(cfg.ProcessedFolder, 0755); err != nil {
-				log.Printf("Failed to create processed folder '%s': %v", cfg.ProcessedFolder, err)
-				return
-			}
-		}
-		newPath := filepath.Join(cfg.ProcessedFolder, filepath.Base(filePath))
-		if err := os.Rename(filePath, newPath); err != nil {
-			log.Printf("Failed to move file %s to %s: %v", filePath, newPath, err)
-		} else {
-			log.Printf("Moved file %s to %s", filePath, newPath)
-		}
-	}
+// runApp builds the command tree and executes it with the given arguments.
+func runApp(ctx context.Context, args []string) error {
+	cmd := newRootCmd()
+	cmd.SetArgs(args)
+	return cmd.ExecuteContext(ctx)
 }
@@ -2,10 +2,21 @@
 
 package main
 
-import "log"
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
 
 func main() {
-	if err := runApp(); err != nil {
-		log.Fatalf("Error: %v", err)
+	defer reportPanic()
+	// SIGTERM (sent by service managers and container runtimes) and
+	// Ctrl-C cancel the context, so watchers stop and flush gracefully.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := runApp(ctx, os.Args[1:])
+	stop()
+	if err != nil {
+		fatal(err)
 	}
 }
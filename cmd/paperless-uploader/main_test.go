@@ -1,15 +1,37 @@
 package main
 
 import (
-	"flag"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/c-yco/go-paperless-uploader/internal/audit"
 	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/control"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/c-yco/go-paperless-uploader/internal/server"
+	"github.com/c-yco/go-paperless-uploader/internal/tui"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,6 +51,7 @@ func setupTest(t *testing.T) (string, func()) {
 	originalWd, err := os.Getwd()
 	assert.NoError(t, err)
 	os.Chdir(tmpDir)
+	viper.Reset()
 
 	return tmpDir, func() {
 		os.Chdir(originalWd)
@@ -41,16 +64,26 @@ func TestRunApp(t *testing.T) {
 		tmpDir, cleanup := setupTest(t)
 		defer cleanup()
 
-		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-		os.Args = []string{"test", "-create-config"}
-
-		err := runApp()
+		err := runApp(context.Background(), []string{"config", "init"})
 		assert.NoError(t, err)
 
 		_, err = os.Stat(filepath.Join(tmpDir, "config.yaml"))
 		assert.NoError(t, err)
 	})
 
+	t.Run("create-config refuses to overwrite", func(t *testing.T) {
+		_, cleanup := setupTest(t)
+		defer cleanup()
+
+		assert.NoError(t, os.WriteFile("config.yaml", []byte("api_key: keep"), 0644))
+
+		err := runApp(context.Background(), []string{"config", "init"})
+		assert.Error(t, err)
+
+		err = runApp(context.Background(), []string{"config", "init", "--force"})
+		assert.NoError(t, err)
+	})
+
 	t.Run("file upload", func(t *testing.T) {
 		_, cleanup := setupTest(t)
 		defer cleanup()
@@ -87,46 +120,1568 @@ api_key: "testkey"
 		err = os.WriteFile("config.yaml", []byte(configContent), 0644)
 		assert.NoError(t, err)
 
-		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-		os.Args = []string{"test", "-file", "test.txt", "-watch=false"}
-
-		err = runApp()
+		err = runApp(context.Background(), []string{"upload", "test.txt"})
 		assert.NoError(t, err)
+
+		var out strings.Builder
+		cmd := newRootCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs([]string{"--dry-run", "upload", "test.txt"})
+		assert.NoError(t, cmd.Execute())
+		assert.Contains(t, out.String(), "[dry-run] Would upload test.txt")
+
+		err = runApp(context.Background(), []string{"upload", "test.txt", "missing.txt"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "1 of 2 uploads failed")
+
+		var stderr strings.Builder
+		cmd = newRootCmd()
+		cmd.SetErr(&stderr)
+		cmd.SetIn(strings.NewReader("\n"))
+		cmd.SetArgs([]string{"upload", "--keep-open-on-error", "missing.txt"})
+		assert.Error(t, cmd.Execute())
+		assert.Contains(t, stderr.String(), "Press Enter to close...")
 	})
 }
 
-func TestHandlePostUpload(t *testing.T) {
-	t.Run("delete action", func(t *testing.T) {
-		tmpDir, cleanup := setupTest(t)
-		defer cleanup()
+func TestCollectFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "a.pdf"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "b.txt"), []byte("b"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "sub", "deep"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "sub", "deep", "c.pdf"), []byte("c"), 0644))
 
-		filePath := filepath.Join(tmpDir, "test.txt")
-		err := os.WriteFile(filePath, []byte("content"), 0644)
-		assert.NoError(t, err)
+	files, result := collectFiles([]string{
+		filepath.Join(tmpDir, "*.pdf"),
+		filepath.Join(tmpDir, "sub"),
+		filepath.Join(tmpDir, "a.pdf"),
+		filepath.Join(tmpDir, "missing.pdf"),
+		filepath.Join(tmpDir, "*.doc"),
+	}, nil)
 
-		cfg := &config.Config{PostUploadAction: "delete"}
-		handlePostUpload(cfg, filePath)
+	assert.Equal(t, []string{
+		filepath.Join(tmpDir, "a.pdf"),
+		filepath.Join(tmpDir, "sub", "deep", "c.pdf"),
+	}, files)
+	assert.Len(t, result.Failed, 2)
+}
 
-		_, err = os.Stat(filePath)
-		assert.True(t, os.IsNotExist(err))
-	})
+func TestReadFilesFrom(t *testing.T) {
+	paths, err := readFilesFrom("-", strings.NewReader("a.pdf\r\nsub dir/b.pdf\n\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.pdf", "sub dir/b.pdf"}, paths)
 
-	t.Run("move action", func(t *testing.T) {
-		tmpDir, cleanup := setupTest(t)
-		defer cleanup()
+	paths, err = readFilesFrom("-", strings.NewReader("a.pdf\x00with\nnewline.pdf\x00"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.pdf", "with\nnewline.pdf"}, paths)
 
-		filePath := filepath.Join(tmpDir, "test.txt")
-		err := os.WriteFile(filePath, []byte("content"), 0644)
-		assert.NoError(t, err)
+	tmpDir := t.TempDir()
+	listed := filepath.Join(tmpDir, "[literal].pdf")
+	assert.NoError(t, os.WriteFile(listed, []byte("x"), 0644))
+	files, result := collectFiles(nil, []string{listed})
+	assert.Equal(t, []string{listed}, files)
+	assert.Empty(t, result.Failed)
+}
 
-		processedDir := filepath.Join(tmpDir, "processed")
-		cfg := &config.Config{PostUploadAction: "move", ProcessedFolder: processedDir}
-		handlePostUpload(cfg, filePath)
+func TestTagsCommands(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
 
-		_, err = os.Stat(filePath)
-		assert.True(t, os.IsNotExist(err))
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/tags/":
+			w.Write([]byte(`{"results": [{"id": 1, "name": "Invoice", "color": "#ff0000", "document_count": 3}, {"id": 2024, "name": "Old"}, {"id": 5, "name": "2024"}]}`))
+		case r.Method == "POST" && r.URL.Path == "/api/tags/":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 2, "name": "receipt"}`))
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
 
-		_, err = os.Stat(filepath.Join(processedDir, "test.txt"))
-		assert.NoError(t, err)
-	})
+	err := os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644)
+	assert.NoError(t, err)
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"tags", "list", "-o", "json"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), `"name": "Invoice"`)
+
+	cmd = newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"tags", "create", "--name", "receipt", "--matching-algorithm", "any"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), `Created tag "receipt" (ID 2)`)
+
+	assert.NoError(t, runApp(context.Background(), []string{"tags", "delete", "invoice"}))
+	assert.Equal(t, []string{"/api/tags/1/"}, deleted)
+	assert.Error(t, runApp(context.Background(), []string{"tags", "delete", "missing"}))
+
+	// A numeric argument is a name first and an ID only if no name matches.
+	deleted = nil
+	assert.NoError(t, runApp(context.Background(), []string{"tags", "delete", "2024", "1"}))
+	assert.Equal(t, []string{"/api/tags/5/", "/api/tags/1/"}, deleted)
+}
+
+func TestDocumentsSearch(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags/":
+			w.Write([]byte(`{"results": [{"id": 4, "name": "invoice"}]}`))
+		case "/api/correspondents/":
+			w.Write([]byte(`{"results": [{"id": 9, "name": "ACME"}]}`))
+		case "/api/documents/":
+			assert.Equal(t, "power bill", r.URL.Query().Get("query"))
+			assert.Equal(t, "4", r.URL.Query().Get("tags__id__all"))
+			assert.Equal(t, "9", r.URL.Query().Get("correspondent__id"))
+			w.Write([]byte(`{"results": [{"id": 12, "title": "Power bill March", "created": "2024-03-05T00:00:00Z"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	err := os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644)
+	assert.NoError(t, err)
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"documents", "search", "power bill", "--tag", "invoice", "--correspondent", "acme"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "Power bill March")
+	assert.Contains(t, out.String(), server.URL+"/documents/12/details")
+	assert.Contains(t, out.String(), "2024-03-05")
+
+	err = runApp(context.Background(), []string{"documents", "search", "--created-after", "March"})
+	assert.Error(t, err)
+}
+
+func TestDocumentsDownload(t *testing.T) {
+	tmpDir, cleanup := setupTest(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags/":
+			w.Write([]byte(`{"results": [{"id": 4, "name": "invoice"}]}`))
+		case "/api/documents/":
+			assert.Equal(t, "4", r.URL.Query().Get("tags__id__all"))
+			w.Write([]byte(`{"results": [{"id": 1}, {"id": 2}]}`))
+		case "/api/documents/1/download/", "/api/documents/2/download/":
+			w.Header().Set("Content-Disposition", `attachment; filename="doc`+strings.Split(r.URL.Path, "/")[3]+`.pdf"`)
+			w.Write([]byte("pdf"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	err := os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644)
+	assert.NoError(t, err)
+
+	assert.NoError(t, runApp(context.Background(), []string{"documents", "download", "1", "-o", "single.pdf"}))
+	_, err = os.Stat(filepath.Join(tmpDir, "single.pdf"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, runApp(context.Background(), []string{"documents", "download", "--tag", "invoice", "--all", "-o", "export"}))
+	_, err = os.Stat(filepath.Join(tmpDir, "export", "doc1.pdf"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(tmpDir, "export", "doc2.pdf"))
+	assert.NoError(t, err)
+
+	assert.Error(t, runApp(context.Background(), []string{"documents", "download", "3"}))
+	assert.Error(t, runApp(context.Background(), []string{"documents", "download", "--tag", "invoice"}))
+
+	// Files already exported are not overwritten.
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "export", "doc1.pdf"), []byte("kept"), 0644))
+	err = runApp(context.Background(), []string{"documents", "download", "--tag", "invoice", "--all", "-o", "export"})
+	assert.EqualError(t, err, "failed to download 2 of 2 documents")
+	data, err := os.ReadFile(filepath.Join(tmpDir, "export", "doc1.pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "kept", string(data))
+}
+
+func TestUploadAdHocTags(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	var uploadedTags []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/tags/":
+			w.Write([]byte(`{"results": [{"id": 1, "name": "scanner"}, {"id": 2, "name": "Invoice"}, {"id": 2024, "name": "Old"}]}`))
+		case r.Method == "POST" && r.URL.Path == "/api/tags/":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 3, "name": "2024"}`))
+		case r.URL.Path == "/api/documents/post_document/":
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			uploadedTags = r.Form["tags"]
+		}
+	}))
+	defer server.Close()
+
+	config := "paperless_url: \"" + server.URL + "\"\napi_key: testkey\ntags: [scanner]\n"
+	assert.NoError(t, os.WriteFile("config.yaml", []byte(config), 0644))
+	assert.NoError(t, os.WriteFile("test.pdf", []byte("pdf"), 0644))
+
+	assert.NoError(t, runApp(context.Background(), []string{"upload", "test.pdf", "--tag", "invoice", "--tag", "2024"}))
+	assert.Equal(t, []string{"1", "2", "3"}, uploadedTags)
+
+	assert.NoError(t, runApp(context.Background(), []string{"upload", "test.pdf", "--tag", "invoice", "--replace-tags"}))
+	assert.Equal(t, []string{"2"}, uploadedTags)
+
+	assert.Error(t, runApp(context.Background(), []string{"upload", "test.pdf", "--tag", "missing", "--create-tags=false"}))
+}
+
+func TestUploadMetadataFlags(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	var form map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/correspondents/":
+			w.Write([]byte(`{"results": [{"id": 3, "name": "ACME"}]}`))
+		case "/api/document_types/":
+			w.Write([]byte(`{"results": [{"id": 4, "name": "Invoice"}]}`))
+		case "/api/storage_paths/":
+			w.Write([]byte(`{"results": [{"id": 5, "name": "Bills", "path": "bills/{created_year}"}]}`))
+		case "/api/documents/post_document/":
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			form = r.MultipartForm.Value
+		}
+	}))
+	defer server.Close()
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644))
+	assert.NoError(t, os.WriteFile("test.pdf", []byte("pdf"), 0644))
+
+	err := runApp(context.Background(), []string{"upload", "test.pdf",
+		"--title", "Power bill", "--correspondent", "acme", "--document-type", "invoice",
+		"--storage-path", "Bills", "--created", "2024-03-05", "--asn", "1001"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Power bill"}, form["title"])
+	assert.Equal(t, []string{"3"}, form["correspondent"])
+	assert.Equal(t, []string{"4"}, form["document_type"])
+	assert.Equal(t, []string{"5"}, form["storage_path"])
+	assert.Equal(t, []string{"2024-03-05"}, form["created"])
+	assert.Equal(t, []string{"1001"}, form["archive_serial_number"])
+
+	assert.Error(t, runApp(context.Background(), []string{"upload", "test.pdf", "--created", "yesterday"}))
+	assert.Error(t, runApp(context.Background(), []string{"upload", "test.pdf", "--correspondent", "nobody"}))
+}
+
+func TestVersionCommand(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Version", "2.11.6")
+	}))
+	defer server.Close()
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644))
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"version"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "paperless-uploader dev")
+	assert.Contains(t, out.String(), "go version: go")
+	assert.Contains(t, out.String(), "Paperless-ngx 2.11.6")
+}
+
+func TestHealthcheck(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/":
+			w.WriteHeader(http.StatusOK)
+		case "/status":
+			w.Write([]byte(`{"watching": true}`))
+		}
+	}))
+	defer server.Close()
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644))
+
+	assert.NoError(t, runApp(context.Background(), []string{"healthcheck"}))
+	assert.NoError(t, runApp(context.Background(), []string{"healthcheck", "--status-addr", strings.TrimPrefix(server.URL, "http://")}))
+
+	// No instance listening on the status address.
+	err := runApp(context.Background(), []string{"healthcheck", "--status-addr", "127.0.0.1:1"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unhealthy")
+}
+
+func TestStatusCommand(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"watching": true, "queue_depth": 2, "in_flight": 1, "retry_backlog": 3,
+			"folders": [{"path": "consume", "uploaded": 5, "failed": 1, "last_error": "boom"}]}`))
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	// Without a configured endpoint there is nothing to query.
+	err := runApp(context.Background(), []string{"status"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no status endpoint configured")
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("status_listen: \""+addr+"\"\n"), 0644))
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"status"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "Queue depth:   2")
+	assert.Contains(t, out.String(), "In flight:     1")
+	assert.Contains(t, out.String(), "Retry backlog: 3")
+	assert.Regexp(t, `consume\s+5\s+1\s+-\s+-\s+boom`, out.String())
+
+	out.Reset()
+	cmd = newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"status", "-o", "json"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), `"queue_depth": 2`)
+}
+
+func TestCompletion(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"id": 1, "name": "invoice"}, {"id": 2, "name": "receipt"}]}`))
+	}))
+	defer server.Close()
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644))
+
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		var out strings.Builder
+		cmd := newRootCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs([]string{"completion", shell})
+		assert.NoError(t, cmd.Execute(), shell)
+		assert.Contains(t, out.String(), "paperless-uploader", shell)
+	}
+
+	for _, args := range [][]string{
+		{"upload", "--tag", ""},
+		{"documents", "search", "--tag", ""},
+		{"tags", "delete", ""},
+	} {
+		var out strings.Builder
+		cmd := newRootCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs(append([]string{cobra.ShellCompRequestCmd}, args...))
+		assert.NoError(t, cmd.Execute())
+		assert.Contains(t, out.String(), "invoice\nreceipt\n", args)
+	}
+}
+
+func TestLogLevelFlags(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	err := runApp(context.Background(), []string{"version", "--short", "--log-level", "verbose"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid log level")
+
+	assert.NoError(t, runApp(context.Background(), []string{"version", "--short", "--quiet"}))
+	assert.Equal(t, logging.LevelError, logging.GetLevel())
+	assert.NoError(t, runApp(context.Background(), []string{"version", "--short", "--log-level", "debug"}))
+	assert.Equal(t, logging.LevelDebug, logging.GetLevel())
+	assert.NoError(t, runApp(context.Background(), []string{"version", "--short"}))
+	assert.Equal(t, logging.LevelInfo, logging.GetLevel())
+
+	err = runApp(context.Background(), []string{"version", "--short", "--log-format", "xml"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid log format")
+	assert.NoError(t, runApp(context.Background(), []string{"version", "--short", "--log-format", "json"}))
+
+	err = runApp(context.Background(), []string{"version", "--short", "--log-output", "file"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid log output")
+	assert.NoError(t, runApp(context.Background(), []string{"version", "--short", "--log-output", "stdout"}))
+}
+
+func TestContainerMode(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	// The config file is looked up in /data first.
+	err := runApp(context.Background(), []string{"--container", "config", "path"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no config file found in [/data .")
+
+	err = runApp(context.Background(), []string{"config", "path"})
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "/data")
+}
+
+func TestGenMan(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	assert.NoError(t, runApp(context.Background(), []string{"gen", "man", "--dir", "man"}))
+	for _, name := range []string{"paperless-uploader.1", "paperless-uploader-upload.1", "paperless-uploader-tags-list.1"} {
+		content, err := os.ReadFile(filepath.Join("man", name))
+		assert.NoError(t, err, name)
+		assert.Contains(t, string(content), ".TH \"PAPERLESS-UPLOADER\"", name)
+	}
+	content, err := os.ReadFile(filepath.Join("man", "paperless-uploader-upload.1"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "--tag")
+}
+
+func TestDoctor(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	apiKey := "testkey"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token "+apiKey {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Version", "2.11.6")
+	}))
+	defer server.Close()
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\nwatch_folder: consume\n"), 0644))
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"doctor"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "[PASS] Connectivity")
+	assert.Contains(t, out.String(), "[SKIP] TLS")
+	assert.Contains(t, out.String(), "[PASS] API token")
+	assert.Contains(t, out.String(), "[PASS] Paperless version: Paperless-ngx 2.11.6")
+	assert.Contains(t, out.String(), "[WARN] Watch folder consume: does not exist yet")
+
+	apiKey = "other"
+	out.Reset()
+	cmd = newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"doctor"})
+	err := cmd.Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of")
+	assert.Contains(t, out.String(), "[FAIL] API token")
+	assert.Contains(t, out.String(), "hint: create a new API token")
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "2.0 GiB", formatBytes(2<<30))
+}
+
+func TestUploadWait(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	taskPollInterval = time.Millisecond
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/documents/post_document/":
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			_, header, _ := r.FormFile("document")
+			w.Write([]byte(`"task-` + header.Filename + `"`))
+		case "/api/tasks/":
+			if r.URL.Query().Get("task_id") == "task-good.pdf" {
+				w.Write([]byte(`[{"task_id": "task-good.pdf", "status": "SUCCESS", "related_document": "42"}]`))
+				return
+			}
+			w.Write([]byte(`[{"task_id": "task-bad.pdf", "status": "FAILURE", "result": "not a PDF"}]`))
+		}
+	}))
+	defer server.Close()
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644))
+	assert.NoError(t, os.WriteFile("good.pdf", []byte("pdf"), 0644))
+	assert.NoError(t, os.WriteFile("bad.pdf", []byte("pdf"), 0644))
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"upload", "--wait", "good.pdf"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "Created document 42: "+server.URL+"/documents/42/details")
+
+	out.Reset()
+	cmd = newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"upload", "--wait", "good.pdf", "bad.pdf"})
+	err := cmd.Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 2 uploads failed")
+	assert.Contains(t, out.String(), "consumption failed: not a PDF")
+}
+
+func TestBackfillCommand(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/documents/":
+			w.Write([]byte(`{"results": []}`))
+		case "/api/documents/post_document/":
+			uploads.Add(1)
+			w.Write([]byte(`"task"`))
+		}
+	}))
+	defer server.Close()
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join("archive", "2019"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join("archive", "2019", "a.pdf"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join("archive", "b.pdf"), []byte("b"), 0644))
+
+	args := []string{"backfill", "archive", "--state", "backfill.jsonl", "--report", "report.csv"}
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs(args)
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "Backfilling 2 files; progress is kept in backfill.jsonl")
+	assert.Equal(t, int32(2), uploads.Load())
+	report, err := os.ReadFile("report.csv")
+	assert.NoError(t, err)
+	assert.Contains(t, string(report), "\n2019/a.pdf,uploaded,1,")
+
+	// A second run finds everything done.
+	assert.NoError(t, runApp(context.Background(), args))
+	assert.Equal(t, int32(2), uploads.Load())
+
+	assert.EqualError(t, runApp(context.Background(), []string{"backfill", "archive", "--concurrency", "0"}), "--concurrency must be at least 1")
+	assert.EqualError(t, runApp(context.Background(), []string{"backfill", "config.yaml"}), "config.yaml is not a directory")
+}
+
+func TestMigrateCommand(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	var mu sync.Mutex
+	var uploads []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/":
+		case "GET /api/documents/", "GET /api/document_types/", "GET /api/tags/":
+			w.Write([]byte(`{"results": []}`))
+		case "GET /api/correspondents/":
+			w.Write([]byte(`{"results": [{"id": 1, "name": "ACME"}]}`))
+		case "POST /api/correspondents/":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 2, "name": "Bank"}`))
+		case "POST /api/documents/post_document/":
+			mu.Lock()
+			uploads = append(uploads, r.FormValue("correspondent")+" "+r.FormValue("created"))
+			mu.Unlock()
+			w.Write([]byte(`"task"`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join("archive", "ACME", "2019"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join("archive", "Bank", "2020"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join("archive", "ACME", "2019", "a.pdf"), []byte("a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join("archive", "Bank", "2020", "2020-05-04 b.pdf"), []byte("b"), 0644))
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"migrate", "archive", "--state", "migrate.jsonl", "--dry-run"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "ACME/2019/a.pdf\nCorrespondent: ACME\nCreated:       2019-01-01\n")
+	assert.Contains(t, out.String(), "[dry-run] Uses 2 correspondents: ACME, Bank")
+	assert.Empty(t, uploads)
+
+	args := []string{"migrate", "archive", "--state", "migrate.jsonl", "--report", "report.csv"}
+	assert.NoError(t, runApp(context.Background(), args))
+	sort.Strings(uploads)
+	assert.Equal(t, []string{"1 2019-01-01", "2 2020-05-04"}, uploads)
+
+	// A second run finds everything done.
+	assert.NoError(t, runApp(context.Background(), args))
+	assert.Len(t, uploads, 2)
+
+	assert.EqualError(t, runApp(context.Background(), []string{"migrate", "archive", "--layout", "{who}"}), `invalid --layout: unknown layout field "who"`)
+}
+
+func TestBenchCommand(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags/":
+			w.Write([]byte(`{"results": [{"id": 3, "name": "benchmark"}]}`))
+		case "/api/documents/post_document/":
+			uploads.Add(1)
+			w.Write([]byte(`"task"`))
+		case "/api/tasks/":
+			w.Write([]byte(`[{"task_id": "task", "status": "SUCCESS", "related_document": 9}]`))
+		}
+	}))
+	defer server.Close()
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644))
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"bench", "--count", "3", "--size", "8KB"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, int32(3), uploads.Load())
+	assert.Contains(t, out.String(), "Documents:      3 succeeded, 0 failed")
+	assert.Contains(t, out.String(), "Task latency:")
+
+	assert.EqualError(t, runApp(context.Background(), []string{"bench", "--count", "0"}), "--count must be at least 1")
+	assert.EqualError(t, runApp(context.Background(), []string{"bench", "--size", "big"}), `invalid --size: invalid size "big"`)
+}
+
+func TestSimulateCommand(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte(`paperless_url: "http://127.0.0.1:1"
+api_key: testkey
+folders:
+  - path: inbox
+    tags: [inbox]
+    filename_pattern: '^(?P<correspondent>[^_]+)_(?P<title>.+)$'
+post_upload_action: delete
+`), 0644))
+	assert.NoError(t, os.WriteFile("scenario.yaml", []byte(`files:
+  - path: inbox/ACME_Bill.pdf
+    expect:
+      title: Bill
+      correspondent: ACME
+      tags: [inbox]
+      dest: deleted
+  - path: inbox/Other_Letter.pdf
+    expect:
+      title: Invoice
+`), 0644))
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"simulate", "scenario.yaml"})
+	assert.EqualError(t, cmd.Execute(), "1 of 2 files did not match their expectation")
+	assert.Contains(t, out.String(), "Correspondent: ACME\n")
+	assert.Contains(t, out.String(), "Post upload:   deleted\n")
+	assert.Contains(t, out.String(), `Mismatch:      title: expected "Invoice", got "Letter"`)
+	_, err := os.Stat("inbox")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestIndexCommand(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/documents/7/metadata/":
+			// The MD5 checksum of "uploaded".
+			w.Write([]byte(`{"original_checksum": "bf5f3461956c8f4ab9d7c0877c1505ad"}`))
+		case r.URL.Query().Get("fields") == "id":
+			w.Write([]byte(`{"all": [7], "results": []}`))
+		default:
+			w.Write([]byte(`{"next": null, "results": [{"id": 7, "title": "Power bill", "modified": "2024-05-01T10:00:00Z"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\ndocument_index:\n  path: index/documents.db\n"), 0644))
+	assert.NoError(t, os.WriteFile("uploaded.pdf", []byte("uploaded"), 0644))
+	assert.NoError(t, os.WriteFile("new.pdf", []byte("new"), 0644))
+
+	run := func(args ...string) string {
+		var out strings.Builder
+		cmd := newRootCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs(args)
+		assert.NoError(t, cmd.Execute())
+		return out.String()
+	}
+	assert.Contains(t, run("index", "lookup", "new.pdf"), "never refreshed")
+	assert.Equal(t, "Document index refreshed: 1 updated, 0 removed, 1 documents\n", run("index", "refresh"))
+
+	// Lookups need no server.
+	server.Close()
+	out := run("index", "lookup", "uploaded.pdf", "new.pdf")
+	assert.Contains(t, out, "uploaded.pdf: document 7 \"Power bill\" "+server.URL+"/documents/7/details\n")
+	assert.Contains(t, out, "new.pdf: not in Paperless\n")
+}
+
+func TestWatchOnce(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/documents/post_document/":
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			_, header, _ := r.FormFile("document")
+			w.Write([]byte(`"task-` + header.Filename + `"`))
+		case "/api/tasks/":
+			if r.URL.Query().Get("task_id") == "task-good.pdf" {
+				w.Write([]byte(`[{"task_id": "task-good.pdf", "status": "SUCCESS", "related_document": "42"}]`))
+				return
+			}
+			w.Write([]byte(`[{"task_id": "task-bad.pdf", "status": "FAILURE", "result": "not a PDF"}]`))
+		}
+	}))
+	defer server.Close()
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\nwatch_folder: consume\npost_upload_action: delete\n"), 0644))
+	assert.NoError(t, os.MkdirAll("consume", 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join("consume", "good.pdf"), []byte("pdf"), 0644))
+	assert.NoError(t, runApp(context.Background(), []string{"watch", "--once"}))
+	assert.NoFileExists(t, filepath.Join("consume", "good.pdf"))
+
+	assert.NoError(t, os.WriteFile(filepath.Join("consume", "good.pdf"), []byte("pdf"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join("consume", "bad.pdf"), []byte("pdf"), 0644))
+	err := runApp(context.Background(), []string{"watch", "--once"})
+	assert.EqualError(t, err, "1 of 2 files failed")
+
+	assert.EqualError(t, runApp(context.Background(), []string{"watch", "--once", "--tui"}), "--once and --tui cannot be combined")
+	assert.EqualError(t, runApp(context.Background(), []string{"watch", "--once", "--tray"}), "--tray cannot be combined with --once or --tui")
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\nwatch_folder: consume\nmemory_budget: plenty\n"), 0644))
+	assert.EqualError(t, runApp(context.Background(), []string{"watch", "--once"}), `invalid memory_budget: invalid size "plenty"`)
+	assert.Equal(t, 64, maxPendingFor(256<<20))
+	assert.Equal(t, 8, maxPendingFor(1<<20))
+}
+
+func TestUploadPushgateway(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+	var pushes []string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushes = append(pushes, r.URL.Path)
+	}))
+	defer gateway.Close()
+
+	config := "paperless_url: \"" + server.URL + "\"\napi_key: testkey\npushgateway:\n  url: \"" + gateway.URL + "\"\n  instance: test\n"
+	assert.NoError(t, os.WriteFile("config.yaml", []byte(config), 0644))
+	assert.NoError(t, os.WriteFile("scan.pdf", []byte("pdf"), 0644))
+
+	assert.NoError(t, runApp(context.Background(), []string{"upload", "scan.pdf"}))
+	assert.Error(t, runApp(context.Background(), []string{"upload", "missing.pdf"}))
+	assert.Equal(t, []string{"/metrics/job/paperless_uploader/instance/test", "/metrics/job/paperless_uploader/instance/test"}, pushes)
+
+	// Dry runs push nothing.
+	assert.NoError(t, runApp(context.Background(), []string{"upload", "--dry-run", "scan.pdf"}))
+	assert.Len(t, pushes, 2)
+}
+
+func TestUploadStdin(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	var filename, content string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/documents/post_document/" {
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			file, header, err := r.FormFile("document")
+			assert.NoError(t, err)
+			data, _ := io.ReadAll(file)
+			filename, content = header.Filename, string(data)
+		}
+	}))
+	defer server.Close()
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644))
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetIn(strings.NewReader("%PDF-1.4"))
+	cmd.SetArgs([]string{"upload", "-", "--name", "scan.pdf"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "scan.pdf", filename)
+	assert.Equal(t, "%PDF-1.4", content)
+	assert.Contains(t, out.String(), "Uploaded 1 of 1 documents successfully.")
+
+	cmd = newRootCmd()
+	cmd.SetArgs([]string{"upload", "-"})
+	assert.EqualError(t, cmd.Execute(), "--name is required when uploading from stdin")
+
+	cmd = newRootCmd()
+	cmd.SetArgs([]string{"upload", "-", "--name", "scan.pdf", "--files-from", "-"})
+	assert.Error(t, cmd.Execute())
+}
+
+func TestUploadURL(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	var filename, content string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/files/invoice.pdf":
+			if r.Header.Get("Cookie") != "session=abc" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte("%PDF-1.4"))
+		case "/api/documents/post_document/":
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			file, header, err := r.FormFile("document")
+			assert.NoError(t, err)
+			data, _ := io.ReadAll(file)
+			filename, content = header.Filename, string(data)
+		}
+	}))
+	defer server.Close()
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\n"), 0644))
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"upload", server.URL + "/files/invoice.pdf", "--header", "Cookie: session=abc"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, "invoice.pdf", filename)
+	assert.Equal(t, "%PDF-1.4", content)
+	assert.Contains(t, out.String(), "Uploaded 1 of 1 documents successfully.")
+
+	cmd = newRootCmd()
+	cmd.SetOut(io.Discard)
+	cmd.SetArgs([]string{"upload", server.URL + "/files/invoice.pdf"})
+	assert.Error(t, cmd.Execute())
+
+	cmd = newRootCmd()
+	cmd.SetArgs([]string{"upload", server.URL + "/files/invoice.pdf", "--header", "Cookie"})
+	assert.EqualError(t, cmd.Execute(), `invalid --header "Cookie", expected "Name: value"`)
+}
+
+func TestPickMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags/":
+			w.Write([]byte(`{"results": [{"id": 1, "name": "inbox"}, {"id": 2, "name": "invoice"}]}`))
+		case "/api/correspondents/":
+			w.Write([]byte(`{"results": [{"id": 7, "name": "ACME"}]}`))
+		case "/api/document_types/":
+			w.Write([]byte(`{"results": [{"id": 3, "name": "Bill"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	var titles []string
+	pickItems = func(title string, items []tui.Item, multi bool) ([]tui.Item, error) {
+		titles = append(titles, title)
+		if title == "Document type" {
+			return nil, nil
+		}
+		return items[len(items)-1:], nil
+	}
+	defer func() { pickItems = tui.Pick }()
+
+	client := paperless.NewClient(server.URL, "testkey")
+	var meta metadataFlags
+	var tags []string
+	assert.NoError(t, pickMetadata(client, &meta, &tags))
+	assert.Equal(t, []string{"Tags", "Correspondent", "Document type"}, titles)
+	assert.Equal(t, []string{"invoice"}, tags)
+	assert.Equal(t, "7", meta.correspondent)
+	assert.Empty(t, meta.documentType)
+
+	// Values given as flags are not picked again.
+	titles = nil
+	meta = metadataFlags{correspondent: "ACME", documentType: "Bill"}
+	tags = []string{"inbox"}
+	assert.NoError(t, pickMetadata(client, &meta, &tags))
+	assert.Empty(t, titles)
+	assert.Equal(t, []string{"inbox"}, tags)
+}
+
+func TestRetryFailed(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	var uploadedTags []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags/":
+			w.Write([]byte(`{"results": [{"id": 1, "name": "inbox"}]}`))
+		case "/api/documents/post_document/":
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			_, header, _ := r.FormFile("document")
+			if header.Filename == "bad.pdf" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			uploadedTags = r.MultipartForm.Value["tags"]
+		}
+	}))
+	defer server.Close()
+
+	assert.Error(t, runApp(context.Background(), []string{"retry-failed"}))
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\nfailed_folder: failed\nprocessed_folder: done\n"), 0644))
+	assert.NoError(t, os.MkdirAll("failed", 0755))
+	for _, name := range []string{"good.pdf", "bad.pdf"} {
+		path := filepath.Join("failed", name)
+		assert.NoError(t, os.WriteFile(path, []byte("pdf"), 0644))
+		assert.NoError(t, watcher.WriteFailedRecord(path, watcher.FailedRecord{Folder: "scanner", TagNames: []string{"inbox"}, Error: "timeout", Attempts: 4}))
+	}
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"retry-failed"})
+	err := cmd.Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 2 uploads failed")
+	assert.Equal(t, []string{"1"}, uploadedTags)
+
+	// The uploaded file was moved out of the failed folder.
+	assert.FileExists(t, filepath.Join("done", "good.pdf"))
+	assert.NoFileExists(t, filepath.Join("failed", "good.pdf.failed.json"))
+
+	failed, err := watcher.ListFailed("failed")
+	assert.NoError(t, err)
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, 5, failed[0].Record.Attempts)
+		assert.Contains(t, failed[0].Record.Error, "status code 400")
+	}
+}
+
+func TestRetryFailedEncrypted(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	var uploaded string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/documents/post_document/" {
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			f, header, _ := r.FormFile("document")
+			data, _ := io.ReadAll(f)
+			uploaded = header.Filename + ": " + string(data)
+		}
+	}))
+	defer server.Close()
+
+	assert.NoError(t, os.WriteFile("key", []byte(strings.Repeat("ab", 32)+"\n"), 0600))
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \""+server.URL+"\"\napi_key: testkey\nfailed_folder: failed\nprocessed_folder: done\nencryption:\n  key_file: key\n"), 0644))
+	cfg, err := loadConfigFile("")
+	assert.NoError(t, err)
+	assert.Equal(t, "REDACTED", logging.Redact(strings.Repeat("ab", 32)))
+	folder := watchFolders(cfg, nil)[0]
+	assert.NoError(t, os.WriteFile("scan.pdf", []byte("%PDF-1.4"), 0644))
+	dest, err := watcher.MoveToFailed(folder, "scan.pdf", 3, errors.New("timeout"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("failed", "scan.pdf.enc"), dest)
+
+	assert.NoError(t, runApp(context.Background(), []string{"retry-failed"}))
+	assert.Equal(t, "scan.pdf: %PDF-1.4", uploaded)
+	assert.FileExists(t, filepath.Join("done", "scan.pdf.enc"))
+
+	assert.NoError(t, runApp(context.Background(), []string{"decrypt", filepath.Join("done", "scan.pdf.enc"), "--output", "."}))
+	data, err := os.ReadFile("scan.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4", string(data))
+
+	assert.NoError(t, os.WriteFile("key", []byte("short"), 0600))
+	_, err = loadConfigFile("")
+	assert.ErrorContains(t, err, "invalid encryption.key_file")
+}
+
+func TestControlSocket(t *testing.T) {
+	dir, cleanup := setupTest(t)
+	defer cleanup()
+
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags/":
+			w.Write([]byte(`{"results": [{"id": 1, "name": "inbox"}]}`))
+		case "/api/documents/post_document/":
+			uploads.Add(1)
+			w.Write([]byte(`"task"`))
+		}
+	}))
+	defer server.Close()
+
+	base := "paperless_url: \"" + server.URL + "\"\napi_key: testkey\nwatch_folder: consume\nfailed_folder: failed\nprocessed_folder: done\n"
+	assert.NoError(t, os.WriteFile("config.yaml", []byte(base), 0644))
+	assert.EqualError(t, runApp(context.Background(), []string{"pause"}), "control_socket is not configured")
+	base += "control_socket: " + filepath.Join(dir, "control.sock") + "\n"
+	assert.NoError(t, os.WriteFile("config.yaml", []byte(base), 0644))
+	assert.ErrorIs(t, runApp(context.Background(), []string{"pause"}), control.ErrNotRunning)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- runApp(ctx, []string{"watch"}) }()
+
+	run := func(args ...string) (string, error) {
+		var out strings.Builder
+		cmd := newRootCmd()
+		cmd.SetOut(&out)
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return out.String(), err
+	}
+	assert.Eventually(t, func() bool {
+		out, err := run("status")
+		return err == nil && strings.Contains(out, "Watching:      yes")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	out, err := run("pause")
+	assert.NoError(t, err)
+	assert.Equal(t, "Processing paused.\n", out)
+	out, _ = run("status")
+	assert.Contains(t, out, "paused")
+
+	// The running watcher retries the failed files.
+	assert.NoError(t, os.MkdirAll("failed", 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join("failed", "scan.pdf"), []byte("pdf"), 0644))
+	assert.NoError(t, watcher.WriteFailedRecord(filepath.Join("failed", "scan.pdf"), watcher.FailedRecord{TagNames: []string{"inbox"}, Error: "timeout"}))
+	out, err = run("retry-failed")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "The running watcher retried the failed files.\nUploaded 1 of 1 documents successfully.")
+	assert.Equal(t, int32(1), uploads.Load())
+
+	// An invalid configuration is rejected; a valid one restarts the
+	// watcher, which stays paused.
+	assert.NoError(t, os.WriteFile("config.yaml", []byte(base+"proxy: \"ftp://proxy\"\n"), 0644))
+	_, err = run("reload")
+	assert.ErrorContains(t, err, "invalid configuration, keeping the current one")
+	assert.NoError(t, os.WriteFile("config.yaml", []byte(base), 0644))
+	out, err = run("reload")
+	assert.NoError(t, err)
+	assert.Equal(t, "Configuration reloaded.\n", out)
+	assert.Eventually(t, func() bool {
+		out, err := run("status")
+		return err == nil && strings.Contains(out, "Watching:      yes, paused")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	out, err = run("flush")
+	assert.NoError(t, err)
+	assert.Equal(t, "Queued 0 files for upload.\n", out)
+	_, err = run("resume")
+	assert.NoError(t, err)
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.NoFileExists(t, filepath.Join(dir, "control.sock"))
+}
+
+func TestNewWebUI(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	var uploaded []string
+	paperlessServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags/":
+			w.Write([]byte(`{"results": [{"id": 1, "name": "inbox"}]}`))
+		case "/api/correspondents/":
+			w.Write([]byte(`{"results": [{"id": 1, "name": "ACME"}]}`))
+		case "/api/document_types/":
+			w.Write([]byte(`{"results": []}`))
+		case "/api/documents/post_document/":
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			_, header, _ := r.FormFile("document")
+			uploaded = append(uploaded, header.Filename)
+		}
+	}))
+	defer paperlessServer.Close()
+
+	cfg := &config.Config{PaperlessURL: paperlessServer.URL, APIKey: "key", WatchFolder: "consume", FailedFolder: "failed", ProcessedFolder: "done"}
+	cfg.WebUI.MaxFileSize = "1M"
+	client := newClient(cfg)
+	folders := watchFolders(cfg, nil)
+	ui, err := newWebUI(cfg, folders, watcher.New(client, folders), client, newReceivedMetadata(), false)
+	assert.NoError(t, err)
+
+	choices, err := ui.Choices()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"inbox"}, choices.Tags)
+	assert.Equal(t, []string{"ACME"}, choices.Correspondents)
+
+	failed, err := ui.Failed()
+	assert.NoError(t, err)
+	assert.Empty(t, failed)
+	assert.NoError(t, os.MkdirAll("failed", 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join("failed", "bad.pdf"), []byte("pdf"), 0644))
+	assert.NoError(t, watcher.WriteFailedRecord(filepath.Join("failed", "bad.pdf"), watcher.FailedRecord{Folder: "consume", Error: "timeout", Attempts: 3}))
+	failed, err = ui.Failed()
+	assert.NoError(t, err)
+	assert.Equal(t, []server.FailedFile{{Name: "bad.pdf", Folder: "consume", Error: "timeout", Attempts: 3}}, failed)
+
+	assert.ErrorIs(t, ui.Retry("other.pdf"), server.ErrNotFound)
+	assert.NoError(t, ui.Retry("bad.pdf"))
+	assert.Equal(t, []string{"bad.pdf"}, uploaded)
+	assert.FileExists(t, filepath.Join("done", "bad.pdf"))
+
+	cfg.WebUI.Folder = "elsewhere"
+	_, err = newWebUI(cfg, folders, nil, client, nil, false)
+	assert.ErrorContains(t, err, "invalid web_ui.folder")
+}
+
+func TestPurge(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("processed_folder: done\nfailed_folder: failed\nretention:\n  processed: 30d\n"), 0644))
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	for _, path := range []string{filepath.Join("done", "2024", "old.pdf"), filepath.Join("done", "new.pdf"), filepath.Join("failed", "old.pdf")} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("pdf"), 0644))
+		if strings.HasSuffix(path, "old.pdf") {
+			assert.NoError(t, os.Chtimes(path, old, old))
+		}
+	}
+	assert.NoError(t, watcher.WriteFailedRecord(filepath.Join("failed", "old.pdf"), watcher.FailedRecord{Error: "boom"}))
+
+	// Dry runs only report.
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"purge", "--dry-run"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "[dry-run] Would delete 1 files.")
+	assert.FileExists(t, filepath.Join("done", "2024", "old.pdf"))
+
+	// The failed folder has no retention, so only processed files go.
+	assert.NoError(t, runApp(context.Background(), []string{"purge"}))
+	assert.NoFileExists(t, filepath.Join("done", "2024", "old.pdf"))
+	assert.FileExists(t, filepath.Join("done", "new.pdf"))
+	assert.FileExists(t, filepath.Join("failed", "old.pdf"))
+
+	assert.NoError(t, runApp(context.Background(), []string{"purge", "--older-than", "1w"}))
+	assert.NoFileExists(t, filepath.Join("failed", "old.pdf"))
+	assert.NoFileExists(t, filepath.Join("failed", "old.pdf.failed.json"))
+	assert.FileExists(t, filepath.Join("done", "new.pdf"))
+
+	assert.Error(t, runApp(context.Background(), []string{"purge", "--older-than", "soon"}))
+}
+
+func TestAuditCommand(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	err := runApp(context.Background(), []string{"audit", "invoice"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no audit log configured")
+
+	log := `{"time":"2024-03-01T10:00:00Z","event":"detected","id":"a1","file":"consume/invoice-march.pdf"}
+{"time":"2024-03-01T10:00:01Z","event":"detected","id":"b2","file":"consume/receipt.pdf"}
+{"time":"2024-03-01T10:00:02Z","event":"uploaded","id":"a1","file":"consume/invoice-march.pdf","task_id":"t-1"}
+not json
+{"time":"2024-03-01T10:00:05Z","event":"consumed","id":"a1","file":"consume/invoice-march.pdf","task_id":"t-1","document_id":42}
+{"time":"2024-03-01T10:00:06Z","event":"moved","id":"a1","file":"consume/invoice-march.pdf","dest":"done/invoice-march.pdf"}
+`
+	assert.NoError(t, os.WriteFile("audit.jsonl", []byte(log), 0644))
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("audit_log: audit.jsonl\n"), 0644))
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"audit", "Invoice"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, 5, strings.Count(out.String(), "\n"))
+	assert.Contains(t, out.String(), "document=42")
+	assert.Contains(t, out.String(), "to=done/invoice-march.pdf")
+	assert.NotContains(t, out.String(), "receipt.pdf")
+
+	err = runApp(context.Background(), []string{"audit", "missing"})
+	assert.EqualError(t, err, `no audit records for "missing"`)
+}
+
+func TestAuditVerify(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	_, key, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile("audit.key", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("audit_log: audit.jsonl\naudit_signing_key: audit.key\n"), 0644))
+	l, err := audit.Open("audit.jsonl", key)
+	assert.NoError(t, err)
+	for _, name := range []string{"invoice.pdf", "receipt.pdf"} {
+		assert.NoError(t, l.Write(audit.Record{Event: "detected", ID: name, File: name}))
+	}
+	assert.NoError(t, l.Close())
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"audit", "verify"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "Verified 2 records, all signed\nLast record: 2, hash ")
+
+	data, err := os.ReadFile("audit.jsonl")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile("audit.jsonl", []byte(strings.Replace(string(data), "receipt.pdf", "other.pdf", 1)), 0644))
+	err = runApp(context.Background(), []string{"audit", "verify"})
+	assert.EqualError(t, err, "audit log was modified: line 2 does not match its hash")
+}
+
+func TestTagsSync(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	var created []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Write([]byte(`{"results": [{"id": 1, "name": "inbox"}, {"id": 2, "name": "Invoice"}, {"id": 2024, "name": "Old"}]}`))
+		case "POST":
+			var tag paperless.NewTag
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&tag))
+			created = append(created, tag.Name)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 3, "name": "` + tag.Name + `"}`))
+		}
+	}))
+	defer server.Close()
+
+	config := "paperless_url: \"" + server.URL + "\"\napi_key: testkey\ntags: [inbox, \"2024\"]\nfolders:\n  - path: scans\n    tags: [scanner, invoice]\n"
+	assert.NoError(t, os.WriteFile("config.yaml", []byte(config), 0644))
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"tags", "sync", "--check"})
+	err := cmd.Execute()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "3 tags differ")
+	assert.Contains(t, out.String(), "ok       inbox")
+	assert.Contains(t, out.String(), "missing  scanner")
+	assert.Contains(t, out.String(), "missing  2024")
+	assert.Contains(t, out.String(), `drift    invoice (exists as "Invoice")`)
+	assert.Empty(t, created)
+
+	out.Reset()
+	cmd = newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"tags", "sync"})
+	assert.NoError(t, cmd.Execute())
+	assert.Equal(t, []string{"2024", "scanner"}, created)
+	assert.Contains(t, out.String(), "created  scanner (ID 3)")
+}
+
+func TestRulesTest(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+
+	config := `tags: [inbox]
+post_upload_action: move
+processed_folder: done
+folders:
+  - path: scans
+    tags: [scanner]
+    filename_pattern: '^(?P<created>\d{8})_(?P<correspondent>[^_]+)_(?P<title>.+)$'
+    title_template: "{{.correspondent}}: {{.title}}"
+rules:
+  - name: mailed bills
+    match:
+      sender: "*@acme.example"
+      filename: "*bill*"
+    set:
+      document_type: Bill
+      tags: [bills]
+      post_upload_action: keep
+`
+	assert.NoError(t, os.WriteFile("config.yaml", []byte(config), 0644))
+
+	var out strings.Builder
+	cmd := newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"rules", "test", filepath.Join("scans", "20240305_ACME_Power bill.pdf")})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "Folder:        scans")
+	assert.Contains(t, out.String(), "Pattern:       matched")
+	assert.Contains(t, out.String(), "Title:         ACME: Power bill")
+	assert.Contains(t, out.String(), "Created:       2024-03-05")
+	assert.Contains(t, out.String(), "Correspondent: ACME")
+	assert.Contains(t, out.String(), "Tags:          scanner")
+	assert.Contains(t, out.String(), "Post upload:   Would move")
+	assert.Contains(t, out.String(), "Rules:         -")
+
+	out.Reset()
+	cmd = newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"rules", "test", "--sender", "billing@ACME.example", filepath.Join("scans", "20240305_ACME_Power bill.pdf")})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "Rules:         mailed bills")
+	assert.Contains(t, out.String(), "Document type: Bill")
+	assert.Contains(t, out.String(), "Tags:          scanner, bills")
+	assert.Contains(t, out.String(), "Post upload:   Would leave")
+
+	out.Reset()
+	cmd = newRootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"rules", "test", "-o", "json", "elsewhere/file.pdf"})
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), `"tags": [
+      "inbox"
+    ]`)
+	assert.Contains(t, out.String(), `"matched": false`)
+}
+
+func TestNewSMTPReceiver(t *testing.T) {
+	folders := []watcher.Folder{{Path: "consume"}, {Path: "scanner"}}
+	cfg := config.SMTPReceiver{
+		Listen:         ":2525",
+		MaxMessageSize: "1M",
+		Routes:         []config.SMTPRoute{{Sender: "*@office.lan", Folder: "./scanner"}},
+	}
+	s, err := newSMTPReceiver(cfg, folders)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1<<20), s.MaxSize)
+	assert.Equal(t, "scanner", s.Routes[0].Folder)
+	assert.Equal(t, "consume", s.Folder)
+
+	cfg.RejectUnknownSenders = true
+	s, err = newSMTPReceiver(cfg, folders)
+	assert.NoError(t, err)
+	assert.Empty(t, s.Folder)
+
+	cfg.Routes[0].Folder = "elsewhere"
+	_, err = newSMTPReceiver(cfg, folders)
+	assert.EqualError(t, err, "invalid smtp_receiver route for *@office.lan: elsewhere is not a watch folder")
+}
+
+func TestNewFTPReceiver(t *testing.T) {
+	folders := []watcher.Folder{{Path: "consume"}, {Path: "scanner"}}
+	cfg := config.FTPReceiver{
+		Listen:       ":2121",
+		PassivePorts: "50000-50100",
+		MaxFileSize:  "1M",
+		Users: []config.FTPUser{
+			{Username: "scanner", Password: "secret", Folder: "./scanner"},
+			{Username: "office", Password: "secret"},
+		},
+	}
+	s, err := newFTPReceiver(cfg, folders)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1<<20), s.MaxSize)
+	assert.Equal(t, [2]int{50000, 50100}, s.PassivePorts)
+	assert.Equal(t, "scanner", s.Users[0].Folder)
+	assert.Equal(t, "consume", s.Users[1].Folder)
+
+	cfg.PassivePorts = "50100-50000"
+	_, err = newFTPReceiver(cfg, folders)
+	assert.ErrorContains(t, err, "invalid ftp_receiver.passive_ports")
+
+	cfg.PassivePorts = ""
+	cfg.RequireTLS = true
+	_, err = newFTPReceiver(cfg, folders)
+	assert.EqualError(t, err, "ftp_receiver.require_tls needs tls_cert and tls_key")
+
+	cfg.RequireTLS = false
+	cfg.Users[0].Folder = "elsewhere"
+	_, err = newFTPReceiver(cfg, folders)
+	assert.EqualError(t, err, "invalid ftp_receiver folder for scanner: elsewhere is not a watch folder")
+}
+
+func TestReceivedMetadata(t *testing.T) {
+	dir := t.TempDir()
+	folders := []watcher.Folder{{Path: dir}}
+	cfg := config.UploadReceiver{Listen: ":8766", MaxFileSize: "1M"}
+	received := newReceivedMetadata()
+	_, err := newUploadHandler(cfg, folders, received)
+	assert.EqualError(t, err, "upload_receiver needs a token")
+
+	received.attach(nil, folders)
+	dest, err := received.deliver(dir, "scan.pdf", strings.NewReader("%PDF"), rules.Metadata{Title: "Invoice", Created: "2024-01-02"})
+	assert.NoError(t, err)
+	plain, err := received.deliver(dir, "other.pdf", strings.NewReader("%PDF"), rules.Metadata{})
+	assert.NoError(t, err)
+
+	opts, err := folders[0].Metadata(dest)
+	assert.NoError(t, err)
+	assert.Equal(t, "Invoice", opts.Title)
+	assert.Equal(t, "2024-01-02", opts.Created)
+	opts, err = folders[0].Metadata(plain)
+	assert.NoError(t, err)
+	assert.Empty(t, opts.Title)
+
+	received.Handle(watcher.Event{Type: watcher.EventUploaded, Path: dest})
+	opts, err = folders[0].Metadata(dest)
+	assert.NoError(t, err)
+	assert.Empty(t, opts.Title)
+}
+
+func TestNewMQTTCommands(t *testing.T) {
+	dir := t.TempDir()
+	shared := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(shared, "scan.pdf"), []byte("%PDF"), 0o644))
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	assert.NoError(t, os.WriteFile(outside, []byte("secret"), 0o644))
+	folders := []watcher.Folder{{Path: dir}}
+	cfg := config.MQTT{
+		UploadPaths: []string{shared},
+		ScanProfiles: []config.ScanProfile{
+			{Name: "fail", Command: []string{"sh", "-c", "echo no scanner found; exit 1"}},
+			{Name: "touch", Command: []string{"touch", "scanned.pdf"}},
+		},
+	}
+	c, err := newMQTTCommands(cfg, folders, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fail", "touch"}, c.Profiles)
+
+	ctx := context.Background()
+	assert.NoError(t, c.Scan(ctx, "touch"))
+	assert.FileExists(t, filepath.Join(dir, "scanned.pdf"))
+	assert.ErrorContains(t, c.Scan(ctx, "fail"), "no scanner found")
+	assert.EqualError(t, c.Scan(ctx, "other"), "unknown scan profile other")
+
+	dest, err := c.Upload(ctx, filepath.Join(shared, "scan.pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "scan.pdf"), dest)
+	assert.FileExists(t, filepath.Join(shared, "scan.pdf"), "the original is kept")
+	_, err = c.Upload(ctx, outside)
+	assert.ErrorContains(t, err, "is not within mqtt.upload_paths")
+	_, err = c.Upload(ctx, filepath.Join(shared, "..", filepath.Base(filepath.Dir(outside)), "secret.txt"))
+	assert.Error(t, err)
+
+	cfg.ScanProfiles = append(cfg.ScanProfiles, config.ScanProfile{Name: "touch", Command: []string{"true"}})
+	_, err = newMQTTCommands(cfg, folders, nil)
+	assert.EqualError(t, err, "duplicate mqtt scan profile touch")
+}
+
+func TestLoadConfigFileRegistersSecrets(t *testing.T) {
+	_, cleanup := setupTest(t)
+	defer cleanup()
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("paperless_url: \"http://paperless\"\napi_key: registered-api-key\nmqtt:\n  password: registered-mqtt-pass\n"), 0644))
+
+	_, err := loadConfigFile("")
+	assert.NoError(t, err)
+	assert.Equal(t, "key REDACTED, password REDACTED", logging.Redact("key registered-api-key, password registered-mqtt-pass"))
+}
+
+func TestNewClientHeaders(t *testing.T) {
+	cfg := &config.Config{PaperlessURL: "http://paperless", APIKey: "key", Headers: map[string]string{"cf-access-client-id": "id.access"}}
+	assert.Equal(t, http.Header{"Cf-Access-Client-Id": {"id.access"}}, newClientWithKey(cfg, "alice").Header)
+	assert.Nil(t, newClient(&config.Config{}).Header)
+}
+
+// serveSOCKS5 accepts unauthenticated SOCKS5 CONNECT requests for domain
+// names on l, sending the requested addresses to targets.
+func serveSOCKS5(l net.Listener, targets chan<- string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			buf := make([]byte, 262)
+			// Greeting: version, methods; request: version, command,
+			// reserved, address type 3 (domain), length, name, port.
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				return
+			}
+			io.ReadFull(conn, buf[:buf[1]])
+			conn.Write([]byte{5, 0})
+			if _, err := io.ReadFull(conn, buf[:5]); err != nil || buf[3] != 3 {
+				return
+			}
+			n := int(buf[4])
+			io.ReadFull(conn, buf[:n+2])
+			addr := net.JoinHostPort(string(buf[:n]), strconv.Itoa(int(buf[n])<<8|int(buf[n+1])))
+			targets <- addr
+			upstream, err := net.Dial("tcp", addr)
+			if err != nil {
+				conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+				return
+			}
+			defer upstream.Close()
+			conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+			go io.Copy(upstream, conn)
+			io.Copy(conn, upstream)
+		}()
+	}
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [{"id": 1, "name": "inbox"}]}`))
+	}))
+	defer server.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	targets := make(chan string, 1)
+	go serveSOCKS5(l, targets)
+
+	// The host name is only resolved by the proxy.
+	port := strings.TrimPrefix(server.URL, "http://127.0.0.1:")
+	cfg := &config.Config{PaperlessURL: "http://localhost:" + port, APIKey: "key", Proxy: "socks5h://" + l.Addr().String()}
+	tags, err := newClient(cfg).GetTags()
+	assert.NoError(t, err)
+	assert.Len(t, tags, 1)
+	assert.Equal(t, "localhost:"+port, <-targets)
+
+	assert.Nil(t, paperlessTransport(&config.Config{}))
+	for _, proxy := range []string{"ftp://proxy:21", "127.0.0.1:1080", "socks5://"} {
+		_, err := parseProxy(proxy)
+		assert.ErrorContains(t, err, "invalid proxy", proxy)
+	}
+}
+
+func TestWatchFoldersAPIKeys(t *testing.T) {
+	cfg := &config.Config{PaperlessURL: "http://paperless", APIKey: "shared", Folders: []config.FolderConfig{
+		{Path: "a"}, {Path: "b", APIKey: "alice"}, {Path: "c", APIKey: "alice"}, {Path: "d", APIKey: "shared"},
+	}}
+	folders := watchFolders(cfg, nil)
+	assert.Nil(t, folders[0].Client)
+	assert.Equal(t, "alice", folders[1].Client.APIKey)
+	assert.Same(t, folders[1].Client, folders[2].Client)
+	assert.Nil(t, folders[3].Client)
+}
+
+func TestNewScreenshotSource(t *testing.T) {
+	dir := t.TempDir()
+	shots := t.TempDir()
+	folders := []watcher.Folder{{Path: dir}}
+	received := newReceivedMetadata()
+	cfg := config.Screenshots{Watch: true, ScreenshotFolder: shots, Tags: []string{"screenshot"}}
+	s, err := newScreenshotSource(cfg, folders, received)
+	assert.NoError(t, err)
+	assert.Equal(t, shots, s.Folder)
+
+	dest, err := s.Deliver("receipt.pdf", strings.NewReader("%PDF"))
+	assert.NoError(t, err)
+	assert.Equal(t, rules.Metadata{Tags: []string{"screenshot"}}, received.files[dest])
+
+	cfg.ScreenshotFolder = dir
+	_, err = newScreenshotSource(cfg, folders, received)
+	assert.EqualError(t, err, "screenshots.screenshot_folder must not be a watch folder")
 }
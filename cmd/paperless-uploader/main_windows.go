@@ -3,80 +3,94 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"strings"
-	"time"
 
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/debug"
 	"golang.org/x/sys/windows/svc/eventlog"
-	"golang.org/x/sys/windows/svc/mgr"
 )
 
-const serviceName = "PaperlessUploader"
+// serviceName returns the name of the Windows service of the selected
+// instance.
+func serviceName() string {
+	return config.Namespaced("PaperlessUploader")
+}
 
 var elog debug.Log
 
 func main() {
+	defer reportPanic()
 	isInteractive, err := svc.IsAnInteractiveSession()
 	if err != nil {
 		log.Fatalf("failed to determine if we are running in an interactive session: %v", err)
 	}
 
 	if !isInteractive {
+		// The service name depends on the instance recorded in the
+		// service arguments, which are only parsed by runApp.
+		if err := config.SetInstance(instanceArg(os.Args[1:])); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
 		runService(false)
 		return
 	}
 
-	if len(os.Args) > 1 {
-		cmd := strings.ToLower(os.Args[1])
-		switch cmd {
-		case "debug":
-			runService(true)
-			return
-		case "install":
-			err = installService()
-		case "remove":
-			err = removeService()
-		case "start":
-			err = startService()
-		case "stop":
-			err = controlService(svc.Stop, svc.Stopped)
-		case "pause":
-			err = controlService(svc.Pause, svc.Paused)
-		case "continue":
-			err = controlService(svc.Continue, svc.Running)
-		default:
-			if err := runApp(); err != nil {
-				log.Fatalf("Error: %v", err)
-			}
-			return
-		}
-		if err != nil {
-			log.Fatalf("failed to %s service: %v", cmd, err)
-		}
-		return
+	if err := runApp(context.Background(), os.Args[1:]); err != nil {
+		fatal(err)
 	}
+}
 
-	// if we are not running as a service, and no command was given, run the app
-	if err := runApp(); err != nil {
-		log.Fatalf("Error: %v", err)
+// instanceArg returns the value of the --instance flag in args.
+func instanceArg(args []string) string {
+	for i, arg := range args {
+		if name, ok := strings.CutPrefix(arg, "--instance="); ok {
+			return name
+		}
+		if arg == "--instance" && i+1 < len(args) {
+			return args[i+1]
+		}
 	}
+	return ""
 }
 
 type paperlessUploaderService struct{}
 
 func (s *paperlessUploaderService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
-	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown
+	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
 	changes <- svc.Status{State: svc.StartPending}
 	elog.Info(1, "Paperless Uploader service starting.")
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The service arguments recorded at install time select the command,
+	// e.g. "watch --config C:\ProgramData\PaperlessUploader\config.yaml".
+	appArgs := os.Args[1:]
+	if len(appArgs) == 0 {
+		appArgs = []string{"watch"}
+	}
+	// Pause and Continue are applied to the watcher once the watch command
+	// has created it.
+	watchers := make(chan *watcher.Watcher, 1)
+	watcherCreated = func(w *watcher.Watcher) { watchers <- w }
+	var (
+		w      *watcher.Watcher
+		paused bool
+	)
+	// A failing command stops the service with an error, so the recovery
+	// actions configured at install time restart it.
+	failed := make(chan struct{})
 	go func() {
-		if err := runApp(); err != nil {
+		if err := runApp(ctx, appArgs); err != nil {
 			elog.Error(1, fmt.Sprintf("runApp failed: %v", err))
+			close(failed)
 		}
 	}()
 
@@ -90,9 +104,30 @@ func (s *paperlessUploaderService) Execute(args []string, r <-chan svc.ChangeReq
 				elog.Info(1, "Paperless Uploader service stopping.")
 				changes <- svc.Status{State: svc.StopPending}
 				return
+			case svc.Pause:
+				elog.Info(1, "Paperless Uploader service pausing.")
+				paused = true
+				if w != nil {
+					w.Pause()
+				}
+				changes <- svc.Status{State: svc.Paused, Accepts: cmdsAccepted}
+			case svc.Continue:
+				elog.Info(1, "Paperless Uploader service continuing.")
+				paused = false
+				if w != nil {
+					w.Resume()
+				}
+				changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 			default:
 				elog.Error(1, fmt.Sprintf("unexpected control request #%d", c))
 			}
+		case <-failed:
+			changes <- svc.Status{State: svc.StopPending}
+			return false, 1
+		case w = <-watchers:
+			if paused {
+				w.Pause()
+			}
 		}
 	}
 }
@@ -100,9 +135,9 @@ func (s *paperlessUploaderService) Execute(args []string, r <-chan svc.ChangeReq
 func runService(isDebug bool) {
 	var err error
 	if isDebug {
-		elog = debug.New(serviceName)
+		elog = debug.New(serviceName())
 	} else {
-		elog, err = eventlog.Open(serviceName)
+		elog, err = eventlog.Open(serviceName())
 		if err != nil {
 			return
 		}
@@ -114,99 +149,10 @@ func runService(isDebug bool) {
 	if isDebug {
 		run = debug.Run
 	}
-	err = run(serviceName, &paperlessUploaderService{})
+	err = run(serviceName(), &paperlessUploaderService{})
 	if err != nil {
 		elog.Error(1, fmt.Sprintf("service run failed: %v", err))
 		return
 	}
 	elog.Info(1, "Paperless Uploader service stopped.")
 }
-
-func getServiceManager() (*mgr.Mgr, error) {
-	return mgr.Connect()
-}
-
-func installService() error {
-	m, err := getServiceManager()
-	if err != nil {
-		return err
-	}
-	defer m.Disconnect()
-
-	exepath, err := os.Executable()
-	if err != nil {
-		return err
-	}
-
-	s, err := m.CreateService(serviceName, exepath, mgr.Config{DisplayName: "Paperless Uploader Service"})
-	if err != nil {
-		return err
-	}
-	defer s.Close()
-
-	return nil
-}
-
-func removeService() error {
-	m, err := getServiceManager()
-	if err != nil {
-		return err
-	}
-	defer m.Disconnect()
-
-	s, err := m.OpenService(serviceName)
-	if err != nil {
-		return fmt.Errorf("service %s is not installed", serviceName)
-	}
-	defer s.Close()
-
-	return s.Delete()
-}
-
-func startService() error {
-	m, err := getServiceManager()
-	if err != nil {
-		return err
-	}
-	defer m.Disconnect()
-
-	s, err := m.OpenService(serviceName)
-	if err != nil {
-		return fmt.Errorf("could not access service: %v", err)
-	}
-	defer s.Close()
-
-	return s.Start()
-}
-
-func controlService(c svc.Cmd, to svc.State) error {
-	m, err := getServiceManager()
-	if err != nil {
-		return err
-	}
-	defer m.Disconnect()
-
-	s, err := m.OpenService(serviceName)
-	if err != nil {
-		return fmt.Errorf("could not access service: %v", err)
-	}
-	defer s.Close()
-
-	status, err := s.Control(c)
-	if err != nil {
-		return fmt.Errorf("could not send control=%d: %v", c, err)
-	}
-
-	timeout := time.Now().Add(10 * time.Second)
-	for status.State != to {
-		if time.Now().After(timeout) {
-			return fmt.Errorf("timeout waiting for service to go to state=%d", to)
-		}
-		time.Sleep(300 * time.Millisecond)
-		status, err = s.Query()
-		if err != nil {
-			return fmt.Errorf("could not retrieve service status: %v", err)
-		}
-	}
-	return nil
-}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/c-yco/go-paperless-uploader/internal/backfill"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/migrate"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCmd(opts *globalOptions) *cobra.Command {
+	var (
+		layout         string
+		tags           []string
+		create         bool
+		concurrency    int
+		rate           float64
+		statePath      string
+		reportPath     string
+		skipDuplicates bool
+	)
+	cmd := &cobra.Command{
+		Use:   "migrate <directory>",
+		Short: "Import an archive organized in folders, deriving metadata from the paths",
+		Long: `Import an existing archive organized in folders, such as
+Archive/<Correspondent>/<Year>/..., the one-time import when adopting
+Paperless.
+
+--layout names what the folder levels below the directory stand for, from
+the top: {correspondent}, {document_type}, {storage_path}, {tag}, {year},
+{month}, {day}, or * for a level that is ignored. Folders below the last
+level become tags. The creation date is taken from the file name if it
+starts with one (2024-03-05, 2024_03_05 or 20240305), otherwise from the
+year, month and day folders. Correspondents, document types and tags that
+Paperless does not have yet are created, unless --create=false; storage
+paths must exist.
+
+Like backfill, every file is checkpointed as soon as it is done, so an
+interrupted migration continues where it stopped when run again, files whose
+content Paperless already has are skipped, and a CSV report is written to
+--report. Use --dry-run to see the metadata derived from the paths.`,
+		Example: `  paperless-uploader migrate ~/Archive --layout "{correspondent}/{year}" --dry-run
+  paperless-uploader migrate ~/Archive --layout "{document_type}/{correspondent}/*" --tag migrated`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := args[0]
+			if info, err := os.Stat(dir); err != nil {
+				return err
+			} else if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			l, err := migrate.ParseLayout(layout)
+			if err != nil {
+				return fmt.Errorf("invalid --layout: %v", err)
+			}
+			if concurrency < 1 {
+				return fmt.Errorf("--concurrency must be at least 1")
+			}
+			if rate < 0 {
+				return fmt.Errorf("--rate must not be negative")
+			}
+			cfg, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+			journal, statePath, closeJournal, err := openJournal(cfg, "migrate", dir, statePath)
+			if err != nil {
+				return err
+			}
+			defer closeJournal()
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Scanning %s...\n", dir)
+			files, err := backfill.Scan(dir)
+			if err != nil {
+				return err
+			}
+			if opts.dryRun {
+				return writeMigrationPlan(out, l, journal, files, append(append([]string{}, cfg.Tags...), tags...))
+			}
+
+			tagIDs, err := resolveTagIDs(client, cfg.Tags)
+			if err != nil {
+				return err
+			}
+			adHocIDs, err := ensureTags(client, tags, create)
+			if err != nil {
+				return err
+			}
+			base := mergeIDs(tagIDs, adHocIDs)
+			resolver := migrate.NewResolver(client)
+			resolver.Create = create
+			resolver.Created = func(kind, name string) {
+				logging.Infof("Created %s '%s'", kind, name)
+			}
+
+			fmt.Fprintf(out, "Migrating %d files; progress is kept in %s\n", len(files), statePath)
+			bar := newProgressBar(cmd.ErrOrStderr(), "Migration")
+			b := &backfill.Backfill{
+				Client:         client,
+				Journal:        journal,
+				Concurrency:    concurrency,
+				Rate:           rate,
+				SkipDuplicates: skipDuplicates,
+				Progress:       bar.update,
+			}
+			b.OptionsFor = func(f backfill.File) (paperless.UploadOptions, error) {
+				options, err := resolver.Resolve(l.Derive(f.Rel))
+				options.Tags = mergeIDs(base, options.Tags)
+				return options, err
+			}
+			if skipDuplicates && cfg.DocumentIndex.Path != "" {
+				index, err := openIndex(cfg)
+				if err != nil {
+					return err
+				}
+				defer index.Close()
+				refreshIndex(cmd.Context(), index, client)
+				b.Index = index
+			}
+			records, runErr := b.Run(cmd.Context(), files)
+			bar.finish()
+
+			if err := writeBackfillReport(reportPath, records); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Report written to %s\n", reportPath)
+			if runErr != nil {
+				return fmt.Errorf("migration interrupted after %d of %d files; run it again to continue", len(records), len(files))
+			}
+			var failed int
+			for _, r := range records {
+				if r.Status == backfill.StatusFailed {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d files failed", failed, len(files))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&layout, "layout", migrate.DefaultLayout, "what the folder levels stand for, e.g. \"{correspondent}/{year}\"")
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "add a tag by name to every document (repeatable)")
+	cmd.Flags().BoolVar(&create, "create", true, "create missing correspondents, document types and tags")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "number of concurrent uploads")
+	cmd.Flags().Float64Var(&rate, "rate", 0, "maximum uploads per second (0: unlimited)")
+	cmd.Flags().StringVar(&statePath, "state", "", "state file recording the progress (default: the state store with the bbolt or sqlite state_backend, else one file per directory in the user cache directory)")
+	cmd.Flags().StringVar(&reportPath, "report", "migrate-report.csv", "CSV file the results are written to")
+	cmd.Flags().BoolVar(&skipDuplicates, "skip-duplicates", true, "skip files whose content is already in Paperless")
+	return cmd
+}
+
+// writeMigrationPlan lists the metadata derived for the files not migrated
+// yet and the entities they name, without contacting Paperless.
+func writeMigrationPlan(out io.Writer, l migrate.Layout, journal *backfill.Journal, files []backfill.File, tags []string) error {
+	names := map[string]map[string]bool{"correspondents": {}, "document types": {}, "storage paths": {}, "tags": {}}
+	var todo int
+	for _, f := range files {
+		if _, done := journal.Done(f); done {
+			continue
+		}
+		todo++
+		md := l.Derive(f.Rel)
+		md.Tags = mergeNames(tags, md.Tags)
+		fmt.Fprintf(out, "\n%s\n", f.Rel)
+		for _, field := range []struct{ label, value, kind string }{
+			{"Correspondent", md.Correspondent, "correspondents"},
+			{"Document type", md.DocumentType, "document types"},
+			{"Storage path", md.StoragePath, "storage paths"},
+			{"Created", md.Created, ""},
+			{"Tags", strings.Join(md.Tags, ", "), ""},
+		} {
+			if field.value == "" {
+				continue
+			}
+			writeField(out, field.label, field.value)
+			if field.kind != "" {
+				names[field.kind][field.value] = true
+			}
+		}
+		for _, tag := range md.Tags {
+			names["tags"][tag] = true
+		}
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "[dry-run] Would upload up to %d of %d files\n", todo, len(files))
+	for _, kind := range []string{"correspondents", "document types", "storage paths", "tags"} {
+		if len(names[kind]) == 0 {
+			continue
+		}
+		var list []string
+		for name := range names[kind] {
+			list = append(list, name)
+		}
+		sort.Strings(list)
+		fmt.Fprintf(out, "[dry-run] Uses %d %s: %s\n", len(list), kind, strings.Join(list, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/spf13/cobra"
+)
+
+func newPurgeCmd(opts *globalOptions) *cobra.Command {
+	var olderThan string
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Delete old files from the processed and failed folders",
+		Long: `Delete files from processed_folder and failed_folder that are older than the
+configured retention, so the local copies of originals don't grow unbounded:
+
+  retention:
+    processed: "90d"
+    failed: "30d"
+
+--older-than overrides the retention for both folders. Ages accept the units
+d (days) and w (weeks) in addition to Go durations such as 36h. Folders
+without a retention are left alone. Use --dry-run to see what would be
+deleted.`,
+		Example: `  paperless-uploader purge --older-than 90d --dry-run`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			targets := []struct {
+				name, dir, age string
+			}{
+				{"processed", cfg.ProcessedFolder, cfg.Retention.Processed},
+				{"failed", cfg.FailedFolder, cfg.Retention.Failed},
+			}
+			out := cmd.OutOrStdout()
+			var purged int
+			for _, target := range targets {
+				age := target.age
+				if olderThan != "" {
+					age = olderThan
+				}
+				if target.dir == "" || age == "" {
+					continue
+				}
+				maxAge, err := config.ParseAge(age)
+				if err != nil {
+					return err
+				}
+				if _, err := os.Stat(target.dir); os.IsNotExist(err) {
+					continue
+				}
+				n, err := purgeFolder(out, target.dir, time.Now().Add(-maxAge), opts.dryRun)
+				if err != nil {
+					return fmt.Errorf("failed to purge %s folder: %v", target.name, err)
+				}
+				purged += n
+			}
+
+			if opts.dryRun {
+				fmt.Fprintf(out, "[dry-run] Would delete %d files.\n", purged)
+			} else {
+				fmt.Fprintf(out, "Deleted %d files.\n", purged)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "delete files older than this age, e.g. 90d (default: the configured retention)")
+	return cmd
+}
+
+// purgeFolder deletes the regular files below dir modified before cutoff and
+// returns how many were (or would be) deleted. Failure records and receipts
+// are removed together with their file.
+func purgeFolder(out io.Writer, dir string, cutoff time.Time, dryRun bool) (int, error) {
+	var purged int
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || watcher.IsSidecar(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Before(cutoff) {
+			return nil
+		}
+		purged++
+		if dryRun {
+			fmt.Fprintf(out, "[dry-run] Would delete %s\n", path)
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		if err := watcher.RemoveFailedRecord(path); err != nil {
+			return err
+		}
+		if err := watcher.RemoveReceipt(path); err != nil {
+			return err
+		}
+		if err := watcher.RemoveErrorReport(path); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Deleted %s\n", path)
+		return nil
+	})
+	return purged, err
+}
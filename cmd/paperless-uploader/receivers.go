@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/fetch"
+	"github.com/c-yco/go-paperless-uploader/internal/ftpd"
+	"github.com/c-yco/go-paperless-uploader/internal/gdrive"
+	"github.com/c-yco/go-paperless-uploader/internal/grpcapi"
+	"github.com/c-yco/go-paperless-uploader/internal/rclonesource"
+	"github.com/c-yco/go-paperless-uploader/internal/removable"
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/c-yco/go-paperless-uploader/internal/screenshot"
+	"github.com/c-yco/go-paperless-uploader/internal/server"
+	"github.com/c-yco/go-paperless-uploader/internal/sftpsource"
+	"github.com/c-yco/go-paperless-uploader/internal/smtpd"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// watchedFolder returns the watch folder named by path, so that receivers
+// only deliver documents where they are uploaded from.
+func watchedFolder(folders []watcher.Folder, path string) (string, error) {
+	folder, err := findFolder(folders, path)
+	return folder.Path, err
+}
+
+// sourceFolder returns the watch folder whose settings the documents of a
+// source are uploaded with: the one named by path, or the first one if path
+// is empty.
+func sourceFolder(folders []watcher.Folder, path string) (watcher.Folder, error) {
+	if path == "" {
+		return folders[0], nil
+	}
+	return findFolder(folders, path)
+}
+
+// findFolder returns the watch folder named by path.
+func findFolder(folders []watcher.Folder, path string) (watcher.Folder, error) {
+	want, err := filepath.Abs(path)
+	if err != nil {
+		return watcher.Folder{}, err
+	}
+	for _, f := range folders {
+		if abs, err := filepath.Abs(f.Path); err == nil && abs == want {
+			return f, nil
+		}
+	}
+	return watcher.Folder{}, fmt.Errorf("%s is not a watch folder", path)
+}
+
+// newSMTPReceiver creates the SMTP receiver configured by cfg.
+func newSMTPReceiver(cfg config.SMTPReceiver, folders []watcher.Folder) (*smtpd.Server, error) {
+	maxSize, err := config.ParseSize(cfg.MaxMessageSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp_receiver.max_message_size: %v", err)
+	}
+	s := &smtpd.Server{Addr: cfg.Listen, Hostname: cfg.Hostname, MaxSize: maxSize}
+	if s.Hostname == "" {
+		if s.Hostname, err = os.Hostname(); err != nil {
+			s.Hostname = "localhost"
+		}
+	}
+	for _, r := range cfg.Routes {
+		folder, err := watchedFolder(folders, r.Folder)
+		if err != nil {
+			return nil, fmt.Errorf("invalid smtp_receiver route for %s: %v", r.Sender, err)
+		}
+		s.Routes = append(s.Routes, smtpd.Route{Sender: r.Sender, Folder: folder})
+	}
+	if !cfg.RejectUnknownSenders {
+		s.Folder = folders[0].Path
+		if cfg.Folder != "" {
+			if s.Folder, err = watchedFolder(folders, cfg.Folder); err != nil {
+				return nil, fmt.Errorf("invalid smtp_receiver.folder: %v", err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// newFTPReceiver creates the FTP receiver configured by cfg.
+func newFTPReceiver(cfg config.FTPReceiver, folders []watcher.Folder) (*ftpd.Server, error) {
+	maxSize, err := config.ParseSize(cfg.MaxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ftp_receiver.max_file_size: %v", err)
+	}
+	s := &ftpd.Server{Addr: cfg.Listen, MaxSize: maxSize, RequireTLS: cfg.RequireTLS}
+	if cfg.PassivePorts != "" {
+		first, last, ok := strings.Cut(cfg.PassivePorts, "-")
+		s.PassivePorts[0], err = strconv.Atoi(strings.TrimSpace(first))
+		if err == nil {
+			s.PassivePorts[1], err = strconv.Atoi(strings.TrimSpace(last))
+		}
+		if !ok || err != nil || s.PassivePorts[0] <= 0 || s.PassivePorts[1] > 65535 || s.PassivePorts[0] > s.PassivePorts[1] {
+			return nil, fmt.Errorf("invalid ftp_receiver.passive_ports %q: want a range such as 50000-50100", cfg.PassivePorts)
+		}
+	}
+	if cfg.PublicHost != "" {
+		addr, err := net.ResolveIPAddr("ip4", cfg.PublicHost)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ftp_receiver.public_host: %v", err)
+		}
+		s.PublicIP = addr.IP
+	}
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ftp_receiver TLS certificate: %v", err)
+		}
+		s.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	} else if cfg.RequireTLS {
+		return nil, fmt.Errorf("ftp_receiver.require_tls needs tls_cert and tls_key")
+	}
+
+	folder := folders[0].Path
+	if cfg.Folder != "" {
+		if folder, err = watchedFolder(folders, cfg.Folder); err != nil {
+			return nil, fmt.Errorf("invalid ftp_receiver.folder: %v", err)
+		}
+	}
+	if len(cfg.Users) == 0 {
+		return nil, fmt.Errorf("ftp_receiver needs at least one user")
+	}
+	for _, u := range cfg.Users {
+		if u.Username == "" || u.Password == "" {
+			return nil, fmt.Errorf("ftp_receiver users need a username and a password")
+		}
+		user := ftpd.User{Name: u.Username, Password: u.Password, Folder: folder}
+		if u.Folder != "" {
+			if user.Folder, err = watchedFolder(folders, u.Folder); err != nil {
+				return nil, fmt.Errorf("invalid ftp_receiver folder for %s: %v", u.Username, err)
+			}
+		}
+		s.Users = append(s.Users, user)
+	}
+	return s, nil
+}
+
+// newDriveSource creates the Google Drive source configured by cfg. With
+// dryRun it only logs the files it would download.
+func newDriveSource(cfg config.GoogleDrive, folders []watcher.Folder, dryRun bool) (*gdrive.Source, error) {
+	folder, err := sourceFolder(folders, cfg.Folder)
+	if err != nil {
+		return nil, fmt.Errorf("invalid google_drive.folder: %v", err)
+	}
+	source, err := gdrive.New(cfg, folder)
+	if err != nil {
+		return nil, fmt.Errorf("invalid google_drive settings: %v", err)
+	}
+	source.DryRun = dryRun
+	return source, nil
+}
+
+// newSFTPSource creates the SFTP source configured by cfg. With dryRun it
+// only logs the files it would download.
+func newSFTPSource(cfg config.SFTP, folders []watcher.Folder, dryRun bool) (*sftpsource.Source, error) {
+	folder, err := sourceFolder(folders, cfg.Folder)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sftp.folder: %v", err)
+	}
+	source, err := sftpsource.New(cfg, folder)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sftp settings: %v", err)
+	}
+	source.DryRun = dryRun
+	return source, nil
+}
+
+// newRcloneSource creates the rclone source configured by cfg, uploading
+// documents with the settings of folder. With dryRun it only logs the files
+// it would download.
+func newRcloneSource(cfg config.Rclone, folder watcher.Folder, dryRun bool) (*rclonesource.Source, error) {
+	source, err := rclonesource.New(cfg, folder)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rclone settings: %v", err)
+	}
+	source.DryRun = dryRun
+	return source, nil
+}
+
+// newUploadHandler creates the handler of POST /upload configured by cfg.
+// The metadata posted with the files is kept in received.
+func newUploadHandler(cfg config.UploadReceiver, folders []watcher.Folder, received *receivedMetadata) (http.Handler, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("upload_receiver needs a token")
+	}
+	maxSize, err := config.ParseSize(cfg.MaxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload_receiver.max_file_size: %v", err)
+	}
+	dest := folders[0].Path
+	if cfg.Folder != "" {
+		if dest, err = watchedFolder(folders, cfg.Folder); err != nil {
+			return nil, fmt.Errorf("invalid upload_receiver.folder: %v", err)
+		}
+	}
+	return server.UploadHandler(cfg.Token, maxSize, func(name string, r io.Reader, md rules.Metadata) (string, error) {
+		return received.deliver(dest, name, r, md)
+	}), nil
+}
+
+// newFetchHandler creates the handler of POST /fetch, which shares the
+// token, size limit and folder of the upload receiver configured by cfg.
+func newFetchHandler(cfg config.UploadReceiver, folders []watcher.Folder, received *receivedMetadata) (http.Handler, error) {
+	maxSize, err := config.ParseSize(cfg.MaxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload_receiver.max_file_size: %v", err)
+	}
+	dest := folders[0].Path
+	if cfg.Folder != "" {
+		if dest, err = watchedFolder(folders, cfg.Folder); err != nil {
+			return nil, fmt.Errorf("invalid upload_receiver.folder: %v", err)
+		}
+	}
+	return server.FetchHandler(cfg.Token, func(ctx context.Context, url string, header http.Header, md rules.Metadata) (string, error) {
+		return fetch.Download(ctx, nil, url, header, maxSize, func(name string, r io.Reader) (string, error) {
+			return received.deliver(dest, name, r, md)
+		})
+	}), nil
+}
+
+// newGRPCServer creates the gRPC API configured by cfg, controlling w. The
+// metadata sent with uploads is kept in received.
+func newGRPCServer(cfg config.GRPC, folders []watcher.Folder, w *watcher.Watcher, received *receivedMetadata) (*grpcapi.Server, error) {
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("grpc needs a token")
+	}
+	maxSize, err := config.ParseSize(cfg.MaxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid grpc.max_file_size: %v", err)
+	}
+	s := &grpcapi.Server{Addr: cfg.Listen, Token: cfg.Token, MaxSize: maxSize, Watcher: w}
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid grpc TLS certificate: %v", err)
+		}
+		s.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+	s.Deliver = func(folder, name string, r io.Reader, md rules.Metadata) (string, error) {
+		dest := folders[0].Path
+		if folder != "" {
+			var err error
+			if dest, err = watchedFolder(folders, folder); err != nil {
+				return "", fmt.Errorf("%s: %w", folder, grpcapi.ErrUnknownFolder)
+			}
+		}
+		return received.deliver(dest, name, r, md)
+	}
+	return s, nil
+}
+
+// newScreenshotSource creates the screenshot and clipboard source
+// configured by cfg. The configured tags are kept in received.
+func newScreenshotSource(cfg config.Screenshots, folders []watcher.Folder, received *receivedMetadata) (*screenshot.Source, error) {
+	dest := folders[0].Path
+	if cfg.Folder != "" {
+		var err error
+		if dest, err = watchedFolder(folders, cfg.Folder); err != nil {
+			return nil, fmt.Errorf("invalid screenshots.folder: %v", err)
+		}
+	}
+	s := &screenshot.Source{Clipboard: cfg.Clipboard, PollInterval: cfg.PollInterval}
+	if cfg.Watch {
+		s.Folder = cfg.ScreenshotFolder
+		if s.Folder == "" {
+			var err error
+			if s.Folder, err = screenshot.DefaultFolder(); err != nil {
+				return nil, fmt.Errorf("failed to find the screenshot folder: %v", err)
+			}
+		}
+		if _, err := watchedFolder(folders, s.Folder); err == nil {
+			return nil, fmt.Errorf("screenshots.screenshot_folder must not be a watch folder")
+		}
+	}
+	md := rules.Metadata{Tags: cfg.Tags}
+	s.Deliver = func(name string, r io.Reader) (string, error) {
+		return received.deliver(dest, name, r, md)
+	}
+	return s, nil
+}
+
+// newRemovableSource creates the removable drive importer configured by
+// cfg, tagging documents with the IDs in tagMap.
+func newRemovableSource(cfg config.RemovableDrives, tagMap map[string]int, dryRun bool) *removable.Source {
+	return &removable.Source{
+		PollInterval: cfg.PollInterval,
+		Paths:        cfg.Paths,
+		Extensions:   cfg.Extensions,
+		MarkImported: cfg.MarkImported,
+		DryRun:       dryRun,
+		Folder:       watcher.Folder{Tags: tagIDsFor(tagMap, cfg.Tags), TagNames: cfg.Tags},
+	}
+}
+
+// receivedMetadata holds the metadata posted to the upload receiver along
+// with a file until the file was uploaded.
+type receivedMetadata struct {
+	mu    sync.Mutex
+	files map[string]rules.Metadata
+}
+
+func newReceivedMetadata() *receivedMetadata {
+	return &receivedMetadata{files: make(map[string]rules.Metadata)}
+}
+
+// deliver stores a received file in dir and remembers its metadata.
+func (m *receivedMetadata) deliver(dir, name string, r io.Reader, md rules.Metadata) (string, error) {
+	// The metadata is registered right after the file appears; the watcher
+	// only asks for it once the settle delay has passed.
+	dest, err := watcher.Deliver(dir, name, r)
+	if err != nil {
+		return "", err
+	}
+	if md.Title != "" || md.Created != "" || md.Correspondent != "" || md.DocumentType != "" ||
+		md.StoragePath != "" || len(md.Tags) > 0 || md.ASN != 0 {
+		m.mu.Lock()
+		m.files[dest] = md
+		m.mu.Unlock()
+	}
+	return dest, nil
+}
+
+// attach makes the folders use the posted metadata of received files
+// instead of the metadata derived from their names.
+func (m *receivedMetadata) attach(client *paperless.Client, folders []watcher.Folder) {
+	for i := range folders {
+		derive := folders[i].Metadata
+		folders[i].Metadata = func(filePath string) (paperless.UploadOptions, error) {
+			m.mu.Lock()
+			md, ok := m.files[filePath]
+			m.mu.Unlock()
+			switch {
+			case ok:
+				return resolveMetadata(client, md)
+			case derive != nil:
+				return derive(filePath)
+			default:
+				return paperless.UploadOptions{}, nil
+			}
+		}
+	}
+}
+
+// Handle forgets the metadata of files that were uploaded or failed for
+// good. It is meant to be registered with Watcher.OnEvent.
+func (m *receivedMetadata) Handle(e watcher.Event) {
+	if e.Type == watcher.EventUploaded || e.Type == watcher.EventUploadFailed {
+		m.mu.Lock()
+		delete(m.files, e.Path)
+		m.mu.Unlock()
+	}
+}
+
+// newWebUI creates the web UI configured by cfg. Uploads are stored in its
+// folder with their metadata kept in received; failed files are retried
+// like with the retry-failed command, except in dry runs.
+func newWebUI(cfg *config.Config, folders []watcher.Folder, w *watcher.Watcher, client *paperless.Client, received *receivedMetadata, dryRun bool) (*server.WebUI, error) {
+	maxSize, err := config.ParseSize(cfg.WebUI.MaxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid web_ui.max_file_size: %v", err)
+	}
+	dest := folders[0].Path
+	if cfg.WebUI.Folder != "" {
+		if dest, err = watchedFolder(folders, cfg.WebUI.Folder); err != nil {
+			return nil, fmt.Errorf("invalid web_ui.folder: %v", err)
+		}
+	}
+	ui := &server.WebUI{
+		Username: cfg.WebUI.Username,
+		Password: cfg.WebUI.Password,
+		MaxSize:  maxSize,
+		Status:   w.Status,
+		Choices:  func() (server.Choices, error) { return webUIChoices(client) },
+		Deliver: func(name string, r io.Reader, md rules.Metadata) (string, error) {
+			return received.deliver(dest, name, r, md)
+		},
+	}
+	if cfg.FailedFolder != "" {
+		ui.Failed = func() ([]server.FailedFile, error) {
+			files, err := watcher.ListFailed(cfg.FailedFolder)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			var failed []server.FailedFile
+			for _, f := range files {
+				failed = append(failed, server.FailedFile{
+					Name:     filepath.Base(f.Path),
+					Folder:   f.Record.Folder,
+					Error:    f.Record.Error,
+					Attempts: f.Record.Attempts,
+					FailedAt: f.Record.FailedAt,
+				})
+			}
+			return failed, nil
+		}
+		ui.Retry = func(name string) error {
+			if dryRun {
+				return fmt.Errorf("not retrying %s in a dry run", name)
+			}
+			files, err := watcher.ListFailed(cfg.FailedFolder)
+			if err != nil {
+				return err
+			}
+			for _, f := range files {
+				if filepath.Base(f.Path) != name {
+					continue
+				}
+				folder := originFolder(cfg, f.Record)
+				tagIDs, err := resolveTagIDs(client, folder.TagNames)
+				if err != nil {
+					return err
+				}
+				return retryFailed(client, folder, f, tagIDs)
+			}
+			return fmt.Errorf("%s: %w", name, server.ErrNotFound)
+		}
+	}
+	return ui, nil
+}
+
+// webUIChoices returns the names of the tags, correspondents and document
+// types in Paperless.
+func webUIChoices(client *paperless.Client) (server.Choices, error) {
+	choices := server.Choices{}
+	tags, err := client.GetTags()
+	if err != nil {
+		return choices, err
+	}
+	for _, t := range tags {
+		choices.Tags = append(choices.Tags, t.Name)
+	}
+	correspondents, err := client.GetCorrespondents()
+	if err != nil {
+		return choices, err
+	}
+	for _, c := range correspondents {
+		choices.Correspondents = append(choices.Correspondents, c.Name)
+	}
+	types, err := client.GetDocumentTypes()
+	if err != nil {
+		return choices, err
+	}
+	for _, t := range types {
+		choices.DocumentTypes = append(choices.DocumentTypes, t.Name)
+	}
+	return choices, nil
+}
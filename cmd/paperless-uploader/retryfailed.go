@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/c-yco/go-paperless-uploader/internal/atrest"
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/control"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/spf13/cobra"
+)
+
+func newRetryFailedCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "retry-failed",
+		Short: "Upload the files in the failed folder again",
+		Long: `Upload every file in failed_folder again, using the tags of the folder it was
+originally found in.
+
+Successfully uploaded files get the post-upload action of that folder. Files
+whose folder leaves them in place are moved to processed_folder instead, so
+they are not retried again. Files that fail again stay in the failed folder
+with an updated error. A summary is printed at the end.
+
+If control_socket is configured and a watcher is running, the running watcher
+uploads the files with its configuration.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if cfg.ControlSocket != "" && !opts.dryRun {
+				remote, err := control.NewClient(cfg.ControlSocket).RetryFailed()
+				if err == nil {
+					fmt.Fprintln(out, "The running watcher retried the failed files.")
+					return fromRetryResult(remote).report(out)
+				}
+				if !errors.Is(err, control.ErrNotRunning) {
+					return err
+				}
+			}
+			result, err := retryAllFailed(cfg, newClient(cfg), opts.dryRun, func(format string, args ...any) {
+				fmt.Fprintf(out, format+"\n", args...)
+			})
+			if err != nil || opts.dryRun {
+				return err
+			}
+			return result.report(out)
+		},
+	}
+}
+
+// retryAllFailed uploads every file in the failed folder of cfg again,
+// reporting the progress to logf.
+func retryAllFailed(cfg *config.Config, client *paperless.Client, dryRun bool, logf func(format string, args ...any)) (*uploadResult, error) {
+	if cfg.FailedFolder == "" {
+		return nil, fmt.Errorf("failed_folder is not configured")
+	}
+	files, err := watcher.ListFailed(cfg.FailedFolder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read failed folder: %v", err)
+	}
+
+	result := &uploadResult{}
+	tagCache := make(map[string][]int)
+	for _, file := range files {
+		folder := originFolder(cfg, file.Record)
+		if dryRun {
+			logf("[dry-run] Would upload %s with tags %v", file.Path, folder.TagNames)
+			continue
+		}
+
+		key := strings.Join(folder.TagNames, "\x00")
+		tagIDs, ok := tagCache[key]
+		if !ok {
+			if tagIDs, err = resolveTagIDs(client, folder.TagNames); err != nil {
+				return nil, err
+			}
+			tagCache[key] = tagIDs
+		}
+
+		logf("Uploading %s to Paperless...", file.Path)
+		if err := retryFailed(client, folder, file, tagIDs); err != nil {
+			result.fail(file.Path, err)
+			continue
+		}
+		result.Succeeded++
+	}
+	return result, nil
+}
+
+// originFolder returns the configured folder a failed file came from, falling
+// back to the global settings if the folder is no longer configured.
+func originFolder(cfg *config.Config, record watcher.FailedRecord) watcher.Folder {
+	for _, folder := range watchFolders(cfg, nil) {
+		if record.Folder != "" && filepath.Clean(folder.Path) == filepath.Clean(record.Folder) {
+			return folder
+		}
+	}
+	tags := record.TagNames
+	if len(tags) == 0 {
+		tags = cfg.Tags
+	}
+	key, _ := encryptionKey(cfg)
+	return watcher.Folder{
+		Path:             record.Folder,
+		TagNames:         tags,
+		PostUploadAction: cfg.PostUploadAction,
+		ProcessedFolder:  cfg.ProcessedFolder,
+		EncryptionKey:    key,
+	}
+}
+
+// retryFailed uploads a failed file and runs the post-upload action, or
+// records the new error. Encrypted files are uploaded from a decrypted
+// temporary copy and stay encrypted.
+func retryFailed(client *paperless.Client, folder watcher.Folder, file watcher.FailedFile, tagIDs []int) error {
+	if folder.Client != nil {
+		client = folder.Client
+	}
+	uploadPath := file.Path
+	if strings.HasSuffix(file.Path, atrest.Suffix) {
+		if len(folder.EncryptionKey) == 0 {
+			return fmt.Errorf("file is encrypted, but encryption.key_file is not configured")
+		}
+		dir, err := os.MkdirTemp("", "paperless-uploader-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		uploadPath = filepath.Join(dir, strings.TrimSuffix(filepath.Base(file.Path), atrest.Suffix))
+		if err := atrest.DecryptFile(folder.EncryptionKey, file.Path, uploadPath); err != nil {
+			return err
+		}
+	}
+	_, err := client.UploadFile(uploadPath, paperless.UploadOptions{Tags: tagIDs})
+	if err != nil {
+		record := file.Record
+		record.Error = err.Error()
+		record.Attempts++
+		if err := watcher.WriteFailedRecord(file.Path, record); err != nil {
+			return err
+		}
+		return err
+	}
+	if err := watcher.RemoveFailedRecord(file.Path); err != nil {
+		return fmt.Errorf("uploaded, but failed to remove failure record: %v", err)
+	}
+	if err := watcher.RemoveErrorReport(file.Path); err != nil {
+		return fmt.Errorf("uploaded, but failed to remove error report: %v", err)
+	}
+	if folder.PostUploadAction == "" {
+		folder.PostUploadAction = "move"
+	}
+	watcher.HandlePostUpload(folder, file.Path)
+	return nil
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/atrest"
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/tlsconfig"
+	"github.com/c-yco/go-paperless-uploader/internal/tracing"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/spf13/cobra"
+)
+
+// globalOptions holds the flags shared by all commands.
+type globalOptions struct {
+	configFile string
+	instance   string
+	container  bool
+	dryRun     bool
+	logLevel   string
+	logFormat  string
+	logOutput  string
+	syslogAddr string
+	quiet      bool
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &globalOptions{}
+
+	root := &cobra.Command{
+		Use:           "paperless-uploader",
+		Short:         "Upload documents to Paperless-ngx",
+		Long:          "Upload documents to Paperless-ngx, either one at a time or by watching folders for new files.",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := config.SetInstance(opts.instance); err != nil {
+				return err
+			}
+			config.SetContainer(opts.container)
+			if opts.container {
+				// Container logs are collected from stdout.
+				if !cmd.Flags().Changed("log-format") {
+					opts.logFormat = "json"
+				}
+				if !cmd.Flags().Changed("log-output") {
+					opts.logOutput = "stdout"
+				}
+			}
+			if err := opts.setupLogging(); err != nil {
+				return err
+			}
+			if opts.container && os.Geteuid() == 0 {
+				logging.Warnf("Running as root in container mode; run the container as an unprivileged user instead")
+			}
+			return nil
+		},
+	}
+	root.PersistentFlags().StringVar(&opts.configFile, "config", "", "path to the config file (default: search the standard locations)")
+	root.PersistentFlags().StringVar(&opts.instance, "instance", "", "name of the instance to run; it reads config-<name>.yaml and uses its own service name")
+	root.PersistentFlags().BoolVar(&opts.container, "container", false, "container mode: JSON logs on stdout, config and folders in /data and the status endpoint on :8765")
+	root.PersistentFlags().BoolVar(&opts.dryRun, "dry-run", false, "log what would be uploaded and done without contacting the server or changing files")
+	root.PersistentFlags().StringVar(&opts.logLevel, "log-level", "info", "minimum level to log: debug, info, warn or error")
+	root.PersistentFlags().StringVar(&opts.logFormat, "log-format", "text", "log record format: text or json")
+	root.PersistentFlags().StringVar(&opts.logOutput, "log-output", "stderr", "where to log: stderr, stdout, syslog or journald")
+	root.PersistentFlags().StringVar(&opts.syslogAddr, "syslog-addr", "", `syslog server for --log-output syslog, e.g. "udp://logs:514" (default: the local syslog socket)`)
+	root.PersistentFlags().BoolVarP(&opts.quiet, "quiet", "q", false, "only log errors (same as --log-level error)")
+
+	root.AddCommand(
+		newUploadCmd(opts),
+		newBackfillCmd(opts),
+		newBenchCmd(opts),
+		newMigrateCmd(opts),
+		newWatchCmd(opts),
+		newTagsCmd(opts),
+		newDocumentsCmd(opts),
+		newIndexCmd(opts),
+		newExportCmd(opts),
+		newConfigCmd(opts),
+		newHealthcheckCmd(opts),
+		newDoctorCmd(opts),
+		newStatusCmd(opts),
+		newPauseCmd(opts),
+		newResumeCmd(opts),
+		newRescanCmd(opts),
+		newFlushCmd(opts),
+		newReloadCmd(opts),
+		newRetryFailedCmd(opts),
+		newAuditCmd(opts),
+		newPurgeCmd(opts),
+		newDecryptCmd(opts),
+		newRulesCmd(opts),
+		newSimulateCmd(opts),
+		newVersionCmd(opts),
+		newCompletionCmd(),
+		newGenCmd(),
+	)
+	addServiceCmd(root, opts)
+	addIntegrateCmd(root, opts)
+
+	return root
+}
+
+// setupLogging applies the logging flags. The records of named instances
+// carry the instance name.
+func (o *globalOptions) setupLogging() error {
+	level, err := logging.ParseLevel(o.logLevel)
+	if err != nil {
+		return err
+	}
+	if o.quiet {
+		level = logging.LevelError
+	}
+	logging.SetLevel(level)
+	switch o.logOutput {
+	case "stderr":
+		err = logging.Setup(os.Stderr, o.logFormat)
+	case "stdout":
+		err = logging.Setup(os.Stdout, o.logFormat)
+	case "syslog":
+		err = logging.SetupSyslog(o.syslogAddr)
+	case "journald":
+		err = logging.SetupJournald()
+	default:
+		return fmt.Errorf("invalid log output %q: must be stderr, stdout, syslog or journald", o.logOutput)
+	}
+	if err != nil {
+		return err
+	}
+	if o.instance != "" {
+		logging.SetLogger(logging.Logger().With(logging.KeyInstance, o.instance))
+	}
+	return nil
+}
+
+// loadConfig loads the configuration selected by the global flags.
+func (o *globalOptions) loadConfig() (*config.Config, error) {
+	cfg, err := loadConfigFile(o.configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %v", err)
+	}
+	logConfig(cfg)
+	return cfg, nil
+}
+
+// configMu serializes loading the configuration, which goes through the
+// global viper instance, e.g. by a reload through the control socket.
+var configMu sync.Mutex
+
+// loadConfigFile loads the configuration at path, or the one found in the
+// search paths, and registers its secrets for redaction from all output.
+func loadConfigFile(path string) (*config.Config, error) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	cfg, err := config.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	logging.AddSecret(cfg.Secrets()...)
+	if _, err := tlsconfig.New(cfg.TLS); err != nil {
+		return nil, err
+	}
+	if _, err := parseProxy(cfg.Proxy); err != nil {
+		return nil, err
+	}
+	if _, err := uploadLimits(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.OnDuplicate != "" && !slices.Contains(watcher.DuplicatePolicies, cfg.OnDuplicate) {
+		return nil, fmt.Errorf("invalid on_duplicate %q: must be %s", cfg.OnDuplicate, strings.Join(watcher.DuplicatePolicies, ", "))
+	}
+	for _, u := range cfg.Failover.URLs {
+		if parsed, err := url.Parse(u); err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid failover URL %q", u)
+		}
+	}
+	key, err := encryptionKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	logging.AddSecret(hex.EncodeToString(key))
+	return cfg, nil
+}
+
+// encryptionKey reads the key of encryption.key_file, or returns nil if
+// files are not encrypted.
+func encryptionKey(cfg *config.Config) ([]byte, error) {
+	if cfg.Encryption.KeyFile == "" {
+		return nil, nil
+	}
+	key, err := atrest.LoadKey(cfg.Encryption.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption.key_file: %v", err)
+	}
+	return key, nil
+}
+
+// loadClient loads the configuration and creates a Paperless client for it.
+func (o *globalOptions) loadClient() (*config.Config, *paperless.Client, error) {
+	cfg, err := o.loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	client := newClient(cfg)
+	if !o.dryRun {
+		negotiate(client)
+	}
+	return cfg, client, nil
+}
+
+// negotiate detects the API version and features of the server, warning
+// about the features it lacks. Failures are logged and leave the client
+// using the server's default version.
+func negotiate(client *paperless.Client) {
+	caps, err := client.Negotiate()
+	if err != nil {
+		if paperless.IsUnavailable(err) {
+			logging.Debugf("Could not detect the Paperless API version: %v", err)
+		} else {
+			logging.Warnf("Could not detect the Paperless API version: %v", err)
+		}
+		return
+	}
+	server := strings.TrimSpace("Paperless " + caps.ServerVersion)
+	logging.Debugf("%s, API version %d", server, caps.APIVersion)
+	if !caps.StoragePaths {
+		logging.Warnf("%s has no storage paths; storage paths set by rules or flags are ignored", server)
+	}
+	if !caps.Tasks {
+		logging.Warnf("%s has no consumption tasks; consumption cannot be tracked", server)
+	}
+}
+
+// newClient creates a Paperless client for cfg. At debug level every HTTP
+// request is logged.
+func newClient(cfg *config.Config) *paperless.Client {
+	return newClientWithKey(cfg, cfg.APIKey)
+}
+
+// newClientWithKey creates a Paperless client for cfg authenticating with
+// apiKey instead of the configured one.
+func newClientWithKey(cfg *config.Config, apiKey string) *paperless.Client {
+	client := paperless.NewClient(cfg.PaperlessURL, apiKey)
+	if len(cfg.Headers) > 0 {
+		client.Header = make(http.Header)
+		for name, value := range cfg.Headers {
+			client.Header.Set(name, value)
+		}
+	}
+	if transport := paperlessTransport(cfg); transport != nil {
+		client.HTTPClient.Transport = transport
+	}
+	client.Limits, _ = uploadLimits(cfg)
+	if logging.Enabled(logging.LevelDebug) {
+		client.HTTPClient.Transport = logging.Transport(client.HTTPClient.Transport)
+	}
+	if len(cfg.Failover.URLs) > 0 {
+		client.HTTPClient.Transport = &paperless.Failover{
+			URLs:         append([]string{cfg.PaperlessURL}, cfg.Failover.URLs...),
+			Transport:    client.HTTPClient.Transport,
+			RetryPrimary: cfg.Failover.RetryPrimary,
+			OnSwitch: func(from, to string) {
+				logging.Warnf("Switched the Paperless URL from %s to %s", from, to)
+			},
+		}
+	}
+	return client
+}
+
+// uploadLimits returns the limits checked before uploads. The server's
+// rejections are learned even without configured limits.
+func uploadLimits(cfg *config.Config) (*paperless.Limits, error) {
+	limits := &paperless.Limits{}
+	if cfg.UploadLimits.MaxSize != "" {
+		size, err := config.ParseSize(cfg.UploadLimits.MaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upload_limits.max_size: %v", err)
+		}
+		limits.MaxSize = size
+	}
+	for _, t := range cfg.UploadLimits.MimeTypes {
+		if strings.EqualFold(t, "default") {
+			limits.MimeTypes = append(limits.MimeTypes, paperless.DefaultMimeTypes...)
+			continue
+		}
+		if _, err := path.Match(t, ""); err != nil || !strings.Contains(t, "/") {
+			return nil, fmt.Errorf("invalid upload_limits.mime_types entry %q", t)
+		}
+		limits.MimeTypes = append(limits.MimeTypes, t)
+	}
+	return limits, nil
+}
+
+// paperlessTransport returns the transport for the connections to Paperless
+// configured in cfg, or nil if the default one applies. The settings were
+// validated by loadConfigFile.
+func paperlessTransport(cfg *config.Config) *http.Transport {
+	tlsConfig, _ := tlsconfig.New(cfg.TLS)
+	proxy, _ := parseProxy(cfg.Proxy)
+	if tlsConfig == nil && proxy == nil {
+		return nil
+	}
+	transport := tlsconfig.Transport(tlsConfig)
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return transport
+}
+
+// parseProxy parses the proxy URL, returning nil if it is empty.
+func parseProxy(s string) (*url.URL, error) {
+	if s == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy: not a URL")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+		return u, nil
+	}
+	return nil, fmt.Errorf("invalid proxy: scheme must be http, https, socks5 or socks5h, got %q", u.Scheme)
+}
+
+// setupTracing starts the trace export configured in cfg. The returned
+// function flushes the pending spans and must be called before exiting.
+func setupTracing(ctx context.Context, cfg *config.Config) (func(), error) {
+	shutdown, err := tracing.Setup(ctx, cfg.Tracing, version)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			logging.Warnf("Failed to flush traces: %v", err)
+		}
+	}, nil
+}
+
+// logConfig logs the configuration for debugging. The API key is redacted
+// like every registered secret.
+func logConfig(cfg *config.Config) {
+	apiKeyForLogging := cfg.APIKey
+	if len(cfg.APIKey) <= 4 {
+		apiKeyForLogging = "(too short to be valid)"
+	}
+	logging.Debugf("Loaded configuration: URL=[%s], APIKey=[%s], WatchFolder=[%s], PostUploadAction=[%s], ProcessedFolder=[%s], Tags=[%v], SettleDelay=[%s]", cfg.PaperlessURL, apiKeyForLogging, cfg.WatchFolder, cfg.PostUploadAction, cfg.ProcessedFolder, cfg.Tags, cfg.SettleDelay)
+}
+
+// resolveTagIDs converts tag names to tag IDs, warning about unknown tags.
+func resolveTagIDs(client *paperless.Client, names []string) ([]int, error) {
+	tagMap, err := resolveTagMap(client, names)
+	if err != nil {
+		return nil, err
+	}
+	return tagIDsFor(tagMap, names), nil
+}
+
+// resolveTagMap maps the given tag names to tag IDs, warning about unknown
+// tags.
+func resolveTagMap(client *paperless.Client, names []string) (map[string]int, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	// Get all tags from Paperless
+	allTags, err := client.GetTags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags from Paperless: %v", err)
+	}
+
+	// Create a map of tag names to tag IDs for quick lookup
+	tagMap := make(map[string]int)
+	for _, tag := range allTags {
+		tagMap[tag.Name] = tag.ID
+	}
+
+	for _, tagName := range names {
+		if _, ok := tagMap[tagName]; !ok {
+			logging.Warnf("Tag '%s' not found in Paperless and will be ignored.", tagName)
+		}
+	}
+	return tagMap, nil
+}
+
+// tagIDsFor returns the IDs of the names found in tagMap.
+func tagIDsFor(tagMap map[string]int, names []string) []int {
+	var tagIDs []int
+	for _, name := range names {
+		if id, ok := tagMap[name]; ok {
+			tagIDs = append(tagIDs, id)
+		}
+	}
+	return tagIDs
+}
+
+// ensureTags resolves tag names to tag IDs, creating missing tags when create
+// is set. Names are never taken as IDs, so "2024" is the tag named 2024.
+func ensureTags(client *paperless.Client, names []string, create bool) ([]int, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	allTags, err := client.GetTags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags from Paperless: %v", err)
+	}
+
+	var tagIDs []int
+	for _, name := range names {
+		if tag, ok := findTagByName(allTags, name); ok {
+			tagIDs = append(tagIDs, tag.ID)
+			continue
+		}
+		if !create {
+			return nil, fmt.Errorf("tag %q not found in Paperless", name)
+		}
+		created, err := client.CreateTag(paperless.NewTag{Name: name})
+		if err != nil {
+			return nil, err
+		}
+		logging.Infof("Created tag '%s' (ID %d)", created.Name, created.ID)
+		allTags = append(allTags, *created)
+		tagIDs = append(tagIDs, created.ID)
+	}
+	return tagIDs, nil
+}
+
+// mergeIDs appends the IDs in extra that are not already in ids.
+func mergeIDs(ids, extra []int) []int {
+	for _, id := range extra {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// watchFolders maps the configured folders to watcher folders, looking up
+// their tags in tagMap. Folders with their own API key get their own client.
+func watchFolders(cfg *config.Config, tagMap map[string]int) []watcher.Folder {
+	var folders []watcher.Folder
+	clients := make(map[string]*paperless.Client)
+	// The key file was checked when loading the configuration.
+	key, _ := encryptionKey(cfg)
+	for _, f := range cfg.WatchFolders() {
+		var client *paperless.Client
+		if f.APIKey != "" && f.APIKey != cfg.APIKey {
+			if client = clients[f.APIKey]; client == nil {
+				client = newClientWithKey(cfg, f.APIKey)
+				clients[f.APIKey] = client
+			}
+		}
+		folders = append(folders, watcher.Folder{
+			Path:             f.Path,
+			SettleDelay:      f.SettleDelay,
+			Tags:             tagIDsFor(tagMap, f.Tags),
+			TagNames:         f.Tags,
+			PostUploadAction: cfg.PostUploadAction,
+			ProcessedFolder:  cfg.ProcessedFolder,
+			FailedFolder:     cfg.FailedFolder,
+			Client:           client,
+			EncryptionKey:    key,
+			OnDuplicate:      cfg.OnDuplicate,
+			DuplicatesFolder: cfg.DuplicatesFolder,
+		})
+	}
+	return folders
+}
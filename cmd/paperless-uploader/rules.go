@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/extract"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/spf13/cobra"
+)
+
+func newRulesCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rules",
+		Short: "Work with the metadata rules",
+	}
+	cmd.AddCommand(newRulesTestCmd(opts))
+	return cmd
+}
+
+func newRulesTestCmd(opts *globalOptions) *cobra.Command {
+	var (
+		folder string
+		sender string
+		remote string
+		output string
+	)
+	cmd := &cobra.Command{
+		Use:   "test <filename>...",
+		Short: "Show the metadata the rules would apply to a file",
+		Long: `Run the folder mapping, filename pattern, title template and rules against
+sample file names and print the metadata that would be applied. The files
+don't need to exist and nothing is uploaded; rules on the size or type of a
+file only match existing files.
+
+The folder is taken from the file's directory, or from --folder. Rules on the
+origin of a file match --sender and --remote. Names of correspondents,
+document types and tags are shown as configured; they are resolved when
+uploading.`,
+		Example: `  paperless-uploader rules test "scans/20240305_ACME_Power bill.pdf"`,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid output format %q: must be table or json", output)
+			}
+			cfg, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+
+			type result struct {
+				File             string         `json:"file"`
+				Folder           string         `json:"folder,omitempty"`
+				Tags             []string       `json:"tags,omitempty"`
+				PostUploadAction string         `json:"post_upload_action,omitempty"`
+				Metadata         rules.Metadata `json:"metadata"`
+			}
+			var results []result
+			for _, arg := range args {
+				dir := folder
+				if dir == "" {
+					dir = filepath.Dir(arg)
+				}
+				fc, matched := matchFolder(cfg, dir)
+				engine, err := newEngine(cfg, fc.FilenamePattern, fc.TitleTemplate)
+				if err != nil {
+					return err
+				}
+				md, err := engine.ApplyFile(rules.File{Path: arg, Folder: dir, Sender: sender, Remote: remote})
+				if err != nil {
+					return fmt.Errorf("%s: %v", arg, err)
+				}
+				r := result{File: arg, Tags: mergeNames(fc.Tags, md.Tags), PostUploadAction: cfg.PostUploadAction, Metadata: md}
+				switch md.PostUploadAction {
+				case "":
+				case "keep":
+					r.PostUploadAction = ""
+				default:
+					r.PostUploadAction = md.PostUploadAction
+				}
+				if matched {
+					r.Folder = fc.Path
+				}
+				results = append(results, r)
+			}
+
+			out := cmd.OutOrStdout()
+			if output == "json" {
+				return writeJSON(out, results)
+			}
+			for i, r := range results {
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+				folder := r.Folder
+				if folder == "" {
+					folder = "(none, using top-level settings)"
+				}
+				pattern := "no match"
+				if r.Metadata.Matched {
+					pattern = "matched"
+				}
+				writeField(out, "File", r.File)
+				writeField(out, "Folder", folder)
+				writeField(out, "Pattern", pattern)
+				writeField(out, "Rules", strings.Join(r.Metadata.Rules, ", "))
+				writeField(out, "Title", r.Metadata.Title)
+				writeField(out, "Created", r.Metadata.Created)
+				writeField(out, "Correspondent", r.Metadata.Correspondent)
+				writeField(out, "Document type", r.Metadata.DocumentType)
+				writeField(out, "Storage path", r.Metadata.StoragePath)
+				if r.Metadata.ASN > 0 {
+					writeField(out, "ASN", fmt.Sprint(r.Metadata.ASN))
+				}
+				writeField(out, "Tags", strings.Join(r.Tags, ", "))
+				writeField(out, "Post upload", watcher.DescribePostUpload(watcher.Folder{PostUploadAction: r.PostUploadAction, ProcessedFolder: cfg.ProcessedFolder}, r.File))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&folder, "folder", "", "treat the files as if they were in this watch folder")
+	cmd.Flags().StringVar(&sender, "sender", "", "treat the files as if they were mailed by this sender")
+	cmd.Flags().StringVar(&remote, "remote", "", "treat the files as if they were downloaded from this remote path")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	return cmd
+}
+
+func writeField(out io.Writer, name, value string) {
+	if value == "" {
+		value = "-"
+	}
+	fmt.Fprintf(out, "%-15s%s\n", name+":", value)
+}
+
+// matchFolder returns the configured folder for dir, or the top-level
+// settings if no folder matches.
+func matchFolder(cfg *config.Config, dir string) (config.FolderConfig, bool) {
+	for _, f := range cfg.WatchFolders() {
+		if filepath.Clean(f.Path) == filepath.Clean(dir) {
+			return f, true
+		}
+	}
+	return config.FolderConfig{
+		Tags:            cfg.Tags,
+		FilenamePattern: cfg.FilenamePattern,
+		TitleTemplate:   cfg.TitleTemplate,
+	}, false
+}
+
+// mergeNames appends the names in extra that are not already in names.
+func mergeNames(names, extra []string) []string {
+	merged := append([]string{}, names...)
+	for _, name := range extra {
+		found := false
+		for _, n := range merged {
+			if strings.EqualFold(n, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, name)
+		}
+	}
+	return merged
+}
+
+// newEngine compiles a filename pattern and title template together with
+// the configured rules.
+func newEngine(cfg *config.Config, pattern, titleTemplate string) (*rules.Engine, error) {
+	engine, err := rules.New(pattern, titleTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var compiled []rules.Rule
+	for i, r := range cfg.Rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if r.Set.PostUploadAction == "move" && cfg.ProcessedFolder == "" {
+			return nil, fmt.Errorf("rule %s: post upload action move needs processed_folder", name)
+		}
+		rule := rules.Rule{
+			Name: name,
+			When: rules.Condition{
+				Filename:      r.Match.Filename,
+				Folder:        r.Match.Folder,
+				MimeType:      r.Match.MimeType,
+				CreatedAfter:  r.Match.CreatedAfter,
+				CreatedBefore: r.Match.CreatedBefore,
+				Sender:        r.Match.Sender,
+				Remote:        r.Match.Remote,
+				Content:       r.Match.Content,
+			},
+			Then: rules.Action{
+				Title:            r.Set.Title,
+				Correspondent:    r.Set.Correspondent,
+				DocumentType:     r.Set.DocumentType,
+				StoragePath:      r.Set.StoragePath,
+				Tags:             r.Set.Tags,
+				PostUploadAction: r.Set.PostUploadAction,
+			},
+			Stop: r.Stop,
+		}
+		if r.Match.MinSize != "" {
+			if rule.When.MinSize, err = config.ParseSize(r.Match.MinSize); err != nil {
+				return nil, fmt.Errorf("rule %s: invalid min_size: %v", name, err)
+			}
+		}
+		if r.Match.MaxSize != "" {
+			if rule.When.MaxSize, err = config.ParseSize(r.Match.MaxSize); err != nil {
+				return nil, fmt.Errorf("rule %s: invalid max_size: %v", name, err)
+			}
+		}
+		compiled = append(compiled, rule)
+	}
+	if err := engine.AddRules(compiled); err != nil {
+		return nil, err
+	}
+	if engine.MatchesContent() {
+		x, err := newExtractor(cfg.ContentExtraction)
+		if err != nil {
+			return nil, err
+		}
+		engine.ExtractText(x.Text)
+	}
+	return engine, nil
+}
+
+// newExtractor creates the text extractor configured by cfg.
+func newExtractor(cfg config.ContentExtraction) (*extract.Extractor, error) {
+	x := &extract.Extractor{
+		PDFCommand:        cfg.PDFCommand,
+		ScannedPDFCommand: cfg.ScannedPDFCommand,
+		ImageCommand:      cfg.ImageCommand,
+		Timeout:           cfg.Timeout,
+	}
+	if cfg.MaxSize != "" {
+		var err error
+		if x.MaxSize, err = config.ParseSize(cfg.MaxSize); err != nil {
+			return nil, fmt.Errorf("invalid content_extraction.max_size: %v", err)
+		}
+	}
+	return x, nil
+}
+
+// attachRules sets the metadata function of every folder that has a
+// filename pattern or title template, or of all folders if rules are
+// configured. origins tells the rules where files came from.
+func attachRules(client *paperless.Client, cfg *config.Config, folders []watcher.Folder, origins *fileOrigins) error {
+	for i, f := range cfg.WatchFolders() {
+		engine, err := newEngine(cfg, f.FilenamePattern, f.TitleTemplate)
+		if err != nil {
+			return fmt.Errorf("folder %s: %v", f.Path, err)
+		}
+		if !engine.Empty() {
+			attachEngine(&folders[i], engine, client, origins, true)
+		}
+	}
+	return nil
+}
+
+// attachEngine makes folder derive the metadata of its files with engine.
+// With postUpload, rules also choose the post-upload action.
+func attachEngine(folder *watcher.Folder, engine *rules.Engine, client *paperless.Client, origins *fileOrigins, postUpload bool) {
+	apply := func(filePath string) (rules.Metadata, error) {
+		f := origins.file(filePath)
+		f.Folder = folder.Path
+		return engine.ApplyFile(f)
+	}
+	folder.Metadata = func(filePath string) (paperless.UploadOptions, error) {
+		md, err := apply(filePath)
+		if err != nil {
+			return paperless.UploadOptions{}, err
+		}
+		if folder.Client != nil {
+			return resolveMetadata(folder.Client, md)
+		}
+		return resolveMetadata(client, md)
+	}
+	if postUpload && engine.SetsPostUploadAction() {
+		folder.PostUploadActionFor = func(filePath string) (string, bool) {
+			md, err := apply(filePath)
+			if err != nil || md.PostUploadAction == "" {
+				return "", false
+			}
+			if md.PostUploadAction == "keep" {
+				return "", true
+			}
+			return md.PostUploadAction, true
+		}
+	}
+}
+
+// fileOrigins tells where received and downloaded files came from, for the
+// sender and remote conditions of rules.
+type fileOrigins struct {
+	mu      sync.Mutex
+	senders map[string]string
+	remotes []func(local string) (string, bool)
+}
+
+func newFileOrigins() *fileOrigins {
+	return &fileOrigins{senders: make(map[string]string)}
+}
+
+// delivered records the sender of a file received by mail.
+func (o *fileOrigins) delivered(path, sender string) {
+	o.mu.Lock()
+	o.senders[path] = sender
+	o.mu.Unlock()
+}
+
+// addRemote adds a source of downloaded files, such as SFTP or rclone.
+func (o *fileOrigins) addRemote(lookup func(local string) (string, bool)) {
+	o.mu.Lock()
+	o.remotes = append(o.remotes, lookup)
+	o.mu.Unlock()
+}
+
+// file describes the file at path with its origin.
+func (o *fileOrigins) file(path string) rules.File {
+	f := rules.File{Path: path}
+	if o == nil {
+		return f
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	f.Sender = o.senders[path]
+	for _, lookup := range o.remotes {
+		if remote, ok := lookup(path); ok {
+			f.Remote = remote
+			break
+		}
+	}
+	return f
+}
+
+// Handle forgets the senders of files that were uploaded or failed for
+// good. It is meant to be registered with Watcher.OnEvent.
+func (o *fileOrigins) Handle(e watcher.Event) {
+	if e.Type == watcher.EventUploaded || e.Type == watcher.EventUploadFailed {
+		o.mu.Lock()
+		delete(o.senders, e.Path)
+		o.mu.Unlock()
+	}
+}
+
+// resolveMetadata converts derived metadata to upload options. Unknown
+// names are skipped with a warning.
+func resolveMetadata(client *paperless.Client, md rules.Metadata) (paperless.UploadOptions, error) {
+	opts := paperless.UploadOptions{Title: md.Title, Created: md.Created}
+	if md.ASN > 0 {
+		asn := md.ASN
+		opts.ArchiveSerialNumber = &asn
+	}
+	var err error
+	if opts.Tags, err = resolveTagIDs(client, md.Tags); err != nil {
+		return opts, err
+	}
+	lookups := []struct {
+		name   string
+		lookup func(*paperless.Client, string) (*int, error)
+		dest   **int
+	}{
+		{md.Correspondent, lookupCorrespondent, &opts.Correspondent},
+		{md.DocumentType, lookupDocumentType, &opts.DocumentType},
+		{md.StoragePath, lookupStoragePath, &opts.StoragePath},
+	}
+	for _, l := range lookups {
+		id, err := l.lookup(client, l.name)
+		if err != nil {
+			logging.Warnf("%v; ignoring it", err)
+			continue
+		}
+		*l.dest = id
+	}
+	return opts, nil
+}
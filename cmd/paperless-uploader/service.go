@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+)
+
+// serviceConfigPath returns the absolute path of the config file a service
+// should use: the --config file if given, otherwise the one found in the
+// search paths. It is empty if there is none.
+func serviceConfigPath(opts *globalOptions) (string, error) {
+	if opts.configFile == "" {
+		return config.Find(), nil
+	}
+	path, err := filepath.Abs(opts.configFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve config path: %v", err)
+	}
+	return path, nil
+}
+
+// wrapServiceErr prefixes err with the service verb that failed.
+func wrapServiceErr(verb string, err error) error {
+	if err != nil {
+		return fmt.Errorf("failed to %s service: %v", verb, err)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+//go:build darwin
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// launchdLabel returns the label of the launchd job of the selected
+// instance.
+func launchdLabel() string {
+	return "com.github.c-yco." + config.Namespaced("paperless-uploader")
+}
+
+// launchctl runs launchctl; replaced in tests.
+var launchctl = func(args ...string) error {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// domain returns the launchd domain of the job: the GUI session of the
+// current user for agents, the system domain for daemons.
+func (s *serviceScope) domain() string {
+	if s.isUser() {
+		return fmt.Sprintf("gui/%d", os.Getuid())
+	}
+	return "system"
+}
+
+// target returns the launchd service target of the job.
+func (s *serviceScope) target() string {
+	return s.domain() + "/" + launchdLabel()
+}
+
+// plistPath returns where the job's property list is installed.
+func (s *serviceScope) plistPath() (string, error) {
+	if !s.isUser() {
+		return filepath.Join("/Library/LaunchDaemons", launchdLabel()+".plist"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", launchdLabel()+".plist"), nil
+}
+
+// logDir returns the directory the job's output is written to.
+func (s *serviceScope) logDir() (string, error) {
+	if !s.isUser() {
+		return "/Library/Logs/paperless-uploader", nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "Logs", "paperless-uploader"), nil
+}
+
+// addServiceCmd registers the launchd service management commands.
+func addServiceCmd(root *cobra.Command, opts *globalOptions) {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "Manage the launchd service",
+	}
+
+	var (
+		scope serviceScope
+		runAs string
+	)
+	install := &cobra.Command{
+		Use:   "install",
+		Short: "Install and load a launchd job running 'watch'",
+		Long: `Write a launchd property list running 'watch' with the current config file and
+load it. The job starts at load, is restarted when it exits unexpectedly and
+writes its output to paperless-uploader.log in the Logs folder.
+
+With --system (the default for root) a LaunchDaemon is installed in
+/Library/LaunchDaemons and runs as --run-as; with --user a LaunchAgent is
+installed in ~/Library/LaunchAgents for the current user.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath, err := serviceConfigPath(opts)
+			if err != nil {
+				return err
+			}
+			exe, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			logDir, err := scope.logDir()
+			if err != nil {
+				return err
+			}
+			job := plistOptions{
+				Label:   launchdLabel(),
+				Args:    []string{exe, "watch"},
+				LogPath: filepath.Join(logDir, config.Namespaced("paperless-uploader")+".log"),
+			}
+			if !scope.isUser() {
+				if job.RunAs = runAs; job.RunAs == "" {
+					job.RunAs = defaultRunAs()
+				}
+			}
+			if configPath == "" {
+				logging.Warnf("No config file found; the service will search %v", config.SearchPaths())
+			} else {
+				logging.Infof("Service will use config file %s", configPath)
+				job.Args = append(job.Args, "--config", configPath)
+				job.WorkingDirectory = filepath.Dir(configPath)
+			}
+			if name := config.Instance(); name != "" {
+				job.Args = append(job.Args, "--instance", name)
+			}
+			return wrapServiceErr("install", installPlist(&scope, job))
+		},
+	}
+	scope.register(install)
+	install.Flags().StringVar(&runAs, "run-as", "", "user the LaunchDaemon runs as (default: the invoking sudo user)")
+
+	cmd.AddCommand(
+		install,
+		launchdVerb("remove", "Unload and remove the service", func(scope *serviceScope) error {
+			path, err := scope.plistPath()
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(path); err != nil {
+				return fmt.Errorf("service is not installed: %s not found", path)
+			}
+			if err := launchctl("bootout", scope.domain(), path); err != nil {
+				logging.Warnf("Failed to unload service: %v", err)
+			}
+			return os.Remove(path)
+		}),
+		launchdVerb("start", "Start the service", func(scope *serviceScope) error {
+			return launchctl("kickstart", scope.target())
+		}),
+		launchdVerb("stop", "Stop the service", func(scope *serviceScope) error {
+			return launchctl("kill", "SIGTERM", scope.target())
+		}),
+	)
+	root.AddCommand(cmd)
+}
+
+func launchdVerb(name, short string, fn func(scope *serviceScope) error) *cobra.Command {
+	var scope serviceScope
+	cmd := &cobra.Command{
+		Use:   name,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return wrapServiceErr(name, fn(&scope))
+		},
+	}
+	scope.register(cmd)
+	return cmd
+}
+
+// installPlist writes the property list and loads the job, replacing a job
+// that is already loaded.
+func installPlist(scope *serviceScope, job plistOptions) error {
+	path, err := scope.plistPath()
+	if err != nil {
+		return err
+	}
+	content, err := renderPlist(job)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(job.LogPath), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return err
+	}
+	logging.Infof("Wrote %s", path)
+	// Unloading fails if the job is not loaded, which is expected on a
+	// first install.
+	_ = launchctl("bootout", scope.domain(), path)
+	return launchctl("bootstrap", scope.domain(), path)
+}
+
+// plistOptions are the values of the generated property list.
+type plistOptions struct {
+	Label            string
+	Args             []string
+	WorkingDirectory string
+	LogPath          string
+	// RunAs is the account a LaunchDaemon runs as; empty for agents.
+	RunAs string
+}
+
+var plistTemplate = template.Must(template.New("plist").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{xml .Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+{{- range .Args}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+{{- if .WorkingDirectory}}
+	<key>WorkingDirectory</key>
+	<string>{{xml .WorkingDirectory}}</string>
+{{- end}}
+{{- if .RunAs}}
+	<key>UserName</key>
+	<string>{{xml .RunAs}}</string>
+{{- end}}
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ThrottleInterval</key>
+	<integer>10</integer>
+	<key>ProcessType</key>
+	<string>Background</string>
+	<key>StandardOutPath</key>
+	<string>{{xml .LogPath}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{xml .LogPath}}</string>
+</dict>
+</plist>
+`))
+
+// renderPlist returns the property list for job.
+func renderPlist(job plistOptions) (string, error) {
+	var b strings.Builder
+	if err := plistTemplate.Execute(&b, job); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// xmlEscape escapes s for use in XML character data.
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,29 @@
+//go:build darwin
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPlist(t *testing.T) {
+	plist, err := renderPlist(plistOptions{
+		Label:            launchdLabel(),
+		Args:             []string{"/usr/local/bin/paperless-uploader", "watch", "--config", "/Users/me/Scans & Mail/config.yaml"},
+		WorkingDirectory: "/Users/me/Scans & Mail",
+		LogPath:          "/Library/Logs/paperless-uploader/paperless-uploader.log",
+		RunAs:            "me",
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, plist, "<string>/Users/me/Scans &amp; Mail/config.yaml</string>")
+	assert.Contains(t, plist, "<key>UserName</key>\n\t<string>me</string>")
+	assert.Contains(t, plist, "<key>KeepAlive</key>\n\t<dict>\n\t\t<key>SuccessfulExit</key>\n\t\t<false/>")
+	assert.Contains(t, plist, "<key>StandardErrorPath</key>\n\t<string>/Library/Logs/paperless-uploader/paperless-uploader.log</string>")
+
+	agent, err := renderPlist(plistOptions{Label: launchdLabel(), Args: []string{"paperless-uploader", "watch"}})
+	assert.NoError(t, err)
+	assert.NotContains(t, agent, "UserName")
+	assert.NotContains(t, agent, "WorkingDirectory")
+}
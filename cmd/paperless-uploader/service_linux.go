@@ -0,0 +1,315 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// unitName returns the name of the systemd unit of the selected instance.
+func unitName() string {
+	return config.Namespaced("paperless-uploader") + ".service"
+}
+
+// systemctl runs systemctl, for the user's service manager if user is set;
+// replaced in tests.
+var systemctl = func(user bool, args ...string) error {
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// unitPath returns where the unit file is installed.
+func (s *serviceScope) unitPath() (string, error) {
+	if !s.isUser() {
+		return filepath.Join("/etc/systemd/system", unitName()), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "systemd", "user", unitName()), nil
+}
+
+// addServiceCmd registers the systemd service management commands.
+func addServiceCmd(root *cobra.Command, opts *globalOptions) {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "Manage the systemd service",
+	}
+
+	var (
+		scope serviceScope
+		runAs string
+		start bool
+	)
+	install := &cobra.Command{
+		Use:   "install",
+		Short: "Install and enable a hardened systemd unit running 'watch'",
+		Long: `Write a systemd unit running 'watch' with the current config file, then enable
+it. The unit uses Type=notify with a watchdog and sandboxing options; the
+watched, processed and failed folders and the audit log directory stay
+writable.
+
+With --system (the default for root) the unit is installed in
+/etc/systemd/system and runs as --run-as; with --user it is installed for the
+current user.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath, err := serviceConfigPath(opts)
+			if err != nil {
+				return err
+			}
+			exe, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			unit := unitOptions{Executable: exe, ConfigPath: configPath, Instance: config.Instance(), User: scope.isUser()}
+			if !unit.User {
+				if unit.RunAs = runAs; unit.RunAs == "" {
+					unit.RunAs = defaultRunAs()
+				}
+			}
+			if configPath == "" {
+				logging.Warnf("No config file found; the service will search %v", config.SearchPaths())
+			} else {
+				logging.Infof("Service will use config file %s", configPath)
+				unit.WorkingDirectory = filepath.Dir(configPath)
+				cfg, err := loadConfigFile(configPath)
+				if err != nil {
+					return fmt.Errorf("failed to load configuration: %v", err)
+				}
+				unit.WritablePaths = writablePaths(cfg, unit.WorkingDirectory)
+				if cfg.ControlSocket != "" {
+					unit.Reload = true
+					unit.RuntimeDirectory = runtimeDirectory(cfg.ControlSocket)
+				}
+			}
+			return wrapServiceErr("install", installUnit(&scope, unit, start))
+		},
+	}
+	scope.register(install)
+	install.Flags().StringVar(&runAs, "run-as", "", "user the system service runs as (default: the invoking sudo user)")
+	install.Flags().BoolVar(&start, "now", false, "also start the service")
+
+	cmd.AddCommand(
+		install,
+		unitVerb("remove", "Stop, disable and remove the service", func(scope *serviceScope) error {
+			path, err := scope.unitPath()
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(path); err != nil {
+				return fmt.Errorf("service is not installed: %s not found", path)
+			}
+			if err := systemctl(scope.isUser(), "disable", "--now", unitName()); err != nil {
+				return err
+			}
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			return systemctl(scope.isUser(), "daemon-reload")
+		}),
+		unitVerb("start", "Start the service", func(scope *serviceScope) error {
+			return systemctl(scope.isUser(), "start", unitName())
+		}),
+		unitVerb("stop", "Stop the service", func(scope *serviceScope) error {
+			return systemctl(scope.isUser(), "stop", unitName())
+		}),
+	)
+	root.AddCommand(cmd)
+}
+
+func unitVerb(name, short string, fn func(scope *serviceScope) error) *cobra.Command {
+	var scope serviceScope
+	cmd := &cobra.Command{
+		Use:   name,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return wrapServiceErr(name, fn(&scope))
+		},
+	}
+	scope.register(cmd)
+	return cmd
+}
+
+// installUnit writes the unit file, reloads systemd and enables the unit.
+func installUnit(scope *serviceScope, unit unitOptions, start bool) error {
+	path, err := scope.unitPath()
+	if err != nil {
+		return err
+	}
+	content, err := renderUnit(unit)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return err
+	}
+	logging.Infof("Wrote %s", path)
+	if err := systemctl(unit.User, "daemon-reload"); err != nil {
+		return err
+	}
+	args := []string{"enable", unitName()}
+	if start {
+		args = []string{"enable", "--now", unitName()}
+	}
+	return systemctl(unit.User, args...)
+}
+
+// writablePaths returns the directories the service writes to, resolved
+// against dir.
+func writablePaths(cfg *config.Config, dir string) []string {
+	seen := map[string]bool{}
+	add := func(path string) {
+		if path == "" {
+			return
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		seen[filepath.Clean(path)] = true
+	}
+	for _, f := range cfg.WatchFolders() {
+		add(f.Path)
+	}
+	if cfg.PostUploadAction == "move" {
+		add(cfg.ProcessedFolder)
+	}
+	add(cfg.FailedFolder)
+	add(cfg.ConsumeFallback.Dir)
+	add(cfg.Rclone.DownloadDir)
+	if cfg.AuditLog != "" {
+		add(filepath.Dir(cfg.AuditLog))
+	}
+	if cfg.ControlSocket != "" {
+		add(filepath.Dir(cfg.ControlSocket))
+	}
+	if cfg.DocumentIndex.Path != "" {
+		add(filepath.Dir(cfg.DocumentIndex.Path))
+	}
+	var paths []string
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// unitOptions are the values of the generated unit file.
+type unitOptions struct {
+	Executable       string
+	ConfigPath       string
+	Instance         string
+	WorkingDirectory string
+	// User installs a user unit; RunAs is the account of a system unit.
+	User          bool
+	RunAs         string
+	WritablePaths []string
+	// Reload adds an ExecReload through the control socket.
+	Reload bool
+	// RuntimeDirectory is the directory below /run systemd creates for the
+	// control socket.
+	RuntimeDirectory string
+}
+
+// runtimeDirectory returns the directory of socket relative to /run, or ""
+// if it is elsewhere.
+func runtimeDirectory(socket string) string {
+	dir, ok := strings.CutPrefix(filepath.Dir(filepath.Clean(socket)), "/run/")
+	if !ok || strings.HasPrefix(dir, "user/") {
+		return ""
+	}
+	return dir
+}
+
+var unitTemplate = template.Must(template.New("unit").Funcs(template.FuncMap{"quote": systemdQuote}).Parse(`[Unit]
+Description=Paperless Uploader{{if .Instance}} ({{.Instance}}){{end}}
+Documentation=https://github.com/c-yco/go-paperless-uploader
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+ExecStart={{quote .Executable}} watch{{if .ConfigPath}} --config {{quote .ConfigPath}}{{end}}{{if .Instance}} --instance {{.Instance}}{{end}}
+{{- if .Reload}}
+ExecReload={{quote .Executable}} reload{{if .ConfigPath}} --config {{quote .ConfigPath}}{{end}}{{if .Instance}} --instance {{.Instance}}{{end}}
+{{- end}}
+{{- if .RuntimeDirectory}}
+RuntimeDirectory={{quote .RuntimeDirectory}}
+{{- end}}
+{{- if .WorkingDirectory}}
+WorkingDirectory={{quote .WorkingDirectory}}
+{{- end}}
+Restart=on-failure
+RestartSec=10s
+WatchdogSec=60s
+TimeoutStopSec=30s
+{{- if not .User}}
+User={{.RunAs}}
+
+# Sandboxing
+NoNewPrivileges=yes
+ProtectSystem=strict
+{{- range .WritablePaths}}
+ReadWritePaths=-{{quote .}}
+{{- end}}
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+ProtectClock=yes
+ProtectHostname=yes
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+RestrictNamespaces=yes
+RestrictRealtime=yes
+RestrictSUIDSGID=yes
+LockPersonality=yes
+MemoryDenyWriteExecute=yes
+SystemCallArchitectures=native
+CapabilityBoundingSet=
+{{- else}}
+NoNewPrivileges=yes
+{{- end}}
+
+[Install]
+WantedBy={{if .User}}default.target{{else}}multi-user.target{{end}}
+`))
+
+// renderUnit returns the unit file for unit.
+func renderUnit(unit unitOptions) (string, error) {
+	var b strings.Builder
+	if err := unitTemplate.Execute(&b, unit); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// systemdQuote quotes s for a unit file if it contains spaces or quotes.
+func systemdQuote(s string) string {
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceInstallLinux(t *testing.T) {
+	dir, cleanup := setupTest(t)
+	defer cleanup()
+
+	var calls []string
+	oldSystemctl := systemctl
+	systemctl = func(user bool, args ...string) error {
+		if user {
+			args = append([]string{"--user"}, args...)
+		}
+		calls = append(calls, strings.Join(args, " "))
+		return nil
+	}
+	defer func() { systemctl = oldSystemctl }()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "xdg"))
+
+	assert.NoError(t, os.WriteFile("config.yaml", []byte("watch_folder: consume\npost_upload_action: move\nprocessed_folder: /srv/done\nfailed_folder: failed\n"), 0644))
+	assert.NoError(t, runApp(context.Background(), []string{"service", "install", "--user", "--now", "--config", "config.yaml"}))
+	assert.Equal(t, []string{"--user daemon-reload", "--user enable --now paperless-uploader.service"}, calls)
+
+	unitPath := filepath.Join(dir, "xdg", "systemd", "user", "paperless-uploader.service")
+	unit, err := os.ReadFile(unitPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(unit), "Type=notify\n")
+	assert.Contains(t, string(unit), " watch --config "+filepath.Join(dir, "config.yaml")+"\n")
+	assert.Contains(t, string(unit), "WantedBy=default.target\n")
+	assert.NotContains(t, string(unit), "User=")
+
+	calls = nil
+	assert.NoError(t, runApp(context.Background(), []string{"service", "remove", "--user"}))
+	assert.Equal(t, []string{"--user disable --now paperless-uploader.service", "--user daemon-reload"}, calls)
+	assert.NoFileExists(t, unitPath)
+
+	err = runApp(context.Background(), []string{"service", "remove", "--user"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "service is not installed")
+
+	// Named instances get their own unit.
+	defer config.SetInstance("")
+	assert.NoError(t, os.WriteFile("config-scanner.yaml", []byte("watch_folder: scanner\n"), 0644))
+	calls = nil
+	assert.NoError(t, runApp(context.Background(), []string{"service", "install", "--user", "--instance", "scanner"}))
+	assert.Equal(t, []string{"--user daemon-reload", "--user enable paperless-uploader-scanner.service"}, calls)
+	unit, err = os.ReadFile(filepath.Join(dir, "xdg", "systemd", "user", "paperless-uploader-scanner.service"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(unit), " watch --config "+filepath.Join(dir, "config-scanner.yaml")+" --instance scanner\n")
+}
+
+func TestRenderSystemUnit(t *testing.T) {
+	unit, err := renderUnit(unitOptions{
+		Executable:       "/usr/local/bin/paperless-uploader",
+		ConfigPath:       "/etc/paperless uploader/config.yaml",
+		WorkingDirectory: "/etc/paperless uploader",
+		RunAs:            "paperless",
+		WritablePaths:    []string{"/srv/consume", "/srv/failed"},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, unit, `ExecStart=/usr/local/bin/paperless-uploader watch --config "/etc/paperless uploader/config.yaml"`+"\n")
+	assert.Contains(t, unit, "User=paperless\n")
+	assert.Contains(t, unit, "ProtectSystem=strict\nReadWritePaths=-/srv/consume\nReadWritePaths=-/srv/failed\n")
+	assert.Contains(t, unit, "WantedBy=multi-user.target\n")
+
+	assert.NotContains(t, unit, "ExecReload=")
+
+	unit, err = renderUnit(unitOptions{Executable: "/usr/bin/paperless-uploader", Instance: "scanner", User: true, Reload: true})
+	assert.NoError(t, err)
+	assert.Contains(t, unit, "Description=Paperless Uploader (scanner)\n")
+	assert.Contains(t, unit, "ExecStart=/usr/bin/paperless-uploader watch --instance scanner\n")
+	assert.Contains(t, unit, "ExecReload=/usr/bin/paperless-uploader reload --instance scanner\n")
+}
+
+func TestRuntimeDirectory(t *testing.T) {
+	assert.Equal(t, "paperless-uploader", runtimeDirectory("/run/paperless-uploader/control.sock"))
+	assert.Equal(t, "", runtimeDirectory("/run/user/1000/control.sock"))
+	assert.Equal(t, "", runtimeDirectory("/var/lib/paperless-uploader/control.sock"))
+}
@@ -0,0 +1,9 @@
+//go:build !windows && !linux && !darwin
+
+package main
+
+import "github.com/spf13/cobra"
+
+// addServiceCmd registers the service management commands. Service
+// management is only available on Windows, Linux and macOS.
+func addServiceCmd(root *cobra.Command, opts *globalOptions) {}
@@ -0,0 +1,40 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"os/user"
+
+	"github.com/spf13/cobra"
+)
+
+// serviceScope selects the system or the user service manager.
+type serviceScope struct {
+	user, system bool
+}
+
+func (s *serviceScope) register(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&s.user, "user", false, "use the service manager of the current user (default when not root)")
+	cmd.Flags().BoolVar(&s.system, "system", false, "use the system service manager (default when root)")
+	cmd.MarkFlagsMutuallyExclusive("user", "system")
+}
+
+// isUser reports whether the user service manager is selected.
+func (s *serviceScope) isUser() bool {
+	if s.user || s.system {
+		return s.user
+	}
+	return os.Geteuid() != 0
+}
+
+// defaultRunAs returns the user who invoked sudo, or the current user.
+func defaultRunAs() string {
+	if name := os.Getenv("SUDO_USER"); name != "" {
+		return name
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "root"
+}
@@ -0,0 +1,188 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// recoveryActions are the restarts the service manager attempts after the
+// first, second and any further failure.
+var recoveryActions = []mgr.RecoveryAction{
+	{Type: mgr.ServiceRestart, Delay: 10 * time.Second},
+	{Type: mgr.ServiceRestart, Delay: time.Minute},
+	{Type: mgr.ServiceRestart, Delay: 5 * time.Minute},
+}
+
+// recoveryResetPeriod is how long the service must run without failing
+// before the failure count is reset.
+const recoveryResetPeriod = 24 * time.Hour
+
+// addServiceCmd registers the Windows service management commands.
+func addServiceCmd(root *cobra.Command, opts *globalOptions) {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "Manage the Windows service",
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "install",
+			Short: "Install the service, recording the config file in its arguments",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				configPath, err := serviceConfigPath(opts)
+				if err != nil {
+					return err
+				}
+				return wrapServiceErr("install", installService(configPath))
+			},
+		},
+		serviceVerb("remove", "Remove the service", removeService),
+		serviceVerb("start", "Start the service", startService),
+		serviceVerb("stop", "Stop the service", func() error { return controlService(svc.Stop, svc.Stopped) }),
+		serviceVerb("pause", "Pause the service", func() error { return controlService(svc.Pause, svc.Paused) }),
+		serviceVerb("continue", "Continue the paused service", func() error { return controlService(svc.Continue, svc.Running) }),
+		&cobra.Command{
+			Use:   "debug",
+			Short: "Run the service in the foreground for debugging",
+			Args:  cobra.NoArgs,
+			Run: func(cmd *cobra.Command, args []string) {
+				runService(true)
+			},
+		},
+	)
+	root.AddCommand(cmd)
+}
+
+func serviceVerb(name, short string, fn func() error) *cobra.Command {
+	return &cobra.Command{
+		Use:   name,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return wrapServiceErr(name, fn())
+		},
+	}
+}
+
+func getServiceManager() (*mgr.Mgr, error) {
+	return mgr.Connect()
+}
+
+// installService registers the service. When configPath is not empty it is
+// recorded in the service arguments, so the service finds its config
+// regardless of the working directory the SCM starts it in. The service is
+// restarted by the SCM when it fails.
+func installService(configPath string) error {
+	m, err := getServiceManager()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	exepath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	args := []string{"watch"}
+	displayName := "Paperless Uploader Service"
+	if name := config.Instance(); name != "" {
+		args = append(args, "--instance", name)
+		displayName += " (" + name + ")"
+	}
+	if configPath != "" {
+		args = append(args, "--config", configPath)
+		logging.Infof("Service will use config file %s", configPath)
+	} else {
+		logging.Warnf("No config file found; the service will search %v", config.SearchPaths())
+	}
+
+	s, err := m.CreateService(serviceName(), exepath, mgr.Config{DisplayName: displayName}, args...)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// Restart the service when it crashes or stops with an error, waiting
+	// longer after repeated failures.
+	if err := s.SetRecoveryActions(recoveryActions, uint32(recoveryResetPeriod/time.Second)); err != nil {
+		return fmt.Errorf("failed to configure recovery actions: %v", err)
+	}
+	if err := s.SetRecoveryActionsOnNonCrashFailures(true); err != nil {
+		return fmt.Errorf("failed to configure recovery actions: %v", err)
+	}
+	return nil
+}
+
+func removeService() error {
+	m, err := getServiceManager()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName())
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName())
+	}
+	defer s.Close()
+
+	return s.Delete()
+}
+
+func startService() error {
+	m, err := getServiceManager()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName())
+	if err != nil {
+		return fmt.Errorf("could not access service: %v", err)
+	}
+	defer s.Close()
+
+	return s.Start()
+}
+
+func controlService(c svc.Cmd, to svc.State) error {
+	m, err := getServiceManager()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName())
+	if err != nil {
+		return fmt.Errorf("could not access service: %v", err)
+	}
+	defer s.Close()
+
+	status, err := s.Control(c)
+	if err != nil {
+		return fmt.Errorf("could not send control=%d: %v", c, err)
+	}
+
+	timeout := time.Now().Add(10 * time.Second)
+	for status.State != to {
+		if time.Now().After(timeout) {
+			return fmt.Errorf("timeout waiting for service to go to state=%d", to)
+		}
+		time.Sleep(300 * time.Millisecond)
+		status, err = s.Query()
+		if err != nil {
+			return fmt.Errorf("could not retrieve service status: %v", err)
+		}
+	}
+	return nil
+}
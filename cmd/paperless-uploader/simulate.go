@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/c-yco/go-paperless-uploader/internal/simulate"
+	"github.com/c-yco/go-paperless-uploader/internal/state"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/spf13/cobra"
+)
+
+func newSimulateCmd(opts *globalOptions) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "simulate <scenario|audit-log>",
+		Short: "Run a scenario of files through the configuration without a server",
+		Long: `Run a scenario of files through the watch folders, rules and post-upload
+actions of the configuration and print what happened to every file, without
+a Paperless server or real documents. The results do not depend on timing,
+so scenarios can check configurations in CI.
+
+A scenario is a YAML file listing the files that appear, in order:
+
+  files:
+    - path: /scans/inbox/2024-03-05_ACME_Invoice.pdf
+      size: 200KB            # or content: verbatim file content
+      text: "Invoice no. 42" # the text content rules see
+      sender: billing@acme.example
+      upload_status: 500     # every upload is rejected with this status
+      consume_error: "corrupt PDF"
+      expect:
+        status: consumed     # or e.g. upload_failed, consume_failed, duplicate
+        title: Invoice
+        correspondent: ACME
+        tags: [inbox, invoices]
+        dest: /scans/processed/2024-03-05_ACME_Invoice.pdf
+
+An audit log is replayed instead: the detected files appear in the recorded
+order, with their recorded upload rejections and consumption failures.
+
+The files are created in a temporary copy of the watch, processed and failed
+folders, one after the other once the previous file is done, and uploaded to
+an in-process fake Paperless in which every tag, correspondent, document
+type and storage path exists. Retries are not delayed. The command exits
+with a non-zero status if a result does not match its expectation.`,
+		Example: `  paperless-uploader simulate scenario.yaml
+  paperless-uploader simulate audit.jsonl -o json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid output format %q: must be table or json", output)
+			}
+			cfg, err := opts.loadConfig()
+			if err != nil {
+				return err
+			}
+			scenario, err := simulate.Load(args[0])
+			if err != nil {
+				return err
+			}
+
+			sim := &simulate.Simulator{}
+			tagMap := make(map[string]int)
+			for _, name := range cfg.TagNames() {
+				tagMap[name] = sim.TagIDs([]string{name})[0]
+			}
+			folders := watchFolders(cfg, tagMap)
+			for i, f := range cfg.WatchFolders() {
+				engine, err := newEngine(cfg, f.FilenamePattern, f.TitleTemplate)
+				if err != nil {
+					return fmt.Errorf("folder %s: %v", f.Path, err)
+				}
+				folder := simulate.Folder{Folder: folders[i]}
+				if !engine.Empty() {
+					folder.Engine = engine
+				}
+				sim.Folders = append(sim.Folders, folder)
+			}
+			var recent watcher.RecentUploads
+			if cfg.DedupWindow > 0 {
+				dir, err := os.MkdirTemp("", "paperless-uploader-simulate-state-")
+				if err != nil {
+					return err
+				}
+				defer os.RemoveAll(dir)
+				store, err := state.Open(state.BackendJSON, filepath.Join(dir, "state.json"))
+				if err != nil {
+					return err
+				}
+				defer store.Close()
+				recent = state.NewRecentUploads(store, cfg.DedupWindow)
+			}
+			sim.Setup = func(w *watcher.Watcher) {
+				w.MaxRetries = cfg.MaxRetries
+				w.Recent = recent
+			}
+
+			results, err := sim.Run(cmd.Context(), scenario)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if output == "json" {
+				if err := writeJSON(out, results); err != nil {
+					return err
+				}
+			} else {
+				for i, r := range results {
+					if i > 0 {
+						fmt.Fprintln(out)
+					}
+					writeSimulateResult(out, r)
+				}
+			}
+			var mismatched int
+			for _, r := range results {
+				if len(r.Mismatches) > 0 {
+					mismatched++
+				}
+			}
+			if mismatched > 0 {
+				return fmt.Errorf("%d of %d files did not match their expectation", mismatched, len(results))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	return cmd
+}
+
+func writeSimulateResult(out io.Writer, r simulate.Result) {
+	writeField(out, "File", r.File)
+	writeField(out, "Result", r.Status)
+	if r.Error != "" {
+		writeField(out, "Error", r.Error)
+	}
+	if u := r.Upload; u != nil {
+		writeField(out, "Title", u.Title)
+		writeField(out, "Created", u.Created)
+		writeField(out, "Correspondent", u.Correspondent)
+		writeField(out, "Document type", u.DocumentType)
+		writeField(out, "Storage path", u.StoragePath)
+		if u.ASN > 0 {
+			writeField(out, "ASN", fmt.Sprint(u.ASN))
+		}
+		writeField(out, "Tags", strings.Join(u.Tags, ", "))
+	}
+	switch r.Dest {
+	case "":
+		if r.Status != simulate.StatusNotWatched {
+			writeField(out, "Post upload", "left in place")
+		}
+	case "deleted":
+		writeField(out, "Post upload", "deleted")
+	default:
+		writeField(out, "Post upload", "moved to "+r.Dest)
+	}
+	for _, m := range r.Mismatches {
+		writeField(out, "Mismatch", m)
+	}
+}
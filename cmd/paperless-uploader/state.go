@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/state"
+)
+
+// openState opens the state store configured by state_backend and
+// state_file and returns it with its path.
+func openState(cfg *config.Config) (state.Store, string, error) {
+	path := cfg.StateFile
+	if path == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, "", fmt.Errorf("no cache directory for the state file, set state_file: %v", err)
+		}
+		path = filepath.Join(cache, "paperless-uploader", state.FileName(cfg.StateBackend, config.Namespaced("state")))
+	}
+	store, err := state.Open(cfg.StateBackend, path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open state store: %v", err)
+	}
+	return store, path, nil
+}
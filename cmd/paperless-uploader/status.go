@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/control"
+	"github.com/c-yco/go-paperless-uploader/internal/server"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/spf13/cobra"
+)
+
+func newStatusCmd(opts *globalOptions) *cobra.Command {
+	var (
+		statusAddr string
+		output     string
+	)
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the runtime state of a running watcher",
+		Long: `Show the runtime state of a running watcher: uptime, queue depth, uploads in
+flight, the retry backlog and the last success and failure per folder.
+
+The state is read from control_socket if it is configured, and from the local
+status endpoint at status_listen otherwise.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid output format %q: must be table or json", output)
+			}
+			var controlSocket string
+			if statusAddr == "" {
+				cfg, err := loadConfigFile(opts.configFile)
+				if err != nil {
+					return fmt.Errorf("failed to load configuration: %v", err)
+				}
+				statusAddr, controlSocket = cfg.StatusListen, cfg.ControlSocket
+			}
+			if statusAddr == "" && controlSocket == "" {
+				return fmt.Errorf("no status endpoint configured: set control_socket, status_listen or use --status-addr")
+			}
+
+			var (
+				status *watcher.Status
+				err    error
+			)
+			if controlSocket != "" {
+				status, err = control.NewClient(controlSocket).Status()
+			} else {
+				status, err = server.FetchStatus(statusAddr)
+			}
+			if err != nil {
+				return err
+			}
+			if output == "json" {
+				return writeJSON(cmd.OutOrStdout(), status)
+			}
+			return writeStatus(cmd.OutOrStdout(), status)
+		},
+	}
+	cmd.Flags().StringVar(&statusAddr, "status-addr", "", "address of the status endpoint (default: status_listen from the config)")
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	return cmd
+}
+
+func writeStatus(out io.Writer, status *watcher.Status) error {
+	switch {
+	case status.Watching && status.CircuitOpen:
+		fmt.Fprintf(out, "Watching:      yes, Paperless down, uploads held (up %s)\n", time.Since(status.StartedAt).Round(time.Second))
+	case status.Watching && status.Paused:
+		fmt.Fprintf(out, "Watching:      yes, paused (up %s)\n", time.Since(status.StartedAt).Round(time.Second))
+	case status.Watching:
+		fmt.Fprintf(out, "Watching:      yes (up %s)\n", time.Since(status.StartedAt).Round(time.Second))
+	default:
+		fmt.Fprintln(out, "Watching:      no")
+	}
+	fmt.Fprintf(out, "Queue depth:   %d\n", status.QueueDepth)
+	fmt.Fprintf(out, "In flight:     %d\n", status.InFlight)
+	fmt.Fprintf(out, "Retry backlog: %d\n", status.RetryBacklog)
+	if status.Spooled > 0 {
+		fmt.Fprintf(out, "Spooled:       %d\n", status.Spooled)
+	}
+	fmt.Fprintln(out)
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FOLDER\tUPLOADED\tFAILED\tLAST SUCCESS\tLAST FAILURE\tLAST ERROR")
+	for _, f := range status.Folders {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\n", f.Path, f.Uploaded, f.Failed, formatTime(f.LastSuccess), formatTime(f.LastFailure), f.LastError)
+	}
+	return tw.Flush()
+}
+
+// formatTime formats t for tables, showing "-" for the zero time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
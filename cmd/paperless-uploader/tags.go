@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/spf13/cobra"
+)
+
+// matchingAlgorithms maps the --matching-algorithm flag values to the API
+// constants.
+var matchingAlgorithms = map[string]int{
+	"none":    paperless.MatchNone,
+	"any":     paperless.MatchAny,
+	"all":     paperless.MatchAll,
+	"literal": paperless.MatchLiteral,
+	"regex":   paperless.MatchRegex,
+	"fuzzy":   paperless.MatchFuzzy,
+	"auto":    paperless.MatchAuto,
+}
+
+func newTagsCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tags",
+		Short: "Manage Paperless tags",
+	}
+	cmd.AddCommand(
+		newTagsListCmd(opts),
+		newTagsCreateCmd(opts),
+		newTagsDeleteCmd(opts),
+		newTagsSyncCmd(opts),
+	)
+	return cmd
+}
+
+func newTagsListCmd(opts *globalOptions) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the tags defined in Paperless",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("invalid output format %q: must be table or json", output)
+			}
+			_, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+			tags, err := client.GetTags()
+			if err != nil {
+				return fmt.Errorf("failed to get tags from Paperless: %v", err)
+			}
+			if output == "json" {
+				return writeJSON(cmd.OutOrStdout(), tags)
+			}
+			return writeTagTable(cmd.OutOrStdout(), tags)
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "output format: table or json")
+	return cmd
+}
+
+func writeTagTable(out io.Writer, tags []paperless.Tag) error {
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tCOLOR\tMATCH\tDOCUMENTS")
+	for _, tag := range tags {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\n", tag.ID, tag.Name, tag.Color, tag.Match, tag.DocumentCount)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func newTagsCreateCmd(opts *globalOptions) *cobra.Command {
+	var (
+		tag       paperless.NewTag
+		algorithm string
+	)
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a tag",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if tag.Name == "" {
+				return fmt.Errorf("--name is required")
+			}
+			if algorithm != "" {
+				id, ok := matchingAlgorithms[algorithm]
+				if !ok {
+					return fmt.Errorf("invalid matching algorithm %q", algorithm)
+				}
+				tag.MatchingAlgorithm = &id
+			}
+
+			_, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+			created, err := client.CreateTag(tag)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Created tag %q (ID %d)\n", created.Name, created.ID)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&tag.Name, "name", "", "name of the tag")
+	cmd.Flags().StringVar(&tag.Color, "color", "", "tag color, e.g. #a6cee3")
+	cmd.Flags().StringVar(&tag.Match, "match", "", "text used to automatically assign the tag")
+	cmd.Flags().StringVar(&algorithm, "matching-algorithm", "", "matching algorithm: none, any, all, literal, regex, fuzzy or auto")
+	cmd.Flags().BoolVar(&tag.IsInsensitive, "insensitive", true, "match case-insensitively")
+	return cmd
+}
+
+func newTagsDeleteCmd(opts *globalOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <name|id>...",
+		Short: "Delete tags by name or ID",
+		Long: `Delete tags by name or ID. A name always wins over an ID, so a numeric
+argument deletes the tag with that name if there is one and only falls back to
+the tag with that ID otherwise.`,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeTagNames(opts),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+			tags, err := client.GetTags()
+			if err != nil {
+				return fmt.Errorf("failed to get tags from Paperless: %v", err)
+			}
+
+			var failed int
+			for _, arg := range args {
+				tag, ok := findTag(tags, arg)
+				if !ok {
+					fmt.Fprintf(cmd.ErrOrStderr(), "Tag %q not found\n", arg)
+					failed++
+					continue
+				}
+				if err := client.DeleteTag(tag.ID); err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "%v\n", err)
+					failed++
+					continue
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Deleted tag %q (ID %d)\n", tag.Name, tag.ID)
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed to delete %d of %d tags", failed, len(args))
+			}
+			return nil
+		},
+	}
+}
+
+func newTagsSyncCmd(opts *globalOptions) *cobra.Command {
+	var check bool
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Create the tags referenced in the config that are missing in Paperless",
+		Long: `Make sure every tag referenced in the configuration (the global tags and the
+tags of each folder) exists in Paperless, creating missing ones.
+
+Tags are matched by name only, so a numeric tag name is never confused with a
+tag ID. Tags that only exist with different capitalisation are reported as
+drift and not created. With --check (or --dry-run) nothing is created and the command
+exits with a non-zero status if the config and the server differ, for use in
+CI or cron jobs.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+			tags, err := client.GetTags()
+			if err != nil {
+				return fmt.Errorf("failed to get tags from Paperless: %v", err)
+			}
+
+			out := cmd.OutOrStdout()
+			createMissing := !check && !opts.dryRun
+			var drift, failed int
+			for _, name := range cfg.TagNames() {
+				tag, ok := findTagByName(tags, name)
+				switch {
+				case ok && tag.Name == name:
+					fmt.Fprintf(out, "ok       %s\n", name)
+				case ok:
+					fmt.Fprintf(out, "drift    %s (exists as %q)\n", name, tag.Name)
+					drift++
+				case !createMissing:
+					fmt.Fprintf(out, "missing  %s\n", name)
+					drift++
+				default:
+					created, err := client.CreateTag(paperless.NewTag{Name: name})
+					if err != nil {
+						fmt.Fprintf(cmd.ErrOrStderr(), "failed to create tag %q: %v\n", name, err)
+						failed++
+						continue
+					}
+					tags = append(tags, *created)
+					fmt.Fprintf(out, "created  %s (ID %d)\n", created.Name, created.ID)
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed to create %d tags", failed)
+			}
+			if drift > 0 && !createMissing {
+				return fmt.Errorf("%d tags differ between config and Paperless", drift)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&check, "check", false, "only report differences; exit non-zero if there are any")
+	return cmd
+}
+
+// findTag looks up a tag by case-insensitive name, falling back to its ID
+// only when no tag has that name, so "2024" finds the tag named 2024 rather
+// than the tag with ID 2024.
+func findTag(tags []paperless.Tag, nameOrID string) (paperless.Tag, bool) {
+	if tag, ok := findTagByName(tags, nameOrID); ok {
+		return tag, true
+	}
+	if id, err := strconv.Atoi(nameOrID); err == nil {
+		for _, tag := range tags {
+			if tag.ID == id {
+				return tag, true
+			}
+		}
+	}
+	return paperless.Tag{}, false
+}
+
+// findTagByName looks up a tag by case-insensitive name.
+func findTagByName(tags []paperless.Tag, name string) (paperless.Tag, bool) {
+	for _, tag := range tags {
+		if strings.EqualFold(tag.Name, name) {
+			return tag, true
+		}
+	}
+	return paperless.Tag{}, false
+}
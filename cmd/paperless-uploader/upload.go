@@ -0,0 +1,583 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/fetch"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/metrics"
+	"github.com/c-yco/go-paperless-uploader/internal/tui"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newUploadCmd(opts *globalOptions) *cobra.Command {
+	var (
+		filesFrom   string
+		tags        []string
+		replaceTags bool
+		createTags  bool
+		meta        metadataFlags
+		wait        bool
+		waitTimeout time.Duration
+		pick        bool
+		name        string
+		keepOpen    bool
+		headers     []string
+	)
+	cmd := &cobra.Command{
+		Use:   "upload <file|directory|glob|url|->...",
+		Short: "Upload documents to Paperless",
+		Long: `Upload documents to Paperless.
+
+Arguments may be files, directories (uploaded recursively) or glob patterns.
+Additional paths can be read from a file, or from stdin with "--files-from -",
+separated by newlines or NUL characters (as produced by "find -print0").
+The argument "-" uploads the document content read from stdin under the file
+name given with --name. http and https URLs are downloaded and uploaded, sending
+the headers given with --header, e.g. a cookie or an Authorization header.
+Tags given with --tag are added to the configured tags (or replace them with
+--replace-tags) and are created in Paperless if they don't exist yet.
+Metadata flags apply to every uploaded document; names are resolved to IDs.
+With --wait the command waits until Paperless has consumed each document and
+prints its ID and URL, counting failed consumption as a failed upload.
+With --pick, tags, correspondent and document type not given as flags are
+chosen interactively from the ones defined in Paperless.
+The command exits with a non-zero status if any upload fails.`,
+		Example: `  paperless-uploader upload scans/*.pdf --tag inbox
+  find . -name '*.pdf' -print0 | paperless-uploader upload --files-from -
+  scanimage --format=pdf | paperless-uploader upload - --name scan.pdf
+  paperless-uploader upload https://example.com/invoice.pdf --header "Cookie: session=abc"`,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if keepOpen {
+				defer func() { waitOnError(cmd, err) }()
+			}
+			args, fromStdin := splitStdinArg(args)
+			args, urls := splitURLArgs(args)
+			header, err := parseHeaders(headers)
+			if err != nil {
+				return err
+			}
+			if fromStdin && filesFrom == "-" {
+				return fmt.Errorf("stdin cannot be used for both document content and --files-from")
+			}
+			if fromStdin && name == "" {
+				return fmt.Errorf("--name is required when uploading from stdin")
+			}
+			var listed []string
+			if filesFrom != "" {
+				var err error
+				if listed, err = readFilesFrom(filesFrom, cmd.InOrStdin()); err != nil {
+					return err
+				}
+			}
+			if len(args) == 0 && len(urls) == 0 && filesFrom == "" && !fromStdin {
+				return fmt.Errorf("at least one file, directory, glob or URL is required")
+			}
+			if err := meta.validate(); err != nil {
+				return err
+			}
+			if pick && !isInteractive() {
+				return fmt.Errorf("--pick requires an interactive terminal")
+			}
+
+			cfg, client, err := opts.loadClient()
+			if err != nil {
+				return err
+			}
+			configTags := cfg.Tags
+			if replaceTags {
+				configTags = nil
+			}
+
+			out := cmd.OutOrStdout()
+			files, result := collectFiles(args, listed)
+			if pick && (len(files) > 0 || len(urls) > 0 || fromStdin) {
+				if err := pickMetadata(client, &meta, &tags); err != nil {
+					return err
+				}
+			}
+			if opts.dryRun {
+				allTags := append(append([]string{}, configTags...), tags...)
+				if fromStdin {
+					fmt.Fprintf(out, "[dry-run] Would upload stdin as %s with tags %v%s\n", name, allTags, meta)
+				}
+				for _, filePath := range files {
+					fmt.Fprintf(out, "[dry-run] Would upload %s with tags %v%s\n", filePath, allTags, meta)
+				}
+				for _, u := range urls {
+					fmt.Fprintf(out, "[dry-run] Would download and upload %s with tags %v%s\n", u, allTags, meta)
+				}
+				return result.report(out)
+			}
+
+			if cfg.Pushgateway.URL != "" {
+				start := time.Now()
+				defer func() {
+					run := metrics.Run{Start: start, Uploaded: result.Succeeded, Failed: len(result.Failed), Err: err}
+					if pushErr := metrics.PushRun(cfg.Pushgateway, run); pushErr != nil {
+						logging.Warnf("%v", pushErr)
+					}
+				}()
+			}
+			flushTraces, err := setupTracing(cmd.Context(), cfg)
+			if err != nil {
+				return err
+			}
+			defer flushTraces()
+
+			tagIDs, err := resolveTagIDs(client, configTags)
+			if err != nil {
+				return err
+			}
+			adHocIDs, err := ensureTags(client, tags, createTags)
+			if err != nil {
+				return err
+			}
+			uploadOpts, err := meta.resolve(client)
+			if err != nil {
+				return err
+			}
+			uploadOpts.Tags = mergeIDs(tagIDs, adHocIDs)
+
+			upload := func(label string, send func() (string, error)) {
+				ctx, doc := tracer.Start(cmd.Context(), "document", trace.WithAttributes(attribute.String("file", label)))
+				fmt.Fprintf(out, "Uploading %s to Paperless...\n", label)
+				_, span := tracer.Start(ctx, "upload")
+				taskID, err := send()
+				span.SetAttributes(attribute.String("task_id", taskID))
+				endSpan(span, err)
+				if err != nil {
+					endSpan(doc, err)
+					result.fail(label, err)
+					return
+				}
+				if wait {
+					_, span := tracer.Start(ctx, "task_poll")
+					err := waitForConsumption(out, client, taskID, waitTimeout)
+					endSpan(span, err)
+					if err != nil {
+						endSpan(doc, err)
+						result.fail(label, err)
+						return
+					}
+				}
+				doc.End()
+				result.Succeeded++
+			}
+			if fromStdin {
+				upload(name+" (stdin)", func() (string, error) {
+					return client.UploadReader(name, cmd.InOrStdin(), uploadOpts)
+				})
+			}
+			for _, filePath := range files {
+				upload(filePath, func() (string, error) {
+					return client.UploadFile(filePath, uploadOpts)
+				})
+			}
+			for _, u := range urls {
+				upload(u, func() (string, error) {
+					return uploadURL(cmd.Context(), client, u, header, uploadOpts)
+				})
+			}
+			return result.report(out)
+		},
+	}
+	cmd.Flags().StringArrayVar(&tags, "tag", nil, "add a tag by name for this upload (repeatable)")
+	registerTagCompletion(cmd, opts)
+	cmd.Flags().BoolVar(&replaceTags, "replace-tags", false, "use only the --tag tags instead of adding them to the configured tags")
+	cmd.Flags().BoolVar(&createTags, "create-tags", true, "create --tag tags that don't exist in Paperless yet")
+	meta.register(cmd)
+	cmd.Flags().StringVar(&filesFrom, "files-from", "", `read paths to upload from a file ("-" for stdin), one per line or NUL-separated`)
+	cmd.Flags().BoolVar(&wait, "wait", false, "wait until Paperless has consumed each document")
+	cmd.Flags().DurationVar(&waitTimeout, "wait-timeout", 5*time.Minute, "maximum time to wait for consumption of each document")
+	cmd.Flags().StringArrayVar(&headers, "header", nil, `header sent when downloading URLs, e.g. "Cookie: session=abc" (repeatable)`)
+	cmd.Flags().StringVar(&name, "name", "", `file name for the document read from stdin with "-", e.g. scan.pdf`)
+	cmd.Flags().BoolVar(&pick, "pick", false, "choose tags, correspondent and document type interactively")
+	// Used by the shell integration, whose console window closes on exit.
+	cmd.Flags().BoolVar(&keepOpen, "keep-open-on-error", false, "wait for Enter before exiting when an upload fails")
+	cmd.Flags().MarkHidden("keep-open-on-error")
+	return cmd
+}
+
+// waitOnError prints err and waits for Enter, so the error stays readable in
+// a console window that closes when the command exits.
+func waitOnError(cmd *cobra.Command, err error) {
+	if err == nil {
+		return
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Error: %v\nPress Enter to close...", err)
+	bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+}
+
+// splitStdinArg removes the "-" arguments from args and reports whether there
+// were any.
+func splitStdinArg(args []string) ([]string, bool) {
+	var rest []string
+	fromStdin := false
+	for _, arg := range args {
+		if arg == "-" {
+			fromStdin = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, fromStdin
+}
+
+// splitURLArgs removes the http and https URLs from args and returns them.
+func splitURLArgs(args []string) ([]string, []string) {
+	var rest, urls []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+			urls = append(urls, arg)
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, urls
+}
+
+// parseHeaders parses "Name: value" flags.
+func parseHeaders(flags []string) (http.Header, error) {
+	header := make(http.Header)
+	for _, f := range flags {
+		name, value, ok := strings.Cut(f, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid --header %q, expected \"Name: value\"", f)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return header, nil
+}
+
+// uploadURL downloads the document at rawURL into a temporary directory and
+// uploads it.
+func uploadURL(ctx context.Context, client *paperless.Client, rawURL string, header http.Header, opts paperless.UploadOptions) (string, error) {
+	dir, err := os.MkdirTemp("", "paperless-uploader-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	path, err := fetch.Download(ctx, nil, rawURL, header, maxFetchSize, fetch.ToDir(dir))
+	if err != nil {
+		return "", err
+	}
+	return client.UploadFile(path, opts)
+}
+
+// pickItems shows the interactive picker; replaced in tests.
+var pickItems = tui.Pick
+
+// isInteractive reports whether stdin and stdout are terminals.
+func isInteractive() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd())
+}
+
+// pickMetadata lets the user choose the tags, correspondent and document type
+// that were not given on the command line.
+func pickMetadata(client *paperless.Client, meta *metadataFlags, tags *[]string) error {
+	if len(*tags) == 0 {
+		all, err := client.GetTags()
+		if err != nil {
+			return fmt.Errorf("failed to get tags from Paperless: %v", err)
+		}
+		var items []tui.Item
+		for _, tag := range all {
+			items = append(items, tui.Item{ID: tag.ID, Name: tag.Name})
+		}
+		chosen, err := pickItems("Tags", items, true)
+		if err != nil {
+			return err
+		}
+		for _, item := range chosen {
+			*tags = append(*tags, item.Name)
+		}
+	}
+	if meta.correspondent == "" {
+		all, err := client.GetCorrespondents()
+		if err != nil {
+			return fmt.Errorf("failed to get correspondents from Paperless: %v", err)
+		}
+		var items []tui.Item
+		for _, c := range all {
+			items = append(items, tui.Item{ID: c.ID, Name: c.Name})
+		}
+		if meta.correspondent, err = pickOne("Correspondent", items); err != nil {
+			return err
+		}
+	}
+	if meta.documentType == "" {
+		all, err := client.GetDocumentTypes()
+		if err != nil {
+			return fmt.Errorf("failed to get document types from Paperless: %v", err)
+		}
+		var items []tui.Item
+		for _, t := range all {
+			items = append(items, tui.Item{ID: t.ID, Name: t.Name})
+		}
+		if meta.documentType, err = pickOne("Document type", items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pickOne lets the user choose one of items and returns its ID, or "" if the
+// choice was skipped.
+func pickOne(title string, items []tui.Item) (string, error) {
+	if len(items) == 0 {
+		return "", nil
+	}
+	chosen, err := pickItems(title, items, false)
+	if err != nil || len(chosen) == 0 {
+		return "", err
+	}
+	return strconv.Itoa(chosen[0].ID), nil
+}
+
+// tracer records the spans of the upload command.
+var tracer = otel.Tracer("github.com/c-yco/go-paperless-uploader/cmd/paperless-uploader")
+
+// endSpan ends span, marking it as failed if err is set.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// taskPollInterval is how often --wait polls the consumption task.
+var taskPollInterval = 2 * time.Second
+
+// waitForConsumption waits for the consumption task and prints the created
+// document, returning an error if consumption failed.
+func waitForConsumption(out io.Writer, client *paperless.Client, taskID string, timeout time.Duration) error {
+	if taskID == "" {
+		return fmt.Errorf("no consumption task returned by Paperless")
+	}
+	task, err := client.WaitForTask(taskID, taskPollInterval, timeout)
+	if err != nil {
+		return err
+	}
+	if task.Status != paperless.TaskSuccess {
+		return fmt.Errorf("consumption failed: %s", task.Result)
+	}
+	fmt.Fprintf(out, "Created document %d: %s\n", task.DocumentID, client.DocumentURL(task.DocumentID))
+	return nil
+}
+
+// metadataFlags holds the document metadata given on the command line.
+type metadataFlags struct {
+	title         string
+	correspondent string
+	documentType  string
+	storagePath   string
+	created       string
+	asn           int
+}
+
+func (m *metadataFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&m.title, "title", "", "document title")
+	cmd.Flags().StringVar(&m.correspondent, "correspondent", "", "correspondent name or ID")
+	cmd.Flags().StringVar(&m.documentType, "document-type", "", "document type name or ID")
+	cmd.Flags().StringVar(&m.storagePath, "storage-path", "", "storage path name or ID")
+	cmd.Flags().StringVar(&m.created, "created", "", "creation date (YYYY-MM-DD or RFC 3339)")
+	cmd.Flags().IntVar(&m.asn, "asn", 0, "archive serial number")
+}
+
+func (m *metadataFlags) validate() error {
+	if m.created == "" {
+		return nil
+	}
+	if _, err := time.Parse("2006-01-02", m.created); err == nil {
+		return nil
+	}
+	if _, err := time.Parse(time.RFC3339, m.created); err == nil {
+		return nil
+	}
+	return fmt.Errorf("invalid --created %q: expected YYYY-MM-DD or RFC 3339", m.created)
+}
+
+// resolve looks up the named objects and returns the upload options.
+func (m *metadataFlags) resolve(client *paperless.Client) (paperless.UploadOptions, error) {
+	opts := paperless.UploadOptions{Title: m.title, Created: m.created}
+	var err error
+	if opts.Correspondent, err = lookupCorrespondent(client, m.correspondent); err != nil {
+		return opts, err
+	}
+	if opts.DocumentType, err = lookupDocumentType(client, m.documentType); err != nil {
+		return opts, err
+	}
+	if opts.StoragePath, err = lookupStoragePath(client, m.storagePath); err != nil {
+		return opts, err
+	}
+	if m.asn > 0 {
+		asn := m.asn
+		opts.ArchiveSerialNumber = &asn
+	}
+	return opts, nil
+}
+
+// String describes the metadata for dry-run output.
+func (m metadataFlags) String() string {
+	var parts []string
+	for _, f := range [][2]string{
+		{"title", m.title},
+		{"correspondent", m.correspondent},
+		{"document type", m.documentType},
+		{"storage path", m.storagePath},
+		{"created", m.created},
+	} {
+		if f[1] != "" {
+			parts = append(parts, fmt.Sprintf("%s %q", f[0], f[1]))
+		}
+	}
+	if m.asn > 0 {
+		parts = append(parts, fmt.Sprintf("ASN %d", m.asn))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(parts, ", ")
+}
+
+// readFilesFrom reads a newline or NUL separated list of paths from the named
+// file, or from stdin when name is "-". Paths are taken literally; globs are
+// not expanded.
+func readFilesFrom(name string, stdin io.Reader) ([]string, error) {
+	r := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file list: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+
+	sep := "\n"
+	if strings.Contains(string(data), "\x00") {
+		sep = "\x00"
+	}
+	var paths []string
+	for _, line := range strings.Split(string(data), sep) {
+		line = strings.TrimSuffix(line, "\r")
+		if line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
+
+// uploadResult summarises a multi-file upload.
+type uploadResult struct {
+	Succeeded int
+	Failed    []uploadFailure
+}
+
+type uploadFailure struct {
+	Path string
+	Err  error
+}
+
+func (r *uploadResult) fail(path string, err error) {
+	r.Failed = append(r.Failed, uploadFailure{Path: path, Err: err})
+}
+
+// report prints the summary and returns an error if any upload failed.
+func (r *uploadResult) report(out io.Writer) error {
+	total := r.Succeeded + len(r.Failed)
+	fmt.Fprintf(out, "Uploaded %d of %d documents successfully.\n", r.Succeeded, total)
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	fmt.Fprintf(out, "%d failed:\n", len(r.Failed))
+	for _, f := range r.Failed {
+		fmt.Fprintf(out, "  %s: %v\n", f.Path, f.Err)
+	}
+	return fmt.Errorf("%d of %d uploads failed", len(r.Failed), total)
+}
+
+// collectFiles expands the upload arguments into a list of files. Glob
+// patterns in args are expanded, listed paths are used literally, and
+// directories are walked recursively. Paths that cannot be resolved are
+// recorded as failures in the returned result.
+func collectFiles(args, listed []string) ([]string, *uploadResult) {
+	result := &uploadResult{}
+	seen := make(map[string]bool)
+	var files []string
+
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	var paths []string
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			paths = append(paths, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			result.fail(arg, fmt.Errorf("invalid pattern: %w", err))
+			continue
+		}
+		if len(matches) == 0 {
+			result.fail(arg, fmt.Errorf("no files match pattern"))
+			continue
+		}
+		paths = append(paths, matches...)
+	}
+	paths = append(paths, listed...)
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			result.fail(path, err)
+			continue
+		}
+		if !info.IsDir() {
+			add(path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				result.fail(p, err)
+				return nil
+			}
+			if d.Type().IsRegular() {
+				add(p)
+			}
+			return nil
+		})
+		if err != nil {
+			result.fail(path, err)
+		}
+	}
+	return files, result
+}
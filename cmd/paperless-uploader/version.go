@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/spf13/cobra"
+)
+
+// Build information, set at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.date=...".
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// buildInfo describes the running binary.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// currentBuildInfo returns the injected build information, falling back to
+// the VCS details Go embeds in binaries built from a checkout.
+func currentBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.Date == "":
+				info.Date = setting.Value
+			}
+		}
+		if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	if info.Date == "" {
+		info.Date = "unknown"
+	}
+	return info
+}
+
+func newVersionCmd(opts *globalOptions) *cobra.Command {
+	var short bool
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print version and build information",
+		Long: `Print version and build information, and the version of the configured
+Paperless server when it is reachable. Please include this in bug reports.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			out := cmd.OutOrStdout()
+			info := currentBuildInfo()
+			if short {
+				fmt.Fprintln(out, info.Version)
+				return
+			}
+			fmt.Fprintf(out, "paperless-uploader %s\n", info.Version)
+			fmt.Fprintf(out, "  commit:     %s\n", info.Commit)
+			fmt.Fprintf(out, "  built:      %s\n", info.Date)
+			fmt.Fprintf(out, "  go version: %s\n", info.GoVersion)
+			fmt.Fprintf(out, "  platform:   %s\n", info.Platform)
+			fmt.Fprintf(out, "  server:     %s\n", serverVersion(opts))
+		},
+	}
+	cmd.Flags().BoolVar(&short, "short", false, "print only the version number")
+	return cmd
+}
+
+// serverVersion returns the Paperless server version, or a short explanation
+// why it could not be determined.
+func serverVersion(opts *globalOptions) string {
+	cfg, err := loadConfigFile(opts.configFile)
+	if err != nil {
+		return "unknown (no configuration)"
+	}
+	v, err := paperless.NewClient(cfg.PaperlessURL, cfg.APIKey).GetServerVersion()
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	return fmt.Sprintf("Paperless-ngx %s at %s", v, cfg.PaperlessURL)
+}
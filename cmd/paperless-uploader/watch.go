@@ -0,0 +1,543 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/audit"
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/deferred"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/metrics"
+	"github.com/c-yco/go-paperless-uploader/internal/mqtt"
+	"github.com/c-yco/go-paperless-uploader/internal/notify"
+	"github.com/c-yco/go-paperless-uploader/internal/privilege"
+	"github.com/c-yco/go-paperless-uploader/internal/server"
+	"github.com/c-yco/go-paperless-uploader/internal/state"
+	"github.com/c-yco/go-paperless-uploader/internal/stats"
+	"github.com/c-yco/go-paperless-uploader/internal/systemd"
+	"github.com/c-yco/go-paperless-uploader/internal/tray"
+	"github.com/c-yco/go-paperless-uploader/internal/tui"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/spf13/cobra"
+)
+
+// watcherCreated, if set, receives the watcher of the watch command before
+// it runs. The Windows service uses it to pause and resume processing.
+var watcherCreated func(*watcher.Watcher)
+
+func newWatchCmd(opts *globalOptions) *cobra.Command {
+	var dashboard, once, trayIcon bool
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Watch folders for new files and upload them",
+		Long: `Watch folders for new files and upload them.
+
+With --once the files currently in the folders are uploaded and the command
+exits after their uploads, retries and consumption by Paperless are done,
+instead of watching for new files. It exits with a non-zero status if any file
+failed, for use in cron jobs and systemd timers.
+
+With --tray a system tray icon shows the status and the recent uploads, and
+its menu pauses and resumes processing and uploads files picked in a file
+dialog with the configured tags. On Linux the file dialog needs zenity or
+kdialog.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if once && dashboard {
+				return fmt.Errorf("--once and --tui cannot be combined")
+			}
+			if trayIcon && (once || dashboard) {
+				return fmt.Errorf("--tray cannot be combined with --once or --tui")
+			}
+			// The control socket outlives the runs of the watcher, which
+			// restart on every reload.
+			var ctl *controller
+			if !once {
+				cfg, err := loadConfigFile(opts.configFile)
+				if err != nil {
+					return fmt.Errorf("failed to load configuration: %v", err)
+				}
+				if cfg.ControlSocket != "" {
+					ctl = newController(cfg.ControlSocket, opts)
+					if err := ctl.Start(); err != nil {
+						return err
+					}
+					defer func() {
+						ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+						defer cancel()
+						ctl.Shutdown(ctx)
+					}()
+				}
+				defer systemd.Notify("STOPPING=1")
+			}
+
+			var (
+				dropped      bool
+				auditKeyPath string
+				auditKey     ed25519.PrivateKey
+			)
+			run := func(ctx context.Context) error {
+				cfg, client, err := opts.loadClient()
+				if err != nil {
+					return err
+				}
+				flushTraces, err := setupTracing(ctx, cfg)
+				if err != nil {
+					return err
+				}
+				defer flushTraces()
+				var tagMap map[string]int
+				if !opts.dryRun {
+					if tagMap, err = resolveTagMap(client, cfg.TagNames()); err != nil {
+						return err
+					}
+				}
+
+				folders := watchFolders(cfg, tagMap)
+				origins := newFileOrigins()
+				if err := attachRules(client, cfg, folders, origins); err != nil {
+					return err
+				}
+				var received *receivedMetadata
+				screenshots := cfg.Screenshots.Watch || cfg.Screenshots.Clipboard
+				if (cfg.UploadReceiver.Listen != "" || cfg.GRPC.Listen != "" || cfg.WebUI.Listen != "" || screenshots) && !once {
+					received = newReceivedMetadata()
+					received.attach(client, folders)
+				}
+				w := watcher.New(client, folders)
+				w.OnEvent(origins.Handle)
+				if watcherCreated != nil {
+					watcherCreated(w)
+				}
+				if ctl != nil {
+					ctl.attach(w, cfg, client)
+					defer ctl.detach()
+				}
+				w.DryRun = opts.dryRun
+				w.MaxRetries = cfg.MaxRetries
+				w.RetryDelay = cfg.RetryDelay
+				w.Receipts = cfg.Receipts
+				w.ErrorReports = cfg.ErrorReports
+				w.Profile = config.Profile()
+				w.VerifyChecksum = cfg.VerifyChecksum
+				if cfg.AfterConsumption.Enabled() {
+					applier, err := deferred.New(cfg.AfterConsumption)
+					if err != nil {
+						return fmt.Errorf("invalid after_consumption: %v", err)
+					}
+					w.AfterConsumption = applier.Apply
+				}
+				w.FallbackDir = cfg.ConsumeFallback.Dir
+				w.FallbackAfter = cfg.ConsumeFallback.After
+				w.BreakerThreshold = cfg.CircuitBreaker.Threshold
+				w.BreakerProbe = cfg.CircuitBreaker.ProbeInterval
+				w.SpoolDir = cfg.SpoolDir
+				if cfg.FolderLock.Enabled {
+					if w.Instance, err = lockInstance(cfg.FolderLock); err != nil {
+						return err
+					}
+					w.ClaimTimeout = cfg.FolderLock.Timeout
+				}
+				if cfg.MemoryBudget != "" {
+					budget, err := config.ParseSize(cfg.MemoryBudget)
+					if err != nil {
+						return fmt.Errorf("invalid memory_budget: %v", err)
+					}
+					debug.SetMemoryLimit(budget)
+					w.MaxPending = maxPendingFor(budget)
+					logging.Infof("Memory budget %s: at most %d files pending", cfg.MemoryBudget, w.MaxPending)
+				}
+				// The signing key is read while still root, so it can be
+				// kept from the run_as user, and reused after a reload.
+				if cfg.AuditLog != "" && cfg.AuditSigningKey != auditKeyPath {
+					auditKey = nil
+					if cfg.AuditSigningKey != "" {
+						if auditKey, err = audit.LoadSigningKey(cfg.AuditSigningKey); err != nil {
+							return fmt.Errorf("invalid audit_signing_key: %v", err)
+						}
+					}
+					auditKeyPath = cfg.AuditSigningKey
+				}
+
+				targets, err := notify.FromConfig(cfg.Notifications)
+				if err != nil {
+					return fmt.Errorf("invalid notification settings: %v", err)
+				}
+				if len(targets) > 0 {
+					notifier := notify.NewDispatcher(targets, w.Status)
+					if cfg.Notifications.DocumentLinks {
+						notifier.ResolveDocuments(func(taskID string) (string, error) {
+							return documentURL(client, taskID)
+						})
+					}
+					w.OnEvent(notifier.Handle)
+					go notifier.Run(ctx, cfg.Notifications.SummaryInterval)
+				}
+
+				if cfg.LogSummaryInterval > 0 {
+					var paths []string
+					for _, f := range folders {
+						paths = append(paths, f.Path)
+					}
+					collector := stats.NewCollector(paths...)
+					w.OnEvent(collector.Handle)
+					go collector.Run(ctx, cfg.LogSummaryInterval)
+				}
+				if cfg.GoogleDrive.FolderID != "" && !once {
+					drive, err := newDriveSource(cfg.GoogleDrive, folders, opts.dryRun)
+					if err != nil {
+						return err
+					}
+					w.AddSource(drive)
+				}
+				if cfg.SFTP.Host != "" && !once {
+					remote, err := newSFTPSource(cfg.SFTP, folders, opts.dryRun)
+					if err != nil {
+						return err
+					}
+					origins.addRemote(remote.Remote)
+					w.AddSource(remote)
+				}
+				if cfg.Rclone.URL != "" && !once {
+					folder := watcher.Folder{Tags: tagIDsFor(tagMap, cfg.Rclone.Tags), TagNames: cfg.Rclone.Tags}
+					if len(cfg.Rules) > 0 {
+						engine, err := newEngine(cfg, "", "")
+						if err != nil {
+							return err
+						}
+						attachEngine(&folder, engine, client, origins, false)
+					}
+					remote, err := newRcloneSource(cfg.Rclone, folder, opts.dryRun)
+					if err != nil {
+						return err
+					}
+					origins.addRemote(remote.Remote)
+					w.AddSource(remote)
+				}
+				if cfg.RemovableDrives.Enabled && !once {
+					w.AddSource(newRemovableSource(cfg.RemovableDrives, tagMap, opts.dryRun))
+				}
+				if screenshots && !once {
+					source, err := newScreenshotSource(cfg.Screenshots, folders, received)
+					if err != nil {
+						return err
+					}
+					go func() {
+						if err := source.Run(ctx); err != nil {
+							logging.Errorf("Screenshot source failed: %v", err)
+						}
+					}()
+				}
+				if cfg.MQTT.Broker != "" {
+					publisher := mqtt.New(cfg.MQTT, version, w.Status)
+					if cfg.MQTT.Commands && !once {
+						commands, err := newMQTTCommands(cfg.MQTT, folders, w)
+						if err != nil {
+							return err
+						}
+						publisher.HandleCommands(commands)
+					}
+					w.OnEvent(publisher.Handle)
+					go publisher.Run(ctx)
+				}
+
+				endpoints := endpoints{}
+				if cfg.StatusListen != "" {
+					endpoints.at(cfg.StatusListen).Handle("/status", server.StatusHandler(w.Status))
+				}
+				if cfg.MetricsListen != "" {
+					endpoints.at(cfg.MetricsListen).Handle("/metrics", metrics.New(w).Handler())
+				}
+				if cfg.UploadReceiver.Listen != "" && !once {
+					upload, err := newUploadHandler(cfg.UploadReceiver, folders, received)
+					if err != nil {
+						return err
+					}
+					endpoints.at(cfg.UploadReceiver.Listen).Handle("POST /upload", upload)
+					fetchURL, err := newFetchHandler(cfg.UploadReceiver, folders, received)
+					if err != nil {
+						return err
+					}
+					endpoints.at(cfg.UploadReceiver.Listen).Handle("POST /fetch", fetchURL)
+				}
+				if cfg.WebUI.Listen != "" && !once {
+					ui, err := newWebUI(cfg, folders, w, client, received, opts.dryRun)
+					if err != nil {
+						return err
+					}
+					if ui.Username == "" && ui.Password == "" {
+						logging.Warnf("The web UI on %s has no password; everyone who can reach it can upload", cfg.WebUI.Listen)
+					}
+					w.OnEvent(ui.Handle)
+					// The activity view links to the created documents.
+					w.TrackConsumption = true
+					endpoints.at(cfg.WebUI.Listen).Handle("/", ui.Handler())
+				}
+				if received != nil {
+					w.OnEvent(received.Handle)
+				}
+				defer endpoints.shutdown()
+				if len(endpoints) > 0 {
+					health := server.NewHealth(w.Status, cfg.ReadyTimeout)
+					w.OnEvent(func(e watcher.Event) {
+						if e.Type == watcher.EventUploaded {
+							health.Observe(nil)
+						}
+					})
+					if !opts.dryRun {
+						go health.Monitor(ctx, client.Ping, healthInterval(cfg.ReadyTimeout))
+					}
+					for _, srv := range endpoints {
+						srv.Handle("/healthz", health.Healthz())
+						srv.Handle("/readyz", health.Readyz())
+					}
+				}
+				if err := endpoints.start(); err != nil {
+					return err
+				}
+				if cfg.SMTPReceiver.Listen != "" && !once {
+					receiver, err := newSMTPReceiver(cfg.SMTPReceiver, folders)
+					if err != nil {
+						return err
+					}
+					receiver.Delivered = origins.delivered
+					if err := receiver.Start(); err != nil {
+						return err
+					}
+					defer func() {
+						ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+						defer cancel()
+						receiver.Shutdown(ctx)
+					}()
+				}
+				if cfg.FTPReceiver.Listen != "" && !once {
+					receiver, err := newFTPReceiver(cfg.FTPReceiver, folders)
+					if err != nil {
+						return err
+					}
+					if err := receiver.Start(); err != nil {
+						return err
+					}
+					defer func() {
+						ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+						defer cancel()
+						receiver.Shutdown(ctx)
+					}()
+				}
+				if cfg.GRPC.Listen != "" && !once {
+					api, err := newGRPCServer(cfg.GRPC, folders, w, received)
+					if err != nil {
+						return err
+					}
+					w.OnEvent(api.Handle)
+					if err := api.Start(); err != nil {
+						return err
+					}
+					defer func() {
+						ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+						defer cancel()
+						api.Shutdown(ctx)
+					}()
+				}
+				// Runs after a reload have dropped them already.
+				if !dropped {
+					if err := privilege.Drop(cfg.RunAs.User, cfg.RunAs.Group); err != nil {
+						return fmt.Errorf("failed to drop privileges: %v", err)
+					}
+					if cfg.RunAs.User != "" {
+						logging.Infof("Switched to user %s", cfg.RunAs.User)
+					}
+					dropped = true
+				}
+				// The files written while watching are opened only now, as
+				// the run_as user, so a reload can open them again.
+				if cfg.DedupWindow > 0 && !opts.dryRun {
+					store, _, err := openState(cfg)
+					if err != nil {
+						return err
+					}
+					defer store.Close()
+					w.Recent = state.NewRecentUploads(store, cfg.DedupWindow)
+				}
+				if cfg.AuditLog != "" {
+					auditLog, err := audit.Open(cfg.AuditLog, auditKey)
+					if err != nil {
+						return err
+					}
+					defer auditLog.Close()
+					w.OnEvent(auditLog.Handle)
+					w.TrackConsumption = true
+				}
+				if cfg.DocumentIndex.Path != "" && !once && !opts.dryRun {
+					if cfg.DocumentIndex.RefreshInterval <= 0 {
+						return fmt.Errorf("document_index.refresh_interval must be positive")
+					}
+					index, err := openIndex(cfg)
+					if err != nil {
+						return err
+					}
+					indexCtx, stopIndex := context.WithCancel(ctx)
+					var wg sync.WaitGroup
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						runIndexRefresh(indexCtx, index, client, cfg.DocumentIndex.RefreshInterval)
+					}()
+					defer func() {
+						stopIndex()
+						wg.Wait()
+						index.Close()
+					}()
+				}
+				if once {
+					return scanOnce(ctx, w)
+				}
+
+				// Under systemd (Type=notify) report readiness once watching
+				// and keep the watchdog fed while the event loop responds.
+				w.OnEvent(func(e watcher.Event) {
+					if e.Type == watcher.EventWatching {
+						if _, err := systemd.Notify(fmt.Sprintf("READY=1\nSTATUS=Watching %d folders", len(folders))); err != nil {
+							logging.Warnf("Failed to notify systemd: %v", err)
+						}
+					}
+				})
+				go systemd.RunWatchdog(ctx, func() bool { return w.Alive(5 * time.Second) })
+
+				if dashboard {
+					return tui.Run(ctx, w)
+				}
+				if trayIcon {
+					tags := tagIDsFor(tagMap, cfg.Tags)
+					return tray.Run(ctx, w, func(path string) error {
+						if opts.dryRun {
+							logging.Infof("[dry-run] Would upload %s", path)
+							return nil
+						}
+						_, err := client.UploadFile(path, paperless.UploadOptions{Tags: tags})
+						return err
+					})
+				}
+				return w.Run(ctx)
+			}
+			if ctl == nil {
+				return run(cmd.Context())
+			}
+			return ctl.run(cmd.Context(), run)
+		},
+	}
+	cmd.Flags().BoolVar(&dashboard, "tui", false, "show a live terminal dashboard instead of log output")
+	cmd.Flags().BoolVar(&trayIcon, "tray", false, "show a system tray icon with the status, pause/resume and manual upload")
+	cmd.Flags().BoolVar(&once, "once", false, "upload the files currently in the folders, wait until Paperless consumed them and exit")
+	return cmd
+}
+
+// scanOnce uploads the files currently in the folders of w and waits for
+// their consumption. It fails if any file could not be uploaded or consumed.
+func scanOnce(ctx context.Context, w *watcher.Watcher) error {
+	var (
+		mu            sync.Mutex
+		files, failed int
+	)
+	w.TrackConsumption = true
+	w.OnEvent(func(e watcher.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch e.Type {
+		case watcher.EventDetected:
+			files++
+		case watcher.EventUploadFailed, watcher.EventConsumeFailed, watcher.EventVerifyFailed:
+			failed++
+		}
+	})
+	if err := w.Scan(ctx); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	logging.Infof("Scan finished: %d files, %d failed", files, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, files)
+	}
+	return nil
+}
+
+// maxPendingFor returns the number of files that may wait for upload within
+// a memory budget of budget bytes.
+func maxPendingFor(budget int64) int {
+	return int(min(max(budget>>22, 8), 1024))
+}
+
+// lockInstance returns the name the instance claims files under.
+func lockInstance(lock config.FolderLock) (string, error) {
+	if lock.Timeout <= 0 {
+		return "", fmt.Errorf("folder_lock.timeout must be positive")
+	}
+	if lock.Instance != "" {
+		return lock.Instance, nil
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("no host name to claim files under, set folder_lock.instance: %v", err)
+	}
+	return config.Namespaced(host), nil
+}
+
+// documentURL waits for the consumption task and returns the URL of the
+// created document.
+func documentURL(client *paperless.Client, taskID string) (string, error) {
+	task, err := client.WaitForTask(taskID, taskPollInterval, 5*time.Minute)
+	if err != nil {
+		return "", err
+	}
+	if task.Status != paperless.TaskSuccess {
+		return "", fmt.Errorf("consumption failed: %s", task.Result)
+	}
+	return client.DocumentURL(task.DocumentID), nil
+}
+
+// healthInterval returns how often Paperless is pinged so that /readyz
+// notices an outage within readyTimeout.
+func healthInterval(readyTimeout time.Duration) time.Duration {
+	return min(max(readyTimeout/3, time.Second), time.Minute)
+}
+
+// endpoints holds the HTTP servers of a watch run, one per listen address,
+// so endpoints configured on the same address share a server.
+type endpoints map[string]*server.Server
+
+// at returns the server for addr, creating it if necessary.
+func (e endpoints) at(addr string) *server.Server {
+	srv, ok := e[addr]
+	if !ok {
+		srv = server.New(addr, nil)
+		e[addr] = srv
+	}
+	return srv
+}
+
+// start starts all servers.
+func (e endpoints) start() error {
+	for _, srv := range e {
+		if err := srv.Start(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shutdown stops all servers.
+func (e endpoints) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, srv := range e {
+		srv.Shutdown(ctx)
+	}
+}
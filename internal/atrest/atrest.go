@@ -0,0 +1,197 @@
+// Package atrest encrypts files kept on disk after or instead of their
+// upload, such as the processed and failed folders, with AES-256-GCM.
+//
+// An encrypted file starts with a magic string and a random nonce prefix,
+// followed by chunks of at most chunkSize bytes, each sealed with a nonce
+// made of the prefix and the chunk number. The last chunk is marked in its
+// additional data, so truncated files are detected.
+package atrest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Suffix is appended to the names of encrypted files.
+const Suffix = ".enc"
+
+const (
+	magic     = "PUENC1\n"
+	chunkSize = 64 << 10
+	prefixLen = 8
+)
+
+// ErrInvalid is returned for files that are not encrypted with the key or
+// were modified.
+var ErrInvalid = errors.New("not encrypted with this key or corrupted")
+
+// LoadKey reads a 32 byte key, hex encoded as created by
+// "openssl rand -hex 32", from path.
+func LoadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%s does not hold 64 hex characters", path)
+	}
+	return key, nil
+}
+
+// Encrypt writes the encrypted content of r to w.
+func Encrypt(key []byte, w io.Writer, r io.Reader) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, prefixLen)
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, magic); err != nil {
+		return err
+	}
+	if _, err := w.Write(prefix); err != nil {
+		return err
+	}
+	buf := make([]byte, chunkSize)
+	// A chunk is only sealed once the next read shows whether it is the
+	// last one.
+	n, err := io.ReadFull(r, buf)
+	for counter := uint32(0); ; counter++ {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		chunk := append([]byte(nil), buf[:n]...)
+		if !last {
+			n, err = io.ReadFull(r, buf)
+			last = err == io.EOF
+		}
+		if _, werr := w.Write(aead.Seal(nil, nonce(prefix, counter), chunk, final(last))); werr != nil {
+			return werr
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// Decrypt writes the decrypted content of r to w.
+func Decrypt(key []byte, w io.Writer, r io.Reader) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, len(magic)+prefixLen)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(magic)]) != magic {
+		return ErrInvalid
+	}
+	prefix := header[len(magic):]
+	buf := make([]byte, chunkSize+aead.Overhead())
+	n, err := io.ReadFull(r, buf)
+	for counter := uint32(0); ; counter++ {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := err != nil
+		sealed := append([]byte(nil), buf[:n]...)
+		if !last {
+			n, err = io.ReadFull(r, buf)
+			last = err == io.EOF
+		}
+		plain, openErr := aead.Open(nil, nonce(prefix, counter), sealed, final(last))
+		if openErr != nil {
+			return ErrInvalid
+		}
+		if _, err := w.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// EncryptFile encrypts src into dst and removes src. dst is written under a
+// temporary name first, so it is complete once it exists.
+func EncryptFile(key []byte, src, dst string) error {
+	if err := EncryptCopy(key, src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// EncryptCopy encrypts src into dst like EncryptFile, keeping src.
+func EncryptCopy(key []byte, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dst, func(w io.Writer) error { return Encrypt(key, w, in) })
+}
+
+// DecryptFile decrypts src into dst, keeping src.
+func DecryptFile(key []byte, src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := writeFile(dst, func(w io.Writer) error { return Decrypt(key, w, in) }); err != nil {
+		return fmt.Errorf("failed to decrypt %s: %w", src, err)
+	}
+	return nil
+}
+
+// writeFile writes path with write, removing the partial file on failure.
+func writeFile(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.partial")
+	if err != nil {
+		return err
+	}
+	err = write(tmp)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(prefix []byte, counter uint32) []byte {
+	n := make([]byte, 12)
+	copy(n, prefix)
+	binary.BigEndian.PutUint32(n[prefixLen:], counter)
+	return n
+}
+
+func final(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
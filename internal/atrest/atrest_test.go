@@ -0,0 +1,68 @@
+package atrest
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	for _, size := range []int{0, 10, chunkSize, 2*chunkSize + 123} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		var sealed bytes.Buffer
+		assert.NoError(t, Encrypt(key, &sealed, bytes.NewReader(plain)))
+
+		var out bytes.Buffer
+		assert.NoError(t, Decrypt(key, &out, bytes.NewReader(sealed.Bytes())), size)
+		assert.True(t, bytes.Equal(plain, out.Bytes()), size)
+
+		wrong := bytes.Repeat([]byte{8}, 32)
+		assert.True(t, errors.Is(Decrypt(wrong, &out, bytes.NewReader(sealed.Bytes())), ErrInvalid))
+		if size > chunkSize {
+			// Cut off after the first chunk.
+			truncated := sealed.Bytes()[:len(magic)+prefixLen+chunkSize+16]
+			assert.True(t, errors.Is(Decrypt(key, &out, bytes.NewReader(truncated)), ErrInvalid))
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f\n"), 0600))
+	key, err := LoadKey(keyFile)
+	assert.NoError(t, err)
+	assert.Len(t, key, 32)
+	assert.NoError(t, os.WriteFile(keyFile, []byte("abcd"), 0600))
+	_, err = LoadKey(keyFile)
+	assert.Error(t, err)
+
+	src := filepath.Join(dir, "scan.pdf")
+	assert.NoError(t, os.WriteFile(src, []byte("%PDF-1.4"), 0644))
+	assert.NoError(t, EncryptFile(key, src, src+Suffix))
+	assert.NoFileExists(t, src)
+	sealed, _ := os.ReadFile(src + Suffix)
+	assert.NotContains(t, string(sealed), "%PDF")
+
+	plain := filepath.Join(dir, "restored.pdf")
+	assert.NoError(t, DecryptFile(key, src+Suffix, plain))
+	data, _ := os.ReadFile(plain)
+	assert.Equal(t, "%PDF-1.4", string(data))
+
+	assert.Error(t, DecryptFile(bytes.Repeat([]byte{1}, 32), src+Suffix, filepath.Join(dir, "bad.pdf")))
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 3, "failed decryption leaves no files behind")
+
+	assert.NoError(t, EncryptCopy(key, plain, filepath.Join(dir, "copy.pdf"+Suffix)))
+	assert.FileExists(t, plain)
+	assert.NoError(t, DecryptFile(key, filepath.Join(dir, "copy.pdf"+Suffix), filepath.Join(dir, "copy.pdf")))
+	data, _ = os.ReadFile(filepath.Join(dir, "copy.pdf"))
+	assert.Equal(t, "%PDF-1.4", string(data))
+}
@@ -0,0 +1,177 @@
+// Package audit writes an append-only JSONL trail of the lifecycle of every
+// file handled by the watcher. The records are chained by their hashes, and
+// optionally signed, so Verify can tell whether the trail was modified.
+package audit
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// Record is a single line of the audit log.
+type Record struct {
+	Time time.Time `json:"time"`
+	// Event is the watcher event type, e.g. "detected" or "consumed".
+	Event string `json:"event"`
+	// ID correlates the records of one file.
+	ID         string `json:"id"`
+	File       string `json:"file"`
+	Folder     string `json:"folder,omitempty"`
+	Attempt    int    `json:"attempt,omitempty"`
+	SHA256     string `json:"sha256,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	TaskID     string `json:"task_id,omitempty"`
+	DocumentID int    `json:"document_id,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Dest       string `json:"dest,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Seq numbers the records of the chain, Prev is the hash of the line
+	// before and Hash that of this record. Sig is the base64 Ed25519
+	// signature of Hash if the log is signed.
+	Seq  uint64 `json:"seq,omitempty"`
+	Prev string `json:"prev,omitempty"`
+	Hash string `json:"hash,omitempty"`
+	Sig  string `json:"sig,omitempty"`
+}
+
+// Log appends records to an audit file. The chain continues from the last
+// record in the file, so only one process may write to a log.
+type Log struct {
+	mu     sync.Mutex
+	f      *os.File
+	key    ed25519.PrivateKey
+	seq    uint64
+	prev   string
+	closed bool
+}
+
+// Open opens the audit log at path for appending, creating it and its
+// directory if necessary. If key is set, every record is signed with it.
+func Open(path string, key ed25519.PrivateKey) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	l := &Log{f: f, key: key}
+	last, before, terminated, err := tail(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	if len(last) > 0 {
+		rec, chained, hash := lineHash(last)
+		l.prev, l.seq = hash, rec.Seq
+		// The next record is chained to a line cut short, and continues
+		// the sequence of the record before it.
+		if !chained {
+			if rec, chained, _ := lineHash(before); chained {
+				l.seq = rec.Seq
+			}
+		}
+	}
+	// Finish a line cut short by a crash, so the next record starts on a
+	// line of its own.
+	if !terminated {
+		if _, err := f.Write([]byte{'\n'}); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to write audit log: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Write appends r to the log, chained to the record before it.
+func (l *Log) Write(r Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return os.ErrClosed
+	}
+	r.Seq = l.seq + 1
+	r.Prev = l.prev
+	hash, err := chainHash(r)
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	if l.key != nil {
+		r.Sig = base64.StdEncoding.EncodeToString(ed25519.Sign(l.key, []byte(hash)))
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	// A single write keeps lines intact.
+	if _, err := l.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	l.seq, l.prev = r.Seq, hash
+	return nil
+}
+
+// Handle records a watcher event. It is meant to be registered with
+// Watcher.OnEvent; progress events and those not about a file are not
+// recorded.
+func (l *Log) Handle(e watcher.Event) {
+	switch e.Type {
+	case watcher.EventUploadProgress, watcher.EventWatching, watcher.EventCircuitOpened, watcher.EventCircuitClosed:
+		return
+	}
+	r := Record{
+		Time:       e.Time,
+		Event:      string(e.Type),
+		ID:         e.ID,
+		File:       e.Path,
+		Folder:     e.Folder,
+		Attempt:    e.Attempt,
+		SHA256:     e.Checksum,
+		Size:       e.Total,
+		TaskID:     e.TaskID,
+		DocumentID: e.DocumentID,
+		URL:        e.URL,
+		Dest:       e.Dest,
+	}
+	if e.Err != nil {
+		r.Error = e.Err.Error()
+	}
+	if err := l.Write(r); err != nil && err != os.ErrClosed {
+		logging.Errorf("Failed to write audit log: %v", err)
+	}
+}
+
+// Close closes the log. Later records are dropped.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return l.f.Close()
+}
+
+// Read calls fn for every record of the audit log in r. Lines that are not
+// valid records are skipped.
+func Read(r io.Reader, fn func(Record)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+	for scanner.Scan() {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		fn(rec)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,174 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "audit.jsonl")
+	l, err := Open(path, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, e := range []watcher.Event{
+		{Type: watcher.EventWatching, Time: now},
+		{Type: watcher.EventDetected, Time: now, ID: "abc", Folder: "consume", Path: "consume/invoice.pdf"},
+		{Type: watcher.EventUploadProgress, Time: now, ID: "abc", Path: "consume/invoice.pdf", Sent: 10},
+		{Type: watcher.EventHashed, Time: now, ID: "abc", Path: "consume/invoice.pdf", Checksum: "deadbeef"},
+		{Type: watcher.EventRetryScheduled, Time: now, ID: "abc", Path: "consume/invoice.pdf", Err: errors.New("timeout")},
+		{Type: watcher.EventUploaded, Time: now, ID: "abc", Path: "consume/invoice.pdf", Attempt: 1, Total: 2048, TaskID: "task-1"},
+		{Type: watcher.EventConsumed, Time: now, ID: "abc", Path: "consume/invoice.pdf", TaskID: "task-1", DocumentID: 42},
+	} {
+		l.Handle(e)
+	}
+	assert.NoError(t, l.Close())
+	// Records after closing are dropped.
+	l.Handle(watcher.Event{Type: watcher.EventDeleted, ID: "abc"})
+
+	f, err := os.Open(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	var records []Record
+	assert.NoError(t, Read(f, func(r Record) {
+		assert.NotEmpty(t, r.Hash)
+		r.Seq, r.Prev, r.Hash = 0, "", ""
+		records = append(records, r)
+	}))
+	assert.Equal(t, []Record{
+		{Time: now, Event: "detected", ID: "abc", File: "consume/invoice.pdf", Folder: "consume"},
+		{Time: now, Event: "hashed", ID: "abc", File: "consume/invoice.pdf", SHA256: "deadbeef"},
+		{Time: now, Event: "retry_scheduled", ID: "abc", File: "consume/invoice.pdf", Error: "timeout"},
+		{Time: now, Event: "uploaded", ID: "abc", File: "consume/invoice.pdf", Attempt: 1, Size: 2048, TaskID: "task-1"},
+		{Time: now, Event: "consumed", ID: "abc", File: "consume/invoice.pdf", TaskID: "task-1", DocumentID: 42},
+	}, records)
+
+	// Reopening appends.
+	l, err = Open(path, nil)
+	assert.NoError(t, err)
+	l.Handle(watcher.Event{Type: watcher.EventDeleted, Time: now, ID: "abc", Path: "consume/invoice.pdf"})
+	assert.NoError(t, l.Close())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"event":"deleted"`)
+	v, err := Verify(strings.NewReader(string(data)), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Verification{Records: 6, LastSeq: 6, LastHash: v.LastHash}, v)
+}
+
+func TestVerify(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	// Records of versions without chaining, the last one cut short.
+	assert.NoError(t, os.WriteFile(path, []byte(`{"event":"detected","id":"old"}`+"\n"+`{"event":"upl`), 0640))
+	for i := 0; i < 2; i++ {
+		l, err := Open(path, key)
+		assert.NoError(t, err)
+		for _, id := range []string{"a", "b"} {
+			assert.NoError(t, l.Write(Record{Event: "detected", ID: id, File: id + ".pdf"}))
+		}
+		assert.NoError(t, l.Close())
+	}
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	assert.Len(t, lines, 6)
+
+	pub := key.Public().(ed25519.PublicKey)
+	v, err := Verify(strings.NewReader(string(data)), pub)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, v.Records)
+	assert.Equal(t, 4, v.Signed)
+	assert.Equal(t, 2, v.Unchained)
+	assert.Equal(t, uint64(4), v.LastSeq)
+
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	_, err = Verify(strings.NewReader(string(data)), otherPub)
+	assert.ErrorIs(t, err, ErrTampered)
+	assert.ErrorContains(t, err, "line 3 has no valid signature")
+
+	verify := func(lines []string) error {
+		_, err := Verify(strings.NewReader(strings.Join(lines, "\n")+"\n"), pub)
+		return err
+	}
+	changed := slices.Clone(lines)
+	changed[3] = strings.Replace(changed[3], "b.pdf", "c.pdf", 1)
+	assert.ErrorContains(t, verify(changed), "line 4 does not match its hash")
+	assert.ErrorContains(t, verify(slices.Delete(slices.Clone(lines), 3, 4)), "line 4 does not follow the line before it")
+	assert.ErrorContains(t, verify(slices.Delete(slices.Clone(lines), 1, 2)), "line 2 does not follow the line before it")
+	assert.ErrorContains(t, verify(append(slices.Clone(lines), `{"event":"deleted"}`)), "line 7 is not a chained record")
+}
+
+func TestVerifyAfterCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := Open(path, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Write(Record{Event: "detected", ID: "a"}))
+	assert.NoError(t, l.Close())
+	// A crash cuts the second record short.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0640)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"seq":2,"event":"uplo`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	l, err = Open(path, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Write(Record{Event: "uploaded", ID: "a"}))
+	assert.NoError(t, l.Close())
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	v, err := Verify(strings.NewReader(string(data)), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, v.Records)
+	assert.Equal(t, 1, v.Truncated)
+	assert.Equal(t, uint64(2), v.LastSeq)
+
+	// Only a record chained to it may follow the line cut short.
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	_, err = Verify(strings.NewReader(strings.Join([]string{lines[0], lines[1], `{"event":"fake"`, lines[2]}, "\n")), nil)
+	assert.ErrorContains(t, err, "line 3 is not a chained record")
+	_, err = Verify(strings.NewReader(strings.Join([]string{lines[0], `{"event":"fake"`, lines[2]}, "\n")), nil)
+	assert.ErrorContains(t, err, "line 3 does not follow the line before it")
+}
+
+func TestLoadKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	assert.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	assert.NoError(t, err)
+	privPath := filepath.Join(dir, "audit.key")
+	pubPath := filepath.Join(dir, "audit.pub")
+	assert.NoError(t, os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600))
+	assert.NoError(t, os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644))
+
+	loaded, err := LoadSigningKey(privPath)
+	assert.NoError(t, err)
+	assert.True(t, priv.Equal(loaded))
+	for _, path := range []string{privPath, pubPath} {
+		loadedPub, err := LoadVerifyKey(path)
+		assert.NoError(t, err)
+		assert.True(t, pub.Equal(loadedPub))
+	}
+	_, err = LoadSigningKey(pubPath)
+	assert.Error(t, err)
+}
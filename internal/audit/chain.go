@@ -0,0 +1,190 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The records of a log are chained: each one carries its sequence number,
+// the hash of the line before it and its own hash, the SHA-256 of the
+// record without Hash and Sig, prefixed by Prev. Removing, reordering or
+// changing a record breaks the chain from that record on. Records of
+// versions without chaining hash as their whole line, and so do lines cut
+// short by a crash, which the next record is chained to.
+
+// ErrTampered is returned by Verify when the log was modified.
+var ErrTampered = errors.New("audit log was modified")
+
+// maxLine is the longest line read from a log.
+const maxLine = 1024 * 1024
+
+// chainHash returns the hash of r, ignoring its Hash and Sig.
+func chainHash(r Record) (string, error) {
+	r.Hash, r.Sig = "", ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(r.Prev), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lineHash returns the hash a line contributes to the chain: the Hash of a
+// chained record, or the SHA-256 of anything else.
+func lineHash(line []byte) (rec Record, chained bool, hash string) {
+	if err := json.Unmarshal(line, &rec); err == nil && rec.Hash != "" {
+		return rec, true, rec.Hash
+	}
+	sum := sha256.Sum256(line)
+	return rec, false, hex.EncodeToString(sum[:])
+}
+
+// tail returns the last line of f, the line before it, and whether f ends
+// with a newline.
+func tail(f *os.File) (line, before []byte, terminated bool, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	start := max(info.Size()-2*maxLine, 0)
+	buf := make([]byte, info.Size()-start)
+	if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+		return nil, nil, false, err
+	}
+	terminated = len(buf) == 0 || buf[len(buf)-1] == '\n'
+	buf = bytes.TrimRight(buf, "\n")
+	line = buf
+	if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+		line, before = buf[i+1:], buf[:i]
+		if i := bytes.LastIndexByte(before, '\n'); i >= 0 {
+			before = before[i+1:]
+		}
+	}
+	return line, before, terminated, nil
+}
+
+// Verification summarizes a verified log.
+type Verification struct {
+	// Records is the number of chained records, Signed the number of
+	// those with a valid signature.
+	Records int
+	Signed  int
+	// Unchained is the number of lines before the first chained record,
+	// written by versions without chaining.
+	Unchained int
+	// Truncated is the number of lines after it that a crash cut short.
+	Truncated int
+	// LastSeq and LastHash identify the last record. Keeping them
+	// elsewhere lets a later verification detect removed trailing records.
+	LastSeq  uint64
+	LastHash string
+}
+
+// Verify checks the chain of the log in r. If pub is set, every chained
+// record must be signed with its private key. The returned error wraps
+// ErrTampered and names the first offending line.
+func Verify(r io.Reader, pub ed25519.PublicKey) (Verification, error) {
+	var v Verification
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+	prev := ""
+	// truncated is set after a line cut short, which only a chained record
+	// may follow.
+	truncated := false
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		rec, chained, hash := lineHash(line)
+		if !chained {
+			switch {
+			case v.Records == 0:
+				v.Unchained++
+			case !truncated && !json.Valid(line):
+				// Open chains the next record to a line cut short.
+				v.Truncated++
+				truncated = true
+			default:
+				return v, fmt.Errorf("%w: line %d is not a chained record", ErrTampered, n)
+			}
+			prev = hash
+			continue
+		}
+		truncated = false
+		if rec.Prev != prev {
+			return v, fmt.Errorf("%w: line %d does not follow the line before it", ErrTampered, n)
+		}
+		if v.Records > 0 && rec.Seq != v.LastSeq+1 {
+			return v, fmt.Errorf("%w: line %d has sequence number %d, expected %d", ErrTampered, n, rec.Seq, v.LastSeq+1)
+		}
+		if want, err := chainHash(rec); err != nil || want != hash {
+			return v, fmt.Errorf("%w: line %d does not match its hash", ErrTampered, n)
+		}
+		if pub != nil {
+			sig, err := base64.StdEncoding.DecodeString(rec.Sig)
+			if err != nil || !ed25519.Verify(pub, []byte(hash), sig) {
+				return v, fmt.Errorf("%w: line %d has no valid signature", ErrTampered, n)
+			}
+			v.Signed++
+		}
+		v.Records++
+		v.LastSeq = rec.Seq
+		v.LastHash = hash
+		prev = hash
+	}
+	return v, scanner.Err()
+}
+
+// LoadSigningKey reads an Ed25519 private key in PEM encoded PKCS #8 form,
+// as created by "openssl genpkey -algorithm ed25519".
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	key, err := loadPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s does not hold an Ed25519 private key", path)
+	}
+	return priv, nil
+}
+
+// LoadVerifyKey reads an Ed25519 public key in PEM encoded PKIX form, as
+// created by "openssl pkey -pubout", or derives it from a private key.
+func LoadVerifyKey(path string) (ed25519.PublicKey, error) {
+	key, err := loadPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k.Public().(ed25519.PublicKey), nil
+	}
+	return nil, fmt.Errorf("%s does not hold an Ed25519 key", path)
+}
+
+func loadPEM(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", path)
+	}
+	if block.Type == "PUBLIC KEY" {
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
@@ -0,0 +1,292 @@
+// Package backfill imports large directories of historical documents.
+// Files are uploaded with bounded concurrency and rate, files whose content
+// is already in Paperless are skipped, and every result is checkpointed in a
+// journal, so an interrupted backfill resumes where it stopped.
+package backfill
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/docindex"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// File is a file to backfill.
+type File struct {
+	// Path is the path to open, Rel the path relative to the backfilled
+	// directory, which identifies the file in the journal.
+	Path    string
+	Rel     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Scan lists the files below dir, sorted by path. Hidden files and
+// directories and the files the watcher leaves alone, such as failure
+// records, are left out.
+func Scan(dir string) ([]File, error) {
+	var files []File
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || watcher.IsSidecar(path) || watcher.IsPartial(path) || watcher.IsSyncthingArtifact(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{Path: path, Rel: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].Rel < files[j].Rel })
+	return files, err
+}
+
+// Progress is the state of a running backfill.
+type Progress struct {
+	// Total is the number of files, Done the number processed so far,
+	// including the Resumed ones done by earlier runs.
+	Total, Done, Resumed         int
+	Uploaded, Duplicates, Failed int
+}
+
+// Backfill uploads the files of a directory.
+type Backfill struct {
+	Client  *paperless.Client
+	Options paperless.UploadOptions
+	// OptionsFor, if set, returns the upload options of a file instead of
+	// Options.
+	OptionsFor func(File) (paperless.UploadOptions, error)
+	Journal    *Journal
+	// Concurrency is the number of concurrent uploads, at least one.
+	Concurrency int
+	// Rate limits the uploads per second. Zero leaves them unlimited.
+	Rate float64
+	// SkipDuplicates skips files whose content is already in Paperless or
+	// was uploaded from another file of the backfill.
+	SkipDuplicates bool
+	// Index, if set, is asked for the documents in Paperless instead of
+	// the server.
+	Index *docindex.Index
+	// Progress, if set, is called after every file.
+	Progress func(Progress)
+
+	mu       sync.Mutex
+	progress Progress
+	// claimed maps the checksums uploaded or being uploaded to the file.
+	claimed map[string]string
+}
+
+// Run uploads the files that the journal does not record as done and
+// returns the records of all files, in the order of files. If ctx is
+// cancelled, the uploads in progress complete, the remaining files are left
+// out of the records and ctx.Err() is returned.
+func (b *Backfill) Run(ctx context.Context, files []File) ([]Record, error) {
+	b.progress = Progress{Total: len(files)}
+	b.claimed = b.Journal.uploaded()
+	records := make([]Record, len(files))
+	var pending []int
+	for i, f := range files {
+		if r, ok := b.Journal.Done(f); ok {
+			records[i] = r
+			b.progress.Done++
+			b.progress.Resumed++
+			continue
+		}
+		pending = append(pending, i)
+	}
+	b.mu.Lock()
+	b.report()
+	b.mu.Unlock()
+
+	var limit <-chan time.Time
+	if b.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / b.Rate))
+		defer ticker.Stop()
+		limit = ticker.C
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range max(b.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				records[i] = b.process(ctx, files[i], limit)
+			}
+		}()
+	}
+feed:
+	for _, i := range pending {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	var done []Record
+	for _, r := range records {
+		if r.Path != "" {
+			done = append(done, r)
+		}
+	}
+	return done, ctx.Err()
+}
+
+// process uploads f unless it is a duplicate and records the result. Files
+// interrupted by the cancellation of ctx are not recorded.
+func (b *Backfill) process(ctx context.Context, f File, limit <-chan time.Time) Record {
+	r := Record{Path: f.Rel, Size: f.Size, ModTime: f.ModTime}
+	if err := b.upload(ctx, f, &r, limit); err != nil {
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			return Record{}
+		}
+		r.Status, r.Error = StatusFailed, err.Error()
+	}
+	r.Time = time.Now()
+	if err := b.Journal.Append(r); err != nil && r.Status != StatusFailed {
+		r.Status, r.Error = StatusFailed, "failed to write the journal: "+err.Error()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.progress.Done++
+	switch r.Status {
+	case StatusUploaded:
+		b.progress.Uploaded++
+	case StatusDuplicate:
+		b.progress.Duplicates++
+	default:
+		b.progress.Failed++
+	}
+	b.report()
+	return r
+}
+
+func (b *Backfill) upload(ctx context.Context, f File, r *Record, limit <-chan time.Time) error {
+	sum, err := checksum(f.Path)
+	if err != nil {
+		return err
+	}
+	r.Checksum = sum
+	if b.SkipDuplicates {
+		if other, ok := b.claim(sum, f.Rel); !ok {
+			r.Status, r.DuplicateOf = StatusDuplicate, other
+			return nil
+		}
+		id, err := b.known(sum)
+		if err != nil {
+			b.release(sum)
+			return err
+		}
+		if id != 0 {
+			r.Status, r.DocumentID = StatusDuplicate, id
+			return nil
+		}
+	}
+	opts := b.Options
+	if b.OptionsFor != nil {
+		if opts, err = b.OptionsFor(f); err != nil {
+			b.release(sum)
+			return err
+		}
+	}
+	if limit != nil {
+		select {
+		case <-limit:
+		case <-ctx.Done():
+			b.release(sum)
+			return ctx.Err()
+		}
+	}
+	taskID, err := b.Client.UploadFile(f.Path, opts)
+	if err != nil {
+		b.release(sum)
+		return err
+	}
+	r.Status, r.TaskID = StatusUploaded, taskID
+	return nil
+}
+
+// known returns the ID of a document in Paperless whose original has the
+// checksum sum, zero if there is none.
+func (b *Backfill) known(sum string) (int, error) {
+	if b.Index != nil {
+		docs, err := b.Index.Lookup(sum)
+		if err != nil || len(docs) == 0 {
+			return 0, err
+		}
+		return docs[0].ID, nil
+	}
+	docs, err := b.Client.ListDocuments(paperless.DocumentFilter{Checksum: sum, Limit: 1})
+	if err != nil || len(docs) == 0 {
+		return 0, err
+	}
+	return docs[0].ID, nil
+}
+
+// claim reserves sum for the file rel, or returns the file that has it.
+func (b *Backfill) claim(sum, rel string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if other, ok := b.claimed[sum]; ok {
+		return other, false
+	}
+	b.claimed[sum] = rel
+	return "", true
+}
+
+func (b *Backfill) release(sum string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.claimed, sum)
+}
+
+// report passes the progress to b.Progress. b.mu must be held, so the
+// calls are serialized.
+func (b *Backfill) report() {
+	if b.Progress != nil {
+		b.Progress(b.progress)
+	}
+}
+
+// checksum returns the MD5 checksum Paperless keeps of original files.
+func checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
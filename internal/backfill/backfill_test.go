@@ -0,0 +1,173 @@
+package backfill
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/state"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackfill(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"2019/a.pdf":             "first",
+		"2019/copy-of-a.pdf":     "first",
+		"2020/known.pdf":         "already in paperless",
+		"2020/flaky.pdf":         "flaky",
+		".DS_Store":              "hidden",
+		"2020/a.pdf.failed.json": "{}",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	known := md5.Sum([]byte("already in paperless"))
+
+	var (
+		mu       sync.Mutex
+		uploaded []string
+		flaky    = true
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/documents/":
+			if r.URL.Query().Get("checksum__iexact") == hex.EncodeToString(known[:]) {
+				w.Write([]byte(`{"results": [{"id": 7}]}`))
+				return
+			}
+			w.Write([]byte(`{"results": []}`))
+		case "/api/documents/post_document/":
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			_, header, _ := r.FormFile("document")
+			mu.Lock()
+			defer mu.Unlock()
+			if header.Filename == "flaky.pdf" && flaky {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			uploaded = append(uploaded, header.Filename)
+			w.Write([]byte(`"task-` + header.Filename + `"`))
+		}
+	}))
+	defer server.Close()
+
+	scanned, err := Scan(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, f := range scanned {
+		names = append(names, f.Rel)
+	}
+	assert.Equal(t, []string{"2019/a.pdf", "2019/copy-of-a.pdf", "2020/flaky.pdf", "2020/known.pdf"}, names)
+
+	statePath := filepath.Join(t.TempDir(), "state", "backfill.jsonl")
+	run := func() ([]Record, Progress) {
+		journal, err := OpenJournal(statePath)
+		assert.NoError(t, err)
+		defer journal.Close()
+		var last Progress
+		b := &Backfill{
+			Client:         paperless.NewClient(server.URL, "test_key"),
+			Journal:        journal,
+			Concurrency:    1,
+			Rate:           1000,
+			SkipDuplicates: true,
+			Progress:       func(p Progress) { last = p },
+		}
+		records, err := b.Run(context.Background(), scanned)
+		assert.NoError(t, err)
+		return records, last
+	}
+
+	records, progress := run()
+	assert.Equal(t, Progress{Total: 4, Done: 4, Uploaded: 1, Duplicates: 2, Failed: 1}, progress)
+	assert.Equal(t, StatusUploaded, records[0].Status)
+	assert.Equal(t, "task-a.pdf", records[0].TaskID)
+	assert.Equal(t, StatusDuplicate, records[1].Status)
+	assert.Equal(t, "2019/a.pdf", records[1].DuplicateOf)
+	assert.Equal(t, StatusFailed, records[2].Status)
+	assert.Contains(t, records[2].Error, "502")
+	assert.Equal(t, StatusDuplicate, records[3].Status)
+	assert.Equal(t, 7, records[3].DocumentID)
+	assert.Equal(t, []string{"a.pdf"}, uploaded)
+
+	// A crash may leave a partial line, which is dropped on resume.
+	f, err := os.OpenFile(statePath, os.O_APPEND|os.O_WRONLY, 0)
+	assert.NoError(t, err)
+	f.WriteString(`{"path": "2020/fl`)
+	f.Close()
+
+	// The next run only retries the failed file.
+	flaky = false
+	records, progress = run()
+	assert.Equal(t, Progress{Total: 4, Done: 4, Resumed: 3, Uploaded: 1}, progress)
+	assert.Equal(t, []string{"a.pdf", "flaky.pdf"}, uploaded)
+	assert.Equal(t, StatusUploaded, records[2].Status)
+
+	// Changed files are uploaded again.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "2019/a.pdf"), []byte("edited"), 0644))
+	scanned, _ = Scan(dir)
+	_, progress = run()
+	assert.Equal(t, 1, progress.Uploaded)
+	assert.Equal(t, 3, progress.Resumed)
+
+	var report strings.Builder
+	assert.NoError(t, WriteReport(&report, records))
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	assert.Len(t, lines, 5)
+	assert.Equal(t, "path,status,size,checksum,task_id,document_id,duplicate_of,error,time", lines[0])
+	assert.Contains(t, lines[4], "2020/known.pdf,duplicate,20,"+hex.EncodeToString(known[:])+",,7,,,")
+}
+
+func TestRunCancelled(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a.pdf"), []byte("a"), 0644))
+	journal, err := OpenJournal(filepath.Join(dir, ".state.jsonl"))
+	assert.NoError(t, err)
+	defer journal.Close()
+	scanned, err := Scan(dir)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b := &Backfill{Client: paperless.NewClient("http://127.0.0.1:0", "test_key"), Journal: journal, Rate: 0.001}
+	records, err := b.Run(ctx, scanned)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, records)
+	_, ok := journal.Done(scanned[0])
+	assert.False(t, ok)
+}
+
+func TestStoreJournal(t *testing.T) {
+	store, err := state.Open(state.BackendSQLite, filepath.Join(t.TempDir(), "state.db"))
+	assert.NoError(t, err)
+	defer store.Close()
+	journal, err := OpenStoreJournal(store, "backfill:/scans")
+	assert.NoError(t, err)
+	f := File{Rel: "2019/a.pdf", Size: 5, ModTime: time.Unix(1700000000, 0)}
+	assert.NoError(t, journal.Append(Record{Path: f.Rel, Size: f.Size, ModTime: f.ModTime, Status: StatusUploaded}))
+	assert.NoError(t, journal.Close())
+
+	// The next run finds the file done, unless it changed.
+	journal, err = OpenStoreJournal(store, "backfill:/scans")
+	assert.NoError(t, err)
+	_, done := journal.Done(f)
+	assert.True(t, done)
+	f.Size = 6
+	_, done = journal.Done(f)
+	assert.False(t, done)
+	other, err := OpenStoreJournal(store, "backfill:/other")
+	assert.NoError(t, err)
+	_, done = other.Done(File{Rel: "2019/a.pdf", Size: 5, ModTime: time.Unix(1700000000, 0)})
+	assert.False(t, done)
+}
@@ -0,0 +1,184 @@
+package backfill
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/state"
+)
+
+// Status is the outcome for a file.
+type Status string
+
+const (
+	StatusUploaded  Status = "uploaded"
+	StatusDuplicate Status = "duplicate"
+	StatusFailed    Status = "failed"
+)
+
+// Record is the outcome for a file, as kept in the journal.
+type Record struct {
+	// Path is relative to the backfilled directory.
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Checksum string    `json:"checksum,omitempty"`
+	Status   Status    `json:"status"`
+	TaskID   string    `json:"task_id,omitempty"`
+	// DocumentID is the Paperless document a duplicate matches, or
+	// DuplicateOf the file of the backfill with the same content.
+	DocumentID  int       `json:"document_id,omitempty"`
+	DuplicateOf string    `json:"duplicate_of,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// Journal checkpoints a backfill: an append-only file with one JSON record
+// per processed file, or a bucket of a state store. The last record of a
+// file counts.
+type Journal struct {
+	mu      sync.Mutex
+	f       *os.File
+	store   state.Store
+	bucket  string
+	records map[string]Record
+}
+
+// OpenStoreJournal opens the journal kept in bucket of store, which the
+// caller closes.
+func OpenStoreJournal(store state.Store, bucket string) (*Journal, error) {
+	j := &Journal{store: store, bucket: bucket, records: make(map[string]Record)}
+	err := store.ForEach(bucket, func(key string, value []byte) error {
+		var r Record
+		if err := json.Unmarshal(value, &r); err != nil {
+			return fmt.Errorf("invalid journal record %s: %v", key, err)
+		}
+		j.records[r.Path] = r
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// OpenJournal opens the journal at path, creating it if necessary, and
+// reads the records of earlier runs.
+func OpenJournal(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{f: f, records: make(map[string]Record)}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var end int64
+	for scanner.Scan() {
+		var r Record
+		// A line cut short by a crash is dropped and overwritten.
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			break
+		}
+		j.records[r.Path] = r
+		end += int64(len(scanner.Bytes())) + 1
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(end); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// Done returns the record of f if an earlier run uploaded it or found it to
+// be a duplicate, and f has not changed since.
+func (j *Journal) Done(f File) (Record, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	r, ok := j.records[f.Rel]
+	if !ok || r.Status == StatusFailed || r.Size != f.Size || !r.ModTime.Equal(f.ModTime) {
+		return Record{}, false
+	}
+	return r, true
+}
+
+// uploaded maps the checksums of the uploaded files to their paths.
+func (j *Journal) uploaded() map[string]string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	sums := make(map[string]string)
+	for _, r := range j.records {
+		if r.Status == StatusUploaded && r.Checksum != "" {
+			sums[r.Checksum] = r.Path
+		}
+	}
+	return sums
+}
+
+// Append records r.
+func (j *Journal) Append(r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.store != nil {
+		err = j.store.Put(j.bucket, r.Path, data)
+	} else {
+		_, err = j.f.Write(append(data, '\n'))
+	}
+	if err != nil {
+		return err
+	}
+	j.records[r.Path] = r
+	return nil
+}
+
+// Close closes the journal file. Journals in a store leave it open.
+func (j *Journal) Close() error {
+	if j.f == nil {
+		return nil
+	}
+	if err := j.f.Sync(); err != nil {
+		j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
+
+// WriteReport writes records as CSV with a header line.
+func WriteReport(w io.Writer, records []Record) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"path", "status", "size", "checksum", "task_id", "document_id", "duplicate_of", "error", "time"})
+	for _, r := range records {
+		documentID := ""
+		if r.DocumentID != 0 {
+			documentID = strconv.Itoa(r.DocumentID)
+		}
+		out.Write([]string{
+			r.Path, string(r.Status), strconv.FormatInt(r.Size, 10), r.Checksum, r.TaskID,
+			documentID, r.DuplicateOf, r.Error, r.Time.Format(time.RFC3339),
+		})
+	}
+	out.Flush()
+	return out.Error()
+}
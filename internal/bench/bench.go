@@ -0,0 +1,227 @@
+// Package bench measures how fast a Paperless instance ingests documents.
+// Synthetic PDFs are uploaded with bounded concurrency and rate, and the
+// upload time and the time until each consumption task finished are
+// recorded, so that the concurrency and rate of a backfill can be sized.
+package bench
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+)
+
+// defaultPollInterval is how often the consumption tasks are polled.
+const defaultPollInterval = time.Second
+
+// Sample is the result of one document.
+type Sample struct {
+	File string
+	Size int64
+	// Upload is the time the upload request took, Consume the time from
+	// the start of the upload until the consumption task finished.
+	Upload, Consume time.Duration
+	DocumentID      int
+	// Err is set if the upload or the consumption failed.
+	Err error
+}
+
+// Result is the outcome of a benchmark.
+type Result struct {
+	Samples []Sample
+	// Uploaded is the time until the last upload finished, Elapsed the
+	// time until the last consumption task finished.
+	Uploaded, Elapsed time.Duration
+}
+
+// Bench uploads documents and waits for their consumption.
+type Bench struct {
+	Client  *paperless.Client
+	Options paperless.UploadOptions
+	// Concurrency is the number of concurrent uploads, at least one.
+	Concurrency int
+	// Rate limits the uploads per second. Zero leaves them unlimited.
+	Rate float64
+	// TaskTimeout is how long to wait for each consumption task. Zero
+	// skips waiting, measuring the uploads only.
+	TaskTimeout time.Duration
+	// PollInterval is how often the tasks are polled, one second if zero.
+	PollInterval time.Duration
+	// Progress, if set, is called whenever a document is done.
+	Progress func(done, total int)
+}
+
+// Run uploads files and returns the samples in the order of files. If ctx
+// is cancelled, the uploads in progress complete, the remaining files are
+// left out and ctx.Err() is returned.
+func (b *Bench) Run(ctx context.Context, files []string) (Result, error) {
+	interval := b.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	var limit <-chan time.Time
+	if b.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / b.Rate))
+		defer ticker.Stop()
+		limit = ticker.C
+	}
+
+	var (
+		mu       sync.Mutex
+		done     int
+		result   Result
+		samples  = make([]Sample, len(files))
+		started  = make([]bool, len(files))
+		uploads  sync.WaitGroup
+		consumed sync.WaitGroup
+	)
+	start := time.Now()
+	finish := func(i int, s Sample) {
+		mu.Lock()
+		defer mu.Unlock()
+		samples[i] = s
+		done++
+		result.Elapsed = time.Since(start)
+		if b.Progress != nil {
+			b.Progress(done, len(files))
+		}
+	}
+
+	work := make(chan int)
+	for range max(b.Concurrency, 1) {
+		uploads.Add(1)
+		go func() {
+			defer uploads.Done()
+			for i := range work {
+				if limit != nil {
+					select {
+					case <-limit:
+					case <-ctx.Done():
+						continue
+					}
+				}
+				mu.Lock()
+				started[i] = true
+				mu.Unlock()
+				s, taskID := b.upload(files[i])
+				mu.Lock()
+				result.Uploaded = time.Since(start)
+				mu.Unlock()
+				if s.Err != nil || b.TaskTimeout <= 0 {
+					finish(i, s)
+					continue
+				}
+				// The tasks are waited for apart from the uploads, so the
+				// consumption does not hold back the next upload.
+				consumed.Add(1)
+				go func() {
+					defer consumed.Done()
+					finish(i, b.wait(s, taskID, interval))
+				}()
+			}
+		}()
+	}
+feed:
+	for i := range files {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	uploads.Wait()
+	consumed.Wait()
+
+	for i, s := range samples {
+		if started[i] {
+			result.Samples = append(result.Samples, s)
+		}
+	}
+	return result, ctx.Err()
+}
+
+func (b *Bench) upload(file string) (Sample, string) {
+	s := Sample{File: file}
+	if info, err := os.Stat(file); err == nil {
+		s.Size = info.Size()
+	}
+	t := time.Now()
+	taskID, err := b.Client.UploadFile(file, b.Options)
+	s.Upload = time.Since(t)
+	s.Consume = s.Upload
+	if err == nil && taskID == "" {
+		err = errors.New("no consumption task returned by Paperless")
+	}
+	s.Err = err
+	return s, taskID
+}
+
+func (b *Bench) wait(s Sample, taskID string, interval time.Duration) Sample {
+	t := time.Now()
+	task, err := b.Client.WaitForTask(taskID, interval, b.TaskTimeout)
+	s.Consume += time.Since(t)
+	switch {
+	case err != nil:
+		s.Err = err
+	case task.Status != paperless.TaskSuccess:
+		s.Err = errors.New("consumption failed: " + task.Result)
+	default:
+		s.DocumentID = task.DocumentID
+	}
+	return s
+}
+
+// Succeeded returns the samples without an error.
+func (r Result) Succeeded() []Sample {
+	var ok []Sample
+	for _, s := range r.Samples {
+		if s.Err == nil {
+			ok = append(ok, s)
+		}
+	}
+	return ok
+}
+
+// Bytes returns the total size of the succeeded documents.
+func (r Result) Bytes() int64 {
+	var n int64
+	for _, s := range r.Succeeded() {
+		n += s.Size
+	}
+	return n
+}
+
+// Latency summarizes durations.
+type Latency struct {
+	P50, P95, Max time.Duration
+}
+
+// UploadLatency summarizes the upload times of the succeeded documents.
+func (r Result) UploadLatency() Latency {
+	return latency(r.Succeeded(), func(s Sample) time.Duration { return s.Upload })
+}
+
+// ConsumeLatency summarizes the times until the succeeded documents were
+// consumed.
+func (r Result) ConsumeLatency() Latency {
+	return latency(r.Succeeded(), func(s Sample) time.Duration { return s.Consume })
+}
+
+func latency(samples []Sample, value func(Sample) time.Duration) Latency {
+	if len(samples) == 0 {
+		return Latency{}
+	}
+	d := make([]time.Duration, len(samples))
+	for i, s := range samples {
+		d[i] = value(s)
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	// Nearest rank percentiles.
+	rank := func(p int) time.Duration { return d[(len(d)*p+99)/100-1] }
+	return Latency{P50: rank(50), P95: rank(95), Max: d[len(d)-1]}
+}
@@ -0,0 +1,106 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	dir := t.TempDir()
+	files, err := Generate(dir, "run1", 3, 64<<10)
+	assert.NoError(t, err)
+	assert.Len(t, files, 3)
+	var previous []byte
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		assert.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4")))
+		assert.True(t, bytes.HasSuffix(data, []byte("%%EOF\n")))
+		assert.InDelta(t, 64<<10, len(data), 1024)
+		assert.NotEqual(t, previous, data)
+		previous = data
+	}
+	assert.Contains(t, files[2], "bench-run1-00003.pdf")
+}
+
+func TestBench(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		tasks = make(map[string]string)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/documents/post_document/":
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			_, header, _ := r.FormFile("document")
+			if strings.HasSuffix(header.Filename, "00002.pdf") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			tasks["task-"+header.Filename] = header.Filename
+			mu.Unlock()
+			w.Write([]byte(`"task-` + header.Filename + `"`))
+		case "/api/tasks/":
+			id := r.URL.Query().Get("task_id")
+			status := `"SUCCESS", "related_document": "5"`
+			if strings.HasSuffix(id, "00003.pdf") {
+				status = `"FAILURE", "result": "corrupt"`
+			}
+			w.Write([]byte(`[{"task_id": "` + id + `", "status": ` + status + `}]`))
+		}
+	}))
+	defer server.Close()
+
+	files, err := Generate(t.TempDir(), "test", 4, 4<<10)
+	assert.NoError(t, err)
+	var done int
+	b := &Bench{
+		Client:       paperless.NewClient(server.URL, "test_key"),
+		Concurrency:  2,
+		TaskTimeout:  time.Second,
+		PollInterval: time.Millisecond,
+		Progress:     func(d, total int) { done = d; assert.Equal(t, 4, total) },
+	}
+	result, err := b.Run(context.Background(), files)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, done)
+	assert.Len(t, result.Samples, 4)
+	assert.NoError(t, result.Samples[0].Err)
+	assert.Equal(t, 5, result.Samples[0].DocumentID)
+	assert.ErrorContains(t, result.Samples[1].Err, "status code 400")
+	assert.EqualError(t, result.Samples[2].Err, "consumption failed: corrupt")
+	assert.Len(t, result.Succeeded(), 2)
+	assert.Equal(t, result.Samples[0].Size+result.Samples[3].Size, result.Bytes())
+	assert.GreaterOrEqual(t, result.Elapsed, result.Uploaded)
+	l := result.ConsumeLatency()
+	assert.LessOrEqual(t, l.P50, l.Max)
+	assert.GreaterOrEqual(t, l.P50, result.UploadLatency().P50)
+
+	// Without a task timeout only the uploads are measured.
+	b.TaskTimeout = 0
+	result, err = b.Run(context.Background(), files)
+	assert.NoError(t, err)
+	assert.NoError(t, result.Samples[2].Err)
+	assert.Equal(t, result.Samples[2].Upload, result.Samples[2].Consume)
+}
+
+func TestLatency(t *testing.T) {
+	var samples []Sample
+	for i := 1; i <= 20; i++ {
+		samples = append(samples, Sample{Upload: time.Duration(i) * time.Second})
+	}
+	l := latency(samples, func(s Sample) time.Duration { return s.Upload })
+	assert.Equal(t, Latency{P50: 10 * time.Second, P95: 19 * time.Second, Max: 20 * time.Second}, l)
+	assert.Equal(t, Latency{}, latency(nil, nil))
+}
@@ -0,0 +1,78 @@
+package bench
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// pdfOverhead is roughly the size of a synthetic PDF without padding.
+const pdfOverhead = 700
+
+// WritePDF writes a single page PDF showing label, padded with random data
+// to about size bytes. The random padding keeps every document unique, so
+// Paperless does not reject them as duplicates, and incompressible.
+func WritePDF(w io.Writer, label string, size int64) error {
+	label = strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(label)
+	content := fmt.Sprintf("BT /F1 24 Tf 72 720 Td (%s) Tj ET", label)
+	padding := max(size-pdfOverhead-int64(len(content)), 16)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	bw := bufio.NewWriter(w)
+	n, _ := bw.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int64, 0, len(objects)+1)
+	for i, obj := range objects {
+		offsets = append(offsets, int64(n))
+		m, _ := fmt.Fprintf(bw, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+		n += m
+	}
+	// The padding is an unreferenced stream object, which readers ignore.
+	offsets = append(offsets, int64(n))
+	m, _ := fmt.Fprintf(bw, "%d 0 obj\n<< /Length %d >>\nstream\n", len(objects)+1, padding)
+	pos := int64(n + m)
+	if _, err := io.CopyN(bw, rand.Reader, padding); err != nil {
+		return err
+	}
+	m, _ = bw.WriteString("\nendstream\nendobj\n")
+	pos += padding + int64(m)
+
+	fmt.Fprintf(bw, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(bw, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(bw, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, pos)
+	return bw.Flush()
+}
+
+// Generate writes count synthetic PDFs of about size bytes to dir and
+// returns their paths. The documents are labelled with run and their
+// number.
+func Generate(dir, run string, count int, size int64) ([]string, error) {
+	paths := make([]string, 0, count)
+	for i := range count {
+		path := filepath.Join(dir, fmt.Sprintf("bench-%s-%05d.pdf", run, i+1))
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		err = WritePDF(f, fmt.Sprintf("paperless-uploader benchmark %s #%d", run, i+1), size)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
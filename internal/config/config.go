@@ -1,7 +1,16 @@
 package config
 
 import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -9,29 +18,575 @@ import (
 // Config stores the application configuration.
 type Config struct {
 	PaperlessURL     string   `mapstructure:"paperless_url"`
-	APIKey           string   `mapstructure:"api_key"`
+	APIKey           string   `mapstructure:"api_key" secret:"true"`
 	WatchFolder      string   `mapstructure:"watch_folder"`
 	PostUploadAction string   `mapstructure:"post_upload_action"`
 	ProcessedFolder  string   `mapstructure:"processed_folder"`
 	Tags             []string `mapstructure:"tags"`
+	// FailedFolder receives files whose upload failed for good, so they
+	// can be retried with the retry-failed command. Empty disables it.
+	FailedFolder string `mapstructure:"failed_folder"`
+	// SettleDelay is how long to wait after a file is detected before
+	// uploading it, giving the writer time to finish.
+	SettleDelay time.Duration  `mapstructure:"settle_delay"`
+	Folders     []FolderConfig `mapstructure:"folders"`
+	// Failover lists further URLs of Paperless, used while PaperlessURL
+	// cannot be reached.
+	Failover Failover `mapstructure:"failover"`
+	// TLS configures the connections to Paperless.
+	TLS TLS `mapstructure:"tls"`
+	// Proxy is the URL of the proxy used to reach Paperless, with the
+	// scheme http, https, socks5 or socks5h. Empty uses the HTTPS_PROXY
+	// and NO_PROXY environment variables.
+	Proxy string `mapstructure:"proxy" secret:"true"`
+	// Headers are sent with every request to Paperless, e.g. the service
+	// token of an authenticating proxy such as Cloudflare Access. Only the
+	// values of credential headers, such as Authorization, Cookie or
+	// X-Api-Key, are treated as secrets.
+	Headers map[string]string `mapstructure:"headers" secret:"true"`
+	// Encryption encrypts the files in ProcessedFolder, FailedFolder and
+	// SpoolDir.
+	Encryption Encryption `mapstructure:"encryption"`
+	// StatusListen is the address of the local status endpoint served while
+	// watching, e.g. "127.0.0.1:8765". Empty disables it.
+	StatusListen string `mapstructure:"status_listen"`
+	// MetricsListen is the address serving Prometheus metrics on /metrics
+	// while watching. It may equal StatusListen. Empty disables it.
+	MetricsListen string `mapstructure:"metrics_listen"`
+	// ControlSocket is the path of the unix socket, or the name of the
+	// named pipe on Windows, through which the CLI manages a running
+	// watcher. Empty disables it.
+	ControlSocket string `mapstructure:"control_socket"`
+	// LogSummaryInterval is how often a summary of the uploads per folder
+	// is logged while watching. Zero disables it.
+	LogSummaryInterval time.Duration `mapstructure:"log_summary_interval"`
+	// Pushgateway receives the metrics of one-shot runs, which cannot be
+	// scraped.
+	Pushgateway Pushgateway `mapstructure:"pushgateway"`
+	// ReadyTimeout is how long Paperless may be unreachable before /readyz
+	// reports the instance as not ready.
+	ReadyTimeout time.Duration `mapstructure:"ready_timeout"`
+	// MaxRetries is how often a failed upload is retried while watching.
+	MaxRetries int `mapstructure:"max_retries"`
+	// RetryDelay is the delay before the first retry; it doubles with every
+	// further attempt.
+	RetryDelay time.Duration `mapstructure:"retry_delay"`
+	// Include lists additional config files, directories or glob patterns
+	// merged on top of the main config file.
+	Include []string `mapstructure:"include"`
+	// Retention controls how long files are kept by the purge command.
+	Retention Retention `mapstructure:"retention"`
+	// FilenamePattern and TitleTemplate derive metadata from file names;
+	// see the rules package for the supported groups and fields.
+	FilenamePattern string `mapstructure:"filename_pattern"`
+	TitleTemplate   string `mapstructure:"title_template"`
+	// Tracing configures the export of OpenTelemetry traces.
+	Tracing Tracing `mapstructure:"tracing"`
+	// Notifications configures the notification backends.
+	Notifications Notifications `mapstructure:"notifications"`
+	// Receipts writes a <file>.uploaded.json with the document ID and link
+	// next to every uploaded file that is moved or left in place.
+	Receipts bool `mapstructure:"receipts"`
+	// ErrorReports writes a <file>.error.json with the error, the response
+	// of Paperless and every attempt next to files that failed for good.
+	ErrorReports bool `mapstructure:"error_reports"`
+	// VerifyChecksum deletes files with the "delete" post-upload action only
+	// once the original of their document matches their checksum.
+	VerifyChecksum bool `mapstructure:"verify_checksum"`
+	// OnDuplicate is what happens to files Paperless rejects as
+	// duplicates: "success", "move", "reupload" or "fail". Empty keeps
+	// running the post-upload action regardless.
+	OnDuplicate string `mapstructure:"on_duplicate"`
+	// DuplicatesFolder receives the duplicates with OnDuplicate "move".
+	DuplicatesFolder string `mapstructure:"duplicates_folder"`
+	// AuditLog is the JSONL file recording the lifecycle of every file
+	// handled while watching. Empty disables it.
+	AuditLog string `mapstructure:"audit_log"`
+	// AuditSigningKey is the path to an Ed25519 private key in PEM form that
+	// signs the records of AuditLog. Empty leaves them only chained by their
+	// hashes.
+	AuditSigningKey string `mapstructure:"audit_signing_key"`
+	// MQTT publishes the watcher status for Home Assistant.
+	MQTT MQTT `mapstructure:"mqtt"`
+	// SMTPReceiver accepts documents mailed by scanners.
+	SMTPReceiver SMTPReceiver `mapstructure:"smtp_receiver"`
+	// FTPReceiver accepts documents uploaded by scanners over FTP.
+	FTPReceiver FTPReceiver `mapstructure:"ftp_receiver"`
+	// UploadReceiver accepts documents posted over HTTP.
+	UploadReceiver UploadReceiver `mapstructure:"upload_receiver"`
+	// GRPC serves the gRPC API for remote control and uploads.
+	GRPC GRPC `mapstructure:"grpc"`
+	// WebUI serves a web interface for uploads and monitoring.
+	WebUI WebUI `mapstructure:"web_ui"`
+	// GoogleDrive downloads new files from a Drive folder.
+	GoogleDrive GoogleDrive `mapstructure:"google_drive"`
+	// SFTP downloads new files from a folder on an SFTP server.
+	SFTP SFTP `mapstructure:"sftp"`
+	// Rclone downloads new files from an rclone remote.
+	Rclone Rclone `mapstructure:"rclone"`
+	// Screenshots uploads screenshots and copied images as PDFs.
+	Screenshots Screenshots `mapstructure:"screenshots"`
+	// RemovableDrives imports documents from newly plugged in drives.
+	RemovableDrives RemovableDrives `mapstructure:"removable_drives"`
+	// ConsumeFallback copies files to a Paperless consume directory while
+	// the API is down.
+	ConsumeFallback ConsumeFallback `mapstructure:"consume_fallback"`
+	// CircuitBreaker holds uploads while Paperless is down.
+	CircuitBreaker CircuitBreaker `mapstructure:"circuit_breaker"`
+	// DedupWindow skips files byte-identical to one uploaded within it,
+	// e.g. double scans, without asking the server. Zero disables it.
+	DedupWindow time.Duration `mapstructure:"dedup_window"`
+	// StateBackend is the store of StateFile: "json", "bbolt" or
+	// "sqlite".
+	StateBackend string `mapstructure:"state_backend"`
+	// StateFile keeps what is remembered across restarts, such as recent
+	// uploads and, with the bbolt or sqlite backend, backfill checkpoints.
+	// Empty uses a file in the user cache directory.
+	StateFile string `mapstructure:"state_file"`
+	// SpoolDir stores files with their metadata while Paperless is down,
+	// to upload them in order once it is back. Empty disables it.
+	SpoolDir string `mapstructure:"spool_dir"`
+	// DocumentIndex mirrors the documents in Paperless locally for quick
+	// duplicate checks.
+	DocumentIndex DocumentIndex `mapstructure:"document_index"`
+	// FolderLock makes instances watching the same shared folders upload
+	// every file once.
+	FolderLock FolderLock `mapstructure:"folder_lock"`
+	// Rules set the metadata and post-upload action of the files they
+	// match, after the filename pattern and title template.
+	Rules []Rule `mapstructure:"rules"`
+	// ContentExtraction reads the text of files for rules matching their
+	// content.
+	ContentExtraction ContentExtraction `mapstructure:"content_extraction"`
+	// Export holds the defaults of the export command.
+	Export Export `mapstructure:"export"`
+	// MemoryBudget, e.g. "256M", is the memory the watch command aims to
+	// stay within, as accepted by ParseSize. Empty disables the limit.
+	MemoryBudget string `mapstructure:"memory_budget"`
+	// RunAs is the account the watch command switches to after startup
+	// when started as root. Unix only.
+	RunAs RunAs `mapstructure:"run_as"`
+	// UploadLimits are checked before uploads, so documents Paperless
+	// would reject fail without retries.
+	UploadLimits UploadLimits `mapstructure:"upload_limits"`
+	// AfterConsumption is metadata applied to documents once Paperless
+	// created them, for what cannot be set with the upload.
+	AfterConsumption AfterConsumption `mapstructure:"after_consumption"`
+}
+
+// Failover holds the URLs under which Paperless is reachable besides
+// PaperlessURL, e.g. over a VPN when away from home.
+type Failover struct {
+	// URLs are used in order when the ones before, starting with
+	// PaperlessURL, cannot be reached.
+	URLs []string `mapstructure:"urls"`
+	// RetryPrimary is how often the preferred URLs are tried again while
+	// another one is in use.
+	RetryPrimary time.Duration `mapstructure:"retry_primary"`
+}
+
+// ConsumeFallback holds the consume directory used while the API is
+// unreachable. An empty Dir disables the fallback.
+type ConsumeFallback struct {
+	// Dir is the Paperless consume directory, e.g. a mounted SMB share.
+	Dir string `mapstructure:"dir"`
+	// After is how long the API must have been unreachable before files
+	// are copied to Dir.
+	After time.Duration `mapstructure:"after"`
+}
+
+// CircuitBreaker holds uploads once Paperless is down, instead of failing
+// them one after the other, until a probe finds it available again.
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive uploads failing because the
+	// server is unreachable or answers with a server error that opens the
+	// circuit. Zero disables the circuit breaker.
+	Threshold int `mapstructure:"threshold"`
+	// ProbeInterval is how often the server is checked while the circuit
+	// is open.
+	ProbeInterval time.Duration `mapstructure:"probe_interval"`
+}
+
+// DocumentIndex holds the settings of the local document mirror. An empty
+// Path disables it.
+type DocumentIndex struct {
+	// Path is the SQLite file of the mirror.
+	Path string `mapstructure:"path"`
+	// RefreshInterval is how often the watch command refreshes the mirror.
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+}
+
+// FolderLock holds the settings of the claims by which instances sharing
+// folders coordinate.
+type FolderLock struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Instance names this instance in its claims and must differ between
+	// the instances. It defaults to the host name, suffixed with the name
+	// of a named instance.
+	Instance string `mapstructure:"instance"`
+	// Timeout is how long the claims of an instance that stopped block
+	// their files.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Rule sets metadata on the files matching all of its conditions.
+type Rule struct {
+	Name  string    `mapstructure:"name"`
+	Match RuleMatch `mapstructure:"match"`
+	Set   RuleSet   `mapstructure:"set"`
+	// Stop skips the rules after this one if it matched.
+	Stop bool `mapstructure:"stop"`
+}
+
+// RuleMatch holds the conditions of a rule. Patterns are globs such as
+// "*invoice*".
+type RuleMatch struct {
+	Filename string `mapstructure:"filename"`
+	// Folder is the watch folder, by path or name.
+	Folder   string `mapstructure:"folder"`
+	MimeType string `mapstructure:"mime_type"`
+	// MinSize and MaxSize are sizes as accepted by ParseSize.
+	MinSize string `mapstructure:"min_size"`
+	MaxSize string `mapstructure:"max_size"`
+	// CreatedAfter and CreatedBefore bound the date parsed from the file
+	// name, as YYYY-MM-DD.
+	CreatedAfter  string `mapstructure:"created_after"`
+	CreatedBefore string `mapstructure:"created_before"`
+	// Sender matches the sender of files received by mail.
+	Sender string `mapstructure:"sender"`
+	// Remote matches the remote path of files downloaded over SFTP or
+	// rclone.
+	Remote string `mapstructure:"remote"`
+	// Content is a regular expression matched against the text of the
+	// file, as extracted by ContentExtraction.
+	Content string `mapstructure:"content"`
+}
+
+// ContentExtraction holds the commands that extract the text of files for
+// the content conditions of rules. They print the text on standard output;
+// "{file}" in their arguments is replaced by the path of the file.
+type ContentExtraction struct {
+	PDFCommand []string `mapstructure:"pdf_command"`
+	// ScannedPDFCommand recognizes the text of PDFs without a text layer.
+	// Empty leaves them without text.
+	ScannedPDFCommand []string      `mapstructure:"scanned_pdf_command"`
+	ImageCommand      []string      `mapstructure:"image_command"`
+	Timeout           time.Duration `mapstructure:"timeout"`
+	// MaxSize, as accepted by ParseSize, skips larger files.
+	MaxSize string `mapstructure:"max_size"`
+}
+
+// RuleSet holds the metadata a rule sets.
+type RuleSet struct {
+	Title         string   `mapstructure:"title"`
+	Correspondent string   `mapstructure:"correspondent"`
+	DocumentType  string   `mapstructure:"document_type"`
+	StoragePath   string   `mapstructure:"storage_path"`
+	Tags          []string `mapstructure:"tags"`
+	// PostUploadAction is "delete", "move" or "keep".
+	PostUploadAction string `mapstructure:"post_upload_action"`
+}
+
+// Export holds the settings of the export command, which backs up the
+// documents in Paperless into a local folder.
+type Export struct {
+	// Dir is the folder documents are exported to.
+	Dir string `mapstructure:"dir"`
+	// Layout is a text/template of the path of a document in Dir, without
+	// extension. Empty files documents by correspondent and year.
+	Layout string `mapstructure:"layout"`
+	// Original exports the original files instead of the archived (OCRed)
+	// versions.
+	Original bool `mapstructure:"original"`
+	// Prune removes exported documents that were deleted from Paperless.
+	Prune bool `mapstructure:"prune"`
+}
+
+// RunAs holds the user and group, by name or numeric ID, to switch to. An
+// empty group uses the user's primary group.
+type RunAs struct {
+	User  string `mapstructure:"user"`
+	Group string `mapstructure:"group"`
+}
+
+// UploadLimits describe the documents Paperless accepts.
+type UploadLimits struct {
+	// MaxSize, as accepted by ParseSize, is the size of the largest
+	// document accepted, e.g. the client_max_body_size of a reverse proxy.
+	// Empty disables the check.
+	MaxSize string `mapstructure:"max_size"`
+	// MimeTypes are patterns of the accepted content types, e.g.
+	// "image/*"; "default" stands for the types Paperless consumes without
+	// Tika. Empty accepts all types.
+	MimeTypes []string `mapstructure:"mime_types"`
+}
+
+// AfterConsumption holds the metadata set on every document after its
+// consumption. Notes and custom field values are text/templates with the
+// fields .File, .Path, .Folder and .DocumentID; users and groups are given
+// by name.
+type AfterConsumption struct {
+	Notes []string `mapstructure:"notes"`
+	// CustomFields maps custom field names to their values.
+	CustomFields map[string]string `mapstructure:"custom_fields"`
+	Owner        string            `mapstructure:"owner"`
+	ViewUsers    []string          `mapstructure:"view_users"`
+	ViewGroups   []string          `mapstructure:"view_groups"`
+	ChangeUsers  []string          `mapstructure:"change_users"`
+	ChangeGroups []string          `mapstructure:"change_groups"`
+}
+
+// Enabled reports whether anything is to be set.
+func (a AfterConsumption) Enabled() bool {
+	return len(a.Notes) > 0 || len(a.CustomFields) > 0 || a.Owner != "" ||
+		len(a.ViewUsers)+len(a.ViewGroups)+len(a.ChangeUsers)+len(a.ChangeGroups) > 0
+}
+
+// Tracing holds the OpenTelemetry trace export settings.
+type Tracing struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Endpoint is the OTLP/HTTP collector address, e.g. "localhost:4318".
+	// Empty uses the standard OTEL_EXPORTER_OTLP_* environment variables.
+	Endpoint string `mapstructure:"endpoint"`
+	// Insecure sends traces over plain HTTP.
+	Insecure bool `mapstructure:"insecure"`
+	// SampleRatio is the fraction of documents traced, from 0 to 1.
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+// Pushgateway holds the Prometheus Pushgateway settings. An empty URL
+// disables pushing.
+type Pushgateway struct {
+	URL string `mapstructure:"url"`
+	// Job is the job label; it defaults to "paperless_uploader".
+	Job string `mapstructure:"job"`
+	// Instance is the instance label; it defaults to the host name,
+	// suffixed with the name of a named instance.
+	Instance string `mapstructure:"instance"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password" secret:"true"`
+}
+
+// Retention holds the maximum age of files in the local archive folders, as
+// accepted by ParseAge. Empty values keep files forever.
+type Retention struct {
+	Processed string `mapstructure:"processed"`
+	Failed    string `mapstructure:"failed"`
+}
+
+// ParseSize parses a size in bytes with an optional unit K, M or G (powers
+// of 1024), which may be followed by "B" or "iB", e.g. "512M" or "1GiB".
+func ParseSize(s string) (int64, error) {
+	n := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(s), "B"), "i")
+	shift := 0
+	if len(n) > 0 {
+		switch n[len(n)-1] {
+		case 'K', 'k':
+			shift = 10
+		case 'M', 'm':
+			shift = 20
+		case 'G', 'g':
+			shift = 30
+		}
+	}
+	if shift > 0 {
+		n = n[:len(n)-1]
+	}
+	size, err := strconv.ParseInt(n, 10, 64)
+	if err != nil || size <= 0 || size > math.MaxInt64>>shift {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size << shift, nil
+}
+
+// ParseAge parses a duration that may also use the units "d" (days) and "w"
+// (weeks), e.g. "90d" or "2w". Other values are parsed by
+// time.ParseDuration.
+func ParseAge(s string) (time.Duration, error) {
+	if n, ok := strings.CutSuffix(s, "d"); ok {
+		days, err := strconv.Atoi(n)
+		if err != nil || days < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	if n, ok := strings.CutSuffix(s, "w"); ok {
+		weeks, err := strconv.Atoi(n)
+		if err != nil || weeks < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(weeks) * 7 * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+// FolderConfig describes a single watched folder. Zero values inherit the
+// corresponding top-level setting.
+type FolderConfig struct {
+	Path        string        `mapstructure:"path"`
+	SettleDelay time.Duration `mapstructure:"settle_delay"`
+	// Tags replace the top-level tags for documents from this folder.
+	Tags            []string `mapstructure:"tags"`
+	FilenamePattern string   `mapstructure:"filename_pattern"`
+	TitleTemplate   string   `mapstructure:"title_template"`
+	// APIKey replaces the top-level api_key for documents from this
+	// folder, so that they are owned by the Paperless user of the key.
+	APIKey string `mapstructure:"api_key" secret:"true"`
+}
+
+// WatchFolders returns the effective list of folders to watch. When no
+// folders are configured, the top-level watch_folder is used.
+func (c *Config) WatchFolders() []FolderConfig {
+	if len(c.Folders) == 0 {
+		return []FolderConfig{{
+			Path:            c.WatchFolder,
+			SettleDelay:     c.SettleDelay,
+			Tags:            c.Tags,
+			FilenamePattern: c.FilenamePattern,
+			TitleTemplate:   c.TitleTemplate,
+		}}
+	}
+	folders := make([]FolderConfig, 0, len(c.Folders))
+	for _, f := range c.Folders {
+		if f.SettleDelay == 0 {
+			f.SettleDelay = c.SettleDelay
+		}
+		if len(f.Tags) == 0 {
+			f.Tags = c.Tags
+		}
+		if f.FilenamePattern == "" {
+			f.FilenamePattern = c.FilenamePattern
+		}
+		if f.TitleTemplate == "" {
+			f.TitleTemplate = c.TitleTemplate
+		}
+		folders = append(folders, f)
+	}
+	return folders
+}
+
+// TagNames returns every tag name referenced in the configuration, without
+// duplicates, in the order they first appear.
+func (c *Config) TagNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(tags []string) {
+		for _, name := range tags {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	add(c.Tags)
+	for _, f := range c.Folders {
+		add(f.Tags)
+	}
+	add(c.RemovableDrives.Tags)
+	add(c.Rclone.Tags)
+	for _, r := range c.Rules {
+		add(r.Set.Tags)
+	}
+	return names
+}
+
+// SearchPaths returns the directories searched for the config file, in
+// order.
+func SearchPaths() []string {
+	paths := []string{"."}
+	if container {
+		paths = []string{DataDir, "."}
+	}
+	return append(paths, platformSearchPaths()...)
+}
+
+// Find returns the absolute path of the first config file of the selected
+// instance found in the search paths, or an empty string if there is none.
+func Find() string {
+	for _, dir := range SearchPaths() {
+		path := filepath.Join(dir, FileName())
+		if _, err := os.Stat(path); err == nil {
+			if abs, err := filepath.Abs(path); err == nil {
+				return abs
+			}
+			return path
+		}
+	}
+	return ""
 }
 
 // Load loads the configuration from a file and environment variables.
 func Load() (*Config, error) {
-	viper.SetConfigName("config") // name of config file (without extension)
+	return LoadFile("")
+}
+
+// LoadFile loads the configuration like Load, but reads the given config
+// file instead of searching for one when path is not empty.
+func LoadFile(path string) (*Config, error) {
+	viper.SetConfigName(Namespaced("config")) // name of config file (without extension)
 	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")                        // look for config in the working directory
-	viper.AddConfigPath("/etc/paperless-uploader/") // and in a system-wide directory
+	for _, dir := range SearchPaths() {
+		viper.AddConfigPath(dir)
+	}
+	if path != "" {
+		viper.SetConfigFile(path)
+	}
 	viper.SetEnvPrefix("UPLOADER")
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
+	bindEnv("", reflect.TypeOf(Config{}))
 
 	// Set default values
 	viper.SetDefault("paperless_url", "http://localhost:8000")
 	viper.SetDefault("watch_folder", "watch")
 	viper.SetDefault("post_upload_action", "")
 	viper.SetDefault("processed_folder", "processed")
+	viper.SetDefault("failed_folder", "")
+	viper.SetDefault("duplicates_folder", "duplicates")
 	viper.SetDefault("tags", nil)
+	viper.SetDefault("settle_delay", "1s")
+	viper.SetDefault("status_listen", "")
+	viper.SetDefault("ready_timeout", "5m")
+	viper.SetDefault("log_summary_interval", "24h")
+	viper.SetDefault("max_retries", 3)
+	viper.SetDefault("retry_delay", "30s")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+	viper.SetDefault("notifications.summary_interval", "24h")
+	viper.SetDefault("mqtt.client_id", Namespaced("paperless-uploader"))
+	viper.SetDefault("mqtt.topic_prefix", Namespaced("paperless-uploader"))
+	viper.SetDefault("mqtt.discovery", true)
+	viper.SetDefault("mqtt.discovery_prefix", "homeassistant")
+	viper.SetDefault("mqtt.interval", "30s")
+	viper.SetDefault("smtp_receiver.max_message_size", "32M")
+	viper.SetDefault("ftp_receiver.max_file_size", "256M")
+	viper.SetDefault("upload_receiver.max_file_size", "256M")
+	viper.SetDefault("grpc.max_file_size", "256M")
+	viper.SetDefault("web_ui.max_file_size", "256M")
+	viper.SetDefault("google_drive.poll_interval", "1m")
+	viper.SetDefault("sftp.poll_interval", "1m")
+	viper.SetDefault("rclone.poll_interval", "1m")
+	viper.SetDefault("failover.retry_primary", "1m")
+	viper.SetDefault("consume_fallback.after", "10m")
+	viper.SetDefault("circuit_breaker.threshold", 5)
+	viper.SetDefault("circuit_breaker.probe_interval", "30s")
+	viper.SetDefault("state_backend", "json")
+	viper.SetDefault("folder_lock.timeout", "10m")
+	viper.SetDefault("document_index.refresh_interval", "15m")
+	viper.SetDefault("content_extraction.pdf_command", []string{"pdftotext", "-l", "5", "{file}", "-"})
+	viper.SetDefault("content_extraction.image_command", []string{"tesseract", "{file}", "stdout"})
+	viper.SetDefault("content_extraction.timeout", "1m")
+	viper.SetDefault("content_extraction.max_size", "50M")
+	viper.SetDefault("screenshots.poll_interval", "2s")
+	viper.SetDefault("screenshots.tags", []string{"screenshot"})
+	viper.SetDefault("removable_drives.poll_interval", "5s")
+	viper.SetDefault("removable_drives.extensions", []string{"pdf", "jpg", "jpeg", "png", "tif", "tiff"})
+	if container {
+		setContainerDefaults()
+	}
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
@@ -40,6 +595,10 @@ func Load() (*Config, error) {
 		}
 	}
 
+	if err := mergeIncludes(); err != nil {
+		return nil, err
+	}
+
 	var cfg Config
 	if err := viper.Unmarshal(&cfg); err != nil {
 		return nil, err
@@ -47,3 +606,105 @@ func Load() (*Config, error) {
 
 	return &cfg, nil
 }
+
+// appendedLists are the lists of sections that included files add to
+// instead of replacing, so that e.g. every file of conf.d can declare its
+// own folders.
+var appendedLists = []string{
+	"folders",
+	"rules",
+	"mqtt.scan_profiles",
+	"smtp_receiver.routes",
+	"ftp_receiver.users",
+	"notifications.webhooks",
+}
+
+// mergeIncludes merges the files referenced by the include list, followed by
+// any *.yaml files in a conf.d directory next to the main config file. Files
+// are merged in order, so later files override earlier ones, except for the
+// appendedLists, which are concatenated. Includes inside included files are
+// not followed. Without a main config file there is no conf.d: it would be
+// looked up in the working directory, picking up whatever is there.
+func mergeIncludes() error {
+	base := "."
+	if used := viper.ConfigFileUsed(); used != "" {
+		base = filepath.Dir(used)
+	}
+
+	var files []string
+	for _, include := range viper.GetStringSlice("include") {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(base, include)
+		}
+		matches, err := expandInclude(include)
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+	if viper.ConfigFileUsed() != "" {
+		confD, err := expandInclude(filepath.Join(base, "conf.d"))
+		if err != nil {
+			return err
+		}
+		files = append(files, confD...)
+	}
+
+	for _, file := range files {
+		if err := mergeFile(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandInclude resolves a single include entry to a sorted list of files.
+// Directories expand to the *.yaml and *.yml files they contain.
+func expandInclude(include string) ([]string, error) {
+	if info, err := os.Stat(include); err == nil && info.IsDir() {
+		var files []string
+		for _, pattern := range []string{"*.yaml", "*.yml"} {
+			matches, err := filepath.Glob(filepath.Join(include, pattern))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
+		}
+		sort.Strings(files)
+		return files, nil
+	}
+
+	matches, err := filepath.Glob(include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern %q: %w", include, err)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func mergeFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to open included config %s: %w", path, err)
+	}
+
+	included := viper.New()
+	included.SetConfigType("yaml")
+	if ext := strings.TrimPrefix(filepath.Ext(path), "."); ext != "" {
+		included.SetConfigType(ext)
+	}
+	if err := included.ReadConfig(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to merge included config %s: %w", path, err)
+	}
+	for _, key := range appendedLists {
+		existing, _ := viper.Get(key).([]any)
+		added, _ := included.Get(key).([]any)
+		if len(existing) > 0 && len(added) > 0 {
+			included.Set(key, append(append([]any{}, existing...), added...))
+		}
+	}
+	if err := viper.MergeConfigMap(included.AllSettings()); err != nil {
+		return fmt.Errorf("failed to merge included config %s: %w", path, err)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -112,5 +113,267 @@ api_key: "file_key"
 		assert.Equal(t, "", cfg.PostUploadAction)
 		assert.Equal(t, "processed", cfg.ProcessedFolder)
 		assert.Nil(t, cfg.Tags)
+		assert.Equal(t, time.Second, cfg.SettleDelay)
 	})
+
+	t.Run("per-folder settle delay", func(t *testing.T) {
+		viper.Reset()
+		content := `
+settle_delay: "2s"
+folders:
+  - path: "/scans"
+  - path: "/slow"
+    settle_delay: "30s"
+    tags: [slow]
+`
+		tmpDir, err := os.MkdirTemp("", "config-test-folders")
+		assert.NoError(t, err)
+		defer os.RemoveAll(tmpDir)
+
+		err = os.WriteFile(filepath.Join(tmpDir, "config.yaml"), []byte(content), 0600)
+		assert.NoError(t, err)
+
+		viper.AddConfigPath(tmpDir)
+
+		cfg, err := Load()
+		assert.NoError(t, err)
+		assert.Equal(t, []FolderConfig{
+			{Path: "/scans", SettleDelay: 2 * time.Second},
+			{Path: "/slow", SettleDelay: 30 * time.Second, Tags: []string{"slow"}},
+		}, cfg.WatchFolders())
+	})
+
+	t.Run("include and conf.d are merged", func(t *testing.T) {
+		viper.Reset()
+		tmpDir, err := os.MkdirTemp("", "config-test-include")
+		assert.NoError(t, err)
+		defer os.RemoveAll(tmpDir)
+
+		main := `
+paperless_url: "http://main.com"
+api_key: "main_key"
+include:
+  - extra.yaml
+`
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "config.yaml"), []byte(main), 0600))
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "extra.yaml"), []byte(`api_key: "extra_key"
+tags: [fromextra]
+`), 0600))
+		assert.NoError(t, os.Mkdir(filepath.Join(tmpDir, "conf.d"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "conf.d", "10-url.yaml"), []byte(`paperless_url: "http://confd.com"`), 0600))
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "conf.d", "20-tags.yaml"), []byte(`tags: [fromconfd]`), 0600))
+
+		viper.AddConfigPath(tmpDir)
+
+		cfg, err := Load()
+		assert.NoError(t, err)
+		assert.Equal(t, "http://confd.com", cfg.PaperlessURL)
+		assert.Equal(t, "extra_key", cfg.APIKey)
+		assert.Equal(t, []string{"fromconfd"}, cfg.Tags)
+	})
+
+	t.Run("conf.d files add folders", func(t *testing.T) {
+		viper.Reset()
+		tmpDir := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "config.yaml"), []byte(`folders:
+  - path: /scans
+rules:
+  - name: main
+`), 0600))
+		assert.NoError(t, os.Mkdir(filepath.Join(tmpDir, "conf.d"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "conf.d", "10-mail.yaml"), []byte(`folders:
+  - path: /mail
+    tags: [mail]
+smtp_receiver:
+  routes:
+    - sender: "*@scanner.lan"
+      folder: /mail
+`), 0600))
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "conf.d", "20-phone.yml"), []byte(`folders:
+  - path: /phone
+smtp_receiver:
+  routes:
+    - sender: phone@example.com
+      folder: /phone
+`), 0600))
+
+		viper.AddConfigPath(tmpDir)
+
+		cfg, err := Load()
+		assert.NoError(t, err)
+		var paths []string
+		for _, f := range cfg.Folders {
+			paths = append(paths, f.Path)
+		}
+		assert.Equal(t, []string{"/scans", "/mail", "/phone"}, paths)
+		assert.Equal(t, []string{"mail"}, cfg.Folders[1].Tags)
+		assert.Equal(t, []SMTPRoute{{Sender: "*@scanner.lan", Folder: "/mail"}, {Sender: "phone@example.com", Folder: "/phone"}}, cfg.SMTPReceiver.Routes)
+		assert.Len(t, cfg.Rules, 1)
+	})
+
+	t.Run("explicit config file", func(t *testing.T) {
+		viper.Reset()
+		tmpDir, err := os.MkdirTemp("", "config-test-explicit")
+		assert.NoError(t, err)
+		defer os.RemoveAll(tmpDir)
+
+		tmpFile := filepath.Join(tmpDir, "uploader.yaml")
+		assert.NoError(t, os.WriteFile(tmpFile, []byte(`api_key: "explicit_key"`), 0600))
+
+		cfg, err := LoadFile(tmpFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "explicit_key", cfg.APIKey)
+
+		viper.Reset()
+		_, err = LoadFile(filepath.Join(tmpDir, "missing.yaml"))
+		assert.Error(t, err)
+	})
+
+	t.Run("notifications", func(t *testing.T) {
+		viper.Reset()
+		tmpFile := filepath.Join(t.TempDir(), "config.yaml")
+		assert.NoError(t, os.WriteFile(tmpFile, []byte(`notifications:
+  ntfy:
+    topic: scans
+    events: [failure, summary]
+    templates:
+      failure: "{{.Name}} failed"
+  webhooks:
+    - format: discord
+      url: https://discord.test/hook
+      batch_interval: 5m
+`), 0600))
+
+		cfg, err := LoadFile(tmpFile)
+		assert.NoError(t, err)
+		assert.Equal(t, 24*time.Hour, cfg.Notifications.SummaryInterval)
+		if assert.NotNil(t, cfg.Notifications.Ntfy) {
+			assert.Equal(t, "scans", cfg.Notifications.Ntfy.Topic)
+			assert.Equal(t, []string{"failure", "summary"}, cfg.Notifications.Ntfy.Events)
+			assert.Equal(t, map[string]string{"failure": "{{.Name}} failed"}, cfg.Notifications.Ntfy.Templates)
+		}
+		if assert.Len(t, cfg.Notifications.Webhooks, 1) {
+			assert.Equal(t, "discord", cfg.Notifications.Webhooks[0].Format)
+			assert.Equal(t, 5*time.Minute, cfg.Notifications.Webhooks[0].BatchInterval)
+		}
+	})
+
+	t.Run("mqtt", func(t *testing.T) {
+		viper.Reset()
+		tmpFile := filepath.Join(t.TempDir(), "config.yaml")
+		assert.NoError(t, os.WriteFile(tmpFile, []byte(`mqtt:
+  broker: tcp://ha:1883
+  client_id: office
+`), 0600))
+
+		cfg, err := LoadFile(tmpFile)
+		assert.NoError(t, err)
+		assert.Equal(t, MQTT{
+			Broker:          "tcp://ha:1883",
+			ClientID:        "office",
+			TopicPrefix:     "paperless-uploader",
+			Discovery:       true,
+			DiscoveryPrefix: "homeassistant",
+			Interval:        30 * time.Second,
+		}, cfg.MQTT)
+	})
+
+	t.Run("named instance", func(t *testing.T) {
+		viper.Reset()
+		dir := t.TempDir()
+		t.Chdir(dir)
+		assert.NoError(t, os.WriteFile("config.yaml", []byte("api_key: default\n"), 0600))
+		assert.NoError(t, os.WriteFile("config-scanner.yaml", []byte("api_key: scanner\n"), 0600))
+		assert.NoError(t, SetInstance("scanner"))
+		defer SetInstance("")
+
+		cfg, err := Load()
+		assert.NoError(t, err)
+		assert.Equal(t, "scanner", cfg.APIKey)
+		assert.Equal(t, "paperless-uploader-scanner", cfg.MQTT.ClientID)
+		assert.Equal(t, "paperless-uploader-scanner", cfg.MQTT.TopicPrefix)
+		assert.Equal(t, filepath.Join(dir, "config-scanner.yaml"), Find())
+
+		assert.Error(t, SetInstance("../etc"))
+	})
+
+	t.Run("container mode from environment only", func(t *testing.T) {
+		viper.Reset()
+		t.Chdir(t.TempDir())
+		t.Setenv("UPLOADER_API_KEY", "env_key")
+		t.Setenv("UPLOADER_MQTT_BROKER", "tcp://ha:1883")
+		t.Setenv("UPLOADER_NOTIFICATIONS_NTFY_TOPIC", "scans")
+		t.Setenv("UPLOADER_RUN_AS_USER", "65532")
+		SetContainer(true)
+		defer SetContainer(false)
+
+		cfg, err := Load()
+		assert.NoError(t, err)
+		assert.Equal(t, "env_key", cfg.APIKey)
+		assert.Equal(t, "tcp://ha:1883", cfg.MQTT.Broker)
+		assert.Equal(t, RunAs{User: "65532"}, cfg.RunAs)
+		if assert.NotNil(t, cfg.Notifications.Ntfy) {
+			assert.Equal(t, "scans", cfg.Notifications.Ntfy.Topic)
+		}
+		assert.Nil(t, cfg.Notifications.Gotify)
+		assert.Equal(t, "/data/consume", cfg.WatchFolder)
+		assert.Equal(t, "/data/failed", cfg.FailedFolder)
+		assert.Equal(t, ":8765", cfg.StatusListen)
+		assert.Equal(t, "/data", SearchPaths()[0])
+	})
+}
+
+func TestWatchFolders(t *testing.T) {
+	cfg := &Config{WatchFolder: "watch", SettleDelay: 5 * time.Second}
+	assert.Equal(t, []FolderConfig{{Path: "watch", SettleDelay: 5 * time.Second}}, cfg.WatchFolders())
+
+	cfg = &Config{Tags: []string{"inbox"}, Folders: []FolderConfig{{Path: "a"}, {Path: "b", Tags: []string{"scanner", "inbox"}}}}
+	assert.Equal(t, []string{"inbox"}, cfg.WatchFolders()[0].Tags)
+	assert.Equal(t, []string{"scanner", "inbox"}, cfg.WatchFolders()[1].Tags)
+	assert.Equal(t, []string{"inbox", "scanner"}, cfg.TagNames())
+}
+
+func TestSecrets(t *testing.T) {
+	cfg := &Config{
+		APIKey:  "main-key",
+		Folders: []FolderConfig{{Path: "a"}, {Path: "b", APIKey: "alice-key"}},
+		MQTT:    MQTT{Username: "mqtt", Password: "mqtt-pass"},
+		Headers: map[string]string{"cf-access-client-secret": "cf-secret", "Authorization": "Bearer abc", "X-Forwarded-Proto": "https"},
+	}
+	cfg.Notifications.Webhooks = []Webhook{{URL: "https://hooks.slack.com/services/T000/B000/XXXX"}}
+	assert.ElementsMatch(t, []string{"main-key", "alice-key", "mqtt-pass", "cf-secret", "Bearer abc", "https://hooks.slack.com/services/T000/B000/XXXX"}, cfg.Secrets())
+}
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{
+		"4096":  4096,
+		"512M":  512 << 20,
+		"256MB": 256 << 20,
+		"1GiB":  1 << 30,
+		"64k":   64 << 10,
+	} {
+		got, err := ParseSize(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "M", "-1M", "0", "lots", "1.5G"} {
+		_, err := ParseSize(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"90d": 90 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+	} {
+		got, err := ParseAge(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, s := range []string{"", "d", "-1d", "soon"} {
+		_, err := ParseAge(s)
+		assert.Error(t, err, s)
+	}
 }
@@ -0,0 +1,29 @@
+package config
+
+import "github.com/spf13/viper"
+
+// DataDir is the volume of the container image holding the config file and
+// the folders.
+const DataDir = "/data"
+
+// ContainerStatusListen is the default status endpoint in container mode,
+// reachable by the image's health check and by orchestrator probes.
+const ContainerStatusListen = ":8765"
+
+// container is set by SetContainer.
+var container bool
+
+// SetContainer selects the defaults of container mode: the config file is
+// looked up in DataDir first, the folders default to subdirectories of
+// DataDir and the status endpoint, which serves /readyz, is enabled.
+func SetContainer(enabled bool) {
+	container = enabled
+}
+
+// setContainerDefaults overrides the defaults for container mode.
+func setContainerDefaults() {
+	viper.SetDefault("watch_folder", DataDir+"/consume")
+	viper.SetDefault("processed_folder", DataDir+"/processed")
+	viper.SetDefault("failed_folder", DataDir+"/failed")
+	viper.SetDefault("status_listen", ContainerStatusListen)
+}
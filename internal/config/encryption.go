@@ -0,0 +1,9 @@
+package config
+
+// Encryption configures the encryption of files kept on disk.
+type Encryption struct {
+	// KeyFile holds a 32 byte key, hex encoded as created by
+	// "openssl rand -hex 32". If set, files moved to the processed and
+	// failed folders are encrypted with it and get the suffix ".enc".
+	KeyFile string `mapstructure:"key_file"`
+}
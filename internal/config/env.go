@@ -0,0 +1,33 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// bindEnv binds the environment variable of every setting of t below prefix,
+// so settings without a default can be configured from the environment
+// alone, e.g. UPLOADER_API_KEY or UPLOADER_MQTT_BROKER. Lists of objects,
+// such as folders, and maps can only be set in a config file.
+func bindEnv(prefix string, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		ft := field.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		switch {
+		case opts == "squash":
+			bindEnv(prefix, ft)
+		case name == "" || name == "-":
+		case ft.Kind() == reflect.Struct:
+			bindEnv(prefix+name+".", ft)
+		case ft.Kind() == reflect.Map, ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+		default:
+			_ = viper.BindEnv(prefix + name)
+		}
+	}
+}
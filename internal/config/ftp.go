@@ -0,0 +1,37 @@
+package config
+
+// FTPReceiver configures the embedded FTP server for scanners that can only
+// "scan to FTP".
+type FTPReceiver struct {
+	// Listen is the listen address of the control connection, e.g.
+	// ":2121". Empty disables the receiver.
+	Listen string `mapstructure:"listen"`
+	// PassivePorts is the port range offered for passive data connections,
+	// e.g. "50000-50100". Empty uses any free port.
+	PassivePorts string `mapstructure:"passive_ports"`
+	// PublicHost is the IPv4 address announced for passive connections
+	// when clients reach the server through NAT, e.g. in a container. It
+	// defaults to the address the client connected to.
+	PublicHost string `mapstructure:"public_host"`
+	// TLSCert and TLSKey enable FTPS with AUTH TLS.
+	TLSCert string `mapstructure:"tls_cert"`
+	TLSKey  string `mapstructure:"tls_key"`
+	// RequireTLS rejects logins before AUTH TLS.
+	RequireTLS bool `mapstructure:"require_tls"`
+	// MaxFileSize limits the size of an uploaded file, as accepted by
+	// ParseSize.
+	MaxFileSize string `mapstructure:"max_file_size"`
+	// Users are the accounts that may upload.
+	Users []FTPUser `mapstructure:"users"`
+	// Folder receives the files of users without a folder; it defaults to
+	// the first watch folder.
+	Folder string `mapstructure:"folder"`
+}
+
+// FTPUser is an account of the FTP receiver. Its uploads are delivered to
+// Folder.
+type FTPUser struct {
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password" secret:"true"`
+	Folder   string `mapstructure:"folder"`
+}
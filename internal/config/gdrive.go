@@ -0,0 +1,26 @@
+package config
+
+import "time"
+
+// GoogleDrive configures downloading new files from a Google Drive folder.
+type GoogleDrive struct {
+	// FolderID is the Drive folder watched for new files. Empty disables
+	// the source.
+	FolderID string `mapstructure:"folder_id"`
+	// ProcessedFolderID is the Drive folder files are moved to once
+	// uploaded. Empty leaves them in place.
+	ProcessedFolderID string `mapstructure:"processed_folder_id"`
+	// CredentialsFile is the JSON key of a service account the folder is
+	// shared with.
+	CredentialsFile string `mapstructure:"credentials_file"`
+	// ClientID, ClientSecret and RefreshToken authorize as a user with
+	// OAuth instead.
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret" secret:"true"`
+	RefreshToken string `mapstructure:"refresh_token" secret:"true"`
+	// PollInterval is how often Drive is asked for changes.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// Folder is the watch folder whose settings downloads are uploaded
+	// with; it defaults to the first watch folder.
+	Folder string `mapstructure:"folder"`
+}
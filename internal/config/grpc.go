@@ -0,0 +1,15 @@
+package config
+
+// GRPC configures the gRPC API for remote control and uploads.
+type GRPC struct {
+	// Listen is the listen address, e.g. ":9090". Empty disables the API.
+	Listen string `mapstructure:"listen"`
+	// Token is the bearer token clients must send.
+	Token string `mapstructure:"token" secret:"true"`
+	// TLSCert and TLSKey secure the API with TLS.
+	TLSCert string `mapstructure:"tls_cert"`
+	TLSKey  string `mapstructure:"tls_key"`
+	// MaxFileSize limits the size of an uploaded document, as accepted by
+	// ParseSize.
+	MaxFileSize string `mapstructure:"max_file_size"`
+}
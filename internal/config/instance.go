@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/spf13/viper"
+)
+
+// instance is the name of the selected instance, empty for the default one.
+var instance string
+
+var instanceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// SetInstance selects the named instance. Each instance reads its own config
+// file, config-<name>.yaml, and namespaces the names it uses on the machine or
+// on shared servers. An empty name selects the default instance.
+func SetInstance(name string) error {
+	if name != "" && !instanceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid instance name %q: use letters, digits, '-' and '_'", name)
+	}
+	instance = name
+	return nil
+}
+
+// Instance returns the name of the selected instance, empty for the default
+// one.
+func Instance() string {
+	return instance
+}
+
+// Namespaced returns name suffixed with "-<instance>" for named instances,
+// and name itself for the default instance.
+func Namespaced(name string) string {
+	if instance != "" {
+		return name + "-" + instance
+	}
+	return name
+}
+
+// FileName returns the name of the config file of the selected instance.
+func FileName() string {
+	return Namespaced("config") + ".yaml"
+}
+
+// Profile names the loaded configuration: the path of its file, or the
+// instance name if no file was read.
+func Profile() string {
+	if used := viper.ConfigFileUsed(); used != "" {
+		return used
+	}
+	return instance
+}
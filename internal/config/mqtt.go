@@ -0,0 +1,50 @@
+package config
+
+import "time"
+
+// MQTT configures publishing the watcher status to an MQTT broker.
+type MQTT struct {
+	// Broker is the broker URL, e.g. "tcp://homeassistant:1883"; use
+	// "ssl://" for TLS. Empty disables MQTT.
+	Broker   string `mapstructure:"broker"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password" secret:"true"`
+	// ClientID identifies this instance at the broker and in Home
+	// Assistant.
+	ClientID string `mapstructure:"client_id"`
+	// TopicPrefix is the prefix of the state and availability topics.
+	TopicPrefix string `mapstructure:"topic_prefix"`
+	// Discovery publishes Home Assistant discovery payloads under
+	// DiscoveryPrefix so the sensors appear automatically.
+	Discovery       bool   `mapstructure:"discovery"`
+	DiscoveryPrefix string `mapstructure:"discovery_prefix"`
+	// Interval is how often the state is published in addition to the
+	// updates after every upload.
+	Interval time.Duration `mapstructure:"interval"`
+	// Commands subscribes to <CommandTopic>/<command> to control the
+	// watcher: rescan, pause, resume, scan (payload: a scan profile name)
+	// and upload (payload: a file path or URL).
+	Commands bool `mapstructure:"commands"`
+	// CommandTopic is the prefix of the command topics, by default
+	// <TopicPrefix>/command.
+	CommandTopic string `mapstructure:"command_topic"`
+	// Folder is the watch folder receiving uploaded files, by default the
+	// first one.
+	Folder string `mapstructure:"folder"`
+	// UploadPaths are the directories files may be uploaded from by path;
+	// uploads by path are refused when empty.
+	UploadPaths []string `mapstructure:"upload_paths"`
+	// ScanProfiles are the scans started by the scan command.
+	ScanProfiles []ScanProfile `mapstructure:"scan_profiles"`
+}
+
+// ScanProfile is a command, typically a scanimage or scanadf invocation,
+// run in a watch folder so that the scanned documents are uploaded.
+type ScanProfile struct {
+	Name    string   `mapstructure:"name"`
+	Command []string `mapstructure:"command"`
+	// Folder is the watch folder the command runs in, by default the
+	// first one.
+	Folder  string        `mapstructure:"folder"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
@@ -0,0 +1,108 @@
+package config
+
+import "time"
+
+// Notifications configures the notification backends used while watching.
+type Notifications struct {
+	// SummaryInterval is how often a summary is sent to the backends that
+	// subscribed to "summary" notifications.
+	SummaryInterval time.Duration `mapstructure:"summary_interval"`
+	// DocumentLinks waits for Paperless to consume each uploaded document
+	// so that upload notifications can link to it.
+	DocumentLinks bool      `mapstructure:"document_links"`
+	Ntfy          *Ntfy     `mapstructure:"ntfy"`
+	Gotify        *Gotify   `mapstructure:"gotify"`
+	Telegram      *Telegram `mapstructure:"telegram"`
+	Pushover      *Pushover `mapstructure:"pushover"`
+	Webhooks      []Webhook `mapstructure:"webhooks"`
+	Email         *Email    `mapstructure:"email"`
+}
+
+// NotifierOptions holds the settings shared by all notification backends.
+type NotifierOptions struct {
+	// Events selects the notifications sent: "failure", "upload",
+	// "summary" and "outage". Empty sends failures and outages.
+	Events []string `mapstructure:"events"`
+	// Templates overrides the message body per notification, as a
+	// text/template.
+	Templates map[string]string `mapstructure:"templates"`
+	// BatchInterval, if set, collects the notifications of this interval
+	// into a single message.
+	BatchInterval time.Duration `mapstructure:"batch_interval"`
+}
+
+// Ntfy configures notifications through ntfy.sh or a self-hosted ntfy.
+type Ntfy struct {
+	NotifierOptions `mapstructure:",squash"`
+	// URL is the ntfy server, https://ntfy.sh by default.
+	URL   string `mapstructure:"url"`
+	Topic string `mapstructure:"topic"`
+	// Token is an optional access token.
+	Token string `mapstructure:"token" secret:"true"`
+	// Priority is the message priority (min, low, default, high, urgent or
+	// 1-5); FailurePriority applies to failures and defaults to high.
+	Priority        string `mapstructure:"priority"`
+	FailurePriority string `mapstructure:"failure_priority"`
+}
+
+// Gotify configures notifications through a Gotify server.
+type Gotify struct {
+	NotifierOptions `mapstructure:",squash"`
+	URL             string `mapstructure:"url"`
+	// Token is the application token created in Gotify.
+	Token string `mapstructure:"token" secret:"true"`
+	// Priority is the message priority from 0 to 10, 5 by default;
+	// FailurePriority applies to failures and defaults to 8.
+	Priority        *int `mapstructure:"priority"`
+	FailurePriority *int `mapstructure:"failure_priority"`
+}
+
+// Telegram configures notifications sent by a Telegram bot.
+type Telegram struct {
+	NotifierOptions `mapstructure:",squash"`
+	// Token is the bot token from BotFather.
+	Token string `mapstructure:"token" secret:"true"`
+	// ChatID is the chat, group or channel the messages are sent to.
+	ChatID string `mapstructure:"chat_id"`
+}
+
+// Pushover configures notifications through Pushover.
+type Pushover struct {
+	NotifierOptions `mapstructure:",squash"`
+	// Token is the application API token and User the user or group key.
+	Token string `mapstructure:"token" secret:"true"`
+	User  string `mapstructure:"user" secret:"true"`
+	// Device optionally limits the messages to one device.
+	Device string `mapstructure:"device"`
+	// Priority is the message priority from -2 to 1, 0 by default;
+	// FailurePriority applies to failures and defaults to 1.
+	Priority        *int `mapstructure:"priority"`
+	FailurePriority *int `mapstructure:"failure_priority"`
+}
+
+// Webhook configures notifications posted to a Slack, Discord or Mattermost
+// incoming webhook.
+type Webhook struct {
+	NotifierOptions `mapstructure:",squash"`
+	// Name identifies the webhook in logs; it defaults to the format.
+	Name string `mapstructure:"name"`
+	// URL contains the webhook's token.
+	URL string `mapstructure:"url" secret:"true"`
+	// Format is "slack", "discord" or "mattermost".
+	Format string `mapstructure:"format"`
+}
+
+// Email configures notifications sent by mail. Adding "summary" to the
+// events turns the periodic summary into an email digest.
+type Email struct {
+	NotifierOptions `mapstructure:",squash"`
+	Host            string `mapstructure:"host"`
+	// Port defaults to 465 with implicit TLS and 587 otherwise.
+	Port     int      `mapstructure:"port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password" secret:"true"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	// TLS is "starttls" (the default), "tls" for implicit TLS or "none".
+	TLS string `mapstructure:"tls"`
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package config
+
+// platformSearchPaths returns the system-wide config locations.
+func platformSearchPaths() []string {
+	return []string{"/etc/paperless-uploader/"}
+}
@@ -0,0 +1,23 @@
+//go:build windows
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// platformSearchPaths returns the Windows config locations: the directory
+// containing the executable and %ProgramData%\PaperlessUploader. Services
+// started by the SCM run with an unhelpful working directory, so the current
+// directory alone is not enough.
+func platformSearchPaths() []string {
+	var paths []string
+	if exe, err := os.Executable(); err == nil {
+		paths = append(paths, filepath.Dir(exe))
+	}
+	if programData := os.Getenv("ProgramData"); programData != "" {
+		paths = append(paths, filepath.Join(programData, "PaperlessUploader"))
+	}
+	return paths
+}
@@ -0,0 +1,28 @@
+package config
+
+import "time"
+
+// Rclone configures downloading new files from any remote supported by
+// rclone, through the remote control API of a running "rclone rcd".
+type Rclone struct {
+	// URL is the address of the remote control API, e.g.
+	// "http://localhost:5572". Empty disables the source. rclone must
+	// serve the remotes with --rc-serve.
+	URL string `mapstructure:"url"`
+	// Username and Password are those given to rclone with --rc-user and
+	// --rc-pass.
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password" secret:"true"`
+	// Remote is the folder watched for new files, e.g. "dropbox:Scans".
+	Remote string `mapstructure:"remote"`
+	// Processed is the folder files are moved to once uploaded, e.g.
+	// "dropbox:Scans/done". Empty deletes them.
+	Processed string `mapstructure:"processed"`
+	// PollInterval is how often the remote folder is listed.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// DownloadDir holds the files while they are uploaded, by default a
+	// temporary directory.
+	DownloadDir string `mapstructure:"download_dir"`
+	// Tags are the names of the tags applied to the documents.
+	Tags []string `mapstructure:"tags"`
+}
@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+// RemovableDrives configures importing documents from USB drives and memory
+// cards as they are plugged in.
+type RemovableDrives struct {
+	// Enabled looks for newly mounted drives every PollInterval.
+	Enabled      bool          `mapstructure:"enabled"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// Paths are the folders on a drive searched for documents, e.g. "DCIM"
+	// or "SCANS". Empty searches the whole drive.
+	Paths []string `mapstructure:"paths"`
+	// Extensions are the file extensions imported, without the dot.
+	Extensions []string `mapstructure:"extensions"`
+	// MarkImported records uploaded files on the drive, so they are not
+	// imported again the next time it is plugged in.
+	MarkImported bool `mapstructure:"mark_imported"`
+	// Tags are the names of the tags applied to imported documents.
+	Tags []string `mapstructure:"tags"`
+}
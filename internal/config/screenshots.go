@@ -0,0 +1,22 @@
+package config
+
+import "time"
+
+// Screenshots configures the desktop mode turning screenshots and images
+// copied to the clipboard into PDF documents.
+type Screenshots struct {
+	// Watch converts new images in ScreenshotFolder.
+	Watch bool `mapstructure:"watch"`
+	// ScreenshotFolder is where screenshots are saved, by default the
+	// folder used by the operating system.
+	ScreenshotFolder string `mapstructure:"screenshot_folder"`
+	// Clipboard converts images copied to the clipboard, checked every
+	// PollInterval.
+	Clipboard    bool          `mapstructure:"clipboard"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// Tags are the names of the tags applied to the documents.
+	Tags []string `mapstructure:"tags"`
+	// Folder is the watch folder receiving the PDFs, by default the first
+	// one.
+	Folder string `mapstructure:"folder"`
+}
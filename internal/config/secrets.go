@@ -0,0 +1,71 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// credentialNames are parts of the header names whose values are
+// credentials, such as Authorization, Proxy-Authorization, Cookie, X-Api-Key
+// and CF-Access-Client-Secret.
+var credentialNames = []string{"auth", "cookie", "token", "key", "secret", "password", "session"}
+
+// Secrets returns the values of the settings tagged `secret:"true"`, such as
+// API keys, passwords and tokens, which must never be logged. Of tagged maps,
+// such as headers, only the values under credentialNames are returned, so
+// that harmless values like "gzip" are not redacted everywhere.
+func (c *Config) Secrets() []string {
+	var values []string
+	collectSecrets(reflect.ValueOf(c).Elem(), &values)
+	return values
+}
+
+func collectSecrets(v reflect.Value, values *[]string) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			collectSecrets(v.Elem(), values)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			collectSecrets(v.Index(i), values)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := v.Field(i)
+			if t.Field(i).Tag.Get("secret") == "true" {
+				switch field.Kind() {
+				case reflect.String:
+					if s := field.String(); s != "" {
+						*values = append(*values, s)
+					}
+					continue
+				case reflect.Map:
+					iter := field.MapRange()
+					for iter.Next() {
+						if !isCredential(iter.Key().String()) {
+							continue
+						}
+						if s, ok := iter.Value().Interface().(string); ok && s != "" {
+							*values = append(*values, s)
+						}
+					}
+					continue
+				}
+			}
+			collectSecrets(field, values)
+		}
+	}
+}
+
+// isCredential reports whether the header name carries a credential.
+func isCredential(name string) bool {
+	name = strings.ToLower(name)
+	for _, part := range credentialNames {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package config
+
+import "time"
+
+// SFTP configures downloading new files from a folder on an SFTP server.
+type SFTP struct {
+	// Host is the server, optionally with a port, e.g. "nas.lan:22". Empty
+	// disables the source.
+	Host     string `mapstructure:"host"`
+	Username string `mapstructure:"username"`
+	// Password authenticates with a password, PrivateKeyFile with a key,
+	// decrypted with Passphrase if it is encrypted.
+	Password       string `mapstructure:"password" secret:"true"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	Passphrase     string `mapstructure:"passphrase" secret:"true"`
+	// KnownHostsFile or HostKey, a fingerprint such as "SHA256:...", verify
+	// the server's host key. One of them is required.
+	KnownHostsFile string `mapstructure:"known_hosts_file"`
+	HostKey        string `mapstructure:"host_key"`
+	// RemotePath is the remote folder watched for new files.
+	RemotePath string `mapstructure:"remote_path"`
+	// ProcessedPath is the remote folder files are moved to once uploaded.
+	// Empty deletes them.
+	ProcessedPath string `mapstructure:"processed_path"`
+	// PollInterval is how often the remote folder is listed.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// Folder is the watch folder whose settings downloads are uploaded
+	// with; it defaults to the first watch folder.
+	Folder string `mapstructure:"folder"`
+}
@@ -0,0 +1,30 @@
+package config
+
+// SMTPReceiver configures the embedded SMTP listener for scanners that can
+// only "scan to email".
+type SMTPReceiver struct {
+	// Listen is the listen address, e.g. ":2525". Empty disables the
+	// receiver.
+	Listen string `mapstructure:"listen"`
+	// Hostname is announced to clients; it defaults to the host name.
+	Hostname string `mapstructure:"hostname"`
+	// MaxMessageSize limits the size of a message, as accepted by
+	// ParseSize.
+	MaxMessageSize string `mapstructure:"max_message_size"`
+	// Routes select the watch folder receiving the attachments by sender.
+	Routes []SMTPRoute `mapstructure:"routes"`
+	// Folder receives the attachments of senders without a matching route;
+	// it defaults to the first watch folder.
+	Folder string `mapstructure:"folder"`
+	// RejectUnknownSenders rejects mail from senders without a matching
+	// route instead.
+	RejectUnknownSenders bool `mapstructure:"reject_unknown_senders"`
+}
+
+// SMTPRoute delivers the attachments of mail from matching senders to a
+// watch folder.
+type SMTPRoute struct {
+	// Sender is an address or a pattern such as "*@scanner.lan".
+	Sender string `mapstructure:"sender"`
+	Folder string `mapstructure:"folder"`
+}
@@ -0,0 +1,18 @@
+package config
+
+// TLS configures the TLS connections to Paperless.
+type TLS struct {
+	// PinnedCertSHA256 are SHA-256 fingerprints of certificates, hex
+	// encoded, and PinnedSPKISHA256 those of public keys, base64 encoded as
+	// for HPKP. If any is set, the server's certificate or one of its
+	// issuers must match one of them in addition to being trusted.
+	PinnedCertSHA256 []string `mapstructure:"pinned_cert_sha256"`
+	PinnedSPKISHA256 []string `mapstructure:"pinned_spki_sha256"`
+	// MinVersion is the lowest TLS version accepted, "1.2" or "1.3".
+	// Empty keeps the default, TLS 1.2.
+	MinVersion string `mapstructure:"min_version"`
+	// CipherSuites limits the cipher suites of TLS 1.2 connections to
+	// those named, e.g. "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384". The suites
+	// of TLS 1.3 are not configurable.
+	CipherSuites []string `mapstructure:"cipher_suites"`
+}
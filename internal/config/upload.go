@@ -0,0 +1,16 @@
+package config
+
+// UploadReceiver configures the HTTP endpoint accepting documents posted by
+// phones, shortcuts and browser extensions.
+type UploadReceiver struct {
+	// Listen is the listen address of POST /upload, e.g. ":8766". It may
+	// equal StatusListen. Empty disables the endpoint.
+	Listen string `mapstructure:"listen"`
+	// Token is the bearer token clients must send.
+	Token string `mapstructure:"token" secret:"true"`
+	// MaxFileSize limits the size of a request, as accepted by ParseSize.
+	MaxFileSize string `mapstructure:"max_file_size"`
+	// Folder is the watch folder received files are stored in; it defaults
+	// to the first watch folder.
+	Folder string `mapstructure:"folder"`
+}
@@ -0,0 +1,17 @@
+package config
+
+// WebUI configures the local web interface for uploads and monitoring.
+type WebUI struct {
+	// Listen is the listen address, e.g. "127.0.0.1:8767". It may equal
+	// StatusListen. Empty disables the web UI.
+	Listen string `mapstructure:"listen"`
+	// Username and Password protect the web UI with basic authentication.
+	// Empty leaves it open to everyone who can reach Listen.
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password" secret:"true"`
+	// MaxFileSize limits the size of an upload, as accepted by ParseSize.
+	MaxFileSize string `mapstructure:"max_file_size"`
+	// Folder is the watch folder uploaded files are stored in; it defaults
+	// to the first watch folder.
+	Folder string `mapstructure:"folder"`
+}
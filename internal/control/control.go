@@ -0,0 +1,300 @@
+// Package control serves the control socket of a running watcher, a unix
+// socket or a named pipe on Windows, through which the CLI queries its
+// status, pauses and resumes processing, triggers rescans, flushes delayed
+// files, reloads the configuration and retries failed files without a
+// restart.
+//
+// The protocol is plain HTTP with JSON responses, so the socket can also be
+// used with "curl --unix-socket".
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// ErrNotRunning is returned by the client when no instance serves the
+// socket.
+var ErrNotRunning = errors.New("no running instance serves the control socket")
+
+// Watcher is the part of a running watcher managed through the socket.
+type Watcher interface {
+	Status() watcher.Status
+	Pause()
+	Resume()
+	Rescan()
+	Flush() int
+}
+
+// RetryResult reports the outcome of retrying the failed folder.
+type RetryResult struct {
+	Succeeded int            `json:"succeeded"`
+	Failed    []RetryFailure `json:"failed"`
+}
+
+// RetryFailure is a failed file that failed again.
+type RetryFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// Server serves the control socket.
+type Server struct {
+	// Reload loads the configuration again and restarts the watcher with
+	// it. It returns an error, and keeps the running watcher, if the new
+	// configuration is invalid.
+	Reload func() error
+	// RetryFailed uploads the files in the failed folder again.
+	RetryFailed func() (RetryResult, error)
+
+	path string
+	srv  *http.Server
+	ln   net.Listener
+
+	mu sync.Mutex
+	w  Watcher
+}
+
+// NewServer creates a server for the socket at path. On Windows, path is
+// the name of a pipe, with or without the \\.\pipe\ prefix.
+func NewServer(path string) *Server {
+	s := &Server{path: path}
+	s.srv = &http.Server{Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+// SetWatcher sets the watcher managed through the socket. It is replaced
+// by the new one on every reload and nil while none is running.
+func (s *Server) SetWatcher(w Watcher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.w = w
+}
+
+func (s *Server) watcher() Watcher {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w
+}
+
+// Start listens on the socket and serves requests in the background. A
+// socket left behind by an instance that did not shut down cleanly is
+// replaced, but not one that is still served.
+func (s *Server) Start() error {
+	ln, err := listen(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket %s: %w", s.path, err)
+	}
+	s.ln = ln
+	logging.Infof("Control socket listening on %s", s.path)
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logging.Errorf("Control socket failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the server and removes the socket.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.srv.Shutdown(ctx)
+	// Serve may not have taken over the listener yet.
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	return err
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.withWatcher(func(w Watcher) (any, error) {
+		return w.Status(), nil
+	}))
+	mux.HandleFunc("POST /pause", s.withWatcher(func(w Watcher) (any, error) {
+		w.Pause()
+		return w.Status(), nil
+	}))
+	mux.HandleFunc("POST /resume", s.withWatcher(func(w Watcher) (any, error) {
+		w.Resume()
+		return w.Status(), nil
+	}))
+	mux.HandleFunc("POST /rescan", s.withWatcher(func(w Watcher) (any, error) {
+		w.Rescan()
+		return map[string]bool{"rescan": true}, nil
+	}))
+	mux.HandleFunc("POST /flush", s.withWatcher(func(w Watcher) (any, error) {
+		return map[string]int{"flushed": w.Flush()}, nil
+	}))
+	mux.HandleFunc("POST /reload", func(w http.ResponseWriter, r *http.Request) {
+		if s.Reload == nil {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "reloading is not supported"})
+			return
+		}
+		if err := s.Reload(); err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			return
+		}
+		logging.Infof("Reloading the configuration on request of the control socket")
+		writeJSON(w, http.StatusOK, map[string]bool{"reloaded": true})
+	})
+	mux.HandleFunc("POST /retry-failed", func(w http.ResponseWriter, r *http.Request) {
+		if s.RetryFailed == nil {
+			writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "retrying is not supported"})
+			return
+		}
+		result, err := s.RetryFailed()
+		if err != nil {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+	return mux
+}
+
+// withWatcher serves the result of fn for the current watcher.
+func (s *Server) withWatcher(fn func(Watcher) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		current := s.watcher()
+		if current == nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "the watcher is restarting"})
+			return
+		}
+		result, err := fn(current)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Client talks to the control socket of a running instance.
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a client for the socket at path.
+func NewClient(path string) *Client {
+	return &Client{http: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			conn, err := dial(ctx, path)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrNotRunning, err)
+			}
+			return conn, nil
+		},
+	}}}
+}
+
+// Status returns the status of the running watcher.
+func (c *Client) Status() (*watcher.Status, error) {
+	var status watcher.Status
+	if err := c.do("GET", "/status", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Pause pauses processing and returns the new status.
+func (c *Client) Pause() (*watcher.Status, error) {
+	var status watcher.Status
+	if err := c.do("POST", "/pause", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Resume resumes processing and returns the new status.
+func (c *Client) Resume() (*watcher.Status, error) {
+	var status watcher.Status
+	if err := c.do("POST", "/resume", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Rescan makes the watcher look for files it did not pick up.
+func (c *Client) Rescan() error {
+	return c.do("POST", "/rescan", nil)
+}
+
+// Flush queues the files waiting for their settle or retry delay and
+// returns their number.
+func (c *Client) Flush() (int, error) {
+	var result struct {
+		Flushed int `json:"flushed"`
+	}
+	err := c.do("POST", "/flush", &result)
+	return result.Flushed, err
+}
+
+// Reload makes the instance load its configuration again. It returns once
+// the new configuration was validated.
+func (c *Client) Reload() error {
+	return c.do("POST", "/reload", nil)
+}
+
+// RetryFailed makes the instance upload the files in its failed folder
+// again.
+func (c *Client) RetryFailed() (*RetryResult, error) {
+	var result RetryResult
+	if err := c.do("POST", "/retry-failed", &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) do(method, path string, result any) error {
+	req, err := http.NewRequest(method, "http://control"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// The URL is made up, so it is left out of the error.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(data, &body) != nil || body.Error == "" {
+			body.Error = strings.TrimSpace(string(data))
+		}
+		return fmt.Errorf("control socket returned %s: %s", resp.Status, body.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode control socket response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package control
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeWatcher struct {
+	paused   bool
+	rescans  int
+	inFlight int
+}
+
+func (f *fakeWatcher) Status() watcher.Status {
+	return watcher.Status{Watching: true, Paused: f.paused, InFlight: f.inFlight}
+}
+func (f *fakeWatcher) Pause()     { f.paused = true }
+func (f *fakeWatcher) Resume()    { f.paused = false }
+func (f *fakeWatcher) Rescan()    { f.rescans++ }
+func (f *fakeWatcher) Flush() int { return 2 }
+
+func TestControl(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "control.sock")
+	client := NewClient(path)
+	_, err := client.Status()
+	assert.ErrorIs(t, err, ErrNotRunning)
+
+	var reloads int
+	srv := NewServer(path)
+	srv.Reload = func() error {
+		reloads++
+		if reloads > 1 {
+			return errors.New("invalid api_key")
+		}
+		return nil
+	}
+	srv.RetryFailed = func() (RetryResult, error) {
+		return RetryResult{Succeeded: 1, Failed: []RetryFailure{{Path: "failed/a.pdf", Error: "timeout"}}}, nil
+	}
+	assert.NoError(t, srv.Start())
+	defer srv.Shutdown(context.Background())
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+
+	// A second instance must not take over the socket.
+	assert.ErrorContains(t, NewServer(path).Start(), "another instance")
+
+	_, err = client.Status()
+	assert.ErrorContains(t, err, "restarting")
+
+	w := &fakeWatcher{inFlight: 1}
+	srv.SetWatcher(w)
+	status, err := client.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, status.InFlight)
+
+	status, err = client.Pause()
+	assert.NoError(t, err)
+	assert.True(t, status.Paused)
+	status, err = client.Resume()
+	assert.NoError(t, err)
+	assert.False(t, status.Paused)
+
+	assert.NoError(t, client.Rescan())
+	assert.Equal(t, 1, w.rescans)
+	flushed, err := client.Flush()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, flushed)
+
+	assert.NoError(t, client.Reload())
+	assert.EqualError(t, client.Reload(), "control socket returned 422 Unprocessable Entity: invalid api_key")
+
+	result, err := client.RetryFailed()
+	assert.NoError(t, err)
+	assert.Equal(t, &RetryResult{Succeeded: 1, Failed: []RetryFailure{{Path: "failed/a.pdf", Error: "timeout"}}}, result)
+}
+
+func TestStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "control.sock")
+	// A crashed instance leaves its socket behind.
+	ln, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	assert.FileExists(t, path)
+
+	srv := NewServer(path)
+	assert.NoError(t, srv.Start())
+	srv.Shutdown(context.Background())
+	assert.NoFileExists(t, path)
+
+	assert.NoError(t, os.WriteFile(path, nil, 0644))
+	assert.ErrorContains(t, NewServer(path).Start(), "not a socket")
+}
@@ -0,0 +1,30 @@
+package control
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// pipePrefix is the namespace of local named pipes.
+const pipePrefix = `\\.\pipe\`
+
+// pipeName returns the full name of the pipe path.
+func pipeName(path string) string {
+	if strings.HasPrefix(strings.ToLower(path), pipePrefix) {
+		return path
+	}
+	return pipePrefix + path
+}
+
+// listen creates the pipe with the default security descriptor, which
+// grants access to administrators, LocalSystem and the creator only.
+func listen(path string) (net.Listener, error) {
+	return winio.ListenPipe(pipeName(path), nil)
+}
+
+func dial(ctx context.Context, path string) (net.Conn, error) {
+	return winio.DialPipeContext(ctx, pipeName(path))
+}
@@ -0,0 +1,256 @@
+// Package deferred applies the metadata Paperless does not accept with an
+// upload, such as notes, custom field values and permissions, to documents
+// once they were consumed.
+package deferred
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+)
+
+// Fields are the fields of the note and custom field templates.
+type Fields struct {
+	// File is the name of the uploaded file, Path its full path.
+	File, Path string
+	// Folder is the watch folder the file was found in.
+	Folder     string
+	DocumentID int
+}
+
+// field is a custom field value to set.
+type field struct {
+	name  string
+	value *template.Template
+}
+
+// Applier applies the metadata of an AfterConsumption configuration.
+type Applier struct {
+	notes        []*template.Template
+	fields       []field
+	owner        string
+	viewUsers    []string
+	viewGroups   []string
+	changeUsers  []string
+	changeGroups []string
+}
+
+// New compiles the templates of cfg.
+func New(cfg config.AfterConsumption) (*Applier, error) {
+	a := &Applier{
+		owner:        cfg.Owner,
+		viewUsers:    cfg.ViewUsers,
+		viewGroups:   cfg.ViewGroups,
+		changeUsers:  cfg.ChangeUsers,
+		changeGroups: cfg.ChangeGroups,
+	}
+	for i, note := range cfg.Notes {
+		tmpl, err := template.New(fmt.Sprintf("note %d", i+1)).Option("missingkey=error").Parse(note)
+		if err != nil {
+			return nil, fmt.Errorf("invalid note: %w", err)
+		}
+		a.notes = append(a.notes, tmpl)
+	}
+	for name, value := range cfg.CustomFields {
+		tmpl, err := template.New(fmt.Sprintf("custom field %q", name)).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of custom field %q: %w", name, err)
+		}
+		a.fields = append(a.fields, field{name: name, value: tmpl})
+	}
+	sort.Slice(a.fields, func(i, j int) bool { return a.fields[i].name < a.fields[j].name })
+	return a, nil
+}
+
+// Apply sets the metadata on the document created from the file at path,
+// found in folder. Custom fields, owner and permissions are set with one
+// update, then the notes are added. Names are resolved on every call, so
+// fields, users and groups created in the meantime are found.
+func (a *Applier) Apply(client *paperless.Client, documentID int, folder, path string) error {
+	data := Fields{File: filepath.Base(path), Path: path, Folder: folder, DocumentID: documentID}
+	var update paperless.DocumentUpdate
+	changed := false
+	if len(a.fields) > 0 {
+		values, err := a.customFields(client, documentID, data)
+		if err != nil {
+			return err
+		}
+		update.CustomFields, changed = values, true
+	}
+	if a.owner != "" || len(a.viewUsers)+len(a.viewGroups)+len(a.changeUsers)+len(a.changeGroups) > 0 {
+		if err := a.permissions(client, &update); err != nil {
+			return err
+		}
+		changed = true
+	}
+	if changed {
+		if err := client.UpdateDocument(documentID, update); err != nil {
+			return err
+		}
+	}
+	for _, tmpl := range a.notes {
+		note, err := render(tmpl, data)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(note) == "" {
+			continue
+		}
+		if err := client.AddNote(documentID, note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// customFields returns the custom fields of the document with the
+// configured values set. Field names match regardless of case, as the
+// configuration lowercases them.
+func (a *Applier) customFields(client *paperless.Client, documentID int, data Fields) ([]paperless.CustomFieldValue, error) {
+	defs, err := client.GetCustomFields()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := client.GetDocument(documentID)
+	if err != nil {
+		return nil, err
+	}
+	values := doc.CustomFields
+	for _, f := range a.fields {
+		var def *paperless.CustomField
+		for i := range defs {
+			if strings.EqualFold(defs[i].Name, f.name) {
+				def = &defs[i]
+				break
+			}
+		}
+		if def == nil {
+			return nil, fmt.Errorf("custom field %q not found", f.name)
+		}
+		text, err := render(f.value, data)
+		if err != nil {
+			return nil, err
+		}
+		value, err := convert(*def, text)
+		if err != nil {
+			return nil, err
+		}
+		set := false
+		for i := range values {
+			if values[i].Field == def.ID {
+				values[i].Value, set = value, true
+			}
+		}
+		if !set {
+			values = append(values, paperless.CustomFieldValue{Field: def.ID, Value: value})
+		}
+	}
+	return values, nil
+}
+
+// convert converts text to the type of the custom field. An empty text
+// clears the field.
+func convert(def paperless.CustomField, text string) (any, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+	var (
+		value any
+		err   error
+	)
+	switch def.DataType {
+	case "boolean":
+		value, err = strconv.ParseBool(text)
+	case "integer", "documentlink":
+		value, err = strconv.Atoi(text)
+	case "float":
+		value, err = strconv.ParseFloat(text, 64)
+	default:
+		value = text
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value %q of custom field %q", def.DataType, text, def.Name)
+	}
+	return value, nil
+}
+
+// permissions resolves the owner, users and groups into update.
+func (a *Applier) permissions(client *paperless.Client, update *paperless.DocumentUpdate) error {
+	var users map[string]int
+	if a.owner != "" || len(a.viewUsers)+len(a.changeUsers) > 0 {
+		list, err := client.GetUsers()
+		if err != nil {
+			return err
+		}
+		users = make(map[string]int, len(list))
+		for _, u := range list {
+			users[strings.ToLower(u.Username)] = u.ID
+		}
+	}
+	var groups map[string]int
+	if len(a.viewGroups)+len(a.changeGroups) > 0 {
+		list, err := client.GetGroups()
+		if err != nil {
+			return err
+		}
+		groups = make(map[string]int, len(list))
+		for _, g := range list {
+			groups[strings.ToLower(g.Name)] = g.ID
+		}
+	}
+	if a.owner != "" {
+		id, ok := users[strings.ToLower(a.owner)]
+		if !ok {
+			return fmt.Errorf("user %q not found", a.owner)
+		}
+		update.Owner = &id
+	}
+	if len(a.viewUsers)+len(a.viewGroups)+len(a.changeUsers)+len(a.changeGroups) == 0 {
+		return nil
+	}
+	var perms paperless.Permissions
+	var err error
+	if perms.View.Users, err = resolve("user", users, a.viewUsers); err != nil {
+		return err
+	}
+	if perms.View.Groups, err = resolve("group", groups, a.viewGroups); err != nil {
+		return err
+	}
+	if perms.Change.Users, err = resolve("user", users, a.changeUsers); err != nil {
+		return err
+	}
+	if perms.Change.Groups, err = resolve("group", groups, a.changeGroups); err != nil {
+		return err
+	}
+	update.SetPermissions = &perms
+	return nil
+}
+
+// resolve returns the IDs of names, never nil so that the server clears
+// permissions not configured.
+func resolve(kind string, ids map[string]int, names []string) ([]int, error) {
+	resolved := []int{}
+	for _, name := range names {
+		id, ok := ids[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("%s %q not found", kind, name)
+		}
+		resolved = append(resolved, id)
+	}
+	return resolved, nil
+}
+
+func render(tmpl *template.Template, data Fields) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
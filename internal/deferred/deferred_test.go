@@ -0,0 +1,101 @@
+package deferred
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	var update map[string]any
+	var notes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/custom_fields/":
+			w.Write([]byte(`{"results": [{"id": 1, "name": "Source", "data_type": "string"}, {"id": 2, "name": "Reviewed", "data_type": "boolean"}, {"id": 3, "name": "Pages", "data_type": "integer"}]}`))
+		case "GET /api/documents/42/":
+			w.Write([]byte(`{"id": 42, "custom_fields": [{"field": 3, "value": 7}, {"field": 1, "value": "old"}]}`))
+		case "GET /api/users/":
+			w.Write([]byte(`{"results": [{"id": 5, "username": "Alice"}, {"id": 6, "username": "bob"}]}`))
+		case "GET /api/groups/":
+			w.Write([]byte(`{"results": [{"id": 9, "name": "family"}]}`))
+		case "PATCH /api/documents/42/":
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+			w.Write([]byte(`{"id": 42}`))
+		case "POST /api/documents/42/notes/":
+			var note struct{ Note string }
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&note))
+			notes = append(notes, note.Note)
+			w.Write([]byte(`[]`))
+		default:
+			body, _ := io.ReadAll(r.Body)
+			t.Errorf("unexpected request %s %s: %s", r.Method, r.URL.Path, body)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := paperless.NewClient(server.URL, "test_key")
+
+	a, err := New(config.AfterConsumption{
+		Notes:        []string{"Uploaded from {{.Folder}}", "{{if false}}skipped{{end}}"},
+		CustomFields: map[string]string{"source": "{{.File}}", "reviewed": "false"},
+		Owner:        "alice",
+		ViewGroups:   []string{"Family"},
+		ChangeUsers:  []string{"bob"},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, a.Apply(client, 42, "/scans", "/scans/bill.pdf"))
+
+	assert.Equal(t, []any{
+		map[string]any{"field": float64(3), "value": float64(7)},
+		map[string]any{"field": float64(1), "value": "bill.pdf"},
+		map[string]any{"field": float64(2), "value": false},
+	}, update["custom_fields"])
+	assert.Equal(t, float64(5), update["owner"])
+	assert.Equal(t, map[string]any{
+		"view":   map[string]any{"users": []any{}, "groups": []any{float64(9)}},
+		"change": map[string]any{"users": []any{float64(6)}, "groups": []any{}},
+	}, update["set_permissions"])
+	assert.Equal(t, []string{"Uploaded from /scans"}, notes)
+}
+
+func TestApplyErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/custom_fields/":
+			w.Write([]byte(`{"results": [{"id": 3, "name": "Pages", "data_type": "integer"}]}`))
+		case "/api/documents/42/":
+			w.Write([]byte(`{"id": 42}`))
+		case "/api/users/":
+			w.Write([]byte(`{"results": []}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	client := paperless.NewClient(server.URL, "test_key")
+
+	for _, tt := range []struct {
+		cfg config.AfterConsumption
+		err string
+	}{
+		{config.AfterConsumption{CustomFields: map[string]string{"pages": "many"}}, `invalid integer value "many" of custom field "Pages"`},
+		{config.AfterConsumption{CustomFields: map[string]string{"missing": "x"}}, `custom field "missing" not found`},
+		{config.AfterConsumption{Owner: "carol"}, `user "carol" not found`},
+		{config.AfterConsumption{Notes: []string{"{{.Unknown}}"}}, `failed to render note 1`},
+	} {
+		a, err := New(tt.cfg)
+		assert.NoError(t, err)
+		assert.ErrorContains(t, a.Apply(client, 42, "/scans", "/scans/bill.pdf"), tt.err)
+	}
+
+	_, err := New(config.AfterConsumption{Notes: []string{"{{"}})
+	assert.ErrorContains(t, err, "invalid note")
+}
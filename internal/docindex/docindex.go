@@ -0,0 +1,246 @@
+// Package docindex keeps a local SQLite mirror of the documents in
+// Paperless with the checksums of their originals, so checks whether a file
+// was uploaded already need no request and work while the server is
+// unreachable. The mirror is refreshed incrementally: only documents
+// modified since the last refresh are fetched.
+package docindex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS documents (
+	id INTEGER PRIMARY KEY,
+	title TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	original_file_name TEXT NOT NULL,
+	added TEXT NOT NULL,
+	modified TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS documents_checksum ON documents (checksum);
+CREATE TABLE IF NOT EXISTS sync (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// Keys of the sync table.
+const (
+	// keyModified is the modification time of the last document mirrored,
+	// from which the next refresh continues.
+	keyModified = "modified"
+	// keyRefreshed is when the last refresh completed.
+	keyRefreshed = "refreshed"
+)
+
+// Document is a mirrored document.
+type Document struct {
+	ID    int
+	Title string
+	// Checksum is the MD5 checksum of the original file, in hex.
+	Checksum         string
+	OriginalFileName string
+	Added            string
+	Modified         string
+}
+
+// Index is the local mirror. It is safe for concurrent use.
+type Index struct {
+	db *sql.DB
+}
+
+// Open opens the mirror at path, creating it and its directory if
+// necessary.
+func Open(path string) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create document index directory: %w", err)
+	}
+	// The busy timeout lets the watcher and a CLI command share the file.
+	db, err := sql.Open("sqlite", "file:"+filepath.ToSlash(path)+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open document index: %w", err)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open document index: %w", err)
+	}
+	return &Index{db: db}, nil
+}
+
+// Close closes the mirror.
+func (x *Index) Close() error {
+	return x.db.Close()
+}
+
+// Stats summarizes a refresh.
+type Stats struct {
+	// Updated counts the documents added to or changed in the mirror,
+	// Removed those deleted from Paperless since.
+	Updated, Removed int
+	// Total is the number of documents in the mirror afterwards.
+	Total int
+}
+
+// Refresh mirrors the documents added or modified since the last refresh
+// and drops the deleted ones. The progress is kept after every document, so
+// an interrupted refresh continues where it stopped.
+func (x *Index) Refresh(ctx context.Context, client *paperless.Client) (Stats, error) {
+	var stats Stats
+	since, err := x.get(keyModified)
+	if err != nil {
+		return stats, err
+	}
+	// Documents modified at the same time as the last one mirrored may
+	// not have been seen, so the listing includes that time; documents
+	// that did not change are skipped.
+	docs, err := client.ListDocuments(paperless.DocumentFilter{ModifiedSince: since, Ordering: "modified"})
+	if err != nil {
+		return stats, fmt.Errorf("failed to list documents: %w", err)
+	}
+	for _, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		var modified string
+		err := x.db.QueryRow("SELECT modified FROM documents WHERE id = ?", doc.ID).Scan(&modified)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return stats, err
+		}
+		if err == nil && modified == doc.Modified {
+			continue
+		}
+		md, err := client.GetDocumentMetadata(doc.ID)
+		if err != nil {
+			return stats, err
+		}
+		if err := x.put(doc, md.OriginalChecksum); err != nil {
+			return stats, err
+		}
+		stats.Updated++
+	}
+
+	ids, err := client.DocumentIDs()
+	if err != nil {
+		return stats, err
+	}
+	if stats.Removed, err = x.prune(ids); err != nil {
+		return stats, err
+	}
+	if err := x.set(keyRefreshed, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return stats, err
+	}
+	stats.Total, err = x.Count()
+	return stats, err
+}
+
+// put stores doc and advances the refresh to its modification time.
+func (x *Index) put(doc paperless.Document, checksum string) error {
+	tx, err := x.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO documents (id, title, checksum, original_file_name, added, modified) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET title = excluded.title, checksum = excluded.checksum,
+		original_file_name = excluded.original_file_name, added = excluded.added, modified = excluded.modified`,
+		doc.ID, doc.Title, strings.ToLower(checksum), doc.OriginalFileName, doc.Added, doc.Modified)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT OR REPLACE INTO sync (key, value) VALUES (?, ?)", keyModified, doc.Modified); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// prune removes the documents that are not in ids.
+func (x *Index) prune(ids []int) (int, error) {
+	keep := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		keep[id] = true
+	}
+	rows, err := x.db.Query("SELECT id FROM documents")
+	if err != nil {
+		return 0, err
+	}
+	var gone []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if !keep[id] {
+			gone = append(gone, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, id := range gone {
+		if _, err := x.db.Exec("DELETE FROM documents WHERE id = ?", id); err != nil {
+			return 0, err
+		}
+	}
+	return len(gone), nil
+}
+
+// Lookup returns the documents whose original has the MD5 checksum sum.
+func (x *Index) Lookup(sum string) ([]Document, error) {
+	rows, err := x.db.Query("SELECT id, title, checksum, original_file_name, added, modified FROM documents WHERE checksum = ? ORDER BY id", strings.ToLower(sum))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var docs []Document
+	for rows.Next() {
+		var d Document
+		if err := rows.Scan(&d.ID, &d.Title, &d.Checksum, &d.OriginalFileName, &d.Added, &d.Modified); err != nil {
+			return nil, err
+		}
+		docs = append(docs, d)
+	}
+	return docs, rows.Err()
+}
+
+// Count returns the number of mirrored documents.
+func (x *Index) Count() (int, error) {
+	var n int
+	err := x.db.QueryRow("SELECT COUNT(*) FROM documents").Scan(&n)
+	return n, err
+}
+
+// Refreshed returns when the last refresh completed, zero if none did.
+func (x *Index) Refreshed() (time.Time, error) {
+	value, err := x.get(keyRefreshed)
+	if err != nil || value == "" {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (x *Index) get(key string) (string, error) {
+	var value string
+	err := x.db.QueryRow("SELECT value FROM sync WHERE key = ?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return value, err
+}
+
+func (x *Index) set(key, value string) error {
+	_, err := x.db.Exec("INSERT OR REPLACE INTO sync (key, value) VALUES (?, ?)", key, value)
+	return err
+}
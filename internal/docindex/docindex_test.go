@@ -0,0 +1,104 @@
+package docindex
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDocument struct {
+	title, checksum, modified string
+}
+
+func TestRefresh(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		documents = map[int]fakeDocument{
+			1: {"Power bill", "AAAA", "2024-05-01T10:00:00Z"},
+			2: {"Lease", "bbbb", "2024-05-02T10:00:00Z"},
+		}
+		metadataRequests int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/metadata/") {
+			metadataRequests++
+			var id int
+			fmt.Sscanf(r.URL.Path, "/api/documents/%d/metadata/", &id)
+			fmt.Fprintf(w, `{"original_checksum": %q}`, documents[id].checksum)
+			return
+		}
+		if r.URL.Query().Get("fields") == "id" {
+			var ids []string
+			for id := range documents {
+				ids = append(ids, fmt.Sprint(id))
+			}
+			fmt.Fprintf(w, `{"all": [%s], "results": []}`, strings.Join(ids, ","))
+			return
+		}
+		since := r.URL.Query().Get("modified__gte")
+		var results []string
+		for id := 1; id <= 10; id++ {
+			if d, ok := documents[id]; ok && d.modified >= since {
+				results = append(results, fmt.Sprintf(`{"id": %d, "title": %q, "modified": %q}`, id, d.title, d.modified))
+			}
+		}
+		fmt.Fprintf(w, `{"next": null, "results": [%s]}`, strings.Join(results, ","))
+	}))
+	defer server.Close()
+	client := paperless.NewClient(server.URL, "test_key")
+
+	path := filepath.Join(t.TempDir(), "index", "documents.db")
+	x, err := Open(path)
+	assert.NoError(t, err)
+	refreshed, err := x.Refreshed()
+	assert.NoError(t, err)
+	assert.True(t, refreshed.IsZero())
+
+	stats, err := x.Refresh(context.Background(), client)
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Updated: 2, Total: 2}, stats)
+	docs, err := x.Lookup("aaaa")
+	assert.NoError(t, err)
+	assert.Equal(t, []Document{{ID: 1, Title: "Power bill", Checksum: "aaaa", Modified: "2024-05-01T10:00:00Z"}}, docs)
+	assert.NoError(t, x.Close())
+
+	// Only changes are fetched on the next refresh, which also drops
+	// deleted documents.
+	mu.Lock()
+	delete(documents, 1)
+	documents[2] = fakeDocument{"Lease (signed)", "cccc", "2024-05-03T10:00:00Z"}
+	documents[3] = fakeDocument{"Receipt", "dddd", "2024-05-03T10:00:00Z"}
+	metadataRequests = 0
+	mu.Unlock()
+	x, err = Open(path)
+	assert.NoError(t, err)
+	defer x.Close()
+	stats, err = x.Refresh(context.Background(), client)
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Updated: 2, Removed: 1, Total: 2}, stats)
+	assert.Equal(t, 2, metadataRequests)
+	docs, _ = x.Lookup("AAAA")
+	assert.Empty(t, docs)
+	docs, _ = x.Lookup("cccc")
+	assert.Equal(t, "Lease (signed)", docs[0].Title)
+
+	// Documents modified at the time of the last one are checked again,
+	// but not fetched unless they changed.
+	stats, err = x.Refresh(context.Background(), client)
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Total: 2}, stats)
+	assert.Equal(t, 2, metadataRequests)
+	refreshed, err = x.Refreshed()
+	assert.NoError(t, err)
+	assert.False(t, refreshed.IsZero())
+}
@@ -0,0 +1,385 @@
+// Package export backs up the documents of a Paperless instance into a local
+// folder structure. Exports are incremental: a state file in the export
+// folder records the exported documents, and only documents modified since
+// the last export are downloaded again.
+package export
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// DefaultLayout files documents by correspondent and year.
+const DefaultLayout = "{{.Correspondent}}/{{.Year}}/{{.Created}} {{.Title}}"
+
+// StateFile is the name of the state file in the export folder.
+const StateFile = ".paperless-export.json"
+
+// saveEvery is the number of exported documents after which the state is
+// saved, so an interrupted export does not start over.
+const saveEvery = 50
+
+// Fields are the fields of the layout template. Fields Paperless has no
+// value for are empty; empty path elements are dropped.
+type Fields struct {
+	ID            int
+	Title         string
+	Correspondent string
+	DocumentType  string
+	StoragePath   string
+	// Created is the creation date as YYYY-MM-DD, also split into Year,
+	// Month and Day.
+	Created          string
+	Year, Month, Day string
+	ASN              string
+	// OriginalName is the name of the uploaded file without extension.
+	OriginalName string
+}
+
+// Exporter downloads documents into Dir.
+type Exporter struct {
+	Client *paperless.Client
+	Dir    string
+	// Filter selects the documents to export.
+	Filter paperless.DocumentFilter
+	// Layout is a text/template of the path of a document relative to Dir,
+	// without extension, using Fields. Empty uses DefaultLayout.
+	Layout string
+	// Original exports the original files instead of the archived (OCRed)
+	// versions.
+	Original bool
+	// Prune removes exported documents that were deleted from Paperless.
+	Prune bool
+	// Progress, if set, is called for every document downloaded or
+	// removed, with its path relative to Dir.
+	Progress func(id int, path string, removed bool, err error)
+}
+
+// Stats summarizes an export.
+type Stats struct {
+	Exported, Unchanged, Removed, Failed int
+}
+
+// state is the content of the state file.
+type state struct {
+	// Key identifies the settings of the export. The documents are all
+	// listed again when it changes.
+	Key string `json:"key"`
+	// Modified is the modification time of the last document exported,
+	// from which the next export continues.
+	Modified  string        `json:"modified,omitempty"`
+	Documents map[int]entry `json:"documents"`
+}
+
+// entry is an exported document.
+type entry struct {
+	// Path is relative to the export folder, with forward slashes.
+	Path     string `json:"path"`
+	Modified string `json:"modified"`
+}
+
+// names maps the IDs of correspondents, document types and storage paths
+// to their names.
+type names struct {
+	correspondents, documentTypes, storagePaths map[int]string
+}
+
+// Run exports the documents added or modified since the last run. Documents
+// that fail are counted and retried by the next run.
+func (e *Exporter) Run(ctx context.Context) (Stats, error) {
+	var stats Stats
+	layout := e.Layout
+	if layout == "" {
+		layout = DefaultLayout
+	}
+	tmpl, err := template.New("layout").Option("missingkey=error").Parse(layout)
+	if err != nil {
+		return stats, fmt.Errorf("invalid layout: %v", err)
+	}
+	if err := os.MkdirAll(e.Dir, 0755); err != nil {
+		return stats, fmt.Errorf("failed to create export folder: %v", err)
+	}
+	st, err := e.load()
+	if err != nil {
+		return stats, err
+	}
+	key := fmt.Sprintf("%s|%t|%s|%s|%s|%s|%s|%s", layout, e.Original, e.Filter.Query, intsKey(e.Filter.TagIDs),
+		ptrKey(e.Filter.CorrespondentID), ptrKey(e.Filter.DocumentTypeID), e.Filter.CreatedAfter, e.Filter.CreatedBefore)
+	if st.Key != key {
+		// Every document is exported again with the new settings.
+		st.Key, st.Modified = key, ""
+		for id, ent := range st.Documents {
+			ent.Modified = ""
+			st.Documents[id] = ent
+		}
+	}
+
+	n, err := e.names()
+	if err != nil {
+		return stats, err
+	}
+	// Documents modified at the time of the last one exported may not
+	// have been seen; unchanged ones are skipped.
+	filter := e.Filter
+	filter.ModifiedSince, filter.Ordering, filter.Limit = st.Modified, "modified", 0
+	docs, err := e.Client.ListDocuments(filter)
+	if err != nil {
+		return stats, fmt.Errorf("failed to list documents: %v", err)
+	}
+	owners := make(map[string]int, len(st.Documents))
+	for id, ent := range st.Documents {
+		owners[ent.Path] = id
+	}
+	// The watermark only advances past documents that were exported, so
+	// failed ones are retried.
+	failed := false
+	for _, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			e.save(st)
+			return stats, err
+		}
+		old, known := st.Documents[doc.ID]
+		if known && old.Modified == doc.Modified && e.exists(old.Path) {
+			if !failed && doc.Modified > st.Modified {
+				st.Modified = doc.Modified
+			}
+			stats.Unchanged++
+			continue
+		}
+		rel, err := e.export(tmpl, n, doc, owners)
+		e.report(doc.ID, rel, false, err)
+		if err != nil {
+			stats.Failed++
+			failed = true
+			continue
+		}
+		if known && old.Path != rel {
+			e.remove(old.Path)
+			delete(owners, old.Path)
+		}
+		owners[rel] = doc.ID
+		st.Documents[doc.ID] = entry{Path: rel, Modified: doc.Modified}
+		if !failed && doc.Modified > st.Modified {
+			st.Modified = doc.Modified
+		}
+		stats.Exported++
+		if stats.Exported%saveEvery == 0 {
+			if err := e.save(st); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	if e.Prune {
+		ids, err := e.Client.DocumentIDs()
+		if err != nil {
+			e.save(st)
+			return stats, err
+		}
+		present := make(map[int]bool, len(ids))
+		for _, id := range ids {
+			present[id] = true
+		}
+		for id, ent := range st.Documents {
+			if present[id] {
+				continue
+			}
+			e.remove(ent.Path)
+			delete(st.Documents, id)
+			e.report(id, ent.Path, true, nil)
+			stats.Removed++
+		}
+	}
+	return stats, e.save(st)
+}
+
+// export downloads doc and returns its path relative to Dir.
+func (e *Exporter) export(tmpl *template.Template, n names, doc paperless.Document, owners map[string]int) (string, error) {
+	body, filename, err := e.Client.DownloadDocument(doc.ID, e.Original)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, n.fields(doc)); err != nil {
+		return "", fmt.Errorf("failed to apply layout to document %d: %v", doc.ID, err)
+	}
+	var elems []string
+	for _, elem := range strings.Split(filepath.ToSlash(buf.String()), "/") {
+		if strings.Trim(elem, ". ") != "" {
+			elems = append(elems, watcher.SafeFileName(elem))
+		}
+	}
+	if len(elems) == 0 {
+		elems = []string{"document-" + strconv.Itoa(doc.ID)}
+	}
+	ext := path.Ext(filename)
+	rel := strings.Join(elems, "/") + ext
+	// Documents rendering to the same path are told apart by their ID.
+	if owner, ok := owners[rel]; ok && owner != doc.ID {
+		rel = strings.Join(elems, "/") + "-" + strconv.Itoa(doc.ID) + ext
+	}
+
+	dest := filepath.Join(e.Dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".export-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to download document %d: %v", doc.ID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return rel, nil
+}
+
+// separators replaces path separators in field values, so only those of
+// the layout start directories.
+var separators = strings.NewReplacer("/", "_", `\`, "_")
+
+func (n names) fields(doc paperless.Document) Fields {
+	f := Fields{ID: doc.ID, Title: separators.Replace(doc.Title)}
+	if doc.Correspondent != nil {
+		f.Correspondent = separators.Replace(n.correspondents[*doc.Correspondent])
+	}
+	if doc.DocumentType != nil {
+		f.DocumentType = separators.Replace(n.documentTypes[*doc.DocumentType])
+	}
+	if doc.StoragePath != nil {
+		f.StoragePath = separators.Replace(n.storagePaths[*doc.StoragePath])
+	}
+	if len(doc.Created) >= 10 {
+		f.Created = doc.Created[:10]
+		f.Year, f.Month, f.Day = f.Created[:4], f.Created[5:7], f.Created[8:10]
+	}
+	if doc.ArchiveSerialNumber != nil {
+		f.ASN = strconv.Itoa(*doc.ArchiveSerialNumber)
+	}
+	f.OriginalName = separators.Replace(strings.TrimSuffix(doc.OriginalFileName, path.Ext(doc.OriginalFileName)))
+	return f
+}
+
+func (e *Exporter) names() (names, error) {
+	n := names{make(map[int]string), make(map[int]string), make(map[int]string)}
+	correspondents, err := e.Client.GetCorrespondents()
+	if err != nil {
+		return n, fmt.Errorf("failed to get correspondents: %v", err)
+	}
+	for _, c := range correspondents {
+		n.correspondents[c.ID] = c.Name
+	}
+	types, err := e.Client.GetDocumentTypes()
+	if err != nil {
+		return n, fmt.Errorf("failed to get document types: %v", err)
+	}
+	for _, t := range types {
+		n.documentTypes[t.ID] = t.Name
+	}
+	paths, err := e.Client.GetStoragePaths()
+	if err != nil {
+		return n, fmt.Errorf("failed to get storage paths: %v", err)
+	}
+	for _, p := range paths {
+		n.storagePaths[p.ID] = p.Name
+	}
+	return n, nil
+}
+
+func (e *Exporter) report(id int, rel string, removed bool, err error) {
+	if e.Progress != nil {
+		e.Progress(id, rel, removed, err)
+	}
+}
+
+func (e *Exporter) exists(rel string) bool {
+	_, err := os.Stat(filepath.Join(e.Dir, filepath.FromSlash(rel)))
+	return err == nil
+}
+
+// remove deletes an exported file and the directories it leaves empty.
+func (e *Exporter) remove(rel string) {
+	p := filepath.Join(e.Dir, filepath.FromSlash(rel))
+	if err := os.Remove(p); err != nil {
+		return
+	}
+	root := filepath.Clean(e.Dir)
+	for dir := filepath.Dir(p); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+func (e *Exporter) load() (*state, error) {
+	st := &state{Documents: make(map[int]entry)}
+	data, err := os.ReadFile(filepath.Join(e.Dir, StateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("invalid export state %s: %v", StateFile, err)
+	}
+	if st.Documents == nil {
+		st.Documents = make(map[int]entry)
+	}
+	return st, nil
+}
+
+// save replaces the state file atomically.
+func (e *Exporter) save(st *state) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(e.Dir, StateFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to save export state: %v", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(e.Dir, StateFile)); err != nil {
+		return fmt.Errorf("failed to save export state: %v", err)
+	}
+	return nil
+}
+
+func intsKey(ids []int) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.Itoa(id)
+	}
+	return strings.Join(s, ",")
+}
+
+func ptrKey(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.Itoa(*id)
+}
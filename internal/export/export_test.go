@@ -0,0 +1,121 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDocument struct {
+	title, correspondent, created, modified string
+}
+
+func TestExport(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		documents = map[int]fakeDocument{
+			1: {"Power bill", "1", "2023-11-02", "2024-05-01T10:00:00Z"},
+			2: {"Lease", "null", "2024-01-15", "2024-05-02T10:00:00Z"},
+			3: {"Power bill", "1", "2023-11-02", "2024-05-02T11:00:00Z"},
+		}
+		downloads []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/api/correspondents/":
+			fmt.Fprint(w, `{"results": [{"id": 1, "name": "Utility Co/Power"}]}`)
+		case r.URL.Path == "/api/document_types/" || r.URL.Path == "/api/storage_paths/":
+			fmt.Fprint(w, `{"results": []}`)
+		case strings.HasSuffix(r.URL.Path, "/download/"):
+			var id int
+			fmt.Sscanf(r.URL.Path, "/api/documents/%d/download/", &id)
+			downloads = append(downloads, r.URL.String())
+			w.Header().Set("Content-Disposition", `attachment; filename="scan.pdf"`)
+			fmt.Fprintf(w, "%s %s", documents[id].title, documents[id].modified)
+		case r.URL.Query().Get("fields") == "id":
+			var ids []string
+			for id := range documents {
+				ids = append(ids, fmt.Sprint(id))
+			}
+			fmt.Fprintf(w, `{"all": [%s], "results": []}`, strings.Join(ids, ","))
+		default:
+			since := r.URL.Query().Get("modified__gte")
+			var results []string
+			for id := 1; id <= 10; id++ {
+				if d, ok := documents[id]; ok && d.modified >= since {
+					results = append(results, fmt.Sprintf(`{"id": %d, "title": %q, "correspondent": %s, "created": %q, "modified": %q}`,
+						id, d.title, d.correspondent, d.created, d.modified))
+				}
+			}
+			fmt.Fprintf(w, `{"next": null, "results": [%s]}`, strings.Join(results, ","))
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	e := &Exporter{Client: paperless.NewClient(server.URL, "test_key"), Dir: dir, Prune: true}
+	stats, err := e.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Exported: 3}, stats)
+	assert.FileExists(t, filepath.Join(dir, "Utility Co_Power", "2023", "2023-11-02 Power bill.pdf"))
+	assert.FileExists(t, filepath.Join(dir, "Utility Co_Power", "2023", "2023-11-02 Power bill-3.pdf"))
+	data, err := os.ReadFile(filepath.Join(dir, "2024", "2024-01-15 Lease.pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Lease 2024-05-02T10:00:00Z", string(data))
+	assert.Len(t, downloads, 3)
+	assert.NotContains(t, downloads[0], "original=true")
+
+	// Only changed documents are downloaded again, moved if their path
+	// changed, and deleted ones are pruned.
+	mu.Lock()
+	documents[2] = fakeDocument{"Lease (signed)", "null", "2024-01-15", "2024-05-03T10:00:00Z"}
+	delete(documents, 1)
+	downloads = nil
+	mu.Unlock()
+	stats, err = e.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Exported: 1, Unchanged: 1, Removed: 1}, stats)
+	assert.Len(t, downloads, 1)
+	assert.NoFileExists(t, filepath.Join(dir, "2024", "2024-01-15 Lease.pdf"))
+	assert.FileExists(t, filepath.Join(dir, "2024", "2024-01-15 Lease (signed).pdf"))
+	assert.NoFileExists(t, filepath.Join(dir, "Utility Co_Power", "2023", "2023-11-02 Power bill.pdf"))
+	assert.FileExists(t, filepath.Join(dir, "Utility Co_Power", "2023", "2023-11-02 Power bill-3.pdf"))
+
+	// Documents modified at the time of the last one exported are checked
+	// again, but not downloaded unless they changed.
+	stats, err = e.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Unchanged: 1}, stats)
+	assert.Len(t, downloads, 1)
+
+	// Another layout exports everything again.
+	e.Layout, e.Original = "{{.Year}}/{{.ID}}", true
+	stats, err = e.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Exported: 2}, stats)
+	assert.Contains(t, downloads[1], "original=true")
+	assert.FileExists(t, filepath.Join(dir, "2024", "2.pdf"))
+	assert.FileExists(t, filepath.Join(dir, "2023", "3.pdf"))
+	assert.NoDirExists(t, filepath.Join(dir, "Utility Co_Power"))
+
+	// Documents that fail are counted and kept as they were.
+	e.Layout = "{{.Nope}}"
+	stats, err = e.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Failed: 2}, stats)
+	assert.FileExists(t, filepath.Join(dir, "2024", "2.pdf"))
+	e.Layout = "{{.Year"
+	_, err = e.Run(context.Background())
+	assert.ErrorContains(t, err, "invalid layout")
+}
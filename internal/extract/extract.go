@@ -0,0 +1,168 @@
+// Package extract reads the text of documents with local tools, such as
+// pdftotext for PDFs and tesseract for images, so that rules can route
+// files by their content before they are uploaded.
+package extract
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// FilePlaceholder is replaced by the path of the file in the arguments of
+// commands. Commands without it get the path as last argument.
+const FilePlaceholder = "{file}"
+
+// cacheSize is the number of files whose text is kept, so rules evaluated
+// several times for a file extract it once.
+const cacheSize = 32
+
+// maxText limits the text kept of a file.
+const maxText = 1 << 20
+
+// Extractor extracts the text of files with external commands, which
+// print the text on standard output.
+type Extractor struct {
+	// PDFCommand reads the text layer of PDFs, e.g. pdftotext.
+	PDFCommand []string
+	// ScannedPDFCommand, if set, recognizes the text of PDFs without a
+	// text layer, e.g. by rendering pages for tesseract.
+	ScannedPDFCommand []string
+	// ImageCommand recognizes the text of images, e.g. tesseract.
+	ImageCommand []string
+	// Timeout bounds every command; zero is no limit.
+	Timeout time.Duration
+	// MaxSize skips larger files; zero is no limit.
+	MaxSize int64
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+type cached struct {
+	size    int64
+	modTime time.Time
+	text    string
+}
+
+// Text returns the text of the file at path. Files of other types than
+// PDF, image or plain text have none.
+func (x *Extractor) Text(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if x.MaxSize > 0 && info.Size() > x.MaxSize {
+		return "", fmt.Errorf("%s is larger than the content extraction limit", path)
+	}
+	x.mu.Lock()
+	c, ok := x.cache[path]
+	x.mu.Unlock()
+	if ok && c.size == info.Size() && c.modTime.Equal(info.ModTime()) {
+		return c.text, nil
+	}
+
+	var text string
+	switch t := MimeType(path); {
+	case t == "application/pdf":
+		if text, err = x.run(x.PDFCommand, path); err == nil && strings.TrimSpace(text) == "" && len(x.ScannedPDFCommand) > 0 {
+			text, err = x.run(x.ScannedPDFCommand, path)
+		}
+	case strings.HasPrefix(t, "image/"):
+		text, err = x.run(x.ImageCommand, path)
+	case strings.HasPrefix(t, "text/"):
+		var data []byte
+		if data, err = os.ReadFile(path); err == nil {
+			text = string(data)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(text) > maxText {
+		text = text[:maxText]
+	}
+	text = strings.ToValidUTF8(text, string(utf8.RuneError))
+
+	x.mu.Lock()
+	if x.cache == nil {
+		x.cache = make(map[string]cached)
+	}
+	if len(x.cache) >= cacheSize {
+		for p := range x.cache {
+			delete(x.cache, p)
+			break
+		}
+	}
+	x.cache[path] = cached{size: info.Size(), modTime: info.ModTime(), text: text}
+	x.mu.Unlock()
+	return text, nil
+}
+
+// run runs command on the file at path and returns its output.
+func (x *Extractor) run(command []string, path string) (string, error) {
+	if len(command) == 0 {
+		return "", nil
+	}
+	ctx := context.Background()
+	if x.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, x.Timeout)
+		defer cancel()
+	}
+	args := make([]string, 0, len(command))
+	replaced := false
+	for _, arg := range command[1:] {
+		if strings.Contains(arg, FilePlaceholder) {
+			arg = strings.ReplaceAll(arg, FilePlaceholder, path)
+			replaced = true
+		}
+		args = append(args, arg)
+	}
+	if !replaced {
+		args = append(args, path)
+	}
+	cmd := exec.CommandContext(ctx, command[0], args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 512 {
+			msg = "..." + msg[len(msg)-512:]
+		}
+		if msg != "" {
+			return "", fmt.Errorf("%s failed: %v: %s", command[0], err, msg)
+		}
+		return "", fmt.Errorf("%s failed: %v", command[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// MimeType returns the content type of the file at path by its extension,
+// or else by its content.
+func MimeType(path string) string {
+	t := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if t == "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		buf := make([]byte, 512)
+		n, _ := f.Read(buf)
+		t = http.DetectContentType(buf[:n])
+	}
+	if mt, _, err := mime.ParseMediaType(t); err == nil {
+		return mt
+	}
+	return t
+}
@@ -0,0 +1,54 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestText(t *testing.T) {
+	dir := t.TempDir()
+	counter := filepath.Join(dir, "runs")
+	x := &Extractor{
+		PDFCommand:        []string{"sh", "-c", `echo run >> "$1"; cat "$0"`, "{file}", counter},
+		ScannedPDFCommand: []string{"echo", "scanned"},
+		ImageCommand:      []string{"false"},
+	}
+
+	pdf := filepath.Join(dir, "bill.pdf")
+	assert.NoError(t, os.WriteFile(pdf, []byte("IBAN DE89 3704 0044"), 0644))
+	text, err := x.Text(pdf)
+	assert.NoError(t, err)
+	assert.Equal(t, "IBAN DE89 3704 0044", text)
+
+	// The text is kept until the file changes.
+	_, err = x.Text(pdf)
+	assert.NoError(t, err)
+	runs, _ := os.ReadFile(counter)
+	assert.Equal(t, 1, strings.Count(string(runs), "run"))
+
+	// PDFs without a text layer are read by the scanned PDF command.
+	scan := filepath.Join(dir, "scan.pdf")
+	assert.NoError(t, os.WriteFile(scan, nil, 0644))
+	text, err = x.Text(scan)
+	assert.NoError(t, err)
+	assert.Equal(t, "scanned "+scan+"\n", text)
+
+	note := filepath.Join(dir, "note.txt")
+	assert.NoError(t, os.WriteFile(note, []byte("plain"), 0644))
+	text, err = x.Text(note)
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", text)
+
+	photo := filepath.Join(dir, "photo.png")
+	assert.NoError(t, os.WriteFile(photo, []byte("png"), 0644))
+	_, err = x.Text(photo)
+	assert.ErrorContains(t, err, "false failed")
+
+	x.MaxSize = 4
+	_, err = x.Text(note)
+	assert.ErrorContains(t, err, "larger than")
+}
@@ -0,0 +1,127 @@
+// Package fetch downloads documents referenced by URL.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// DefaultClient is used when Download is called without a client.
+var DefaultClient = &http.Client{Timeout: 5 * time.Minute}
+
+var (
+	// ErrTooLarge is returned for documents exceeding the size limit.
+	ErrTooLarge = errors.New("document too large")
+	// ErrInvalidURL is returned for URLs other than http and https ones.
+	ErrInvalidURL = errors.New("only http and https URLs are supported")
+)
+
+// StoreFunc stores a downloaded document under name and returns its path.
+// It must not keep the document if reading r fails.
+type StoreFunc func(name string, r io.Reader) (string, error)
+
+// ToDir returns a StoreFunc delivering documents to dir with
+// watcher.Deliver.
+func ToDir(dir string) StoreFunc {
+	return func(name string, r io.Reader) (string, error) {
+		return watcher.Deliver(dir, name, r)
+	}
+}
+
+// Download fetches the http or https URL rawURL, sending header with the
+// request, and passes the document to store. Its name is taken from the
+// Content-Disposition header or the URL path. Downloads larger than maxSize
+// bytes fail with ErrTooLarge unless maxSize is zero.
+func Download(ctx context.Context, client *http.Client, rawURL string, header http.Header, maxSize int64, store StoreFunc) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid URL %q: %w", rawURL, ErrInvalidURL)
+	}
+	if client == nil {
+		client = DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	for name, values := range header {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("failed to fetch %s: status code %d", u.Redacted(), resp.StatusCode)
+	}
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return "", fmt.Errorf("%s: %w", u.Redacted(), ErrTooLarge)
+	}
+	r := &limitedReader{r: resp.Body, n: maxSize}
+	dest, err := store(fileName(u, resp.Header), r)
+	if r.exceeded {
+		return "", fmt.Errorf("%s: %w", u.Redacted(), ErrTooLarge)
+	}
+	return dest, err
+}
+
+// fileName returns the name of a downloaded document, adding an extension
+// matching its content type if the name has none.
+func fileName(u *url.URL, header http.Header) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		name = path.Base(u.Path)
+	}
+	name = watcher.SafeFileName(name)
+	if filepath.Ext(name) == "" {
+		if mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+			if ext, ok := extensions[mediaType]; ok {
+				name += ext
+			} else if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+				name += exts[0]
+			}
+		}
+	}
+	return name
+}
+
+// extensions are the usual extensions of common document types, for which
+// mime returns the alphabetically first one (".jpe", ".asc").
+var extensions = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/tiff":      ".tiff",
+	"text/plain":      ".txt",
+}
+
+// limitedReader fails once more than n bytes were read, unless n is zero.
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	read     int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.n > 0 && l.read > l.n {
+		l.exceeded = true
+		return 0, ErrTooLarge
+	}
+	return n, err
+}
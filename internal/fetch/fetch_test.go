@@ -0,0 +1,71 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/files/invoice.pdf":
+			w.Write([]byte("%PDF-1.4"))
+		case "/attachment":
+			w.Header().Set("Content-Disposition", `attachment; filename="scan 01.pdf"`)
+			w.Write([]byte("%PDF"))
+		case "/typed":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF"))
+		case "/private":
+			if r.Header.Get("Cookie") != "session=1" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte("%PDF-1.4"))
+		case "/large":
+			w.Write(make([]byte, 100))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	store := ToDir(dir)
+
+	dest, err := Download(context.Background(), nil, srv.URL+"/files/invoice.pdf", nil, 0, store)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "invoice.pdf"), dest)
+	data, _ := os.ReadFile(dest)
+	assert.Equal(t, "%PDF-1.4", string(data))
+
+	dest, err = Download(context.Background(), nil, srv.URL+"/attachment", nil, 0, store)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "scan 01.pdf"), dest)
+
+	dest, err = Download(context.Background(), nil, srv.URL+"/typed", nil, 0, store)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "typed.pdf"), dest)
+
+	_, err = Download(context.Background(), nil, srv.URL+"/private", nil, 0, store)
+	assert.ErrorContains(t, err, "status code 403")
+	dest, err = Download(context.Background(), nil, srv.URL+"/private", http.Header{"cookie": {"session=1"}}, 0, store)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "private.pdf"), dest)
+
+	_, err = Download(context.Background(), nil, srv.URL+"/large", nil, 10, store)
+	assert.True(t, errors.Is(err, ErrTooLarge))
+	_, err = Download(context.Background(), nil, srv.URL+"/missing", nil, 0, store)
+	assert.ErrorContains(t, err, "status code 404")
+	_, err = Download(context.Background(), nil, "file:///etc/passwd", nil, 0, store)
+	assert.True(t, errors.Is(err, ErrInvalidURL))
+
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 4, "failed downloads leave no files behind")
+}
@@ -0,0 +1,575 @@
+// Package ftpd implements a minimal FTP server for scanners that can only
+// "scan to FTP". Every account has a drop folder: uploaded files are
+// delivered to a watched folder, from where they are uploaded, and
+// directory listings are always empty.
+package ftpd
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+const (
+	// commandTimeout bounds the wait for the next command of a session.
+	commandTimeout = 5 * time.Minute
+	// dataTimeout bounds opening a data connection and the silence during
+	// a transfer.
+	dataTimeout = time.Minute
+	// maxLoginFailures is the number of failed logins after which the
+	// session is closed.
+	maxLoginFailures = 3
+)
+
+// User is an account that may upload files.
+type User struct {
+	Name     string
+	Password string
+	// Folder receives the uploads of the user.
+	Folder string
+}
+
+// Server receives files over FTP.
+type Server struct {
+	// Addr is the listen address, e.g. ":2121".
+	Addr string
+	// PassivePorts is the range of ports offered for passive data
+	// connections. Zero values use any free port.
+	PassivePorts [2]int
+	// PublicIP is announced for passive data connections instead of the
+	// address the client connected to.
+	PublicIP net.IP
+	// TLS enables AUTH TLS when set.
+	TLS *tls.Config
+	// RequireTLS rejects logins on unencrypted connections.
+	RequireTLS bool
+	// MaxSize limits the size of a file in bytes.
+	MaxSize int64
+	Users   []User
+
+	ln    net.Listener
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	// nextPort is the next passive port tried.
+	nextPort int
+}
+
+// Start listens on the configured address and serves sessions in the
+// background. Listen errors are returned immediately.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.Addr, err)
+	}
+	s.ln = ln
+	s.conns = make(map[net.Conn]bool)
+	s.nextPort = s.PassivePorts[0]
+	logging.Infof("FTP receiver listening on %s", ln.Addr())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logging.Errorf("FTP receiver failed: %v", err)
+				}
+				return
+			}
+			s.track(conn, true)
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer s.track(conn, false)
+				s.serve(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// ListenAddr returns the address the server listens on.
+func (s *Server) ListenAddr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Shutdown stops accepting uploads, closes open sessions and waits for them
+// to end or ctx to be done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return err
+}
+
+func (s *Server) track(conn net.Conn, open bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if open {
+		s.conns[conn] = true
+	} else {
+		delete(s.conns, conn)
+		conn.Close()
+	}
+}
+
+// login returns the user with the given name and password.
+func (s *Server) login(name, password string) (*User, bool) {
+	for i, u := range s.Users {
+		if u.Name == name && subtle.ConstantTimeCompare([]byte(u.Password), []byte(password)) == 1 {
+			return &s.Users[i], true
+		}
+	}
+	return nil, false
+}
+
+// listenPassive opens a listener for a passive data connection on the
+// interface of local.
+func (s *Server) listenPassive(local net.IP) (*net.TCPListener, error) {
+	first, last := s.PassivePorts[0], s.PassivePorts[1]
+	if first == 0 {
+		ln, err := net.ListenTCP("tcp", &net.TCPAddr{IP: local})
+		return ln, err
+	}
+	var err error
+	for range last - first + 1 {
+		s.mu.Lock()
+		port := s.nextPort
+		s.nextPort++
+		if s.nextPort > last {
+			s.nextPort = first
+		}
+		s.mu.Unlock()
+		var ln *net.TCPListener
+		if ln, err = net.ListenTCP("tcp", &net.TCPAddr{IP: local, Port: port}); err == nil {
+			return ln, nil
+		}
+	}
+	return nil, fmt.Errorf("no free passive port: %w", err)
+}
+
+// session is the state of one FTP conversation.
+type session struct {
+	s      *Server
+	conn   net.Conn
+	tp     *textproto.Conn
+	remote net.IP
+	// user is set by USER, account once the password was accepted.
+	user     string
+	account  *User
+	failures int
+	cwd      string
+	secure   bool
+	// protect encrypts data connections (PROT P).
+	protect bool
+	// passive or active is the data connection prepared by PASV/EPSV or
+	// PORT/EPRT.
+	passive *net.TCPListener
+	active  string
+}
+
+func (s *Server) serve(conn net.Conn) {
+	sess := &session{s: s, conn: conn, tp: textproto.NewConn(conn), cwd: "/"}
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		sess.remote = addr.IP
+	}
+	defer sess.closeData()
+	sess.reply(220, "paperless-uploader FTP receiver ready")
+	for {
+		sess.conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := sess.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		if !sess.handle(strings.ToUpper(verb), arg) {
+			return
+		}
+	}
+}
+
+func (sess *session) reply(code int, format string, args ...any) {
+	sess.tp.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+// handle runs one command and reports whether the session continues.
+func (sess *session) handle(verb, arg string) bool {
+	switch verb {
+	case "AUTH":
+		return sess.auth(arg)
+	case "USER":
+		if sess.s.RequireTLS && !sess.secure {
+			sess.reply(530, "Use AUTH TLS first")
+			return true
+		}
+		sess.user, sess.account = arg, nil
+		sess.reply(331, "Password required")
+		return true
+	case "PASS":
+		return sess.pass(arg)
+	case "FEAT":
+		sess.tp.PrintfLine("211-Features:")
+		if sess.s.TLS != nil {
+			sess.tp.PrintfLine(" AUTH TLS")
+			sess.tp.PrintfLine(" PBSZ")
+			sess.tp.PrintfLine(" PROT")
+		}
+		sess.tp.PrintfLine(" EPSV")
+		sess.tp.PrintfLine(" UTF8")
+		sess.tp.PrintfLine("211 End")
+		return true
+	case "SYST":
+		sess.reply(215, "UNIX Type: L8")
+		return true
+	case "OPTS":
+		sess.reply(200, "OK")
+		return true
+	case "NOOP":
+		sess.reply(200, "OK")
+		return true
+	case "QUIT":
+		sess.reply(221, "Bye")
+		return false
+	}
+	if sess.account == nil {
+		sess.reply(530, "Not logged in")
+		return true
+	}
+
+	switch verb {
+	case "PBSZ":
+		sess.reply(200, "PBSZ=0")
+	case "PROT":
+		switch {
+		case !sess.secure:
+			sess.reply(503, "Use AUTH TLS first")
+		case strings.EqualFold(arg, "P"):
+			sess.protect = true
+			sess.reply(200, "Data connections are protected")
+		case strings.EqualFold(arg, "C"):
+			sess.protect = false
+			sess.reply(200, "Data connections are not protected")
+		default:
+			sess.reply(504, "Unsupported protection level")
+		}
+	case "PWD", "XPWD":
+		sess.reply(257, "%q", sess.cwd)
+	case "CWD", "XCWD":
+		// Directories are not stored; scanners configured with a path may
+		// change into it.
+		sess.cwd = sess.resolve(arg)
+		sess.reply(250, "Directory changed to %s", sess.cwd)
+	case "CDUP", "XCUP":
+		sess.cwd = sess.resolve("..")
+		sess.reply(250, "Directory changed to %s", sess.cwd)
+	case "MKD", "XMKD":
+		sess.reply(257, "%q created", sess.resolve(arg))
+	case "TYPE", "MODE", "STRU":
+		sess.reply(200, "OK")
+	case "PASV":
+		sess.pasv(false)
+	case "EPSV":
+		sess.pasv(true)
+	case "PORT":
+		sess.port(arg, false)
+	case "EPRT":
+		sess.port(arg, true)
+	case "LIST", "NLST", "MLSD":
+		sess.list()
+	case "STOR":
+		sess.stor(arg)
+	case "SIZE", "MDTM", "RETR", "DELE":
+		sess.reply(550, "File not available")
+	default:
+		sess.reply(502, "Command not implemented")
+	}
+	return true
+}
+
+// auth upgrades the control connection to TLS.
+func (sess *session) auth(arg string) bool {
+	if sess.s.TLS == nil {
+		sess.reply(502, "TLS is not configured")
+		return true
+	}
+	if sess.secure {
+		sess.reply(503, "Already using TLS")
+		return true
+	}
+	if !strings.EqualFold(arg, "TLS") && !strings.EqualFold(arg, "SSL") {
+		sess.reply(504, "Unsupported security mechanism")
+		return true
+	}
+	sess.reply(234, "Starting TLS")
+	conn := tls.Server(sess.conn, sess.s.TLS)
+	if err := conn.Handshake(); err != nil {
+		logging.Warnf("FTP receiver TLS handshake with %s failed: %v", sess.remote, err)
+		return false
+	}
+	sess.conn, sess.tp, sess.secure = conn, textproto.NewConn(conn), true
+	// A new login is required on the secured connection.
+	sess.user, sess.account = "", nil
+	return true
+}
+
+// pass checks the password of the user given with USER.
+func (sess *session) pass(password string) bool {
+	if sess.user == "" {
+		sess.reply(503, "USER first")
+		return true
+	}
+	account, ok := sess.s.login(sess.user, password)
+	if !ok {
+		sess.failures++
+		logging.Warnf("FTP receiver rejected login of %s from %s", sess.user, sess.remote)
+		sess.reply(530, "Login incorrect")
+		return sess.failures < maxLoginFailures
+	}
+	sess.account = account
+	sess.reply(230, "Logged in")
+	return true
+}
+
+// resolve returns the absolute virtual path of p.
+func (sess *session) resolve(p string) string {
+	return path.Join(sess.cwd, p)
+}
+
+// pasv prepares a passive data connection.
+func (sess *session) pasv(extended bool) {
+	sess.closeData()
+	local := sess.conn.LocalAddr().(*net.TCPAddr).IP
+	announced := local.To4()
+	if sess.s.PublicIP != nil {
+		announced = sess.s.PublicIP.To4()
+	}
+	if !extended && announced == nil {
+		sess.reply(522, "Use EPSV with IPv6")
+		return
+	}
+	ln, err := sess.s.listenPassive(local)
+	if err != nil {
+		logging.Errorf("FTP receiver failed to open passive port: %v", err)
+		sess.reply(425, "Cannot open passive connection")
+		return
+	}
+	sess.passive = ln
+	port := ln.Addr().(*net.TCPAddr).Port
+	if extended {
+		sess.reply(229, "Entering Extended Passive Mode (|||%d|)", port)
+		return
+	}
+	sess.reply(227, "Entering Passive Mode (%d,%d,%d,%d,%d,%d)",
+		announced[0], announced[1], announced[2], announced[3], port>>8, port&0xff)
+}
+
+// port prepares an active data connection to the address in arg, which
+// must be the client's own.
+func (sess *session) port(arg string, extended bool) {
+	sess.closeData()
+	var (
+		addr string
+		err  error
+	)
+	if extended {
+		addr, err = parseEPRT(arg)
+	} else {
+		addr, err = parsePORT(arg)
+	}
+	if err != nil {
+		sess.reply(501, "%v", err)
+		return
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	if ip := net.ParseIP(host); ip == nil || !ip.Equal(sess.remote) {
+		sess.reply(504, "Data connections are only made to the client")
+		return
+	}
+	sess.active = addr
+	sess.reply(200, "OK")
+}
+
+// parsePORT parses the h1,h2,h3,h4,p1,p2 argument of PORT.
+func parsePORT(arg string) (string, error) {
+	parts := strings.Split(arg, ",")
+	if len(parts) != 6 {
+		return "", errors.New("syntax: PORT h1,h2,h3,h4,p1,p2")
+	}
+	var n [6]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || v < 0 || v > 255 {
+			return "", errors.New("syntax: PORT h1,h2,h3,h4,p1,p2")
+		}
+		n[i] = v
+	}
+	ip := net.IPv4(byte(n[0]), byte(n[1]), byte(n[2]), byte(n[3]))
+	return net.JoinHostPort(ip.String(), strconv.Itoa(n[4]<<8|n[5])), nil
+}
+
+// parseEPRT parses the |protocol|address|port| argument of EPRT.
+func parseEPRT(arg string) (string, error) {
+	if len(arg) < 2 {
+		return "", errors.New("syntax: EPRT |proto|address|port|")
+	}
+	parts := strings.Split(arg, arg[:1])
+	if len(parts) != 5 || net.ParseIP(parts[2]) == nil {
+		return "", errors.New("syntax: EPRT |proto|address|port|")
+	}
+	if port, err := strconv.Atoi(parts[3]); err != nil || port <= 0 || port > 65535 {
+		return "", errors.New("syntax: EPRT |proto|address|port|")
+	}
+	return net.JoinHostPort(parts[2], parts[3]), nil
+}
+
+// openData opens the data connection prepared by the last PASV, EPSV,
+// PORT or EPRT command.
+func (sess *session) openData() (net.Conn, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+	switch {
+	case sess.passive != nil:
+		ln := sess.passive
+		sess.passive = nil
+		defer ln.Close()
+		ln.SetDeadline(time.Now().Add(dataTimeout))
+		conn, err = ln.Accept()
+		if err != nil {
+			return nil, err
+		}
+		// Only the client may use the port, so that nobody else can
+		// inject a file.
+		if addr, ok := conn.RemoteAddr().(*net.TCPAddr); !ok || !addr.IP.Equal(sess.remote) {
+			conn.Close()
+			return nil, fmt.Errorf("data connection from foreign address %s", conn.RemoteAddr())
+		}
+	case sess.active != "":
+		addr := sess.active
+		sess.active = ""
+		if conn, err = net.DialTimeout("tcp", addr, dataTimeout); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("use PASV or PORT first")
+	}
+	if sess.protect {
+		tlsConn := tls.Server(conn, sess.s.TLS)
+		tlsConn.SetDeadline(time.Now().Add(dataTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return conn, nil
+}
+
+// closeData releases a prepared data connection.
+func (sess *session) closeData() {
+	if sess.passive != nil {
+		sess.passive.Close()
+		sess.passive = nil
+	}
+	sess.active = ""
+}
+
+// list sends an empty directory listing.
+func (sess *session) list() {
+	sess.reply(150, "Opening data connection")
+	conn, err := sess.openData()
+	if err != nil {
+		sess.reply(425, "Cannot open data connection: %v", err)
+		return
+	}
+	conn.Close()
+	sess.reply(226, "Transfer complete")
+}
+
+// stor receives a file and delivers it to the user's folder.
+func (sess *session) stor(arg string) {
+	if arg == "" {
+		sess.reply(501, "Syntax: STOR <file>")
+		return
+	}
+	name := path.Base(sess.resolve(arg))
+	sess.reply(150, "Opening data connection for %s", name)
+	conn, err := sess.openData()
+	if err != nil {
+		sess.reply(425, "Cannot open data connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	r := &limitedReader{r: &timeoutReader{conn: conn}, n: sess.s.MaxSize}
+	dest, err := watcher.Deliver(sess.account.Folder, name, r)
+	if err != nil {
+		if r.exceeded {
+			logging.Warnf("FTP receiver rejected %s from %s: larger than %d bytes", name, sess.account.Name, sess.s.MaxSize)
+			sess.reply(552, "File too large")
+			return
+		}
+		logging.Errorf("FTP receiver failed to store %s from %s: %v", name, sess.account.Name, err)
+		sess.reply(451, "Failed to store file")
+		return
+	}
+	logging.Infof("Received %s by FTP from %s", dest, sess.account.Name)
+	sess.reply(226, "Transfer complete")
+}
+
+// timeoutReader extends the deadline of conn before every read, so that a
+// transfer may take long but not stall.
+type timeoutReader struct {
+	conn net.Conn
+}
+
+func (t *timeoutReader) Read(p []byte) (int, error) {
+	t.conn.SetReadDeadline(time.Now().Add(dataTimeout))
+	return t.conn.Read(p)
+}
+
+// limitedReader fails once more than n bytes were read, unless n is zero.
+type limitedReader struct {
+	r        io.Reader
+	n        int64
+	read     int64
+	exceeded bool
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.n > 0 && l.read > l.n {
+		l.exceeded = true
+		return 0, errors.New("file too large")
+	}
+	return n, err
+}
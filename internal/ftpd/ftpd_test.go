@@ -0,0 +1,217 @@
+package ftpd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// client is a minimal FTP client for the tests.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	tp   *textproto.Conn
+	tls  *tls.Config
+	prot bool
+}
+
+func dial(t *testing.T, addr string) *client {
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	c := &client{t: t, conn: conn, tp: textproto.NewConn(conn)}
+	c.expect(220)
+	return c
+}
+
+// cmd sends a command and returns the code of the reply.
+func (c *client) cmd(format string, args ...any) (int, string) {
+	id, err := c.tp.Cmd(format, args...)
+	assert.NoError(c.t, err)
+	c.tp.StartResponse(id)
+	defer c.tp.EndResponse(id)
+	code, msg, err := c.tp.ReadResponse(0)
+	if err != nil && code == 0 {
+		c.t.Fatalf("%s: %v", format, err)
+	}
+	return code, msg
+}
+
+func (c *client) expect(code int) string {
+	got, msg, err := c.tp.ReadResponse(code)
+	assert.NoError(c.t, err, "want %d, got %d %s", code, got, msg)
+	return msg
+}
+
+func (c *client) login(user, password string) {
+	code, _ := c.cmd("USER %s", user)
+	assert.Equal(c.t, 331, code)
+	code, _ = c.cmd("PASS %s", password)
+	assert.Equal(c.t, 230, code)
+}
+
+func (c *client) startTLS() {
+	code, _ := c.cmd("AUTH TLS")
+	assert.Equal(c.t, 234, code)
+	conn := tls.Client(c.conn, c.tls)
+	assert.NoError(c.t, conn.Handshake())
+	c.conn, c.tp = conn, textproto.NewConn(conn)
+}
+
+// store uploads data as name over a passive data connection and returns
+// the final reply code.
+func (c *client) store(name, data string) int {
+	code, msg := c.cmd("PASV")
+	assert.Equal(c.t, 227, code)
+	fields := strings.Split(msg[strings.Index(msg, "(")+1:strings.Index(msg, ")")], ",")
+	p1, _ := strconv.Atoi(fields[4])
+	p2, _ := strconv.Atoi(fields[5])
+	dataConn, err := net.Dial("tcp", net.JoinHostPort(strings.Join(fields[:4], "."), strconv.Itoa(p1<<8|p2)))
+	assert.NoError(c.t, err)
+	code, _ = c.cmd("STOR %s", name)
+	if code != 150 {
+		dataConn.Close()
+		return code
+	}
+	if c.prot {
+		tlsConn := tls.Client(dataConn, c.tls)
+		assert.NoError(c.t, tlsConn.Handshake())
+		dataConn = tlsConn
+	}
+	dataConn.Write([]byte(data))
+	dataConn.Close()
+	code, _, _ = c.tp.ReadResponse(0)
+	return code
+}
+
+func TestServer(t *testing.T) {
+	scanner, office := t.TempDir(), t.TempDir()
+	s := &Server{
+		Addr:    "127.0.0.1:0",
+		MaxSize: 16,
+		Users: []User{
+			{Name: "scanner", Password: "secret", Folder: scanner},
+			{Name: "office", Password: "other", Folder: office},
+		},
+	}
+	assert.NoError(t, s.Start())
+	defer s.Shutdown(context.Background())
+
+	c := dial(t, s.ListenAddr().String())
+	code, _ := c.cmd("STOR a.pdf")
+	assert.Equal(t, 530, code)
+	c.login("scanner", "secret")
+	code, _ = c.cmd("CWD /scans/2024")
+	assert.Equal(t, 250, code)
+	code, msg := c.cmd("PWD")
+	assert.Equal(t, 257, code)
+	assert.Equal(t, `"/scans/2024"`, msg)
+	assert.Equal(t, 226, c.store("scan 1.pdf", "%PDF-1.4"))
+	data, err := os.ReadFile(filepath.Join(scanner, "scan 1.pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4", string(data))
+
+	// Files above the size limit are not delivered.
+	assert.Equal(t, 552, c.store("big.pdf", strings.Repeat("x", 17)))
+	entries, err := os.ReadDir(scanner)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Active connections are only made to the client.
+	code, _ = c.cmd("PORT 10,0,0,1,4,1")
+	assert.Equal(t, 504, code)
+
+	// Uploads are routed by user.
+	c = dial(t, s.ListenAddr().String())
+	c.login("office", "other")
+	assert.Equal(t, 226, c.store("../letter.pdf", "letter"))
+	assert.FileExists(t, filepath.Join(office, "letter.pdf"))
+}
+
+func TestLoginFailures(t *testing.T) {
+	s := &Server{Addr: "127.0.0.1:0", Users: []User{{Name: "scanner", Password: "secret", Folder: t.TempDir()}}}
+	assert.NoError(t, s.Start())
+	defer s.Shutdown(context.Background())
+
+	c := dial(t, s.ListenAddr().String())
+	for range maxLoginFailures {
+		c.cmd("USER scanner")
+		code, _ := c.cmd("PASS wrong")
+		assert.Equal(t, 530, code)
+	}
+	// The session is closed after too many failures.
+	_, err := c.tp.ReadLine()
+	assert.Error(t, err)
+}
+
+func TestTLS(t *testing.T) {
+	cert, pool := certificate(t)
+	folder := t.TempDir()
+	s := &Server{
+		Addr:       "127.0.0.1:0",
+		TLS:        &tls.Config{Certificates: []tls.Certificate{cert}},
+		RequireTLS: true,
+		Users:      []User{{Name: "scanner", Password: "secret", Folder: folder}},
+	}
+	assert.NoError(t, s.Start())
+	defer s.Shutdown(context.Background())
+
+	c := dial(t, s.ListenAddr().String())
+	code, _ := c.cmd("USER scanner")
+	assert.Equal(t, 530, code)
+
+	c.tls = &tls.Config{RootCAs: pool, ServerName: "localhost", ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+	c.startTLS()
+	c.login("scanner", "secret")
+	code, _ = c.cmd("PBSZ 0")
+	assert.Equal(t, 200, code)
+	code, _ = c.cmd("PROT P")
+	assert.Equal(t, 200, code)
+	c.prot = true
+	assert.Equal(t, 226, c.store("secure.pdf", "%PDF-1.4"))
+	assert.FileExists(t, filepath.Join(folder, "secure.pdf"))
+}
+
+func TestParseEPRT(t *testing.T) {
+	addr, err := parseEPRT("|2|::1|50000|")
+	assert.NoError(t, err)
+	assert.Equal(t, "[::1]:50000", addr)
+	_, err = parseEPRT("|1|nohost|1|")
+	assert.Error(t, err)
+}
+
+// certificate returns a self-signed certificate for localhost and a pool
+// trusting it.
+func certificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	parsed, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
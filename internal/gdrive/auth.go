@@ -0,0 +1,176 @@
+package gdrive
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scope grants access to the files in Drive.
+const scope = "https://www.googleapis.com/auth/drive"
+
+// defaultTokenURL is Google's OAuth token endpoint.
+const defaultTokenURL = "https://oauth2.googleapis.com/token"
+
+// serviceAccount is the relevant part of a service account JSON key.
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// tokenSource obtains access tokens and caches them until shortly before
+// they expire.
+type tokenSource struct {
+	client *http.Client
+	// form returns the token request.
+	form     func() (url.Values, error)
+	tokenURL string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// serviceAccountSource authorizes as the service account of the JSON key in
+// file.
+func serviceAccountSource(client *http.Client, file string) (*tokenSource, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %w", err)
+	}
+	var sa serviceAccount
+	if err := json.Unmarshal(data, &sa); err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %w", file, err)
+	}
+	key, err := parseKey(sa.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials file %s: %w", file, err)
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = defaultTokenURL
+	}
+	return &tokenSource{
+		client:   client,
+		tokenURL: sa.TokenURI,
+		form: func() (url.Values, error) {
+			assertion, err := signJWT(key, sa.ClientEmail, sa.TokenURI, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			return url.Values{
+				"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+				"assertion":  {assertion},
+			}, nil
+		},
+	}, nil
+}
+
+// refreshTokenSource authorizes as the user who granted refreshToken.
+func refreshTokenSource(client *http.Client, tokenURL, clientID, clientSecret, refreshToken string) *tokenSource {
+	return &tokenSource{
+		client:   client,
+		tokenURL: tokenURL,
+		form: func() (url.Values, error) {
+			return url.Values{
+				"grant_type":    {"refresh_token"},
+				"client_id":     {clientID},
+				"client_secret": {clientSecret},
+				"refresh_token": {refreshToken},
+			}, nil
+		},
+	}
+}
+
+// Token returns a valid access token.
+func (ts *tokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.token != "" && time.Now().Before(ts.expires) {
+		return ts.token, nil
+	}
+	form, err := ts.form()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", ts.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := ts.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get access token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get access token: status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return "", errors.New("failed to get access token: invalid response")
+	}
+	ts.token = token.AccessToken
+	ts.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return ts.token, nil
+}
+
+// parseKey parses a PEM encoded PKCS #8 or PKCS #1 RSA private key.
+func parseKey(s string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.New("no PEM private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// signJWT returns the signed assertion exchanging the service account's
+// identity for an access token.
+func signJWT(key *rsa.PrivateKey, email, audience string, now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   email,
+		"scope": scope,
+		"aud":   audience,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token request: %w", err)
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,328 @@
+// Package gdrive downloads new files from a Google Drive folder and moves them
+// to a processed Drive folder once uploaded.
+package gdrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// defaultBaseURL is the Drive API endpoint.
+const defaultBaseURL = "https://www.googleapis.com/drive/v3"
+
+// nativePrefix is the MIME type prefix of Google Docs, Sheets and other
+// native files, which have no content to download.
+const nativePrefix = "application/vnd.google-apps."
+
+// requestTimeout bounds a single API request; downloads are not bounded.
+const requestTimeout = 30 * time.Second
+
+// file is a Drive file as returned by the API.
+type file struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	MimeType string   `json:"mimeType"`
+	Parents  []string `json:"parents"`
+	Trashed  bool     `json:"trashed"`
+}
+
+// Source offers the files added to a Drive folder to a watcher.
+type Source struct {
+	// DryRun only logs the files that would be downloaded and offers
+	// none.
+	DryRun bool
+
+	cfg     config.GoogleDrive
+	folder  watcher.Folder
+	baseURL string
+	client  *http.Client
+	tokens  *tokenSource
+	files   chan watcher.File
+	// dir holds the downloads until they were uploaded.
+	dir string
+
+	mu sync.Mutex
+	// downloaded maps the local path of a download to its Drive file ID
+	// until it was uploaded.
+	downloaded map[string]string
+	// seen holds the IDs of the files downloaded and not yet uploaded, so
+	// that further changes to them are ignored.
+	seen map[string]bool
+}
+
+// New creates a source for cfg. The documents are uploaded with the
+// settings of folder, whose Path is replaced by the Drive folder.
+func New(cfg config.GoogleDrive, folder watcher.Folder) (*Source, error) {
+	folder.Path = "gdrive:" + cfg.FolderID
+	s := &Source{
+		cfg:        cfg,
+		folder:     folder,
+		baseURL:    defaultBaseURL,
+		client:     &http.Client{},
+		files:      make(chan watcher.File),
+		downloaded: make(map[string]string),
+		seen:       make(map[string]bool),
+	}
+	switch {
+	case cfg.CredentialsFile != "":
+		tokens, err := serviceAccountSource(s.client, cfg.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		s.tokens = tokens
+	case cfg.RefreshToken != "":
+		s.tokens = refreshTokenSource(s.client, defaultTokenURL, cfg.ClientID, cfg.ClientSecret, cfg.RefreshToken)
+	default:
+		return nil, errors.New("google_drive needs credentials_file or client_id, client_secret and refresh_token")
+	}
+	return s, nil
+}
+
+// Start creates the download directory and begins watching the folder.
+func (s *Source) Start(ctx context.Context) error {
+	if !s.DryRun {
+		dir, err := os.MkdirTemp("", "paperless-uploader-gdrive-")
+		if err != nil {
+			return err
+		}
+		s.dir = dir
+	}
+	go s.run(ctx)
+	return nil
+}
+
+func (s *Source) Events() <-chan watcher.File {
+	return s.files
+}
+
+// Complete removes the download and, if it was uploaded, moves the Drive
+// file to the processed folder. Failed files stay in the folder.
+func (s *Source) Complete(f watcher.File, err error) {
+	if rmErr := os.Remove(f.Path); rmErr != nil && !os.IsNotExist(rmErr) {
+		logging.Warnf("Failed to remove %s: %v", f.Path, rmErr)
+	}
+	s.mu.Lock()
+	id, ok := s.downloaded[f.Path]
+	delete(s.downloaded, f.Path)
+	delete(s.seen, id)
+	s.mu.Unlock()
+	if !ok || err != nil || s.cfg.ProcessedFolderID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	query := url.Values{"addParents": {s.cfg.ProcessedFolderID}, "removeParents": {s.cfg.FolderID}}
+	if err := s.call(ctx, "PATCH", "/files/"+url.PathEscape(id), query, nil); err != nil {
+		logging.Warnf("Failed to move %s to the processed Drive folder: %v", f.Path, err)
+	}
+}
+
+// run offers the files in the folder, then polls for new ones until ctx is
+// done.
+func (s *Source) run(ctx context.Context) {
+	defer close(s.files)
+	var start struct {
+		Token string `json:"startPageToken"`
+	}
+	for {
+		// The start token is taken before listing so that no file added in
+		// between is missed.
+		err := s.call(ctx, "GET", "/changes/startPageToken", url.Values{"supportsAllDrives": {"true"}}, &start)
+		if err == nil {
+			err = s.downloadExisting(ctx)
+		}
+		if err == nil {
+			break
+		}
+		logging.Errorf("Failed to list Google Drive folder: %v", err)
+		if !sleep(ctx, s.cfg.PollInterval) {
+			return
+		}
+	}
+	logging.Infof("Watching Google Drive folder %s", s.cfg.FolderID)
+
+	token := start.Token
+	for sleep(ctx, s.cfg.PollInterval) {
+		next, err := s.poll(ctx, token)
+		if err != nil {
+			if ctx.Err() == nil {
+				logging.Errorf("Failed to poll Google Drive for changes: %v", err)
+			}
+			continue
+		}
+		token = next
+	}
+}
+
+// downloadExisting downloads the files currently in the folder.
+func (s *Source) downloadExisting(ctx context.Context) error {
+	query := url.Values{
+		"q":                         {fmt.Sprintf("'%s' in parents and trashed = false", strings.ReplaceAll(s.cfg.FolderID, "'", `\'`))},
+		"fields":                    {"nextPageToken,files(id,name,mimeType,parents,trashed)"},
+		"pageSize":                  {"100"},
+		"supportsAllDrives":         {"true"},
+		"includeItemsFromAllDrives": {"true"},
+	}
+	for {
+		var page struct {
+			NextPageToken string `json:"nextPageToken"`
+			Files         []file `json:"files"`
+		}
+		if err := s.call(ctx, "GET", "/files", query, &page); err != nil {
+			return err
+		}
+		for _, f := range page.Files {
+			s.fetch(ctx, f)
+		}
+		if page.NextPageToken == "" {
+			return nil
+		}
+		query.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// poll downloads the files added to the folder since token and returns the
+// token for the next poll.
+func (s *Source) poll(ctx context.Context, token string) (string, error) {
+	query := url.Values{
+		"fields":                    {"nextPageToken,newStartPageToken,changes(removed,file(id,name,mimeType,parents,trashed))"},
+		"pageSize":                  {"100"},
+		"supportsAllDrives":         {"true"},
+		"includeItemsFromAllDrives": {"true"},
+	}
+	for {
+		query.Set("pageToken", token)
+		var page struct {
+			NextPageToken     string `json:"nextPageToken"`
+			NewStartPageToken string `json:"newStartPageToken"`
+			Changes           []struct {
+				Removed bool  `json:"removed"`
+				File    *file `json:"file"`
+			} `json:"changes"`
+		}
+		if err := s.call(ctx, "GET", "/changes", query, &page); err != nil {
+			return token, err
+		}
+		for _, c := range page.Changes {
+			if !c.Removed && c.File != nil {
+				s.fetch(ctx, *c.File)
+			}
+		}
+		if page.NextPageToken == "" {
+			return page.NewStartPageToken, nil
+		}
+		token = page.NextPageToken
+	}
+}
+
+// fetch downloads f and offers it if it is a new document in the folder.
+func (s *Source) fetch(ctx context.Context, f file) {
+	if f.Trashed || strings.HasPrefix(f.MimeType, nativePrefix) || !slices.Contains(f.Parents, s.cfg.FolderID) {
+		return
+	}
+	s.mu.Lock()
+	if s.seen[f.ID] {
+		s.mu.Unlock()
+		return
+	}
+	s.seen[f.ID] = true
+	s.mu.Unlock()
+
+	if s.DryRun {
+		logging.Infof("[dry-run] Would download %s from Google Drive", f.Name)
+		return
+	}
+	path, err := s.download(ctx, f)
+	if err != nil {
+		s.mu.Lock()
+		delete(s.seen, f.ID)
+		s.mu.Unlock()
+		logging.Errorf("Failed to download %s from Google Drive: %v", f.Name, err)
+		return
+	}
+	s.mu.Lock()
+	s.downloaded[path] = f.ID
+	s.mu.Unlock()
+	logging.Infof("Downloaded %s from Google Drive", f.Name)
+	select {
+	case s.files <- watcher.File{Path: path, Folder: s.folder}:
+	case <-ctx.Done():
+	}
+}
+
+func (s *Source) download(ctx context.Context, f file) (string, error) {
+	resp, err := s.do(ctx, "GET", "/files/"+url.PathEscape(f.ID), url.Values{"alt": {"media"}, "supportsAllDrives": {"true"}})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	return watcher.Deliver(s.dir, f.Name, resp.Body)
+}
+
+// call performs an API request and decodes the JSON response into out,
+// unless it is nil.
+func (s *Source) call(ctx context.Context, method, path string, query url.Values, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	resp, err := s.do(ctx, method, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// do performs an authorized API request and fails for non-2xx responses.
+func (s *Source) do(ctx context.Context, method, path string, query url.Values) (*http.Response, error) {
+	token, err := s.tokens.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s %s: status code %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// sleep waits for d and reports whether ctx is still active.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
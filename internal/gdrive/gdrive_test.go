@@ -0,0 +1,183 @@
+package gdrive
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	var (
+		mu      sync.Mutex
+		moved   []string
+		polls   int
+		tokens  int
+		pending = make(chan struct{})
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.FormValue("grant_type"))
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		assert.Len(t, parts, 3)
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig))
+		mu.Lock()
+		tokens++
+		mu.Unlock()
+		w.Write([]byte(`{"access_token": "secret", "expires_in": 3600}`))
+	})
+	api := func(pattern string, fn http.HandlerFunc) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+			fn(w, r)
+		})
+	}
+	api("GET /changes/startPageToken", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"startPageToken": "1"}`))
+	})
+	api("GET /files", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "'inbox' in parents and trashed = false", r.URL.Query().Get("q"))
+		w.Write([]byte(`{"files": [
+			{"id": "a", "name": "a.pdf", "mimeType": "application/pdf", "parents": ["inbox"]},
+			{"id": "doc", "name": "Notes", "mimeType": "application/vnd.google-apps.document", "parents": ["inbox"]}
+		]}`))
+	})
+	api("GET /changes", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		polls++
+		if polls == 1 {
+			assert.Equal(t, "1", r.URL.Query().Get("pageToken"))
+			w.Write([]byte(`{"newStartPageToken": "2", "changes": [
+				{"file": {"id": "b", "name": "b.pdf", "mimeType": "application/pdf", "parents": ["inbox"]}},
+				{"file": {"id": "c", "name": "c.pdf", "mimeType": "application/pdf", "parents": ["elsewhere"]}},
+				{"removed": true}
+			]}`))
+			return
+		}
+		if polls == 2 {
+			close(pending)
+		}
+		assert.Equal(t, "2", r.URL.Query().Get("pageToken"))
+		w.Write([]byte(`{"newStartPageToken": "2"}`))
+	})
+	api("GET /files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "media", r.URL.Query().Get("alt"))
+		w.Write([]byte("content of " + r.PathValue("id")))
+	})
+	api("PATCH /files/{id}", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "done", r.URL.Query().Get("addParents"))
+		assert.Equal(t, "inbox", r.URL.Query().Get("removeParents"))
+		mu.Lock()
+		moved = append(moved, r.PathValue("id"))
+		mu.Unlock()
+		w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: must(x509.MarshalPKCS8PrivateKey(key))})
+	creds, _ := json.Marshal(serviceAccount{ClientEmail: "uploader@project.iam.gserviceaccount.com", PrivateKey: string(keyPEM), TokenURI: server.URL + "/token"})
+	credsFile := filepath.Join(t.TempDir(), "key.json")
+	assert.NoError(t, os.WriteFile(credsFile, creds, 0600))
+
+	s, err := New(config.GoogleDrive{
+		FolderID:          "inbox",
+		ProcessedFolderID: "done",
+		CredentialsFile:   credsFile,
+		PollInterval:      10 * time.Millisecond,
+	}, watcher.Folder{TagNames: []string{"drive"}})
+	assert.NoError(t, err)
+	s.baseURL = server.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, s.Start(ctx))
+	defer os.RemoveAll(s.dir)
+	files := make(map[string]watcher.File)
+	for len(files) < 2 {
+		select {
+		case f := <-s.Events():
+			files[filepath.Base(f.Path)] = f
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the downloads")
+		}
+	}
+	select {
+	case <-pending:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for changes")
+	}
+	cancel()
+	for f := range s.Events() {
+		t.Errorf("unexpected download %s", f.Path)
+	}
+
+	a, b := files["a.pdf"], files["b.pdf"]
+	assert.Equal(t, "gdrive:inbox", a.Folder.Path)
+	assert.Equal(t, []string{"drive"}, a.Folder.TagNames)
+	data, err := os.ReadFile(a.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "content of a", string(data))
+	assert.FileExists(t, b.Path)
+
+	// Uploaded files are moved, failed ones stay; both downloads are
+	// removed.
+	s.Complete(a, nil)
+	s.Complete(b, assert.AnError)
+	assert.Equal(t, []string{"a"}, moved)
+	assert.Equal(t, 1, tokens)
+	assert.NoFileExists(t, a.Path)
+	assert.NoFileExists(t, b.Path)
+}
+
+func TestSourceDryRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	}))
+	defer server.Close()
+
+	s, err := New(config.GoogleDrive{FolderID: "inbox", ClientID: "id", ClientSecret: "secret", RefreshToken: "token"}, watcher.Folder{})
+	assert.NoError(t, err)
+	s.baseURL = server.URL
+	s.DryRun = true
+
+	// Nothing is offered, so fetch would block if it downloaded the file.
+	s.fetch(context.Background(), file{ID: "a", Name: "a.pdf", MimeType: "application/pdf", Parents: []string{"inbox"}})
+	assert.True(t, s.seen["a"])
+	assert.Empty(t, s.downloaded)
+}
+
+func TestNewWithoutCredentials(t *testing.T) {
+	_, err := New(config.GoogleDrive{FolderID: "inbox"}, watcher.Folder{})
+	assert.Error(t, err)
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,340 @@
+// Package grpcapi serves the gRPC API defined in pkg/uploaderpb, which lets
+// other programs upload documents to a running watcher, follow its events
+// and pause, resume or rescan it.
+package grpcapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/c-yco/go-paperless-uploader/pkg/uploaderpb"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// eventBuffer is the number of events buffered per WatchEvents stream.
+// Events are dropped for clients that fall further behind.
+const eventBuffer = 256
+
+// Watcher is the part of the watcher controlled by the API.
+type Watcher interface {
+	Status() watcher.Status
+	Pause()
+	Resume()
+	Rescan()
+}
+
+// DeliverFunc stores an uploaded document in the watch folder named by
+// folder, or the default folder if it is empty, and returns its path. It
+// fails with ErrUnknownFolder for folders that are not watched.
+type DeliverFunc func(folder, name string, r io.Reader, md rules.Metadata) (string, error)
+
+// ErrUnknownFolder is returned by a DeliverFunc for folders that are not
+// watched.
+var ErrUnknownFolder = errors.New("not a watch folder")
+
+// Server serves the gRPC API.
+type Server struct {
+	uploaderpb.UnimplementedUploaderServer
+
+	// Addr is the listen address, e.g. ":9090".
+	Addr string
+	// Token must be sent by clients as bearer token.
+	Token string
+	// TLS secures the connections when set.
+	TLS *tls.Config
+	// MaxSize limits the size of an uploaded document in bytes.
+	MaxSize int64
+	Watcher Watcher
+	Deliver DeliverFunc
+
+	srv *grpc.Server
+	ln  net.Listener
+
+	mu          sync.Mutex
+	subscribers map[chan watcher.Event]bool
+}
+
+// Start listens on the configured address and serves calls in the
+// background. Listen errors are returned immediately.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.Addr, err)
+	}
+	s.ln = ln
+	opts := []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := s.authorize(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorize(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+	if s.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.TLS)))
+	}
+	s.srv = grpc.NewServer(opts...)
+	uploaderpb.RegisterUploaderServer(s.srv, s)
+	logging.Infof("gRPC API listening on %s", ln.Addr())
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			logging.Errorf("gRPC API failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// ListenAddr returns the address the server listens on.
+func (s *Server) ListenAddr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Shutdown stops the server, waiting for running calls to end until ctx is
+// done. Event streams are closed right away.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	for ch := range s.subscribers {
+		close(ch)
+	}
+	s.subscribers = nil
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.srv.Stop()
+		return ctx.Err()
+	}
+}
+
+// authorize checks the bearer token of a call.
+func (s *Server) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid token")
+}
+
+// Handle forwards watcher events to the WatchEvents streams. It is meant to
+// be registered with Watcher.OnEvent.
+func (s *Server) Handle(e watcher.Event) {
+	if e.Type == watcher.EventUploadProgress {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Upload implements uploaderpb.UploaderServer.
+func (s *Server) Upload(stream grpc.ClientStreamingServer[uploaderpb.UploadRequest, uploaderpb.UploadResponse]) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	meta := first.GetMetadata()
+	if meta == nil || meta.Filename == "" {
+		return status.Error(codes.InvalidArgument, "the first message must carry the metadata with a filename")
+	}
+	if meta.Asn < 0 {
+		return status.Error(codes.InvalidArgument, "invalid asn")
+	}
+	md := rules.Metadata{
+		Title:         meta.Title,
+		Created:       meta.Created,
+		Correspondent: meta.Correspondent,
+		DocumentType:  meta.DocumentType,
+		StoragePath:   meta.StoragePath,
+		Tags:          meta.Tags,
+		ASN:           int(meta.Asn),
+	}
+	r := &chunkReader{stream: stream, max: s.MaxSize}
+	path, err := s.Deliver(meta.Folder, meta.Filename, r, md)
+	switch {
+	case r.err != nil:
+		return r.err
+	case errors.Is(err, ErrUnknownFolder):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		logging.Errorf("gRPC API failed to store %s: %v", meta.Filename, err)
+		return status.Error(codes.Internal, "failed to store document")
+	}
+	logging.Infof("Received %s over gRPC", path)
+	return stream.SendAndClose(&uploaderpb.UploadResponse{Path: path, Size: r.size})
+}
+
+// chunkReader reads the content of an Upload stream.
+type chunkReader struct {
+	stream grpc.ClientStreamingServer[uploaderpb.UploadRequest, uploaderpb.UploadResponse]
+	max    int64
+	buf    []byte
+	size   int64
+	// err is the status returned for a failed stream.
+	err error
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		req, err := c.stream.Recv()
+		if err == io.EOF {
+			return 0, io.EOF
+		}
+		if err != nil {
+			c.err = err
+			return 0, err
+		}
+		if req.GetMetadata() != nil {
+			c.err = status.Error(codes.InvalidArgument, "metadata may only be sent first")
+			return 0, c.err
+		}
+		c.buf = req.GetChunk()
+		c.size += int64(len(c.buf))
+		if c.max > 0 && c.size > c.max {
+			c.err = status.Errorf(codes.ResourceExhausted, "document larger than %d bytes", c.max)
+			return 0, c.err
+		}
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// GetStatus implements uploaderpb.UploaderServer.
+func (s *Server) GetStatus(ctx context.Context, _ *uploaderpb.GetStatusRequest) (*uploaderpb.Status, error) {
+	st := s.Watcher.Status()
+	resp := &uploaderpb.Status{
+		Watching:     st.Watching,
+		StartedAt:    timestamp(st.StartedAt),
+		QueueDepth:   int32(st.QueueDepth),
+		InFlight:     int32(st.InFlight),
+		RetryBacklog: int32(st.RetryBacklog),
+		Paused:       st.Paused,
+	}
+	for _, f := range st.Folders {
+		resp.Folders = append(resp.Folders, &uploaderpb.FolderStatus{
+			Path:            f.Path,
+			Uploaded:        int32(f.Uploaded),
+			Failed:          int32(f.Failed),
+			LastSuccess:     timestamp(f.LastSuccess),
+			LastSuccessFile: f.LastSuccessFile,
+			LastFailure:     timestamp(f.LastFailure),
+			LastFailureFile: f.LastFailureFile,
+			LastError:       f.LastError,
+		})
+	}
+	return resp, nil
+}
+
+// WatchEvents implements uploaderpb.UploaderServer.
+func (s *Server) WatchEvents(_ *uploaderpb.WatchEventsRequest, stream grpc.ServerStreamingServer[uploaderpb.Event]) error {
+	ch := make(chan watcher.Event, eventBuffer)
+	s.mu.Lock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[chan watcher.Event]bool)
+	}
+	s.subscribers[ch] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		if s.subscribers[ch] {
+			delete(s.subscribers, ch)
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e, ok := <-ch:
+			if !ok {
+				return status.Error(codes.Unavailable, "shutting down")
+			}
+			if err := stream.Send(event(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Pause implements uploaderpb.UploaderServer.
+func (s *Server) Pause(context.Context, *uploaderpb.PauseRequest) (*uploaderpb.PauseResponse, error) {
+	s.Watcher.Pause()
+	return &uploaderpb.PauseResponse{}, nil
+}
+
+// Resume implements uploaderpb.UploaderServer.
+func (s *Server) Resume(context.Context, *uploaderpb.ResumeRequest) (*uploaderpb.ResumeResponse, error) {
+	s.Watcher.Resume()
+	return &uploaderpb.ResumeResponse{}, nil
+}
+
+// Rescan implements uploaderpb.UploaderServer.
+func (s *Server) Rescan(context.Context, *uploaderpb.RescanRequest) (*uploaderpb.RescanResponse, error) {
+	s.Watcher.Rescan()
+	return &uploaderpb.RescanResponse{}, nil
+}
+
+// event converts a watcher event to its API message.
+func event(e watcher.Event) *uploaderpb.Event {
+	msg := &uploaderpb.Event{
+		Type:       string(e.Type),
+		Time:       timestamp(e.Time),
+		Id:         e.ID,
+		Folder:     e.Folder,
+		Path:       e.Path,
+		Attempt:    int32(e.Attempt),
+		TaskId:     e.TaskID,
+		DocumentId: int32(e.DocumentID),
+		Url:        e.URL,
+		Dest:       e.Dest,
+	}
+	if e.Err != nil {
+		msg.Error = e.Err.Error()
+	}
+	return msg
+}
+
+// timestamp converts t, leaving zero times unset.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
@@ -0,0 +1,145 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/c-yco/go-paperless-uploader/pkg/uploaderpb"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeWatcher struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeWatcher) Status() watcher.Status {
+	return watcher.Status{Watching: true, QueueDepth: 2, Folders: []watcher.FolderStatus{{Path: "consume", Uploaded: 3}}}
+}
+
+func (f *fakeWatcher) Pause()  { f.record("pause") }
+func (f *fakeWatcher) Resume() { f.record("resume") }
+func (f *fakeWatcher) Rescan() { f.record("rescan") }
+
+func (f *fakeWatcher) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func TestServer(t *testing.T) {
+	fw := &fakeWatcher{}
+	var (
+		gotContent string
+		gotMD      rules.Metadata
+	)
+	s := &Server{
+		Addr:    "127.0.0.1:0",
+		Token:   "secret",
+		MaxSize: 10,
+		Watcher: fw,
+		Deliver: func(folder, name string, r io.Reader, md rules.Metadata) (string, error) {
+			if folder != "" {
+				return "", ErrUnknownFolder
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return "", err
+			}
+			gotContent, gotMD = string(data), md
+			return "consume/" + name, nil
+		},
+	}
+	assert.NoError(t, s.Start())
+	defer s.Shutdown(context.Background())
+
+	conn, err := grpc.NewClient(s.ListenAddr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := uploaderpb.NewUploaderClient(conn)
+
+	_, err = client.GetStatus(context.Background(), &uploaderpb.GetStatusRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	st, err := client.GetStatus(ctx, &uploaderpb.GetStatusRequest{})
+	assert.NoError(t, err)
+	assert.True(t, st.Watching)
+	assert.Equal(t, int32(2), st.QueueDepth)
+	assert.Equal(t, "consume", st.Folders[0].Path)
+	assert.Equal(t, int32(3), st.Folders[0].Uploaded)
+	assert.Nil(t, st.StartedAt)
+
+	_, err = client.Pause(ctx, &uploaderpb.PauseRequest{})
+	assert.NoError(t, err)
+	_, err = client.Resume(ctx, &uploaderpb.ResumeRequest{})
+	assert.NoError(t, err)
+	_, err = client.Rescan(ctx, &uploaderpb.RescanRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pause", "resume", "rescan"}, fw.calls)
+
+	upload := func(meta *uploaderpb.UploadMetadata, chunks ...string) (*uploaderpb.UploadResponse, error) {
+		stream, err := client.Upload(ctx)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Send(&uploaderpb.UploadRequest{Data: &uploaderpb.UploadRequest_Metadata{Metadata: meta}}))
+		for _, c := range chunks {
+			if err := stream.Send(&uploaderpb.UploadRequest{Data: &uploaderpb.UploadRequest_Chunk{Chunk: []byte(c)}}); err != nil {
+				break
+			}
+		}
+		return stream.CloseAndRecv()
+	}
+	resp, err := upload(&uploaderpb.UploadMetadata{Filename: "scan.pdf", Title: "Invoice", Tags: []string{"inbox"}}, "%PDF", "-1.4")
+	assert.NoError(t, err)
+	assert.Equal(t, "consume/scan.pdf", resp.Path)
+	assert.Equal(t, int64(8), resp.Size)
+	assert.Equal(t, "%PDF-1.4", gotContent)
+	assert.Equal(t, rules.Metadata{Title: "Invoice", Tags: []string{"inbox"}}, gotMD)
+
+	_, err = upload(&uploaderpb.UploadMetadata{Filename: "big.pdf"}, "0123456789", "x")
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	_, err = upload(&uploaderpb.UploadMetadata{Filename: "a.pdf", Folder: "elsewhere"}, "x")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = upload(&uploaderpb.UploadMetadata{}, "x")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	events, err := client.WatchEvents(ctx, &uploaderpb.WatchEventsRequest{})
+	assert.NoError(t, err)
+	// The stream is registered once the first event could be delivered.
+	received := make(chan *uploaderpb.Event)
+	go func() {
+		for {
+			e, err := events.Recv()
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- e
+		}
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		s.Handle(watcher.Event{Type: watcher.EventUploadFailed, ID: "abc", Path: "consume/scan.pdf", Err: errors.New("boom"), Time: time.Now()})
+		select {
+		case e := <-received:
+			assert.Equal(t, "upload_failed", e.Type)
+			assert.Equal(t, "abc", e.Id)
+			assert.Equal(t, "boom", e.Error)
+			return
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// journalSocket is the socket of the systemd journal's native protocol.
+var journalSocket = "/run/systemd/journal/socket"
+
+// SetupJournald makes the package log to the systemd journal. The record's
+// attributes become journal fields, e.g. "file" is stored as FILE.
+func SetupJournald() error {
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the systemd journal: %w", err)
+	}
+	identifier := filepath.Base(os.Args[0])
+	setSink(func(r sinkRecord) error {
+		_, err := conn.Write(journalEntry(identifier, r))
+		return err
+	})
+	return nil
+}
+
+// journalEntry encodes r in the journal's native protocol.
+func journalEntry(identifier string, r sinkRecord) []byte {
+	var b bytes.Buffer
+	field := func(name, value string) {
+		if !strings.Contains(value, "\n") {
+			b.WriteString(name + "=" + value + "\n")
+			return
+		}
+		// Values containing newlines are length prefixed.
+		b.WriteString(name + "\n")
+		binary.Write(&b, binary.LittleEndian, uint64(len(value)))
+		b.WriteString(value + "\n")
+	}
+	field("MESSAGE", r.Message)
+	field("PRIORITY", strconv.Itoa(severity(r.Level)))
+	field("SYSLOG_IDENTIFIER", identifier)
+	for _, a := range r.Attrs {
+		if name := journalFieldName(a.Key); name != "" {
+			field(name, a.Value.String())
+		}
+	}
+	return b.Bytes()
+}
+
+// journalFieldName converts an attribute key to a valid journal field name:
+// upper case letters, digits and underscores, not starting with an
+// underscore or digit.
+func journalFieldName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return unicode.ToUpper(r)
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+	name = strings.TrimLeft(name, "_0123456789")
+	switch name {
+	case "MESSAGE", "PRIORITY", "SYSLOG_IDENTIFIER":
+		return "ATTR_" + name
+	}
+	return name
+}
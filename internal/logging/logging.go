@@ -0,0 +1,192 @@
+// Package logging provides leveled, structured logging on top of log/slog.
+//
+// Until Setup or SetLogger is called, records go to slog.Default, so programs
+// embedding the watcher control the output by configuring their own default
+// logger.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Level is a logging severity.
+type Level int32
+
+// Log levels, from most to least verbose.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// Slog returns the matching slog level.
+func (l Level) Slog() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(s string) (Level, error) {
+	for level, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return level, nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return LevelWarn, nil
+	}
+	return LevelInfo, fmt.Errorf("invalid log level %q: must be debug, info, warn or error", s)
+}
+
+// Keys of the fields shared by log records across the application.
+const (
+	KeyFile     = "file"
+	KeyFolder   = "folder"
+	KeyProfile  = "profile"
+	KeyInstance = "instance"
+	KeyID       = "id"
+	KeyDuration = "duration"
+	KeyStatus   = "status"
+	KeyError    = "error"
+)
+
+var (
+	current atomic.Int32
+	level   slog.LevelVar
+	logger  atomic.Pointer[slog.Logger]
+	out     = &switchWriter{}
+)
+
+func init() {
+	SetLevel(LevelInfo)
+}
+
+// SetLevel sets the minimum level logged by the handlers created by Setup.
+func SetLevel(l Level) {
+	current.Store(int32(l))
+	level.Set(l.Slog())
+}
+
+// GetLevel returns the minimum level that is logged.
+func GetLevel() Level {
+	return Level(current.Load())
+}
+
+// Enabled reports whether messages at level l are logged.
+func Enabled(l Level) bool {
+	return Logger().Enabled(context.Background(), l.Slog())
+}
+
+// Setup makes the package log records to w, in "text" or "json" format,
+// filtered by the level set with SetLevel.
+func Setup(w io.Writer, format string) error {
+	out.set(w)
+	opts := &slog.HandlerOptions{Level: &level}
+	switch format {
+	case "text", "":
+		SetLogger(slog.New(slog.NewTextHandler(out, opts)))
+	case "json":
+		SetLogger(slog.New(slog.NewJSONHandler(out, opts)))
+	default:
+		return fmt.Errorf("invalid log format %q: must be text or json", format)
+	}
+	return nil
+}
+
+// SetOutput redirects the output of the handler created by Setup and
+// returns the previous writer.
+func SetOutput(w io.Writer) io.Writer {
+	return out.set(w)
+}
+
+// SetLogger replaces the logger used by the package. A nil logger restores
+// slog.Default. The secrets registered with AddSecret are redacted from the
+// records of l.
+func SetLogger(l *slog.Logger) {
+	if l != nil {
+		if _, ok := l.Handler().(*redactHandler); !ok {
+			l = slog.New(&redactHandler{next: l.Handler()})
+		}
+	}
+	logger.Store(l)
+}
+
+// Logger returns the logger used by the package.
+func Logger() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	return slog.Default()
+}
+
+func logf(l Level, format string, args ...interface{}) {
+	lg := Logger()
+	if !lg.Enabled(context.Background(), l.Slog()) {
+		return
+	}
+	lg.Log(context.Background(), l.Slog(), fmt.Sprintf(format, args...))
+}
+
+// Debugf logs a debug message.
+func Debugf(format string, args ...interface{}) { logf(LevelDebug, format, args...) }
+
+// Infof logs an informational message.
+func Infof(format string, args ...interface{}) { logf(LevelInfo, format, args...) }
+
+// Warnf logs a warning.
+func Warnf(format string, args ...interface{}) { logf(LevelWarn, format, args...) }
+
+// Errorf logs an error.
+func Errorf(format string, args ...interface{}) { logf(LevelError, format, args...) }
+
+// switchWriter is a writer whose destination can be changed while handlers
+// are using it.
+type switchWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *switchWriter) set(w io.Writer) io.Writer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.w
+	s.w = w
+	return prev
+}
+
+func (s *switchWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		return len(b), nil
+	}
+	return s.w.Write(b)
+}
@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// minSecretLen is the length below which values are not registered as
+// secrets, as redacting them would mangle unrelated text.
+const minSecretLen = 4
+
+// secrets is the registry of values redacted from all output.
+var secrets struct {
+	mu       sync.RWMutex
+	values   map[string]bool
+	replacer *strings.Replacer
+}
+
+// AddSecret registers values, such as API keys, passwords and tokens, that
+// are replaced by "REDACTED" in every log record and in the output of
+// Redact. Empty and very short values are ignored.
+func AddSecret(values ...string) {
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	changed := false
+	for _, v := range values {
+		if len(v) < minSecretLen || secrets.values[v] {
+			continue
+		}
+		if secrets.values == nil {
+			secrets.values = make(map[string]bool)
+		}
+		secrets.values[v] = true
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	// Longer secrets first, so a secret containing another one is
+	// redacted as a whole.
+	sorted := make([]string, 0, len(secrets.values))
+	for v := range secrets.values {
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	var pairs []string
+	for _, v := range sorted {
+		pairs = append(pairs, v, "REDACTED")
+	}
+	secrets.replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact returns s with the registered secrets replaced.
+func Redact(s string) string {
+	secrets.mu.RLock()
+	r := secrets.replacer
+	secrets.mu.RUnlock()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// redacting reports whether any secrets are registered.
+func redacting() bool {
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+	return secrets.replacer != nil
+}
+
+// redactHandler redacts the registered secrets from the message and the
+// attributes of records before passing them to next.
+type redactHandler struct {
+	next slog.Handler
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return h.next.Enabled(ctx, l)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	if !redacting() {
+		return h.next.Handle(ctx, r)
+	}
+	redacted := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	// Attributes added here are redacted with the secrets known now.
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return &redactHandler{next: h.next.WithAttrs(redacted)}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{next: h.next.WithGroup(name)}
+}
+
+// redactAttr redacts the string form of a's value. Values other than
+// strings, errors and groups, e.g. numbers, are kept.
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		redacted := make([]any, len(group))
+		for i, ga := range group {
+			redacted[i] = redactAttr(ga)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+		if s, ok := v.Any().(interface{ String() string }); ok {
+			return slog.String(a.Key, Redact(s.String()))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
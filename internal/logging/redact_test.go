@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	AddSecret("", "abc", "s3cr3t-token", "s3cr3t-token-long")
+	assert.Equal(t, "token=REDACTED and REDACTED, abc", Redact("token=s3cr3t-token and s3cr3t-token-long, abc"))
+
+	buf := captureLog(t)
+	Errorf("request to https://api.telegram.org/bots3cr3t-token/sendMessage failed")
+	Logger().With("key", "s3cr3t-token").Warn("upload failed",
+		KeyError, errors.New("bad key s3cr3t-token"),
+		slog.Group("auth", "header", "Token s3cr3t-token"),
+		"attempt", 2)
+	out := buf.String()
+	assert.NotContains(t, out, "s3cr3t")
+	assert.Contains(t, out, "/botREDACTED/sendMessage")
+	assert.Contains(t, out, `key=REDACTED`)
+	assert.Contains(t, out, `error="bad key REDACTED"`)
+	assert.Contains(t, out, `auth.header="Token REDACTED"`)
+	assert.Contains(t, out, "attempt=2")
+}
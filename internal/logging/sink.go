@@ -0,0 +1,126 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sinkRecord is a log record with its attributes flattened, group names
+// joined to the keys with dots.
+type sinkRecord struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	Attrs   []slog.Attr
+}
+
+// sinkHandler is a slog.Handler passing flattened records to a sink such as
+// syslog or the systemd journal.
+type sinkHandler struct {
+	level slog.Leveler
+	attrs []slog.Attr
+	group string
+	write func(sinkRecord) error
+}
+
+func (h *sinkHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *sinkHandler) Handle(_ context.Context, r slog.Record) error {
+	rec := sinkRecord{Time: r.Time, Level: r.Level, Message: r.Message, Attrs: append([]slog.Attr{}, h.attrs...)}
+	r.Attrs(func(a slog.Attr) bool {
+		rec.Attrs = appendAttr(rec.Attrs, h.group, a)
+		return true
+	})
+	return h.write(rec)
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append([]slog.Attr{}, h.attrs...)
+	for _, a := range attrs {
+		h2.attrs = appendAttr(h2.attrs, h.group, a)
+	}
+	return &h2
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.group = joinKey(h.group, name)
+	return &h2
+}
+
+func appendAttr(attrs []slog.Attr, group string, a slog.Attr) []slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return attrs
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			attrs = appendAttr(attrs, joinKey(group, a.Key), ga)
+		}
+		return attrs
+	}
+	a.Key = joinKey(group, a.Key)
+	return append(attrs, a)
+}
+
+func joinKey(group, key string) string {
+	if group == "" {
+		return key
+	}
+	if key == "" {
+		return group
+	}
+	return group + "." + key
+}
+
+// formatAttrs renders attrs as space separated key=value pairs, quoting
+// values where necessary.
+func formatAttrs(attrs []slog.Attr) string {
+	var b strings.Builder
+	for i, a := range attrs {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(a.Key)
+		b.WriteByte('=')
+		v := a.Value.String()
+		if v == "" || strings.ContainsAny(v, " \"=\n") {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(v)
+	}
+	return b.String()
+}
+
+// severity maps a slog level to a syslog severity.
+func severity(l slog.Level) int {
+	switch {
+	case l >= slog.LevelError:
+		return 3 // err
+	case l >= slog.LevelWarn:
+		return 4 // warning
+	case l >= slog.LevelInfo:
+		return 6 // info
+	}
+	return 7 // debug
+}
+
+// setSink makes the package log to write.
+func setSink(write func(sinkRecord) error) {
+	SetLogger(slog.New(&sinkHandler{level: &level, write: func(r sinkRecord) error {
+		if err := write(r); err != nil {
+			return fmt.Errorf("failed to write log record: %w", err)
+		}
+		return nil
+	}}))
+}
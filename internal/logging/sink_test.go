@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSinkHandler(t *testing.T) {
+	var got sinkRecord
+	l := slog.New(&sinkHandler{level: slog.LevelInfo, write: func(r sinkRecord) error {
+		got = r
+		return nil
+	}})
+
+	l.Debug("hidden")
+	assert.Empty(t, got.Message)
+
+	l.With("id", "abc").WithGroup("upload").Info("done", "file", "a.pdf", slog.Group("task", "id", 7))
+	assert.Equal(t, "done", got.Message)
+	assert.Equal(t, `id=abc upload.file=a.pdf upload.task.id=7`, formatAttrs(got.Attrs))
+}
+
+func TestSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.NoError(t, SetupSyslog("udp://"+conn.LocalAddr().String()))
+	t.Cleanup(func() { SetLogger(nil) })
+
+	Logger().Warn("Upload failed", KeyFile, "scan 1.pdf")
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	msg := string(buf[:n])
+
+	// daemon.warning = 3*8+4
+	assert.True(t, strings.HasPrefix(msg, "<28>1 "), msg)
+	assert.True(t, strings.HasSuffix(msg, ` - - Upload failed file="scan 1.pdf"`), msg)
+
+	assert.Error(t, SetupSyslog("http://localhost"))
+}
+
+func TestSeverity(t *testing.T) {
+	assert.Equal(t, 7, severity(slog.LevelDebug))
+	assert.Equal(t, 6, severity(slog.LevelInfo))
+	assert.Equal(t, 4, severity(slog.LevelWarn))
+	assert.Equal(t, 3, severity(slog.LevelError))
+}
+
+func TestJournald(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "journal.socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unix datagram sockets not supported: %v", err)
+	}
+	defer conn.Close()
+
+	prev := journalSocket
+	journalSocket = socket
+	assert.NoError(t, SetupJournald())
+	t.Cleanup(func() {
+		journalSocket = prev
+		SetLogger(nil)
+	})
+
+	Logger().Error("Upload failed", KeyFile, "a.pdf", KeyError, "line 1\nline 2", "task-id", 3)
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	entry := string(buf[:n])
+
+	assert.Contains(t, entry, "MESSAGE=Upload failed\n")
+	assert.Contains(t, entry, "PRIORITY=3\n")
+	assert.Contains(t, entry, "FILE=a.pdf\n")
+	assert.Contains(t, entry, "TASK_ID=3\n")
+	length := make([]byte, 8)
+	binary.LittleEndian.PutUint64(length, uint64(len("line 1\nline 2")))
+	assert.Contains(t, entry, "ERROR\n"+string(length)+"line 1\nline 2\n")
+}
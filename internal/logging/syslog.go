@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// facilityDaemon is the syslog facility used for all messages.
+const facilityDaemon = 3
+
+// localSyslogSockets are tried when no syslog address is given.
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SetupSyslog makes the package log RFC 5424 messages to a syslog server.
+// addr is "udp://host:port", "tcp://host:port" or "unix:///path"; empty
+// uses the local syslog socket.
+func SetupSyslog(addr string) error {
+	w, err := newSyslogWriter(addr)
+	if err != nil {
+		return err
+	}
+	setSink(w.write)
+	return nil
+}
+
+// syslogWriter sends records to a syslog server, reconnecting after errors.
+type syslogWriter struct {
+	network, address string
+	hostname, app    string
+	pid              int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newSyslogWriter(addr string) (*syslogWriter, error) {
+	w := &syslogWriter{app: filepath.Base(os.Args[0]), pid: os.Getpid()}
+	w.hostname, _ = os.Hostname()
+	if w.hostname == "" {
+		w.hostname = "-"
+	}
+
+	if addr == "" {
+		for _, path := range localSyslogSockets {
+			if conn, err := net.Dial("unixgram", path); err == nil {
+				w.network, w.address, w.conn = "unixgram", path, conn
+				return w, nil
+			}
+		}
+		return nil, fmt.Errorf("no local syslog socket found")
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address %q: %w", addr, err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		w.network, w.address = u.Scheme, u.Host
+	case "unix":
+		w.network, w.address = "unixgram", u.Path
+	default:
+		return nil, fmt.Errorf("invalid syslog address %q: scheme must be udp, tcp or unix", addr)
+	}
+	if w.conn, err = net.Dial(w.network, w.address); err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return w, nil
+}
+
+// format renders r as an RFC 5424 message.
+func (w *syslogWriter) format(r sinkRecord) string {
+	msg := r.Message
+	if len(r.Attrs) > 0 {
+		msg += " " + formatAttrs(r.Attrs)
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		facilityDaemon*8+severity(r.Level), r.Time.Format(time.RFC3339Nano), w.hostname, w.app, w.pid, msg)
+}
+
+func (w *syslogWriter) write(r sinkRecord) error {
+	msg := w.format(r)
+	if w.network == "tcp" {
+		// Octet counting framing as described in RFC 6587.
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if w.conn == nil {
+			if w.conn, err = net.Dial(w.network, w.address); err != nil {
+				continue
+			}
+		}
+		if _, err = w.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// sensitiveParams are query parameters whose values are never logged.
+var sensitiveParams = []string{"token", "api_key", "apikey", "key", "password", "secret"}
+
+// Transport wraps next so every request and response is summarised at debug
+// level. Credentials in headers and URLs are redacted. A nil next uses
+// http.DefaultTransport.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{next: next}
+}
+
+type transport struct {
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !Enabled(LevelDebug) {
+		return t.next.RoundTrip(req)
+	}
+
+	start := time.Now()
+	lg := Logger().With("method", req.Method, "url", RedactURL(req.URL))
+	lg.Debug("HTTP request", "auth", redactAuth(req.Header.Get("Authorization")), "length", req.ContentLength)
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		lg.Debug("HTTP request failed", KeyDuration, elapsed, KeyError, err)
+		return nil, err
+	}
+	lg.Debug("HTTP response", KeyStatus, resp.StatusCode, "length", resp.ContentLength, "content_type", resp.Header.Get("Content-Type"), KeyDuration, elapsed)
+	return resp, nil
+}
+
+// RedactURL returns u with its password and sensitive query values replaced.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redacted := *u
+	query := redacted.Query()
+	changed := false
+	for name := range query {
+		for _, sensitive := range sensitiveParams {
+			if strings.EqualFold(name, sensitive) {
+				query.Set(name, "REDACTED")
+				changed = true
+			}
+		}
+	}
+	if changed {
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.Redacted()
+}
+
+// redactAuth keeps only the scheme of an Authorization header.
+func redactAuth(value string) string {
+	if value == "" {
+		return "none"
+	}
+	scheme, _, _ := strings.Cut(value, " ")
+	return scheme + " REDACTED"
+}
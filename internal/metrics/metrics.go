@@ -0,0 +1,126 @@
+// Package metrics exposes watcher activity as Prometheus metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "paperless_uploader"
+
+// Metrics collects the metrics of a watcher.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	uploaded      *prometheus.CounterVec
+	failed        *prometheus.CounterVec
+	bytes         *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	retries       *prometheus.CounterVec
+	lastSuccess   *prometheus.GaugeVec
+	watcherStarts prometheus.Counter
+}
+
+// New creates the metrics for w and subscribes to its events. It must be
+// called before w.Run.
+func New(w *watcher.Watcher) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		uploaded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "documents_uploaded_total",
+			Help:      "Documents uploaded successfully.",
+		}, []string{"folder"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "documents_failed_total",
+			Help:      "Documents whose upload failed after all retries.",
+		}, []string{"folder"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "uploaded_bytes_total",
+			Help:      "Bytes sent for successful uploads.",
+		}, []string{"folder"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "upload_duration_seconds",
+			Help:      "Duration of upload attempts.",
+			Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+		}, []string{"folder", "result"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "upload_retries_total",
+			Help:      "Failed upload attempts that were scheduled for a retry.",
+		}, []string{"folder"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_upload_timestamp_seconds",
+			Help:      "Unix time of the last successful upload.",
+		}, []string{"folder"}),
+		watcherStarts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "watcher_starts_total",
+			Help:      "Times the watcher started watching its folders.",
+		}),
+	}
+
+	gauge := func(name, help string, value func(watcher.Status) int) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help}, func() float64 {
+			return float64(value(w.Status()))
+		})
+	}
+	m.registry.MustRegister(
+		m.uploaded, m.failed, m.bytes, m.duration, m.retries, m.lastSuccess, m.watcherStarts,
+		gauge("queue_depth", "Files waiting to settle or to be uploaded.", func(s watcher.Status) int { return s.QueueDepth }),
+		gauge("uploads_in_flight", "Uploads currently in progress.", func(s watcher.Status) int { return s.InFlight }),
+		gauge("retry_backlog", "Failed uploads waiting for their next attempt.", func(s watcher.Status) int { return s.RetryBacklog }),
+		gauge("watching", "1 while the folders are being watched.", func(s watcher.Status) int {
+			if s.Watching {
+				return 1
+			}
+			return 0
+		}),
+		gauge("circuit_open", "1 while uploads are held because Paperless is down.", func(s watcher.Status) int {
+			if s.CircuitOpen {
+				return 1
+			}
+			return 0
+		}),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	w.OnEvent(m.handle)
+	return m
+}
+
+func (m *Metrics) handle(e watcher.Event) {
+	switch e.Type {
+	case watcher.EventWatching:
+		m.watcherStarts.Inc()
+	case watcher.EventUploaded:
+		m.uploaded.WithLabelValues(e.Folder).Inc()
+		m.bytes.WithLabelValues(e.Folder).Add(float64(e.Total))
+		m.duration.WithLabelValues(e.Folder, "success").Observe(e.Duration.Seconds())
+		m.lastSuccess.WithLabelValues(e.Folder).Set(float64(e.Time.Unix()))
+	case watcher.EventRetryScheduled:
+		m.retries.WithLabelValues(e.Folder).Inc()
+		m.duration.WithLabelValues(e.Folder, "error").Observe(e.Duration.Seconds())
+	case watcher.EventUploadFailed:
+		m.failed.WithLabelValues(e.Folder).Inc()
+		m.duration.WithLabelValues(e.Folder, "error").Observe(e.Duration.Seconds())
+	}
+}
+
+// Registry returns the registry holding the metrics.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	w := watcher.New(nil, []watcher.Folder{{Path: "consume"}})
+	m := New(w)
+
+	now := time.Now()
+	m.handle(watcher.Event{Type: watcher.EventWatching})
+	m.handle(watcher.Event{Type: watcher.EventUploaded, Time: now, Folder: "consume", Total: 1024, Duration: 300 * time.Millisecond})
+	m.handle(watcher.Event{Type: watcher.EventRetryScheduled, Folder: "consume", Duration: time.Second})
+	m.handle(watcher.Event{Type: watcher.EventUploadFailed, Folder: "consume", Duration: time.Second})
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.uploaded.WithLabelValues("consume")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.failed.WithLabelValues("consume")))
+	assert.Equal(t, 1024.0, testutil.ToFloat64(m.bytes.WithLabelValues("consume")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.retries.WithLabelValues("consume")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.watcherStarts))
+	assert.Equal(t, float64(now.Unix()), testutil.ToFloat64(m.lastSuccess.WithLabelValues("consume")))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, metric := range []string{
+		`paperless_uploader_documents_uploaded_total{folder="consume"} 1`,
+		`paperless_uploader_upload_duration_seconds_count{folder="consume",result="error"} 2`,
+		"paperless_uploader_queue_depth 0",
+		"paperless_uploader_watching 0",
+	} {
+		assert.Contains(t, body, metric)
+	}
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// defaultPushJob is the job label used when none is configured.
+const defaultPushJob = "paperless_uploader"
+
+// Run summarizes a one-shot run for the Pushgateway.
+type Run struct {
+	Start    time.Time
+	Uploaded int
+	Failed   int
+	// Err is the error the run ended with, if any.
+	Err error
+}
+
+// PushRun pushes the metrics of run to the configured Pushgateway, replacing
+// those of the previous run of the same job and instance.
+func PushRun(cfg config.Pushgateway, run Run) error {
+	registry := prometheus.NewRegistry()
+	gauge := func(name, help string, value float64) {
+		g := prometheus.NewGauge(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help})
+		g.Set(value)
+		registry.MustRegister(g)
+	}
+	end := time.Now()
+	success := 0.0
+	if run.Err == nil && run.Failed == 0 {
+		success = 1
+	}
+	gauge("run_documents_uploaded", "Documents uploaded by the last run.", float64(run.Uploaded))
+	gauge("run_documents_failed", "Documents the last run failed to upload.", float64(run.Failed))
+	gauge("run_duration_seconds", "Duration of the last run.", end.Sub(run.Start).Seconds())
+	gauge("run_success", "Whether the last run completed without failures.", success)
+	gauge("run_timestamp_seconds", "Unix time the last run ended.", float64(end.Unix()))
+
+	job := cfg.Job
+	if job == "" {
+		job = defaultPushJob
+	}
+	pusher := push.New(cfg.URL, job).Gatherer(registry)
+	instance := cfg.Instance
+	if host, err := os.Hostname(); instance == "" && err == nil {
+		instance = config.Namespaced(host)
+	}
+	if instance != "" {
+		pusher = pusher.Grouping("instance", instance)
+	}
+	if cfg.Username != "" {
+		pusher = pusher.BasicAuth(cfg.Username, cfg.Password)
+	}
+	if err := pusher.Push(); err != nil {
+		return fmt.Errorf("failed to push metrics to %s: %w", cfg.URL, err)
+	}
+	return nil
+}
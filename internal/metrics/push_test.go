@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushRun(t *testing.T) {
+	var (
+		method, path, user string
+		body               []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		user, _, _ = r.BasicAuth()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := config.Pushgateway{URL: server.URL, Instance: "scanner", Username: "push", Password: "secret"}
+	run := Run{Start: time.Now().Add(-time.Minute), Uploaded: 3, Failed: 1}
+	assert.NoError(t, PushRun(cfg, run))
+	assert.Equal(t, "PUT", method)
+	assert.Equal(t, "/metrics/job/paperless_uploader/instance/scanner", path)
+	assert.Equal(t, "push", user)
+	// The body is protobuf encoded; the metric names are plain strings.
+	assert.Contains(t, string(body), "paperless_uploader_run_documents_uploaded")
+	assert.Contains(t, string(body), "paperless_uploader_run_success")
+
+	cfg.Job = "nightly"
+	assert.NoError(t, PushRun(cfg, Run{Start: time.Now(), Err: errors.New("boom")}))
+	assert.Equal(t, "/metrics/job/nightly/instance/scanner", path)
+
+	server.Close()
+	assert.Error(t, PushRun(cfg, run))
+}
@@ -0,0 +1,279 @@
+// Package migrate imports archives organized in folders, such as
+// Archive/<Correspondent>/<Year>/..., into Paperless: the metadata of every
+// file is derived from its path according to a layout, and the
+// correspondents, document types and tags it names are created as needed.
+package migrate
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+)
+
+// DefaultLayout files documents by correspondent and year.
+const DefaultLayout = "{correspondent}/{year}"
+
+// Layout fields a folder can stand for.
+const (
+	FieldCorrespondent = "correspondent"
+	FieldDocumentType  = "document_type"
+	FieldStoragePath   = "storage_path"
+	FieldTag           = "tag"
+	FieldYear          = "year"
+	FieldMonth         = "month"
+	FieldDay           = "day"
+)
+
+// Layout describes what the folders of an archive stand for, from the top.
+type Layout struct {
+	// fields holds the field of every folder level, empty for levels
+	// that are ignored.
+	fields []string
+}
+
+// ParseLayout parses a layout such as "{correspondent}/{year}/*". Every
+// element is the field a folder level stands for, or "*" for a level that
+// is ignored. Folders below the last level, and tags, add tags named after
+// them.
+func ParseLayout(s string) (Layout, error) {
+	var l Layout
+	for _, elem := range strings.Split(strings.Trim(s, "/"), "/") {
+		if elem == "*" {
+			l.fields = append(l.fields, "")
+			continue
+		}
+		name, open := strings.CutPrefix(elem, "{")
+		name, closed := strings.CutSuffix(name, "}")
+		if !open || !closed {
+			return Layout{}, fmt.Errorf("invalid layout element %q: expected {field} or *", elem)
+		}
+		switch name {
+		case FieldCorrespondent, FieldDocumentType, FieldStoragePath, FieldTag, FieldYear, FieldMonth, FieldDay:
+		default:
+			return Layout{}, fmt.Errorf("unknown layout field %q", name)
+		}
+		if name != FieldTag && slices.Contains(l.fields, name) {
+			return Layout{}, fmt.Errorf("layout field %q is used twice", name)
+		}
+		l.fields = append(l.fields, name)
+	}
+	return l, nil
+}
+
+// filenameDate matches a date at the start of a file name, as YYYY-MM-DD,
+// YYYY_MM_DD or YYYYMMDD.
+var filenameDate = regexp.MustCompile(`^(\d{4})[-_]?(\d{2})[-_]?(\d{2})(?:\D|$)`)
+
+// Derive returns the metadata of the file at rel, a slash-separated path
+// relative to the archive. The creation date is taken from the file name
+// if it starts with one, otherwise from the year, month and day folders;
+// missing months and days count as the first. Folders that do not hold a
+// valid year, month or day are ignored.
+func (l Layout) Derive(rel string) rules.Metadata {
+	var md rules.Metadata
+	dirs := strings.Split(path.Dir(rel), "/")
+	if dirs[0] == "." {
+		dirs = nil
+	}
+	var year, month, day int
+	for i, dir := range dirs {
+		field := FieldTag
+		if i < len(l.fields) {
+			field = l.fields[i]
+		}
+		switch field {
+		case FieldCorrespondent:
+			md.Correspondent = dir
+		case FieldDocumentType:
+			md.DocumentType = dir
+		case FieldStoragePath:
+			md.StoragePath = dir
+		case FieldTag:
+			md.Tags = append(md.Tags, dir)
+		case FieldYear:
+			year = number(dir, 1, 9999)
+		case FieldMonth:
+			month = number(dir, 1, 12)
+		case FieldDay:
+			day = number(dir, 1, 31)
+		}
+	}
+	if m := filenameDate.FindStringSubmatch(path.Base(rel)); m != nil {
+		md.Created = m[1] + "-" + m[2] + "-" + m[3]
+	} else if year > 0 {
+		md.Created = fmt.Sprintf("%04d-%02d-%02d", year, max(month, 1), max(day, 1))
+	}
+	return md
+}
+
+// number parses the leading digits of s, e.g. "03" of "03 March", and
+// returns zero if there are none or they are out of range.
+func number(s string, lo, hi int) int {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(s[:end])
+	if err != nil || n < lo || n > hi {
+		return 0
+	}
+	return n
+}
+
+// Resolver maps the names of correspondents, document types, storage paths
+// and tags to their IDs in Paperless, creating missing correspondents,
+// document types and tags. Storage paths need a path template and must
+// exist. It is safe for concurrent use.
+type Resolver struct {
+	client *paperless.Client
+	// Create creates missing entities; otherwise they are an error.
+	Create bool
+	// Created, if set, is called for every entity created, with its kind
+	// and name.
+	Created func(kind, name string)
+
+	mu            sync.Mutex
+	loaded        bool
+	correspondent map[string]int
+	documentType  map[string]int
+	storagePath   map[string]int
+	tag           map[string]int
+}
+
+// NewResolver returns a Resolver creating missing entities.
+func NewResolver(client *paperless.Client) *Resolver {
+	return &Resolver{client: client, Create: true}
+}
+
+// Resolve returns the upload options for md.
+func (r *Resolver) Resolve(md rules.Metadata) (paperless.UploadOptions, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.load(); err != nil {
+		return paperless.UploadOptions{}, err
+	}
+	opts := paperless.UploadOptions{Title: md.Title, Created: md.Created}
+	var err error
+	if opts.Correspondent, err = r.id("correspondent", r.correspondent, md.Correspondent); err != nil {
+		return opts, err
+	}
+	if opts.DocumentType, err = r.id("document type", r.documentType, md.DocumentType); err != nil {
+		return opts, err
+	}
+	if md.StoragePath != "" {
+		if err := r.loadStoragePaths(); err != nil {
+			return opts, err
+		}
+		if opts.StoragePath, err = r.id("storage path", r.storagePath, md.StoragePath); err != nil {
+			return opts, err
+		}
+	}
+	for _, name := range md.Tags {
+		id, err := r.id("tag", r.tag, name)
+		if err != nil {
+			return opts, err
+		}
+		if !slices.Contains(opts.Tags, *id) {
+			opts.Tags = append(opts.Tags, *id)
+		}
+	}
+	return opts, nil
+}
+
+// load fetches the existing entities once. r.mu must be held.
+func (r *Resolver) load() error {
+	if r.loaded {
+		return nil
+	}
+	correspondents, err := r.client.GetCorrespondents()
+	if err != nil {
+		return fmt.Errorf("failed to get correspondents from Paperless: %v", err)
+	}
+	types, err := r.client.GetDocumentTypes()
+	if err != nil {
+		return fmt.Errorf("failed to get document types from Paperless: %v", err)
+	}
+	tags, err := r.client.GetTags()
+	if err != nil {
+		return fmt.Errorf("failed to get tags from Paperless: %v", err)
+	}
+	r.correspondent = make(map[string]int)
+	for _, c := range correspondents {
+		r.correspondent[strings.ToLower(c.Name)] = c.ID
+	}
+	r.documentType = make(map[string]int)
+	for _, t := range types {
+		r.documentType[strings.ToLower(t.Name)] = t.ID
+	}
+	r.tag = make(map[string]int)
+	for _, t := range tags {
+		r.tag[strings.ToLower(t.Name)] = t.ID
+	}
+	r.loaded = true
+	return nil
+}
+
+// loadStoragePaths fetches the existing storage paths once. They are not
+// loaded with the other entities, so servers without storage paths work as
+// long as the layout names none. r.mu must be held.
+func (r *Resolver) loadStoragePaths() error {
+	if r.storagePath != nil {
+		return nil
+	}
+	paths, err := r.client.GetStoragePaths()
+	if err != nil {
+		return fmt.Errorf("failed to get storage paths from Paperless: %v", err)
+	}
+	r.storagePath = make(map[string]int)
+	for _, p := range paths {
+		r.storagePath[strings.ToLower(p.Name)] = p.ID
+	}
+	return nil
+}
+
+// id returns the ID of the entity of the kind named name, nil for an empty
+// name, creating it if it is missing. r.mu must be held.
+func (r *Resolver) id(kind string, ids map[string]int, name string) (*int, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if id, ok := ids[strings.ToLower(name)]; ok {
+		return &id, nil
+	}
+	if !r.Create || kind == "storage path" {
+		return nil, fmt.Errorf("%s %q not found in Paperless", kind, name)
+	}
+	var id int
+	switch kind {
+	case "correspondent":
+		created, err := r.client.CreateCorrespondent(name)
+		if err != nil {
+			return nil, err
+		}
+		id = created.ID
+	case "document type":
+		created, err := r.client.CreateDocumentType(name)
+		if err != nil {
+			return nil, err
+		}
+		id = created.ID
+	case "tag":
+		created, err := r.client.CreateTag(paperless.NewTag{Name: name})
+		if err != nil {
+			return nil, err
+		}
+		id = created.ID
+	}
+	ids[strings.ToLower(name)] = id
+	if r.Created != nil {
+		r.Created(kind, name)
+	}
+	return &id, nil
+}
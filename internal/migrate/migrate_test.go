@@ -0,0 +1,103 @@
+package migrate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLayout(t *testing.T) {
+	l, err := ParseLayout("/{correspondent}/*/{year}/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{FieldCorrespondent, "", FieldYear}, l.fields)
+
+	for layout, msg := range map[string]string{
+		"{correspondent}/year":     `invalid layout element "year": expected {field} or *`,
+		"{correspondent}/{title}":  `unknown layout field "title"`,
+		"{year}/{month}/{year}":    `layout field "year" is used twice`,
+		"":                         `invalid layout element ""`,
+		"{tag}/{tag}/{month}}":     `unknown layout field "month}"`,
+		"correspondent}/{tag}/{x}": `invalid layout element "correspondent}"`,
+	} {
+		_, err := ParseLayout(layout)
+		assert.ErrorContains(t, err, msg, layout)
+	}
+	_, err = ParseLayout("{tag}/{tag}")
+	assert.NoError(t, err)
+}
+
+func TestDerive(t *testing.T) {
+	l, err := ParseLayout("{correspondent}/{year}/{month}")
+	assert.NoError(t, err)
+	for rel, want := range map[string]rules.Metadata{
+		"ACME/2019/03 March/bill.pdf":    {Correspondent: "ACME", Created: "2019-03-01"},
+		"ACME/2019/bill.pdf":             {Correspondent: "ACME", Created: "2019-01-01"},
+		"ACME/2019/03/2019-03-17 a.pdf":  {Correspondent: "ACME", Created: "2019-03-17"},
+		"ACME/misc/20200102_scan.pdf":    {Correspondent: "ACME", Created: "2020-01-02"},
+		"ACME/2019/03/tax/2019/bill.pdf": {Correspondent: "ACME", Created: "2019-03-01", Tags: []string{"tax", "2019"}},
+		"ACME/old/bill.pdf":              {Correspondent: "ACME"},
+		"bill.pdf":                       {},
+	} {
+		assert.Equal(t, want, l.Derive(rel), rel)
+	}
+
+	l, err = ParseLayout("{document_type}/*/{tag}/{storage_path}")
+	assert.NoError(t, err)
+	assert.Equal(t, rules.Metadata{DocumentType: "Invoice", StoragePath: "Office", Tags: []string{"tax", "2021"}}, l.Derive("Invoice/ignored/tax/Office/2021/a.pdf"))
+}
+
+func TestResolver(t *testing.T) {
+	var mu sync.Mutex
+	var created []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/correspondents/":
+			w.Write([]byte(`{"results": [{"id": 1, "name": "ACME"}]}`))
+		case "GET /api/document_types/":
+			w.Write([]byte(`{"results": []}`))
+		case "GET /api/tags/":
+			w.Write([]byte(`{"results": [{"id": 7, "name": "Tax"}]}`))
+		case "GET /api/storage_paths/":
+			w.Write([]byte(`{"results": [{"id": 4, "name": "Office", "path": "{title}"}]}`))
+		case "POST /api/correspondents/", "POST /api/document_types/", "POST /api/tags/":
+			var body struct{ Name string }
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			created = append(created, r.URL.Path+body.Name)
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"id": %d, "name": %q}`, 100+len(created), body.Name)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	r := NewResolver(paperless.NewClient(server.URL, "test_key"))
+	var logged []string
+	r.Created = func(kind, name string) { logged = append(logged, kind+" "+name) }
+	opts, err := r.Resolve(rules.Metadata{Correspondent: "acme", DocumentType: "Invoice", StoragePath: "office", Tags: []string{"tax", "New", "new"}, Created: "2019-01-01"})
+	assert.NoError(t, err)
+	id := func(n int) *int { return &n }
+	assert.Equal(t, paperless.UploadOptions{Correspondent: id(1), DocumentType: id(101), StoragePath: id(4), Tags: []int{7, 102}, Created: "2019-01-01"}, opts)
+
+	// Created entities are remembered.
+	opts, err = r.Resolve(rules.Metadata{Correspondent: "Other", DocumentType: "invoice"})
+	assert.NoError(t, err)
+	assert.Equal(t, paperless.UploadOptions{Correspondent: id(103), DocumentType: id(101)}, opts)
+	assert.Equal(t, []string{"/api/document_types/Invoice", "/api/tags/New", "/api/correspondents/Other"}, created)
+	assert.Equal(t, []string{"document type Invoice", "tag New", "correspondent Other"}, logged)
+
+	_, err = r.Resolve(rules.Metadata{StoragePath: "Home"})
+	assert.EqualError(t, err, `storage path "Home" not found in Paperless`)
+	r.Create = false
+	_, err = r.Resolve(rules.Metadata{Tags: []string{"missing"}})
+	assert.EqualError(t, err, `tag "missing" not found in Paperless`)
+}
@@ -0,0 +1,137 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Controller is the part of the watcher controlled by commands.
+type Controller interface {
+	Pause()
+	Resume()
+	Rescan()
+}
+
+// Commands carries out the commands received on the command topics.
+type Commands struct {
+	Controller Controller
+	// Profiles are the names of the scan profiles offered to Home
+	// Assistant.
+	Profiles []string
+	// Scan runs the scan profile with the given name.
+	Scan func(ctx context.Context, profile string) error
+	// Upload copies the file at a local path or URL into a watch folder and
+	// returns where it was stored.
+	Upload func(ctx context.Context, ref string) (string, error)
+}
+
+// Result is the JSON payload published on the command result topic after
+// each command.
+type Result struct {
+	Command string `json:"command"`
+	Payload string `json:"payload"`
+	OK      bool   `json:"ok"`
+	Path    string `json:"path,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HandleCommands makes the publisher subscribe to the command topics and
+// carry out the commands with c. It must be called before Run.
+func (p *Publisher) HandleCommands(c Commands) {
+	p.commands = &c
+}
+
+func (p *Publisher) commandTopic() string {
+	if p.cfg.CommandTopic != "" {
+		return strings.TrimSuffix(p.cfg.CommandTopic, "/")
+	}
+	return p.cfg.TopicPrefix + "/command"
+}
+
+func (p *Publisher) resultTopic() string {
+	return p.cfg.TopicPrefix + "/command_result"
+}
+
+// subscribeCommands subscribes to the command topics. Commands run in their
+// own goroutine as they may take long, e.g. a scan, and must not hold up
+// the client.
+func (p *Publisher) subscribeCommands(ctx context.Context, c paho.Client) {
+	c.Subscribe(p.commandTopic()+"/+", 1, func(c paho.Client, m paho.Message) {
+		name := strings.TrimPrefix(m.Topic(), p.commandTopic()+"/")
+		payload := strings.TrimSpace(string(m.Payload()))
+		go func() {
+			result := p.runCommand(ctx, name, payload)
+			body, _ := json.Marshal(result)
+			c.Publish(p.resultTopic(), 1, false, body)
+		}()
+	})
+}
+
+// runCommand carries out a single command.
+func (p *Publisher) runCommand(ctx context.Context, name, payload string) Result {
+	result := Result{Command: name, Payload: payload}
+	var err error
+	switch name {
+	case "rescan":
+		p.commands.Controller.Rescan()
+	case "pause":
+		p.commands.Controller.Pause()
+	case "resume":
+		p.commands.Controller.Resume()
+	case "scan":
+		if payload == "" {
+			err = fmt.Errorf("missing scan profile")
+		} else {
+			err = p.commands.Scan(ctx, payload)
+		}
+	case "upload":
+		if payload == "" {
+			err = fmt.Errorf("missing path or URL")
+		} else {
+			result.Path, err = p.commands.Upload(ctx, payload)
+		}
+	default:
+		err = fmt.Errorf("unknown command %q", name)
+	}
+	if err != nil {
+		logging.Warnf("MQTT command %s %q failed: %v", name, payload, err)
+		result.Error = err.Error()
+		return result
+	}
+	logging.Infof("Ran MQTT command %s %s", name, payload)
+	result.OK = true
+	return result
+}
+
+// button describes a Home Assistant button publishing a command.
+type button struct {
+	key     string
+	name    string
+	icon    string
+	command string
+	payload string
+}
+
+// buttons returns the Home Assistant buttons of the commands.
+func (p *Publisher) buttons() []button {
+	buttons := []button{
+		{key: "rescan", name: "Rescan", icon: "mdi:folder-refresh", command: "rescan"},
+		{key: "pause", name: "Pause", icon: "mdi:pause", command: "pause"},
+		{key: "resume", name: "Resume", icon: "mdi:play", command: "resume"},
+	}
+	for _, profile := range p.commands.Profiles {
+		buttons = append(buttons, button{
+			key:     "scan_" + nodeID(profile),
+			name:    "Scan " + profile,
+			icon:    "mdi:scanner",
+			command: "scan",
+			payload: profile,
+		})
+	}
+	return buttons
+}
@@ -0,0 +1,287 @@
+// Package mqtt publishes the watcher status to an MQTT broker, including
+// Home Assistant discovery payloads so the uploader shows up as sensors,
+// and optionally takes commands from it.
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// publishTimeout bounds the wait for a publish to be acknowledged.
+const publishTimeout = 10 * time.Second
+
+// message is a single MQTT publish.
+type message struct {
+	Topic   string
+	Payload []byte
+}
+
+// State is the JSON payload published on the state topic.
+type State struct {
+	Status         string     `json:"status"`
+	QueueDepth     int        `json:"queue_depth"`
+	InFlight       int        `json:"in_flight"`
+	RetryBacklog   int        `json:"retry_backlog"`
+	Uploaded       int        `json:"uploaded"`
+	Failed         int        `json:"failed"`
+	LastUpload     *time.Time `json:"last_upload"`
+	LastUploadFile string     `json:"last_upload_file"`
+	LastError      string     `json:"last_error"`
+}
+
+// Publisher publishes the status of a watcher.
+type Publisher struct {
+	cfg     config.MQTT
+	version string
+	status  func() watcher.Status
+	client  paho.Client
+	trigger chan struct{}
+	// commands is set by HandleCommands.
+	commands *Commands
+}
+
+// New creates a publisher for the status returned by status.
+func New(cfg config.MQTT, version string, status func() watcher.Status) *Publisher {
+	return &Publisher{cfg: cfg, version: version, status: status, trigger: make(chan struct{}, 1)}
+}
+
+// Handle publishes the state after uploads, failures and outages. It is meant to be
+// registered with Watcher.OnEvent.
+func (p *Publisher) Handle(e watcher.Event) {
+	switch e.Type {
+	case watcher.EventWatching, watcher.EventUploaded, watcher.EventUploadFailed, watcher.EventCircuitOpened, watcher.EventCircuitClosed:
+		select {
+		case p.trigger <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run connects to the broker and publishes the state until ctx is done.
+// Connection errors are retried in the background.
+func (p *Publisher) Run(ctx context.Context) {
+	opts := paho.NewClientOptions().
+		AddBroker(p.cfg.Broker).
+		SetClientID(p.cfg.ClientID).
+		SetUsername(p.cfg.Username).
+		SetPassword(p.cfg.Password).
+		SetWill(p.availabilityTopic(), "offline", 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(c paho.Client) {
+			logging.Infof("Connected to MQTT broker %s", p.cfg.Broker)
+			p.publishAll(p.onlineMessages())
+			if p.cfg.Discovery {
+				c.Subscribe(p.cfg.DiscoveryPrefix+"/status", 0, func(c paho.Client, m paho.Message) {
+					// Home Assistant restarted and needs the discovery
+					// payloads again.
+					if string(m.Payload()) == "online" {
+						p.publishAll(p.onlineMessages())
+					}
+				})
+			}
+			if p.commands != nil {
+				p.subscribeCommands(ctx, c)
+			}
+		}).
+		SetConnectionLostHandler(func(c paho.Client, err error) {
+			logging.Warnf("Lost connection to MQTT broker %s: %v", p.cfg.Broker, err)
+		})
+	p.client = paho.NewClient(opts)
+	p.client.Connect()
+
+	interval := p.cfg.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if p.client.IsConnectionOpen() {
+				p.publishAll([]message{{p.availabilityTopic(), []byte("offline")}})
+			}
+			p.client.Disconnect(250)
+			return
+		case <-ticker.C:
+		case <-p.trigger:
+		}
+		if p.client.IsConnectionOpen() {
+			p.publishAll([]message{p.stateMessage()})
+		}
+	}
+}
+
+// publishAll publishes retained messages, logging errors.
+func (p *Publisher) publishAll(messages []message) {
+	for _, m := range messages {
+		token := p.client.Publish(m.Topic, 1, true, m.Payload)
+		if !token.WaitTimeout(publishTimeout) {
+			logging.Warnf("Timed out publishing to MQTT topic %s", m.Topic)
+			continue
+		}
+		if err := token.Error(); err != nil {
+			logging.Warnf("Failed to publish to MQTT topic %s: %v", m.Topic, err)
+		}
+	}
+}
+
+// onlineMessages returns the messages published after connecting.
+func (p *Publisher) onlineMessages() []message {
+	var messages []message
+	if p.cfg.Discovery {
+		messages = append(messages, p.discoveryMessages()...)
+	}
+	return append(messages,
+		message{p.availabilityTopic(), []byte("online")},
+		p.stateMessage())
+}
+
+func (p *Publisher) stateTopic() string {
+	return p.cfg.TopicPrefix + "/state"
+}
+
+func (p *Publisher) availabilityTopic() string {
+	return p.cfg.TopicPrefix + "/availability"
+}
+
+// stateMessage returns the current state.
+func (p *Publisher) stateMessage() message {
+	payload, _ := json.Marshal(stateOf(p.status()))
+	return message{p.stateTopic(), payload}
+}
+
+// stateOf summarizes a watcher status over all folders.
+func stateOf(status watcher.Status) State {
+	s := State{
+		Status:       "starting",
+		QueueDepth:   status.QueueDepth,
+		InFlight:     status.InFlight,
+		RetryBacklog: status.RetryBacklog,
+	}
+	if status.Watching {
+		s.Status = "watching"
+	}
+	if status.Watching && status.CircuitOpen {
+		s.Status = "server_down"
+	}
+	var lastFailure time.Time
+	for _, f := range status.Folders {
+		s.Uploaded += f.Uploaded
+		s.Failed += f.Failed
+		if !f.LastSuccess.IsZero() && (s.LastUpload == nil || f.LastSuccess.After(*s.LastUpload)) {
+			last := f.LastSuccess
+			s.LastUpload = &last
+			s.LastUploadFile = f.LastSuccessFile
+		}
+		if f.LastFailure.After(lastFailure) {
+			lastFailure = f.LastFailure
+			s.LastError = f.LastError
+		}
+	}
+	return s
+}
+
+// sensor describes a Home Assistant sensor read from the state topic.
+type sensor struct {
+	key         string
+	name        string
+	icon        string
+	deviceClass string
+	stateClass  string
+}
+
+var sensors = []sensor{
+	{key: "status", name: "Status", icon: "mdi:file-upload"},
+	{key: "queue_depth", name: "Queue depth", icon: "mdi:tray-full", stateClass: "measurement"},
+	{key: "in_flight", name: "Uploads in progress", icon: "mdi:upload", stateClass: "measurement"},
+	{key: "retry_backlog", name: "Retry backlog", icon: "mdi:restart", stateClass: "measurement"},
+	{key: "uploaded", name: "Documents uploaded", icon: "mdi:file-check", stateClass: "total_increasing"},
+	{key: "failed", name: "Failed uploads", icon: "mdi:file-alert", stateClass: "total_increasing"},
+	{key: "last_upload", name: "Last upload", deviceClass: "timestamp"},
+	{key: "last_upload_file", name: "Last uploaded file", icon: "mdi:file-document"},
+	{key: "last_error", name: "Last error", icon: "mdi:alert-circle"},
+}
+
+// discoveryMessages returns the Home Assistant discovery payloads of the
+// sensors and, with commands, the buttons.
+func (p *Publisher) discoveryMessages() []message {
+	node := nodeID(p.cfg.ClientID)
+	device := map[string]interface{}{
+		"identifiers":  []string{node},
+		"name":         "Paperless Uploader (" + p.cfg.ClientID + ")",
+		"model":        "paperless-uploader",
+		"sw_version":   p.version,
+		"manufacturer": "go-paperless-uploader",
+	}
+	var messages []message
+	for _, s := range sensors {
+		payload := map[string]interface{}{
+			"name":               s.name,
+			"unique_id":          node + "_" + s.key,
+			"object_id":          node + "_" + s.key,
+			"state_topic":        p.stateTopic(),
+			"value_template":     fmt.Sprintf("{{ value_json.%s }}", s.key),
+			"availability_topic": p.availabilityTopic(),
+			"device":             device,
+		}
+		if s.icon != "" {
+			payload["icon"] = s.icon
+		}
+		if s.deviceClass != "" {
+			payload["device_class"] = s.deviceClass
+		}
+		if s.stateClass != "" {
+			payload["state_class"] = s.stateClass
+		}
+		body, _ := json.Marshal(payload)
+		messages = append(messages, message{
+			Topic:   fmt.Sprintf("%s/sensor/%s/%s/config", p.cfg.DiscoveryPrefix, node, s.key),
+			Payload: body,
+		})
+	}
+	if p.commands == nil {
+		return messages
+	}
+	for _, b := range p.buttons() {
+		payload := map[string]interface{}{
+			"name":               b.name,
+			"unique_id":          node + "_" + b.key,
+			"object_id":          node + "_" + b.key,
+			"command_topic":      p.commandTopic() + "/" + b.command,
+			"icon":               b.icon,
+			"availability_topic": p.availabilityTopic(),
+			"device":             device,
+		}
+		if b.payload != "" {
+			payload["payload_press"] = b.payload
+		}
+		body, _ := json.Marshal(payload)
+		messages = append(messages, message{
+			Topic:   fmt.Sprintf("%s/button/%s/%s/config", p.cfg.DiscoveryPrefix, node, b.key),
+			Payload: body,
+		})
+	}
+	return messages
+}
+
+// nodeID turns a client ID into a Home Assistant node ID, which may only
+// contain letters, digits, underscores and dashes.
+func nodeID(clientID string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, clientID)
+}
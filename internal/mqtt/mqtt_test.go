@@ -0,0 +1,127 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateOf(t *testing.T) {
+	earlier := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	s := stateOf(watcher.Status{
+		Watching:     true,
+		QueueDepth:   3,
+		RetryBacklog: 1,
+		Folders: []watcher.FolderStatus{
+			{Path: "a", Uploaded: 2, LastSuccess: later, LastSuccessFile: "b.pdf", Failed: 1, LastFailure: earlier, LastError: "timeout"},
+			{Path: "b", Uploaded: 1, LastSuccess: earlier, LastSuccessFile: "a.pdf"},
+		},
+	})
+	assert.Equal(t, State{
+		Status:         "watching",
+		QueueDepth:     3,
+		RetryBacklog:   1,
+		Uploaded:       3,
+		Failed:         1,
+		LastUpload:     &later,
+		LastUploadFile: "b.pdf",
+		LastError:      "timeout",
+	}, s)
+
+	s = stateOf(watcher.Status{})
+	assert.Equal(t, "starting", s.Status)
+	assert.Nil(t, s.LastUpload)
+}
+
+func TestDiscoveryMessages(t *testing.T) {
+	p := New(config.MQTT{
+		ClientID:        "scanner.office",
+		TopicPrefix:     "paperless-uploader",
+		Discovery:       true,
+		DiscoveryPrefix: "homeassistant",
+	}, "1.2.3", func() watcher.Status { return watcher.Status{} })
+
+	messages := p.onlineMessages()
+	assert.Len(t, messages, len(sensors)+2)
+	assert.Equal(t, "paperless-uploader/availability", messages[len(sensors)].Topic)
+	assert.Equal(t, "online", string(messages[len(sensors)].Payload))
+	assert.Equal(t, "paperless-uploader/state", messages[len(sensors)+1].Topic)
+
+	first := messages[0]
+	assert.Equal(t, "homeassistant/sensor/scanner_office/status/config", first.Topic)
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal(first.Payload, &payload))
+	assert.Equal(t, "scanner_office_status", payload["unique_id"])
+	assert.Equal(t, "paperless-uploader/state", payload["state_topic"])
+	assert.Equal(t, "{{ value_json.status }}", payload["value_template"])
+	assert.Equal(t, "paperless-uploader/availability", payload["availability_topic"])
+	assert.Equal(t, "1.2.3", payload["device"].(map[string]interface{})["sw_version"])
+
+	p.cfg.Discovery = false
+	assert.Len(t, p.onlineMessages(), 2)
+}
+
+type fakeController struct {
+	calls []string
+}
+
+func (f *fakeController) Pause()  { f.calls = append(f.calls, "pause") }
+func (f *fakeController) Resume() { f.calls = append(f.calls, "resume") }
+func (f *fakeController) Rescan() { f.calls = append(f.calls, "rescan") }
+
+func TestCommands(t *testing.T) {
+	p := New(config.MQTT{
+		ClientID:        "paperless-uploader",
+		TopicPrefix:     "paperless-uploader",
+		Discovery:       true,
+		DiscoveryPrefix: "homeassistant",
+	}, "1.2.3", func() watcher.Status { return watcher.Status{} })
+	ctl := &fakeController{}
+	var scanned []string
+	p.HandleCommands(Commands{
+		Controller: ctl,
+		Profiles:   []string{"duplex"},
+		Scan: func(ctx context.Context, profile string) error {
+			if profile != "duplex" {
+				return errors.New("unknown scan profile")
+			}
+			scanned = append(scanned, profile)
+			return nil
+		},
+		Upload: func(ctx context.Context, ref string) (string, error) {
+			return "consume/" + ref, nil
+		},
+	})
+	assert.Equal(t, "paperless-uploader/command", p.commandTopic())
+
+	ctx := context.Background()
+	for _, name := range []string{"pause", "resume", "rescan"} {
+		assert.Equal(t, Result{Command: name, OK: true}, p.runCommand(ctx, name, ""))
+	}
+	assert.Equal(t, []string{"pause", "resume", "rescan"}, ctl.calls)
+	assert.Equal(t, Result{Command: "scan", Payload: "duplex", OK: true}, p.runCommand(ctx, "scan", "duplex"))
+	assert.Equal(t, []string{"duplex"}, scanned)
+	assert.Equal(t, Result{Command: "scan", Payload: "simplex", Error: "unknown scan profile"}, p.runCommand(ctx, "scan", "simplex"))
+	assert.Equal(t, Result{Command: "scan", Error: "missing scan profile"}, p.runCommand(ctx, "scan", ""))
+	assert.Equal(t, Result{Command: "upload", Payload: "a.pdf", OK: true, Path: "consume/a.pdf"}, p.runCommand(ctx, "upload", "a.pdf"))
+	assert.False(t, p.runCommand(ctx, "reboot", "").OK)
+
+	messages := p.onlineMessages()
+	assert.Len(t, messages, len(sensors)+4+2)
+	scan := messages[len(sensors)+3]
+	assert.Equal(t, "homeassistant/button/paperless-uploader/scan_duplex/config", scan.Topic)
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal(scan.Payload, &payload))
+	assert.Equal(t, "paperless-uploader/command/scan", payload["command_topic"])
+	assert.Equal(t, "duplex", payload["payload_press"])
+
+	p.cfg.CommandTopic = "home/scanner/"
+	assert.Equal(t, "home/scanner", p.commandTopic())
+}
@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+)
+
+// flusher is implemented by notifiers holding back messages.
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Batcher collects the messages sent within an interval and passes them to
+// the wrapped notifier as a single message, so busy folders don't flood a
+// channel.
+type Batcher struct {
+	next     Notifier
+	interval time.Duration
+	name     string
+
+	mu      sync.Mutex
+	pending []Message
+	timer   *time.Timer
+}
+
+// NewBatcher wraps next so messages are sent at most once per interval.
+func NewBatcher(name string, next Notifier, interval time.Duration) *Batcher {
+	return &Batcher{next: next, interval: interval, name: name}
+}
+
+// Send queues m. It is sent together with the other messages of the
+// interval.
+func (b *Batcher) Send(ctx context.Context, m Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, m)
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, func() {
+			if err := b.Flush(context.Background()); err != nil {
+				logging.Errorf("Failed to send notifications via %s: %v", b.name, err)
+			}
+		})
+	}
+	return nil
+}
+
+// Flush sends the queued messages now.
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	return b.next.Send(ctx, combine(pending))
+}
+
+// combine merges messages into one. Failures are listed first.
+func combine(messages []Message) Message {
+	if len(messages) == 1 {
+		return messages[0]
+	}
+	var failures, others []string
+	for _, m := range messages {
+		line := "• " + strings.ReplaceAll(m.Body, "\n", "\n  ")
+		if m.URL != "" {
+			line += " (" + m.URL + ")"
+		}
+		if m.Kind == KindFailure {
+			failures = append(failures, line)
+		} else {
+			others = append(others, line)
+		}
+	}
+	combined := Message{Kind: KindUpload, Title: fmt.Sprintf("%d notifications", len(messages))}
+	if len(failures) > 0 {
+		combined.Kind = KindFailure
+		combined.Title = fmt.Sprintf("%d notifications, %d failed", len(messages), len(failures))
+	}
+	combined.Body = strings.Join(append(failures, others...), "\n")
+	return combined
+}
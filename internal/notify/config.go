@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+)
+
+// FromConfig creates the targets of the configured backends.
+func FromConfig(cfg config.Notifications) ([]*Target, error) {
+	var targets []*Target
+	add := func(name string, n Notifier, opts config.NotifierOptions) error {
+		if opts.BatchInterval > 0 {
+			n = NewBatcher(name, n, opts.BatchInterval)
+		}
+		t, err := NewTarget(name, n, opts)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, t)
+		return nil
+	}
+
+	if c := cfg.Ntfy; c != nil {
+		if c.Topic == "" {
+			return nil, fmt.Errorf("ntfy: topic is required")
+		}
+		n := &Ntfy{URL: c.URL, Topic: c.Topic, Token: c.Token}
+		if n.URL == "" {
+			n.URL = "https://ntfy.sh"
+		}
+		var err error
+		if n.Priority, err = ParseNtfyPriority(c.Priority, 0); err != nil {
+			return nil, err
+		}
+		if n.FailurePriority, err = ParseNtfyPriority(c.FailurePriority, 4); err != nil {
+			return nil, err
+		}
+		if err := add("ntfy", n, c.NotifierOptions); err != nil {
+			return nil, err
+		}
+	}
+	if c := cfg.Gotify; c != nil {
+		if c.URL == "" || c.Token == "" {
+			return nil, fmt.Errorf("gotify: url and token are required")
+		}
+		g := &Gotify{URL: c.URL, Token: c.Token}
+		var err error
+		if g.Priority, err = intPriority("gotify", c.Priority, 5, 0, 10); err != nil {
+			return nil, err
+		}
+		if g.FailurePriority, err = intPriority("gotify", c.FailurePriority, 8, 0, 10); err != nil {
+			return nil, err
+		}
+		if err := add("gotify", g, c.NotifierOptions); err != nil {
+			return nil, err
+		}
+	}
+	if c := cfg.Telegram; c != nil {
+		if c.Token == "" || c.ChatID == "" {
+			return nil, fmt.Errorf("telegram: token and chat_id are required")
+		}
+		t := &Telegram{Token: c.Token, ChatID: c.ChatID}
+		if err := add("telegram", t, c.NotifierOptions); err != nil {
+			return nil, err
+		}
+	}
+	if c := cfg.Pushover; c != nil {
+		if c.Token == "" || c.User == "" {
+			return nil, fmt.Errorf("pushover: token and user are required")
+		}
+		p := &Pushover{Token: c.Token, User: c.User, Device: c.Device}
+		var err error
+		if p.Priority, err = intPriority("pushover", c.Priority, 0, -2, 1); err != nil {
+			return nil, err
+		}
+		if p.FailurePriority, err = intPriority("pushover", c.FailurePriority, 1, -2, 1); err != nil {
+			return nil, err
+		}
+		if err := add("pushover", p, c.NotifierOptions); err != nil {
+			return nil, err
+		}
+	}
+	for i, c := range cfg.Webhooks {
+		name := c.Name
+		if name == "" {
+			name = c.Format
+		}
+		name = fmt.Sprintf("webhook %s", name)
+		if c.URL == "" {
+			return nil, fmt.Errorf("webhooks[%d]: url is required", i)
+		}
+		if !ValidWebhookFormat(c.Format) {
+			return nil, fmt.Errorf("webhooks[%d]: invalid format %q: must be slack, discord or mattermost", i, c.Format)
+		}
+		if err := add(name, &Webhook{URL: c.URL, Format: c.Format}, c.NotifierOptions); err != nil {
+			return nil, err
+		}
+	}
+	if c := cfg.Email; c != nil {
+		if c.Host == "" || c.From == "" || len(c.To) == 0 {
+			return nil, fmt.Errorf("email: host, from and to are required")
+		}
+		e := &Email{Username: c.Username, Password: c.Password, From: c.From, To: c.To, TLS: c.TLS}
+		if e.TLS == "" {
+			e.TLS = "starttls"
+		}
+		if e.TLS != "starttls" && e.TLS != "tls" && e.TLS != "none" {
+			return nil, fmt.Errorf("email: invalid tls mode %q: must be starttls, tls or none", c.TLS)
+		}
+		port := c.Port
+		if port == 0 {
+			port = 587
+			if e.TLS == "tls" {
+				port = 465
+			}
+		}
+		e.Addr = net.JoinHostPort(c.Host, strconv.Itoa(port))
+		if err := add("email", e, c.NotifierOptions); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// intPriority returns the configured priority, or def if it is not set.
+func intPriority(backend string, value *int, def, min, max int) (int, error) {
+	if value == nil {
+		return def, nil
+	}
+	if *value < min || *value > max {
+		return 0, fmt.Errorf("%s: invalid priority %d: must be %d to %d", backend, *value, min, max)
+	}
+	return *value, nil
+}
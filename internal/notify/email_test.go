@@ -0,0 +1,119 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// smtpSession is what the fake SMTP server received.
+type smtpSession struct {
+	auth bool
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP serves a single SMTP session on the loopback interface.
+func fakeSMTP(t *testing.T) (string, <-chan smtpSession) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	done := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { io.WriteString(conn, s+"\r\n") }
+		var session smtpSession
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); {
+			case cmd == "EHLO":
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case cmd == "AUTH":
+				session.auth = true
+				reply("235 OK")
+			case strings.HasPrefix(line, "MAIL FROM:"):
+				session.from = strings.Trim(strings.TrimPrefix(line, "MAIL FROM:"), "<>")
+				reply("250 OK")
+			case strings.HasPrefix(line, "RCPT TO:"):
+				session.to = append(session.to, strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>"))
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				session.data = data.String()
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 bye")
+				done <- session
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return ln.Addr().String(), done
+}
+
+func TestEmail(t *testing.T) {
+	addr, done := fakeSMTP(t)
+	e := &Email{
+		Addr:     addr,
+		Username: "user",
+		Password: "secret",
+		From:     "Uploader <uploader@example.com>",
+		To:       []string{"office@example.com", "admin@example.com"},
+		TLS:      "none",
+	}
+	assert.NoError(t, e.Send(context.Background(), Message{
+		Kind:  KindFailure,
+		Title: "Upload failed",
+		Body:  "scan.pdf: timeout",
+		URL:   "http://paperless/documents/7/details",
+	}))
+
+	session := <-done
+	assert.True(t, session.auth)
+	assert.Equal(t, "uploader@example.com", session.from)
+	assert.Equal(t, []string{"office@example.com", "admin@example.com"}, session.to)
+
+	msg, err := mail.ReadMessage(strings.NewReader(session.data))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "[paperless-uploader] Upload failed", msg.Header.Get("Subject"))
+		assert.Equal(t, "office@example.com, admin@example.com", msg.Header.Get("To"))
+		assert.Contains(t, msg.Header.Get("Message-ID"), "@example.com>")
+		body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+		assert.NoError(t, err)
+		assert.Equal(t, "scan.pdf: timeout\r\n\r\nhttp://paperless/documents/7/details\r\n", string(body))
+	}
+}
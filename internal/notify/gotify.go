@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Gotify sends messages to a Gotify server.
+type Gotify struct {
+	URL   string
+	Token string
+	// Priority and FailurePriority are Gotify priorities from 0 to 10.
+	Priority        int
+	FailurePriority int
+	HTTPClient      *http.Client
+}
+
+type gotifyMessage struct {
+	Title    string                 `json:"title"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+// Send implements Notifier.
+func (g *Gotify) Send(ctx context.Context, m Message) error {
+	msg := gotifyMessage{Title: m.Title, Message: m.Body, Priority: g.Priority}
+	if m.Kind == KindFailure {
+		msg.Priority = g.FailurePriority
+	}
+	if m.URL != "" {
+		msg.Extras = map[string]interface{}{
+			"client::notification": map[string]interface{}{"click": map[string]string{"url": m.URL}},
+		}
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", strings.TrimRight(g.URL, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.Token)
+	return send(ctx, g.HTTPClient, req)
+}
@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGotify(t *testing.T) {
+	var (
+		token string
+		msg   map[string]interface{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/gotify/message", r.URL.Path)
+		token = r.Header.Get("X-Gotify-Key")
+		msg = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+	}))
+	defer server.Close()
+
+	g := &Gotify{URL: server.URL + "/gotify", Token: "app-token", Priority: 5, FailurePriority: 8}
+	assert.NoError(t, g.Send(context.Background(), Message{Kind: KindFailure, Title: "Upload failed", Body: "scan.pdf: timeout"}))
+	assert.Equal(t, "app-token", token)
+	assert.Equal(t, map[string]interface{}{"title": "Upload failed", "message": "scan.pdf: timeout", "priority": 8.0}, msg)
+
+	assert.NoError(t, g.Send(context.Background(), Message{Kind: KindUpload, Title: "Document uploaded", URL: "http://paperless/documents/1/details"}))
+	assert.Equal(t, 5.0, msg["priority"])
+	assert.Equal(t, map[string]interface{}{
+		"client::notification": map[string]interface{}{"click": map[string]interface{}{"url": "http://paperless/documents/1/details"}},
+	}, msg["extras"])
+}
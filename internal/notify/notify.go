@@ -0,0 +1,364 @@
+// Package notify sends notifications about uploads to services such as ntfy,
+// Gotify, Telegram, Pushover, chat webhooks and email.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/stats"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// Kind identifies a kind of notification.
+type Kind string
+
+// Notification kinds.
+const (
+	// KindUpload is sent for every successful upload.
+	KindUpload Kind = "upload"
+	// KindFailure is sent when an upload failed for good.
+	KindFailure Kind = "failure"
+	// KindSummary is sent periodically with the upload statistics.
+	KindSummary Kind = "summary"
+	// KindOutage is sent when uploads are held because Paperless is down,
+	// and again once it recovered.
+	KindOutage Kind = "outage"
+)
+
+var kinds = []Kind{KindUpload, KindFailure, KindSummary, KindOutage}
+
+var titles = map[Kind]string{
+	KindUpload:  "Document uploaded",
+	KindFailure: "Upload failed",
+	KindSummary: "Upload summary",
+	KindOutage:  "Paperless outage",
+}
+
+var defaultTemplates = map[Kind]string{
+	KindUpload:  `Uploaded {{.Name}} from {{.Folder}}`,
+	KindFailure: `Failed to upload {{.Name}} from {{.Folder}} after {{.Attempts}} attempts: {{.Error}}`,
+	KindSummary: `{{.Summary.Uploaded}} uploaded, {{.Summary.Failed}} failed since {{.Summary.Since.Format "2006-01-02 15:04"}}.
+Queue: {{.Summary.QueueDepth}} waiting, {{.Summary.RetryBacklog}} to retry.
+{{- if gt (len .Summary.Folders) 1}}{{range .Summary.Folders}}
+{{.Folder}}: {{.Uploaded}} uploaded, {{.Failed}} failed, {{.AverageLatency}} average upload time
+{{- end}}{{end}}
+{{- range .Summary.Failures}}
+- {{.Name}}: {{.Error}}
+{{- end}}`,
+	KindOutage: `{{if .Recovered}}Paperless is available again after {{.Duration}}, resuming uploads
+{{- else}}Paperless is unavailable, holding uploads until it recovers: {{.Error}}{{end}}`,
+}
+
+// maxSummaryFailures is the number of failures listed in a summary.
+const maxSummaryFailures = 20
+
+// Message is a rendered notification.
+type Message struct {
+	Kind  Kind
+	Title string
+	Body  string
+	// URL links to the document, if known.
+	URL string
+}
+
+// Notifier delivers messages to a notification service.
+type Notifier interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Data is passed to the message templates.
+type Data struct {
+	Kind   Kind
+	Time   time.Time
+	File   string
+	Name   string
+	Folder string
+	Error  string
+	// Attempts is the number of upload attempts made.
+	Attempts int
+	TaskID   string
+	// URL links to the uploaded document once Paperless consumed it.
+	URL     string
+	Summary *Summary
+	// Recovered is set for KindOutage once Paperless is available again,
+	// after an outage of Duration.
+	Recovered bool
+	Duration  time.Duration
+}
+
+// Summary holds the statistics sent with KindSummary.
+type Summary struct {
+	Since, Until time.Time
+	Uploaded     int
+	Failed       int
+	Failures     []Data
+	QueueDepth   int
+	RetryBacklog int
+	// Bytes is the size of the uploaded documents.
+	Bytes int64
+	// Folders holds the statistics per folder.
+	Folders []stats.Folder
+}
+
+// Target is a notifier together with the notifications it receives.
+type Target struct {
+	Name      string
+	Notifier  Notifier
+	events    map[Kind]bool
+	templates map[Kind]*template.Template
+}
+
+// NewTarget creates a target from the shared backend options.
+func NewTarget(name string, n Notifier, opts config.NotifierOptions) (*Target, error) {
+	t := &Target{Name: name, Notifier: n, events: make(map[Kind]bool), templates: make(map[Kind]*template.Template)}
+	events := opts.Events
+	if len(events) == 0 {
+		events = []string{string(KindFailure), string(KindOutage)}
+	}
+	for _, event := range events {
+		if !isKind(event) {
+			return nil, fmt.Errorf("%s: invalid notification event %q: must be upload, failure, summary or outage", name, event)
+		}
+		t.events[Kind(event)] = true
+	}
+	for name := range opts.Templates {
+		if !isKind(name) {
+			return nil, fmt.Errorf("%s: template for unknown notification %q", t.Name, name)
+		}
+	}
+	for _, kind := range kinds {
+		text, ok := opts.Templates[string(kind)]
+		if !ok {
+			text = defaultTemplates[kind]
+		}
+		tmpl, err := template.New(string(kind)).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid %s template: %w", t.Name, kind, err)
+		}
+		t.templates[kind] = tmpl
+	}
+	return t, nil
+}
+
+func isKind(s string) bool {
+	for _, kind := range kinds {
+		if s == string(kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wants reports whether the target receives notifications of kind.
+func (t *Target) Wants(kind Kind) bool {
+	return t.events[kind]
+}
+
+// Render renders the message for data.
+func (t *Target) Render(data Data) (Message, error) {
+	var body bytes.Buffer
+	if err := t.templates[data.Kind].Execute(&body, data); err != nil {
+		return Message{}, fmt.Errorf("%s: failed to render %s template: %w", t.Name, data.Kind, err)
+	}
+	return Message{Kind: data.Kind, Title: titles[data.Kind], Body: strings.TrimSpace(body.String()), URL: data.URL}, nil
+}
+
+// queueSize is the number of notifications that can wait to be sent.
+const queueSize = 100
+
+type delivery struct {
+	target *Target
+	data   Data
+}
+
+// Dispatcher turns watcher events into notifications and delivers them in
+// the background.
+type Dispatcher struct {
+	targets []*Target
+	status  func() watcher.Status
+	queue   chan delivery
+	resolve func(taskID string) (string, error)
+
+	stats *stats.Collector
+
+	mu      sync.Mutex
+	summary Summary
+}
+
+// NewDispatcher creates a dispatcher sending to targets. status provides
+// the queue statistics for summaries.
+func NewDispatcher(targets []*Target, status func() watcher.Status) *Dispatcher {
+	return &Dispatcher{
+		targets: targets,
+		status:  status,
+		queue:   make(chan delivery, queueSize),
+		stats:   stats.NewCollector(),
+		summary: Summary{Since: time.Now()},
+	}
+}
+
+// ResolveDocuments makes upload notifications link to the created document.
+// resolve waits for the consumption task and returns the document URL. It
+// must be called before the first event is handled.
+func (d *Dispatcher) ResolveDocuments(resolve func(taskID string) (string, error)) {
+	d.resolve = resolve
+}
+
+// Handle records e and queues the notifications it causes. It is meant to
+// be registered with watcher.OnEvent and never blocks.
+func (d *Dispatcher) Handle(e watcher.Event) {
+	d.stats.Handle(e)
+	var kind Kind
+	switch e.Type {
+	case watcher.EventUploaded:
+		kind = KindUpload
+	case watcher.EventUploadFailed:
+		kind = KindFailure
+	case watcher.EventCircuitOpened, watcher.EventCircuitClosed:
+		data := Data{Kind: KindOutage, Time: e.Time, Recovered: e.Type == watcher.EventCircuitClosed, Duration: e.Duration.Round(time.Second)}
+		if e.Err != nil {
+			data.Error = e.Err.Error()
+		}
+		d.dispatch(data)
+		return
+	default:
+		return
+	}
+	data := Data{
+		Kind:     kind,
+		Time:     e.Time,
+		File:     e.Path,
+		Name:     filepath.Base(e.Path),
+		Folder:   e.Folder,
+		Attempts: e.Attempt + 1,
+		TaskID:   e.TaskID,
+	}
+	if e.Err != nil {
+		data.Error = e.Err.Error()
+	}
+
+	d.mu.Lock()
+	if kind == KindUpload {
+		d.summary.Uploaded++
+	} else {
+		d.summary.Failed++
+		if len(d.summary.Failures) < maxSummaryFailures {
+			d.summary.Failures = append(d.summary.Failures, data)
+		}
+	}
+	d.mu.Unlock()
+
+	if kind == KindUpload && d.resolve != nil && data.TaskID != "" && d.wants(KindUpload) {
+		go func() {
+			url, err := d.resolve(data.TaskID)
+			if err != nil {
+				logging.Warnf("Failed to find the document created from %s: %v", data.File, err)
+			}
+			data.URL = url
+			d.dispatch(data)
+		}()
+		return
+	}
+	d.dispatch(data)
+}
+
+// dispatch queues data for every target that wants it.
+func (d *Dispatcher) dispatch(data Data) {
+	for _, t := range d.targets {
+		if !t.Wants(data.Kind) {
+			continue
+		}
+		select {
+		case d.queue <- delivery{t, data}:
+		default:
+			logging.Warnf("Notification queue full, dropping %s notification for %s", data.Kind, t.Name)
+		}
+	}
+}
+
+// Run delivers queued notifications and sends a summary every
+// summaryInterval until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context, summaryInterval time.Duration) {
+	var tick <-chan time.Time
+	if summaryInterval > 0 && d.wants(KindSummary) {
+		ticker := time.NewTicker(summaryInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	defer d.flush()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case del := <-d.queue:
+			d.deliver(ctx, del)
+		case <-tick:
+			d.queueSummary()
+		}
+	}
+}
+
+// flush sends the messages held back by batching notifiers.
+func (d *Dispatcher) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, t := range d.targets {
+		if f, ok := t.Notifier.(flusher); ok {
+			if err := f.Flush(ctx); err != nil {
+				logging.Errorf("Failed to send notifications via %s: %v", t.Name, err)
+			}
+		}
+	}
+}
+
+// wants reports whether any target receives notifications of kind.
+func (d *Dispatcher) wants(kind Kind) bool {
+	for _, t := range d.targets {
+		if t.Wants(kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// queueSummary queues a summary of the uploads since the last one. Nothing
+// is sent if there were no uploads.
+func (d *Dispatcher) queueSummary() {
+	now := time.Now()
+	d.mu.Lock()
+	summary := d.summary
+	d.summary = Summary{Since: now}
+	d.mu.Unlock()
+	report := d.stats.Take()
+	if summary.Uploaded == 0 && summary.Failed == 0 {
+		return
+	}
+	summary.Folders, summary.Bytes = report.Folders, report.Total().Bytes
+
+	summary.Until = now
+	if d.status != nil {
+		status := d.status()
+		summary.QueueDepth, summary.RetryBacklog = status.QueueDepth, status.RetryBacklog
+	}
+	d.dispatch(Data{Kind: KindSummary, Time: now, Summary: &summary})
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, del delivery) {
+	msg, err := del.target.Render(del.data)
+	if err != nil {
+		logging.Errorf("%v", err)
+		return
+	}
+	if err := del.target.Notifier.Send(ctx, msg); err != nil {
+		logging.Errorf("Failed to send %s notification via %s: %v", del.data.Kind, del.target.Name, err)
+	}
+}
@@ -0,0 +1,220 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/stats"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder is a Notifier remembering the messages it was sent.
+type recorder struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (r *recorder) Send(ctx context.Context, m Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, m)
+	return nil
+}
+
+func (r *recorder) sent() []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Message{}, r.messages...)
+}
+
+func TestNewTarget(t *testing.T) {
+	target, err := NewTarget("test", &recorder{}, config.NotifierOptions{})
+	assert.NoError(t, err)
+	assert.True(t, target.Wants(KindFailure))
+	assert.True(t, target.Wants(KindOutage))
+	assert.False(t, target.Wants(KindUpload))
+	assert.False(t, target.Wants(KindSummary))
+
+	_, err = NewTarget("test", &recorder{}, config.NotifierOptions{Events: []string{"always"}})
+	assert.Error(t, err)
+	_, err = NewTarget("test", &recorder{}, config.NotifierOptions{Templates: map[string]string{"failure": "{{.Name"}})
+	assert.Error(t, err)
+	_, err = NewTarget("test", &recorder{}, config.NotifierOptions{Templates: map[string]string{"retry": "x"}})
+	assert.Error(t, err)
+}
+
+func TestRender(t *testing.T) {
+	target, err := NewTarget("test", &recorder{}, config.NotifierOptions{Templates: map[string]string{"upload": "{{.Name}} is in Paperless"}})
+	assert.NoError(t, err)
+
+	msg, err := target.Render(Data{Kind: KindUpload, Name: "scan.pdf"})
+	assert.NoError(t, err)
+	assert.Equal(t, Message{Kind: KindUpload, Title: "Document uploaded", Body: "scan.pdf is in Paperless"}, msg)
+
+	msg, err = target.Render(Data{Kind: KindFailure, Name: "scan.pdf", Folder: "consume", Attempts: 4, Error: "timeout"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Failed to upload scan.pdf from consume after 4 attempts: timeout", msg.Body)
+
+	msg, err = target.Render(Data{Kind: KindOutage, Error: "503 Service Unavailable"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Paperless outage", msg.Title)
+	assert.Equal(t, "Paperless is unavailable, holding uploads until it recovers: 503 Service Unavailable", msg.Body)
+	msg, err = target.Render(Data{Kind: KindOutage, Recovered: true, Duration: 5 * time.Minute})
+	assert.NoError(t, err)
+	assert.Equal(t, "Paperless is available again after 5m0s, resuming uploads", msg.Body)
+
+	since := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	msg, err = target.Render(Data{Kind: KindSummary, Summary: &Summary{Since: since, Uploaded: 3, Failed: 1, QueueDepth: 2, Failures: []Data{{Name: "bad.pdf", Error: "not a PDF"}}}})
+	assert.NoError(t, err)
+	assert.Equal(t, "3 uploaded, 1 failed since 2024-03-01 08:00.\nQueue: 2 waiting, 0 to retry.\n- bad.pdf: not a PDF", msg.Body)
+
+	folders := []stats.Folder{{Folder: "a", Uploaded: 2, Latency: 3 * time.Second}, {Folder: "b", Uploaded: 1, Failed: 1, Latency: time.Second}}
+	msg, err = target.Render(Data{Kind: KindSummary, Summary: &Summary{Since: since, Uploaded: 3, Failed: 1, Folders: folders}})
+	assert.NoError(t, err)
+	assert.Equal(t, "3 uploaded, 1 failed since 2024-03-01 08:00.\nQueue: 0 waiting, 0 to retry.\na: 2 uploaded, 0 failed, 1.5s average upload time\nb: 1 uploaded, 1 failed, 1s average upload time", msg.Body)
+}
+
+func TestDispatcher(t *testing.T) {
+	failures, all := &recorder{}, &recorder{}
+	failureTarget, err := NewTarget("failures", failures, config.NotifierOptions{})
+	assert.NoError(t, err)
+	allTarget, err := NewTarget("all", all, config.NotifierOptions{Events: []string{"upload", "failure", "summary"}})
+	assert.NoError(t, err)
+
+	d := NewDispatcher([]*Target{failureTarget, allTarget}, func() watcher.Status { return watcher.Status{QueueDepth: 5} })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx, 20*time.Millisecond)
+
+	d.Handle(watcher.Event{Type: watcher.EventDetected, Path: "consume/a.pdf"})
+	d.Handle(watcher.Event{Type: watcher.EventUploaded, Path: "consume/a.pdf", Folder: "consume"})
+	d.Handle(watcher.Event{Type: watcher.EventUploadFailed, Path: "consume/b.pdf", Folder: "consume", Attempt: 3, Err: errors.New("timeout")})
+
+	assert.Eventually(t, func() bool { return len(all.sent()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	sent := all.sent()
+	assert.Equal(t, KindUpload, sent[0].Kind)
+	assert.Equal(t, KindFailure, sent[1].Kind)
+	assert.Equal(t, KindSummary, sent[2].Kind)
+	assert.Contains(t, sent[2].Body, "1 uploaded, 1 failed")
+	assert.Contains(t, sent[2].Body, "Queue: 5 waiting")
+	assert.Contains(t, sent[2].Body, "- b.pdf: timeout")
+
+	if assert.Len(t, failures.sent(), 1) {
+		assert.Equal(t, "Failed to upload b.pdf from consume after 4 attempts: timeout", failures.sent()[0].Body)
+	}
+
+	// Empty summaries are not sent.
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, all.sent(), 3)
+}
+
+func TestDispatcherDocumentLinks(t *testing.T) {
+	r := &recorder{}
+	target, err := NewTarget("all", r, config.NotifierOptions{Events: []string{"upload", "failure"}})
+	assert.NoError(t, err)
+
+	d := NewDispatcher([]*Target{target}, nil)
+	d.ResolveDocuments(func(taskID string) (string, error) {
+		if taskID == "bad" {
+			return "", errors.New("consumption failed")
+		}
+		return "http://paperless/documents/7/details", nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx, 0)
+
+	d.Handle(watcher.Event{Type: watcher.EventUploaded, Path: "a.pdf", TaskID: "good"})
+	assert.Eventually(t, func() bool { return len(r.sent()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "http://paperless/documents/7/details", r.sent()[0].URL)
+
+	// The notification is still sent if the document can't be found.
+	d.Handle(watcher.Event{Type: watcher.EventUploaded, Path: "b.pdf", TaskID: "bad"})
+	assert.Eventually(t, func() bool { return len(r.sent()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, r.sent()[1].URL)
+}
+
+func TestFromConfig(t *testing.T) {
+	targets, err := FromConfig(config.Notifications{})
+	assert.NoError(t, err)
+	assert.Empty(t, targets)
+
+	targets, err = FromConfig(config.Notifications{Ntfy: &config.Ntfy{Topic: "scans", Priority: "low"}})
+	assert.NoError(t, err)
+	if assert.Len(t, targets, 1) {
+		assert.Equal(t, &Ntfy{URL: "https://ntfy.sh", Topic: "scans", Priority: 2, FailurePriority: 4}, targets[0].Notifier)
+	}
+
+	_, err = FromConfig(config.Notifications{Ntfy: &config.Ntfy{}})
+	assert.EqualError(t, err, "ntfy: topic is required")
+	_, err = FromConfig(config.Notifications{Ntfy: &config.Ntfy{Topic: "scans", Priority: "loud"}})
+	assert.Error(t, err)
+
+	zero := 0
+	targets, err = FromConfig(config.Notifications{
+		Ntfy:   &config.Ntfy{Topic: "scans"},
+		Gotify: &config.Gotify{URL: "http://gotify", Token: "app-token", Priority: &zero, NotifierOptions: config.NotifierOptions{Events: []string{"upload", "summary"}}},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, targets, 2) {
+		assert.Equal(t, &Gotify{URL: "http://gotify", Token: "app-token", Priority: 0, FailurePriority: 8}, targets[1].Notifier)
+		assert.True(t, targets[1].Wants(KindUpload))
+		assert.False(t, targets[1].Wants(KindFailure))
+	}
+
+	_, err = FromConfig(config.Notifications{Gotify: &config.Gotify{URL: "http://gotify"}})
+	assert.EqualError(t, err, "gotify: url and token are required")
+	eleven := 11
+	_, err = FromConfig(config.Notifications{Gotify: &config.Gotify{URL: "http://gotify", Token: "t", FailurePriority: &eleven}})
+	assert.Error(t, err)
+
+	targets, err = FromConfig(config.Notifications{
+		Telegram: &config.Telegram{Token: "123:abc", ChatID: "42"},
+		Pushover: &config.Pushover{Token: "app", User: "user"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, targets, 2) {
+		assert.Equal(t, &Telegram{Token: "123:abc", ChatID: "42"}, targets[0].Notifier)
+		assert.Equal(t, &Pushover{Token: "app", User: "user", Priority: 0, FailurePriority: 1}, targets[1].Notifier)
+	}
+	_, err = FromConfig(config.Notifications{Telegram: &config.Telegram{Token: "123:abc"}})
+	assert.EqualError(t, err, "telegram: token and chat_id are required")
+	_, err = FromConfig(config.Notifications{Pushover: &config.Pushover{Token: "app", User: "user", Priority: &eleven}})
+	assert.EqualError(t, err, "pushover: invalid priority 11: must be -2 to 1")
+
+	targets, err = FromConfig(config.Notifications{Webhooks: []config.Webhook{
+		{Format: "slack", URL: "http://slack/hook"},
+		{Name: "team", Format: "discord", URL: "http://discord/hook", NotifierOptions: config.NotifierOptions{BatchInterval: time.Minute}},
+	}})
+	assert.NoError(t, err)
+	if assert.Len(t, targets, 2) {
+		assert.Equal(t, "webhook slack", targets[0].Name)
+		assert.Equal(t, &Webhook{URL: "http://slack/hook", Format: "slack"}, targets[0].Notifier)
+		assert.Equal(t, "webhook team", targets[1].Name)
+		assert.IsType(t, &Batcher{}, targets[1].Notifier)
+	}
+	_, err = FromConfig(config.Notifications{Webhooks: []config.Webhook{{Format: "slack"}}})
+	assert.EqualError(t, err, "webhooks[0]: url is required")
+	_, err = FromConfig(config.Notifications{Webhooks: []config.Webhook{{Format: "teams", URL: "http://teams"}}})
+	assert.EqualError(t, err, `webhooks[0]: invalid format "teams": must be slack, discord or mattermost`)
+
+	targets, err = FromConfig(config.Notifications{Email: &config.Email{Host: "mail", From: "a@example.com", To: []string{"b@example.com"}, TLS: "tls"}})
+	assert.NoError(t, err)
+	if assert.Len(t, targets, 1) {
+		assert.Equal(t, &Email{Addr: "mail:465", From: "a@example.com", To: []string{"b@example.com"}, TLS: "tls"}, targets[0].Notifier)
+	}
+	targets, err = FromConfig(config.Notifications{Email: &config.Email{Host: "mail", From: "a@example.com", To: []string{"b@example.com"}}})
+	assert.NoError(t, err)
+	if assert.Len(t, targets, 1) {
+		assert.Equal(t, "mail:587", targets[0].Notifier.(*Email).Addr)
+	}
+	_, err = FromConfig(config.Notifications{Email: &config.Email{Host: "mail"}})
+	assert.EqualError(t, err, "email: host, from and to are required")
+	_, err = FromConfig(config.Notifications{Email: &config.Email{Host: "mail", From: "a", To: []string{"b"}, TLS: "ssl"}})
+	assert.EqualError(t, err, `email: invalid tls mode "ssl": must be starttls, tls or none`)
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ntfyPriorities maps the ntfy priority names to their numbers.
+var ntfyPriorities = map[string]int{"min": 1, "low": 2, "default": 3, "high": 4, "urgent": 5, "max": 5}
+
+// Ntfy publishes messages to an ntfy topic.
+type Ntfy struct {
+	URL   string
+	Topic string
+	Token string
+	// Priority and FailurePriority are ntfy priorities from 1 to 5.
+	Priority        int
+	FailurePriority int
+	HTTPClient      *http.Client
+}
+
+// ParseNtfyPriority parses a priority name or number. Empty returns def.
+func ParseNtfyPriority(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	if p, ok := ntfyPriorities[strings.ToLower(s)]; ok {
+		return p, nil
+	}
+	if p, err := strconv.Atoi(s); err == nil && p >= 1 && p <= 5 {
+		return p, nil
+	}
+	return 0, fmt.Errorf("invalid ntfy priority %q: must be min, low, default, high, urgent or 1-5", s)
+}
+
+// Send implements Notifier.
+func (n *Ntfy) Send(ctx context.Context, m Message) error {
+	url := strings.TrimRight(n.URL, "/") + "/" + n.Topic
+	req, err := http.NewRequest("POST", url, strings.NewReader(m.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", m.Title)
+	priority, tag := n.Priority, "page_facing_up"
+	if m.Kind == KindFailure {
+		priority, tag = n.FailurePriority, "warning"
+	}
+	if priority > 0 {
+		req.Header.Set("Priority", strconv.Itoa(priority))
+	}
+	req.Header.Set("Tags", tag)
+	if m.URL != "" {
+		req.Header.Set("Click", m.URL)
+	}
+	if n.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.Token)
+	}
+	return send(ctx, n.HTTPClient, req)
+}
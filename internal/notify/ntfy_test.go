@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNtfy(t *testing.T) {
+	var req *http.Request
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		req, body = r, string(data)
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"forbidden"}`))
+		}
+	}))
+	defer server.Close()
+
+	n := &Ntfy{URL: server.URL + "/", Topic: "scans", Token: "tk_123", Priority: 2, FailurePriority: 4}
+	assert.NoError(t, n.Send(context.Background(), Message{Kind: KindFailure, Title: "Upload failed", Body: "scan.pdf: timeout"}))
+	assert.Equal(t, "/scans", req.URL.Path)
+	assert.Equal(t, "scan.pdf: timeout", body)
+	assert.Equal(t, "Upload failed", req.Header.Get("Title"))
+	assert.Equal(t, "4", req.Header.Get("Priority"))
+	assert.Equal(t, "warning", req.Header.Get("Tags"))
+	assert.Equal(t, "Bearer tk_123", req.Header.Get("Authorization"))
+
+	assert.NoError(t, n.Send(context.Background(), Message{Kind: KindUpload, Title: "Document uploaded", URL: "http://paperless/documents/1/details"}))
+	assert.Equal(t, "2", req.Header.Get("Priority"))
+	assert.Equal(t, "http://paperless/documents/1/details", req.Header.Get("Click"))
+
+	n.Topic = "missing"
+	assert.EqualError(t, n.Send(context.Background(), Message{Kind: KindUpload}), `status code 403: {"error":"forbidden"}`)
+}
+
+func TestParseNtfyPriority(t *testing.T) {
+	for s, want := range map[string]int{"": 3, "urgent": 5, "Low": 2, "1": 1} {
+		p, err := ParseNtfyPriority(s, 3)
+		assert.NoError(t, err, s)
+		assert.Equal(t, want, p, s)
+	}
+	_, err := ParseNtfyPriority("6", 3)
+	assert.Error(t, err)
+}
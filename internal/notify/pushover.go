@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// pushoverAPI is the Pushover message endpoint.
+const pushoverAPI = "https://api.pushover.net/1/messages.json"
+
+// Pushover sends messages through Pushover.
+type Pushover struct {
+	Token  string
+	User   string
+	Device string
+	// Priority and FailurePriority are Pushover priorities from -2 to 1.
+	Priority        int
+	FailurePriority int
+	// APIURL overrides the message endpoint.
+	APIURL     string
+	HTTPClient *http.Client
+}
+
+// Send implements Notifier.
+func (p *Pushover) Send(ctx context.Context, m Message) error {
+	priority := p.Priority
+	if m.Kind == KindFailure {
+		priority = p.FailurePriority
+	}
+	form := url.Values{
+		"token":    {p.Token},
+		"user":     {p.User},
+		"title":    {m.Title},
+		"message":  {m.Body},
+		"priority": {strconv.Itoa(priority)},
+	}
+	if p.Device != "" {
+		form.Set("device", p.Device)
+	}
+	if m.URL != "" {
+		form.Set("url", m.URL)
+		form.Set("url_title", "Open in Paperless")
+	}
+	api := p.APIURL
+	if api == "" {
+		api = pushoverAPI
+	}
+	req, err := http.NewRequest("POST", api, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return send(ctx, p.HTTPClient, req)
+}
@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushover(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		form = r.PostForm
+	}))
+	defer server.Close()
+
+	p := &Pushover{Token: "app", User: "user", Priority: -1, FailurePriority: 1, APIURL: server.URL}
+	assert.NoError(t, p.Send(context.Background(), Message{Kind: KindFailure, Title: "Upload failed", Body: "scan.pdf: timeout"}))
+	assert.Equal(t, url.Values{
+		"token":    {"app"},
+		"user":     {"user"},
+		"title":    {"Upload failed"},
+		"message":  {"scan.pdf: timeout"},
+		"priority": {"1"},
+	}, form)
+
+	p.Device = "phone"
+	assert.NoError(t, p.Send(context.Background(), Message{Kind: KindUpload, Title: "Document uploaded", URL: "http://paperless/documents/7/details"}))
+	assert.Equal(t, "-1", form.Get("priority"))
+	assert.Equal(t, "phone", form.Get("device"))
+	assert.Equal(t, "http://paperless/documents/7/details", form.Get("url"))
+}
@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// telegramAPI is the Telegram Bot API endpoint.
+const telegramAPI = "https://api.telegram.org"
+
+// Telegram sends messages through a Telegram bot.
+type Telegram struct {
+	Token  string
+	ChatID string
+	// APIURL overrides the Bot API endpoint.
+	APIURL     string
+	HTTPClient *http.Client
+}
+
+// Send implements Notifier.
+func (t *Telegram) Send(ctx context.Context, m Message) error {
+	lines := []string{m.Title, m.Body}
+	if m.URL != "" {
+		lines = append(lines, m.URL)
+	}
+	body, err := json.Marshal(map[string]string{"chat_id": t.ChatID, "text": strings.Join(lines, "\n")})
+	if err != nil {
+		return err
+	}
+	api := t.APIURL
+	if api == "" {
+		api = telegramAPI
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimRight(api, "/"), t.Token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := send(ctx, t.HTTPClient, req); err != nil {
+		// The request URL contains the bot token.
+		return errors.New(strings.ReplaceAll(err.Error(), t.Token, "REDACTED"))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelegram(t *testing.T) {
+	var (
+		path string
+		msg  map[string]string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		msg = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		if msg["chat_id"] == "unknown" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"ok":false,"description":"Bad Request: chat not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	tg := &Telegram{Token: "123:secret", ChatID: "42", APIURL: server.URL}
+	assert.NoError(t, tg.Send(context.Background(), Message{Kind: KindUpload, Title: "Document uploaded", Body: "Uploaded scan.pdf", URL: "http://paperless/documents/7/details"}))
+	assert.Equal(t, "/bot123:secret/sendMessage", path)
+	assert.Equal(t, map[string]string{"chat_id": "42", "text": "Document uploaded\nUploaded scan.pdf\nhttp://paperless/documents/7/details"}, msg)
+
+	tg.ChatID = "unknown"
+	err := tg.Send(context.Background(), Message{Kind: KindFailure})
+	assert.ErrorContains(t, err, "chat not found")
+
+	// Connection errors include the request URL, which holds the token.
+	tg.APIURL = "http://127.0.0.1:1"
+	err = tg.Send(context.Background(), Message{Kind: KindFailure})
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), "secret")
+	}
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// discordMaxLength is the maximum length of a Discord message.
+const discordMaxLength = 2000
+
+// Webhook posts messages to a Slack, Discord or Mattermost incoming webhook.
+type Webhook struct {
+	URL string
+	// Format is "slack", "discord" or "mattermost".
+	Format     string
+	HTTPClient *http.Client
+}
+
+// ValidWebhookFormat reports whether format is a supported webhook format.
+func ValidWebhookFormat(format string) bool {
+	switch format {
+	case "slack", "discord", "mattermost":
+		return true
+	}
+	return false
+}
+
+// Send implements Notifier.
+func (w *Webhook) Send(ctx context.Context, m Message) error {
+	var payload map[string]string
+	switch w.Format {
+	case "slack":
+		text := "*" + m.Title + "*\n" + m.Body
+		if m.URL != "" {
+			text += "\n<" + m.URL + "|Open in Paperless>"
+		}
+		payload = map[string]string{"text": text}
+	case "mattermost":
+		text := "**" + m.Title + "**\n" + m.Body
+		if m.URL != "" {
+			text += "\n[Open in Paperless](" + m.URL + ")"
+		}
+		payload = map[string]string{"text": text}
+	case "discord":
+		text := "**" + m.Title + "**\n" + m.Body
+		if m.URL != "" {
+			text += "\n<" + m.URL + ">"
+		}
+		if len(text) > discordMaxLength {
+			text = strings.ToValidUTF8(text[:discordMaxLength-3], "") + "..."
+		}
+		payload = map[string]string{"content": text}
+	default:
+		return fmt.Errorf("unsupported webhook format %q", w.Format)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return send(ctx, w.HTTPClient, req)
+}
@@ -0,0 +1,66 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		payload = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+	}))
+	defer server.Close()
+
+	m := Message{Kind: KindUpload, Title: "Document uploaded", Body: "scan.pdf", URL: "http://paperless/documents/7/details"}
+	for format, want := range map[string]map[string]string{
+		"slack":      {"text": "*Document uploaded*\nscan.pdf\n<http://paperless/documents/7/details|Open in Paperless>"},
+		"mattermost": {"text": "**Document uploaded**\nscan.pdf\n[Open in Paperless](http://paperless/documents/7/details)"},
+		"discord":    {"content": "**Document uploaded**\nscan.pdf\n<http://paperless/documents/7/details>"},
+	} {
+		w := &Webhook{URL: server.URL, Format: format}
+		assert.NoError(t, w.Send(context.Background(), m), format)
+		assert.Equal(t, want, payload, format)
+	}
+
+	w := &Webhook{URL: server.URL, Format: "discord"}
+	assert.NoError(t, w.Send(context.Background(), Message{Title: "Summary", Body: strings.Repeat("x", 3000)}))
+	assert.Len(t, payload["content"], discordMaxLength)
+	assert.Error(t, (&Webhook{URL: server.URL, Format: "teams"}).Send(context.Background(), m))
+}
+
+func TestBatcher(t *testing.T) {
+	r := &recorder{}
+	b := NewBatcher("test", r, time.Hour)
+	ctx := context.Background()
+
+	assert.NoError(t, b.Send(ctx, Message{Kind: KindUpload, Title: "Document uploaded", Body: "a.pdf"}))
+	assert.NoError(t, b.Flush(ctx))
+	assert.Equal(t, []Message{{Kind: KindUpload, Title: "Document uploaded", Body: "a.pdf"}}, r.sent())
+
+	assert.NoError(t, b.Send(ctx, Message{Kind: KindUpload, Title: "Document uploaded", Body: "b.pdf", URL: "http://paperless/documents/2/details"}))
+	assert.NoError(t, b.Send(ctx, Message{Kind: KindFailure, Title: "Upload failed", Body: "c.pdf: timeout"}))
+	assert.Len(t, r.sent(), 1)
+	assert.NoError(t, b.Flush(ctx))
+	assert.Equal(t, Message{
+		Kind:  KindFailure,
+		Title: "2 notifications, 1 failed",
+		Body:  "• c.pdf: timeout\n• b.pdf (http://paperless/documents/2/details)",
+	}, r.sent()[1])
+
+	assert.NoError(t, b.Flush(ctx))
+	assert.Len(t, r.sent(), 2)
+
+	b = NewBatcher("test", r, 10*time.Millisecond)
+	assert.NoError(t, b.Send(ctx, Message{Kind: KindUpload, Body: "d.pdf"}))
+	assert.Eventually(t, func() bool { return len(r.sent()) == 3 }, time.Second, 5*time.Millisecond)
+}
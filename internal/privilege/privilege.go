@@ -0,0 +1,67 @@
+// Package privilege drops root privileges after startup, so the uploader
+// can bind low ports and open protected files as root but processes files as
+// an unprivileged account.
+package privilege
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// credentials are the numeric IDs to switch to.
+type credentials struct {
+	UID    int
+	GID    int
+	Groups []int
+}
+
+// lookup resolves a user and an optional group, given by name or numeric ID.
+// Without a group the user's primary group is used. The supplementary groups
+// are those of the user, if it is known to the system.
+func lookup(userName, groupName string) (credentials, error) {
+	var creds credentials
+	known := true
+	u, err := user.Lookup(userName)
+	if err != nil {
+		if u, err = user.LookupId(userName); err != nil {
+			if _, convErr := strconv.Atoi(userName); convErr != nil {
+				return creds, fmt.Errorf("unknown user %q", userName)
+			}
+			// A numeric ID unknown to the system, as common in containers.
+			u = &user.User{Uid: userName, Gid: userName}
+			known = false
+		}
+	}
+	if creds.UID, err = strconv.Atoi(u.Uid); err != nil {
+		return creds, fmt.Errorf("user %q has no numeric ID", userName)
+	}
+	gid := u.Gid
+	if groupName != "" {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			if g, err = user.LookupGroupId(groupName); err != nil {
+				if _, convErr := strconv.Atoi(groupName); convErr != nil {
+					return creds, fmt.Errorf("unknown group %q", groupName)
+				}
+				g = &user.Group{Gid: groupName}
+			}
+		}
+		gid = g.Gid
+	}
+	if creds.GID, err = strconv.Atoi(gid); err != nil {
+		return creds, fmt.Errorf("group %q has no numeric ID", gid)
+	}
+	creds.Groups = []int{creds.GID}
+	if !known {
+		return creds, nil
+	}
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if n, err := strconv.Atoi(id); err == nil && n != creds.GID {
+				creds.Groups = append(creds.Groups, n)
+			}
+		}
+	}
+	return creds, nil
+}
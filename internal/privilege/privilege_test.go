@@ -0,0 +1,45 @@
+package privilege
+
+import (
+	"os/user"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("numeric user IDs are not used on Windows")
+	}
+	current, err := user.Current()
+	assert.NoError(t, err)
+	uid, _ := strconv.Atoi(current.Uid)
+	gid, _ := strconv.Atoi(current.Gid)
+
+	creds, err := lookup(current.Username, "")
+	assert.NoError(t, err)
+	assert.Equal(t, uid, creds.UID)
+	assert.Equal(t, gid, creds.GID)
+	assert.Equal(t, gid, creds.Groups[0])
+
+	creds, err = lookup(current.Uid, "")
+	assert.NoError(t, err)
+	assert.Equal(t, uid, creds.UID)
+
+	// IDs unknown to the system are used as given.
+	creds, err = lookup("65532", "65533")
+	assert.NoError(t, err)
+	assert.Equal(t, credentials{UID: 65532, GID: 65533, Groups: []int{65533}}, creds)
+
+	_, err = lookup("no-such-user", "")
+	assert.EqualError(t, err, `unknown user "no-such-user"`)
+	_, err = lookup(current.Uid, "no-such-group")
+	assert.EqualError(t, err, `unknown group "no-such-group"`)
+}
+
+func TestDropWithoutUser(t *testing.T) {
+	assert.NoError(t, Drop("", ""))
+	assert.Error(t, Drop("", "staff"))
+}
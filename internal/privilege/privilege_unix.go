@@ -0,0 +1,43 @@
+//go:build !windows
+
+package privilege
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Drop switches the process to userName and groupName (names or numeric
+// IDs) if it runs as root. It does nothing if userName is empty and fails if
+// the process was not started as root or root privileges could be regained.
+func Drop(userName, groupName string) error {
+	if userName == "" {
+		if groupName != "" {
+			return errors.New("run_as.group requires run_as.user")
+		}
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("cannot switch to user %q: not running as root", userName)
+	}
+	creds, err := lookup(userName, groupName)
+	if err != nil {
+		return err
+	}
+	// The group must be changed while still root.
+	if err := syscall.Setgroups(creds.Groups); err != nil {
+		return fmt.Errorf("failed to set supplementary groups: %w", err)
+	}
+	if err := syscall.Setgid(creds.GID); err != nil {
+		return fmt.Errorf("failed to set group ID %d: %w", creds.GID, err)
+	}
+	if err := syscall.Setuid(creds.UID); err != nil {
+		return fmt.Errorf("failed to set user ID %d: %w", creds.UID, err)
+	}
+	if creds.UID != 0 && syscall.Setuid(0) == nil {
+		return errors.New("root privileges could be regained after switching users")
+	}
+	return nil
+}
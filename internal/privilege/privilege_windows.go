@@ -0,0 +1,12 @@
+package privilege
+
+import "errors"
+
+// Drop is not supported on Windows, where the service account is chosen
+// when installing the service. It fails if userName or groupName is set.
+func Drop(userName, groupName string) error {
+	if userName != "" || groupName != "" {
+		return errors.New("run_as is not supported on Windows")
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+// Package rclonesource downloads new files from any remote supported by
+// rclone, using the remote control API of "rclone rcd", and deletes them
+// remotely, or moves them to a processed folder, once uploaded.
+package rclonesource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// requestTimeout bounds API calls other than downloads.
+const requestTimeout = time.Minute
+
+// stat is the size and modification time of a remote file, compared
+// between polls to tell whether the file is still being written.
+type stat struct {
+	size    int64
+	modTime string
+}
+
+// entry is a file listed by operations/list.
+type entry struct {
+	Name    string
+	Size    int64
+	ModTime string
+	IsDir   bool
+}
+
+// Source offers the files added to an rclone remote to a watcher.
+type Source struct {
+	// DryRun only logs the files that would be downloaded and offers
+	// none.
+	DryRun bool
+
+	cfg    config.Rclone
+	folder watcher.Folder
+	client *http.Client
+	files  chan watcher.File
+	// dir holds the downloads until they were uploaded.
+	dir string
+
+	mu sync.Mutex
+	// downloaded maps the local path of a download to its remote name
+	// until it was uploaded.
+	downloaded map[string]string
+	// seen holds the remote names downloaded in this run, so that they are
+	// not downloaded again before they were deleted or moved.
+	seen map[string]bool
+	// pending holds the files found by the previous poll that were not
+	// downloaded yet.
+	pending map[string]stat
+}
+
+// New creates a source for cfg. The documents are uploaded with the
+// settings of folder, whose Path is replaced by the remote.
+func New(cfg config.Rclone, folder watcher.Folder) (*Source, error) {
+	if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid url %q", cfg.URL)
+	}
+	if !strings.Contains(cfg.Remote, ":") {
+		return nil, errors.New(`rclone needs remote, e.g. "dropbox:Scans"`)
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Minute
+	}
+	folder.Path = cfg.Remote
+	return &Source{
+		cfg:        cfg,
+		folder:     folder,
+		client:     &http.Client{},
+		files:      make(chan watcher.File),
+		downloaded: make(map[string]string),
+		seen:       make(map[string]bool),
+		pending:    make(map[string]stat),
+	}, nil
+}
+
+// Start creates the download directory and begins polling the remote.
+func (s *Source) Start(ctx context.Context) error {
+	switch {
+	case s.DryRun:
+	case s.cfg.DownloadDir != "":
+		if err := os.MkdirAll(s.cfg.DownloadDir, 0700); err != nil {
+			return err
+		}
+		s.dir = s.cfg.DownloadDir
+	default:
+		dir, err := os.MkdirTemp("", "paperless-uploader-rclone-")
+		if err != nil {
+			return err
+		}
+		s.dir = dir
+	}
+	logging.Infof("Watching rclone remote %s", s.cfg.Remote)
+	go s.run(ctx)
+	return nil
+}
+
+func (s *Source) Events() <-chan watcher.File {
+	return s.files
+}
+
+// Remote returns the remote name of the downloaded file at local until it
+// was uploaded.
+func (s *Source) Remote(local string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remote, ok := s.downloaded[local]
+	return remote, ok
+}
+
+// Complete removes the download and, if it was uploaded, deletes or moves
+// the remote file. Failed files stay on the remote, but are not downloaded
+// again until the next start.
+func (s *Source) Complete(f watcher.File, err error) {
+	if rmErr := os.Remove(f.Path); rmErr != nil && !os.IsNotExist(rmErr) {
+		logging.Warnf("Failed to remove %s: %v", f.Path, rmErr)
+	}
+	s.mu.Lock()
+	name, ok := s.downloaded[f.Path]
+	delete(s.downloaded, f.Path)
+	s.mu.Unlock()
+	if !ok || err != nil {
+		return
+	}
+	if err := s.finish(name); err != nil {
+		logging.Warnf("Failed to clean up %s on rclone remote %s: %v", name, s.cfg.Remote, err)
+		return
+	}
+	s.mu.Lock()
+	delete(s.seen, name)
+	s.mu.Unlock()
+}
+
+// finish deletes the remote file name or moves it to the processed folder.
+func (s *Source) finish(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	if s.cfg.Processed == "" {
+		return s.call(ctx, "operations/deletefile", map[string]string{"fs": s.cfg.Remote, "remote": name}, nil)
+	}
+	return s.call(ctx, "operations/movefile", map[string]string{
+		"srcFs": s.cfg.Remote, "srcRemote": name,
+		"dstFs": s.cfg.Processed, "dstRemote": name,
+	}, nil)
+}
+
+func (s *Source) run(ctx context.Context) {
+	defer close(s.files)
+	for {
+		if err := s.poll(ctx); err != nil && ctx.Err() == nil {
+			logging.Errorf("Failed to poll rclone remote %s: %v", s.cfg.Remote, err)
+		}
+		if !sleep(ctx, s.cfg.PollInterval) {
+			return
+		}
+	}
+}
+
+// poll lists the remote folder and offers the files that did not change
+// since the previous poll, so that files still being written are skipped.
+func (s *Source) poll(ctx context.Context) error {
+	listCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	var list struct {
+		List []entry `json:"list"`
+	}
+	if err := s.call(listCtx, "operations/list", map[string]string{"fs": s.cfg.Remote, "remote": ""}, &list); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	previous := s.pending
+	s.pending = make(map[string]stat)
+	var ready []string
+	for _, e := range list.List {
+		if e.IsDir || strings.HasPrefix(e.Name, ".") || s.seen[e.Name] {
+			continue
+		}
+		current := stat{size: e.Size, modTime: e.ModTime}
+		if previous[e.Name] == current {
+			ready = append(ready, e.Name)
+		} else {
+			s.pending[e.Name] = current
+		}
+	}
+	s.mu.Unlock()
+
+	for _, name := range ready {
+		if s.DryRun {
+			s.mu.Lock()
+			s.seen[name] = true
+			s.mu.Unlock()
+			logging.Infof("[dry-run] Would download %s from rclone remote %s", name, s.cfg.Remote)
+			continue
+		}
+		local, err := s.download(ctx, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			logging.Errorf("Failed to download %s from rclone remote %s: %v", name, s.cfg.Remote, err)
+			continue
+		}
+		s.mu.Lock()
+		s.seen[name] = true
+		s.downloaded[local] = name
+		s.mu.Unlock()
+		logging.Infof("Downloaded %s from rclone remote %s", name, s.cfg.Remote)
+		select {
+		case s.files <- watcher.File{Path: local, Folder: s.folder}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// download fetches the remote file name through the file server of
+// --rc-serve.
+func (s *Source) download(ctx context.Context, name string) (string, error) {
+	u := strings.TrimSuffix(s.cfg.URL, "/") + "/" + url.PathEscape("["+s.cfg.Remote+"]") + "/" + url.PathEscape(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	s.authorize(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status code %d; is rclone started with --rc-serve?", resp.StatusCode)
+	}
+	return watcher.Deliver(s.dir, path.Base(name), resp.Body)
+}
+
+// call calls the API method with the JSON object in, decoding the result
+// into out unless it is nil.
+func (s *Source) call(ctx context.Context, method string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(s.cfg.URL, "/")+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.authorize(req)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+			return fmt.Errorf("%s: %s", method, failure.Error)
+		}
+		return fmt.Errorf("%s: status code %d", method, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (s *Source) authorize(req *http.Request) {
+	if s.cfg.Username != "" || s.cfg.Password != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+}
+
+// sleep waits for d and reports whether ctx is still active.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,119 @@
+package rclonesource
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRclone serves the remote control API for the remote "nas:scans".
+type fakeRclone struct {
+	mu    sync.Mutex
+	files map[string]string
+	moved []string
+}
+
+func (f *fakeRclone) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, _ := r.BasicAuth(); user != "rc" || pass != "secret" {
+		http.Error(w, `{"error": "unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var in map[string]string
+	if r.Method == http.MethodPost {
+		json.NewDecoder(r.Body).Decode(&in)
+	}
+	switch r.URL.Path {
+	case "/operations/list":
+		var list []map[string]any
+		for name, content := range f.files {
+			list = append(list, map[string]any{"Name": name, "Size": len(content), "ModTime": "2024-05-01T10:00:00Z"})
+		}
+		list = append(list, map[string]any{"Name": "done", "IsDir": true})
+		json.NewEncoder(w).Encode(map[string]any{"list": list})
+	case "/operations/movefile":
+		f.moved = append(f.moved, in["srcFs"]+in["srcRemote"]+" -> "+in["dstFs"]+in["dstRemote"])
+		delete(f.files, in["srcRemote"])
+		w.Write([]byte("{}"))
+	case "/[nas:scans]/scan 1.pdf":
+		w.Write([]byte(f.files["scan 1.pdf"]))
+	default:
+		http.Error(w, `{"error": "not found"}`, http.StatusNotFound)
+	}
+}
+
+func TestSource(t *testing.T) {
+	rc := &fakeRclone{files: map[string]string{"scan 1.pdf": "%PDF-1.4"}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	_, err := New(config.Rclone{URL: srv.URL, Remote: "scans"}, watcher.Folder{})
+	assert.Error(t, err)
+
+	s, err := New(config.Rclone{
+		URL:          srv.URL,
+		Username:     "rc",
+		Password:     "secret",
+		Remote:       "nas:scans",
+		Processed:    "nas:scans/done",
+		PollInterval: 10 * time.Millisecond,
+		DownloadDir:  t.TempDir(),
+	}, watcher.Folder{TagNames: []string{"nas"}})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, s.Start(ctx))
+
+	var f watcher.File
+	select {
+	case f = <-s.Events():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the download")
+	}
+	assert.Equal(t, "nas:scans", f.Folder.Path)
+	assert.Equal(t, []string{"nas"}, f.Folder.TagNames)
+	data, err := os.ReadFile(f.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4", string(data))
+
+	s.Complete(f, nil)
+	_, err = os.Stat(f.Path)
+	assert.True(t, os.IsNotExist(err))
+	rc.mu.Lock()
+	assert.Equal(t, []string{"nas:scansscan 1.pdf -> nas:scans/donescan 1.pdf"}, rc.moved)
+	rc.mu.Unlock()
+
+	cancel()
+	for range s.Events() {
+	}
+}
+
+func TestSourceDryRun(t *testing.T) {
+	rc := &fakeRclone{files: map[string]string{"scan 1.pdf": "%PDF-1.4"}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	s, err := New(config.Rclone{URL: srv.URL, Username: "rc", Password: "secret", Remote: "nas:scans", DownloadDir: dir}, watcher.Folder{})
+	assert.NoError(t, err)
+	s.DryRun = true
+
+	// The second poll finds the file unchanged and would download it.
+	assert.NoError(t, s.poll(context.Background()))
+	assert.NoError(t, s.poll(context.Background()))
+	assert.True(t, s.seen["scan 1.pdf"])
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Contains(t, rc.files, "scan 1.pdf")
+}
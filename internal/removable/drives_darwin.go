@@ -0,0 +1,22 @@
+package removable
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// listDrives returns the volumes mounted in /Volumes, except the startup
+// disk, which is a symlink to /.
+func listDrives() ([]string, error) {
+	entries, err := os.ReadDir("/Volumes")
+	if err != nil {
+		return nil, err
+	}
+	var drives []string
+	for _, e := range entries {
+		if e.IsDir() {
+			drives = append(drives, filepath.Join("/Volumes", e.Name()))
+		}
+	}
+	return drives, nil
+}
@@ -0,0 +1,56 @@
+//go:build !windows && !darwin
+
+package removable
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mountRoots are where udisks and desktop environments mount removable
+// media.
+var mountRoots = []string{"/media/", "/run/media/"}
+
+// listDrives returns the mount points below mountRoots.
+func listDrives() ([]string, error) {
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var drives []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		mountPoint := unescapeMount(fields[1])
+		for _, root := range mountRoots {
+			if strings.HasPrefix(mountPoint, root) {
+				drives = append(drives, mountPoint)
+				break
+			}
+		}
+	}
+	return drives, scanner.Err()
+}
+
+// unescapeMount decodes the octal escapes, e.g. "\040" for a space, of a
+// mount point listed in /proc/self/mounts.
+func unescapeMount(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,26 @@
+package removable
+
+import "golang.org/x/sys/windows"
+
+// listDrives returns the roots of the drive letters of removable drives.
+func listDrives() ([]string, error) {
+	mask, err := windows.GetLogicalDrives()
+	if err != nil {
+		return nil, err
+	}
+	var drives []string
+	for i := 0; i < 26; i++ {
+		if mask&(1<<i) == 0 {
+			continue
+		}
+		root := string(rune('A'+i)) + `:\`
+		p, err := windows.UTF16PtrFromString(root)
+		if err != nil {
+			continue
+		}
+		if windows.GetDriveType(p) == windows.DRIVE_REMOVABLE {
+			drives = append(drives, root)
+		}
+	}
+	return drives, nil
+}
@@ -0,0 +1,222 @@
+// Package removable imports documents from USB drives and memory cards when
+// they are plugged in, e.g. after scanning to a stick at the copier.
+package removable
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// MarkerFile lists the files imported from a drive, relative to its root,
+// one per line.
+const MarkerFile = ".paperless-imported"
+
+// Source offers the documents on newly mounted removable drives to a
+// watcher. Drives already mounted when it starts are left alone.
+type Source struct {
+	PollInterval time.Duration
+	// Paths are the folders searched on a drive, relative to its root.
+	// Empty searches the whole drive.
+	Paths []string
+	// Extensions are the extensions of the files imported, without the
+	// dot. Empty imports every file.
+	Extensions []string
+	// MarkImported appends uploaded files to the MarkerFile of their drive
+	// and skips the files listed there.
+	MarkImported bool
+	// DryRun leaves the drives untouched.
+	DryRun bool
+	// Folder holds the settings documents are uploaded with. Its Path is
+	// replaced by the drive's mount point.
+	Folder watcher.Folder
+
+	// listDrives returns the mount points of removable drives; tests
+	// replace it.
+	listDrives func() ([]string, error)
+	files      chan watcher.File
+	// mu serializes writing the marker files.
+	mu sync.Mutex
+}
+
+// Start lists the drives mounted now and begins polling for new ones.
+func (s *Source) Start(ctx context.Context) error {
+	mounted, err := s.drives()
+	if err != nil {
+		return fmt.Errorf("failed to list removable drives: %v", err)
+	}
+	s.files = make(chan watcher.File)
+	logging.Infof("Watching for removable drives")
+	go s.run(ctx, mounted)
+	return nil
+}
+
+// Events returns the documents found on new drives. It must be called after
+// Start.
+func (s *Source) Events() <-chan watcher.File {
+	return s.files
+}
+
+// Complete records f in the marker file of its drive once it was uploaded.
+// Failed files are imported again the next time the drive is plugged in.
+func (s *Source) Complete(f watcher.File, err error) {
+	if err != nil || !s.MarkImported || s.DryRun {
+		return
+	}
+	rel, err := filepath.Rel(f.Folder.Path, f.Path)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	marker, err := os.OpenFile(filepath.Join(f.Folder.Path, MarkerFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err == nil {
+		_, err = fmt.Fprintln(marker, filepath.ToSlash(rel))
+		if closeErr := marker.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		logging.Warnf("Failed to mark %s as imported: %v", f.Path, err)
+	}
+}
+
+func (s *Source) drives() ([]string, error) {
+	if s.listDrives != nil {
+		return s.listDrives()
+	}
+	return listDrives()
+}
+
+func (s *Source) run(ctx context.Context, mounted []string) {
+	defer close(s.files)
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	known := make(map[string]bool)
+	for _, d := range mounted {
+		known[d] = true
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		drives, err := s.drives()
+		if err != nil {
+			logging.Debugf("Failed to list removable drives: %v", err)
+			continue
+		}
+		current := make(map[string]bool)
+		for _, d := range drives {
+			current[d] = true
+			if !known[d] && !s.importDrive(ctx, d) {
+				return
+			}
+		}
+		// Drives that were removed are searched again when plugged back in.
+		known = current
+	}
+}
+
+// importDrive offers the documents on the drive mounted at root, returning
+// false if ctx was cancelled first.
+func (s *Source) importDrive(ctx context.Context, root string) bool {
+	logging.Infof("Importing documents from removable drive %s", root)
+	imported := s.imported(root)
+	folder := s.Folder
+	folder.Path = root
+	paths := s.Paths
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	found := 0
+	for _, p := range paths {
+		start := filepath.Join(root, filepath.FromSlash(p))
+		err := filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == start && os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			// Hidden files include the AppleDouble files macOS leaves on
+			// FAT drives.
+			if path != start && (strings.HasPrefix(d.Name(), ".") || d.Name() == "System Volume Information") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() || !s.wanted(path) {
+				return nil
+			}
+			if rel, err := filepath.Rel(root, path); err == nil && imported[filepath.ToSlash(rel)] {
+				return nil
+			}
+			select {
+			case s.files <- watcher.File{Path: path, Folder: folder}:
+				found++
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if ctx.Err() != nil {
+			return false
+		}
+		if err != nil {
+			logging.Warnf("Failed to search %s: %v", start, err)
+		}
+	}
+	logging.Infof("Found %d new documents on %s", found, root)
+	return true
+}
+
+// wanted reports whether path has one of the configured extensions.
+func (s *Source) wanted(path string) bool {
+	if len(s.Extensions) == 0 {
+		return true
+	}
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	for _, e := range s.Extensions {
+		if strings.EqualFold(strings.TrimPrefix(e, "."), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// imported returns the files listed in the marker file of the drive at
+// root.
+func (s *Source) imported(root string) map[string]bool {
+	imported := make(map[string]bool)
+	if !s.MarkImported {
+		return imported
+	}
+	f, err := os.Open(filepath.Join(root, MarkerFile))
+	if err != nil {
+		return imported
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			imported[line] = true
+		}
+	}
+	return imported
+}
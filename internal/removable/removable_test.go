@@ -0,0 +1,87 @@
+package removable
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource(t *testing.T) {
+	drive := t.TempDir()
+	for _, name := range []string{"SCANS/a.pdf", "SCANS/sub/b.JPG", "SCANS/notes.txt", "SCANS/._a.pdf", "other.pdf"} {
+		path := filepath.Join(drive, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("x"), 0644))
+	}
+
+	var (
+		mu      sync.Mutex
+		mounted []string
+	)
+	mount := func(drives ...string) {
+		mu.Lock()
+		defer mu.Unlock()
+		mounted = drives
+	}
+	s := &Source{
+		PollInterval: 10 * time.Millisecond,
+		Paths:        []string{"SCANS", "MISSING"},
+		Extensions:   []string{"pdf", "jpg"},
+		MarkImported: true,
+		Folder:       watcher.Folder{TagNames: []string{"usb"}},
+		listDrives: func() ([]string, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return mounted, nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, s.Start(ctx))
+
+	next := func() watcher.File {
+		select {
+		case f := <-s.Events():
+			return f
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a file")
+			return watcher.File{}
+		}
+	}
+
+	mount(drive)
+	var found []string
+	for range 2 {
+		f := next()
+		assert.Equal(t, drive, f.Folder.Path)
+		assert.Equal(t, []string{"usb"}, f.Folder.TagNames)
+		rel, _ := filepath.Rel(drive, f.Path)
+		found = append(found, filepath.ToSlash(rel))
+		if filepath.Ext(f.Path) == ".pdf" {
+			s.Complete(f, nil)
+		}
+	}
+	sort.Strings(found)
+	assert.Equal(t, []string{"SCANS/a.pdf", "SCANS/sub/b.JPG"}, found)
+	marker, err := os.ReadFile(filepath.Join(drive, MarkerFile))
+	assert.NoError(t, err)
+	assert.Equal(t, "SCANS/a.pdf\n", string(marker))
+
+	// Plugged in again, only the file that was not uploaded is offered.
+	mount()
+	time.Sleep(50 * time.Millisecond)
+	mount(drive)
+	f := next()
+	assert.Equal(t, filepath.Join(drive, "SCANS", "sub", "b.JPG"), f.Path)
+
+	cancel()
+	for range s.Events() {
+	}
+}
@@ -0,0 +1,305 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/extract"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+)
+
+// File describes a file for the conditions of rules.
+type File struct {
+	Path string
+	// Folder is the watch folder of the file; empty uses the directory of
+	// Path.
+	Folder string
+	// Size and MimeType are read from the file at Path when zero.
+	Size     int64
+	MimeType string
+	// Sender is the address a mailed file came from.
+	Sender string
+	// Remote is the path or key of a file downloaded from a remote, e.g.
+	// over SFTP or rclone.
+	Remote string
+
+	// text is the extracted text, read when first needed.
+	text     string
+	textRead bool
+}
+
+// Condition selects the files a rule applies to. Every condition that is
+// set must match. Patterns are globs as understood by path.Match.
+type Condition struct {
+	// Filename is a pattern of the file name with extension, compared
+	// case-insensitively, e.g. "*invoice*.pdf".
+	Filename string
+	// Folder is a pattern of the watch folder path, or of its name if it
+	// contains no slash.
+	Folder string
+	// MinSize and MaxSize bound the file size in bytes; zero is no bound.
+	MinSize, MaxSize int64
+	// MimeType is a pattern of the content type, e.g. "image/*".
+	MimeType string
+	// CreatedAfter and CreatedBefore are inclusive YYYY-MM-DD bounds of
+	// the date parsed from the file name. Files without one don't match.
+	CreatedAfter, CreatedBefore string
+	// Sender is a pattern of the mail sender, compared case-insensitively,
+	// e.g. "*@bank.example".
+	Sender string
+	// Remote is a pattern of the remote path, e.g. "invoices/*".
+	Remote string
+	// Content is a regular expression matched case-insensitively against
+	// the text of the file, e.g. an IBAN. Its named groups are available to
+	// the title template.
+	Content string
+}
+
+// Action is the metadata a rule sets. Empty fields are left as they are;
+// tags are added.
+type Action struct {
+	// Title is a template like the title template, which can also use
+	// correspondent, document_type, storage_path, created, sender and
+	// remote.
+	Title         string
+	Correspondent string
+	DocumentType  string
+	StoragePath   string
+	Tags          []string
+	// PostUploadAction is "delete", "move" or "keep" to leave the file.
+	PostUploadAction string
+}
+
+// Rule sets metadata on the files matching a condition.
+type Rule struct {
+	Name string
+	When Condition
+	Then Action
+	// Stop skips the rules after this one if it matched.
+	Stop bool
+}
+
+type rule struct {
+	Rule
+	title   *template.Template
+	content *regexp.Regexp
+}
+
+// ExtractText sets the function reading the text of files for the content
+// conditions of rules. Without it, content conditions never match.
+func (e *Engine) ExtractText(text func(path string) (string, error)) {
+	e.text = text
+}
+
+// MatchesContent reports whether a rule has a content condition.
+func (e *Engine) MatchesContent() bool {
+	for _, r := range e.rules {
+		if r.content != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRules adds rules, which are applied in order after the filename
+// pattern and title template. Later rules override the fields set by
+// earlier ones.
+func (e *Engine) AddRules(rules []Rule) error {
+	for i, r := range rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			r.Name = name
+		}
+		for _, pattern := range []string{r.When.Filename, r.When.Folder, r.When.MimeType, r.When.Sender, r.When.Remote} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %s: invalid pattern %q", name, pattern)
+			}
+		}
+		for _, date := range []string{r.When.CreatedAfter, r.When.CreatedBefore} {
+			if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+				return fmt.Errorf("rule %s: invalid date %q: expected YYYY-MM-DD", name, date)
+			}
+		}
+		switch r.Then.PostUploadAction {
+		case "", "delete", "move", "keep":
+		default:
+			return fmt.Errorf("rule %s: invalid post upload action %q: must be delete, move or keep", name, r.Then.PostUploadAction)
+		}
+		compiled := rule{Rule: r}
+		if r.When.Content != "" {
+			re, err := regexp.Compile("(?i)" + r.When.Content)
+			if err != nil {
+				return fmt.Errorf("rule %s: invalid content pattern: %v", name, err)
+			}
+			compiled.content = re
+		}
+		if r.Then.Title != "" {
+			tmpl, err := template.New(name).Option("missingkey=zero").Parse(r.Then.Title)
+			if err != nil {
+				return fmt.Errorf("rule %s: invalid title template: %v", name, err)
+			}
+			compiled.title = tmpl
+		}
+		e.rules = append(e.rules, compiled)
+	}
+	return nil
+}
+
+// SetsPostUploadAction reports whether a rule sets the post-upload action.
+func (e *Engine) SetsPostUploadAction() bool {
+	for _, r := range e.rules {
+		if r.Then.PostUploadAction != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRules applies the matching rules to md.
+func (e *Engine) applyRules(f File, md *Metadata) error {
+	if f.Folder == "" {
+		f.Folder = filepath.Dir(f.Path)
+	}
+	for _, r := range e.rules {
+		if !r.When.matches(&f, md.Created) {
+			continue
+		}
+		if r.content != nil {
+			m := r.content.FindStringSubmatch(e.fileText(&f))
+			if m == nil {
+				continue
+			}
+			for i, group := range r.content.SubexpNames() {
+				if group != "" && m[i] != "" {
+					md.Fields[group] = strings.TrimSpace(m[i])
+				}
+			}
+		}
+		md.Rules = append(md.Rules, r.Name)
+		a := r.Then
+		for _, set := range []struct {
+			dest  *string
+			value string
+		}{
+			{&md.Correspondent, a.Correspondent},
+			{&md.DocumentType, a.DocumentType},
+			{&md.StoragePath, a.StoragePath},
+			{&md.PostUploadAction, a.PostUploadAction},
+		} {
+			if set.value != "" {
+				*set.dest = set.value
+			}
+		}
+		for _, tag := range a.Tags {
+			if !containsFold(md.Tags, tag) {
+				md.Tags = append(md.Tags, tag)
+			}
+		}
+		if r.title != nil {
+			fields := make(map[string]string, len(md.Fields)+6)
+			for k, v := range md.Fields {
+				fields[k] = v
+			}
+			for k, v := range map[string]string{
+				"title": md.Title, "correspondent": md.Correspondent, "document_type": md.DocumentType,
+				"storage_path": md.StoragePath, "created": md.Created, "sender": f.Sender, "remote": f.Remote,
+			} {
+				if v != "" {
+					fields[k] = v
+				}
+			}
+			var b strings.Builder
+			if err := r.title.Execute(&b, fields); err != nil {
+				return fmt.Errorf("rule %s: failed to render title: %v", r.Name, err)
+			}
+			md.Title = strings.Join(strings.Fields(b.String()), " ")
+		}
+		if r.Stop {
+			break
+		}
+	}
+	return nil
+}
+
+// fileText returns the text of f, empty if it cannot be extracted.
+func (e *Engine) fileText(f *File) string {
+	if !f.textRead && e.text != nil {
+		text, err := e.text(f.Path)
+		if err != nil {
+			logging.Warnf("Failed to extract the text of %s for rules: %v", f.Path, err)
+		}
+		f.text = text
+	}
+	f.textRead = true
+	return f.text
+}
+
+// matches reports whether f, created on the parsed date created, meets c.
+// The size and type of f are read when first needed.
+func (c Condition) matches(f *File, created string) bool {
+	if c.Filename != "" && !match(strings.ToLower(c.Filename), strings.ToLower(filepath.Base(f.Path))) {
+		return false
+	}
+	if c.Folder != "" {
+		folder := filepath.ToSlash(filepath.Clean(f.Folder))
+		if !strings.Contains(c.Folder, "/") {
+			folder = path.Base(folder)
+		}
+		if !match(c.Folder, folder) {
+			return false
+		}
+	}
+	if c.Sender != "" && (f.Sender == "" || !match(strings.ToLower(c.Sender), strings.ToLower(f.Sender))) {
+		return false
+	}
+	if c.Remote != "" && (f.Remote == "" || !match(c.Remote, f.Remote)) {
+		return false
+	}
+	if c.CreatedAfter != "" || c.CreatedBefore != "" {
+		if created == "" || (c.CreatedAfter != "" && created < c.CreatedAfter) || (c.CreatedBefore != "" && created > c.CreatedBefore) {
+			return false
+		}
+	}
+	if c.MinSize > 0 || c.MaxSize > 0 {
+		if f.Size == 0 {
+			info, err := os.Stat(f.Path)
+			if err != nil {
+				return false
+			}
+			f.Size = info.Size()
+		}
+		if (c.MinSize > 0 && f.Size < c.MinSize) || (c.MaxSize > 0 && f.Size > c.MaxSize) {
+			return false
+		}
+	}
+	if c.MimeType != "" {
+		if f.MimeType == "" {
+			f.MimeType = extract.MimeType(f.Path)
+		}
+		if !match(strings.ToLower(c.MimeType), f.MimeType) {
+			return false
+		}
+	}
+	return true
+}
+
+func match(pattern, name string) bool {
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
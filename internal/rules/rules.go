@@ -0,0 +1,171 @@
+// Package rules derives document metadata from file names and from rules
+// matching files by name, folder, size, type, date and origin.
+package rules
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// dateLayouts are the accepted formats of a parsed creation date.
+var dateLayouts = []string{"2006-01-02", "20060102", "2006_01_02", "2006.01.02", "02.01.2006"}
+
+// Metadata is the metadata derived for a file. Objects are referenced by
+// name and still have to be resolved to IDs.
+type Metadata struct {
+	Title         string   `json:"title,omitempty"`
+	Created       string   `json:"created,omitempty"`
+	Correspondent string   `json:"correspondent,omitempty"`
+	DocumentType  string   `json:"document_type,omitempty"`
+	StoragePath   string   `json:"storage_path,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	ASN           int      `json:"asn,omitempty"`
+	// PostUploadAction, if set by a rule, replaces the post-upload action
+	// of the folder: "delete", "move" or "keep".
+	PostUploadAction string `json:"post_upload_action,omitempty"`
+	// Rules are the names of the rules that matched, in order.
+	Rules []string `json:"rules,omitempty"`
+	// Matched reports whether the filename pattern matched.
+	Matched bool `json:"matched"`
+	// Fields holds the named groups of the pattern and the built-in
+	// template fields.
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Engine applies a filename pattern and a title template to file names.
+//
+// The pattern is a regular expression matched against the file name without
+// its extension. The named groups title, created (or date), correspondent,
+// document_type, storage_path, tags (comma separated) and asn set the
+// corresponding metadata. The title template is a text/template that can
+// use every named group as well as filename, ext and folder, e.g.
+// "{{.correspondent}} {{.title}}". Rules added with AddRules are applied
+// afterwards.
+type Engine struct {
+	pattern *regexp.Regexp
+	title   *template.Template
+	rules   []rule
+	text    func(path string) (string, error)
+}
+
+// New compiles an engine. Empty arguments disable the pattern or template.
+func New(pattern, titleTemplate string) (*Engine, error) {
+	e := &Engine{}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filename pattern: %v", err)
+		}
+		e.pattern = re
+	}
+	if titleTemplate != "" {
+		tmpl, err := template.New("title").Option("missingkey=zero").Parse(titleTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid title template: %v", err)
+		}
+		e.title = tmpl
+	}
+	return e, nil
+}
+
+// Empty reports whether the engine has neither a pattern, a template nor
+// rules.
+func (e *Engine) Empty() bool {
+	return e.pattern == nil && e.title == nil && len(e.rules) == 0
+}
+
+// Apply derives the metadata for the file at path.
+func (e *Engine) Apply(path string) (Metadata, error) {
+	return e.ApplyFile(File{Path: path})
+}
+
+// ApplyFile derives the metadata for f. The size and type of f are read
+// from the file if it exists and the rules need them.
+func (e *Engine) ApplyFile(f File) (Metadata, error) {
+	path := f.Path
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	md := Metadata{Fields: map[string]string{
+		"filename": name,
+		"ext":      strings.TrimPrefix(ext, "."),
+		"folder":   filepath.Base(filepath.Dir(path)),
+	}}
+
+	if e.pattern != nil {
+		if m := e.pattern.FindStringSubmatch(name); m != nil {
+			md.Matched = true
+			for i, group := range e.pattern.SubexpNames() {
+				if group != "" && m[i] != "" {
+					md.Fields[group] = m[i]
+				}
+			}
+			if err := md.setFromFields(); err != nil {
+				return md, err
+			}
+		}
+	}
+
+	if e.title != nil {
+		var b strings.Builder
+		if err := e.title.Execute(&b, md.Fields); err != nil {
+			return md, fmt.Errorf("failed to render title: %v", err)
+		}
+		md.Title = strings.Join(strings.Fields(b.String()), " ")
+	}
+	if len(e.rules) > 0 {
+		if err := e.applyRules(f, &md); err != nil {
+			return md, err
+		}
+	}
+	return md, nil
+}
+
+func (md *Metadata) setFromFields() error {
+	f := md.Fields
+	md.Title = f["title"]
+	md.Correspondent = f["correspondent"]
+	md.DocumentType = f["document_type"]
+	md.StoragePath = f["storage_path"]
+	for _, tag := range strings.Split(f["tags"], ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			md.Tags = append(md.Tags, tag)
+		}
+	}
+
+	created := f["created"]
+	if created == "" {
+		created = f["date"]
+	}
+	if created != "" {
+		date, err := parseDate(created)
+		if err != nil {
+			return err
+		}
+		md.Created = date
+	}
+
+	if asn := f["asn"]; asn != "" {
+		n, err := strconv.Atoi(asn)
+		if err != nil {
+			return fmt.Errorf("invalid archive serial number %q", asn)
+		}
+		md.ASN = n
+	}
+	return nil
+}
+
+// parseDate normalises a date in one of the accepted layouts to YYYY-MM-DD.
+func parseDate(s string) (string, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q in file name", s)
+}
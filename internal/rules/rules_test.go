@@ -0,0 +1,165 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	e, err := New(`^(?P<date>\d{8})_(?P<correspondent>[^_]+)_(?P<title>[^_]+)(_(?P<tags>.+))?$`, "{{.correspondent}} - {{.title}}")
+	assert.NoError(t, err)
+
+	md, err := e.Apply(filepath.Join("scans", "20240305_ACME_Power bill_invoice,utilities.pdf"))
+	assert.NoError(t, err)
+	assert.True(t, md.Matched)
+	assert.Equal(t, "ACME - Power bill", md.Title)
+	assert.Equal(t, "2024-03-05", md.Created)
+	assert.Equal(t, "ACME", md.Correspondent)
+	assert.Equal(t, []string{"invoice", "utilities"}, md.Tags)
+	assert.Equal(t, "scans", md.Fields["folder"])
+	assert.Equal(t, "pdf", md.Fields["ext"])
+
+	// Without a match only the built-in fields are available.
+	md, err = e.Apply("scan0001.pdf")
+	assert.NoError(t, err)
+	assert.False(t, md.Matched)
+	assert.Equal(t, "-", md.Title)
+
+	_, err = e.Apply("20241399_ACME_Bill.pdf")
+	assert.Error(t, err)
+}
+
+func TestTitleFromFilename(t *testing.T) {
+	e, err := New("", "Scan {{.filename}}")
+	assert.NoError(t, err)
+	md, err := e.Apply("inbox/doc 1.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, "Scan doc 1", md.Title)
+}
+
+func TestNew(t *testing.T) {
+	e, err := New("", "")
+	assert.NoError(t, err)
+	assert.True(t, e.Empty())
+
+	_, err = New("(", "")
+	assert.Error(t, err)
+	_, err = New("", "{{.title")
+	assert.Error(t, err)
+}
+
+func TestParseDate(t *testing.T) {
+	for _, s := range []string{"2024-03-05", "20240305", "2024_03_05", "05.03.2024"} {
+		date, err := parseDate(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, "2024-03-05", date, s)
+	}
+}
+
+func TestRules(t *testing.T) {
+	e, err := New(`^(?P<created>\d{8})_(?P<title>.+)$`, "")
+	assert.NoError(t, err)
+	assert.NoError(t, e.AddRules([]Rule{
+		{Name: "bank", When: Condition{Sender: "*@BANK.example"}, Then: Action{Correspondent: "Bank", Tags: []string{"finance"}}},
+		{Name: "statements", When: Condition{Filename: "*statement*.pdf", CreatedAfter: "2024-01-01"},
+			Then: Action{DocumentType: "Statement", Tags: []string{"Finance", "statement"}, Title: "{{.correspondent}} {{.title}}"}, Stop: true},
+		{Name: "never", When: Condition{Filename: "*"}, Then: Action{Tags: []string{"late"}}},
+	}))
+
+	md, err := e.ApplyFile(File{Path: "mail/20240305_Statement.pdf", Sender: "noreply@bank.example"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bank", "statements"}, md.Rules)
+	assert.Equal(t, "Bank", md.Correspondent)
+	assert.Equal(t, "Statement", md.DocumentType)
+	assert.Equal(t, []string{"finance", "statement"}, md.Tags)
+	assert.Equal(t, "Bank Statement", md.Title)
+
+	// Conditions on the parsed date don't match files without one.
+	md, err = e.ApplyFile(File{Path: "mail/statement.pdf"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"never"}, md.Rules)
+	assert.Equal(t, []string{"late"}, md.Tags)
+}
+
+func TestConditions(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "phone")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	photo := filepath.Join(dir, "IMG_1.jpg")
+	assert.NoError(t, os.WriteFile(photo, make([]byte, 2048), 0644))
+	scan := filepath.Join(dir, "scan")
+	assert.NoError(t, os.WriteFile(scan, []byte("%PDF-1.4"), 0644))
+
+	for _, tt := range []struct {
+		name string
+		when Condition
+		file File
+		want bool
+	}{
+		{"folder name", Condition{Folder: "phone"}, File{Path: photo}, true},
+		{"folder path", Condition{Folder: "/srv/*"}, File{Path: photo, Folder: "/srv/phone"}, true},
+		{"other folder", Condition{Folder: "scanner"}, File{Path: photo}, false},
+		{"min size", Condition{MinSize: 1024}, File{Path: photo}, true},
+		{"max size", Condition{MaxSize: 1024}, File{Path: photo}, false},
+		{"missing file", Condition{MinSize: 1}, File{Path: filepath.Join(dir, "gone.pdf")}, false},
+		{"mime type by extension", Condition{MimeType: "image/*"}, File{Path: photo}, true},
+		{"mime type by content", Condition{MimeType: "application/pdf"}, File{Path: scan}, true},
+		{"remote", Condition{Remote: "invoices/*"}, File{Path: scan, Remote: "invoices/a.pdf"}, true},
+		{"no remote", Condition{Remote: "*"}, File{Path: scan}, false},
+	} {
+		e, err := New("", "")
+		assert.NoError(t, err)
+		assert.NoError(t, e.AddRules([]Rule{{Name: tt.name, When: tt.when, Then: Action{PostUploadAction: "keep"}}}))
+		assert.True(t, e.SetsPostUploadAction())
+		md, err := e.ApplyFile(tt.file)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, md.PostUploadAction == "keep", tt.name)
+	}
+}
+
+func TestAddRules(t *testing.T) {
+	for _, r := range []Rule{
+		{When: Condition{Filename: "["}},
+		{When: Condition{CreatedAfter: "2024-13-01"}},
+		{Then: Action{PostUploadAction: "archive"}},
+		{Then: Action{Title: "{{.title"}},
+	} {
+		e, _ := New("", "")
+		assert.Error(t, e.AddRules([]Rule{r}))
+	}
+}
+
+func TestContentRules(t *testing.T) {
+	e, err := New("", "")
+	assert.NoError(t, err)
+	assert.NoError(t, e.AddRules([]Rule{
+		{Name: "iban", When: Condition{Content: `iban:? (?P<iban>DE\d{2}[ \d]+)`}, Then: Action{Correspondent: "Stadtwerke", Title: "Bill {{.iban}}"}},
+	}))
+	assert.True(t, e.MatchesContent())
+
+	// Without an extractor content conditions never match.
+	md, err := e.Apply("bill.pdf")
+	assert.NoError(t, err)
+	assert.Empty(t, md.Rules)
+
+	extracted := 0
+	e.ExtractText(func(path string) (string, error) {
+		extracted++
+		if path == "other.pdf" {
+			return "Invoice", nil
+		}
+		return "Pay to IBAN DE89 3704 0044\n", nil
+	})
+	md, err = e.Apply("bill.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, "Stadtwerke", md.Correspondent)
+	assert.Equal(t, "Bill DE89 3704 0044", md.Title)
+	md, err = e.Apply("other.pdf")
+	assert.NoError(t, err)
+	assert.Empty(t, md.Correspondent)
+	assert.Equal(t, 2, extracted)
+
+	assert.Error(t, e.AddRules([]Rule{{When: Condition{Content: "("}}}))
+}
@@ -0,0 +1,36 @@
+package screenshot
+
+import (
+	"context"
+	"encoding/hex"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultFolder returns the desktop, where macOS saves screenshots unless
+// configured otherwise.
+func defaultFolder(home string) string {
+	out, err := exec.Command("defaults", "read", "com.apple.screencapture", "location").Output()
+	if location := strings.TrimSpace(string(out)); err == nil && location != "" {
+		if rest, ok := strings.CutPrefix(location, "~"); ok {
+			return filepath.Join(home, rest)
+		}
+		return location
+	}
+	return filepath.Join(home, "Desktop")
+}
+
+// readClipboard returns the PNG image in the clipboard using AppleScript,
+// which prints it as «data PNGf<hex>».
+func readClipboard(ctx context.Context) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, "osascript", "-e", "the clipboard as «class PNGf»").Output()
+	if err != nil {
+		return nil, errNoImage
+	}
+	data, ok := strings.CutPrefix(strings.TrimSpace(string(out)), "«data PNGf")
+	if !ok {
+		return nil, errNoImage
+	}
+	return hex.DecodeString(strings.TrimSuffix(data, "»"))
+}
@@ -0,0 +1,43 @@
+//go:build !windows && !darwin
+
+package screenshot
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultFolder returns the folder GNOME and KDE save screenshots in,
+// honouring XDG_PICTURES_DIR.
+func defaultFolder(home string) string {
+	pictures := os.Getenv("XDG_PICTURES_DIR")
+	if pictures == "" {
+		pictures = filepath.Join(home, "Pictures")
+	}
+	return filepath.Join(pictures, "Screenshots")
+}
+
+// readClipboard returns the PNG image in the clipboard using wl-paste on
+// Wayland or xclip on X11.
+func readClipboard(ctx context.Context) ([]byte, error) {
+	var list, get *exec.Cmd
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		list = exec.CommandContext(ctx, "wl-paste", "--list-types")
+		get = exec.CommandContext(ctx, "wl-paste", "--type", "image/png")
+	} else {
+		list = exec.CommandContext(ctx, "xclip", "-selection", "clipboard", "-target", "TARGETS", "-out")
+		get = exec.CommandContext(ctx, "xclip", "-selection", "clipboard", "-target", "image/png", "-out")
+	}
+	types, err := list.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, errors.New("reading the clipboard needs wl-paste (Wayland) or xclip (X11)")
+	}
+	if err != nil || !strings.Contains(string(types), "image/png") {
+		return nil, errNoImage
+	}
+	return get.Output()
+}
@@ -0,0 +1,41 @@
+package screenshot
+
+import (
+	"context"
+	"encoding/base64"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// defaultFolder returns the folder Win+PrtScn and the Snipping Tool save
+// screenshots in.
+func defaultFolder(home string) string {
+	return filepath.Join(home, "Pictures", "Screenshots")
+}
+
+// clipboardScript prints the image in the clipboard as base64 encoded PNG,
+// or nothing.
+const clipboardScript = `Add-Type -AssemblyName System.Windows.Forms, System.Drawing
+$img = [System.Windows.Forms.Clipboard]::GetImage()
+if ($img) {
+  $ms = New-Object System.IO.MemoryStream
+  $img.Save($ms, [System.Drawing.Imaging.ImageFormat]::Png)
+  [Convert]::ToBase64String($ms.ToArray())
+}`
+
+// readClipboard returns the PNG image in the clipboard using PowerShell.
+func readClipboard(ctx context.Context) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "powershell.exe", "-NoProfile", "-NonInteractive", "-STA", "-Command", clipboardScript)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	data := strings.TrimSpace(string(out))
+	if data == "" {
+		return nil, errNoImage
+	}
+	return base64.StdEncoding.DecodeString(data)
+}
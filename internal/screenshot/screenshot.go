@@ -0,0 +1,171 @@
+// Package screenshot turns new screenshots and images copied to the
+// clipboard into PDF documents in a watch folder, for filing receipts and
+// confirmations shown on screen.
+package screenshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/fsnotify/fsnotify"
+)
+
+// settleDelay is how long a new screenshot may still be written to.
+const settleDelay = time.Second
+
+// errNoImage is returned by readClipboard when the clipboard holds no
+// image.
+var errNoImage = errors.New("no image in clipboard")
+
+// DeliverFunc stores a converted document under name and returns its path.
+type DeliverFunc func(name string, r io.Reader) (string, error)
+
+// Source converts screenshots and copied images.
+type Source struct {
+	// Folder is the screenshot folder watched for new images. Empty
+	// disables watching it.
+	Folder string
+	// Clipboard polls the clipboard for images every PollInterval.
+	Clipboard    bool
+	PollInterval time.Duration
+	Deliver      DeliverFunc
+
+	// readClipboard returns the image in the clipboard; tests replace it.
+	readClipboard func(ctx context.Context) ([]byte, error)
+}
+
+// DefaultFolder returns the folder the operating system saves screenshots
+// in.
+func DefaultFolder() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return defaultFolder(home), nil
+}
+
+// Run converts new images until ctx is done. Images already in the folder
+// or the clipboard when it starts are left alone.
+func (s *Source) Run(ctx context.Context) error {
+	var fsw *fsnotify.Watcher
+	events := make(chan fsnotify.Event)
+	if s.Folder != "" {
+		var err error
+		if fsw, err = fsnotify.NewWatcher(); err != nil {
+			return err
+		}
+		defer fsw.Close()
+		if err := fsw.Add(s.Folder); err != nil {
+			return err
+		}
+		logging.Infof("Watching screenshot folder %s", s.Folder)
+		events = fsw.Events
+	}
+	var poll <-chan time.Time
+	var last [sha256.Size]byte
+	if s.Clipboard {
+		interval := s.PollInterval
+		if interval <= 0 {
+			interval = 2 * time.Second
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+		if data, err := s.clipboard(ctx); err == nil {
+			last = sha256.Sum256(data)
+		}
+		logging.Infof("Watching the clipboard for images")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case e := <-events:
+			if e.Op&(fsnotify.Create|fsnotify.Rename) != 0 && isImage(e.Name) {
+				path := e.Name
+				time.AfterFunc(settleDelay, func() { s.convertFile(path) })
+			}
+		case <-poll:
+			data, err := s.clipboard(ctx)
+			if err != nil {
+				if !errors.Is(err, errNoImage) && ctx.Err() == nil {
+					logging.Debugf("Failed to read the clipboard: %v", err)
+				}
+				continue
+			}
+			if sum := sha256.Sum256(data); sum != last {
+				last = sum
+				name := "clipboard-" + time.Now().Format("2006-01-02-150405") + ".pdf"
+				s.convert(name, bytes.NewReader(data))
+			}
+		}
+	}
+}
+
+func (s *Source) clipboard(ctx context.Context) ([]byte, error) {
+	if s.readClipboard != nil {
+		return s.readClipboard(ctx)
+	}
+	return readClipboard(ctx)
+}
+
+// convertFile converts the screenshot at path. The screenshot is kept.
+func (s *Source) convertFile(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		// Some tools save under a temporary name first.
+		if !os.IsNotExist(err) {
+			logging.Warnf("Failed to read screenshot %s: %v", path, err)
+		}
+		return
+	}
+	defer f.Close()
+	s.convert(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))+".pdf", f)
+}
+
+// convert stores the image read from r as PDF under name.
+func (s *Source) convert(name string, r io.Reader) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		logging.Warnf("Failed to decode image for %s: %v", name, err)
+		return
+	}
+	var doc bytes.Buffer
+	if err := WritePDF(&doc, img); err != nil {
+		logging.Warnf("Failed to convert %s: %v", name, err)
+		return
+	}
+	dest, err := s.Deliver(name, &doc)
+	if err != nil {
+		logging.Errorf("Failed to store %s: %v", name, err)
+		return
+	}
+	logging.Infof("Converted screenshot to %s", dest)
+}
+
+// isImage reports whether path names an image screenshot tools save,
+// excluding hidden temporary files.
+func isImage(path string) bool {
+	base := filepath.Base(path)
+	if strings.HasPrefix(base, ".") {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(base)) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+		return true
+	}
+	return false
+}
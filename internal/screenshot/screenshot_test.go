@@ -0,0 +1,114 @@
+package screenshot
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPNG(t *testing.T, c color.Color) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	for x := 0; x < 4; x++ {
+		img.Set(x, 0, c)
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestWritePDF(t *testing.T) {
+	img, _, err := image.Decode(bytes.NewReader(testPNG(t, color.NRGBA{R: 255, A: 255})))
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, WritePDF(&buf, img))
+	doc := buf.Bytes()
+	assert.True(t, bytes.HasPrefix(doc, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(doc, []byte("%%EOF\n")))
+	assert.Contains(t, string(doc), "/MediaBox [0 0 3.00 1.50]")
+	assert.Contains(t, string(doc), "/Width 4 /Height 2")
+
+	// The cross-reference table points at the objects.
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(doc, -1)
+	assert.Len(t, offsets, 5)
+	for i, m := range offsets {
+		off, _ := strconv.Atoi(string(m[1]))
+		assert.True(t, bytes.HasPrefix(doc[off:], []byte(strconv.Itoa(i+1)+" 0 obj")), "object %d", i+1)
+	}
+	start := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(doc)
+	off, _ := strconv.Atoi(string(start[1]))
+	assert.True(t, bytes.HasPrefix(doc[off:], []byte("xref\n")))
+
+	assert.Error(t, WritePDF(io.Discard, image.NewRGBA(image.Rectangle{})))
+}
+
+func TestSource(t *testing.T) {
+	folder := t.TempDir()
+	var (
+		mu        sync.Mutex
+		delivered []string
+		clipboard = testPNG(t, color.Black)
+	)
+	s := &Source{
+		Folder:       folder,
+		Clipboard:    true,
+		PollInterval: 10 * time.Millisecond,
+		Deliver: func(name string, r io.Reader) (string, error) {
+			data, _ := io.ReadAll(r)
+			assert.True(t, bytes.HasPrefix(data, []byte("%PDF")))
+			mu.Lock()
+			defer mu.Unlock()
+			delivered = append(delivered, name)
+			return "consume/" + name, nil
+		},
+		readClipboard: func(ctx context.Context) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return clipboard, nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+
+	// The image in the clipboard at startup is not converted, a new one is.
+	mu.Lock()
+	assert.Empty(t, delivered)
+	clipboard = testPNG(t, color.White)
+	mu.Unlock()
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(delivered) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	assert.Regexp(t, `^clipboard-\d{4}-\d\d-\d\d-\d{6}\.pdf$`, delivered[0])
+	mu.Unlock()
+
+	assert.NoError(t, os.WriteFile(filepath.Join(folder, "notes.txt"), []byte("text"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(folder, "Screenshot 2024-03-01.png"), testPNG(t, color.Black), 0644))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(delivered) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, "Screenshot 2024-03-01.pdf", delivered[1])
+	mu.Unlock()
+	assert.FileExists(t, filepath.Join(folder, "Screenshot 2024-03-01.png"), "screenshots are kept")
+
+	cancel()
+	assert.NoError(t, <-done)
+}
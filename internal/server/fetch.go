@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/c-yco/go-paperless-uploader/internal/fetch"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+)
+
+// maxFetchRequest limits the JSON body of a fetch request.
+const maxFetchRequest = 64 << 10
+
+// FetchFunc downloads the document at url, sending header, and stores it
+// with md. It returns the path of the stored document.
+type FetchFunc func(ctx context.Context, url string, header http.Header, md rules.Metadata) (string, error)
+
+// FetchRequest is the JSON body of a fetch request.
+type FetchRequest struct {
+	URL string `json:"url"`
+	// Headers are sent when downloading, e.g. a cookie.
+	Headers map[string]string `json:"headers"`
+	// Username and Password authenticate the download with basic auth.
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	Title         string   `json:"title"`
+	Created       string   `json:"created"`
+	Correspondent string   `json:"correspondent"`
+	DocumentType  string   `json:"document_type"`
+	StoragePath   string   `json:"storage_path"`
+	Tags          []string `json:"tags"`
+	ASN           int      `json:"asn"`
+}
+
+// FetchHandler accepts a FetchRequest with a bearer token and passes the
+// document it references to fetch, for bookmarklets and automations that
+// have a link rather than the file.
+func FetchHandler(token string, download FetchFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+			return
+		}
+		var req FetchRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxFetchRequest)).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if req.URL == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing url"})
+			return
+		}
+		if req.ASN < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid asn"})
+			return
+		}
+		header := http.Header{}
+		for name, value := range req.Headers {
+			header.Set(name, value)
+		}
+		if req.Username != "" || req.Password != "" {
+			basic, _ := http.NewRequest(http.MethodGet, "/", nil)
+			basic.SetBasicAuth(req.Username, req.Password)
+			header.Set("Authorization", basic.Header.Get("Authorization"))
+		}
+		md := rules.Metadata{
+			Title:         req.Title,
+			Created:       req.Created,
+			Correspondent: req.Correspondent,
+			DocumentType:  req.DocumentType,
+			StoragePath:   req.StoragePath,
+			Tags:          req.Tags,
+			ASN:           req.ASN,
+		}
+		dest, err := download(r.Context(), req.URL, header, md)
+		if err != nil {
+			logging.Warnf("Failed to fetch a document for %s: %v", r.RemoteAddr, err)
+			code := http.StatusBadGateway
+			if errors.Is(err, fetch.ErrInvalidURL) {
+				code = http.StatusBadRequest
+			}
+			writeJSON(w, code, map[string]string{"error": err.Error()})
+			return
+		}
+		logging.Infof("Fetched %s for %s", dest, r.RemoteAddr)
+		writeJSON(w, http.StatusAccepted, map[string]any{"received": []string{filepath.Base(dest)}})
+	})
+}
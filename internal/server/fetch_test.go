@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c-yco/go-paperless-uploader/internal/fetch"
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchHandler(t *testing.T) {
+	var (
+		gotURL    string
+		gotHeader http.Header
+		gotMD     rules.Metadata
+	)
+	h := FetchHandler("secret", func(ctx context.Context, url string, header http.Header, md rules.Metadata) (string, error) {
+		if strings.HasPrefix(url, "ftp:") {
+			return "", fmt.Errorf("invalid URL: %w", fetch.ErrInvalidURL)
+		}
+		if strings.HasSuffix(url, "/missing") {
+			return "", fmt.Errorf("status code 404")
+		}
+		gotURL, gotHeader, gotMD = url, header, md
+		return "/consume/invoice.pdf", nil
+	})
+	post := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/fetch", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("wrong", `{"url": "https://shop.example/invoice.pdf"}`).Code)
+
+	rec := post("secret", `{"url": "https://shop.example/invoice.pdf", "headers": {"Cookie": "session=1"},
+		"username": "me", "password": "pw", "title": "Invoice", "tags": ["bills"]}`)
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	var resp map[string][]string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"invoice.pdf"}, resp["received"])
+	assert.Equal(t, "https://shop.example/invoice.pdf", gotURL)
+	assert.Equal(t, "session=1", gotHeader.Get("Cookie"))
+	assert.Equal(t, "Basic bWU6cHc=", gotHeader.Get("Authorization"))
+	assert.Equal(t, rules.Metadata{Title: "Invoice", Tags: []string{"bills"}}, gotMD)
+
+	assert.Equal(t, http.StatusBadRequest, post("secret", `{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, post("secret", `not json`).Code)
+	assert.Equal(t, http.StatusBadRequest, post("secret", `{"url": "ftp://host/a.pdf"}`).Code)
+	assert.Equal(t, http.StatusBadGateway, post("secret", `{"url": "https://shop.example/missing"}`).Code)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// Health tracks whether a watch run is ready to process documents: the
+// watcher is running and Paperless was reachable recently.
+type Health struct {
+	status func() watcher.Status
+	maxAge time.Duration
+
+	mu          sync.Mutex
+	lastContact time.Time
+	lastErr     error
+}
+
+// NewHealth creates a health tracker for the watcher reporting status.
+// Paperless counts as reachable if it was contacted within maxAge.
+func NewHealth(status func() watcher.Status, maxAge time.Duration) *Health {
+	return &Health{status: status, maxAge: maxAge}
+}
+
+// Observe records the outcome of contacting Paperless.
+func (h *Health) Observe(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		h.lastContact = time.Now()
+	}
+	h.lastErr = err
+}
+
+// Monitor calls ping every interval until ctx is cancelled and records the
+// results, so idle instances keep reporting whether Paperless is reachable.
+func (h *Health) Monitor(ctx context.Context, ping func() error, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		h.Observe(ping())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readiness is the body of the /readyz response.
+type readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+func (h *Health) readiness() readiness {
+	r := readiness{Ready: true, Checks: map[string]string{"config": "ok"}}
+	fail := func(check, msg string) {
+		r.Ready = false
+		r.Checks[check] = msg
+	}
+
+	if h.status().Watching {
+		r.Checks["watcher"] = "ok"
+	} else {
+		fail("watcher", "not watching")
+	}
+
+	h.mu.Lock()
+	lastContact, lastErr := h.lastContact, h.lastErr
+	h.mu.Unlock()
+	switch {
+	case !lastContact.IsZero() && time.Since(lastContact) <= h.maxAge:
+		r.Checks["paperless"] = "ok"
+	case lastErr != nil:
+		fail("paperless", fmt.Sprintf("unreachable: %v", lastErr))
+	case lastContact.IsZero():
+		fail("paperless", "not contacted yet")
+	default:
+		fail("paperless", fmt.Sprintf("not reached for %s", time.Since(lastContact).Round(time.Second)))
+	}
+	return r
+}
+
+// Healthz reports that the process is alive.
+func (h *Health) Healthz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+// Readyz reports whether the watch run is ready, answering 503 if not.
+func (h *Health) Readyz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ready := h.readiness()
+		code := http.StatusOK
+		if !ready.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, ready)
+	})
+}
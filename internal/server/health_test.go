@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	watching := false
+	h := NewHealth(func() watcher.Status { return watcher.Status{Watching: watching} }, time.Minute)
+
+	get := func(handler http.Handler) (int, readiness) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		var r readiness
+		json.Unmarshal(rec.Body.Bytes(), &r)
+		return rec.Code, r
+	}
+
+	code, _ := get(h.Healthz())
+	assert.Equal(t, http.StatusOK, code)
+
+	code, r := get(h.Readyz())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, r.Ready)
+	assert.Equal(t, "not watching", r.Checks["watcher"])
+	assert.Equal(t, "not contacted yet", r.Checks["paperless"])
+
+	watching = true
+	h.Observe(nil)
+	code, r = get(h.Readyz())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]string{"config": "ok", "watcher": "ok", "paperless": "ok"}, r.Checks)
+
+	// A failed ping doesn't matter while the last contact is recent enough.
+	h.Observe(errors.New("connection refused"))
+	code, _ = get(h.Readyz())
+	assert.Equal(t, http.StatusOK, code)
+
+	h.lastContact = time.Now().Add(-2 * time.Minute)
+	code, r = get(h.Readyz())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unreachable: connection refused", r.Checks["paperless"])
+}
+
+func TestHealthMonitor(t *testing.T) {
+	h := NewHealth(func() watcher.Status { return watcher.Status{Watching: true} }, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	pings := make(chan struct{}, 10)
+	go h.Monitor(ctx, func() error {
+		pings <- struct{}{}
+		return nil
+	}, time.Millisecond)
+	<-pings
+	<-pings
+	cancel()
+	assert.True(t, h.readiness().Ready)
+}
@@ -0,0 +1,107 @@
+// Package server provides the local HTTP endpoint exposing the runtime state
+// of a running watcher.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// Server is the local status HTTP server.
+type Server struct {
+	mux *http.ServeMux
+	srv *http.Server
+}
+
+// New creates a server listening on addr that reports the status returned by
+// status on /status. A nil status serves only the handlers added with Handle.
+func New(addr string, status func() watcher.Status) *Server {
+	mux := http.NewServeMux()
+	if status != nil {
+		mux.Handle("/status", StatusHandler(status))
+	}
+	return &Server{
+		mux: mux,
+		srv: &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second},
+	}
+}
+
+// StatusHandler serves the status returned by status as JSON.
+func StatusHandler(status func() watcher.Status) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, status())
+	})
+}
+
+// Handle registers an additional handler.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Start listens on the configured address and serves requests in the
+// background. Listen errors are returned immediately.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.srv.Addr, err)
+	}
+	logging.Infof("HTTP endpoint listening on http://%s", ln.Addr())
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logging.Errorf("HTTP endpoint failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// FetchStatus queries the status endpoint of a running instance listening on
+// addr. Wildcard listen addresses are contacted on the loopback interface.
+func FetchStatus(addr string) (*watcher.Status, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("http://%s/status", dialAddr(addr)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach status endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status endpoint returned status code %d", resp.StatusCode)
+	}
+	var status watcher.Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to decode status: %w", err)
+	}
+	return &status, nil
+}
+
+// dialAddr turns a listen address into one that can be dialled locally.
+func dialAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Warnf("Error writing response: %v", err)
+	}
+}
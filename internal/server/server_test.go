@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestStatusEndpoint(t *testing.T) {
+	addr := freeAddr(t)
+	started := time.Now().UTC().Truncate(time.Second)
+	srv := New(addr, func() watcher.Status {
+		return watcher.Status{Watching: true, StartedAt: started, Folders: []watcher.FolderStatus{{Path: "consume"}}}
+	})
+	assert.NoError(t, srv.Start())
+	defer srv.Shutdown(t.Context())
+
+	status, err := FetchStatus(addr)
+	assert.NoError(t, err)
+	assert.True(t, status.Watching)
+	assert.Equal(t, []watcher.FolderStatus{{Path: "consume"}}, status.Folders)
+	assert.True(t, started.Equal(status.StartedAt))
+
+	// Listening twice on the same address fails up front.
+	assert.Error(t, New(addr, nil).Start())
+}
+
+func TestFetchStatusUnreachable(t *testing.T) {
+	_, err := FetchStatus(freeAddr(t))
+	assert.Error(t, err)
+}
+
+func TestDialAddr(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:8765", dialAddr(":8765"))
+	assert.Equal(t, "127.0.0.1:8765", dialAddr("0.0.0.0:8765"))
+	assert.Equal(t, "127.0.0.1:8765", dialAddr("[::]:8765"))
+	assert.Equal(t, "192.168.1.2:8765", dialAddr("192.168.1.2:8765"))
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+)
+
+// maxMemory is the part of an upload request kept in memory; larger files
+// are spooled to disk while the request is parsed.
+const maxMemory = 1 << 20
+
+// DeliverFunc stores a received document with the metadata posted along
+// with it and returns its path.
+type DeliverFunc func(name string, r io.Reader, md rules.Metadata) (string, error)
+
+// UploadHandler accepts documents posted as multipart/form-data with a
+// bearer token. Every file part is passed to deliver together with the
+// fields title, created, correspondent, document_type, storage_path, tags
+// (repeated or comma separated) and asn. Requests larger than maxSize bytes
+// are rejected.
+func UploadHandler(token string, maxSize int64, deliver DeliverFunc) http.Handler {
+	upload := uploadForm(maxSize, deliver)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+			return
+		}
+		upload.ServeHTTP(w, r)
+	})
+}
+
+// uploadForm passes the files of a multipart/form-data request to deliver,
+// as described for UploadHandler, without checking a token.
+func uploadForm(maxSize int64, deliver DeliverFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "request too large"})
+				return
+			}
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid multipart form: " + err.Error()})
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		md, err := formMetadata(r.MultipartForm.Value)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		var files []*multipart.FileHeader
+		for _, field := range slices.Sorted(maps.Keys(r.MultipartForm.File)) {
+			files = append(files, r.MultipartForm.File[field]...)
+		}
+		if len(files) == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "no file in request"})
+			return
+		}
+
+		received := []string{}
+		for _, fh := range files {
+			f, err := fh.Open()
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			dest, err := deliver(fh.Filename, f, md)
+			f.Close()
+			if err != nil {
+				logging.Errorf("Upload receiver failed to store %s: %v", fh.Filename, err)
+				writeJSON(w, http.StatusInternalServerError, map[string]any{"error": "failed to store file", "received": received})
+				return
+			}
+			logging.Infof("Received %s over HTTP from %s", dest, r.RemoteAddr)
+			received = append(received, fh.Filename)
+		}
+		writeJSON(w, http.StatusAccepted, map[string]any{"received": received})
+	})
+}
+
+// formMetadata returns the metadata given in the form values.
+func formMetadata(values map[string][]string) (rules.Metadata, error) {
+	get := func(key string) string {
+		if v := values[key]; len(v) > 0 {
+			return strings.TrimSpace(v[0])
+		}
+		return ""
+	}
+	md := rules.Metadata{
+		Title:         get("title"),
+		Created:       get("created"),
+		Correspondent: get("correspondent"),
+		DocumentType:  get("document_type"),
+		StoragePath:   get("storage_path"),
+	}
+	for _, v := range values["tags"] {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				md.Tags = append(md.Tags, tag)
+			}
+		}
+	}
+	if asn := get("asn"); asn != "" {
+		n, err := strconv.Atoi(asn)
+		if err != nil || n <= 0 {
+			return md, errors.New("invalid asn " + strconv.Quote(asn))
+		}
+		md.ASN = n
+	}
+	return md, nil
+}
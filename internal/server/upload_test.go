@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/stretchr/testify/assert"
+)
+
+func uploadRequest(t *testing.T, token string, fields map[string]string, files map[string]string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		assert.NoError(t, mw.WriteField(k, v))
+	}
+	for name, content := range files {
+		fw, err := mw.CreateFormFile("file", name)
+		assert.NoError(t, err)
+		fw.Write([]byte(content))
+	}
+	assert.NoError(t, mw.Close())
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestUploadHandler(t *testing.T) {
+	type delivery struct {
+		content string
+		md      rules.Metadata
+	}
+	got := map[string]delivery{}
+	h := UploadHandler("secret", 1024, func(name string, r io.Reader, md rules.Metadata) (string, error) {
+		data, err := io.ReadAll(r)
+		got[name] = delivery{string(data), md}
+		return "/consume/" + name, err
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, uploadRequest(t, "wrong", nil, map[string]string{"a.pdf": "%PDF"}))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, got)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, uploadRequest(t, "secret", map[string]string{
+		"title":         "Invoice",
+		"correspondent": "ACME",
+		"tags":          "inbox, bills",
+		"asn":           "42",
+	}, map[string]string{"a.pdf": "%PDF"}))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	var resp struct {
+		Received []string `json:"received"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"a.pdf"}, resp.Received)
+	assert.Equal(t, delivery{"%PDF", rules.Metadata{Title: "Invoice", Correspondent: "ACME", Tags: []string{"inbox", "bills"}, ASN: 42}}, got["a.pdf"])
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, uploadRequest(t, "secret", map[string]string{"asn": "x"}, map[string]string{"b.pdf": "%PDF"}))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, uploadRequest(t, "secret", map[string]string{"title": "no file"}, nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, uploadRequest(t, "secret", nil, map[string]string{"big.pdf": strings.Repeat("x", 2048)}))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.NotContains(t, got, "big.pdf")
+}
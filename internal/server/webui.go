@@ -0,0 +1,264 @@
+package server
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+//go:embed webui/index.html
+var webUIPage []byte
+
+// recentEvents is the number of events a new activity stream starts with.
+const recentEvents = 50
+
+// eventBuffer is the number of events buffered per activity stream. Events
+// are dropped for browsers that fall further behind.
+const eventBuffer = 256
+
+// csrfHeader must be sent with every POST to the web UI. Browsers only send
+// it from other sites after a CORS preflight, which the web UI rejects.
+const csrfHeader = "X-Paperless-Uploader"
+
+// Choices are the metadata offered for uploads, as known to Paperless.
+type Choices struct {
+	Tags           []string `json:"tags"`
+	Correspondents []string `json:"correspondents"`
+	DocumentTypes  []string `json:"document_types"`
+}
+
+// FailedFile is a file in the failed folder as shown by the web UI.
+type FailedFile struct {
+	Name     string    `json:"name"`
+	Folder   string    `json:"folder,omitempty"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// ActivityEvent is a watcher event as streamed to the web UI.
+type ActivityEvent struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	ID         string    `json:"id"`
+	Folder     string    `json:"folder,omitempty"`
+	File       string    `json:"file"`
+	Sent       int64     `json:"sent,omitempty"`
+	Total      int64     `json:"total,omitempty"`
+	DocumentID int       `json:"document_id,omitempty"`
+	URL        string    `json:"url,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// WebUI serves a small web interface to upload documents by drag and drop
+// with metadata chosen from Paperless, follow the activity of the watcher
+// and retry failed files.
+type WebUI struct {
+	// Username and Password enable basic authentication when set.
+	Username, Password string
+	// MaxSize limits the size of an upload request in bytes.
+	MaxSize int64
+	Status  func() watcher.Status
+	// Choices returns the metadata offered for uploads.
+	Choices func() (Choices, error)
+	Deliver DeliverFunc
+	// Failed lists the failed files, and Retry uploads the one named name
+	// again. Both are nil if there is no failed folder.
+	Failed func() ([]FailedFile, error)
+	Retry  func(name string) error
+
+	mu          sync.Mutex
+	recent      []ActivityEvent
+	subscribers map[chan ActivityEvent]bool
+}
+
+// Handle records watcher events for the activity view. It is meant to be
+// registered with Watcher.OnEvent.
+func (u *WebUI) Handle(e watcher.Event) {
+	if e.Type == watcher.EventWatching {
+		return
+	}
+	a := ActivityEvent{
+		Type:       string(e.Type),
+		Time:       e.Time,
+		ID:         e.ID,
+		Folder:     e.Folder,
+		File:       e.Path,
+		Sent:       e.Sent,
+		Total:      e.Total,
+		DocumentID: e.DocumentID,
+		URL:        e.URL,
+	}
+	if e.Err != nil {
+		a.Error = e.Err.Error()
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	// Progress is only streamed live, so the history shows the steps.
+	if e.Type != watcher.EventUploadProgress {
+		u.recent = append(u.recent, a)
+		if len(u.recent) > recentEvents {
+			u.recent = u.recent[len(u.recent)-recentEvents:]
+		}
+	}
+	for ch := range u.subscribers {
+		select {
+		case ch <- a:
+		default:
+		}
+	}
+}
+
+// Handler returns the handler serving the page on / and its API below
+// /api/.
+func (u *WebUI) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+		w.Write(webUIPage)
+	})
+	mux.Handle("GET /api/status", StatusHandler(u.Status))
+	mux.HandleFunc("GET /api/choices", u.serveChoices)
+	mux.HandleFunc("GET /api/events", u.serveEvents)
+	mux.HandleFunc("GET /api/failed", u.serveFailed)
+	mux.Handle("POST /api/upload", u.csrf(uploadForm(u.MaxSize, u.Deliver)))
+	mux.Handle("POST /api/failed/retry", u.csrf(http.HandlerFunc(u.serveRetry)))
+	return u.authenticate(mux)
+}
+
+// authenticate requires the configured credentials, if any.
+func (u *WebUI) authenticate(next http.Handler) http.Handler {
+	if u.Username == "" && u.Password == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(u.Username)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(u.Password)) == 1
+		if !userOK || !passOK {
+			w.Header().Set("WWW-Authenticate", `Basic realm="paperless-uploader", charset="UTF-8"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrf rejects requests without csrfHeader, such as forms posted from other
+// sites with the credentials the browser remembered.
+func (u *WebUI) csrf(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(csrfHeader) == "" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "missing " + csrfHeader + " header"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (u *WebUI) serveChoices(w http.ResponseWriter, r *http.Request) {
+	choices, err := u.Choices()
+	if err != nil {
+		logging.Warnf("Web UI failed to load metadata from Paperless: %v", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, choices)
+}
+
+// serveEvents streams the recent and all following events as server-sent
+// events.
+func (u *WebUI) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming not supported"})
+		return
+	}
+	ch := make(chan ActivityEvent, eventBuffer)
+	u.mu.Lock()
+	for _, a := range u.recent {
+		ch <- a
+	}
+	if u.subscribers == nil {
+		u.subscribers = make(map[chan ActivityEvent]bool)
+	}
+	u.subscribers[ch] = true
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		delete(u.subscribers, ch)
+		u.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case a := <-ch:
+			data, err := json.Marshal(a)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (u *WebUI) serveFailed(w http.ResponseWriter, r *http.Request) {
+	if u.Failed == nil {
+		writeJSON(w, http.StatusOK, []FailedFile{})
+		return
+	}
+	files, err := u.Failed()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	if files == nil {
+		files = []FailedFile{}
+	}
+	writeJSON(w, http.StatusOK, files)
+}
+
+func (u *WebUI) serveRetry(w http.ResponseWriter, r *http.Request) {
+	if u.Retry == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "failed_folder is not configured"})
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || req.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expected {\"name\": \"<file>\"}"})
+		return
+	}
+	if err := u.Retry(req.Name); err != nil {
+		code := http.StatusBadGateway
+		if errors.Is(err, ErrNotFound) {
+			code = http.StatusNotFound
+		}
+		writeJSON(w, code, map[string]string{"error": err.Error()})
+		return
+	}
+	logging.Infof("Retried failed file %s from the web UI", req.Name)
+	writeJSON(w, http.StatusOK, map[string]string{"retried": req.Name})
+}
+
+// ErrNotFound is returned by WebUI.Retry for unknown files.
+var ErrNotFound = errors.New("no such failed file")
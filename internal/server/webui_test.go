@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebUI(t *testing.T) {
+	var delivered []string
+	var retried []string
+	ui := &WebUI{
+		Username: "family",
+		Password: "secret",
+		MaxSize:  1 << 20,
+		Status:   func() watcher.Status { return watcher.Status{Watching: true, QueueDepth: 2} },
+		Choices: func() (Choices, error) {
+			return Choices{Tags: []string{"inbox"}, Correspondents: []string{"ACME"}}, nil
+		},
+		Deliver: func(name string, r io.Reader, md rules.Metadata) (string, error) {
+			data, _ := io.ReadAll(r)
+			delivered = append(delivered, fmt.Sprintf("%s %s %v", name, data, md.Tags))
+			return "consume/" + name, nil
+		},
+		Failed: func() ([]FailedFile, error) {
+			return []FailedFile{{Name: "bad.pdf", Error: "timeout", Attempts: 3}}, nil
+		},
+		Retry: func(name string) error {
+			if name != "bad.pdf" {
+				return fmt.Errorf("%s: %w", name, ErrNotFound)
+			}
+			retried = append(retried, name)
+			return nil
+		},
+	}
+	handler := ui.Handler()
+	serve := func(req *http.Request, auth bool) *httptest.ResponseRecorder {
+		if auth {
+			req.SetBasicAuth("family", "secret")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(httptest.NewRequest("GET", "/", nil), false)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+
+	rec = serve(httptest.NewRequest("GET", "/", nil), true)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<title>Paperless Uploader</title>")
+
+	rec = serve(httptest.NewRequest("GET", "/api/status", nil), true)
+	assert.Contains(t, rec.Body.String(), `"queue_depth":2`)
+	rec = serve(httptest.NewRequest("GET", "/api/choices", nil), true)
+	assert.JSONEq(t, `{"tags": ["inbox"], "correspondents": ["ACME"], "document_types": null}`, rec.Body.String())
+	rec = serve(httptest.NewRequest("GET", "/api/failed", nil), true)
+	assert.JSONEq(t, `[{"name": "bad.pdf", "error": "timeout", "attempts": 3, "failed_at": "0001-01-01T00:00:00Z"}]`, rec.Body.String())
+
+	// POSTs need the header only scripts of the page itself can send.
+	upload := func(csrf bool) *httptest.ResponseRecorder {
+		req := uploadRequest(t, "", map[string]string{"tags": "inbox"}, map[string]string{"scan.pdf": "%PDF"})
+		req.URL.Path = "/api/upload"
+		if csrf {
+			req.Header.Set(csrfHeader, "1")
+		}
+		return serve(req, true)
+	}
+	assert.Equal(t, http.StatusForbidden, upload(false).Code)
+	rec = upload(true)
+	assert.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+	assert.Equal(t, []string{"scan.pdf %PDF [inbox]"}, delivered)
+
+	retry := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/failed/retry", strings.NewReader(`{"name": "`+name+`"}`))
+		req.Header.Set(csrfHeader, "1")
+		return serve(req, true)
+	}
+	assert.Equal(t, http.StatusOK, retry("bad.pdf").Code)
+	assert.Equal(t, http.StatusNotFound, retry("other.pdf").Code)
+	assert.Equal(t, []string{"bad.pdf"}, retried)
+}
+
+func TestWebUIEvents(t *testing.T) {
+	ui := &WebUI{Choices: func() (Choices, error) { return Choices{}, errors.New("unreachable") }}
+	srv := httptest.NewServer(ui.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/choices")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	ui.Handle(watcher.Event{Type: watcher.EventDetected, Time: now, ID: "a", Path: "consume/old.pdf"})
+	ui.Handle(watcher.Event{Type: watcher.EventUploadProgress, Time: now, ID: "a", Path: "consume/old.pdf", Sent: 1})
+
+	resp, err = http.Get(srv.URL + "/api/events")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	lines := bufio.NewScanner(resp.Body)
+	next := func() ActivityEvent {
+		for lines.Scan() {
+			if data, ok := strings.CutPrefix(lines.Text(), "data: "); ok {
+				var a ActivityEvent
+				assert.NoError(t, json.Unmarshal([]byte(data), &a))
+				return a
+			}
+		}
+		t.Fatal("event stream ended")
+		return ActivityEvent{}
+	}
+	// The history leaves out the progress.
+	assert.Equal(t, ActivityEvent{Type: "detected", Time: now, ID: "a", File: "consume/old.pdf"}, next())
+
+	ui.Handle(watcher.Event{Type: watcher.EventUploadFailed, Time: now, ID: "a", Path: "consume/old.pdf", Err: errors.New("timeout")})
+	assert.Equal(t, ActivityEvent{Type: "upload_failed", Time: now, ID: "a", File: "consume/old.pdf", Error: "timeout"}, next())
+}
@@ -0,0 +1,356 @@
+// Package sftpsource downloads new files from a folder on an SFTP server and
+// deletes them remotely, or moves them to a processed folder, once uploaded.
+package sftpsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// dialTimeout bounds connecting and authenticating to the server.
+const dialTimeout = 30 * time.Second
+
+// stat is the size and modification time of a remote file, compared
+// between polls to tell whether the file is still being written.
+type stat struct {
+	size    int64
+	modTime time.Time
+}
+
+// Source offers the files added to a remote folder to a watcher.
+type Source struct {
+	// DryRun only logs the files that would be downloaded and offers
+	// none.
+	DryRun bool
+
+	cfg    config.SFTP
+	folder watcher.Folder
+	addr   string
+	config *ssh.ClientConfig
+	files  chan watcher.File
+	// dir holds the downloads until they were uploaded.
+	dir string
+
+	// connMu guards the connection, which is shared by polling and the
+	// remote moves and deletes after uploads.
+	connMu sync.Mutex
+	conn   *ssh.Client
+	client *sftp.Client
+
+	mu sync.Mutex
+	// downloaded maps the local path of a download to its remote path
+	// until it was uploaded.
+	downloaded map[string]string
+	// seen holds the remote paths downloaded in this run, so that they are
+	// not downloaded again before they were deleted or moved.
+	seen map[string]bool
+	// pending holds the files found by the previous poll that were not
+	// downloaded yet.
+	pending map[string]stat
+}
+
+// New creates a source for cfg. The documents are uploaded with the
+// settings of folder, whose Path is replaced by the remote folder.
+func New(cfg config.SFTP, folder watcher.Folder) (*Source, error) {
+	if cfg.RemotePath == "" {
+		return nil, errors.New("sftp needs remote_path")
+	}
+	auth, err := authMethods(cfg)
+	if err != nil {
+		return nil, err
+	}
+	hostKey, err := hostKeyCallback(cfg)
+	if err != nil {
+		return nil, err
+	}
+	addr := cfg.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	folder.Path = cfg.Host + ":" + cfg.RemotePath
+	return &Source{
+		cfg:    cfg,
+		folder: folder,
+		addr:   addr,
+		files:  make(chan watcher.File),
+		config: &ssh.ClientConfig{
+			User:            cfg.Username,
+			Auth:            auth,
+			HostKeyCallback: hostKey,
+			Timeout:         dialTimeout,
+		},
+		downloaded: make(map[string]string),
+		seen:       make(map[string]bool),
+		pending:    make(map[string]stat),
+	}, nil
+}
+
+// authMethods returns the configured password and key authentication.
+func authMethods(cfg config.SFTP) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	if cfg.PrivateKeyFile != "" {
+		data, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		var signer ssh.Signer
+		if cfg.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(cfg.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key %s: %w", cfg.PrivateKeyFile, err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		methods = append(methods, ssh.Password(cfg.Password))
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("sftp needs password or private_key_file")
+	}
+	return methods, nil
+}
+
+// hostKeyCallback returns the verification of the server's host key.
+func hostKeyCallback(cfg config.SFTP) (ssh.HostKeyCallback, error) {
+	switch {
+	case cfg.KnownHostsFile != "":
+		callback, err := knownhosts.New(cfg.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read known_hosts_file: %w", err)
+		}
+		return callback, nil
+	case cfg.HostKey != "":
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != cfg.HostKey {
+				return fmt.Errorf("host key %s of %s does not match host_key", got, hostname)
+			}
+			return nil
+		}, nil
+	default:
+		return nil, errors.New("sftp needs known_hosts_file or host_key to verify the server")
+	}
+}
+
+// Remote returns the remote path of the downloaded file at local until it
+// was uploaded.
+func (s *Source) Remote(local string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remote, ok := s.downloaded[local]
+	return remote, ok
+}
+
+// Start creates the download directory and begins polling the remote
+// folder.
+func (s *Source) Start(ctx context.Context) error {
+	if !s.DryRun {
+		dir, err := os.MkdirTemp("", "paperless-uploader-sftp-")
+		if err != nil {
+			return err
+		}
+		s.dir = dir
+	}
+	logging.Infof("Watching %s on SFTP server %s", s.cfg.RemotePath, s.cfg.Host)
+	go s.run(ctx)
+	return nil
+}
+
+func (s *Source) Events() <-chan watcher.File {
+	return s.files
+}
+
+// Complete removes the download and, if it was uploaded, deletes or moves
+// the remote file. Failed files stay on the server, but are not downloaded
+// again until the next start.
+func (s *Source) Complete(f watcher.File, err error) {
+	if rmErr := os.Remove(f.Path); rmErr != nil && !os.IsNotExist(rmErr) {
+		logging.Warnf("Failed to remove %s: %v", f.Path, rmErr)
+	}
+	s.mu.Lock()
+	remote, ok := s.downloaded[f.Path]
+	delete(s.downloaded, f.Path)
+	s.mu.Unlock()
+	if !ok || err != nil {
+		return
+	}
+	if err := s.finish(remote); err != nil {
+		logging.Warnf("Failed to clean up %s on the SFTP server: %v", remote, err)
+		return
+	}
+	s.mu.Lock()
+	delete(s.seen, remote)
+	s.mu.Unlock()
+}
+
+// finish deletes remote or moves it to the processed folder.
+func (s *Source) finish(remote string) error {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	if s.cfg.ProcessedPath == "" {
+		err = client.Remove(remote)
+	} else {
+		err = client.PosixRename(remote, path.Join(s.cfg.ProcessedPath, path.Base(remote)))
+	}
+	if err != nil {
+		s.disconnect()
+	}
+	return err
+}
+
+func (s *Source) run(ctx context.Context) {
+	defer close(s.files)
+	defer func() {
+		s.connMu.Lock()
+		s.disconnect()
+		s.connMu.Unlock()
+	}()
+	for {
+		downloads, err := s.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			logging.Errorf("Failed to poll SFTP server %s: %v", s.cfg.Host, err)
+		}
+		for _, local := range downloads {
+			select {
+			case s.files <- watcher.File{Path: local, Folder: s.folder}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if !sleep(ctx, s.cfg.PollInterval) {
+			return
+		}
+	}
+}
+
+// poll lists the remote folder and downloads the files that did not change
+// since the previous poll, so that files still being written are skipped.
+// It returns the local paths of the downloads.
+func (s *Source) poll(ctx context.Context) ([]string, error) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	client, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := client.ReadDir(s.cfg.RemotePath)
+	if err != nil {
+		s.disconnect()
+		return nil, err
+	}
+
+	s.mu.Lock()
+	previous := s.pending
+	s.pending = make(map[string]stat)
+	var ready []string
+	for _, entry := range entries {
+		name := entry.Name()
+		remote := path.Join(s.cfg.RemotePath, name)
+		if !entry.Mode().IsRegular() || strings.HasPrefix(name, ".") || s.seen[remote] {
+			continue
+		}
+		current := stat{size: entry.Size(), modTime: entry.ModTime()}
+		if previous[remote] == current {
+			ready = append(ready, remote)
+		} else {
+			s.pending[remote] = current
+		}
+	}
+	s.mu.Unlock()
+
+	var downloads []string
+	for _, remote := range ready {
+		if ctx.Err() != nil {
+			break
+		}
+		if s.DryRun {
+			s.mu.Lock()
+			s.seen[remote] = true
+			s.mu.Unlock()
+			logging.Infof("[dry-run] Would download %s from SFTP server %s", remote, s.cfg.Host)
+			continue
+		}
+		local, err := s.download(client, remote)
+		if err != nil {
+			logging.Errorf("Failed to download %s from SFTP server %s: %v", remote, s.cfg.Host, err)
+			continue
+		}
+		s.mu.Lock()
+		s.seen[remote] = true
+		s.downloaded[local] = remote
+		s.mu.Unlock()
+		logging.Infof("Downloaded %s from SFTP server %s", remote, s.cfg.Host)
+		downloads = append(downloads, local)
+	}
+	return downloads, nil
+}
+
+func (s *Source) download(client *sftp.Client, remote string) (string, error) {
+	f, err := client.Open(remote)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return watcher.Deliver(s.dir, path.Base(remote), f)
+}
+
+// connect returns the SFTP client, connecting first if necessary. connMu
+// must be held.
+func (s *Source) connect() (*sftp.Client, error) {
+	if s.client != nil {
+		return s.client, nil
+	}
+	conn, err := ssh.Dial("tcp", s.addr, s.config)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.conn, s.client = conn, client
+	return client, nil
+}
+
+// disconnect closes the connection so that the next operation reconnects.
+// connMu must be held.
+func (s *Source) disconnect() {
+	if s.client != nil {
+		s.client.Close()
+		s.conn.Close()
+		s.conn, s.client = nil, nil
+	}
+}
+
+// sleep waits for d and reports whether ctx is still active.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,176 @@
+package sftpsource
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// startServer serves root over SFTP to the user "scanner" with the password
+// "secret" and returns the address and the host key fingerprint.
+func startServer(t *testing.T, root string) (string, string) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.NoError(t, err)
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if c.User() == "scanner" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, assert.AnError
+		},
+	}
+	cfg.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn, cfg, root)
+		}
+	}()
+	return ln.Addr().String(), ssh.FingerprintSHA256(signer.PublicKey())
+}
+
+func serve(conn net.Conn, cfg *ssh.ServerConfig, root string) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					server, _ := sftp.NewServer(ch, sftp.WithServerWorkingDirectory(root))
+					server.Serve()
+					ch.Close()
+				}
+			}
+		}()
+	}
+}
+
+func TestSource(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "outbox"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "done"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "outbox", "a.pdf"), []byte("content of a"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "outbox", "b.pdf"), []byte("content of b"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "outbox", ".upload.tmp"), []byte("partial"), 0644))
+	addr, fingerprint := startServer(t, root)
+
+	s, err := New(config.SFTP{
+		Host:          addr,
+		Username:      "scanner",
+		Password:      "secret",
+		HostKey:       fingerprint,
+		RemotePath:    "outbox",
+		ProcessedPath: "done",
+		PollInterval:  10 * time.Millisecond,
+	}, watcher.Folder{TagNames: []string{"nas"}})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, s.Start(ctx))
+	defer os.RemoveAll(s.dir)
+	files := make(map[string]watcher.File)
+	for len(files) < 2 {
+		select {
+		case f := <-s.Events():
+			files[filepath.Base(f.Path)] = f
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the downloads")
+		}
+	}
+	a, b := files["a.pdf"], files["b.pdf"]
+	assert.Equal(t, addr+":outbox", a.Folder.Path)
+	assert.Equal(t, []string{"nas"}, a.Folder.TagNames)
+	data, err := os.ReadFile(a.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "content of a", string(data))
+	remote, ok := s.Remote(a.Path)
+	assert.True(t, ok)
+	assert.Equal(t, "outbox/a.pdf", remote)
+
+	// Uploaded files are moved, failed ones stay and are not downloaded
+	// again; both downloads are removed.
+	s.Complete(a, nil)
+	s.Complete(b, assert.AnError)
+	assert.FileExists(t, filepath.Join(root, "done", "a.pdf"))
+	assert.NoFileExists(t, filepath.Join(root, "outbox", "a.pdf"))
+	assert.FileExists(t, filepath.Join(root, "outbox", "b.pdf"))
+	assert.NoFileExists(t, a.Path)
+	assert.NoFileExists(t, b.Path)
+	select {
+	case f := <-s.Events():
+		t.Fatalf("unexpected download %s", f.Path)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	for range s.Events() {
+	}
+}
+
+func TestSourceDryRun(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.pdf"), []byte("content of a"), 0644))
+	addr, fingerprint := startServer(t, root)
+
+	s, err := New(config.SFTP{Host: addr, Username: "scanner", Password: "secret", HostKey: fingerprint, RemotePath: "."}, watcher.Folder{})
+	assert.NoError(t, err)
+	s.DryRun = true
+
+	// The second poll finds the file unchanged and would download it.
+	for range 2 {
+		downloads, err := s.poll(context.Background())
+		assert.NoError(t, err)
+		assert.Empty(t, downloads)
+	}
+	assert.True(t, s.seen["a.pdf"])
+	assert.FileExists(t, filepath.Join(root, "a.pdf"))
+}
+
+func TestNewRequiresHostKeyVerification(t *testing.T) {
+	_, err := New(config.SFTP{Host: "nas", Password: "secret", RemotePath: "/outbox"}, watcher.Folder{})
+	assert.ErrorContains(t, err, "known_hosts_file or host_key")
+}
+
+func TestNewRequiresAuthentication(t *testing.T) {
+	_, err := New(config.SFTP{Host: "nas", HostKey: "SHA256:x", RemotePath: "/outbox"}, watcher.Folder{})
+	assert.ErrorContains(t, err, "password or private_key_file")
+}
+
+func TestHostKeyMismatch(t *testing.T) {
+	root := t.TempDir()
+	addr, _ := startServer(t, root)
+	s, err := New(config.SFTP{Host: addr, Username: "scanner", Password: "secret", HostKey: "SHA256:other", RemotePath: "."}, watcher.Folder{})
+	assert.NoError(t, err)
+	_, err = s.poll(context.Background())
+	assert.ErrorContains(t, err, "does not match host_key")
+}
@@ -0,0 +1,164 @@
+// Package simulate runs scenarios of files through the watcher against a
+// fake Paperless, so that folder, rule and profile configurations can be
+// checked without a server or real documents. Scenarios are written in
+// YAML or replayed from an audit log.
+package simulate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+
+	"github.com/c-yco/go-paperless-uploader/internal/audit"
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"go.yaml.in/yaml/v3"
+)
+
+// defaultSize is the size of the files of a scenario that sets neither
+// size nor content.
+const defaultSize = 1024
+
+// Scenario is a sequence of files appearing in the watch folders.
+type Scenario struct {
+	Files []File `yaml:"files" json:"files"`
+}
+
+// File is a file of a scenario and how the fake Paperless treats it.
+type File struct {
+	// Path is where the file appears, inside a configured watch folder.
+	Path string `yaml:"path" json:"path"`
+	// Content is written to the file verbatim. Without it the file gets
+	// Size bytes of content derived from Path, or from Checksum if set, so
+	// files with the same checksum are identical.
+	Content  string `yaml:"content,omitempty" json:"content,omitempty"`
+	Size     string `yaml:"size,omitempty" json:"size,omitempty"`
+	Checksum string `yaml:"checksum,omitempty" json:"checksum,omitempty"`
+	// Text is what content rules see as the text of the file.
+	Text string `yaml:"text,omitempty" json:"text,omitempty"`
+	// Sender and Remote are the origin of the file for rules.
+	Sender string `yaml:"sender,omitempty" json:"sender,omitempty"`
+	Remote string `yaml:"remote,omitempty" json:"remote,omitempty"`
+	// UploadStatus, if set, is the HTTP status every upload of the file is
+	// rejected with, e.g. 500.
+	UploadStatus int `yaml:"upload_status,omitempty" json:"upload_status,omitempty"`
+	// ConsumeError, if set, fails the consumption of the file with it.
+	ConsumeError string `yaml:"consume_error,omitempty" json:"consume_error,omitempty"`
+	// Expect, if set, is checked against the result.
+	Expect *Expect `yaml:"expect,omitempty" json:"expect,omitempty"`
+}
+
+// Expect is the expected result of a file. Only the fields that are set
+// are checked.
+type Expect struct {
+	// Status is the final event of the file, e.g. "consumed",
+	// "upload_failed" or "duplicate".
+	Status        string   `yaml:"status,omitempty" json:"status,omitempty"`
+	Title         string   `yaml:"title,omitempty" json:"title,omitempty"`
+	Created       string   `yaml:"created,omitempty" json:"created,omitempty"`
+	Correspondent string   `yaml:"correspondent,omitempty" json:"correspondent,omitempty"`
+	DocumentType  string   `yaml:"document_type,omitempty" json:"document_type,omitempty"`
+	StoragePath   string   `yaml:"storage_path,omitempty" json:"storage_path,omitempty"`
+	Tags          []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	// Dest is where the file was moved to, or "deleted".
+	Dest string `yaml:"dest,omitempty" json:"dest,omitempty"`
+}
+
+// Load reads a scenario file, or an audit log if the file starts with a
+// JSON object.
+func Load(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return FromAudit(bytes.NewReader(data))
+	}
+	var s Scenario
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %v", path, err)
+	}
+	for i, f := range s.Files {
+		if f.Path == "" {
+			return nil, fmt.Errorf("invalid scenario %s: file #%d has no path", path, i+1)
+		}
+		if f.Size != "" {
+			if _, err := config.ParseSize(f.Size); err != nil {
+				return nil, fmt.Errorf("invalid scenario %s: %s: %v", path, f.Path, err)
+			}
+		}
+	}
+	return &s, nil
+}
+
+// statusCode finds the HTTP status in a recorded upload error.
+var statusCode = regexp.MustCompile(`status code (\d{3})`)
+
+// FromAudit turns the files recorded in an audit log into a scenario, in
+// the order they were detected. Their rejected uploads and failed
+// consumption are replayed by the fake Paperless, and files with the same
+// recorded checksum get the same content.
+func FromAudit(r io.Reader) (*Scenario, error) {
+	var (
+		s     Scenario
+		index = make(map[string]int)
+	)
+	err := audit.Read(r, func(rec audit.Record) {
+		i, ok := index[rec.ID]
+		if !ok {
+			if rec.Event != string(watcher.EventDetected) {
+				return
+			}
+			index[rec.ID] = len(s.Files)
+			s.Files = append(s.Files, File{Path: rec.File})
+			return
+		}
+		f := &s.Files[i]
+		switch watcher.EventType(rec.Event) {
+		case watcher.EventHashed:
+			f.Checksum = rec.SHA256
+		case watcher.EventUploaded:
+			f.Size = strconv.FormatInt(rec.Size, 10)
+		case watcher.EventUploadFailed:
+			f.UploadStatus = 500
+			if m := statusCode.FindStringSubmatch(rec.Error); m != nil {
+				f.UploadStatus, _ = strconv.Atoi(m[1])
+			}
+		case watcher.EventConsumeFailed:
+			f.ConsumeError = rec.Error
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Files) == 0 {
+		return nil, fmt.Errorf("no files recorded in the audit log")
+	}
+	return &s, nil
+}
+
+// content returns the content of the file.
+func (f File) content() []byte {
+	if f.Content != "" {
+		return []byte(f.Content)
+	}
+	size := int64(defaultSize)
+	if f.Size != "" {
+		// The size was checked when loading the scenario.
+		size, _ = config.ParseSize(f.Size)
+	}
+	seed := f.Path
+	if f.Checksum != "" {
+		seed = f.Checksum
+	}
+	// Repeating a hash of the seed keeps the files distinct unless they
+	// share it.
+	sum := sha256.Sum256([]byte(seed))
+	block := []byte(fmt.Sprintf("%x\n", sum))
+	data := bytes.Repeat(block, int(size)/len(block)+1)
+	return data[:size]
+}
@@ -0,0 +1,175 @@
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// Kinds of named objects in Paperless.
+const (
+	KindTag           = "tags"
+	KindCorrespondent = "correspondents"
+	KindDocumentType  = "document_types"
+	KindStoragePath   = "storage_paths"
+)
+
+// Names stands in for the objects defined in Paperless: every name exists
+// and gets an ID on first use.
+type Names struct {
+	mu    sync.Mutex
+	ids   map[string]map[string]int
+	names map[string]map[int]string
+}
+
+// NewNames returns an empty registry.
+func NewNames() *Names {
+	return &Names{ids: make(map[string]map[string]int), names: make(map[string]map[int]string)}
+}
+
+// ID returns the ID of the object of kind named name.
+func (n *Names) ID(kind, name string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if id, ok := n.ids[kind][name]; ok {
+		return id
+	}
+	if n.ids[kind] == nil {
+		n.ids[kind] = make(map[string]int)
+		n.names[kind] = make(map[int]string)
+	}
+	id := len(n.ids[kind]) + 1
+	n.ids[kind][name] = id
+	n.names[kind][id] = name
+	return id
+}
+
+// Name returns the name of the object of kind with the ID id.
+func (n *Names) Name(kind string, id int) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if name, ok := n.names[kind][id]; ok {
+		return name
+	}
+	return "#" + strconv.Itoa(id)
+}
+
+// Upload is the metadata a document was uploaded with, by name.
+type Upload struct {
+	Title         string   `json:"title,omitempty"`
+	Created       string   `json:"created,omitempty"`
+	Correspondent string   `json:"correspondent,omitempty"`
+	DocumentType  string   `json:"document_type,omitempty"`
+	StoragePath   string   `json:"storage_path,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	ASN           int      `json:"asn,omitempty"`
+}
+
+// Server is a fake Paperless accepting uploads. It rejects or fails the
+// files the scenario asks for, identified by their name, and consumes all
+// others at once.
+type Server struct {
+	*httptest.Server
+	names *Names
+
+	mu      sync.Mutex
+	files   map[string]File
+	uploads map[string]Upload
+	failed  map[string]string
+}
+
+// NewServer starts a fake Paperless resolving IDs with names.
+func NewServer(names *Names) *Server {
+	s := &Server{names: names, files: make(map[string]File), uploads: make(map[string]Upload), failed: make(map[string]string)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Expect sets how the files are treated, by their name.
+func (s *Server) Expect(files map[string]File) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files = files
+}
+
+// Upload returns the upload that created the task.
+func (s *Server) Upload(taskID string) (Upload, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[taskID]
+	return u, ok
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/documents/post_document/":
+		s.upload(w, r)
+	case "/api/tasks/":
+		s.mu.Lock()
+		taskID := r.URL.Query().Get("task_id")
+		_, ok := s.uploads[taskID]
+		reason, failed := s.failed[taskID]
+		s.mu.Unlock()
+		switch {
+		case !ok:
+			w.Write([]byte(`[]`))
+		case failed:
+			json.NewEncoder(w).Encode([]map[string]string{{"task_id": taskID, "status": "FAILURE", "result": reason}})
+		default:
+			json.NewEncoder(w).Encode([]map[string]string{{"task_id": taskID, "status": "SUCCESS", "related_document": taskID[len("task-"):]}})
+		}
+	default:
+		w.Write([]byte(`{"results": []}`))
+	}
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	_, header, err := r.FormFile("document")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.files[filepath.Base(header.Filename)]
+	if f.UploadStatus != 0 {
+		http.Error(w, fmt.Sprintf("simulated status %d", f.UploadStatus), f.UploadStatus)
+		return
+	}
+
+	u := Upload{
+		Title:         r.FormValue("title"),
+		Created:       r.FormValue("created"),
+		Correspondent: s.name(KindCorrespondent, r.FormValue("correspondent")),
+		DocumentType:  s.name(KindDocumentType, r.FormValue("document_type")),
+		StoragePath:   s.name(KindStoragePath, r.FormValue("storage_path")),
+	}
+	u.ASN, _ = strconv.Atoi(r.FormValue("archive_serial_number"))
+	for _, id := range r.MultipartForm.Value["tags"] {
+		u.Tags = append(u.Tags, s.name(KindTag, id))
+	}
+	taskID := fmt.Sprintf("task-%d", len(s.uploads)+1)
+	s.uploads[taskID] = u
+	if f.ConsumeError != "" {
+		s.failed[taskID] = f.ConsumeError
+	}
+	json.NewEncoder(w).Encode(taskID)
+}
+
+// name returns the name of the object with the ID in a form value.
+func (s *Server) name(kind, value string) string {
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return value
+	}
+	return s.names.Name(kind, id)
+}
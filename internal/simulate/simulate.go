@@ -0,0 +1,321 @@
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// Folder is a configured watch folder.
+type Folder struct {
+	watcher.Folder
+	// Engine, if set, derives the metadata of the files.
+	Engine *rules.Engine
+}
+
+// Result is what happened to a file of a scenario.
+type Result struct {
+	File string `json:"file"`
+	// Status is the final event of the file, e.g. "consumed".
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Upload is the metadata the document was uploaded with.
+	Upload *Upload `json:"upload,omitempty"`
+	// Dest is where the file was moved to, as configured, or "deleted".
+	Dest string `json:"dest,omitempty"`
+	// Mismatches lists how the result differs from the expected one.
+	Mismatches []string `json:"mismatches,omitempty"`
+}
+
+// StatusNotWatched is the status of a file outside the watch folders.
+const StatusNotWatched = "not_watched"
+
+// Simulator runs scenarios through watchers. The watch, processed and failed
+// folders are mapped into a temporary directory, so the real ones are not
+// touched. Uploads go to a fake Paperless, retries are not delayed and
+// consumption is always tracked.
+type Simulator struct {
+	Folders []Folder
+	// Setup, if set, configures the watcher, e.g. its retries.
+	Setup func(w *watcher.Watcher)
+
+	names  *Names
+	dir    string
+	mapped map[string]string
+	// files holds the file being simulated by its sandbox path.
+	mu    sync.Mutex
+	files map[string]File
+}
+
+// Run runs the scenario and returns the result of every file, in order.
+// The files appear one after the other, each once the previous one is
+// done, so the results do not depend on timing.
+func (s *Simulator) Run(ctx context.Context, scenario *Scenario) ([]Result, error) {
+	dir, err := os.MkdirTemp("", "paperless-uploader-simulate-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	s.dir, s.mapped = dir, make(map[string]string)
+	if s.names == nil {
+		s.names = NewNames()
+	}
+	server := NewServer(s.names)
+	defer server.Close()
+	client := paperless.NewClient(server.URL, "simulated")
+
+	folders := s.sandbox()
+	results := make([]Result, len(scenario.Files))
+	for i, f := range scenario.Files {
+		results[i] = Result{File: f.Path}
+		path, ok := s.mapPath(f.Path)
+		if !ok {
+			results[i].Status = StatusNotWatched
+		} else if err := s.runFile(ctx, client, server, folders, path, f, &results[i]); err != nil {
+			return nil, err
+		}
+		if f.Expect != nil {
+			results[i].Mismatches = f.Expect.check(results[i])
+		}
+	}
+	return results, nil
+}
+
+// runFile creates the file at the sandbox path in the otherwise emptied
+// watch folders and scans them.
+func (s *Simulator) runFile(ctx context.Context, client *paperless.Client, server *Server, folders []watcher.Folder, path string, f File, r *Result) error {
+	for _, folder := range folders {
+		if err := os.RemoveAll(folder.Path); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(folder.Path, 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, f.content(), 0644); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.files = map[string]File{path: f}
+	s.mu.Unlock()
+	server.Expect(map[string]File{filepath.Base(path): f})
+
+	w := watcher.New(client, folders)
+	if s.Setup != nil {
+		s.Setup(w)
+	}
+	w.RetryDelay = time.Millisecond
+	w.TrackConsumption = true
+	var mu sync.Mutex
+	w.OnEvent(func(e watcher.Event) {
+		if e.Path != path {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch e.Type {
+		case watcher.EventMoved:
+			r.Dest = s.unmapPath(e.Dest)
+		case watcher.EventDeleted:
+			r.Dest = "deleted"
+		case watcher.EventUploaded:
+			if u, ok := server.Upload(e.TaskID); ok {
+				r.Upload = &u
+			}
+			r.Status = string(e.Type)
+		case watcher.EventUploadFailed, watcher.EventConsumed, watcher.EventConsumeFailed,
+			watcher.EventVerifyFailed, watcher.EventDuplicate, watcher.EventSpooled:
+			r.Status = string(e.Type)
+			if e.Err != nil {
+				r.Error = e.Err.Error()
+			}
+		}
+	})
+	return w.Scan(ctx)
+}
+
+// sandbox returns the folders with their paths mapped into the sandbox and
+// their metadata derived with the scenario's origins and text.
+func (s *Simulator) sandbox() []watcher.Folder {
+	var folders []watcher.Folder
+	for i, f := range s.Folders {
+		folder := f.Folder
+		configured := folder.Path
+		folder.Path = s.mapDir(configured, filepath.Join("watch", strconv.Itoa(i+1)))
+		folder.SettleDelay = 0
+		folder.Client = nil
+		if folder.ProcessedFolder != "" {
+			folder.ProcessedFolder = s.mapDir(folder.ProcessedFolder, "processed")
+		}
+		if folder.FailedFolder != "" {
+			folder.FailedFolder = s.mapDir(folder.FailedFolder, "failed")
+		}
+		if f.Engine != nil {
+			s.attach(&folder, f.Engine, configured)
+		}
+		folders = append(folders, folder)
+	}
+	return folders
+}
+
+// attach makes folder derive the metadata of its files with engine, as
+// if the folder was at configured.
+func (s *Simulator) attach(folder *watcher.Folder, engine *rules.Engine, configured string) {
+	engine.ExtractText(func(path string) (string, error) {
+		return s.file(path).Text, nil
+	})
+	apply := func(path string) (rules.Metadata, error) {
+		f := s.file(path)
+		return engine.ApplyFile(rules.File{Path: path, Folder: configured, Sender: f.Sender, Remote: f.Remote})
+	}
+	folder.Metadata = func(path string) (paperless.UploadOptions, error) {
+		md, err := apply(path)
+		if err != nil {
+			return paperless.UploadOptions{}, err
+		}
+		opts := paperless.UploadOptions{Title: md.Title, Created: md.Created}
+		if md.ASN > 0 {
+			asn := md.ASN
+			opts.ArchiveSerialNumber = &asn
+		}
+		for _, tag := range md.Tags {
+			opts.Tags = append(opts.Tags, s.names.ID(KindTag, tag))
+		}
+		for _, ref := range []struct {
+			kind, name string
+			dest       **int
+		}{
+			{KindCorrespondent, md.Correspondent, &opts.Correspondent},
+			{KindDocumentType, md.DocumentType, &opts.DocumentType},
+			{KindStoragePath, md.StoragePath, &opts.StoragePath},
+		} {
+			if ref.name != "" {
+				id := s.names.ID(ref.kind, ref.name)
+				*ref.dest = &id
+			}
+		}
+		return opts, nil
+	}
+	if engine.SetsPostUploadAction() {
+		folder.PostUploadActionFor = func(path string) (string, bool) {
+			md, err := apply(path)
+			if err != nil || md.PostUploadAction == "" {
+				return "", false
+			}
+			if md.PostUploadAction == "keep" {
+				return "", true
+			}
+			return md.PostUploadAction, true
+		}
+	}
+}
+
+// TagIDs returns the IDs the simulated Paperless gives the tags. It is
+// meant for the tags of the configured folders.
+func (s *Simulator) TagIDs(names []string) []int {
+	if s.names == nil {
+		s.names = NewNames()
+	}
+	var ids []int
+	for _, name := range names {
+		ids = append(ids, s.names.ID(KindTag, name))
+	}
+	return ids
+}
+
+// file returns the scenario file at the sandbox path.
+func (s *Simulator) file(path string) File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.files[path]
+}
+
+// mapDir maps the configured directory to a directory of the sandbox
+// named after it below parent.
+func (s *Simulator) mapDir(configured, parent string) string {
+	abs, err := filepath.Abs(configured)
+	if err != nil {
+		abs = filepath.Clean(configured)
+	}
+	if dir, ok := s.mapped[abs]; ok {
+		return dir
+	}
+	dir := filepath.Join(s.dir, parent, filepath.Base(abs))
+	s.mapped[abs] = dir
+	return dir
+}
+
+// mapPath maps a path inside a watch folder into the sandbox.
+func (s *Simulator) mapPath(path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	for _, f := range s.Folders {
+		folder, err := filepath.Abs(f.Path)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(folder, abs); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.Join(s.mapped[folder], rel), true
+		}
+	}
+	return "", false
+}
+
+// unmapPath maps a path of the sandbox back to the configured directory.
+func (s *Simulator) unmapPath(path string) string {
+	for configured, dir := range s.mapped {
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.Join(configured, rel)
+		}
+	}
+	return path
+}
+
+// check compares the result with the expectation.
+func (e *Expect) check(r Result) []string {
+	var u Upload
+	if r.Upload != nil {
+		u = *r.Upload
+	}
+	var mismatches []string
+	compare := func(field, want, got string) {
+		if want != "" && want != got {
+			mismatches = append(mismatches, fmt.Sprintf("%s: expected %q, got %q", field, want, got))
+		}
+	}
+	compare("status", e.Status, r.Status)
+	compare("title", e.Title, u.Title)
+	compare("created", e.Created, u.Created)
+	compare("correspondent", e.Correspondent, u.Correspondent)
+	compare("document type", e.DocumentType, u.DocumentType)
+	compare("storage path", e.StoragePath, u.StoragePath)
+	dest := e.Dest
+	if dest != "" && dest != "deleted" {
+		if abs, err := filepath.Abs(dest); err == nil {
+			dest = abs
+		}
+	}
+	compare("dest", dest, r.Dest)
+	if e.Tags != nil {
+		want, got := slices.Sorted(slices.Values(e.Tags)), slices.Sorted(slices.Values(u.Tags))
+		if !slices.Equal(want, got) {
+			mismatches = append(mismatches, fmt.Sprintf("tags: expected %v, got %v", want, got))
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,153 @@
+package simulate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/rules"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+// recentUploads is an in-memory watcher.RecentUploads.
+type recentUploads map[string]string
+
+func (r recentUploads) RecentUpload(checksum string) (string, time.Time, bool) {
+	path, ok := r[checksum]
+	return path, time.Now(), ok
+}
+
+func (r recentUploads) AddRecentUpload(checksum, path string) error {
+	r[checksum] = path
+	return nil
+}
+
+func TestSimulator(t *testing.T) {
+	// The configured folders are never touched.
+	dir := filepath.Join(t.TempDir(), "missing")
+	inbox := filepath.Join(dir, "inbox")
+	processed := filepath.Join(dir, "processed")
+	failed := filepath.Join(dir, "failed")
+
+	engine, err := rules.New(`^(?P<created>\d{4}-\d{2}-\d{2})_(?P<correspondent>[^_]+)_(?P<title>.+)$`, "")
+	assert.NoError(t, err)
+	assert.NoError(t, engine.AddRules([]rules.Rule{
+		{Name: "iban", When: rules.Condition{Content: `DE\d{20}`}, Then: rules.Action{DocumentType: "Invoice", Tags: []string{"bank"}}},
+		{Name: "keep mail", When: rules.Condition{Sender: "*@keep.example"}, Then: rules.Action{PostUploadAction: "keep"}},
+	}))
+	sim := &Simulator{}
+	sim.Folders = []Folder{{
+		Folder: watcher.Folder{
+			Path:             inbox,
+			Tags:             sim.TagIDs([]string{"inbox"}),
+			PostUploadAction: "move",
+			ProcessedFolder:  processed,
+			FailedFolder:     failed,
+		},
+		Engine: engine,
+	}}
+	recent := recentUploads{}
+	sim.Setup = func(w *watcher.Watcher) {
+		w.MaxRetries = 1
+		w.Recent = recent
+	}
+
+	scenario := &Scenario{Files: []File{
+		{
+			Path: filepath.Join(inbox, "2024-03-05_ACME_Power bill.pdf"),
+			Text: "Pay to DE12345678901234567890",
+			Expect: &Expect{
+				Status:        "consumed",
+				Title:         "Power bill",
+				Correspondent: "ACME",
+				DocumentType:  "Invoice",
+				Tags:          []string{"bank", "inbox"},
+				Dest:          filepath.Join(processed, "2024-03-05_ACME_Power bill.pdf"),
+			},
+		},
+		{Path: filepath.Join(inbox, "rejected.pdf"), UploadStatus: 400, Expect: &Expect{Status: "upload_failed", Dest: filepath.Join(failed, "rejected.pdf")}},
+		{Path: filepath.Join(inbox, "corrupt.pdf"), ConsumeError: "not a PDF", Expect: &Expect{Status: "consume_failed"}},
+		{Path: filepath.Join(inbox, "mail.pdf"), Sender: "a@keep.example", Expect: &Expect{Status: "consumed", Dest: "deleted"}},
+		{Path: filepath.Join(inbox, "copy.pdf"), Content: "same", Expect: &Expect{Status: "consumed"}},
+		{Path: filepath.Join(inbox, "copy.pdf"), Content: "same", Expect: &Expect{Status: "duplicate"}},
+		{Path: filepath.Join(dir, "elsewhere", "a.pdf")},
+	}}
+	results, err := sim.Run(context.Background(), scenario)
+	assert.NoError(t, err)
+	assert.Len(t, results, 7)
+
+	assert.Empty(t, results[0].Mismatches)
+	assert.Equal(t, "2024-03-05", results[0].Upload.Created)
+	assert.Empty(t, results[1].Mismatches)
+	assert.Contains(t, results[1].Error, "status code 400")
+	assert.Nil(t, results[1].Upload)
+	assert.Empty(t, results[2].Mismatches)
+	assert.Contains(t, results[2].Error, "not a PDF")
+	assert.Equal(t, []string{`dest: expected "deleted", got ""`}, results[3].Mismatches)
+	assert.Empty(t, results[4].Mismatches)
+	assert.Empty(t, results[5].Mismatches)
+	assert.Equal(t, StatusNotWatched, results[6].Status)
+
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scenario.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+files:
+  - path: /scans/a.pdf
+    size: 2KB
+    upload_status: 503
+    expect:
+      status: upload_failed
+      tags: [inbox]
+`), 0644))
+	s, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []File{{Path: "/scans/a.pdf", Size: "2KB", UploadStatus: 503, Expect: &Expect{Status: "upload_failed", Tags: []string{"inbox"}}}}, s.Files)
+	assert.Len(t, s.Files[0].content(), 2048)
+
+	assert.NoError(t, os.WriteFile(path, []byte("files:\n  - size: 2KB\n"), 0644))
+	_, err = Load(path)
+	assert.ErrorContains(t, err, "file #1 has no path")
+	assert.NoError(t, os.WriteFile(path, []byte("files:\n  - path: a.pdf\n    size: huge\n"), 0644))
+	_, err = Load(path)
+	assert.ErrorContains(t, err, `invalid size "huge"`)
+}
+
+func TestFromAudit(t *testing.T) {
+	log := strings.Join([]string{
+		`{"event": "detected", "id": "1", "file": "/scans/a.pdf"}`,
+		`{"event": "detected", "id": "2", "file": "/scans/b.pdf"}`,
+		`{"event": "hashed", "id": "1", "file": "/scans/a.pdf", "sha256": "abc"}`,
+		`{"event": "uploaded", "id": "1", "file": "/scans/a.pdf", "size": 4096}`,
+		`{"event": "consume_failed", "id": "1", "file": "/scans/a.pdf", "error": "corrupt"}`,
+		`{"event": "upload_failed", "id": "2", "file": "/scans/b.pdf", "error": "failed to upload document: received status code 413, body: "}`,
+		`{"event": "uploaded", "id": "3", "file": "/scans/c.pdf"}`,
+		`not a record`,
+		`{"event": "detected", "id": "4", "file": "/scans/a.pdf"}`,
+		`{"event": "hashed", "id": "4", "file": "/scans/a.pdf", "sha256": "abc"}`,
+		`{"event": "duplicate", "id": "4", "file": "/scans/a.pdf"}`,
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	assert.NoError(t, os.WriteFile(path, []byte(log), 0644))
+	s, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []File{
+		{Path: "/scans/a.pdf", Checksum: "abc", Size: "4096", ConsumeError: "corrupt"},
+		{Path: "/scans/b.pdf", UploadStatus: 413},
+		{Path: "/scans/a.pdf", Checksum: "abc"},
+	}, s.Files)
+	// Files with the same checksum are identical.
+	assert.Equal(t, File{Path: "/x", Checksum: "abc"}.content(), File{Path: "/y", Checksum: "abc"}.content())
+	assert.NotEqual(t, File{Path: "/x"}.content(), File{Path: "/y"}.content())
+
+	_, err = FromAudit(strings.NewReader(`{"event": "uploaded", "id": "3"}`))
+	assert.EqualError(t, err, "no files recorded in the audit log")
+}
@@ -0,0 +1,74 @@
+package smtpd
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+)
+
+// maxDepth limits the nesting of multipart bodies.
+const maxDepth = 10
+
+var wordDecoder = mime.WordDecoder{}
+
+// walkPart calls fn for the part with header h and body, or for the
+// attachments nested in it.
+func walkPart(h textproto.MIMEHeader, body io.Reader, fn func(name string, r io.Reader) error, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxDepth {
+			return errors.New("message nested too deeply")
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkPart(part.Header, part, fn, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	name := fileName(h, params)
+	if name == "" {
+		// The message text rather than an attachment.
+		return nil
+	}
+	return fn(name, decode(h.Get("Content-Transfer-Encoding"), body))
+}
+
+// fileName returns the file name of an attachment from its
+// Content-Disposition header or the name parameter of its Content-Type.
+func fileName(h textproto.MIMEHeader, typeParams map[string]string) string {
+	name := typeParams["name"]
+	if _, params, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = params["filename"]
+	}
+	if decoded, err := wordDecoder.DecodeHeader(name); err == nil {
+		name = decoded
+	}
+	return name
+}
+
+// decode undoes the content transfer encoding of a part.
+func decode(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
@@ -0,0 +1,344 @@
+// Package smtpd implements a minimal SMTP receiver for scanners that can
+// only "scan to email". The attachments of accepted messages are delivered
+// to watched folders, from where they are uploaded.
+package smtpd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+const (
+	// commandTimeout bounds the wait for the next command of a session.
+	commandTimeout = 5 * time.Minute
+	// dataTimeout bounds the transfer of a message.
+	dataTimeout = 10 * time.Minute
+	// maxRecipients limits the recipients of a message.
+	maxRecipients = 100
+)
+
+// Route delivers the attachments of mail from matching senders to a folder.
+type Route struct {
+	// Sender is an address or a pattern such as "*@scanner.lan", compared
+	// case-insensitively.
+	Sender string
+	Folder string
+}
+
+// Server receives mail over SMTP.
+type Server struct {
+	// Addr is the listen address, e.g. ":2525".
+	Addr string
+	// Hostname is announced in the greeting.
+	Hostname string
+	// MaxSize limits the size of a message in bytes.
+	MaxSize int64
+	// Routes are tried in order to find the folder for a sender.
+	Routes []Route
+	// Folder receives the mail of senders without a matching route. Empty
+	// rejects them.
+	Folder string
+	// Delivered, if set, is called with the path and sender of every
+	// attachment stored.
+	Delivered func(path, sender string)
+
+	ln    net.Listener
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+}
+
+// Start listens on the configured address and serves sessions in the
+// background. Listen errors are returned immediately.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.Addr, err)
+	}
+	s.ln = ln
+	s.conns = make(map[net.Conn]bool)
+	logging.Infof("SMTP receiver listening on %s", ln.Addr())
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logging.Errorf("SMTP receiver failed: %v", err)
+				}
+				return
+			}
+			s.track(conn, true)
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer s.track(conn, false)
+				s.serve(conn)
+			}()
+		}
+	}()
+	return nil
+}
+
+// ListenAddr returns the address the server listens on.
+func (s *Server) ListenAddr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Shutdown stops accepting mail, closes open sessions and waits for them
+// to end or ctx to be done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.ln.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return err
+}
+
+func (s *Server) track(conn net.Conn, open bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if open {
+		s.conns[conn] = true
+	} else {
+		delete(s.conns, conn)
+		conn.Close()
+	}
+}
+
+// route returns the folder for mail from sender, or false if the sender is
+// not accepted.
+func (s *Server) route(sender string) (string, bool) {
+	sender = strings.ToLower(sender)
+	for _, r := range s.Routes {
+		if ok, _ := path.Match(strings.ToLower(r.Sender), sender); ok {
+			return r.Folder, true
+		}
+	}
+	return s.Folder, s.Folder != ""
+}
+
+// session is the state of one SMTP conversation.
+type session struct {
+	s      *Server
+	conn   net.Conn
+	tp     *textproto.Conn
+	remote string
+	helo   bool
+	// sender and folder are set by MAIL, recipients by RCPT.
+	sender     string
+	folder     string
+	recipients int
+}
+
+func (s *Server) serve(conn net.Conn) {
+	sess := &session{s: s, conn: conn, tp: textproto.NewConn(conn), remote: conn.RemoteAddr().String()}
+	sess.reply(220, "%s ESMTP paperless-uploader", s.Hostname)
+	for {
+		conn.SetDeadline(time.Now().Add(commandTimeout))
+		line, err := sess.tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		if !sess.handle(strings.ToUpper(verb), strings.TrimSpace(arg)) {
+			return
+		}
+	}
+}
+
+func (sess *session) reply(code int, format string, args ...any) {
+	sess.tp.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+func (sess *session) reset() {
+	sess.sender, sess.folder, sess.recipients = "", "", 0
+}
+
+// handle runs one command and reports whether the session continues.
+func (sess *session) handle(verb, arg string) bool {
+	switch verb {
+	case "HELO":
+		sess.reset()
+		sess.helo = true
+		sess.reply(250, "%s", sess.s.Hostname)
+	case "EHLO":
+		sess.reset()
+		sess.helo = true
+		sess.tp.PrintfLine("250-%s", sess.s.Hostname)
+		sess.tp.PrintfLine("250-SIZE %d", sess.s.MaxSize)
+		sess.tp.PrintfLine("250 8BITMIME")
+	case "MAIL":
+		sess.mail(arg)
+	case "RCPT":
+		switch {
+		case sess.sender == "":
+			sess.reply(503, "5.5.1 MAIL first")
+		case sess.recipients >= maxRecipients:
+			sess.reply(452, "4.5.3 Too many recipients")
+		case !strings.HasPrefix(strings.ToUpper(arg), "TO:"):
+			sess.reply(501, "5.5.4 Syntax: RCPT TO:<address>")
+		default:
+			sess.recipients++
+			sess.reply(250, "2.1.5 OK")
+		}
+	case "DATA":
+		if sess.recipients == 0 {
+			sess.reply(503, "5.5.1 RCPT first")
+			return true
+		}
+		sess.data()
+		sess.reset()
+	case "RSET":
+		sess.reset()
+		sess.reply(250, "2.0.0 OK")
+	case "NOOP":
+		sess.reply(250, "2.0.0 OK")
+	case "VRFY":
+		sess.reply(252, "2.5.2 Cannot verify users")
+	case "QUIT":
+		sess.reply(221, "2.0.0 Bye")
+		return false
+	default:
+		sess.reply(502, "5.5.2 Command not implemented")
+	}
+	return true
+}
+
+// mail starts a transaction for the sender in arg, "FROM:<address>" with
+// optional parameters.
+func (sess *session) mail(arg string) {
+	if !sess.helo {
+		sess.reply(503, "5.5.1 EHLO first")
+		return
+	}
+	if sess.sender != "" {
+		sess.reply(503, "5.5.1 Nested MAIL command")
+		return
+	}
+	if len(arg) < 5 || !strings.EqualFold(arg[:5], "FROM:") {
+		sess.reply(501, "5.5.4 Syntax: MAIL FROM:<address>")
+		return
+	}
+	addr, params, _ := strings.Cut(strings.TrimSpace(arg[5:]), " ")
+	addr = strings.TrimSuffix(strings.TrimPrefix(addr, "<"), ">")
+	if addr == "" {
+		sess.reply(550, "5.7.1 Bounces are not accepted")
+		return
+	}
+	for _, param := range strings.Fields(params) {
+		if v, ok := strings.CutPrefix(strings.ToUpper(param), "SIZE="); ok {
+			if size, err := strconv.ParseInt(v, 10, 64); err == nil && size > sess.s.MaxSize {
+				sess.reply(552, "5.3.4 Message too big")
+				return
+			}
+		}
+	}
+	folder, ok := sess.s.route(addr)
+	if !ok {
+		logging.Warnf("SMTP receiver rejected mail from %s (%s)", addr, sess.remote)
+		sess.reply(550, "5.7.1 Sender not accepted")
+		return
+	}
+	sess.sender, sess.folder = addr, folder
+	sess.reply(250, "2.1.0 OK")
+}
+
+// data receives a message and delivers its attachments.
+func (sess *session) data() {
+	sess.reply(354, "End data with <CR><LF>.<CR><LF>")
+	sess.conn.SetDeadline(time.Now().Add(dataTimeout))
+
+	// The message is spooled to disk so that its attachments are only
+	// delivered once it was received completely.
+	spool, err := os.CreateTemp("", "paperless-uploader-smtp-*")
+	if err != nil {
+		logging.Errorf("SMTP receiver failed to spool message: %v", err)
+		io.Copy(io.Discard, sess.tp.DotReader())
+		sess.reply(451, "4.3.0 Failed to store message")
+		return
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	message := sess.tp.DotReader()
+	n, err := io.Copy(spool, io.LimitReader(message, sess.s.MaxSize+1))
+	if err != nil {
+		return
+	}
+	if n > sess.s.MaxSize {
+		io.Copy(io.Discard, message)
+		sess.reply(552, "5.3.4 Message too big")
+		return
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		sess.reply(451, "4.3.0 Failed to read message")
+		return
+	}
+
+	var delivered []string
+	err = Attachments(spool, func(name string, r io.Reader) error {
+		dest, err := watcher.Deliver(sess.folder, name, r)
+		if err != nil {
+			return err
+		}
+		if sess.s.Delivered != nil {
+			sess.s.Delivered(dest, sess.sender)
+		}
+		delivered = append(delivered, dest)
+		return nil
+	})
+	if err != nil {
+		logging.Errorf("SMTP receiver failed to deliver mail from %s: %v", sess.sender, err)
+		for _, dest := range delivered {
+			os.Remove(dest)
+		}
+		sess.reply(451, "4.3.0 Failed to store attachments")
+		return
+	}
+	if len(delivered) == 0 {
+		logging.Warnf("SMTP receiver got mail without attachments from %s", sess.sender)
+	}
+	for _, dest := range delivered {
+		logging.Infof("Received %s by mail from %s", dest, sess.sender)
+	}
+	sess.reply(250, "2.0.0 OK: %d attachments queued", len(delivered))
+}
+
+// Attachments calls fn with the file name and decoded content of every
+// attachment of the message read from r.
+func Attachments(r io.Reader, fn func(name string, r io.Reader) error) error {
+	msg, err := mail.ReadMessage(bufio.NewReader(r))
+	if err != nil {
+		return fmt.Errorf("invalid message: %w", err)
+	}
+	return walkPart(textproto.MIMEHeader(msg.Header), msg.Body, fn, 0)
+}
@@ -0,0 +1,89 @@
+package smtpd
+
+import (
+	"context"
+	"io"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const scanMail = "From: Scanner <scanner@office.lan>\r\n" +
+	"To: paperless@uploader.lan\r\n" +
+	"Subject: Scan\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"b2\"\r\n" +
+	"\r\n" +
+	"--b2\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Scanned document attached.\r\n" +
+	"--b2--\r\n" +
+	"--b1\r\n" +
+	"Content-Type: application/pdf; name=\"ignored.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"=?UTF-8?Q?Rechnung_M=C3=A4rz.pdf?=\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0x\r\nLjQ=\r\n" +
+	"--b1\r\n" +
+	"Content-Type: image/jpeg; name=\"../page 2.jpg\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"JPEG=3D\r\n" +
+	"--b1--\r\n"
+
+func TestAttachments(t *testing.T) {
+	found := map[string]string{}
+	err := Attachments(strings.NewReader(scanMail), func(name string, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		found[name] = string(data)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Rechnung März.pdf": "%PDF-1.4", "../page 2.jpg": "JPEG="}, found)
+}
+
+func TestServer(t *testing.T) {
+	office, other := t.TempDir(), t.TempDir()
+	s := &Server{
+		Addr:     "127.0.0.1:0",
+		Hostname: "uploader.lan",
+		MaxSize:  4096,
+		Routes:   []Route{{Sender: "*@Office.lan", Folder: office}},
+	}
+	assert.NoError(t, s.Start())
+	defer s.Shutdown(context.Background())
+	addr := s.ListenAddr().String()
+
+	assert.NoError(t, smtp.SendMail(addr, nil, "scanner@office.lan", []string{"paperless@uploader.lan"}, []byte(scanMail)))
+	data, err := os.ReadFile(filepath.Join(office, "Rechnung März.pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "%PDF-1.4", string(data))
+	assert.FileExists(t, filepath.Join(office, "page 2.jpg"))
+
+	// Senders without a route are rejected unless there is a default
+	// folder.
+	err = smtp.SendMail(addr, nil, "someone@example.com", []string{"paperless@uploader.lan"}, []byte(scanMail))
+	assert.ErrorContains(t, err, "550")
+	s.Folder = other
+	assert.NoError(t, smtp.SendMail(addr, nil, "someone@example.com", []string{"paperless@uploader.lan"}, []byte(scanMail)))
+	assert.FileExists(t, filepath.Join(other, "Rechnung März.pdf"))
+
+	// Delivered files don't overwrite earlier ones.
+	assert.NoError(t, smtp.SendMail(addr, nil, "scanner@office.lan", []string{"paperless@uploader.lan"}, []byte(scanMail)))
+	assert.FileExists(t, filepath.Join(office, "Rechnung März-1.pdf"))
+
+	big := scanMail + strings.Repeat("x", 5000)
+	err = smtp.SendMail(addr, nil, "scanner@office.lan", []string{"paperless@uploader.lan"}, []byte(big))
+	assert.ErrorContains(t, err, "552")
+	entries, err := os.ReadDir(office)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
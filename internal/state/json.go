@@ -0,0 +1,110 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// jsonStore keeps the buckets in memory and rewrites the whole file
+// atomically on every change.
+type jsonStore struct {
+	path string
+
+	mu      sync.Mutex
+	buckets map[string]map[string]json.RawMessage
+}
+
+func openJSON(path string) (*jsonStore, error) {
+	s := &jsonStore{path: path, buckets: make(map[string]map[string]json.RawMessage)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.buckets); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+	if s.buckets == nil {
+		s.buckets = make(map[string]map[string]json.RawMessage)
+	}
+	return s, nil
+}
+
+func (s *jsonStore) Get(bucket, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.buckets[bucket][key]
+	return value, ok, nil
+}
+
+func (s *jsonStore) Put(bucket, key string, value []byte) error {
+	if !json.Valid(value) {
+		return fmt.Errorf("value of %s/%s is not JSON", bucket, key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		b = make(map[string]json.RawMessage)
+		s.buckets[bucket] = b
+	}
+	b[key] = append(json.RawMessage(nil), value...)
+	return s.save()
+}
+
+func (s *jsonStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[bucket][key]; !ok {
+		return nil
+	}
+	delete(s.buckets[bucket], key)
+	return s.save()
+}
+
+func (s *jsonStore) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	s.mu.Lock()
+	b := s.buckets[bucket]
+	keys := make([]string, 0, len(b))
+	for key := range b {
+		keys = append(keys, key)
+	}
+	values := make(map[string]json.RawMessage, len(b))
+	for key, value := range b {
+		values[key] = value
+	}
+	s.mu.Unlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(key, values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonStore) Close() error {
+	return nil
+}
+
+// save writes the state file. The caller holds s.mu.
+func (s *jsonStore) save() error {
+	data, err := json.MarshalIndent(s.buckets, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	return nil
+}
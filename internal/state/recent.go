@@ -0,0 +1,68 @@
+package state
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// recentBucket holds the recent uploads by the SHA-256 of their content.
+const recentBucket = "recent_uploads"
+
+// Upload is a recently uploaded file.
+type Upload struct {
+	Path string    `json:"path"`
+	Time time.Time `json:"time"`
+}
+
+// RecentUploads remembers the checksums of the files uploaded within a
+// window in a store.
+type RecentUploads struct {
+	store  Store
+	window time.Duration
+}
+
+// NewRecentUploads remembers uploads in store for window.
+func NewRecentUploads(store Store, window time.Duration) *RecentUploads {
+	return &RecentUploads{store: store, window: window}
+}
+
+// RecentUpload returns the file with the SHA-256 checksum uploaded within
+// the window, if any.
+func (r *RecentUploads) RecentUpload(checksum string) (string, time.Time, bool) {
+	data, ok, err := r.store.Get(recentBucket, checksum)
+	if err != nil || !ok {
+		return "", time.Time{}, false
+	}
+	var u Upload
+	if err := json.Unmarshal(data, &u); err != nil || time.Since(u.Time) > r.window {
+		return "", time.Time{}, false
+	}
+	return u.Path, u.Time, true
+}
+
+// AddRecentUpload records that the file at path with the SHA-256 checksum
+// was uploaded now, forgetting the uploads older than the window.
+func (r *RecentUploads) AddRecentUpload(checksum, path string) error {
+	now := time.Now()
+	var expired []string
+	err := r.store.ForEach(recentBucket, func(key string, value []byte) error {
+		var u Upload
+		if json.Unmarshal(value, &u) != nil || now.Sub(u.Time) > r.window {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range expired {
+		if err := r.store.Delete(recentBucket, key); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(Upload{Path: path, Time: now})
+	if err != nil {
+		return err
+	}
+	return r.store.Put(recentBucket, checksum, data)
+}
@@ -0,0 +1,84 @@
+package state
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS state (
+	bucket TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+);
+`
+
+// sqliteStore keeps all buckets in one table.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func openSQLite(path string) (*sqliteStore, error) {
+	// The busy timeout lets the watcher and a CLI command share the file.
+	db, err := sql.Open("sqlite", "file:"+filepath.ToSlash(path)+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Get(bucket, key string) ([]byte, bool, error) {
+	var value []byte
+	err := s.db.QueryRow(`SELECT value FROM state WHERE bucket = ? AND key = ?`, bucket, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *sqliteStore) Put(bucket, key string, value []byte) error {
+	_, err := s.db.Exec(`INSERT INTO state (bucket, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (bucket, key) DO UPDATE SET value = excluded.value`, bucket, key, value)
+	return err
+}
+
+func (s *sqliteStore) Delete(bucket, key string) error {
+	_, err := s.db.Exec(`DELETE FROM state WHERE bucket = ? AND key = ?`, bucket, key)
+	return err
+}
+
+func (s *sqliteStore) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	rows, err := s.db.Query(`SELECT key, value FROM state WHERE bucket = ? ORDER BY key`, bucket)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			key   string
+			value []byte
+		)
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,63 @@
+// Package state persists what the uploader remembers across restarts, such
+// as the checksums of recently uploaded files and backfill checkpoints, in a
+// Store with a backend chosen to fit the platform.
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Store keeps values under keys grouped in buckets. Values are JSON
+// documents. Implementations are safe for concurrent use.
+type Store interface {
+	// Get returns the value of key in bucket; ok is false if there is none.
+	Get(bucket, key string) (value []byte, ok bool, err error)
+	// Put sets the value of key in bucket.
+	Put(bucket, key string, value []byte) error
+	// Delete removes key from bucket, if present.
+	Delete(bucket, key string) error
+	// ForEach calls fn for the entries of bucket in key order until it
+	// returns an error. fn must not modify the store.
+	ForEach(bucket string, fn func(key string, value []byte) error) error
+	Close() error
+}
+
+// Backends of Open.
+const (
+	// BackendJSON keeps the state in a plain JSON file, rewritten on every
+	// change. It suits small state and is easy to inspect.
+	BackendJSON = "json"
+	// BackendBolt keeps the state in a bbolt database, which only one
+	// process can open at a time.
+	BackendBolt = "bbolt"
+	// BackendSQLite keeps the state in an SQLite database, which the watcher
+	// and CLI commands can share.
+	BackendSQLite = "sqlite"
+)
+
+// Open opens the store of backend at path, creating it and its directory if
+// necessary. An empty backend is BackendJSON.
+func Open(backend, path string) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	switch backend {
+	case "", BackendJSON:
+		return openJSON(path)
+	case BackendBolt:
+		return openBolt(path)
+	case BackendSQLite:
+		return openSQLite(path)
+	}
+	return nil, fmt.Errorf("unknown state backend %q: must be json, bbolt or sqlite", backend)
+}
+
+// FileName returns the name of a store of backend called name.
+func FileName(backend, name string) string {
+	if backend == "" || backend == BackendJSON {
+		return name + ".json"
+	}
+	return name + ".db"
+}
@@ -0,0 +1,88 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStores(t *testing.T) {
+	for _, backend := range []string{BackendJSON, BackendBolt, BackendSQLite} {
+		t.Run(backend, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state", FileName(backend, "state"))
+			s, err := Open(backend, path)
+			assert.NoError(t, err)
+			_, ok, err := s.Get("files", "a")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			assert.NoError(t, s.Put("files", "b", []byte(`{"n":2}`)))
+			assert.NoError(t, s.Put("files", "a", []byte(`{"n":1}`)))
+			assert.NoError(t, s.Put("files", "a", []byte(`{"n":3}`)))
+			assert.NoError(t, s.Put("other", "c", []byte(`{}`)))
+			value, ok, err := s.Get("files", "a")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.JSONEq(t, `{"n":3}`, string(value))
+
+			// The entries survive a restart.
+			assert.NoError(t, s.Close())
+			s, err = Open(backend, path)
+			assert.NoError(t, err)
+			defer s.Close()
+			var keys []string
+			assert.NoError(t, s.ForEach("files", func(key string, value []byte) error {
+				keys = append(keys, key)
+				return nil
+			}))
+			assert.Equal(t, []string{"a", "b"}, keys)
+
+			assert.NoError(t, s.Delete("files", "a"))
+			assert.NoError(t, s.Delete("files", "missing"))
+			assert.NoError(t, s.Delete("missing", "a"))
+			_, ok, err = s.Get("files", "a")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			assert.NoError(t, s.ForEach("missing", func(string, []byte) error { return os.ErrInvalid }))
+		})
+	}
+	_, err := Open("redis", filepath.Join(t.TempDir(), "state"))
+	assert.ErrorContains(t, err, "unknown state backend")
+}
+
+func TestRecentUploads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := Open(BackendJSON, path)
+	assert.NoError(t, err)
+	r := NewRecentUploads(s, time.Hour)
+	_, _, ok := r.RecentUpload("abc")
+	assert.False(t, ok)
+
+	assert.NoError(t, r.AddRecentUpload("abc", "/scans/a.pdf"))
+	file, at, ok := r.RecentUpload("abc")
+	assert.True(t, ok)
+	assert.Equal(t, "/scans/a.pdf", file)
+	assert.WithinDuration(t, time.Now(), at, time.Second)
+
+	// The uploads survive a restart, but only within the window.
+	s, err = Open(BackendJSON, path)
+	assert.NoError(t, err)
+	_, _, ok = NewRecentUploads(s, time.Hour).RecentUpload("abc")
+	assert.True(t, ok)
+	r = NewRecentUploads(s, 0)
+	_, _, ok = r.RecentUpload("abc")
+	assert.False(t, ok)
+
+	// Expired uploads are forgotten on the next change.
+	assert.NoError(t, r.AddRecentUpload("def", "/scans/b.pdf"))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "abc")
+
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+	_, err = Open(BackendJSON, path)
+	assert.ErrorContains(t, err, "invalid state file")
+}
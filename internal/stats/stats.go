@@ -0,0 +1,145 @@
+// Package stats aggregates the upload statistics of each watched folder
+// over an interval, for periodic summary log lines and notifications.
+package stats
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// Folder holds the statistics of one folder.
+type Folder struct {
+	Folder   string
+	Uploaded int
+	Failed   int
+	// Bytes is the size of the uploaded documents.
+	Bytes int64
+	// Latency is the total duration of the successful uploads.
+	Latency time.Duration
+}
+
+// AverageLatency returns the average duration of a successful upload.
+func (f Folder) AverageLatency() time.Duration {
+	if f.Uploaded == 0 {
+		return 0
+	}
+	return (f.Latency / time.Duration(f.Uploaded)).Round(time.Millisecond)
+}
+
+func (f *Folder) add(o Folder) {
+	f.Uploaded += o.Uploaded
+	f.Failed += o.Failed
+	f.Bytes += o.Bytes
+	f.Latency += o.Latency
+}
+
+// Report holds the statistics of an interval.
+type Report struct {
+	Since, Until time.Time
+	// Folders is sorted by path.
+	Folders []Folder
+}
+
+// Total returns the statistics of all folders combined.
+func (r Report) Total() Folder {
+	var total Folder
+	for _, f := range r.Folders {
+		total.add(f)
+	}
+	return total
+}
+
+// Collector accumulates statistics from watcher events.
+type Collector struct {
+	mu      sync.Mutex
+	since   time.Time
+	folders map[string]*Folder
+}
+
+// NewCollector creates a collector. The given folders are always reported,
+// even without activity.
+func NewCollector(folders ...string) *Collector {
+	c := &Collector{since: time.Now(), folders: make(map[string]*Folder)}
+	for _, path := range folders {
+		c.folders[path] = &Folder{Folder: path}
+	}
+	return c
+}
+
+// Handle records e. It is meant to be registered with Watcher.OnEvent.
+func (c *Collector) Handle(e watcher.Event) {
+	if e.Type != watcher.EventUploaded && e.Type != watcher.EventUploadFailed {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.folders[e.Folder]
+	if !ok {
+		f = &Folder{Folder: e.Folder}
+		c.folders[e.Folder] = f
+	}
+	if e.Type == watcher.EventUploaded {
+		f.Uploaded++
+		f.Bytes += e.Total
+		f.Latency += e.Duration
+	} else {
+		f.Failed++
+	}
+}
+
+// Take returns the statistics since the previous call and starts a new
+// interval.
+func (c *Collector) Take() Report {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := Report{Since: c.since, Until: now}
+	for path, f := range c.folders {
+		r.Folders = append(r.Folders, *f)
+		c.folders[path] = &Folder{Folder: path}
+	}
+	c.since = now
+	sort.Slice(r.Folders, func(i, j int) bool { return r.Folders[i].Folder < r.Folders[j].Folder })
+	return r
+}
+
+// Run logs a summary every interval until ctx is done, so that quiet
+// instances still show they are alive.
+func (c *Collector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			Log(logging.Logger(), c.Take())
+		}
+	}
+}
+
+// Log writes one summary line per folder and, for several folders, one for
+// the total.
+func Log(log *slog.Logger, r Report) {
+	period := r.Until.Sub(r.Since).Round(time.Second)
+	line := func(f Folder, attrs ...any) {
+		log.Info("Upload summary", append(attrs,
+			"period", period,
+			"uploaded", f.Uploaded,
+			"failed", f.Failed,
+			"bytes", f.Bytes,
+			"avg_latency", f.AverageLatency())...)
+	}
+	for _, f := range r.Folders {
+		line(f, logging.KeyFolder, f.Folder)
+	}
+	if len(r.Folders) != 1 {
+		line(r.Total())
+	}
+}
@@ -0,0 +1,50 @@
+package stats
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector("inbox", "scanner")
+	c.Handle(watcher.Event{Type: watcher.EventDetected, Folder: "inbox"})
+	c.Handle(watcher.Event{Type: watcher.EventUploaded, Folder: "inbox", Total: 1000, Duration: time.Second})
+	c.Handle(watcher.Event{Type: watcher.EventUploaded, Folder: "inbox", Total: 500, Duration: 2 * time.Second})
+	c.Handle(watcher.Event{Type: watcher.EventUploadFailed, Folder: "other", Err: errors.New("timeout")})
+
+	r := c.Take()
+	assert.Equal(t, []Folder{
+		{Folder: "inbox", Uploaded: 2, Bytes: 1500, Latency: 3 * time.Second},
+		{Folder: "other", Failed: 1},
+		{Folder: "scanner"},
+	}, r.Folders)
+	assert.Equal(t, 1500*time.Millisecond, r.Folders[0].AverageLatency())
+	assert.Zero(t, r.Folders[1].AverageLatency())
+	assert.Equal(t, Folder{Uploaded: 2, Failed: 1, Bytes: 1500, Latency: 3 * time.Second}, r.Total())
+
+	// Taking a report starts a new interval.
+	next := c.Take()
+	assert.Equal(t, r.Until, next.Since)
+	assert.Equal(t, Folder{}, next.Total())
+	assert.Len(t, next.Folders, 3)
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, nil))
+	since := time.Now().Add(-time.Hour)
+	Log(log, Report{Since: since, Until: since.Add(time.Hour), Folders: []Folder{{Folder: "inbox", Uploaded: 2, Bytes: 1500, Latency: 3 * time.Second}}})
+	assert.Contains(t, buf.String(), `msg="Upload summary" folder=inbox period=1h0m0s uploaded=2 failed=0 bytes=1500 avg_latency=1.5s`)
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("\n")))
+
+	buf.Reset()
+	Log(log, Report{Since: since, Until: since.Add(time.Hour), Folders: []Folder{{Folder: "a", Uploaded: 1}, {Folder: "b", Failed: 1}}})
+	assert.Equal(t, 3, bytes.Count(buf.Bytes(), []byte("\n")))
+	assert.Contains(t, buf.String(), `msg="Upload summary" period=1h0m0s uploaded=1 failed=1`)
+}
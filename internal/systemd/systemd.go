@@ -0,0 +1,70 @@
+// Package systemd implements the sd_notify protocol, reporting readiness
+// and watchdog pings to systemd for Type=notify units.
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+)
+
+// Notify sends state, e.g. "READY=1", to the service manager. It reports
+// false without error when not running under systemd.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the watchdog timeout configured with WatchdogSec
+// for this process, or zero if the watchdog is disabled.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog sends WATCHDOG=1 at half the watchdog interval as long as
+// healthy reports true, until ctx is done. systemd restarts the service
+// when the pings stop. It returns immediately if the watchdog is disabled.
+func RunWatchdog(ctx context.Context, healthy func() bool) {
+	interval := WatchdogInterval() / 2
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !healthy() {
+				logging.Warnf("Watcher is not responding; skipping the systemd watchdog ping")
+				continue
+			}
+			if _, err := Notify("WATCHDOG=1"); err != nil {
+				logging.Warnf("Failed to ping the systemd watchdog: %v", err)
+			}
+		}
+	}
+}
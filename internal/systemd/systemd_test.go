@@ -0,0 +1,69 @@
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// listen creates a notification socket and points NOTIFY_SOCKET at it.
+func listen(t *testing.T) *net.UnixConn {
+	if runtime.GOOS == "windows" {
+		t.Skip("unixgram sockets are not supported on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func read(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	assert.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := Notify("READY=1")
+	assert.NoError(t, err)
+	assert.False(t, sent)
+
+	conn := listen(t)
+	sent, err = Notify("READY=1\nSTATUS=Watching")
+	assert.NoError(t, err)
+	assert.True(t, sent)
+	assert.Equal(t, "READY=1\nSTATUS=Watching", read(t, conn))
+}
+
+func TestWatchdog(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	assert.Zero(t, WatchdogInterval())
+	t.Setenv("WATCHDOG_USEC", "20000")
+	t.Setenv("WATCHDOG_PID", "1")
+	if os.Getpid() != 1 {
+		assert.Zero(t, WatchdogInterval())
+	}
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	assert.Equal(t, 20*time.Millisecond, WatchdogInterval())
+
+	conn := listen(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go RunWatchdog(ctx, func() bool { return true })
+	assert.Equal(t, "WATCHDOG=1", read(t, conn))
+	assert.Equal(t, "WATCHDOG=1", read(t, conn))
+}
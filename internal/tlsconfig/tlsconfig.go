@@ -0,0 +1,138 @@
+// Package tlsconfig builds the TLS settings of the connections to
+// Paperless from the configuration.
+package tlsconfig
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+)
+
+// ErrPinMismatch is returned when no certificate of the server matches the
+// configured pins.
+var ErrPinMismatch = errors.New("server certificate does not match the pinned certificates")
+
+// New returns the TLS settings configured by cfg, or nil if the defaults
+// apply.
+func New(cfg config.TLS) (*tls.Config, error) {
+	certPins, err := parsePins(cfg.PinnedCertSHA256, parseHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls.pinned_cert_sha256: %v", err)
+	}
+	spkiPins, err := parsePins(cfg.PinnedSPKISHA256, parseBase64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tls.pinned_spki_sha256: %v", err)
+	}
+	minVersion, err := parseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := parseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	if len(certPins) == 0 && len(spkiPins) == 0 && minVersion == 0 && suites == nil {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: minVersion, CipherSuites: suites}
+	if len(certPins) == 0 && len(spkiPins) == 0 {
+		return tlsConfig, nil
+	}
+	// VerifyConnection runs after the usual verification of the
+	// certificate chain. Only the verified chains count: the server may
+	// send any certificate along, including a pinned one.
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				if certPins[sha256.Sum256(cert.Raw)] || spkiPins[sha256.Sum256(cert.RawSubjectPublicKeyInfo)] {
+					return nil
+				}
+			}
+		}
+		if len(cs.PeerCertificates) == 0 {
+			return ErrPinMismatch
+		}
+		leaf := cs.PeerCertificates[0]
+		spki := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+		return fmt.Errorf("%w: got certificate %x, public key %s", ErrPinMismatch,
+			sha256.Sum256(leaf.Raw), base64.StdEncoding.EncodeToString(spki[:]))
+	}
+	return tlsConfig, nil
+}
+
+// parseVersion returns the TLS version named v, or 0 if it is empty.
+func parseVersion(v string) (uint16, error) {
+	switch v {
+	case "":
+		return 0, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid tls.min_version %q: must be 1.2 or 1.3", v)
+}
+
+// parseCipherSuites returns the IDs of the named cipher suites, or nil if
+// there are none. Only the suites Go considers secure are accepted.
+func parseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]*tls.CipherSuite)
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s
+	}
+	var ids []uint16
+	for _, name := range names {
+		s := known[strings.ToUpper(strings.TrimSpace(name))]
+		if s == nil {
+			return nil, fmt.Errorf("invalid tls.cipher_suites: %q is not a supported secure cipher suite", name)
+		}
+		if !slices.Contains(s.SupportedVersions, tls.VersionTLS12) {
+			return nil, fmt.Errorf("invalid tls.cipher_suites: %s is a TLS 1.3 suite, which cannot be configured", s.Name)
+		}
+		ids = append(ids, s.ID)
+	}
+	return ids, nil
+}
+
+// Transport returns a copy of http.DefaultTransport using tlsConfig.
+func Transport(tlsConfig *tls.Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	return t
+}
+
+// parsePins decodes SHA-256 fingerprints with parse.
+func parsePins(values []string, parse func(string) ([]byte, error)) (map[[sha256.Size]byte]bool, error) {
+	pins := make(map[[sha256.Size]byte]bool)
+	for _, v := range values {
+		b, err := parse(strings.TrimSpace(v))
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("%q is not a SHA-256 fingerprint", v)
+		}
+		pins[[sha256.Size]byte(b)] = true
+	}
+	return pins, nil
+}
+
+// parseHex decodes a hex fingerprint, optionally with colons as printed by
+// "openssl x509 -fingerprint -sha256".
+func parseHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+}
+
+// parseBase64 decodes a base64 fingerprint, optionally prefixed with
+// "sha256/".
+func parseBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.TrimPrefix(s, "sha256/"))
+}
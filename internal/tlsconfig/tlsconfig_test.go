@@ -0,0 +1,129 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinning(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	cert := srv.Certificate()
+	certSum := sha256.Sum256(cert.Raw)
+	spkiSum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	colons := strings.ToUpper(hex.EncodeToString(certSum[:]))
+	var withColons []string
+	for i := 0; i < len(colons); i += 2 {
+		withColons = append(withColons, colons[i:i+2])
+	}
+	other := strings.Repeat("ab", sha256.Size)
+
+	get := func(cfg config.TLS) error {
+		tlsConfig, err := New(cfg)
+		assert.NoError(t, err)
+		pool := x509.NewCertPool()
+		pool.AddCert(cert)
+		tlsConfig.RootCAs = pool
+		resp, err := (&http.Client{Transport: Transport(tlsConfig)}).Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	assert.NoError(t, get(config.TLS{PinnedCertSHA256: []string{other, strings.Join(withColons, ":")}}))
+	assert.NoError(t, get(config.TLS{PinnedSPKISHA256: []string{"sha256/" + base64.StdEncoding.EncodeToString(spkiSum[:])}}))
+	err := get(config.TLS{PinnedCertSHA256: []string{other}})
+	assert.True(t, errors.Is(err, ErrPinMismatch), err)
+	assert.ErrorContains(t, err, hex.EncodeToString(certSum[:]))
+
+	tlsConfig, err := New(config.TLS{})
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+	_, err = New(config.TLS{PinnedCertSHA256: []string{"abcd"}})
+	assert.Error(t, err)
+	_, err = New(config.TLS{PinnedSPKISHA256: []string{"not base64!"}})
+	assert.Error(t, err)
+}
+
+func TestPinningIgnoresUnverifiedCertificates(t *testing.T) {
+	// The server sends the pinned certificate along with its own, which is
+	// trusted but not pinned.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Paperless"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	pinned, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.StartTLS()
+	defer srv.Close()
+	srv.TLS.Certificates[0].Certificate = append(srv.TLS.Certificates[0].Certificate, pinned)
+
+	pinnedSum := sha256.Sum256(pinned)
+	tlsConfig, err := New(config.TLS{PinnedCertSHA256: []string{hex.EncodeToString(pinnedSum[:])}})
+	assert.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	tlsConfig.RootCAs = pool
+	_, err = (&http.Client{Transport: Transport(tlsConfig)}).Get(srv.URL)
+	assert.True(t, errors.Is(err, ErrPinMismatch), err)
+}
+
+func TestPolicy(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{
+		MaxVersion:   tls.VersionTLS12,
+		CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(cfg config.TLS) error {
+		tlsConfig, err := New(cfg)
+		assert.NoError(t, err)
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AddCert(srv.Certificate())
+		resp, err := (&http.Client{Transport: Transport(tlsConfig)}).Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	assert.NoError(t, get(config.TLS{MinVersion: "1.2", CipherSuites: []string{"tls_ecdhe_rsa_with_aes_128_gcm_sha256"}}))
+	assert.Error(t, get(config.TLS{MinVersion: "1.3"}))
+	assert.Error(t, get(config.TLS{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}}))
+
+	tlsConfig, err := New(config.TLS{MinVersion: "1.3"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	assert.Nil(t, tlsConfig.VerifyConnection)
+	for _, cfg := range []config.TLS{
+		{MinVersion: "1.1"},
+		{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{CipherSuites: []string{"TLS_AES_128_GCM_SHA256"}},
+	} {
+		_, err := New(cfg)
+		assert.Error(t, err, cfg)
+	}
+}
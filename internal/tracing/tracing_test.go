@@ -0,0 +1,19 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/c-yco/go-paperless-uploader/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.Tracing{}, "dev")
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	shutdown, err = Setup(context.Background(), config.Tracing{Enabled: true, Endpoint: "127.0.0.1:1", Insecure: true, SampleRatio: 1}, "dev")
+	assert.NoError(t, err)
+	assert.NotNil(t, shutdown)
+}
@@ -0,0 +1,69 @@
+package tray
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"runtime"
+)
+
+// iconSize is the width and height of the tray icon in pixels.
+const iconSize = 32
+
+// icon returns the tray icon in the format the platform expects: ICO on
+// Windows, PNG elsewhere.
+func icon() []byte {
+	data := iconPNG()
+	if runtime.GOOS == "windows" {
+		return wrapICO(data, iconSize)
+	}
+	return data
+}
+
+// iconPNG draws the icon, a page with a folded corner.
+func iconPNG() []byte {
+	var (
+		green = color.RGBA{0x17, 0x54, 0x1f, 0xff}
+		white = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	)
+	img := image.NewRGBA(image.Rect(0, 0, iconSize, iconSize))
+	const left, top, right, bottom, fold = 6, 2, 26, 30, 7
+	for y := top; y < bottom; y++ {
+		for x := left; x < right; x++ {
+			// Cut off the top right corner.
+			if x-(right-fold) > y-top {
+				continue
+			}
+			c := white
+			if x < left+2 || x >= right-2 || y < top+2 || y >= bottom-2 || x-(right-fold) >= y-top-2 {
+				c = green
+			} else if y >= 12 && y < 24 && y%4 < 2 && x >= left+5 && x < right-5 {
+				c = green
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var b bytes.Buffer
+	png.Encode(&b, img)
+	return b.Bytes()
+}
+
+// wrapICO wraps a square PNG image in an ICO container.
+func wrapICO(data []byte, size int) []byte {
+	var b bytes.Buffer
+	// ICONDIR: reserved, type 1 (icon), one image.
+	binary.Write(&b, binary.LittleEndian, [3]uint16{0, 1, 1})
+	// ICONDIRENTRY: width and height (0 means 256), no palette, 1 plane,
+	// 32 bits per pixel, data size and offset.
+	dim := byte(size)
+	if size >= 256 {
+		dim = 0
+	}
+	b.Write([]byte{dim, dim, 0, 0})
+	binary.Write(&b, binary.LittleEndian, [2]uint16{1, 32})
+	binary.Write(&b, binary.LittleEndian, [2]uint32{uint32(len(data)), 6 + 16})
+	b.Write(data)
+	return b.Bytes()
+}
@@ -0,0 +1,93 @@
+package tray
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// maxRecent is the number of uploads listed in the menu.
+const maxRecent = 5
+
+// statusText summarizes s for the menu and the tooltip.
+func statusText(s watcher.Status) string {
+	if !s.Watching {
+		return "Starting…"
+	}
+	var uploaded, failed int
+	for _, f := range s.Folders {
+		uploaded += f.Uploaded
+		failed += f.Failed
+	}
+	state := "Watching"
+	if s.Paused {
+		state = "Paused"
+	} else if s.CircuitOpen {
+		state = "Waiting for Paperless"
+	}
+	text := fmt.Sprintf("%s: %d uploaded, %d failed", state, uploaded, failed)
+	if queued := s.QueueDepth + s.InFlight + s.RetryBacklog + s.Spooled; queued > 0 {
+		text += fmt.Sprintf(", %d pending", queued)
+	}
+	return text
+}
+
+// upload is an entry of the recent uploads list.
+type upload struct {
+	Name string
+	Time time.Time
+	Err  error
+}
+
+// recent holds the latest uploads, newest first.
+type recent struct {
+	mu      sync.Mutex
+	max     int
+	uploads []upload
+}
+
+func newRecent(max int) *recent {
+	return &recent{max: max}
+}
+
+// handle records the outcome of watcher uploads.
+func (r *recent) handle(e watcher.Event) {
+	switch e.Type {
+	case watcher.EventUploaded:
+		r.addAt(filepath.Base(e.Path), nil, e.Time)
+	case watcher.EventUploadFailed:
+		r.addAt(filepath.Base(e.Path), e.Err, e.Time)
+	}
+}
+
+// add records an upload finished now.
+func (r *recent) add(name string, err error) {
+	r.addAt(name, err, time.Now())
+}
+
+func (r *recent) addAt(name string, err error, t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.uploads = append([]upload{{Name: name, Time: t, Err: err}}, r.uploads...)
+	if len(r.uploads) > r.max {
+		r.uploads = r.uploads[:r.max]
+	}
+}
+
+// labels returns the menu titles of the recent uploads.
+func (r *recent) labels() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	labels := make([]string, len(r.uploads))
+	for i, u := range r.uploads {
+		if u.Err != nil {
+			labels[i] = fmt.Sprintf("✗ %s %s: %v", u.Time.Format("15:04"), u.Name, u.Err)
+		} else {
+			labels[i] = fmt.Sprintf("✓ %s %s", u.Time.Format("15:04"), u.Name)
+		}
+	}
+	return labels
+}
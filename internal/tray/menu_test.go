@@ -0,0 +1,61 @@
+package tray
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusText(t *testing.T) {
+	assert.Equal(t, "Starting…", statusText(watcher.Status{}))
+
+	s := watcher.Status{
+		Watching: true,
+		Folders:  []watcher.FolderStatus{{Uploaded: 3, Failed: 1}, {Uploaded: 2}},
+	}
+	assert.Equal(t, "Watching: 5 uploaded, 1 failed", statusText(s))
+
+	s.Paused = true
+	s.QueueDepth = 2
+	s.InFlight = 1
+	assert.Equal(t, "Paused: 5 uploaded, 1 failed, 3 pending", statusText(s))
+}
+
+func TestRecent(t *testing.T) {
+	r := newRecent(2)
+	at := time.Date(2024, 5, 1, 9, 30, 0, 0, time.Local)
+	r.handle(watcher.Event{Type: watcher.EventUploaded, Path: "/scans/a.pdf", Time: at})
+	r.handle(watcher.Event{Type: watcher.EventDetected, Path: "/scans/b.pdf", Time: at})
+	r.handle(watcher.Event{Type: watcher.EventUploadFailed, Path: "/scans/c.pdf", Time: at, Err: errors.New("timeout")})
+	assert.Equal(t, []string{"✗ 09:30 c.pdf: timeout", "✓ 09:30 a.pdf"}, r.labels())
+
+	r.add("d.pdf", nil)
+	labels := r.labels()
+	assert.Len(t, labels, 2)
+	assert.Contains(t, labels[0], "d.pdf")
+	assert.Contains(t, labels[1], "c.pdf")
+}
+
+func TestIcon(t *testing.T) {
+	data := iconPNG()
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, iconSize, img.Bounds().Dx())
+
+	ico := wrapICO(data, iconSize)
+	assert.Equal(t, []byte{0, 0, 1, 0, 1, 0, iconSize, iconSize}, ico[:8])
+	assert.Equal(t, uint32(len(data)), binary.LittleEndian.Uint32(ico[14:]))
+	assert.Equal(t, uint32(22), binary.LittleEndian.Uint32(ico[18:]))
+	assert.Equal(t, data, ico[22:])
+}
+
+func TestSplitPaths(t *testing.T) {
+	assert.Equal(t, []string{`C:\scans\a.pdf`, "/tmp/b c.pdf"}, splitPaths([]byte("C:\\scans\\a.pdf\r\n/tmp/b c.pdf\n\n")))
+	assert.Nil(t, splitPaths(nil))
+}
@@ -0,0 +1,29 @@
+package tray
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// splitPaths returns the non-empty lines of the output of a file dialog.
+func splitPaths(out []byte) []string {
+	var paths []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths
+}
+
+// dialogOutput returns the output of a file dialog command. A dialog that
+// was cancelled exits with status 1 and yields no output.
+func dialogOutput(cmd *exec.Cmd) ([]byte, error) {
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil, nil
+	}
+	return out, err
+}
@@ -0,0 +1,23 @@
+package tray
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+// pickFiles shows a file dialog and returns the chosen files, none if the
+// dialog was cancelled.
+func pickFiles(title string) ([]string, error) {
+	cmd := exec.Command("osascript",
+		"-e", "set chosen to choose file with prompt "+strconv.Quote(title)+" with multiple selections allowed",
+		"-e", `set out to ""`,
+		"-e", "repeat with f in chosen",
+		"-e", "set out to out & POSIX path of f & linefeed",
+		"-e", "end repeat",
+		"-e", "return out")
+	out, err := dialogOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return splitPaths(out), nil
+}
@@ -0,0 +1,26 @@
+//go:build !windows && !darwin
+
+package tray
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// pickFiles shows a file dialog with zenity or kdialog and returns the
+// chosen files, none if the dialog was cancelled.
+func pickFiles(title string) ([]string, error) {
+	var cmd *exec.Cmd
+	if path, err := exec.LookPath("zenity"); err == nil {
+		cmd = exec.Command(path, "--file-selection", "--multiple", "--separator=\n", "--title="+title)
+	} else if path, err := exec.LookPath("kdialog"); err == nil {
+		cmd = exec.Command(path, "--getopenfilename", ".", "--multiple", "--separate-output", "--title", title)
+	} else {
+		return nil, errors.New("no file dialog available: install zenity or kdialog")
+	}
+	out, err := dialogOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return splitPaths(out), nil
+}
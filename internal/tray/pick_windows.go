@@ -0,0 +1,24 @@
+package tray
+
+import (
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// pickFiles shows a file dialog and returns the chosen files, none if the
+// dialog was cancelled.
+func pickFiles(title string) ([]string, error) {
+	script := `Add-Type -AssemblyName System.Windows.Forms
+$d = New-Object System.Windows.Forms.OpenFileDialog
+$d.Multiselect = $true
+$d.Title = '` + strings.ReplaceAll(title, "'", "''") + `'
+if ($d.ShowDialog() -eq 'OK') { $d.FileNames } else { exit 1 }`
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-STA", "-Command", script)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true}
+	out, err := dialogOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return splitPaths(out), nil
+}
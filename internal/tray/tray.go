@@ -0,0 +1,135 @@
+//go:build windows || linux || (darwin && cgo)
+
+// Package tray provides a system tray icon for a running watcher.
+package tray
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"fyne.io/systray"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// refreshInterval is how often the status shown in the menu is updated.
+const refreshInterval = 2 * time.Second
+
+// Run runs w until ctx is cancelled or the user quits from the tray menu.
+// The menu shows the watcher status and the recent uploads, pauses and
+// resumes processing and uploads files picked in a file dialog with upload.
+func Run(ctx context.Context, w *watcher.Watcher, upload func(path string) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	t := &tray{w: w, upload: upload, recent: newRecent(maxRecent)}
+	w.OnEvent(t.recent.handle)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- w.Run(ctx)
+		cancel()
+	}()
+	go func() {
+		<-ctx.Done()
+		systray.Quit()
+	}()
+
+	systray.Run(func() { t.ready(ctx, cancel) }, nil)
+	cancel()
+	return <-errc
+}
+
+type tray struct {
+	w      *watcher.Watcher
+	upload func(path string) error
+	recent *recent
+}
+
+// ready builds the menu and serves it until ctx is cancelled.
+func (t *tray) ready(ctx context.Context, quit func()) {
+	systray.SetIcon(icon())
+	systray.SetTooltip("Paperless Uploader")
+
+	status := systray.AddMenuItem(statusText(t.w.Status()), "")
+	status.Disable()
+	recentMenu := systray.AddMenuItem("Recent uploads", "")
+	recentItems := make([]*systray.MenuItem, maxRecent)
+	for i := range recentItems {
+		recentItems[i] = recentMenu.AddSubMenuItem("", "")
+		recentItems[i].Disable()
+		recentItems[i].Hide()
+	}
+	systray.AddSeparator()
+	pause := systray.AddMenuItemCheckbox("Pause", "Stop starting new uploads", false)
+	uploadItem := systray.AddMenuItem("Upload file…", "Upload files to Paperless")
+	systray.AddSeparator()
+	quitItem := systray.AddMenuItem("Quit", "Stop watching and exit")
+
+	refresh := func() {
+		s := t.w.Status()
+		status.SetTitle(statusText(s))
+		systray.SetTooltip("Paperless Uploader: " + statusText(s))
+		labels := t.recent.labels()
+		if len(labels) == 0 {
+			recentMenu.Disable()
+		} else {
+			recentMenu.Enable()
+		}
+		for i, item := range recentItems {
+			if i < len(labels) {
+				item.SetTitle(labels[i])
+				item.Show()
+			} else {
+				item.Hide()
+			}
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refresh()
+			case <-pause.ClickedCh:
+				if pause.Checked() {
+					t.w.Resume()
+					pause.Uncheck()
+				} else {
+					t.w.Pause()
+					pause.Check()
+				}
+				refresh()
+			case <-uploadItem.ClickedCh:
+				go t.pickAndUpload(refresh)
+			case <-quitItem.ClickedCh:
+				quit()
+				return
+			}
+		}
+	}()
+}
+
+// pickAndUpload uploads the files picked in a file dialog.
+func (t *tray) pickAndUpload(refresh func()) {
+	paths, err := pickFiles("Upload to Paperless")
+	if err != nil {
+		logging.Errorf("Failed to open the file dialog: %v", err)
+		return
+	}
+	for _, path := range paths {
+		err := t.upload(path)
+		if err != nil {
+			logging.Errorf("Failed to upload %s: %v", path, err)
+		} else {
+			logging.Infof("Uploaded %s", path)
+		}
+		t.recent.add(filepath.Base(path), err)
+		refresh()
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows && !linux && !(darwin && cgo)
+
+package tray
+
+import (
+	"context"
+	"errors"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+)
+
+// Run fails: this build cannot show a tray icon.
+func Run(ctx context.Context, w *watcher.Watcher, upload func(path string) error) error {
+	return errors.New("the system tray is not supported by this build")
+}
@@ -0,0 +1,212 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxPickerRows is the number of matches shown at once.
+const maxPickerRows = 12
+
+// ErrAborted is returned by Pick when the user cancels with ctrl+c.
+var ErrAborted = errors.New("aborted")
+
+// Item is an entry offered by Pick.
+type Item struct {
+	ID   int
+	Name string
+}
+
+// Pick shows a fuzzy-searchable list of items and returns the chosen ones.
+// With multi, several items can be toggled with space; otherwise enter picks
+// the highlighted item. Esc skips the choice and returns no items.
+func Pick(title string, items []Item, multi bool) ([]Item, error) {
+	m := newPicker(title, items, multi)
+	result, err := tea.NewProgram(m).Run()
+	if err != nil {
+		return nil, err
+	}
+	m = result.(*picker)
+	if m.aborted {
+		return nil, ErrAborted
+	}
+	return m.chosen, nil
+}
+
+type picker struct {
+	title    string
+	items    []Item
+	multi    bool
+	query    string
+	matches  []Item
+	cursor   int
+	selected map[int]bool
+	chosen   []Item
+	aborted  bool
+	done     bool
+}
+
+func newPicker(title string, items []Item, multi bool) *picker {
+	m := &picker{title: title, items: items, multi: multi, selected: make(map[int]bool)}
+	m.filter()
+	return m
+}
+
+func (m *picker) Init() tea.Cmd {
+	return nil
+}
+
+func (m *picker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	switch key.Type {
+	case tea.KeyCtrlC:
+		m.aborted = true
+		return m, tea.Quit
+	case tea.KeyEsc:
+		m.chosen = nil
+		m.done = true
+		return m, tea.Quit
+	case tea.KeyEnter:
+		m.chosen = m.choice()
+		m.done = true
+		return m, tea.Quit
+	case tea.KeyUp, tea.KeyShiftTab:
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case tea.KeyDown, tea.KeyTab:
+		if m.cursor < len(m.matches)-1 {
+			m.cursor++
+		}
+	case tea.KeySpace:
+		if m.multi && len(m.matches) > 0 {
+			id := m.matches[m.cursor].ID
+			m.selected[id] = !m.selected[id]
+		} else {
+			m.query += " "
+			m.filter()
+		}
+	case tea.KeyBackspace:
+		if m.query != "" {
+			runes := []rune(m.query)
+			m.query = string(runes[:len(runes)-1])
+			m.filter()
+		}
+	case tea.KeyRunes:
+		m.query += string(key.Runes)
+		m.filter()
+	}
+	return m, nil
+}
+
+// choice returns the selected items in list order, or the highlighted item.
+func (m *picker) choice() []Item {
+	var chosen []Item
+	for _, item := range m.items {
+		if m.selected[item.ID] {
+			chosen = append(chosen, item)
+		}
+	}
+	if len(chosen) == 0 && len(m.matches) > 0 {
+		chosen = []Item{m.matches[m.cursor]}
+	}
+	return chosen
+}
+
+func (m *picker) filter() {
+	type scored struct {
+		item  Item
+		score int
+	}
+	var matches []scored
+	for _, item := range m.items {
+		if score, ok := fuzzyScore(m.query, item.Name); ok {
+			matches = append(matches, scored{item, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	m.matches = m.matches[:0]
+	for _, s := range matches {
+		m.matches = append(m.matches, s.item)
+	}
+	if m.cursor >= len(m.matches) {
+		m.cursor = max(len(m.matches)-1, 0)
+	}
+}
+
+func (m *picker) View() string {
+	if m.done || m.aborted {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n", m.title, m.query)
+	start := 0
+	if m.cursor >= maxPickerRows {
+		start = m.cursor - maxPickerRows + 1
+	}
+	for i := start; i < len(m.matches) && i < start+maxPickerRows; i++ {
+		item := m.matches[i]
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		check := ""
+		if m.multi {
+			check = "[ ] "
+			if m.selected[item.ID] {
+				check = "[x] "
+			}
+		}
+		fmt.Fprintf(&b, "%s%s%s\n", cursor, check, item.Name)
+	}
+	if len(m.matches) == 0 {
+		b.WriteString("  (no matches)\n")
+	}
+	if m.multi {
+		b.WriteString("type to search, space: toggle, enter: done, esc: skip\n")
+	} else {
+		b.WriteString("type to search, enter: pick, esc: skip\n")
+	}
+	return b.String()
+}
+
+// fuzzyScore reports whether the characters of query appear in s in order,
+// ignoring case. Higher scores mean consecutive matches and matches at the
+// start of words.
+func fuzzyScore(query, s string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	if len(q) == 0 {
+		return 0, true
+	}
+	runes := []rune(s)
+	score, qi, prev := 0, 0, -2
+	for i, r := range runes {
+		if qi == len(q) {
+			break
+		}
+		if unicode.ToLower(r) != q[qi] {
+			continue
+		}
+		score++
+		if i == prev+1 {
+			score += 3
+		}
+		if i == 0 || !unicode.IsLetter(runes[i-1]) {
+			score += 2
+		}
+		prev = i
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	return score - len(runes)/10, true
+}
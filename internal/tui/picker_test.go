@@ -0,0 +1,47 @@
+package tui
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	_, ok := fuzzyScore("inv", "Invoice")
+	assert.True(t, ok)
+	_, ok = fuzzyScore("ivc", "Invoice")
+	assert.True(t, ok)
+	_, ok = fuzzyScore("xyz", "Invoice")
+	assert.False(t, ok)
+
+	prefix, _ := fuzzyScore("inv", "Invoice")
+	scattered, _ := fuzzyScore("inv", "Insurance overview")
+	assert.Greater(t, prefix, scattered)
+}
+
+func TestPicker(t *testing.T) {
+	items := []Item{{1, "Insurance"}, {2, "Invoice"}, {3, "Receipt"}}
+
+	m := newPicker("Tags", items, true)
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("in")})
+	assert.Equal(t, []Item{{1, "Insurance"}, {2, "Invoice"}}, m.matches)
+	assert.Contains(t, m.View(), "> [ ] Insurance")
+
+	m.Update(tea.KeyMsg{Type: tea.KeySpace})
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m.Update(tea.KeyMsg{Type: tea.KeySpace})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.Equal(t, []Item{{1, "Insurance"}, {2, "Invoice"}}, m.chosen)
+
+	// Single choice picks the highlighted item; esc skips.
+	m = newPicker("Correspondent", items, false)
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("rec")})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.Equal(t, []Item{{3, "Receipt"}}, m.chosen)
+
+	m = newPicker("Correspondent", items, false)
+	m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.Empty(t, m.chosen)
+	assert.False(t, m.aborted)
+}
@@ -0,0 +1,235 @@
+// Package tui provides a terminal dashboard for a running watcher.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	maxEvents = 10
+	maxErrors = 5
+	maxLogs   = 5
+	barWidth  = 30
+)
+
+type (
+	eventMsg watcher.Event
+	logMsg   string
+	tickMsg  time.Time
+	doneMsg  struct{ err error }
+)
+
+// Run runs w until ctx is cancelled or the user quits, showing live file
+// events, upload progress, queue depth, recent errors and per-folder
+// statistics. Log output is shown in the dashboard while it runs.
+func Run(ctx context.Context, w *watcher.Watcher) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := tea.NewProgram(newModel(w.Status), tea.WithAltScreen())
+	w.OnEvent(func(e watcher.Event) { p.Send(eventMsg(e)) })
+
+	prevOutput := logging.SetOutput(logWriter{p})
+	defer logging.SetOutput(prevOutput)
+
+	errc := make(chan error, 1)
+	go func() {
+		err := w.Run(ctx)
+		errc <- err
+		p.Send(doneMsg{err})
+	}()
+	go func() {
+		<-ctx.Done()
+		p.Quit()
+	}()
+
+	_, err := p.Run()
+	cancel()
+	if runErr := <-errc; runErr != nil {
+		return runErr
+	}
+	return err
+}
+
+// logWriter forwards log output to the dashboard.
+type logWriter struct {
+	p *tea.Program
+}
+
+func (l logWriter) Write(b []byte) (int, error) {
+	l.p.Send(logMsg(strings.TrimRight(string(b), "\n")))
+	return len(b), nil
+}
+
+// upload is an upload in progress.
+type upload struct {
+	path        string
+	sent, total int64
+}
+
+type model struct {
+	statusFunc func() watcher.Status
+	status     watcher.Status
+	uploads    []*upload
+	events     []string
+	errors     []string
+	logs       []string
+	err        error
+}
+
+func newModel(status func() watcher.Status) *model {
+	return &model{statusFunc: status, status: status()}
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg { return tickMsg(t) })
+}
+
+func (m *model) Init() tea.Cmd {
+	return tick()
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c", "esc":
+			return m, tea.Quit
+		}
+	case tickMsg:
+		m.status = m.statusFunc()
+		return m, tick()
+	case eventMsg:
+		m.handleEvent(watcher.Event(msg))
+		m.status = m.statusFunc()
+	case logMsg:
+		m.logs = appendLimited(m.logs, string(msg), maxLogs)
+	case doneMsg:
+		m.err = msg.err
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func (m *model) handleEvent(e watcher.Event) {
+	if e.Type == watcher.EventUploadProgress {
+		u := m.upload(e.Path)
+		u.sent, u.total = e.Sent, e.Total
+		return
+	}
+
+	line := fmt.Sprintf("%s  %-15s  %s", e.Time.Format("15:04:05"), e.Type, e.Path)
+	m.events = appendLimited(m.events, line, maxEvents)
+	switch e.Type {
+	case watcher.EventUploadStarted:
+		u := m.upload(e.Path)
+		u.sent, u.total = 0, 0
+	case watcher.EventUploaded, watcher.EventRetryScheduled, watcher.EventUploadFailed:
+		m.removeUpload(e.Path)
+	}
+	if e.Err != nil {
+		m.errors = appendLimited(m.errors, fmt.Sprintf("%s  %s: %v", e.Time.Format("15:04:05"), filepath.Base(e.Path), e.Err), maxErrors)
+	}
+}
+
+func (m *model) upload(path string) *upload {
+	for _, u := range m.uploads {
+		if u.path == path {
+			return u
+		}
+	}
+	u := &upload{path: path}
+	m.uploads = append(m.uploads, u)
+	return u
+}
+
+func (m *model) removeUpload(path string) {
+	for i, u := range m.uploads {
+		if u.path == path {
+			m.uploads = append(m.uploads[:i], m.uploads[i+1:]...)
+			return
+		}
+	}
+}
+
+func appendLimited(lines []string, line string, limit int) []string {
+	lines = append(lines, line)
+	if len(lines) > limit {
+		lines = lines[len(lines)-limit:]
+	}
+	return lines
+}
+
+func (m *model) View() string {
+	var b strings.Builder
+	status := m.status
+
+	if status.Watching {
+		fmt.Fprintf(&b, "paperless-uploader: watching %d folder(s), up %s\n", len(status.Folders), time.Since(status.StartedAt).Round(time.Second))
+	} else {
+		fmt.Fprintln(&b, "paperless-uploader: starting...")
+	}
+	fmt.Fprintf(&b, "Queue: %d   In flight: %d   Retry backlog: %d\n", status.QueueDepth, status.InFlight, status.RetryBacklog)
+
+	b.WriteString("\nUploads\n")
+	if len(m.uploads) == 0 {
+		b.WriteString("  (idle)\n")
+	}
+	for _, u := range m.uploads {
+		fmt.Fprintf(&b, "  %s %s\n", progressBar(u.sent, u.total), filepath.Base(u.path))
+	}
+
+	b.WriteString("\nFolders\n")
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  FOLDER\tUPLOADED\tFAILED\tLAST SUCCESS\tLAST FAILURE")
+	for _, f := range status.Folders {
+		fmt.Fprintf(tw, "  %s\t%d\t%d\t%s\t%s\n", f.Path, f.Uploaded, f.Failed, clock(f.LastSuccess), clock(f.LastFailure))
+	}
+	tw.Flush()
+
+	section(&b, "Recent events", m.events)
+	section(&b, "Recent errors", m.errors)
+	section(&b, "Log", m.logs)
+
+	if m.err != nil {
+		fmt.Fprintf(&b, "\nError: %v\n", m.err)
+	}
+	b.WriteString("\nq: quit\n")
+	return b.String()
+}
+
+func section(b *strings.Builder, title string, lines []string) {
+	fmt.Fprintf(b, "\n%s\n", title)
+	if len(lines) == 0 {
+		b.WriteString("  (none)\n")
+	}
+	for _, line := range lines {
+		fmt.Fprintf(b, "  %s\n", line)
+	}
+}
+
+// progressBar renders a fixed width progress bar followed by the percentage.
+func progressBar(sent, total int64) string {
+	percent := 0.0
+	if total > 0 {
+		percent = float64(sent) / float64(total)
+	}
+	filled := int(percent * barWidth)
+	return fmt.Sprintf("[%s%s] %3.0f%%", strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), percent*100)
+}
+
+func clock(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("15:04:05")
+}
@@ -0,0 +1,47 @@
+package tui
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/watcher"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModel(t *testing.T) {
+	status := watcher.Status{
+		Watching:   true,
+		StartedAt:  time.Now(),
+		QueueDepth: 2,
+		Folders:    []watcher.FolderStatus{{Path: "consume", Uploaded: 4, Failed: 1}},
+	}
+	m := newModel(func() watcher.Status { return status })
+	now := time.Now()
+
+	m.Update(eventMsg{Type: watcher.EventDetected, Time: now, Path: "consume/a.pdf"})
+	m.Update(eventMsg{Type: watcher.EventUploadStarted, Time: now, Path: "consume/a.pdf"})
+	m.Update(eventMsg{Type: watcher.EventUploadProgress, Time: now, Path: "consume/a.pdf", Sent: 50, Total: 100})
+
+	view := m.View()
+	assert.Contains(t, view, "Queue: 2")
+	assert.Contains(t, view, "[###############---------------]  50% a.pdf")
+	assert.Contains(t, view, "detected")
+	assert.Regexp(t, `consume\s+4\s+1`, view)
+
+	m.Update(eventMsg{Type: watcher.EventUploadFailed, Time: now, Path: "consume/a.pdf", Err: errors.New("server down")})
+	m.Update(logMsg("some log line"))
+	view = m.View()
+	assert.Contains(t, view, "(idle)")
+	assert.Contains(t, view, "a.pdf: server down")
+	assert.Contains(t, view, "some log line")
+}
+
+func TestAppendLimited(t *testing.T) {
+	var lines []string
+	for i := 0; i < 8; i++ {
+		lines = appendLimited(lines, strings.Repeat("x", i), 3)
+	}
+	assert.Equal(t, []string{"xxxxx", "xxxxxx", "xxxxxxx"}, lines)
+}
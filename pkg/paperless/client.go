@@ -6,20 +6,33 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
 )
 
 // Client is a client for the Paperless-ngx API.
 type Client struct {
-	BaseURL    string
-	APIKey     string
+	BaseURL string
+	APIKey  string
+	// Header holds extra headers sent with every request, e.g. the
+	// credentials of an authenticating proxy in front of Paperless.
+	Header     http.Header
 	HTTPClient *http.Client
+	// Limits, if set, are checked before every upload.
+	Limits *Limits
+
+	// caps is set by Negotiate.
+	capsMu sync.Mutex
+	caps   *Capabilities
 }
 
 // NewClient creates a new Paperless-ngx API client.
@@ -33,109 +46,393 @@ func NewClient(baseURL, apiKey string) *Client {
 
 // Tag represents a tag in Paperless-ngx.
 type Tag struct {
-	ID   int    `json:"id"`
-	Name string `json:"name"`
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	Color             string `json:"color,omitempty"`
+	Match             string `json:"match,omitempty"`
+	MatchingAlgorithm int    `json:"matching_algorithm"`
+	IsInboxTag        bool   `json:"is_inbox_tag"`
+	DocumentCount     int    `json:"document_count"`
+}
+
+// Matching algorithms used by tags and other auto-matched objects.
+const (
+	MatchNone    = 0
+	MatchAny     = 1
+	MatchAll     = 2
+	MatchLiteral = 3
+	MatchRegex   = 4
+	MatchFuzzy   = 5
+	MatchAuto    = 6
+)
+
+// NewTag holds the fields used to create a tag.
+type NewTag struct {
+	Name              string `json:"name"`
+	Color             string `json:"color,omitempty"`
+	Match             string `json:"match,omitempty"`
+	MatchingAlgorithm *int   `json:"matching_algorithm,omitempty"`
+	IsInsensitive     bool   `json:"is_insensitive"`
 }
 
-// GetTags fetches all tags from Paperless-ngx.
+// GetTags fetches all tags from Paperless-ngx, following the pages of the
+// list.
 func (c *Client) GetTags() ([]Tag, error) {
 	var allTags []Tag
-
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/tags/", c.BaseURL), nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	query := url.Values{}
+	for {
+		tags, next, err := c.getTagsPage(query)
+		if err != nil {
+			return nil, err
+		}
+		allTags = append(allTags, tags...)
+		if next == "" {
+			return allTags, nil
+		}
+		nextURL, err := url.Parse(next)
+		if err != nil {
+			return nil, fmt.Errorf("invalid next page link %q: %w", next, err)
+		}
+		query = nextURL.Query()
 	}
+}
 
-	req.Header.Set("Authorization", "Token "+c.APIKey)
-
-	resp, err := c.HTTPClient.Do(req)
+// getTagsPage fetches one page of tags and returns the link to the next
+// one, if any.
+func (c *Client) getTagsPage(query url.Values) ([]Tag, string, error) {
+	path := "/api/tags/"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	resp, err := c.do("GET", path, nil, "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, "", err
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("Error closing response body: %v", err)
+			logging.Warnf("Error closing response body: %v", err)
 		}
 	}()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get tags: received status code %d", resp.StatusCode)
+		return nil, "", fmt.Errorf("failed to get tags: received status code %d", resp.StatusCode)
 	}
 
 	var result struct {
-		Results []Tag `json:"results"`
+		Next    *string `json:"next"`
+		Results []Tag   `json:"results"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("failed to decode tags response: %w", err)
+		return nil, "", fmt.Errorf("failed to decode tags response: %w", err)
 	}
+	if result.Next == nil {
+		return result.Results, "", nil
+	}
+	return result.Results, *result.Next, nil
+}
 
-	allTags = append(allTags, result.Results...)
-
-	return allTags, nil
+// UploadOptions holds the metadata sent along with an uploaded document.
+// Zero values are not sent, leaving the choice to Paperless.
+type UploadOptions struct {
+	Title string
+	// Created is the creation date, either YYYY-MM-DD or an RFC 3339 timestamp.
+	Created             string
+	Tags                []int
+	Correspondent       *int
+	DocumentType        *int
+	StoragePath         *int
+	ArchiveSerialNumber *int
+	// Progress, if set, is called as the request body is sent with the number
+	// of bytes sent so far and the total size.
+	Progress func(sent, total int64)
 }
 
 // UploadDocument uploads a document to Paperless-ngx.
 func (c *Client) UploadDocument(filePath string, tags []int) error {
+	_, err := c.UploadFile(filePath, UploadOptions{Tags: tags})
+	return err
+}
+
+// UploadFile uploads the file at filePath with the given metadata and returns
+// the ID of the consumption task created by Paperless-ngx. The file is
+// streamed, not read into memory.
+func (c *Client) UploadFile(filePath string, opts UploadOptions) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return "", fmt.Errorf("failed to open file: %w", err)
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
-			log.Printf("Error closing file: %v", err)
+			logging.Warnf("Error closing file: %v", err)
 		}
 	}()
-
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	part, err := writer.CreateFormFile("document", filepath.Base(filePath))
+	info, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("failed to create form file: %w", err)
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+	var head []byte
+	if c.Limits != nil {
+		head = make([]byte, 512)
+		n, _ := file.ReadAt(head, 0)
+		head = head[:n]
 	}
 
-	if _, err := io.Copy(part, file); err != nil {
-		return fmt.Errorf("failed to copy file to form: %w", err)
+	return c.upload(filepath.Base(filePath), file, info.Size(), head, opts)
+}
+
+// UploadReader uploads a document read from r under the given file name and
+// returns the ID of the consumption task created by Paperless-ngx. The
+// document is buffered in memory to determine its size.
+func (c *Client) UploadReader(name string, r io.Reader, opts UploadOptions) (string, error) {
+	var document bytes.Buffer
+	if _, err := io.Copy(&document, r); err != nil {
+		return "", fmt.Errorf("failed to read document: %w", err)
 	}
+	head := document.Bytes()[:min(document.Len(), 512)]
+	return c.upload(name, &document, int64(document.Len()), head, opts)
+}
 
-	if len(tags) > 0 {
-		for _, tagID := range tags {
-			if err := writer.WriteField("tags", strconv.Itoa(tagID)); err != nil {
-				return fmt.Errorf("failed to add tag to form: %w", err)
-			}
+// upload sends the size bytes read from r as the document, whose first
+// bytes are start. Only the multipart framing around the document is held in
+// memory.
+func (c *Client) upload(name string, r io.Reader, size int64, start []byte, opts UploadOptions) (string, error) {
+	var mimeType string
+	if c.Limits != nil {
+		mimeType = DetectMimeType(name, start)
+		if err := c.Limits.Check(mimeType, size); err != nil {
+			return "", err
 		}
 	}
+	var head bytes.Buffer
+	writer := multipart.NewWriter(&head)
 
+	if err := opts.writeFields(writer); err != nil {
+		return "", err
+	}
+
+	if _, err := writer.CreateFormFile("document", name); err != nil {
+		return "", fmt.Errorf("failed to create form file: %w", err)
+	}
+
+	// Closing the writer appends the closing boundary, which is sent after
+	// the document.
+	headLen := head.Len()
 	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close multipart writer: %w", err)
+		return "", fmt.Errorf("failed to close multipart writer: %w", err)
 	}
+	tail := bytes.Clone(head.Bytes()[headLen:])
+	head.Truncate(headLen)
+	length := int64(headLen) + size + int64(len(tail))
+	body := io.MultiReader(&head, io.LimitReader(r, size), bytes.NewReader(tail))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/api/documents/post_document/", c.BaseURL), body)
+	var reqBody io.Reader = body
+	if opts.Progress != nil {
+		reqBody = &progressReader{r: body, total: length, progress: opts.Progress}
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/api/documents/post_document/", c.BaseURL), reqBody)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
+	req.ContentLength = length
 
-	req.Header.Set("Authorization", "Token "+c.APIKey)
+	c.authorize(req)
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer func() {
 		if err := resp.Body.Close(); err != nil {
-			log.Printf("Error closing response body: %v", err)
+			logging.Warnf("Error closing response body: %v", err)
 		}
 	}()
 
+	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK {
 		// It's helpful to see the response body for debugging
+		uploadErr := &UploadError{StatusCode: resp.StatusCode, Body: string(respBody)}
+		if c.Limits != nil {
+			c.Limits.learn(mimeType, size, uploadErr)
+		}
+		return "", uploadErr
+	}
+
+	// Paperless responds with the task ID as a JSON string.
+	var taskID string
+	if err := json.Unmarshal(respBody, &taskID); err != nil {
+		taskID = strings.TrimSpace(string(respBody))
+	}
+	return taskID, nil
+}
+
+// progressReader reports the number of bytes read from r.
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.progress(p.sent, p.total)
+	}
+	return n, err
+}
+
+func (o UploadOptions) writeFields(writer *multipart.Writer) error {
+	fields := [][2]string{}
+	if o.Title != "" {
+		fields = append(fields, [2]string{"title", o.Title})
+	}
+	if o.Created != "" {
+		fields = append(fields, [2]string{"created", o.Created})
+	}
+	for _, tagID := range o.Tags {
+		fields = append(fields, [2]string{"tags", strconv.Itoa(tagID)})
+	}
+	for _, ref := range []struct {
+		name string
+		id   *int
+	}{
+		{"correspondent", o.Correspondent},
+		{"document_type", o.DocumentType},
+		{"storage_path", o.StoragePath},
+		{"archive_serial_number", o.ArchiveSerialNumber},
+	} {
+		if ref.id != nil {
+			fields = append(fields, [2]string{ref.name, strconv.Itoa(*ref.id)})
+		}
+	}
+
+	for _, field := range fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return fmt.Errorf("failed to add %s to form: %w", field[0], err)
+		}
+	}
+	return nil
+}
+
+// Ping checks that the API is reachable and the API key is accepted.
+func (c *Client) Ping() error {
+	resp, err := c.do("GET", "/api/", nil, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logging.Warnf("Error closing response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API check failed: received status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// GetServerVersion returns the Paperless-ngx version reported by the server
+// in the X-Version response header.
+func (c *Client) GetServerVersion() (string, error) {
+	resp, err := c.do("GET", "/api/", nil, "")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logging.Warnf("Error closing response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get server version: received status code %d", resp.StatusCode)
+	}
+	version := resp.Header.Get("X-Version")
+	if version == "" {
+		return "", fmt.Errorf("server did not report a version")
+	}
+	return version, nil
+}
+
+// CreateTag creates a new tag in Paperless-ngx.
+func (c *Client) CreateTag(tag NewTag) (*Tag, error) {
+	payload, err := json.Marshal(tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tag: %w", err)
+	}
+
+	resp, err := c.do("POST", "/api/tags/", bytes.NewReader(payload), "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logging.Warnf("Error closing response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusCreated {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to upload document: received status code %d, body: %s", resp.StatusCode, string(respBody))
+		return nil, fmt.Errorf("failed to create tag: received status code %d, body: %s", resp.StatusCode, string(respBody))
+	}
+
+	var created Tag
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return nil, fmt.Errorf("failed to decode tag response: %w", err)
 	}
+	return &created, nil
+}
 
+// DeleteTag deletes the tag with the given ID from Paperless-ngx.
+func (c *Client) DeleteTag(id int) error {
+	resp, err := c.do("DELETE", fmt.Sprintf("/api/tags/%d/", id), nil, "")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logging.Warnf("Error closing response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete tag %d: received status code %d", id, resp.StatusCode)
+	}
 	return nil
 }
+
+// authorize adds the extra headers, the API key and the negotiated API
+// version to req.
+func (c *Client) authorize(req *http.Request) {
+	for name, values := range c.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Authorization", "Token "+c.APIKey)
+	req.Header.Set("Accept", c.accept())
+}
+
+// do sends an authenticated request to the API path and returns the response.
+// The caller is responsible for closing the response body.
+func (c *Client) do(method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	c.authorize(req)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	return resp, nil
+}
@@ -1,7 +1,9 @@
 package paperless
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -37,6 +39,37 @@ func TestGetTags(t *testing.T) {
 		assert.Equal(t, "tag1", tags[0].Name)
 	})
 
+	t.Run("all pages", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/tags/", r.URL.Path)
+			if r.URL.Query().Get("page") == "2" {
+				fmt.Fprintln(w, `{"next": null, "results": [{"id": 26, "name": "tag26"}]}`)
+				return
+			}
+			// Paperless may report another host, e.g. behind a proxy.
+			fmt.Fprintln(w, `{"next": "http://paperless.internal/api/tags/?page=2", "results": [{"id": 1, "name": "tag1"}, {"id": 2, "name": "tag2"}]}`)
+		}))
+		defer server.Close()
+
+		tags, err := NewClient(server.URL, "test_key").GetTags()
+		assert.NoError(t, err)
+		assert.Equal(t, []Tag{{ID: 1, Name: "tag1"}, {ID: 2, Name: "tag2"}, {ID: 26, Name: "tag26"}}, tags)
+	})
+
+	t.Run("later page fails", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("page") == "2" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintln(w, `{"next": "http://paperless.internal/api/tags/?page=2", "results": [{"id": 1, "name": "tag1"}]}`)
+		}))
+		defer server.Close()
+
+		_, err := NewClient(server.URL, "test_key").GetTags()
+		assert.EqualError(t, err, "failed to get tags: received status code 500")
+	})
+
 	t.Run("failed to send request", func(t *testing.T) {
 		client := NewClient("http://invalid-url", "test_key")
 		_, err := client.GetTags()
@@ -91,6 +124,11 @@ func TestUploadDocument(t *testing.T) {
 			assert.NoError(t, err)
 			defer file.Close()
 			assert.Equal(t, filepath.Base(tmpFile.Name()), handler.Filename)
+			content, err := io.ReadAll(file)
+			assert.NoError(t, err)
+			assert.Equal(t, "fake PDF content", string(content))
+			// The streamed body has a known length.
+			assert.Positive(t, r.ContentLength)
 
 			w.WriteHeader(http.StatusOK)
 		}))
@@ -116,6 +154,69 @@ func TestUploadDocument(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("upload with metadata returns task id", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := r.ParseMultipartForm(10 << 20)
+			assert.NoError(t, err)
+			assert.Equal(t, "Power bill", r.FormValue("title"))
+			assert.Equal(t, "2024-03-05", r.FormValue("created"))
+			assert.Equal(t, "3", r.FormValue("correspondent"))
+			assert.Equal(t, "4", r.FormValue("document_type"))
+			assert.Equal(t, "5", r.FormValue("storage_path"))
+			assert.Equal(t, "1001", r.FormValue("archive_serial_number"))
+			assert.Equal(t, []string{"1"}, r.Form["tags"])
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, `"0b8a2f6e-3c1d-4a5b-9e7f-123456789abc"`)
+		}))
+		defer server.Close()
+
+		correspondent, documentType, storagePath, asn := 3, 4, 5, 1001
+		client := NewClient(server.URL, "test_key")
+		taskID, err := client.UploadFile(tmpFile.Name(), UploadOptions{
+			Title:               "Power bill",
+			Created:             "2024-03-05",
+			Tags:                []int{1},
+			Correspondent:       &correspondent,
+			DocumentType:        &documentType,
+			StoragePath:         &storagePath,
+			ArchiveSerialNumber: &asn,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "0b8a2f6e-3c1d-4a5b-9e7f-123456789abc", taskID)
+	})
+
+	t.Run("upload from reader", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			file, handler, err := r.FormFile("document")
+			assert.NoError(t, err)
+			defer file.Close()
+			assert.Equal(t, "scan.pdf", handler.Filename)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		_, err := client.UploadReader("scan.pdf", strings.NewReader("pdf"), UploadOptions{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("upload reports progress", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.NoError(t, r.ParseMultipartForm(10<<20))
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		var sent, total int64
+		client := NewClient(server.URL, "test_key")
+		_, err := client.UploadFile(tmpFile.Name(), UploadOptions{Progress: func(s, t int64) {
+			sent, total = s, t
+		}})
+		assert.NoError(t, err)
+		assert.Positive(t, total)
+		assert.Equal(t, total, sent)
+	})
+
 	t.Run("failed to open file", func(t *testing.T) {
 		client := NewClient("http://localhost", "test_key")
 		err := client.UploadDocument("/non/existent/file.pdf", nil)
@@ -127,6 +228,7 @@ func TestUploadDocument(t *testing.T) {
 		client := NewClient("http://invalid-url", "test_key")
 		err := client.UploadDocument(tmpFile.Name(), nil)
 		assert.Error(t, err)
+		assert.True(t, IsUnavailable(err))
 	})
 
 	t.Run("non-200 status code", func(t *testing.T) {
@@ -140,5 +242,155 @@ func TestUploadDocument(t *testing.T) {
 		err := client.UploadDocument(tmpFile.Name(), nil)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "failed to upload document: received status code 400, body: Bad request body")
+		assert.False(t, IsUnavailable(err))
 	})
+
+	t.Run("gateway error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		err := client.UploadDocument(tmpFile.Name(), nil)
+		assert.True(t, IsUnavailable(err))
+	})
+}
+
+func TestCreateTag(t *testing.T) {
+	t.Run("successful create", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "POST", r.Method)
+			assert.Equal(t, "/api/tags/", r.URL.Path)
+			assert.Equal(t, "Token test_key", r.Header.Get("Authorization"))
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+			var tag map[string]interface{}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&tag))
+			assert.Equal(t, "invoice", tag["name"])
+			assert.Equal(t, "#ff0000", tag["color"])
+			assert.Equal(t, float64(MatchAny), tag["matching_algorithm"])
+
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintln(w, `{"id": 7, "name": "invoice", "color": "#ff0000"}`)
+		}))
+		defer server.Close()
+
+		algorithm := MatchAny
+		client := NewClient(server.URL, "test_key")
+		tag, err := client.CreateTag(NewTag{Name: "invoice", Color: "#ff0000", Match: "invoice", MatchingAlgorithm: &algorithm})
+		assert.NoError(t, err)
+		assert.Equal(t, 7, tag.ID)
+	})
+
+	t.Run("non-201 status code", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, `{"name": ["already exists"]}`)
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		_, err := client.CreateTag(NewTag{Name: "invoice"})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to create tag: received status code 400")
+	})
+}
+
+func TestDeleteTag(t *testing.T) {
+	t.Run("successful delete", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "DELETE", r.Method)
+			assert.Equal(t, "/api/tags/7/", r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		assert.NoError(t, client.DeleteTag(7))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		err := client.DeleteTag(7)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "received status code 404")
+	})
+}
+
+func TestGetServerVersion(t *testing.T) {
+	t.Run("version header", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/", r.URL.Path)
+			w.Header().Set("X-Version", "2.11.6")
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		version, err := client.GetServerVersion()
+		assert.NoError(t, err)
+		assert.Equal(t, "2.11.6", version)
+	})
+
+	t.Run("missing header", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		_, err := client.GetServerVersion()
+		assert.Error(t, err)
+	})
+}
+
+func TestPing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	assert.NoError(t, NewClient(server.URL, "good").Ping())
+	err := NewClient(server.URL, "bad").Ping()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "received status code 401")
+}
+
+func TestClientHeader(t *testing.T) {
+	var got []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Clone())
+		if r.URL.Path == "/api/documents/post_document/" {
+			fmt.Fprint(w, `"task-1"`)
+			return
+		}
+		fmt.Fprint(w, `{"results": []}`)
+	}))
+	defer server.Close()
+
+	filePath := filepath.Join(t.TempDir(), "scan.pdf")
+	assert.NoError(t, os.WriteFile(filePath, []byte("%PDF"), 0644))
+	client := NewClient(server.URL, "test_key")
+	client.Header = http.Header{"Cf-Access-Client-Id": {"id.access"}, "Authorization": {"Basic ignored"}}
+	_, err := client.GetTags()
+	assert.NoError(t, err)
+	_, err = client.UploadFile(filePath, UploadOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Ping())
+
+	assert.Len(t, got, 3)
+	for _, h := range got {
+		assert.Equal(t, "id.access", h.Get("CF-Access-Client-Id"))
+		assert.Equal(t, "Token test_key", h.Get("Authorization"))
+	}
 }
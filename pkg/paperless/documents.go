@@ -0,0 +1,309 @@
+package paperless
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+)
+
+// Document represents a document in Paperless-ngx.
+type Document struct {
+	ID                  int    `json:"id"`
+	Title               string `json:"title"`
+	Correspondent       *int   `json:"correspondent"`
+	DocumentType        *int   `json:"document_type"`
+	StoragePath         *int   `json:"storage_path"`
+	Tags                []int  `json:"tags"`
+	Created             string `json:"created"`
+	Added               string `json:"added"`
+	Modified            string `json:"modified"`
+	ArchiveSerialNumber *int   `json:"archive_serial_number"`
+	OriginalFileName    string `json:"original_file_name"`
+	ArchivedFileName    string `json:"archived_file_name"`
+	// CustomFields is only reported by servers supporting custom fields.
+	CustomFields []CustomFieldValue `json:"custom_fields"`
+}
+
+// Correspondent represents a correspondent in Paperless-ngx.
+type Correspondent struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// DocumentType represents a document type in Paperless-ngx.
+type DocumentType struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// StoragePath represents a storage path in Paperless-ngx.
+type StoragePath struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// DocumentFilter narrows down a document listing. Zero values are ignored.
+type DocumentFilter struct {
+	// Query is a full text search query.
+	Query string
+	// TagIDs only matches documents that have all of the given tags.
+	TagIDs          []int
+	CorrespondentID *int
+	DocumentTypeID  *int
+	// CreatedAfter and CreatedBefore are inclusive dates in YYYY-MM-DD format.
+	CreatedAfter  string
+	CreatedBefore string
+	// Checksum matches the document whose original file has this MD5
+	// checksum, in hex.
+	Checksum string
+	// ModifiedSince only matches documents modified at or after this
+	// timestamp, in the format of Document.Modified.
+	ModifiedSince string
+	// Ordering sorts the documents by a field, e.g. "modified"; a leading
+	// "-" reverses the order.
+	Ordering string
+	// Limit caps the number of documents returned; zero means no limit.
+	Limit int
+}
+
+func (f DocumentFilter) values() url.Values {
+	v := url.Values{}
+	if f.Query != "" {
+		v.Set("query", f.Query)
+	}
+	if len(f.TagIDs) > 0 {
+		ids := make([]string, len(f.TagIDs))
+		for i, id := range f.TagIDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		v.Set("tags__id__all", strings.Join(ids, ","))
+	}
+	if f.CorrespondentID != nil {
+		v.Set("correspondent__id", strconv.Itoa(*f.CorrespondentID))
+	}
+	if f.DocumentTypeID != nil {
+		v.Set("document_type__id", strconv.Itoa(*f.DocumentTypeID))
+	}
+	if f.CreatedAfter != "" {
+		v.Set("created__date__gte", f.CreatedAfter)
+	}
+	if f.CreatedBefore != "" {
+		v.Set("created__date__lte", f.CreatedBefore)
+	}
+	if f.Checksum != "" {
+		v.Set("checksum__iexact", f.Checksum)
+	}
+	if f.ModifiedSince != "" {
+		v.Set("modified__gte", f.ModifiedSince)
+	}
+	if f.Ordering != "" {
+		v.Set("ordering", f.Ordering)
+	}
+	return v
+}
+
+// ListDocuments returns the documents matching filter.
+func (c *Client) ListDocuments(filter DocumentFilter) ([]Document, error) {
+	return getAll[Document](c, "/api/documents/", filter.values(), filter.Limit)
+}
+
+// DocumentIDs returns the IDs of all documents, without fetching the
+// documents themselves.
+func (c *Client) DocumentIDs() ([]int, error) {
+	resp, err := c.do("GET", "/api/documents/?page_size=1&fields=id", nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logging.Warnf("Error closing response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to get document IDs: received status code %d, body: %s", resp.StatusCode, string(respBody))
+	}
+	// Every page lists the IDs of all matching documents.
+	var result struct {
+		All []int `json:"all"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode document IDs: %w", err)
+	}
+	return result.All, nil
+}
+
+// GetCorrespondents fetches all correspondents from Paperless-ngx.
+func (c *Client) GetCorrespondents() ([]Correspondent, error) {
+	return getAll[Correspondent](c, "/api/correspondents/", nil, 0)
+}
+
+// GetDocumentTypes fetches all document types from Paperless-ngx.
+func (c *Client) GetDocumentTypes() ([]DocumentType, error) {
+	return getAll[DocumentType](c, "/api/document_types/", nil, 0)
+}
+
+// CreateCorrespondent creates a correspondent in Paperless-ngx.
+func (c *Client) CreateCorrespondent(name string) (*Correspondent, error) {
+	var created Correspondent
+	if err := c.sendJSON("POST", "/api/correspondents/", map[string]string{"name": name}, http.StatusCreated, &created); err != nil {
+		return nil, fmt.Errorf("failed to create correspondent: %w", err)
+	}
+	return &created, nil
+}
+
+// CreateDocumentType creates a document type in Paperless-ngx.
+func (c *Client) CreateDocumentType(name string) (*DocumentType, error) {
+	var created DocumentType
+	if err := c.sendJSON("POST", "/api/document_types/", map[string]string{"name": name}, http.StatusCreated, &created); err != nil {
+		return nil, fmt.Errorf("failed to create document type: %w", err)
+	}
+	return &created, nil
+}
+
+// GetStoragePaths fetches all storage paths from Paperless-ngx.
+func (c *Client) GetStoragePaths() ([]StoragePath, error) {
+	if err := c.require("storage paths", func(caps Capabilities) bool { return caps.StoragePaths }); err != nil {
+		return nil, err
+	}
+	return getAll[StoragePath](c, "/api/storage_paths/", nil, 0)
+}
+
+// DownloadDocument opens the content of a document. By default Paperless
+// serves the archived (OCRed PDF) version when one exists; set original to
+// fetch the file as it was uploaded. The returned filename is the one
+// suggested by the server. The caller must close the returned reader.
+func (c *Client) DownloadDocument(id int, original bool) (io.ReadCloser, string, error) {
+	path := fmt.Sprintf("/api/documents/%d/download/", id)
+	if original {
+		path += "?original=true"
+	}
+	resp, err := c.do("GET", path, nil, "")
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("failed to download document %d: received status code %d, body: %s", id, resp.StatusCode, string(respBody))
+	}
+
+	filename := fmt.Sprintf("document-%d", id)
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := filepath.Base(params["filename"]); name != "." && name != "/" && name != "" {
+			filename = name
+		}
+	}
+	return resp.Body, filename, nil
+}
+
+// DocumentMetadata holds the file details Paperless keeps of a document.
+type DocumentMetadata struct {
+	// OriginalChecksum is the MD5 checksum of the uploaded file, in hex.
+	OriginalChecksum string `json:"original_checksum"`
+	OriginalSize     int64  `json:"original_size"`
+	OriginalMimeType string `json:"original_mime_type"`
+	MediaFilename    string `json:"media_filename"`
+	HasArchive       bool   `json:"has_archive_version"`
+}
+
+// GetDocumentMetadata fetches the file details of a document.
+func (c *Client) GetDocumentMetadata(id int) (*DocumentMetadata, error) {
+	resp, err := c.do("GET", fmt.Sprintf("/api/documents/%d/metadata/", id), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logging.Warnf("Error closing response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to get metadata of document %d: received status code %d, body: %s", id, resp.StatusCode, string(respBody))
+	}
+	var md DocumentMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&md); err != nil {
+		return nil, fmt.Errorf("failed to decode document metadata: %w", err)
+	}
+	return &md, nil
+}
+
+// DocumentURL returns the link to a document in the Paperless-ngx web UI.
+func (c *Client) DocumentURL(id int) string {
+	return fmt.Sprintf("%s/documents/%d/details", strings.TrimRight(c.BaseURL, "/"), id)
+}
+
+// getAll fetches every page of a paginated list endpoint, stopping once limit
+// results have been collected when limit is positive. Only the query of the
+// "next" link is used, so pagination keeps working when Paperless reports a
+// different host than BaseURL (e.g. behind a reverse proxy).
+func getAll[T any](c *Client, path string, query url.Values, limit int) ([]T, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	var all []T
+	for {
+		page, next, err := getPage[T](c, path, query)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if limit > 0 && len(all) >= limit {
+			return all[:limit], nil
+		}
+		if next == "" {
+			return all, nil
+		}
+		nextURL, err := url.Parse(next)
+		if err != nil {
+			return nil, fmt.Errorf("invalid next page link %q: %w", next, err)
+		}
+		query = nextURL.Query()
+	}
+}
+
+func getPage[T any](c *Client, path string, query url.Values) ([]T, string, error) {
+	target := path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	resp, err := c.do("GET", target, nil, "")
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logging.Warnf("Error closing response body: %v", err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, "", fmt.Errorf("failed to get %s: received status code %d, body: %s", path, resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Next    *string `json:"next"`
+		Results []T     `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, "", fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	next := ""
+	if result.Next != nil {
+		next = *result.Next
+	}
+	return result.Results, next, nil
+}
@@ -0,0 +1,178 @@
+package paperless
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListDocuments(t *testing.T) {
+	t.Run("filters and pagination", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/documents/", r.URL.Path)
+			q := r.URL.Query()
+			assert.Equal(t, "invoice", q.Get("query"))
+			assert.Equal(t, "1,2", q.Get("tags__id__all"))
+			assert.Equal(t, "5", q.Get("correspondent__id"))
+			assert.Equal(t, "2024-01-01", q.Get("created__date__gte"))
+			assert.Equal(t, "d41d8cd98f00b204e9800998ecf8427e", q.Get("checksum__iexact"))
+
+			if q.Get("page") == "2" {
+				fmt.Fprintln(w, `{"next": null, "results": [{"id": 3, "title": "third"}]}`)
+				return
+			}
+			// Paperless may report an internal host in the next link.
+			fmt.Fprintln(w, `{"next": "http://internal:8000/api/documents/?page=2&query=invoice&tags__id__all=1,2&correspondent__id=5&created__date__gte=2024-01-01&checksum__iexact=d41d8cd98f00b204e9800998ecf8427e", "results": [{"id": 1, "title": "first"}, {"id": 2, "title": "second"}]}`)
+		}))
+		defer server.Close()
+
+		correspondent := 5
+		client := NewClient(server.URL, "test_key")
+		docs, err := client.ListDocuments(DocumentFilter{
+			Query:           "invoice",
+			TagIDs:          []int{1, 2},
+			CorrespondentID: &correspondent,
+			CreatedAfter:    "2024-01-01",
+			Checksum:        "d41d8cd98f00b204e9800998ecf8427e",
+		})
+		assert.NoError(t, err)
+		assert.Len(t, docs, 3)
+		assert.Equal(t, "third", docs[2].Title)
+	})
+
+	t.Run("modified since", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			assert.Equal(t, "2024-05-01T10:00:00Z", q.Get("modified__gte"))
+			assert.Equal(t, "modified", q.Get("ordering"))
+			fmt.Fprintln(w, `{"next": null, "results": [{"id": 1, "modified": "2024-05-02T08:00:00Z"}]}`)
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		docs, err := client.ListDocuments(DocumentFilter{ModifiedSince: "2024-05-01T10:00:00Z", Ordering: "modified"})
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-05-02T08:00:00Z", docs[0].Modified)
+	})
+
+	t.Run("limit stops paging", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			fmt.Fprintln(w, `{"next": "http://x/api/documents/?page=2", "results": [{"id": 1}, {"id": 2}]}`)
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		docs, err := client.ListDocuments(DocumentFilter{Limit: 1})
+		assert.NoError(t, err)
+		assert.Len(t, docs, 1)
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("non-200 status code", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		_, err := client.ListDocuments(DocumentFilter{})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "received status code 403")
+	})
+}
+
+func TestDocumentURL(t *testing.T) {
+	client := NewClient("http://paperless.local/", "test_key")
+	assert.Equal(t, "http://paperless.local/documents/42/details", client.DocumentURL(42))
+}
+
+func TestDownloadDocument(t *testing.T) {
+	t.Run("archived version", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/documents/42/download/", r.URL.Path)
+			assert.Equal(t, "", r.URL.Query().Get("original"))
+			w.Header().Set("Content-Disposition", `attachment; filename="../2024-03-05 Power bill.pdf"`)
+			fmt.Fprint(w, "pdf content")
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		body, name, err := client.DownloadDocument(42, false)
+		assert.NoError(t, err)
+		defer body.Close()
+		content, _ := io.ReadAll(body)
+		assert.Equal(t, "pdf content", string(content))
+		assert.Equal(t, "2024-03-05 Power bill.pdf", name)
+	})
+
+	t.Run("original version without filename", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "true", r.URL.Query().Get("original"))
+			fmt.Fprint(w, "original")
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		body, name, err := client.DownloadDocument(7, true)
+		assert.NoError(t, err)
+		body.Close()
+		assert.Equal(t, "document-7", name)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		_, _, err := client.DownloadDocument(7, false)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "received status code 404")
+	})
+}
+
+func TestGetDocumentMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/documents/42/metadata/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"original_checksum": "2f7b1fb8f3d1b4ec4f5a1e36b0c3a1d2", "original_size": 1234, "original_mime_type": "application/pdf", "media_filename": "0000042.pdf", "has_archive_version": true}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test_key")
+	md, err := client.GetDocumentMetadata(42)
+	assert.NoError(t, err)
+	assert.Equal(t, &DocumentMetadata{
+		OriginalChecksum: "2f7b1fb8f3d1b4ec4f5a1e36b0c3a1d2",
+		OriginalSize:     1234,
+		OriginalMimeType: "application/pdf",
+		MediaFilename:    "0000042.pdf",
+		HasArchive:       true,
+	}, md)
+
+	_, err = client.GetDocumentMetadata(7)
+	assert.ErrorContains(t, err, "failed to get metadata of document 7: received status code 404")
+}
+
+func TestDocumentIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/documents/", r.URL.Path)
+		assert.Equal(t, "1", r.URL.Query().Get("page_size"))
+		fmt.Fprintln(w, `{"count": 3, "next": "http://x/api/documents/?page=2", "all": [4, 2, 9], "results": [{"id": 4}]}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test_key")
+	ids, err := client.DocumentIDs()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4, 2, 9}, ids)
+}
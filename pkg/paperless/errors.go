@@ -0,0 +1,36 @@
+package paperless
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// UploadError is returned when Paperless-ngx rejects an upload.
+type UploadError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("failed to upload document: received status code %d, body: %s", e.StatusCode, e.Body)
+}
+
+// IsUnavailable reports whether err means the server could not be reached
+// or its API is down, e.g. a refused connection, a timeout or a gateway
+// error from a reverse proxy, as opposed to a rejected request.
+func IsUnavailable(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	var uploadErr *UploadError
+	if errors.As(err, &uploadErr) {
+		switch uploadErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+	}
+	return false
+}
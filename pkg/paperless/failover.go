@@ -0,0 +1,200 @@
+package paperless
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// failoverProbeTimeout bounds the requests checking whether a preferred
+// server is reachable again.
+const failoverProbeTimeout = 5 * time.Second
+
+// Failover is an http.RoundTripper for clients that can reach Paperless
+// under several URLs, e.g. a LAN address at home and a VPN address when
+// away. Requests to the first URL are sent to the active one, initially
+// the first. When a request fails to reach the active server, it is sent to
+// the next URLs in turn, and the first one answering becomes active.
+// Requests whose body cannot be sent again, such as uploads, are not
+// repeated but fail, and the next request goes to the next URL. While a
+// less preferred URL is active, the preferred ones are probed in the
+// background every RetryPrimary, and the first one answering becomes
+// active again.
+type Failover struct {
+	// URLs are the base URLs of the server in order of preference. The
+	// client's BaseURL is the first.
+	URLs []string
+	// Transport sends the requests; nil uses http.DefaultTransport.
+	Transport http.RoundTripper
+	// RetryPrimary is how often the preferred URLs are probed while
+	// another one is active. Zero probes them with every request, one
+	// probe at a time.
+	RetryPrimary time.Duration
+	// OnSwitch, if set, is called when another URL becomes active.
+	OnSwitch func(from, to string)
+
+	once    sync.Once
+	bases   []*url.URL
+	initErr error
+
+	mu      sync.Mutex
+	active  int
+	probed  time.Time
+	probing bool
+}
+
+// Active returns the URL requests are currently sent to.
+func (f *Failover) Active() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.URLs[f.active]
+}
+
+func (f *Failover) init() error {
+	f.once.Do(func() {
+		if len(f.URLs) == 0 {
+			f.initErr = errors.New("no URLs to fail over between")
+			return
+		}
+		for _, raw := range f.URLs {
+			u, err := url.Parse(strings.TrimRight(raw, "/"))
+			if err != nil || u.Host == "" {
+				f.initErr = fmt.Errorf("invalid URL %q", raw)
+				return
+			}
+			f.bases = append(f.bases, u)
+		}
+	})
+	return f.initErr
+}
+
+func (f *Failover) transport() http.RoundTripper {
+	if f.Transport != nil {
+		return f.Transport
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip sends req to the active URL, failing over to the next ones if
+// it cannot be reached.
+func (f *Failover) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := f.init(); err != nil {
+		return nil, err
+	}
+	primary := f.bases[0]
+	if req.URL.Scheme != primary.Scheme || req.URL.Host != primary.Host || !strings.HasPrefix(req.URL.Path, primary.Path) {
+		return f.transport().RoundTrip(req)
+	}
+	f.mu.Lock()
+	start := f.active
+	if start > 0 && !f.probing && time.Since(f.probed) >= f.RetryPrimary {
+		f.probing = true
+		go f.probe(start)
+	}
+	f.mu.Unlock()
+
+	rewindable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	var err error
+	for i := start; i < len(f.bases); i++ {
+		attempt := req
+		if i != start {
+			if attempt, err = rewind(req); err != nil {
+				return nil, err
+			}
+		}
+		var resp *http.Response
+		resp, err = f.transport().RoundTrip(f.rewrite(attempt, i))
+		if err == nil {
+			f.switchTo(i)
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+		if !rewindable {
+			// The body was consumed; the caller's retry goes to the
+			// next URL.
+			if i+1 < len(f.bases) {
+				f.switchTo(i + 1)
+			}
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// rewrite returns a copy of req sent to the URL at index i.
+func (f *Failover) rewrite(req *http.Request, i int) *http.Request {
+	if i == 0 {
+		return req
+	}
+	base := f.bases[i]
+	out := req.Clone(req.Context())
+	u := *req.URL
+	u.Scheme, u.Host, u.User = base.Scheme, base.Host, base.User
+	u.Path = base.Path + strings.TrimPrefix(req.URL.Path, f.bases[0].Path)
+	u.RawPath = ""
+	out.URL, out.Host = &u, ""
+	return out
+}
+
+// rewind returns req with a fresh copy of its body.
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.GetBody == nil {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	out := req.Clone(req.Context())
+	out.Body = body
+	return out, nil
+}
+
+// switchTo makes the URL at index i active.
+func (f *Failover) switchTo(i int) {
+	f.mu.Lock()
+	from := f.active
+	if from == i {
+		f.mu.Unlock()
+		return
+	}
+	f.active = i
+	f.probed = time.Now()
+	f.mu.Unlock()
+	if f.OnSwitch != nil {
+		f.OnSwitch(f.URLs[from], f.URLs[i])
+	}
+}
+
+// probe checks whether a URL preferred to the one at index active answers,
+// and makes the first one that does active.
+func (f *Failover) probe(active int) {
+	defer func() {
+		f.mu.Lock()
+		f.probing = false
+		f.probed = time.Now()
+		f.mu.Unlock()
+	}()
+	for i := 0; i < active; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), failoverProbeTimeout)
+		req, err := http.NewRequestWithContext(ctx, "GET", f.bases[i].String()+"/api/", nil)
+		if err == nil {
+			var resp *http.Response
+			if resp, err = f.transport().RoundTrip(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+		cancel()
+		if err == nil {
+			f.switchTo(i)
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package paperless
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailover(t *testing.T) {
+	var mu sync.Mutex
+	var hits []string
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits = append(hits, name+" "+r.Method+" "+r.URL.Path)
+			mu.Unlock()
+			switch r.URL.Path {
+			case "/paperless/api/tags/":
+				w.Write([]byte(`{"results": [{"id": 1, "name": "inbox"}]}`))
+			case "/paperless/api/documents/post_document/":
+				w.Write([]byte(`"task"`))
+			}
+		})
+	}
+	primary := httptest.NewServer(handler("primary"))
+	primaryURL := primary.URL
+	secondary := httptest.NewServer(handler("secondary"))
+	defer secondary.Close()
+	took := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		h := hits
+		hits = nil
+		return h
+	}
+
+	client := NewClient(primaryURL+"/paperless", "test_key")
+	var switches []string
+	failover := &Failover{
+		URLs:         []string{primaryURL + "/paperless", secondary.URL + "/paperless/"},
+		RetryPrimary: time.Hour,
+		OnSwitch:     func(from, to string) { switches = append(switches, from+" -> "+to) },
+	}
+	client.HTTPClient.Transport = failover
+
+	_, err := client.GetTags()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"primary GET /paperless/api/tags/"}, took())
+
+	// The primary goes away: requests without a body fail over at once.
+	primary.Close()
+	tags, err := client.GetTags()
+	assert.NoError(t, err)
+	assert.Len(t, tags, 1)
+	assert.Equal(t, []string{"secondary GET /paperless/api/tags/"}, took())
+	assert.Equal(t, secondary.URL+"/paperless/", failover.Active())
+	assert.Equal(t, []string{primaryURL + "/paperless -> " + secondary.URL + "/paperless/"}, switches)
+
+	// Later requests go to the secondary directly, uploads too.
+	path := filepath.Join(t.TempDir(), "a.pdf")
+	assert.NoError(t, os.WriteFile(path, []byte("pdf"), 0644))
+	_, err = client.UploadFile(path, UploadOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"secondary POST /paperless/api/documents/post_document/"}, took())
+	// Document links keep using the primary.
+	assert.Equal(t, primaryURL+"/paperless/documents/1/details", client.DocumentURL(1))
+}
+
+func TestFailoverReturnsToPrimary(t *testing.T) {
+	primary := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": []}`))
+	}))
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": []}`))
+	}))
+	defer secondary.Close()
+	primaryURL := "http://" + primary.Listener.Addr().String()
+
+	client := NewClient(primaryURL, "test_key")
+	switched := make(chan string, 2)
+	failover := &Failover{
+		URLs:     []string{primaryURL, secondary.URL},
+		OnSwitch: func(from, to string) { switched <- to },
+	}
+	client.HTTPClient.Transport = failover
+
+	// Uploads cannot be repeated: the first fails, the retry goes to the
+	// secondary.
+	primary.Listener.Close()
+	path := filepath.Join(t.TempDir(), "a.pdf")
+	assert.NoError(t, os.WriteFile(path, []byte("pdf"), 0644))
+	_, err := client.UploadFile(path, UploadOptions{})
+	assert.Error(t, err)
+	assert.Equal(t, secondary.URL, <-switched)
+
+	// Once the primary answers again, a probe switches back to it.
+	primary = httptest.NewUnstartedServer(primary.Config.Handler)
+	listener, err := listen(primaryURL)
+	if err != nil {
+		t.Skipf("cannot listen on %s again: %v", primaryURL, err)
+	}
+	primary.Listener = listener
+	primary.Start()
+	defer primary.Close()
+	_, err = client.GetTags()
+	assert.NoError(t, err)
+	select {
+	case to := <-switched:
+		assert.Equal(t, primaryURL, to)
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not return to the primary")
+	}
+	assert.Equal(t, primaryURL, failover.Active())
+}
+
+// listen listens on the address of the URL.
+func listen(rawURL string) (net.Listener, error) {
+	return net.Listen("tcp", strings.TrimPrefix(rawURL, "http://"))
+}
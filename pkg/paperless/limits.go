@@ -0,0 +1,163 @@
+package paperless
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultMimeTypes are the content types Paperless-ngx consumes without
+// Tika. Office documents and mails need Tika and Gotenberg.
+var DefaultMimeTypes = []string{
+	"application/pdf",
+	"image/jpeg", "image/png", "image/tiff", "image/gif", "image/webp", "image/bmp", "image/heic",
+	"text/plain", "text/csv",
+}
+
+// mimeTypes maps the extensions of the files Paperless-ngx consumes to their
+// content type, as the system's table may lack some of them.
+var mimeTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".tif":  "image/tiff",
+	".tiff": "image/tiff",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".bmp":  "image/bmp",
+	".heic": "image/heic",
+	".txt":  "text/plain",
+	".csv":  "text/csv",
+	".eml":  "message/rfc822",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+}
+
+// DetectMimeType returns the content type of a document named name from
+// its extension or, for unknown extensions, from head, its first bytes.
+func DetectMimeType(name string, head []byte) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	t, ok := mimeTypes[ext]
+	if !ok {
+		t = mime.TypeByExtension(ext)
+	}
+	if t == "" {
+		t = http.DetectContentType(head)
+	}
+	if mt, _, err := mime.ParseMediaType(t); err == nil {
+		return mt
+	}
+	return t
+}
+
+// RejectedError is returned for a document that Paperless will not accept,
+// found before uploading it.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return "document not accepted by Paperless: " + e.Reason
+}
+
+// IsRejected reports whether err means that Paperless does not accept the
+// document, so uploading it again is futile: it failed the checks of
+// Limits, or the server rejected the request as invalid, too large or of
+// an unsupported type.
+func IsRejected(err error) bool {
+	var rejected *RejectedError
+	if errors.As(err, &rejected) {
+		return true
+	}
+	var uploadErr *UploadError
+	if errors.As(err, &uploadErr) {
+		switch uploadErr.StatusCode {
+		case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType:
+			return true
+		}
+	}
+	return false
+}
+
+// Limits are checked before every upload, so that documents the server
+// would reject fail without being sent. Besides the configured limits it
+// learns from the rejections of the server: after a document was rejected
+// as too large, documents at least as large fail, and after a type was
+// rejected as unsupported, further documents of that type fail. It is safe
+// for concurrent use.
+type Limits struct {
+	// MaxSize is the size of the largest document accepted, zero for no
+	// limit.
+	MaxSize int64
+	// MimeTypes are patterns of the accepted content types, e.g.
+	// "image/*". Empty accepts all types.
+	MimeTypes []string
+
+	mu sync.Mutex
+	// tooLarge is the size of the smallest document rejected as too
+	// large, zero if there was none.
+	tooLarge    int64
+	unsupported map[string]bool
+}
+
+// Check returns a RejectedError if a document of the content type and size
+// is not accepted.
+func (l *Limits) Check(mimeType string, size int64) error {
+	if l.MaxSize > 0 && size > l.MaxSize {
+		return &RejectedError{Reason: fmt.Sprintf("%d bytes exceed the maximum upload size of %d bytes", size, l.MaxSize)}
+	}
+	if len(l.MimeTypes) > 0 && !l.accepts(mimeType) {
+		return &RejectedError{Reason: fmt.Sprintf("the type %s is not among the accepted types %s", mimeType, strings.Join(l.MimeTypes, ", "))}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tooLarge > 0 && size >= l.tooLarge {
+		return &RejectedError{Reason: fmt.Sprintf("the server rejected a document of %d bytes as too large, this one has %d", l.tooLarge, size)}
+	}
+	if l.unsupported[mimeType] {
+		return &RejectedError{Reason: fmt.Sprintf("the server rejected the type %s as unsupported", mimeType)}
+	}
+	return nil
+}
+
+func (l *Limits) accepts(mimeType string) bool {
+	for _, pattern := range l.MimeTypes {
+		if ok, _ := path.Match(strings.ToLower(pattern), mimeType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// learn records the rejection of a document of the content type and size.
+func (l *Limits) learn(mimeType string, size int64, err *UploadError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case err.StatusCode == http.StatusRequestEntityTooLarge:
+		if l.tooLarge == 0 || size < l.tooLarge {
+			l.tooLarge = size
+		}
+	case err.StatusCode == http.StatusUnsupportedMediaType,
+		err.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(err.Body), "file type"):
+		// Paperless-ngx answers "Unsupported file type" or "File type
+		// ... not supported".
+		if l.unsupported == nil {
+			l.unsupported = make(map[string]bool)
+		}
+		l.unsupported[mimeType] = true
+	}
+}
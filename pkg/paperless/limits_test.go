@@ -0,0 +1,72 @@
+package paperless
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectMimeType(t *testing.T) {
+	assert.Equal(t, "application/pdf", DetectMimeType("a.PDF", nil))
+	assert.Equal(t, "image/tiff", DetectMimeType("scan.tif", nil))
+	assert.Equal(t, "application/pdf", DetectMimeType("scan", []byte("%PDF-1.7\n")))
+	assert.Equal(t, "text/plain", DetectMimeType("notes", []byte("hello")))
+}
+
+func TestLimits(t *testing.T) {
+	l := &Limits{MaxSize: 100, MimeTypes: []string{"application/pdf", "image/*"}}
+	assert.NoError(t, l.Check("image/png", 100))
+	assert.EqualError(t, l.Check("image/png", 101), "document not accepted by Paperless: 101 bytes exceed the maximum upload size of 100 bytes")
+	assert.EqualError(t, l.Check("application/zip", 10), "document not accepted by Paperless: the type application/zip is not among the accepted types application/pdf, image/*")
+
+	l = &Limits{}
+	l.learn("application/pdf", 50, &UploadError{StatusCode: http.StatusRequestEntityTooLarge})
+	l.learn("application/zip", 10, &UploadError{StatusCode: http.StatusBadRequest, Body: `{"document": ["File type application/zip not supported"]}`})
+	l.learn("image/png", 10, &UploadError{StatusCode: http.StatusBadRequest, Body: `{"tags": ["Invalid pk"]}`})
+	assert.NoError(t, l.Check("application/pdf", 49))
+	assert.True(t, IsRejected(l.Check("application/pdf", 50)))
+	assert.ErrorContains(t, l.Check("application/zip", 1), "the server rejected the type application/zip as unsupported")
+	assert.NoError(t, l.Check("image/png", 10))
+
+	assert.True(t, IsRejected(fmt.Errorf("wrapped: %w", &UploadError{StatusCode: http.StatusRequestEntityTooLarge})))
+	assert.False(t, IsRejected(&UploadError{StatusCode: http.StatusInternalServerError}))
+}
+
+func TestUploadLimits(t *testing.T) {
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	write := func(name string, size int) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(strings.Repeat("x", size)), 0644))
+		return path
+	}
+	client := NewClient(server.URL, "test_key")
+	client.Limits = &Limits{MimeTypes: DefaultMimeTypes}
+
+	_, err := client.UploadFile(write("a.zip", 10), UploadOptions{})
+	assert.True(t, IsRejected(err))
+	assert.Equal(t, int32(0), uploads.Load())
+
+	_, err = client.UploadFile(write("big.pdf", 1000), UploadOptions{})
+	assert.True(t, IsRejected(err))
+	assert.Equal(t, int32(1), uploads.Load())
+	// A larger document is not sent, a smaller one is.
+	_, err = client.UploadReader("bigger.pdf", strings.NewReader(strings.Repeat("x", 2000)), UploadOptions{})
+	assert.ErrorContains(t, err, "the server rejected a document of 1000 bytes as too large, this one has 2000")
+	_, err = client.UploadFile(write("small.pdf", 10), UploadOptions{})
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), uploads.Load())
+}
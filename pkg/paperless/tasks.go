@@ -0,0 +1,144 @@
+package paperless
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+)
+
+// Task states reported by Paperless-ngx.
+const (
+	TaskPending = "PENDING"
+	TaskStarted = "STARTED"
+	TaskSuccess = "SUCCESS"
+	TaskFailure = "FAILURE"
+	TaskRevoked = "REVOKED"
+)
+
+// Task is a consumption task created by an upload.
+type Task struct {
+	ID           int    `json:"id"`
+	TaskID       string `json:"task_id"`
+	TaskFileName string `json:"task_file_name"`
+	Status       string `json:"status"`
+	// Result is the consumer's message, e.g. the reason consumption failed.
+	Result string `json:"result"`
+	// DocumentID is the ID of the created document, zero until the task
+	// succeeded.
+	DocumentID int `json:"-"`
+}
+
+// UnmarshalJSON decodes a task. Paperless reports the related document as a
+// string in some versions and as a number in others.
+func (t *Task) UnmarshalJSON(data []byte) error {
+	type plain Task
+	var raw struct {
+		plain
+		RelatedDocument json.RawMessage `json:"related_document"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*t = Task(raw.plain)
+	ref := string(bytes.Trim(raw.RelatedDocument, `"`))
+	if ref != "" && ref != "null" {
+		id, err := strconv.Atoi(ref)
+		if err != nil {
+			return fmt.Errorf("invalid related document %q", ref)
+		}
+		t.DocumentID = id
+	}
+	return nil
+}
+
+// Done reports whether the task has finished, successfully or not.
+func (t *Task) Done() bool {
+	return t.Status == TaskSuccess || t.Status == TaskFailure || t.Status == TaskRevoked
+}
+
+// duplicateID matches the ID of the existing document in the result of a
+// task Paperless failed because it is a duplicate, e.g. "Not consuming
+// a.pdf: It is a duplicate of Bill (#12)". Older versions omit the ID.
+var duplicateID = regexp.MustCompile(`\(#(\d+)\)`)
+
+// Duplicate reports whether the task failed because Paperless already has
+// the document, and returns the ID of the existing one, zero if Paperless
+// does not name it.
+func (t *Task) Duplicate() (documentID int, ok bool) {
+	if t.Status != TaskFailure || !strings.Contains(strings.ToLower(t.Result), "is a duplicate of") {
+		return 0, false
+	}
+	if m := duplicateID.FindStringSubmatch(t.Result); m != nil {
+		documentID, _ = strconv.Atoi(m[1])
+	}
+	return documentID, true
+}
+
+// GetTask fetches the consumption task with the given task ID.
+func (c *Client) GetTask(taskID string) (*Task, error) {
+	if err := c.require("consumption tasks", func(caps Capabilities) bool { return caps.Tasks }); err != nil {
+		return nil, err
+	}
+	resp, err := c.do("GET", "/api/tasks/?task_id="+url.QueryEscape(taskID), nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logging.Warnf("Error closing response body: %v", err)
+		}
+	}()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get task: received status code %d, body: %s", resp.StatusCode, string(respBody))
+	}
+
+	// The endpoint returns a plain list when filtering by task ID.
+	var tasks []Task
+	if err := json.Unmarshal(respBody, &tasks); err != nil {
+		var page struct {
+			Results []Task `json:"results"`
+		}
+		if err := json.Unmarshal(respBody, &page); err != nil {
+			return nil, fmt.Errorf("failed to decode task response: %w", err)
+		}
+		tasks = page.Results
+	}
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("task %s not found", taskID)
+	}
+	return &tasks[0], nil
+}
+
+// WaitForTask polls the task every interval until it has finished or timeout
+// has passed. Tasks that are not known yet are polled again, as Paperless
+// registers them asynchronously.
+func (c *Client) WaitForTask(taskID string, interval, timeout time.Duration) (*Task, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		task, err := c.GetTask(taskID)
+		if err == nil && task.Done() {
+			return task, nil
+		}
+		if IsUnsupported(err) {
+			return nil, err
+		}
+		if time.Now().Add(interval).After(deadline) {
+			if err != nil {
+				return nil, fmt.Errorf("timed out waiting for task %s: %w", taskID, err)
+			}
+			return task, fmt.Errorf("timed out waiting for task %s (status %s)", taskID, task.Status)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,101 @@
+package paperless
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTask(t *testing.T) {
+	t.Run("string document id", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/api/tasks/", r.URL.Path)
+			assert.Equal(t, "abc", r.URL.Query().Get("task_id"))
+			fmt.Fprint(w, `[{"id": 1, "task_id": "abc", "status": "SUCCESS", "result": "Success. New document id 42 created", "related_document": "42"}]`)
+		}))
+		defer server.Close()
+
+		task, err := NewClient(server.URL, "test_key").GetTask("abc")
+		assert.NoError(t, err)
+		assert.Equal(t, TaskSuccess, task.Status)
+		assert.Equal(t, 42, task.DocumentID)
+		assert.True(t, task.Done())
+	})
+
+	t.Run("numeric document id", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"results": [{"task_id": "abc", "status": "SUCCESS", "related_document": 7}]}`)
+		}))
+		defer server.Close()
+
+		task, err := NewClient(server.URL, "test_key").GetTask("abc")
+		assert.NoError(t, err)
+		assert.Equal(t, 7, task.DocumentID)
+	})
+
+	t.Run("unknown task", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `[]`)
+		}))
+		defer server.Close()
+
+		_, err := NewClient(server.URL, "test_key").GetTask("abc")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not found")
+	})
+}
+
+func TestWaitForTask(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch polls.Add(1) {
+		case 1:
+			fmt.Fprint(w, `[]`)
+		case 2:
+			fmt.Fprint(w, `[{"task_id": "abc", "status": "STARTED", "related_document": null}]`)
+		default:
+			fmt.Fprint(w, `[{"task_id": "abc", "status": "FAILURE", "result": "duplicate document"}]`)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "test_key")
+	task, err := client.WaitForTask("abc", time.Millisecond, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, TaskFailure, task.Status)
+	assert.Equal(t, "duplicate document", task.Result)
+	assert.Equal(t, int32(3), polls.Load())
+
+	_, err = client.WaitForTask("abc", 10*time.Millisecond, 0)
+	assert.NoError(t, err)
+
+	polls.Store(1)
+	_, err = client.WaitForTask("abc", 10*time.Millisecond, 5*time.Millisecond)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out")
+}
+
+func TestTaskDuplicate(t *testing.T) {
+	task := &Task{Status: TaskFailure, Result: "Not consuming a.pdf: It is a duplicate of Bill (#12)."}
+	id, ok := task.Duplicate()
+	assert.True(t, ok)
+	assert.Equal(t, 12, id)
+
+	task.Result = "a.pdf: Not consuming a.pdf: It is a duplicate of Bill (#12). Note: existing document is in the trash."
+	id, ok = task.Duplicate()
+	assert.True(t, ok)
+	assert.Equal(t, 12, id)
+
+	task.Result = "Not consuming a.pdf: It is a duplicate of Bill."
+	id, ok = task.Duplicate()
+	assert.True(t, ok)
+	assert.Zero(t, id)
+
+	_, ok = (&Task{Status: TaskFailure, Result: "Unsupported mime type"}).Duplicate()
+	assert.False(t, ok)
+}
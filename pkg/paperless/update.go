@@ -0,0 +1,133 @@
+package paperless
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+)
+
+// CustomField is a custom field defined in Paperless-ngx.
+type CustomField struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	// DataType is e.g. "string", "integer", "float", "boolean", "date",
+	// "url" or "monetary".
+	DataType string `json:"data_type"`
+}
+
+// CustomFieldValue is the value of a custom field on a document.
+type CustomFieldValue struct {
+	Field int `json:"field"`
+	Value any `json:"value"`
+}
+
+// User is a Paperless-ngx user.
+type User struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+// Group is a Paperless-ngx group of users.
+type Group struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// PermissionSet lists the users and groups granted a permission.
+type PermissionSet struct {
+	Users  []int `json:"users"`
+	Groups []int `json:"groups"`
+}
+
+// Permissions are the object permissions of a document.
+type Permissions struct {
+	View   PermissionSet `json:"view"`
+	Change PermissionSet `json:"change"`
+}
+
+// DocumentUpdate holds the fields changed by UpdateDocument. Nil fields
+// are left as they are. CustomFields replaces all custom fields of the
+// document.
+type DocumentUpdate struct {
+	CustomFields   []CustomFieldValue `json:"custom_fields,omitempty"`
+	Owner          *int               `json:"owner,omitempty"`
+	SetPermissions *Permissions       `json:"set_permissions,omitempty"`
+}
+
+// GetCustomFields fetches all custom fields from Paperless-ngx.
+func (c *Client) GetCustomFields() ([]CustomField, error) {
+	if err := c.require("custom fields", func(caps Capabilities) bool { return caps.CustomFields }); err != nil {
+		return nil, err
+	}
+	return getAll[CustomField](c, "/api/custom_fields/", nil, 0)
+}
+
+// GetUsers fetches all users from Paperless-ngx.
+func (c *Client) GetUsers() ([]User, error) {
+	return getAll[User](c, "/api/users/", nil, 0)
+}
+
+// GetGroups fetches all groups from Paperless-ngx.
+func (c *Client) GetGroups() ([]Group, error) {
+	return getAll[Group](c, "/api/groups/", nil, 0)
+}
+
+// GetDocument fetches the document with the given ID.
+func (c *Client) GetDocument(id int) (*Document, error) {
+	var doc Document
+	if err := c.sendJSON("GET", fmt.Sprintf("/api/documents/%d/", id), nil, http.StatusOK, &doc); err != nil {
+		return nil, fmt.Errorf("failed to get document %d: %w", id, err)
+	}
+	return &doc, nil
+}
+
+// UpdateDocument changes fields of the document with the given ID.
+func (c *Client) UpdateDocument(id int, update DocumentUpdate) error {
+	if err := c.sendJSON("PATCH", fmt.Sprintf("/api/documents/%d/", id), update, http.StatusOK, nil); err != nil {
+		return fmt.Errorf("failed to update document %d: %w", id, err)
+	}
+	return nil
+}
+
+// AddNote adds a note to the document with the given ID.
+func (c *Client) AddNote(id int, note string) error {
+	if err := c.sendJSON("POST", fmt.Sprintf("/api/documents/%d/notes/", id), map[string]string{"note": note}, http.StatusOK, nil); err != nil {
+		return fmt.Errorf("failed to add note to document %d: %w", id, err)
+	}
+	return nil
+}
+
+// sendJSON sends body encoded as JSON, unless nil, and decodes the
+// response into result, unless nil. A status other than want is an error.
+func (c *Client) sendJSON(method, path string, body any, want int, result any) error {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader, contentType = bytes.NewReader(payload), "application/json"
+	}
+	resp, err := c.do(method, path, reader, contentType)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logging.Warnf("Error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode != want {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("received status code %d, body: %s", resp.StatusCode, string(respBody))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
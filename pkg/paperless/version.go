@@ -0,0 +1,148 @@
+package paperless
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+)
+
+// APIVersion is the newest version of the REST API the client was written
+// against. Servers supporting it are asked for it; older ones for their
+// newest version.
+const APIVersion = 5
+
+// MinAPIVersion is the oldest API version the client works with. Version 1
+// reports tag colours in another format.
+const MinAPIVersion = 2
+
+// Capabilities describe what a server supports.
+type Capabilities struct {
+	// APIVersion is the negotiated version sent with every request, zero
+	// if the server did not report its versions.
+	APIVersion int
+	// ServerVersion is the Paperless-ngx version, if reported.
+	ServerVersion string
+	// StoragePaths, CustomFields and Tasks report whether the server has
+	// these endpoints.
+	StoragePaths bool
+	CustomFields bool
+	Tasks        bool
+}
+
+// Missing returns the names of the optional features the server lacks.
+func (c Capabilities) Missing() []string {
+	var missing []string
+	for _, f := range []struct {
+		name string
+		ok   bool
+	}{
+		{"storage paths", c.StoragePaths},
+		{"custom fields", c.CustomFields},
+		{"consumption tasks", c.Tasks},
+	} {
+		if !f.ok {
+			missing = append(missing, f.name)
+		}
+	}
+	return missing
+}
+
+// UnsupportedError is returned when a feature is used that the server
+// does not support.
+type UnsupportedError struct {
+	Feature       string
+	ServerVersion string
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.ServerVersion == "" {
+		return fmt.Sprintf("%s are not supported by this Paperless version", e.Feature)
+	}
+	return fmt.Sprintf("%s are not supported by Paperless %s", e.Feature, e.ServerVersion)
+}
+
+// IsUnsupported reports whether err is an UnsupportedError.
+func IsUnsupported(err error) bool {
+	var unsupported *UnsupportedError
+	return errors.As(err, &unsupported)
+}
+
+// Negotiate asks the server for the API versions it supports and the
+// endpoints it has. Afterwards every request asks for the newest version
+// both sides support, and the features the server lacks fail with an
+// UnsupportedError instead of an unexplained 404. Without a negotiation
+// all features are tried and the server's default version is used.
+func (c *Client) Negotiate() (Capabilities, error) {
+	resp, err := c.do("GET", "/api/", nil, "")
+	if err != nil {
+		return Capabilities{}, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			logging.Warnf("Error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return Capabilities{}, fmt.Errorf("failed to detect the API version: received status code %d", resp.StatusCode)
+	}
+
+	caps := Capabilities{ServerVersion: resp.Header.Get("X-Version"), StoragePaths: true, CustomFields: true, Tasks: true}
+	if v := resp.Header.Get("X-Api-Version"); v != "" {
+		newest, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return Capabilities{}, fmt.Errorf("invalid API version %q reported by the server", v)
+		}
+		if newest < MinAPIVersion {
+			return Capabilities{}, fmt.Errorf("the API version %d of the server is too old, at least %d is needed; upgrade Paperless-ngx", newest, MinAPIVersion)
+		}
+		caps.APIVersion = min(newest, APIVersion)
+	}
+	// The API root lists the endpoints. Servers that don't are assumed to
+	// have them all.
+	var endpoints map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&endpoints); err == nil && len(endpoints) > 0 {
+		_, caps.StoragePaths = endpoints["storage_paths"]
+		_, caps.CustomFields = endpoints["custom_fields"]
+		_, caps.Tasks = endpoints["tasks"]
+	}
+
+	c.capsMu.Lock()
+	c.caps = &caps
+	c.capsMu.Unlock()
+	return caps, nil
+}
+
+// Capabilities returns what Negotiate detected, and false if it did not
+// succeed yet.
+func (c *Client) Capabilities() (Capabilities, bool) {
+	c.capsMu.Lock()
+	defer c.capsMu.Unlock()
+	if c.caps == nil {
+		return Capabilities{}, false
+	}
+	return *c.caps, true
+}
+
+// require returns an UnsupportedError if the negotiation found that the
+// server lacks the feature.
+func (c *Client) require(feature string, has func(Capabilities) bool) error {
+	caps, ok := c.Capabilities()
+	if !ok || has(caps) {
+		return nil
+	}
+	return &UnsupportedError{Feature: feature, ServerVersion: caps.ServerVersion}
+}
+
+// accept returns the Accept header asking for the negotiated API version.
+func (c *Client) accept() string {
+	caps, ok := c.Capabilities()
+	if !ok || caps.APIVersion == 0 {
+		return "application/json"
+	}
+	return fmt.Sprintf("application/json; version=%d", caps.APIVersion)
+}
@@ -0,0 +1,91 @@
+package paperless
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiate(t *testing.T) {
+	t.Run("newer server", func(t *testing.T) {
+		var accept []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accept = append(accept, r.Header.Get("Accept"))
+			switch r.URL.Path {
+			case "/api/":
+				w.Header().Set("X-Version", "2.14.7")
+				w.Header().Set("X-Api-Version", "9")
+				w.Write([]byte(`{"tags": "/api/tags/", "storage_paths": "/api/storage_paths/", "custom_fields": "/api/custom_fields/", "tasks": "/api/tasks/"}`))
+			default:
+				w.Write([]byte(`{"results": []}`))
+			}
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		_, ok := client.Capabilities()
+		assert.False(t, ok)
+		caps, err := client.Negotiate()
+		assert.NoError(t, err)
+		assert.Equal(t, Capabilities{APIVersion: APIVersion, ServerVersion: "2.14.7", StoragePaths: true, CustomFields: true, Tasks: true}, caps)
+		assert.Empty(t, caps.Missing())
+		_, err = client.GetStoragePaths()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"application/json", "application/json; version=5"}, accept)
+	})
+
+	t.Run("older server", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/" {
+				t.Errorf("unexpected request to %s", r.URL.Path)
+				return
+			}
+			w.Header().Set("X-Version", "1.7.1")
+			w.Header().Set("X-Api-Version", "2")
+			w.Write([]byte(`{"tags": "/api/tags/", "documents": "/api/documents/"}`))
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		caps, err := client.Negotiate()
+		assert.NoError(t, err)
+		assert.Equal(t, 2, caps.APIVersion)
+		assert.Equal(t, []string{"storage paths", "custom fields", "consumption tasks"}, caps.Missing())
+
+		_, err = client.GetStoragePaths()
+		assert.EqualError(t, err, "storage paths are not supported by Paperless 1.7.1")
+		_, err = client.WaitForTask("abc", time.Millisecond, time.Minute)
+		assert.True(t, IsUnsupported(err))
+	})
+
+	t.Run("too old", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Api-Version", "1")
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		_, err := client.Negotiate()
+		assert.ErrorContains(t, err, "the API version 1 of the server is too old")
+		_, ok := client.Capabilities()
+		assert.False(t, ok)
+	})
+
+	t.Run("no version reported", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "application/json", r.Header.Get("Accept"))
+		}))
+		defer server.Close()
+
+		client := NewClient(server.URL, "test_key")
+		caps, err := client.Negotiate()
+		assert.NoError(t, err)
+		assert.Equal(t, Capabilities{StoragePaths: true, CustomFields: true, Tasks: true}, caps)
+		_, err = client.GetStoragePaths()
+		assert.Error(t, err)
+		assert.False(t, IsUnsupported(err))
+	})
+}
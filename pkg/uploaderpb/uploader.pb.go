@@ -0,0 +1,1042 @@
+// The gRPC API of a running 'paperless-uploader watch', enabled with the
+// grpc section of the config file. Regenerate the Go code with
+// 'task proto'.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        v5.28.3
+// source: uploader.proto
+
+package uploaderpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type UploadRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Data:
+	//
+	//	*UploadRequest_Metadata
+	//	*UploadRequest_Chunk
+	Data          isUploadRequest_Data `protobuf_oneof:"data"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadRequest) Reset() {
+	*x = UploadRequest{}
+	mi := &file_uploader_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadRequest) ProtoMessage() {}
+
+func (x *UploadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadRequest.ProtoReflect.Descriptor instead.
+func (*UploadRequest) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UploadRequest) GetData() isUploadRequest_Data {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetMetadata() *UploadMetadata {
+	if x != nil {
+		if x, ok := x.Data.(*UploadRequest_Metadata); ok {
+			return x.Metadata
+		}
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Data.(*UploadRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isUploadRequest_Data interface {
+	isUploadRequest_Data()
+}
+
+type UploadRequest_Metadata struct {
+	Metadata *UploadMetadata `protobuf:"bytes,1,opt,name=metadata,proto3,oneof"`
+}
+
+type UploadRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*UploadRequest_Metadata) isUploadRequest_Data() {}
+
+func (*UploadRequest_Chunk) isUploadRequest_Data() {}
+
+// UploadMetadata describes an uploaded document. Unset fields are derived
+// from the file name by the folder's rules, if the other fields are unset as
+// well.
+type UploadMetadata struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Filename string                 `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
+	// folder is the watch folder receiving the document; it defaults to the
+	// first watch folder.
+	Folder string `protobuf:"bytes,2,opt,name=folder,proto3" json:"folder,omitempty"`
+	Title  string `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	// created is the creation date, e.g. "2024-01-31".
+	Created string `protobuf:"bytes,4,opt,name=created,proto3" json:"created,omitempty"`
+	// correspondent, document_type, storage_path and tags are names or IDs.
+	Correspondent string   `protobuf:"bytes,5,opt,name=correspondent,proto3" json:"correspondent,omitempty"`
+	DocumentType  string   `protobuf:"bytes,6,opt,name=document_type,json=documentType,proto3" json:"document_type,omitempty"`
+	StoragePath   string   `protobuf:"bytes,7,opt,name=storage_path,json=storagePath,proto3" json:"storage_path,omitempty"`
+	Tags          []string `protobuf:"bytes,8,rep,name=tags,proto3" json:"tags,omitempty"`
+	Asn           int32    `protobuf:"varint,9,opt,name=asn,proto3" json:"asn,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadMetadata) Reset() {
+	*x = UploadMetadata{}
+	mi := &file_uploader_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadMetadata) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadMetadata) ProtoMessage() {}
+
+func (x *UploadMetadata) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadMetadata.ProtoReflect.Descriptor instead.
+func (*UploadMetadata) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UploadMetadata) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *UploadMetadata) GetFolder() string {
+	if x != nil {
+		return x.Folder
+	}
+	return ""
+}
+
+func (x *UploadMetadata) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *UploadMetadata) GetCreated() string {
+	if x != nil {
+		return x.Created
+	}
+	return ""
+}
+
+func (x *UploadMetadata) GetCorrespondent() string {
+	if x != nil {
+		return x.Correspondent
+	}
+	return ""
+}
+
+func (x *UploadMetadata) GetDocumentType() string {
+	if x != nil {
+		return x.DocumentType
+	}
+	return ""
+}
+
+func (x *UploadMetadata) GetStoragePath() string {
+	if x != nil {
+		return x.StoragePath
+	}
+	return ""
+}
+
+func (x *UploadMetadata) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *UploadMetadata) GetAsn() int32 {
+	if x != nil {
+		return x.Asn
+	}
+	return 0
+}
+
+type UploadResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// path is where the document was stored on the uploader's host.
+	Path          string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Size          int64  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadResponse) Reset() {
+	*x = UploadResponse{}
+	mi := &file_uploader_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadResponse) ProtoMessage() {}
+
+func (x *UploadResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadResponse.ProtoReflect.Descriptor instead.
+func (*UploadResponse) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *UploadResponse) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *UploadResponse) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type GetStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusRequest) Reset() {
+	*x = GetStatusRequest{}
+	mi := &file_uploader_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusRequest) ProtoMessage() {}
+
+func (x *GetStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{3}
+}
+
+type Status struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Watching  bool                   `protobuf:"varint,1,opt,name=watching,proto3" json:"watching,omitempty"`
+	StartedAt *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	// queue_depth counts files waiting to settle or to be uploaded.
+	QueueDepth    int32           `protobuf:"varint,3,opt,name=queue_depth,json=queueDepth,proto3" json:"queue_depth,omitempty"`
+	InFlight      int32           `protobuf:"varint,4,opt,name=in_flight,json=inFlight,proto3" json:"in_flight,omitempty"`
+	RetryBacklog  int32           `protobuf:"varint,5,opt,name=retry_backlog,json=retryBacklog,proto3" json:"retry_backlog,omitempty"`
+	Paused        bool            `protobuf:"varint,6,opt,name=paused,proto3" json:"paused,omitempty"`
+	Folders       []*FolderStatus `protobuf:"bytes,7,rep,name=folders,proto3" json:"folders,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Status) Reset() {
+	*x = Status{}
+	mi := &file_uploader_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Status) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Status) ProtoMessage() {}
+
+func (x *Status) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Status.ProtoReflect.Descriptor instead.
+func (*Status) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Status) GetWatching() bool {
+	if x != nil {
+		return x.Watching
+	}
+	return false
+}
+
+func (x *Status) GetStartedAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.StartedAt
+	}
+	return nil
+}
+
+func (x *Status) GetQueueDepth() int32 {
+	if x != nil {
+		return x.QueueDepth
+	}
+	return 0
+}
+
+func (x *Status) GetInFlight() int32 {
+	if x != nil {
+		return x.InFlight
+	}
+	return 0
+}
+
+func (x *Status) GetRetryBacklog() int32 {
+	if x != nil {
+		return x.RetryBacklog
+	}
+	return 0
+}
+
+func (x *Status) GetPaused() bool {
+	if x != nil {
+		return x.Paused
+	}
+	return false
+}
+
+func (x *Status) GetFolders() []*FolderStatus {
+	if x != nil {
+		return x.Folders
+	}
+	return nil
+}
+
+type FolderStatus struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Path            string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Uploaded        int32                  `protobuf:"varint,2,opt,name=uploaded,proto3" json:"uploaded,omitempty"`
+	Failed          int32                  `protobuf:"varint,3,opt,name=failed,proto3" json:"failed,omitempty"`
+	LastSuccess     *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=last_success,json=lastSuccess,proto3" json:"last_success,omitempty"`
+	LastSuccessFile string                 `protobuf:"bytes,5,opt,name=last_success_file,json=lastSuccessFile,proto3" json:"last_success_file,omitempty"`
+	LastFailure     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=last_failure,json=lastFailure,proto3" json:"last_failure,omitempty"`
+	LastFailureFile string                 `protobuf:"bytes,7,opt,name=last_failure_file,json=lastFailureFile,proto3" json:"last_failure_file,omitempty"`
+	LastError       string                 `protobuf:"bytes,8,opt,name=last_error,json=lastError,proto3" json:"last_error,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *FolderStatus) Reset() {
+	*x = FolderStatus{}
+	mi := &file_uploader_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FolderStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FolderStatus) ProtoMessage() {}
+
+func (x *FolderStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FolderStatus.ProtoReflect.Descriptor instead.
+func (*FolderStatus) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *FolderStatus) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *FolderStatus) GetUploaded() int32 {
+	if x != nil {
+		return x.Uploaded
+	}
+	return 0
+}
+
+func (x *FolderStatus) GetFailed() int32 {
+	if x != nil {
+		return x.Failed
+	}
+	return 0
+}
+
+func (x *FolderStatus) GetLastSuccess() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSuccess
+	}
+	return nil
+}
+
+func (x *FolderStatus) GetLastSuccessFile() string {
+	if x != nil {
+		return x.LastSuccessFile
+	}
+	return ""
+}
+
+func (x *FolderStatus) GetLastFailure() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastFailure
+	}
+	return nil
+}
+
+func (x *FolderStatus) GetLastFailureFile() string {
+	if x != nil {
+		return x.LastFailureFile
+	}
+	return ""
+}
+
+func (x *FolderStatus) GetLastError() string {
+	if x != nil {
+		return x.LastError
+	}
+	return ""
+}
+
+type WatchEventsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEventsRequest) Reset() {
+	*x = WatchEventsRequest{}
+	mi := &file_uploader_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEventsRequest) ProtoMessage() {}
+
+func (x *WatchEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEventsRequest.ProtoReflect.Descriptor instead.
+func (*WatchEventsRequest) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{6}
+}
+
+// Event describes a change in the state of a file, see the watcher's event
+// types.
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// type is e.g. "detected", "uploaded", "upload_failed" or "consumed".
+	Type string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Time *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	// id correlates the events of one file.
+	Id            string `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	Folder        string `protobuf:"bytes,4,opt,name=folder,proto3" json:"folder,omitempty"`
+	Path          string `protobuf:"bytes,5,opt,name=path,proto3" json:"path,omitempty"`
+	Attempt       int32  `protobuf:"varint,6,opt,name=attempt,proto3" json:"attempt,omitempty"`
+	TaskId        string `protobuf:"bytes,7,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
+	DocumentId    int32  `protobuf:"varint,8,opt,name=document_id,json=documentId,proto3" json:"document_id,omitempty"`
+	Url           string `protobuf:"bytes,9,opt,name=url,proto3" json:"url,omitempty"`
+	Dest          string `protobuf:"bytes,10,opt,name=dest,proto3" json:"dest,omitempty"`
+	Error         string `protobuf:"bytes,11,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_uploader_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Event) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Event) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Event) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Event) GetFolder() string {
+	if x != nil {
+		return x.Folder
+	}
+	return ""
+}
+
+func (x *Event) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *Event) GetAttempt() int32 {
+	if x != nil {
+		return x.Attempt
+	}
+	return 0
+}
+
+func (x *Event) GetTaskId() string {
+	if x != nil {
+		return x.TaskId
+	}
+	return ""
+}
+
+func (x *Event) GetDocumentId() int32 {
+	if x != nil {
+		return x.DocumentId
+	}
+	return 0
+}
+
+func (x *Event) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Event) GetDest() string {
+	if x != nil {
+		return x.Dest
+	}
+	return ""
+}
+
+func (x *Event) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type PauseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PauseRequest) Reset() {
+	*x = PauseRequest{}
+	mi := &file_uploader_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PauseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PauseRequest) ProtoMessage() {}
+
+func (x *PauseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PauseRequest.ProtoReflect.Descriptor instead.
+func (*PauseRequest) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{8}
+}
+
+type PauseResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PauseResponse) Reset() {
+	*x = PauseResponse{}
+	mi := &file_uploader_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PauseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PauseResponse) ProtoMessage() {}
+
+func (x *PauseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PauseResponse.ProtoReflect.Descriptor instead.
+func (*PauseResponse) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{9}
+}
+
+type ResumeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResumeRequest) Reset() {
+	*x = ResumeRequest{}
+	mi := &file_uploader_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResumeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResumeRequest) ProtoMessage() {}
+
+func (x *ResumeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResumeRequest.ProtoReflect.Descriptor instead.
+func (*ResumeRequest) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{10}
+}
+
+type ResumeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResumeResponse) Reset() {
+	*x = ResumeResponse{}
+	mi := &file_uploader_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResumeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResumeResponse) ProtoMessage() {}
+
+func (x *ResumeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResumeResponse.ProtoReflect.Descriptor instead.
+func (*ResumeResponse) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{11}
+}
+
+type RescanRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RescanRequest) Reset() {
+	*x = RescanRequest{}
+	mi := &file_uploader_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RescanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RescanRequest) ProtoMessage() {}
+
+func (x *RescanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RescanRequest.ProtoReflect.Descriptor instead.
+func (*RescanRequest) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{12}
+}
+
+type RescanResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RescanResponse) Reset() {
+	*x = RescanResponse{}
+	mi := &file_uploader_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RescanResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RescanResponse) ProtoMessage() {}
+
+func (x *RescanResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_uploader_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RescanResponse.ProtoReflect.Descriptor instead.
+func (*RescanResponse) Descriptor() ([]byte, []int) {
+	return file_uploader_proto_rawDescGZIP(), []int{13}
+}
+
+var File_uploader_proto protoreflect.FileDescriptor
+
+const file_uploader_proto_rawDesc = "" +
+	"\n" +
+	"\x0euploader.proto\x12\x15paperless_uploader.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"t\n" +
+	"\rUploadRequest\x12C\n" +
+	"\bmetadata\x18\x01 \x01(\v2%.paperless_uploader.v1.UploadMetadataH\x00R\bmetadata\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\x06\n" +
+	"\x04data\"\x88\x02\n" +
+	"\x0eUploadMetadata\x12\x1a\n" +
+	"\bfilename\x18\x01 \x01(\tR\bfilename\x12\x16\n" +
+	"\x06folder\x18\x02 \x01(\tR\x06folder\x12\x14\n" +
+	"\x05title\x18\x03 \x01(\tR\x05title\x12\x18\n" +
+	"\acreated\x18\x04 \x01(\tR\acreated\x12$\n" +
+	"\rcorrespondent\x18\x05 \x01(\tR\rcorrespondent\x12#\n" +
+	"\rdocument_type\x18\x06 \x01(\tR\fdocumentType\x12!\n" +
+	"\fstorage_path\x18\a \x01(\tR\vstoragePath\x12\x12\n" +
+	"\x04tags\x18\b \x03(\tR\x04tags\x12\x10\n" +
+	"\x03asn\x18\t \x01(\x05R\x03asn\"8\n" +
+	"\x0eUploadResponse\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\"\x12\n" +
+	"\x10GetStatusRequest\"\x99\x02\n" +
+	"\x06Status\x12\x1a\n" +
+	"\bwatching\x18\x01 \x01(\bR\bwatching\x129\n" +
+	"\n" +
+	"started_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\tstartedAt\x12\x1f\n" +
+	"\vqueue_depth\x18\x03 \x01(\x05R\n" +
+	"queueDepth\x12\x1b\n" +
+	"\tin_flight\x18\x04 \x01(\x05R\binFlight\x12#\n" +
+	"\rretry_backlog\x18\x05 \x01(\x05R\fretryBacklog\x12\x16\n" +
+	"\x06paused\x18\x06 \x01(\bR\x06paused\x12=\n" +
+	"\afolders\x18\a \x03(\v2#.paperless_uploader.v1.FolderStatusR\afolders\"\xcb\x02\n" +
+	"\fFolderStatus\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x1a\n" +
+	"\buploaded\x18\x02 \x01(\x05R\buploaded\x12\x16\n" +
+	"\x06failed\x18\x03 \x01(\x05R\x06failed\x12=\n" +
+	"\flast_success\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\vlastSuccess\x12*\n" +
+	"\x11last_success_file\x18\x05 \x01(\tR\x0flastSuccessFile\x12=\n" +
+	"\flast_failure\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\vlastFailure\x12*\n" +
+	"\x11last_failure_file\x18\a \x01(\tR\x0flastFailureFile\x12\x1d\n" +
+	"\n" +
+	"last_error\x18\b \x01(\tR\tlastError\"\x14\n" +
+	"\x12WatchEventsRequest\"\x97\x02\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x0e\n" +
+	"\x02id\x18\x03 \x01(\tR\x02id\x12\x16\n" +
+	"\x06folder\x18\x04 \x01(\tR\x06folder\x12\x12\n" +
+	"\x04path\x18\x05 \x01(\tR\x04path\x12\x18\n" +
+	"\aattempt\x18\x06 \x01(\x05R\aattempt\x12\x17\n" +
+	"\atask_id\x18\a \x01(\tR\x06taskId\x12\x1f\n" +
+	"\vdocument_id\x18\b \x01(\x05R\n" +
+	"documentId\x12\x10\n" +
+	"\x03url\x18\t \x01(\tR\x03url\x12\x12\n" +
+	"\x04dest\x18\n" +
+	" \x01(\tR\x04dest\x12\x14\n" +
+	"\x05error\x18\v \x01(\tR\x05error\"\x0e\n" +
+	"\fPauseRequest\"\x0f\n" +
+	"\rPauseResponse\"\x0f\n" +
+	"\rResumeRequest\"\x10\n" +
+	"\x0eResumeResponse\"\x0f\n" +
+	"\rRescanRequest\"\x10\n" +
+	"\x0eRescanResponse2\x94\x04\n" +
+	"\bUploader\x12W\n" +
+	"\x06Upload\x12$.paperless_uploader.v1.UploadRequest\x1a%.paperless_uploader.v1.UploadResponse(\x01\x12S\n" +
+	"\tGetStatus\x12'.paperless_uploader.v1.GetStatusRequest\x1a\x1d.paperless_uploader.v1.Status\x12X\n" +
+	"\vWatchEvents\x12).paperless_uploader.v1.WatchEventsRequest\x1a\x1c.paperless_uploader.v1.Event0\x01\x12R\n" +
+	"\x05Pause\x12#.paperless_uploader.v1.PauseRequest\x1a$.paperless_uploader.v1.PauseResponse\x12U\n" +
+	"\x06Resume\x12$.paperless_uploader.v1.ResumeRequest\x1a%.paperless_uploader.v1.ResumeResponse\x12U\n" +
+	"\x06Rescan\x12$.paperless_uploader.v1.RescanRequest\x1a%.paperless_uploader.v1.RescanResponseB7Z5github.com/c-yco/go-paperless-uploader/pkg/uploaderpbb\x06proto3"
+
+var (
+	file_uploader_proto_rawDescOnce sync.Once
+	file_uploader_proto_rawDescData []byte
+)
+
+func file_uploader_proto_rawDescGZIP() []byte {
+	file_uploader_proto_rawDescOnce.Do(func() {
+		file_uploader_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_uploader_proto_rawDesc), len(file_uploader_proto_rawDesc)))
+	})
+	return file_uploader_proto_rawDescData
+}
+
+var file_uploader_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_uploader_proto_goTypes = []any{
+	(*UploadRequest)(nil),         // 0: paperless_uploader.v1.UploadRequest
+	(*UploadMetadata)(nil),        // 1: paperless_uploader.v1.UploadMetadata
+	(*UploadResponse)(nil),        // 2: paperless_uploader.v1.UploadResponse
+	(*GetStatusRequest)(nil),      // 3: paperless_uploader.v1.GetStatusRequest
+	(*Status)(nil),                // 4: paperless_uploader.v1.Status
+	(*FolderStatus)(nil),          // 5: paperless_uploader.v1.FolderStatus
+	(*WatchEventsRequest)(nil),    // 6: paperless_uploader.v1.WatchEventsRequest
+	(*Event)(nil),                 // 7: paperless_uploader.v1.Event
+	(*PauseRequest)(nil),          // 8: paperless_uploader.v1.PauseRequest
+	(*PauseResponse)(nil),         // 9: paperless_uploader.v1.PauseResponse
+	(*ResumeRequest)(nil),         // 10: paperless_uploader.v1.ResumeRequest
+	(*ResumeResponse)(nil),        // 11: paperless_uploader.v1.ResumeResponse
+	(*RescanRequest)(nil),         // 12: paperless_uploader.v1.RescanRequest
+	(*RescanResponse)(nil),        // 13: paperless_uploader.v1.RescanResponse
+	(*timestamppb.Timestamp)(nil), // 14: google.protobuf.Timestamp
+}
+var file_uploader_proto_depIdxs = []int32{
+	1,  // 0: paperless_uploader.v1.UploadRequest.metadata:type_name -> paperless_uploader.v1.UploadMetadata
+	14, // 1: paperless_uploader.v1.Status.started_at:type_name -> google.protobuf.Timestamp
+	5,  // 2: paperless_uploader.v1.Status.folders:type_name -> paperless_uploader.v1.FolderStatus
+	14, // 3: paperless_uploader.v1.FolderStatus.last_success:type_name -> google.protobuf.Timestamp
+	14, // 4: paperless_uploader.v1.FolderStatus.last_failure:type_name -> google.protobuf.Timestamp
+	14, // 5: paperless_uploader.v1.Event.time:type_name -> google.protobuf.Timestamp
+	0,  // 6: paperless_uploader.v1.Uploader.Upload:input_type -> paperless_uploader.v1.UploadRequest
+	3,  // 7: paperless_uploader.v1.Uploader.GetStatus:input_type -> paperless_uploader.v1.GetStatusRequest
+	6,  // 8: paperless_uploader.v1.Uploader.WatchEvents:input_type -> paperless_uploader.v1.WatchEventsRequest
+	8,  // 9: paperless_uploader.v1.Uploader.Pause:input_type -> paperless_uploader.v1.PauseRequest
+	10, // 10: paperless_uploader.v1.Uploader.Resume:input_type -> paperless_uploader.v1.ResumeRequest
+	12, // 11: paperless_uploader.v1.Uploader.Rescan:input_type -> paperless_uploader.v1.RescanRequest
+	2,  // 12: paperless_uploader.v1.Uploader.Upload:output_type -> paperless_uploader.v1.UploadResponse
+	4,  // 13: paperless_uploader.v1.Uploader.GetStatus:output_type -> paperless_uploader.v1.Status
+	7,  // 14: paperless_uploader.v1.Uploader.WatchEvents:output_type -> paperless_uploader.v1.Event
+	9,  // 15: paperless_uploader.v1.Uploader.Pause:output_type -> paperless_uploader.v1.PauseResponse
+	11, // 16: paperless_uploader.v1.Uploader.Resume:output_type -> paperless_uploader.v1.ResumeResponse
+	13, // 17: paperless_uploader.v1.Uploader.Rescan:output_type -> paperless_uploader.v1.RescanResponse
+	12, // [12:18] is the sub-list for method output_type
+	6,  // [6:12] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_uploader_proto_init() }
+func file_uploader_proto_init() {
+	if File_uploader_proto != nil {
+		return
+	}
+	file_uploader_proto_msgTypes[0].OneofWrappers = []any{
+		(*UploadRequest_Metadata)(nil),
+		(*UploadRequest_Chunk)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_uploader_proto_rawDesc), len(file_uploader_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_uploader_proto_goTypes,
+		DependencyIndexes: file_uploader_proto_depIdxs,
+		MessageInfos:      file_uploader_proto_msgTypes,
+	}.Build()
+	File_uploader_proto = out.File
+	file_uploader_proto_goTypes = nil
+	file_uploader_proto_depIdxs = nil
+}
@@ -0,0 +1,334 @@
+// The gRPC API of a running 'paperless-uploader watch', enabled with the
+// grpc section of the config file. Regenerate the Go code with
+// 'task proto'.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.28.3
+// source: uploader.proto
+
+package uploaderpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Uploader_Upload_FullMethodName      = "/paperless_uploader.v1.Uploader/Upload"
+	Uploader_GetStatus_FullMethodName   = "/paperless_uploader.v1.Uploader/GetStatus"
+	Uploader_WatchEvents_FullMethodName = "/paperless_uploader.v1.Uploader/WatchEvents"
+	Uploader_Pause_FullMethodName       = "/paperless_uploader.v1.Uploader/Pause"
+	Uploader_Resume_FullMethodName      = "/paperless_uploader.v1.Uploader/Resume"
+	Uploader_Rescan_FullMethodName      = "/paperless_uploader.v1.Uploader/Rescan"
+)
+
+// UploaderClient is the client API for Uploader service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Uploader controls the watcher and feeds documents into it. Calls must carry
+// the configured token as "authorization: Bearer <token>" metadata.
+type UploaderClient interface {
+	// Upload streams a document into a watch folder, from where it is
+	// uploaded like any other file. The first message carries the metadata,
+	// the following ones the content.
+	Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadRequest, UploadResponse], error)
+	// GetStatus returns the runtime state of the watcher.
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*Status, error)
+	// WatchEvents streams the events of every file handled from now on.
+	WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+	// Pause stops starting new uploads until Resume is called.
+	Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*PauseResponse, error)
+	// Resume continues processing after Pause.
+	Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*ResumeResponse, error)
+	// Rescan looks for files in the watch folders that were not picked up.
+	Rescan(ctx context.Context, in *RescanRequest, opts ...grpc.CallOption) (*RescanResponse, error)
+}
+
+type uploaderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUploaderClient(cc grpc.ClientConnInterface) UploaderClient {
+	return &uploaderClient{cc}
+}
+
+func (c *uploaderClient) Upload(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadRequest, UploadResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Uploader_ServiceDesc.Streams[0], Uploader_Upload_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadRequest, UploadResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Uploader_UploadClient = grpc.ClientStreamingClient[UploadRequest, UploadResponse]
+
+func (c *uploaderClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*Status, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Status)
+	err := c.cc.Invoke(ctx, Uploader_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uploaderClient) WatchEvents(ctx context.Context, in *WatchEventsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Uploader_ServiceDesc.Streams[1], Uploader_WatchEvents_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchEventsRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Uploader_WatchEventsClient = grpc.ServerStreamingClient[Event]
+
+func (c *uploaderClient) Pause(ctx context.Context, in *PauseRequest, opts ...grpc.CallOption) (*PauseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PauseResponse)
+	err := c.cc.Invoke(ctx, Uploader_Pause_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uploaderClient) Resume(ctx context.Context, in *ResumeRequest, opts ...grpc.CallOption) (*ResumeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ResumeResponse)
+	err := c.cc.Invoke(ctx, Uploader_Resume_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uploaderClient) Rescan(ctx context.Context, in *RescanRequest, opts ...grpc.CallOption) (*RescanResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RescanResponse)
+	err := c.cc.Invoke(ctx, Uploader_Rescan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UploaderServer is the server API for Uploader service.
+// All implementations must embed UnimplementedUploaderServer
+// for forward compatibility.
+//
+// Uploader controls the watcher and feeds documents into it. Calls must carry
+// the configured token as "authorization: Bearer <token>" metadata.
+type UploaderServer interface {
+	// Upload streams a document into a watch folder, from where it is
+	// uploaded like any other file. The first message carries the metadata,
+	// the following ones the content.
+	Upload(grpc.ClientStreamingServer[UploadRequest, UploadResponse]) error
+	// GetStatus returns the runtime state of the watcher.
+	GetStatus(context.Context, *GetStatusRequest) (*Status, error)
+	// WatchEvents streams the events of every file handled from now on.
+	WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error
+	// Pause stops starting new uploads until Resume is called.
+	Pause(context.Context, *PauseRequest) (*PauseResponse, error)
+	// Resume continues processing after Pause.
+	Resume(context.Context, *ResumeRequest) (*ResumeResponse, error)
+	// Rescan looks for files in the watch folders that were not picked up.
+	Rescan(context.Context, *RescanRequest) (*RescanResponse, error)
+	mustEmbedUnimplementedUploaderServer()
+}
+
+// UnimplementedUploaderServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedUploaderServer struct{}
+
+func (UnimplementedUploaderServer) Upload(grpc.ClientStreamingServer[UploadRequest, UploadResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Upload not implemented")
+}
+func (UnimplementedUploaderServer) GetStatus(context.Context, *GetStatusRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedUploaderServer) WatchEvents(*WatchEventsRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchEvents not implemented")
+}
+func (UnimplementedUploaderServer) Pause(context.Context, *PauseRequest) (*PauseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pause not implemented")
+}
+func (UnimplementedUploaderServer) Resume(context.Context, *ResumeRequest) (*ResumeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resume not implemented")
+}
+func (UnimplementedUploaderServer) Rescan(context.Context, *RescanRequest) (*RescanResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rescan not implemented")
+}
+func (UnimplementedUploaderServer) mustEmbedUnimplementedUploaderServer() {}
+func (UnimplementedUploaderServer) testEmbeddedByValue()                  {}
+
+// UnsafeUploaderServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UploaderServer will
+// result in compilation errors.
+type UnsafeUploaderServer interface {
+	mustEmbedUnimplementedUploaderServer()
+}
+
+func RegisterUploaderServer(s grpc.ServiceRegistrar, srv UploaderServer) {
+	// If the following call pancis, it indicates UnimplementedUploaderServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Uploader_ServiceDesc, srv)
+}
+
+func _Uploader_Upload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UploaderServer).Upload(&grpc.GenericServerStream[UploadRequest, UploadResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Uploader_UploadServer = grpc.ClientStreamingServer[UploadRequest, UploadResponse]
+
+func _Uploader_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UploaderServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Uploader_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UploaderServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Uploader_WatchEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UploaderServer).WatchEvents(m, &grpc.GenericServerStream[WatchEventsRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Uploader_WatchEventsServer = grpc.ServerStreamingServer[Event]
+
+func _Uploader_Pause_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PauseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UploaderServer).Pause(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Uploader_Pause_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UploaderServer).Pause(ctx, req.(*PauseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Uploader_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResumeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UploaderServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Uploader_Resume_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UploaderServer).Resume(ctx, req.(*ResumeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Uploader_Rescan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RescanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UploaderServer).Rescan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Uploader_Rescan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UploaderServer).Rescan(ctx, req.(*RescanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Uploader_ServiceDesc is the grpc.ServiceDesc for Uploader service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Uploader_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "paperless_uploader.v1.Uploader",
+	HandlerType: (*UploaderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStatus",
+			Handler:    _Uploader_GetStatus_Handler,
+		},
+		{
+			MethodName: "Pause",
+			Handler:    _Uploader_Pause_Handler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    _Uploader_Resume_Handler,
+		},
+		{
+			MethodName: "Rescan",
+			Handler:    _Uploader_Rescan_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Upload",
+			Handler:       _Uploader_Upload_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchEvents",
+			Handler:       _Uploader_WatchEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "uploader.proto",
+}
@@ -0,0 +1,128 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+)
+
+// defaultBreakerProbe is the probe interval used when BreakerProbe is not
+// positive.
+const defaultBreakerProbe = 30 * time.Second
+
+// errCircuitOpen is the cause of files spooled without an attempt because
+// the circuit is open.
+var errCircuitOpen = errors.New("circuit open: Paperless is unavailable")
+
+// isOutage reports whether err shows Paperless to be down: unreachable or
+// answering with a server error.
+func isOutage(err error) bool {
+	if err == nil {
+		return false
+	}
+	var uploadErr *paperless.UploadError
+	if errors.As(err, &uploadErr) {
+		return uploadErr.StatusCode >= http.StatusInternalServerError
+	}
+	return paperless.IsUnavailable(err)
+}
+
+// recordOutcome counts consecutive uploads failing with an outage and opens
+// the circuit once there are BreakerThreshold of them.
+func (w *Watcher) recordOutcome(ctx context.Context, err error) {
+	if w.BreakerThreshold <= 0 {
+		return
+	}
+	w.mu.Lock()
+	if !isOutage(err) {
+		w.outageFailures = 0
+		w.mu.Unlock()
+		return
+	}
+	w.outageFailures++
+	if w.outageFailures < w.BreakerThreshold || w.circuit != nil {
+		w.mu.Unlock()
+		return
+	}
+	w.circuit = make(chan struct{})
+	w.circuitSince = time.Now()
+	w.status.CircuitOpen = true
+	failures := w.outageFailures
+	w.mu.Unlock()
+
+	w.logger().Error("Paperless unavailable, holding uploads until it recovers", "failures", failures, "probe_interval", w.BreakerProbe, logging.KeyError, err)
+	w.emit(Event{Type: EventCircuitOpened, Attempt: failures, Err: err})
+	go w.probe(ctx)
+}
+
+// probe pings the server every BreakerProbe while the circuit is open and
+// closes it once the server answers.
+func (w *Watcher) probe(ctx context.Context) {
+	interval := w.BreakerProbe
+	if interval <= 0 {
+		interval = defaultBreakerProbe
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := w.client.Ping(); err != nil {
+			w.logger().Debug("Paperless still unavailable", logging.KeyError, err)
+			continue
+		}
+		w.mu.Lock()
+		close(w.circuit)
+		w.circuit = nil
+		w.outageFailures = 0
+		w.status.CircuitOpen = false
+		outage := time.Since(w.circuitSince)
+		w.mu.Unlock()
+		w.logger().Info("Paperless available again, resuming uploads", "outage", outage.Round(time.Second))
+		w.emit(Event{Type: EventCircuitClosed, Duration: outage})
+		return
+	}
+}
+
+// circuitOpen reports whether uploads are held because Paperless is down.
+func (w *Watcher) circuitOpen() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.circuit != nil
+}
+
+// waitCircuit blocks while the circuit is open. Files are let through once
+// the outage is long enough to copy them to FallbackDir, and right away if
+// they are spooled to SpoolDir instead. It returns false if ctx was
+// cancelled first.
+func (w *Watcher) waitCircuit(ctx context.Context) bool {
+	if w.SpoolDir != "" {
+		return true
+	}
+	w.mu.Lock()
+	circuit := w.circuit
+	var fallback <-chan time.Time
+	if circuit != nil && w.FallbackDir != "" && !w.apiDownSince.IsZero() {
+		timer := time.NewTimer(time.Until(w.apiDownSince.Add(w.FallbackAfter)))
+		defer timer.Stop()
+		fallback = timer.C
+	}
+	w.mu.Unlock()
+	if circuit == nil {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-circuit:
+	case <-fallback:
+	}
+	return true
+}
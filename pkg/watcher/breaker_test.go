@@ -0,0 +1,94 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsOutage(t *testing.T) {
+	assert.False(t, isOutage(nil))
+	assert.False(t, isOutage(errors.New("not a PDF")))
+	assert.False(t, isOutage(&paperless.UploadError{StatusCode: http.StatusBadRequest}))
+	assert.True(t, isOutage(&paperless.UploadError{StatusCode: http.StatusInternalServerError}))
+	_, err := paperless.NewClient("http://127.0.0.1:1", "test_key").UploadFile(filepath.Join(t.TempDir(), "missing.pdf"), paperless.UploadOptions{})
+	assert.False(t, isOutage(err))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		down    atomic.Bool
+		uploads atomic.Int32
+	)
+	down.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/" {
+			uploads.Add(1)
+		}
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	watchDir := t.TempDir()
+	for _, name := range []string{"a.pdf", "b.pdf", "c.pdf"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(watchDir, name), []byte("pdf"), 0644))
+	}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: watchDir}})
+	w.MaxRetries = 10
+	w.RetryDelay = 10 * time.Millisecond
+	w.BreakerThreshold = 2
+	w.BreakerProbe = 20 * time.Millisecond
+	var (
+		mu     sync.Mutex
+		events []Event
+	)
+	w.OnEvent(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Type == EventCircuitOpened || e.Type == EventCircuitClosed {
+			events = append(events, e)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	// Uploads are held once two failed in a row.
+	assert.Eventually(t, func() bool { return w.Status().CircuitOpen }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(2), uploads.Load())
+
+	// They resume once the server answers the probe.
+	down.Store(false)
+	assert.Eventually(t, func() bool { return w.Status().Folders[0].Uploaded == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, w.Status().CircuitOpen)
+	assert.Zero(t, w.Status().Folders[0].Failed)
+
+	mu.Lock()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, EventCircuitOpened, events[0].Type)
+		assert.Equal(t, 2, events[0].Attempt)
+		assert.Error(t, events[0].Err)
+		assert.Equal(t, EventCircuitClosed, events[1].Type)
+		assert.Positive(t, events[1].Duration)
+	}
+	mu.Unlock()
+
+	cancel()
+	assert.NoError(t, <-done)
+}
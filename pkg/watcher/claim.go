@@ -0,0 +1,178 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+)
+
+// claimSuffix is appended to the name of a file to name the marker by which
+// an instance claims it.
+const claimSuffix = ".claim.json"
+
+// Claim is the marker an instance creates next to a file before uploading
+// it, so instances sharing a folder upload every file once. A claim is held
+// while its file is uploaded or waits for a retry; its modification time is
+// renewed meanwhile, so the claims of a stopped instance become stale.
+type Claim struct {
+	Instance string `json:"instance"`
+	// Uploaded is set once the file was uploaded and left in place. Such a
+	// claim keeps other instances from uploading the file again while its
+	// size and modification time are unchanged.
+	Uploaded bool      `json:"uploaded,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	ModTime  time.Time `json:"mod_time,omitzero"`
+	Time     time.Time `json:"time"`
+}
+
+// claim claims path for the instance. It returns nil once the claim is held,
+// or the claim of the instance that holds it or uploaded the file. Claims of
+// this instance left by an earlier run and stale claims are taken over.
+func (w *Watcher) claim(path string) (*Claim, error) {
+	marker := path + claimSuffix
+	// The marker may be removed between the attempts by its owner.
+	for range 3 {
+		f, err := os.OpenFile(marker, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return nil, w.writeClaim(path, Claim{Instance: w.Instance})
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to claim file: %v", err)
+		}
+
+		other, age, err := readClaim(marker)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			// A claim still being written is held by its owner.
+			if age < w.ClaimTimeout {
+				return &Claim{}, nil
+			}
+		} else if other.Uploaded {
+			if info, err := os.Stat(path); err == nil && info.Size() == other.Size && info.ModTime().Equal(other.ModTime) {
+				return other, nil
+			}
+		} else if other.Instance != w.Instance && age < w.ClaimTimeout {
+			return other, nil
+		}
+		// The file changed since its upload, or the claim was left by
+		// this instance or one that stopped.
+		if err := os.Remove(marker); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to take over claim: %v", err)
+		}
+	}
+	return nil, errors.New("failed to claim file: claimed concurrently")
+}
+
+// readClaim reads the claim marker and returns the time since it was last
+// renewed.
+func readClaim(marker string) (*Claim, time.Duration, error) {
+	info, err := os.Stat(marker)
+	if err != nil {
+		return nil, 0, err
+	}
+	age := time.Since(info.ModTime())
+	data, err := os.ReadFile(marker)
+	if err != nil {
+		return nil, age, err
+	}
+	var c Claim
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, age, err
+	}
+	return &c, age, nil
+}
+
+// writeClaim writes the claim of path and renews it until released.
+func (w *Watcher) writeClaim(path string, c Claim) error {
+	c.Time = time.Now()
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+claimSuffix, data, 0644); err != nil {
+		return fmt.Errorf("failed to write claim: %v", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.claims[path] = true
+	return nil
+}
+
+// holdsClaim reports whether the instance holds the claim of path.
+func (w *Watcher) holdsClaim(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.claims[path]
+}
+
+// releaseClaim removes the claim of path, which was moved or deleted, or
+// whose upload failed. Files that were uploaded and are still at path keep
+// a claim marking them as uploaded.
+func (w *Watcher) releaseClaim(path string, uploaded bool) {
+	if !w.holdsClaim(path) {
+		return
+	}
+	w.mu.Lock()
+	delete(w.claims, path)
+	w.mu.Unlock()
+	if uploaded {
+		if info, err := os.Stat(path); err == nil {
+			c := Claim{Instance: w.Instance, Uploaded: true, Size: info.Size(), ModTime: info.ModTime(), Time: time.Now()}
+			data, _ := json.Marshal(c)
+			if err := os.WriteFile(path+claimSuffix, data, 0644); err != nil {
+				w.logger().Warn("Failed to mark file as uploaded", logging.KeyFile, path, logging.KeyError, err)
+			}
+			return
+		}
+	}
+	if err := os.Remove(path + claimSuffix); err != nil && !os.IsNotExist(err) {
+		w.logger().Warn("Failed to release claim", logging.KeyFile, path, logging.KeyError, err)
+	}
+}
+
+// releaseClaims removes the claims still held once the watcher stopped, so
+// other instances pick the files up right away.
+func (w *Watcher) releaseClaims() {
+	w.mu.Lock()
+	var paths []string
+	for path := range w.claims {
+		paths = append(paths, path)
+	}
+	w.mu.Unlock()
+	for _, path := range paths {
+		w.releaseClaim(path, false)
+	}
+}
+
+// renewClaims renews the claims held until ctx is cancelled.
+func (w *Watcher) renewClaims(ctx context.Context) {
+	ticker := time.NewTicker(w.ClaimTimeout / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		w.mu.Lock()
+		var paths []string
+		for path := range w.claims {
+			paths = append(paths, path)
+		}
+		w.mu.Unlock()
+		now := time.Now()
+		for _, path := range paths {
+			if err := os.Chtimes(path+claimSuffix, now, now); err != nil && w.holdsClaim(path) {
+				w.logger().Warn("Failed to renew claim", logging.KeyFile, path, logging.KeyError, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaims(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		uploads = make(map[string]int)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		_, header, err := r.FormFile("document")
+		assert.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		uploads[header.Filename]++
+		mu.Unlock()
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+
+	shared := t.TempDir()
+	names := []string{"a.pdf", "b.pdf", "c.pdf", "d.pdf", "e.pdf", "f.pdf"}
+	for _, name := range names {
+		assert.NoError(t, os.WriteFile(filepath.Join(shared, name), []byte(name), 0644))
+	}
+	newWatcher := func(instance string) *Watcher {
+		w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: shared}})
+		w.Instance = instance
+		return w
+	}
+
+	// Two instances scanning the same folder upload every file once.
+	var wg sync.WaitGroup
+	for _, instance := range []string{"nas1", "nas2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, newWatcher(instance).Scan(context.Background()))
+		}()
+	}
+	wg.Wait()
+	for _, name := range names {
+		assert.Equal(t, 1, uploads[name], name)
+	}
+	data, err := os.ReadFile(filepath.Join(shared, "a.pdf.claim.json"))
+	assert.NoError(t, err)
+	var claim Claim
+	assert.NoError(t, json.Unmarshal(data, &claim))
+	assert.True(t, claim.Uploaded)
+	assert.True(t, IsSidecar(filepath.Join(shared, "a.pdf.claim.json")))
+
+	// Files left in place stay uploaded until they change.
+	assert.NoError(t, os.WriteFile(filepath.Join(shared, "b.pdf"), []byte("changed"), 0644))
+	assert.NoError(t, newWatcher("nas2").Scan(context.Background()))
+	assert.Equal(t, 1, uploads["a.pdf"])
+	assert.Equal(t, 2, uploads["b.pdf"])
+
+	// Claims of another instance are respected until they are stale.
+	dir := t.TempDir()
+	for _, name := range []string{"held.pdf", "stale.pdf"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name+claimSuffix), []byte(`{"instance": "nas3"}`), 0644))
+	}
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "stale.pdf"+claimSuffix), old, old))
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: dir, PostUploadAction: "delete"}})
+	w.Instance = "nas1"
+	assert.NoError(t, w.Scan(context.Background()))
+	assert.Equal(t, 0, uploads["held.pdf"])
+	assert.Equal(t, 1, uploads["stale.pdf"])
+	assert.FileExists(t, filepath.Join(dir, "held.pdf"+claimSuffix))
+	assert.NoFileExists(t, filepath.Join(dir, "stale.pdf"))
+	assert.NoFileExists(t, filepath.Join(dir, "stale.pdf"+claimSuffix))
+	assert.Equal(t, 1, w.Status().Folders[0].Uploaded)
+}
@@ -0,0 +1,66 @@
+package watcher
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// partialSuffix marks a file that is still being written by Deliver.
+const partialSuffix = ".partial"
+
+// IsPartial reports whether path is a document still being written by
+// Deliver. The watcher ignores such files.
+func IsPartial(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".") && strings.HasSuffix(path, partialSuffix)
+}
+
+// Deliver writes the document read from r to dir under name, for sources
+// that receive documents over the network. The file appears under its final
+// name only once it is complete, so the watcher never sees a partial
+// document. An existing file is not overwritten; the name gets a numeric
+// suffix instead. It returns the path of the document.
+func Deliver(dir, name string, r io.Reader) (string, error) {
+	name = SafeFileName(name)
+	tmp, err := os.CreateTemp(dir, "."+name+".*"+partialSuffix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	dest := uniquePath(filepath.Join(dir, name))
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to store %s: %w", name, err)
+	}
+	return dest, nil
+}
+
+// SafeFileName returns the last element of a file name received from a
+// remote sender, with characters that are invalid in file names on common
+// platforms replaced.
+func SafeFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Trim(name, ". ")
+	if name == "" {
+		return "document"
+	}
+	return name
+}
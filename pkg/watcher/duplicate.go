@@ -0,0 +1,143 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/atrest"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+)
+
+// Policies of Folder.OnDuplicate for files Paperless does not consume
+// because it already has the document.
+const (
+	// DuplicateSuccess treats the upload as done and runs the post-upload
+	// action.
+	DuplicateSuccess = "success"
+	// DuplicateMove moves the file to Folder.DuplicatesFolder.
+	DuplicateMove = "move"
+	// DuplicateReupload uploads the file again as a new document, with its
+	// title marking it as a duplicate. Paperless recognizes duplicates by
+	// their checksum, so a comment is appended to PDFs to change it;
+	// other files fail.
+	DuplicateReupload = "reupload"
+	// DuplicateFail handles the file like one that failed to upload: it is
+	// moved to the failed folder if there is one, else left in place.
+	DuplicateFail = "fail"
+)
+
+// DuplicatePolicies are the valid values of Folder.OnDuplicate besides
+// empty.
+var DuplicatePolicies = []string{DuplicateSuccess, DuplicateMove, DuplicateReupload, DuplicateFail}
+
+// handleDuplicate applies the duplicate policy of its folder to j, which
+// Paperless rejected as a duplicate of documentID, zero if unknown, with
+// err.
+func (w *Watcher) handleDuplicate(j job, taskID string, documentID int, err error) {
+	log := w.log(j).With("task_id", taskID, "document_id", documentID)
+	client := w.clientFor(j.folder)
+	e := Event{Type: EventDuplicate, ID: j.id, Folder: j.folder.Path, Path: j.path, Checksum: j.checksum, TaskID: taskID, DocumentID: documentID}
+	if documentID != 0 {
+		e.URL = client.DocumentURL(documentID)
+	}
+	switch j.folder.OnDuplicate {
+	case DuplicateSuccess:
+		log.Info("Paperless already has the document, treating the upload as done", logging.KeyStatus, "duplicate")
+		w.emit(e)
+		w.finish(j, nil)
+		current := w.postUpload(context.Background(), j)
+		j.endTrace(nil)
+		j.complete(nil)
+		if w.Receipts && current != "" && documentID != 0 {
+			receipt := Receipt{Source: j.path, DocumentID: documentID, URL: e.URL, TaskID: taskID, SHA256: j.checksum, Tags: j.opts.Tags, ConsumedAt: time.Now()}
+			if err := WriteReceipt(current, receipt); err != nil {
+				log.Error("Failed to write receipt", logging.KeyError, err)
+			}
+		}
+		return
+	case DuplicateMove:
+		dest, moveErr := moveToDuplicates(j.folder, j.path)
+		if moveErr != nil {
+			log.Error("Failed to move duplicate", logging.KeyError, moveErr)
+			break
+		}
+		log.Info("Paperless already has the document, moved the file", logging.KeyStatus, "duplicate", "dest", dest)
+		w.emit(e)
+		w.emit(Event{Type: EventMoved, ID: j.id, Folder: j.folder.Path, Path: j.path, Dest: dest})
+		w.releaseClaim(j.path, false)
+		w.finish(j, nil)
+		j.endTrace(nil)
+		j.complete(nil)
+		return
+	case DuplicateReupload:
+		if j.reuploaded {
+			break
+		}
+		newTaskID, uploadErr := w.reupload(j, documentID)
+		if uploadErr != nil {
+			log.Error("Failed to upload the duplicate again", logging.KeyError, uploadErr)
+			break
+		}
+		log.Info("Paperless already has the document, uploaded it again", logging.KeyStatus, "duplicate", "new_task_id", newTaskID)
+		w.emit(e)
+		j.reuploaded = true
+		w.awaitConsumption(j, newTaskID, j.path, true)
+		return
+	}
+	log.Warn("Paperless did not create the document", logging.KeyError, err)
+	w.emit(Event{Type: EventConsumeFailed, ID: j.id, Folder: j.folder.Path, Path: j.path, TaskID: taskID, Err: err})
+	w.keepUnverified(j, err)
+}
+
+// reupload uploads j again with a title marking it as a duplicate of
+// documentID and returns the new consumption task.
+func (w *Watcher) reupload(j job, documentID int) (string, error) {
+	if paperless.DetectMimeType(j.path, nil) != "application/pdf" {
+		return "", errors.New("only PDFs can be uploaded again as duplicates")
+	}
+	f, err := os.Open(j.path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	opts := j.opts
+	if opts.Title == "" {
+		opts.Title = strings.TrimSuffix(filepath.Base(j.path), filepath.Ext(j.path))
+	}
+	if documentID != 0 {
+		opts.Title += fmt.Sprintf(" (duplicate of #%d)", documentID)
+	} else {
+		opts.Title += " (duplicate)"
+	}
+	// PDF readers ignore comments after the end of the file.
+	marker := fmt.Sprintf("\n%% uploaded again by paperless-uploader at %s\n", time.Now().UTC().Format(time.RFC3339Nano))
+	return w.clientFor(j.folder).UploadReader(filepath.Base(j.path), io.MultiReader(f, strings.NewReader(marker)), opts)
+}
+
+// moveToDuplicates moves filePath to the duplicates folder of folder and
+// returns its new path.
+func moveToDuplicates(folder Folder, filePath string) (string, error) {
+	if err := os.MkdirAll(folder.DuplicatesFolder, 0755); err != nil {
+		return "", fmt.Errorf("failed to create duplicates folder '%s': %v", folder.DuplicatesFolder, err)
+	}
+	dest := filepath.Join(folder.DuplicatesFolder, filepath.Base(filePath))
+	if encrypts(folder, filePath) {
+		dest = uniquePath(dest + atrest.Suffix)
+		if err := atrest.EncryptFile(folder.EncryptionKey, filePath, dest); err != nil {
+			return "", fmt.Errorf("failed to encrypt file %s to %s: %v", filePath, dest, err)
+		}
+		return dest, nil
+	}
+	dest = uniquePath(dest)
+	if err := os.Rename(filePath, dest); err != nil {
+		return "", fmt.Errorf("failed to move file %s to %s: %v", filePath, dest, err)
+	}
+	return dest, nil
+}
@@ -0,0 +1,103 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+)
+
+// errorReportSuffix is appended to the name of a failed file to name its
+// error report.
+const errorReportSuffix = ".error.json"
+
+// ErrorReport describes a file that failed for good in enough detail to
+// triage it without the logs. It is stored next to the file, in the failed
+// folder if the file was moved there.
+type ErrorReport struct {
+	// File is the original path of the file.
+	File   string `json:"file"`
+	Folder string `json:"folder"`
+	// Profile names the configuration the watcher ran with.
+	Profile  string    `json:"profile,omitempty"`
+	FailedAt time.Time `json:"failed_at"`
+	Error    string    `json:"error"`
+	// StatusCode and ResponseBody are those of the last response of
+	// Paperless, if it answered.
+	StatusCode   int    `json:"status_code,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	// Attempts lists every attempt, the last one included.
+	Attempts []Attempt `json:"attempts"`
+}
+
+// Attempt is one failed attempt to process a file.
+type Attempt struct {
+	Time       time.Time     `json:"time"`
+	Duration   time.Duration `json:"duration_ns"`
+	Error      string        `json:"error"`
+	StatusCode int           `json:"status_code,omitempty"`
+}
+
+// newAttempt records err, returned after an attempt of duration.
+func newAttempt(err error, duration time.Duration) Attempt {
+	a := Attempt{Time: time.Now(), Duration: duration, Error: err.Error()}
+	var uploadErr *paperless.UploadError
+	if errors.As(err, &uploadErr) {
+		a.StatusCode = uploadErr.StatusCode
+	}
+	return a
+}
+
+// writeErrorReport stores the error report of j, which failed with err,
+// next to the file at path.
+func (w *Watcher) writeErrorReport(j job, path string, err error) {
+	report := ErrorReport{
+		File:     j.path,
+		Folder:   j.folder.Path,
+		Profile:  w.Profile,
+		FailedAt: time.Now(),
+		Error:    err.Error(),
+		Attempts: j.history,
+	}
+	var uploadErr *paperless.UploadError
+	if errors.As(err, &uploadErr) {
+		report.StatusCode, report.ResponseBody = uploadErr.StatusCode, uploadErr.Body
+	}
+	if werr := WriteErrorReport(path, report); werr != nil {
+		w.log(j).Error("Failed to write error report", logging.KeyError, werr)
+	}
+}
+
+// WriteErrorReport stores the error report of the failed file at path, with
+// the secrets registered with logging.AddSecret redacted.
+func WriteErrorReport(path string, report ErrorReport) error {
+	report.Error = logging.Redact(report.Error)
+	report.ResponseBody = logging.Redact(report.ResponseBody)
+	attempts := make([]Attempt, len(report.Attempts))
+	for i, a := range report.Attempts {
+		a.Error = logging.Redact(a.Error)
+		attempts[i] = a
+	}
+	report.Attempts = attempts
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode error report: %v", err)
+	}
+	if err := os.WriteFile(path+errorReportSuffix, data, 0644); err != nil {
+		return fmt.Errorf("failed to write error report: %v", err)
+	}
+	return nil
+}
+
+// RemoveErrorReport deletes the error report of the file at path, if any.
+func RemoveErrorReport(path string) error {
+	err := os.Remove(path + errorReportSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
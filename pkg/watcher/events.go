@@ -0,0 +1,116 @@
+package watcher
+
+import "time"
+
+// EventType identifies what happened to a file.
+type EventType string
+
+// Event types emitted by the watcher.
+const (
+	// EventWatching is emitted when the watcher starts watching its
+	// folders.
+	EventWatching EventType = "watching"
+	// EventDetected is emitted when a new file is found in a folder.
+	EventDetected EventType = "detected"
+	// EventHashed is emitted once the checksum of a file is known.
+	EventHashed EventType = "hashed"
+	// EventUploadStarted is emitted when an upload attempt begins.
+	EventUploadStarted EventType = "upload_started"
+	// EventUploadProgress is emitted while the file is being sent.
+	EventUploadProgress EventType = "upload_progress"
+	// EventUploaded is emitted after a successful upload.
+	EventUploaded EventType = "uploaded"
+	// EventRetryScheduled is emitted when a failed upload will be retried.
+	EventRetryScheduled EventType = "retry_scheduled"
+	// EventUploadFailed is emitted when an upload failed for good.
+	EventUploadFailed EventType = "upload_failed"
+	// EventConsumed is emitted when Paperless created the document of an
+	// upload. It requires Watcher.TrackConsumption.
+	EventConsumed EventType = "consumed"
+	// EventConsumeFailed is emitted when Paperless rejected an upload or
+	// its consumption could not be tracked.
+	EventConsumeFailed EventType = "consume_failed"
+	// EventVerifyFailed is emitted when the document created from an upload
+	// does not match the file with Watcher.VerifyChecksum, which keeps the
+	// file.
+	EventVerifyFailed EventType = "verify_failed"
+	// EventMoved is emitted when a file was moved to the processed or the
+	// failed folder.
+	EventMoved EventType = "moved"
+	// EventDeleted is emitted when a file was deleted after its upload.
+	EventDeleted EventType = "deleted"
+	// EventDuplicate is emitted when a file was skipped because it is
+	// identical to one uploaded recently, which requires Watcher.Recent,
+	// or when Paperless rejected it as a duplicate and Folder.OnDuplicate
+	// took care of it.
+	EventDuplicate EventType = "duplicate"
+	// EventSpooled is emitted when a file was stored in Watcher.SpoolDir
+	// because Paperless is down.
+	EventSpooled EventType = "spooled"
+	// EventCircuitOpened is emitted when uploads are held because Paperless
+	// is down. It requires Watcher.BreakerThreshold.
+	EventCircuitOpened EventType = "circuit_opened"
+	// EventCircuitClosed is emitted when Paperless recovered and the held
+	// uploads resume.
+	EventCircuitClosed EventType = "circuit_closed"
+)
+
+// Event describes a change in the state of a watched file.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// ID correlates the events of one file with its log records.
+	ID     string
+	Folder string
+	Path   string
+	// Attempt is the zero-based upload attempt, or the number of failed
+	// uploads for EventCircuitOpened.
+	Attempt int
+	// Sent and Total are the bytes sent so far and the request size, set
+	// for EventUploadProgress. Total is also set for EventUploaded.
+	Sent, Total int64
+	// Duration is how long the upload attempt took, set for EventUploaded,
+	// EventRetryScheduled and EventUploadFailed, and how long the outage
+	// lasted for EventCircuitClosed.
+	Duration time.Duration
+	// Checksum is the hex encoded SHA-256 of the file, set for EventHashed
+	// and EventDuplicate.
+	Checksum string
+	// Original is the recently uploaded file a duplicate is identical to,
+	// set for EventDuplicate.
+	Original string
+	// TaskID is the Paperless consumption task, set for EventUploaded,
+	// EventConsumed and EventConsumeFailed, and for EventDuplicate of
+	// files Paperless rejected.
+	TaskID string
+	// DocumentID and URL identify the created document, set for
+	// EventConsumed and EventVerifyFailed, or the existing one for
+	// EventDuplicate of files Paperless rejected, if it named it.
+	DocumentID int
+	URL        string
+	// Dest is the new path of the file, set for EventMoved and
+	// EventSpooled, and the copy
+	// in the fallback consume directory for EventUploaded of files that
+	// were not sent through the API.
+	Dest string
+	// Err is the error, set for EventRetryScheduled, EventUploadFailed,
+	// EventConsumeFailed, EventVerifyFailed, EventCircuitOpened, and for
+	// EventSpooled the outage.
+	Err error
+}
+
+// OnEvent registers fn to be called for every event. Listeners are called
+// synchronously from the watcher's goroutines and must not block. OnEvent
+// must be called before Run or Scan.
+func (w *Watcher) OnEvent(fn func(Event)) {
+	w.listeners = append(w.listeners, fn)
+}
+
+func (w *Watcher) emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, fn := range w.listeners {
+		fn(e)
+	}
+}
@@ -0,0 +1,134 @@
+package watcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/atrest"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+)
+
+// failedSuffix is appended to the name of a failed file to name its record.
+const failedSuffix = ".failed.json"
+
+// FailedRecord describes why a file in the failed folder could not be
+// uploaded. It is stored next to the file.
+type FailedRecord struct {
+	// Folder is the watch folder the file was found in.
+	Folder string `json:"folder"`
+	// Source is the original path of the file.
+	Source   string    `json:"source"`
+	TagNames []string  `json:"tags,omitempty"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+	Attempts int       `json:"attempts"`
+}
+
+// FailedFile is a file in the failed folder.
+type FailedFile struct {
+	Path   string
+	Record FailedRecord
+}
+
+// MoveToFailed moves filePath into the folder's failed folder, records the
+// error next to it and returns the new path.
+func MoveToFailed(folder Folder, filePath string, attempts int, uploadErr error) (string, error) {
+	if err := os.MkdirAll(folder.FailedFolder, 0755); err != nil {
+		return "", fmt.Errorf("failed to create failed folder '%s': %v", folder.FailedFolder, err)
+	}
+	dest := filepath.Join(folder.FailedFolder, filepath.Base(filePath))
+	if encrypts(folder, filePath) {
+		dest = uniquePath(dest + atrest.Suffix)
+		if err := atrest.EncryptFile(folder.EncryptionKey, filePath, dest); err != nil {
+			return "", fmt.Errorf("failed to encrypt file %s to %s: %v", filePath, dest, err)
+		}
+	} else {
+		dest = uniquePath(dest)
+		if err := os.Rename(filePath, dest); err != nil {
+			return "", fmt.Errorf("failed to move file %s to %s: %v", filePath, dest, err)
+		}
+	}
+	record := FailedRecord{
+		Folder:   folder.Path,
+		Source:   filePath,
+		TagNames: folder.TagNames,
+		Error:    uploadErr.Error(),
+		FailedAt: time.Now(),
+		Attempts: attempts,
+	}
+	if err := WriteFailedRecord(dest, record); err != nil {
+		return dest, err
+	}
+	logging.Infof("Moved failed file %s to %s", filePath, dest)
+	return dest, nil
+}
+
+// uniquePath returns path, or path with a numeric suffix if it exists. The
+// suffix goes before the extension, and before atrest.Suffix of encrypted
+// files.
+func uniquePath(path string) string {
+	encrypted := ""
+	if strings.HasSuffix(path, atrest.Suffix) {
+		encrypted = atrest.Suffix
+	}
+	ext := filepath.Ext(strings.TrimSuffix(path, encrypted))
+	base := strings.TrimSuffix(path, ext+encrypted)
+	candidate := path
+	for i := 1; ; i++ {
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d%s%s", base, i, ext, encrypted)
+	}
+}
+
+// WriteFailedRecord stores the record of the failed file at path, with the
+// secrets registered with logging.AddSecret redacted from its error.
+func WriteFailedRecord(path string, record FailedRecord) error {
+	record.Error = logging.Redact(record.Error)
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode failure record: %v", err)
+	}
+	if err := os.WriteFile(path+failedSuffix, data, 0644); err != nil {
+		return fmt.Errorf("failed to write failure record: %v", err)
+	}
+	return nil
+}
+
+// RemoveFailedRecord deletes the record of the failed file at path.
+func RemoveFailedRecord(path string) error {
+	err := os.Remove(path + failedSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ListFailed returns the files in dir with their failure records. Files
+// without a record get an empty one.
+func ListFailed(dir string) ([]FailedFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []FailedFile
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || IsSidecar(entry.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		file := FailedFile{Path: path}
+		if data, err := os.ReadFile(path + failedSuffix); err == nil {
+			if err := json.Unmarshal(data, &file.Record); err != nil {
+				logging.Warnf("Ignoring invalid failure record for %s: %v", path, err)
+			}
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
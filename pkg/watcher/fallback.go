@@ -0,0 +1,36 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+)
+
+// apiOutage records whether the upload error err shows the API to be
+// unreachable and returns how long it has been so.
+func (w *Watcher) apiOutage(err error) time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err == nil || !paperless.IsUnavailable(err) {
+		w.apiDownSince = time.Time{}
+		return 0
+	}
+	if w.apiDownSince.IsZero() {
+		w.apiDownSince = time.Now()
+	}
+	return time.Since(w.apiDownSince)
+}
+
+// copyToFallback copies filePath into the consume directory dir. The copy
+// appears under its final name only once complete, so Paperless does not
+// consume a partial file.
+func copyToFallback(dir, filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return Deliver(dir, filepath.Base(filePath), f)
+}
@@ -0,0 +1,76 @@
+package watcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumeFallback(t *testing.T) {
+	var (
+		attempts atomic.Int32
+		down     atomic.Bool
+	)
+	down.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+
+	watchDir := t.TempDir()
+	consumeDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(watchDir, "scan.pdf"), []byte("pdf"), 0644))
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: watchDir, PostUploadAction: "delete"}})
+	w.RetryDelay = 10 * time.Millisecond
+	w.FallbackDir = consumeDir
+	w.FallbackAfter = 50 * time.Millisecond
+	var (
+		mu       sync.Mutex
+		uploaded []Event
+	)
+	w.OnEvent(func(e Event) {
+		if e.Type == EventUploaded {
+			mu.Lock()
+			uploaded = append(uploaded, e)
+			mu.Unlock()
+		}
+	})
+
+	// Without retries configured, the file is retried until the outage
+	// lasted long enough and then copied to the consume directory.
+	assert.NoError(t, w.Scan(context.Background()))
+	assert.Greater(t, attempts.Load(), int32(1))
+	data, err := os.ReadFile(filepath.Join(consumeDir, "scan.pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "pdf", string(data))
+	assert.NoFileExists(t, filepath.Join(watchDir, "scan.pdf"))
+	if assert.Len(t, uploaded, 1) {
+		assert.Equal(t, filepath.Join(consumeDir, "scan.pdf"), uploaded[0].Dest)
+		assert.Empty(t, uploaded[0].TaskID)
+	}
+
+	// The API is preferred again once it answers.
+	down.Store(false)
+	assert.NoError(t, os.WriteFile(filepath.Join(watchDir, "next.pdf"), []byte("pdf"), 0644))
+	assert.NoError(t, w.Scan(context.Background()))
+	assert.NoFileExists(t, filepath.Join(consumeDir, "next.pdf"))
+	if assert.Len(t, uploaded, 2) {
+		assert.Equal(t, "task-1", uploaded[1].TaskID)
+		assert.Empty(t, uploaded[1].Dest)
+	}
+	assert.True(t, w.apiDownSince.IsZero())
+}
@@ -0,0 +1,64 @@
+package watcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// receiptSuffix is appended to the name of an uploaded file to name its
+// receipt. Earlier versions used oldReceiptSuffix, whose receipts are still
+// recognized and removed.
+const (
+	receiptSuffix    = ".uploaded.json"
+	oldReceiptSuffix = ".receipt.json"
+)
+
+// Receipt links an uploaded file to the document Paperless created from it.
+// It is stored next to the file once the document exists.
+type Receipt struct {
+	// Source is the path the file was uploaded from.
+	Source     string `json:"source"`
+	DocumentID int    `json:"document_id"`
+	URL        string `json:"url"`
+	TaskID     string `json:"task_id"`
+	SHA256     string `json:"sha256,omitempty"`
+	// Tags are the IDs of the tags the file was uploaded with.
+	Tags       []int     `json:"tags,omitempty"`
+	ConsumedAt time.Time `json:"consumed_at"`
+}
+
+// WriteReceipt stores the receipt of the file at path.
+func WriteReceipt(path string, receipt Receipt) error {
+	data, err := json.MarshalIndent(receipt, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode receipt: %v", err)
+	}
+	if err := os.WriteFile(path+receiptSuffix, data, 0644); err != nil {
+		return fmt.Errorf("failed to write receipt: %v", err)
+	}
+	return nil
+}
+
+// RemoveReceipt deletes the receipt of the file at path, if any.
+func RemoveReceipt(path string) error {
+	for _, suffix := range []string{receiptSuffix, oldReceiptSuffix} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsSidecar reports whether path is a failure record, an error report, a
+// receipt or a claim rather than a document.
+func IsSidecar(path string) bool {
+	for _, suffix := range []string{failedSuffix, errorReportSuffix, receiptSuffix, oldReceiptSuffix, claimSuffix} {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
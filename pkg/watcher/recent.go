@@ -0,0 +1,44 @@
+package watcher
+
+import (
+	"context"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+)
+
+// RecentUploads remembers the checksums of recently uploaded files, so
+// byte-identical files dropped again, e.g. by a double scan or a sync loop,
+// are skipped without asking the server.
+type RecentUploads interface {
+	// RecentUpload returns the file with the SHA-256 checksum that was
+	// uploaded recently, if any.
+	RecentUpload(checksum string) (path string, at time.Time, ok bool)
+	// AddRecentUpload records that the file at path with the SHA-256
+	// checksum was uploaded now.
+	AddRecentUpload(checksum, path string) error
+}
+
+// skipDuplicate runs the post-upload action of j, whose content was
+// uploaded recently from original, instead of uploading it again.
+func (w *Watcher) skipDuplicate(ctx context.Context, j job, original string, at time.Time) {
+	w.log(j).Info("Skipping file identical to one uploaded recently", logging.KeyStatus, "duplicate", "original", original, "uploaded_at", at)
+	w.mu.Lock()
+	delete(w.active, j.path)
+	w.mu.Unlock()
+	w.emit(Event{Type: EventDuplicate, ID: j.id, Folder: j.folder.Path, Path: j.path, Checksum: j.checksum, Original: original})
+	w.postUpload(ctx, j)
+	j.endTrace(nil)
+	j.complete(nil)
+	w.jobDone()
+}
+
+// addRecentUpload records the upload of j.
+func (w *Watcher) addRecentUpload(j job) {
+	if w.Recent == nil || j.checksum == "" {
+		return
+	}
+	if err := w.Recent.AddRecentUpload(j.checksum, j.path); err != nil {
+		w.log(j).Warn("Failed to record recent upload", logging.KeyError, err)
+	}
+}
@@ -0,0 +1,205 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/fsnotify/fsnotify"
+)
+
+// File is a document offered by a Source for upload.
+type File struct {
+	// Path is where the document can be read until the source is told
+	// that it is complete.
+	Path string
+	// Folder holds the settings the document is uploaded with. Its Path
+	// groups the statistics and events of the document; a source should
+	// leave PostUploadAction and FailedFolder empty unless Path is a file
+	// it no longer needs.
+	Folder Folder
+	// Delay postpones the upload, e.g. to give a writer time to finish.
+	Delay time.Duration
+}
+
+// Source feeds documents into a watcher. The watch folders are a source
+// themselves; other sources, e.g. a mailbox or a bucket, are added with
+// Watcher.AddSource.
+type Source interface {
+	// Start begins looking for documents, which are sent on Events, until
+	// ctx is done. It returns once the source is set up.
+	Start(ctx context.Context) error
+	// Events returns the channel the documents are sent on. It must be
+	// closed once the source stopped.
+	Events() <-chan File
+	// Complete is called once f was uploaded, with a nil error, or failed
+	// for good. The source may then remove or archive the document.
+	Complete(f File, err error)
+}
+
+// AddSource makes Run process the documents offered by s in addition to
+// the files in the watch folders. It must be called before Run.
+func (w *Watcher) AddSource(s Source) {
+	w.sources = append(w.sources, s)
+}
+
+// offer is a File together with the source offering it.
+type offer struct {
+	source Source
+	file   File
+}
+
+// startSources starts the sources and forwards their documents to the
+// returned channel.
+func (w *Watcher) startSources(ctx context.Context, sources []Source) (<-chan offer, error) {
+	offers := make(chan offer)
+	for _, s := range sources {
+		if err := s.Start(ctx); err != nil {
+			return nil, err
+		}
+		go func() {
+			for f := range s.Events() {
+				select {
+				case offers <- offer{s, f}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	return offers, nil
+}
+
+// accept schedules a document offered by a source.
+func (w *Watcher) accept(ctx context.Context, o offer) {
+	j := newJob(o.file.Folder, o.file.Path)
+	j.source, j.file = o.source, o.file
+	w.log(j).Debug("New file detected")
+	w.emit(Event{Type: EventDetected, ID: j.id, Folder: j.folder.Path, Path: j.path})
+	w.schedule(ctx, j, o.file.Delay, false)
+}
+
+// folderSource offers the files in the watch folders: those present at
+// startup or on a rescan, and new ones reported by fsnotify.
+type folderSource struct {
+	w       *Watcher
+	folders []Folder
+	fsw     *fsnotify.Watcher
+	files   chan File
+}
+
+func newFolderSource(w *Watcher, folders []Folder) *folderSource {
+	return &folderSource{w: w, folders: folders, files: make(chan File)}
+}
+
+func (s *folderSource) Start(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for _, folder := range s.folders {
+		if err := fsw.Add(folder.Path); err != nil {
+			fsw.Close()
+			return err
+		}
+		s.w.logger().Info("Watching directory", logging.KeyFolder, folder.Path)
+	}
+	s.fsw = fsw
+	go s.run(ctx)
+	return nil
+}
+
+func (s *folderSource) Events() <-chan File {
+	return s.files
+}
+
+// Complete does nothing; the folder's post-upload action has already been
+// run.
+func (s *folderSource) Complete(File, error) {}
+
+func (s *folderSource) run(ctx context.Context) {
+	defer close(s.files)
+	defer func() {
+		if err := s.fsw.Close(); err != nil {
+			s.w.logger().Warn("Error closing watcher", logging.KeyError, err)
+		}
+	}()
+
+	// Also process existing files in the directories
+	s.scan(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-s.fsw.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Create == fsnotify.Create && !ignored(event.Name) {
+				if s.w.backlogFull() {
+					s.w.logger().Debug("Backlog full, leaving new file for a later rescan", logging.KeyFile, event.Name)
+					continue
+				}
+				folder := s.w.folderFor(event.Name)
+				// Wait for the file to be fully written
+				if !s.send(ctx, File{Path: event.Name, Folder: folder, Delay: folder.SettleDelay}) {
+					return
+				}
+			}
+		case err, ok := <-s.fsw.Errors:
+			if !ok {
+				return
+			}
+			s.w.logger().Error("Watcher error", logging.KeyError, err)
+		case <-s.w.rescan:
+			s.w.logger().Debug("Rescanning folders")
+			s.scan(ctx)
+		}
+	}
+}
+
+// scan offers the files currently in the folders.
+func (s *folderSource) scan(ctx context.Context) {
+	for _, folder := range s.folders {
+		s.w.walkFolder(folder, func(path string) bool {
+			return s.send(ctx, File{Path: path, Folder: folder})
+		})
+	}
+}
+
+// send offers f, returning false if ctx was cancelled first.
+func (s *folderSource) send(ctx context.Context, f File) bool {
+	select {
+	case s.files <- f:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// walkFolder calls found for the files in folder that are not pending yet,
+// until it returns false or the backlog is full.
+func (w *Watcher) walkFolder(folder Folder, found func(path string) bool) {
+	err := filepath.Walk(folder.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != folder.Path && IsSyncthingArtifact(path) {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && !ignored(path) {
+			if w.isActive(path) {
+				return nil
+			}
+			if w.backlogFull() || !found(path) {
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		w.logger().Error("Error processing existing files", logging.KeyFolder, folder.Path, logging.KeyError, err)
+	}
+}
@@ -0,0 +1,98 @@
+package watcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSource offers the files sent on its channel.
+type testSource struct {
+	files chan File
+
+	mu        sync.Mutex
+	completed map[string]error
+}
+
+func (s *testSource) Start(ctx context.Context) error {
+	go func() {
+		<-ctx.Done()
+		close(s.files)
+	}()
+	return nil
+}
+
+func (s *testSource) Events() <-chan File {
+	return s.files
+}
+
+func (s *testSource) Complete(f File, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.completed[filepath.Base(f.Path)] = err
+}
+
+func TestSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, header, _ := r.FormFile("document")
+		if header.Filename == "bad.pdf" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+
+	spool := t.TempDir()
+	for _, name := range []string{"good.pdf", "bad.pdf"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(spool, name), []byte("pdf"), 0644))
+	}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: t.TempDir()}})
+	w.MaxRetries = 0
+	source := &testSource{files: make(chan File), completed: make(map[string]error)}
+	w.AddSource(source)
+	var (
+		mu     sync.Mutex
+		events []Event
+	)
+	w.OnEvent(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Type == EventDetected || e.Type == EventUploaded {
+			events = append(events, e)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	remote := Folder{Path: "imap://inbox"}
+	source.files <- File{Path: filepath.Join(spool, "good.pdf"), Folder: remote}
+	source.files <- File{Path: filepath.Join(spool, "bad.pdf"), Folder: remote, Delay: 10 * time.Millisecond}
+	assert.Eventually(t, func() bool {
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		return len(source.completed) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, source.completed["good.pdf"])
+	assert.ErrorContains(t, source.completed["bad.pdf"], "status code 400")
+	// Without a post-upload action the source keeps its files.
+	assert.FileExists(t, filepath.Join(spool, "good.pdf"))
+
+	mu.Lock()
+	assert.Equal(t, EventDetected, events[0].Type)
+	assert.Equal(t, "imap://inbox", events[0].Folder)
+	mu.Unlock()
+
+	cancel()
+	assert.NoError(t, <-done)
+}
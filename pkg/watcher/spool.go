@@ -0,0 +1,396 @@
+package watcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/atrest"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+)
+
+// spoolRecordName is the file in a spool entry that records how its
+// document is uploaded.
+const spoolRecordName = "spool.json"
+
+// SpoolRecord describes a document spooled while Paperless was down,
+// together with the metadata resolved for it.
+type SpoolRecord struct {
+	// Source is the path the file was found at.
+	Source    string    `json:"source"`
+	Folder    string    `json:"folder"`
+	SpooledAt time.Time `json:"spooled_at"`
+
+	Title               string `json:"title,omitempty"`
+	Created             string `json:"created,omitempty"`
+	Tags                []int  `json:"tags,omitempty"`
+	Correspondent       *int   `json:"correspondent,omitempty"`
+	DocumentType        *int   `json:"document_type,omitempty"`
+	StoragePath         *int   `json:"storage_path,omitempty"`
+	ArchiveSerialNumber *int   `json:"archive_serial_number,omitempty"`
+	// PostUploadAction is the action of the folder. The original was
+	// moved into the spool unless the action leaves it in place.
+	PostUploadAction string `json:"post_upload_action,omitempty"`
+	// Error is set once the upload failed for good and the document was
+	// kept in the spool, which then skips it.
+	Error string `json:"error,omitempty"`
+}
+
+// options returns the upload options recorded in r.
+func (r SpoolRecord) options() paperless.UploadOptions {
+	return paperless.UploadOptions{
+		Title:               r.Title,
+		Created:             r.Created,
+		Tags:                r.Tags,
+		Correspondent:       r.Correspondent,
+		DocumentType:        r.DocumentType,
+		StoragePath:         r.StoragePath,
+		ArchiveSerialNumber: r.ArchiveSerialNumber,
+	}
+}
+
+// SpoolEntry is a document waiting in the spool.
+type SpoolEntry struct {
+	// Path is the spooled document. It has the suffix atrest.Suffix if
+	// it was encrypted.
+	Path   string
+	Record SpoolRecord
+}
+
+// ListSpool returns the documents in the spool directory dir in the order
+// they were spooled.
+func ListSpool(dir string) ([]SpoolEntry, error) {
+	dirs, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []SpoolEntry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		entryDir := filepath.Join(dir, d.Name())
+		data, err := os.ReadFile(filepath.Join(entryDir, spoolRecordName))
+		if err != nil {
+			continue
+		}
+		var record SpoolRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			logging.Warnf("Ignoring invalid spool record in %s: %v", entryDir, err)
+			continue
+		}
+		path := filepath.Join(entryDir, filepath.Base(record.Source))
+		if _, err := os.Stat(path); err != nil {
+			path += atrest.Suffix
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+		}
+		entries = append(entries, SpoolEntry{Path: path, Record: record})
+	}
+	// The entry directories are named by the time they were spooled.
+	sort.Slice(entries, func(i, k int) bool { return entries[i].Path < entries[k].Path })
+	return entries, nil
+}
+
+// spoolFile stores the file of j, to be uploaded with opts, in SpoolDir.
+// Files the folder leaves in place are copied, others moved. With an
+// encryption key, the file is stored encrypted.
+func (w *Watcher) spoolFile(j job, opts paperless.UploadOptions) (string, error) {
+	entryDir := filepath.Join(w.SpoolDir, fmt.Sprintf("%020d-%s", time.Now().UnixNano(), j.id))
+	if err := os.MkdirAll(entryDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create spool entry: %v", err)
+	}
+	record := SpoolRecord{
+		Source:              j.path,
+		Folder:              j.folder.Path,
+		SpooledAt:           time.Now(),
+		Title:               opts.Title,
+		Created:             opts.Created,
+		Tags:                opts.Tags,
+		Correspondent:       opts.Correspondent,
+		DocumentType:        opts.DocumentType,
+		StoragePath:         opts.StoragePath,
+		ArchiveSerialNumber: opts.ArchiveSerialNumber,
+		PostUploadAction:    j.folder.PostUploadAction,
+	}
+	if err := writeSpoolRecord(entryDir, record); err != nil {
+		os.RemoveAll(entryDir)
+		return "", err
+	}
+	dest := filepath.Join(entryDir, filepath.Base(j.path))
+	if encrypts(j.folder, j.path) {
+		dest += atrest.Suffix
+		if err := atrest.EncryptCopy(j.folder.EncryptionKey, j.path, dest); err != nil {
+			os.RemoveAll(entryDir)
+			return "", fmt.Errorf("failed to encrypt file %s to %s: %v", j.path, dest, err)
+		}
+	} else if j.folder.PostUploadAction != "" && os.Rename(j.path, dest) == nil {
+		return dest, nil
+	} else if err := copySpooled(entryDir, j.path); err != nil {
+		os.RemoveAll(entryDir)
+		return "", err
+	}
+	if j.folder.PostUploadAction != "" {
+		if err := os.Remove(j.path); err != nil {
+			return dest, fmt.Errorf("spooled, but failed to remove the original: %v", err)
+		}
+	}
+	return dest, nil
+}
+
+// copySpooled copies the file at path into entryDir.
+func copySpooled(entryDir, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = Deliver(entryDir, filepath.Base(path), f)
+	return err
+}
+
+func writeSpoolRecord(entryDir string, record SpoolRecord) error {
+	record.Error = logging.Redact(record.Error)
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode spool record: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(entryDir, spoolRecordName), data, 0600); err != nil {
+		return fmt.Errorf("failed to write spool record: %v", err)
+	}
+	return nil
+}
+
+// spool stores the file of j in SpoolDir because Paperless is down, and
+// finishes the job. It returns false if the file could not be spooled and
+// is handled as usual.
+func (w *Watcher) spool(j job, opts paperless.UploadOptions, cause error) bool {
+	log := w.log(j)
+	dest, err := w.spoolFile(j, opts)
+	if dest == "" {
+		log.Error("Failed to spool document", logging.KeyError, err)
+		return false
+	}
+	if err != nil {
+		log.Warn(err.Error())
+	}
+	log.Warn("Paperless unavailable, spooled document", logging.KeyStatus, "spooled", "dest", dest, logging.KeyError, cause)
+	w.mu.Lock()
+	delete(w.active, j.path)
+	w.status.Spooled++
+	w.mu.Unlock()
+	w.releaseClaim(j.path, false)
+	j.endTrace(nil)
+	w.emit(Event{Type: EventSpooled, ID: j.id, Folder: j.folder.Path, Path: j.path, Dest: dest, Err: cause})
+	j.complete(nil)
+	w.jobDone()
+	if w.spooler != nil {
+		w.spooler.wake()
+	}
+	return true
+}
+
+// spoolSource offers the spooled documents one at a time, in the order
+// they were spooled, while Paperless is available.
+type spoolSource struct {
+	w     *Watcher
+	files chan File
+	// woken is signalled when a document was spooled.
+	woken chan struct{}
+	// done receives the outcome of the offered document.
+	done chan error
+	// entryDir is the spool entry of the offered document, which is
+	// elsewhere if it was decrypted for the upload.
+	entryDir string
+}
+
+func newSpoolSource(w *Watcher) *spoolSource {
+	return &spoolSource{w: w, files: make(chan File), woken: make(chan struct{}, 1), done: make(chan error, 1)}
+}
+
+func (s *spoolSource) Start(ctx context.Context) error {
+	if err := os.MkdirAll(s.w.SpoolDir, 0700); err != nil {
+		return fmt.Errorf("failed to create spool directory '%s': %v", s.w.SpoolDir, err)
+	}
+	entries, err := ListSpool(s.w.SpoolDir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory '%s': %v", s.w.SpoolDir, err)
+	}
+	pending := 0
+	for _, e := range entries {
+		if e.Record.Error == "" {
+			pending++
+		}
+	}
+	s.w.mu.Lock()
+	s.w.status.Spooled = pending
+	s.w.mu.Unlock()
+	if pending > 0 {
+		s.w.logger().Info("Found spooled documents", "count", pending, "dir", s.w.SpoolDir)
+	}
+	go s.run(ctx)
+	return nil
+}
+
+func (s *spoolSource) Events() <-chan File {
+	return s.files
+}
+
+func (s *spoolSource) wake() {
+	select {
+	case s.woken <- struct{}{}:
+	default:
+	}
+}
+
+// Complete removes the entry of an uploaded document. Documents that
+// failed for good are kept if they were not moved to the failed folder.
+func (s *spoolSource) Complete(f File, err error) {
+	if err == nil || !isOutage(err) {
+		entryDir := s.entryDir
+		if _, statErr := os.Stat(f.Path); err != nil && statErr == nil {
+			s.markFailed(entryDir, err)
+		} else if rerr := os.RemoveAll(entryDir); rerr != nil {
+			s.w.logger().Warn("Failed to remove spool entry", logging.KeyFile, f.Path, logging.KeyError, rerr)
+		}
+		s.w.mu.Lock()
+		s.w.status.Spooled--
+		s.w.mu.Unlock()
+	}
+	s.done <- err
+}
+
+// markFailed records in the spool entry that its document failed for good
+// with err, so that it is skipped.
+func (s *spoolSource) markFailed(entryDir string, err error) {
+	data, _ := os.ReadFile(filepath.Join(entryDir, spoolRecordName))
+	var record SpoolRecord
+	_ = json.Unmarshal(data, &record)
+	record.Error = err.Error()
+	if werr := writeSpoolRecord(entryDir, record); werr != nil {
+		s.w.logger().Error("Failed to mark spooled document as failed", logging.KeyFile, entryDir, logging.KeyError, werr)
+	}
+}
+
+// run offers the spooled documents whenever Paperless answers, until ctx
+// is done.
+func (s *spoolSource) run(ctx context.Context) {
+	defer close(s.files)
+	interval := s.w.BreakerProbe
+	if interval <= 0 {
+		interval = defaultBreakerProbe
+	}
+	for {
+		if s.flush(ctx) {
+			// Wait for the next spooled document.
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.woken:
+			}
+			continue
+		}
+		// Paperless is still down.
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// flush offers the pending spooled documents in order and reports whether
+// the spool was emptied, or false once Paperless turned out to be down.
+func (s *spoolSource) flush(ctx context.Context) bool {
+	for {
+		entries, err := ListSpool(s.w.SpoolDir)
+		if err != nil {
+			s.w.logger().Error("Failed to read spool directory", logging.KeyError, err)
+			return false
+		}
+		var next *SpoolEntry
+		for i := range entries {
+			if entries[i].Record.Error == "" {
+				next = &entries[i]
+				break
+			}
+		}
+		if next == nil || ctx.Err() != nil {
+			return true
+		}
+		if err := s.w.client.Ping(); err != nil {
+			s.w.logger().Debug("Paperless unavailable, keeping documents spooled", logging.KeyError, err)
+			return false
+		}
+		file := File{Path: next.Path, Folder: s.w.spoolFolder(*next)}
+		s.entryDir = filepath.Dir(next.Path)
+		// Encrypted documents are uploaded from a decrypted copy, like
+		// retried failed files.
+		var tmpDir string
+		if strings.HasSuffix(next.Path, atrest.Suffix) {
+			if tmpDir, err = os.MkdirTemp("", "paperless-uploader-"); err != nil {
+				s.w.logger().Error("Failed to create temporary directory", logging.KeyError, err)
+				return false
+			}
+			file.Path = filepath.Join(tmpDir, strings.TrimSuffix(filepath.Base(next.Path), atrest.Suffix))
+			if err := atrest.DecryptFile(file.Folder.EncryptionKey, next.Path, file.Path); err != nil {
+				s.w.logger().Error("Failed to decrypt spooled document, keeping it", logging.KeyFile, next.Path, logging.KeyError, err)
+				os.RemoveAll(tmpDir)
+				s.markFailed(s.entryDir, err)
+				s.w.mu.Lock()
+				s.w.status.Spooled--
+				s.w.mu.Unlock()
+				continue
+			}
+		}
+		var outage bool
+		select {
+		case s.files <- file:
+			select {
+			case err := <-s.done:
+				outage = isOutage(err)
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+		if tmpDir != "" {
+			os.RemoveAll(tmpDir)
+		}
+		if outage {
+			return false
+		}
+		if ctx.Err() != nil {
+			return true
+		}
+	}
+}
+
+// spoolFolder returns the settings the spooled document e is uploaded
+// with: those of its folder, with the recorded metadata. The spooled copy
+// of a file left in place is deleted once uploaded.
+func (w *Watcher) spoolFolder(e SpoolEntry) Folder {
+	folder := w.folderFor(e.Record.Source)
+	folder.Path = e.Record.Folder
+	folder.SettleDelay = 0
+	folder.Tags = nil
+	record := e.Record
+	folder.Metadata = func(string) (paperless.UploadOptions, error) {
+		return record.options(), nil
+	}
+	folder.PostUploadActionFor = nil
+	folder.PostUploadAction = "delete"
+	if record.PostUploadAction == "move" {
+		folder.PostUploadAction = "move"
+	}
+	return folder
+}
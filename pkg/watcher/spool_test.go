@@ -0,0 +1,177 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/atrest"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpool(t *testing.T) {
+	var (
+		down   atomic.Bool
+		mu     sync.Mutex
+		titles []string
+	)
+	down.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != "/api/" {
+			mu.Lock()
+			titles = append(titles, r.FormValue("title"))
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	watchDir := filepath.Join(tmpDir, "consume")
+	processedDir := filepath.Join(tmpDir, "processed")
+	spoolDir := filepath.Join(tmpDir, "spool")
+	assert.NoError(t, os.MkdirAll(watchDir, 0755))
+	for _, name := range []string{"a.pdf", "b.pdf"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(watchDir, name), []byte(name), 0644))
+	}
+	var resolved atomic.Int32
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{
+		Path:             watchDir,
+		PostUploadAction: "move",
+		ProcessedFolder:  processedDir,
+		Metadata: func(filePath string) (paperless.UploadOptions, error) {
+			resolved.Add(1)
+			return paperless.UploadOptions{Title: strings.ToUpper(filepath.Base(filePath))}, nil
+		},
+	}})
+	w.RetryDelay = time.Hour
+	w.BreakerProbe = 20 * time.Millisecond
+	w.SpoolDir = spoolDir
+	var spooled atomic.Int32
+	w.OnEvent(func(e Event) {
+		if e.Type == EventSpooled {
+			spooled.Add(1)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	// The files are moved into the spool with their metadata.
+	assert.Eventually(t, func() bool { return w.Status().Spooled == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), spooled.Load())
+	entries, err := os.ReadDir(watchDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+	spool, err := ListSpool(spoolDir)
+	assert.NoError(t, err)
+	if assert.Len(t, spool, 2) {
+		assert.Equal(t, "a.pdf", filepath.Base(spool[0].Path))
+		assert.Equal(t, "A.PDF", spool[0].Record.Title)
+		assert.Equal(t, filepath.Join(watchDir, "a.pdf"), spool[0].Record.Source)
+	}
+	assert.Zero(t, w.Status().Folders[0].Failed)
+
+	// They are uploaded in order once Paperless is back, without resolving
+	// their metadata again.
+	down.Store(false)
+	assert.Eventually(t, func() bool { return w.Status().Folders[0].Uploaded == 2 }, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []string{"A.PDF", "B.PDF"}, titles)
+	mu.Unlock()
+	assert.Equal(t, int32(2), resolved.Load())
+	assert.FileExists(t, filepath.Join(processedDir, "a.pdf"))
+	assert.FileExists(t, filepath.Join(processedDir, "b.pdf"))
+	assert.Eventually(t, func() bool {
+		entries, _ := os.ReadDir(spoolDir)
+		return len(entries) == 0 && w.Status().Spooled == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestSpoolEncrypted(t *testing.T) {
+	var (
+		down     atomic.Bool
+		mu       sync.Mutex
+		uploaded []string
+	)
+	down.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/api/documents/post_document/" {
+			file, _, err := r.FormFile("document")
+			assert.NoError(t, err)
+			content, _ := io.ReadAll(file)
+			mu.Lock()
+			uploaded = append(uploaded, string(content))
+			mu.Unlock()
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	watchDir := filepath.Join(tmpDir, "consume")
+	spoolDir := filepath.Join(tmpDir, "spool")
+	assert.NoError(t, os.MkdirAll(watchDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(watchDir, "a.pdf"), []byte("secret"), 0644))
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{
+		Path:             watchDir,
+		PostUploadAction: "move",
+		ProcessedFolder:  filepath.Join(tmpDir, "processed"),
+		EncryptionKey:    bytes.Repeat([]byte{7}, 32),
+	}})
+	w.RetryDelay = time.Hour
+	w.BreakerProbe = 20 * time.Millisecond
+	w.SpoolDir = spoolDir
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	// The document is spooled encrypted.
+	assert.Eventually(t, func() bool { return w.Status().Spooled == 1 }, 5*time.Second, 10*time.Millisecond)
+	spool, err := ListSpool(spoolDir)
+	assert.NoError(t, err)
+	if assert.Len(t, spool, 1) {
+		assert.Equal(t, "a.pdf"+atrest.Suffix, filepath.Base(spool[0].Path))
+		content, err := os.ReadFile(spool[0].Path)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(content), "secret")
+	}
+
+	// It is decrypted for the upload and encrypted again when moved.
+	down.Store(false)
+	assert.Eventually(t, func() bool { return w.Status().Folders[0].Uploaded == 1 }, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []string{"secret"}, uploaded)
+	mu.Unlock()
+	assert.FileExists(t, filepath.Join(tmpDir, "processed", "a.pdf"+atrest.Suffix))
+	assert.Eventually(t, func() bool {
+		entries, _ := os.ReadDir(spoolDir)
+		return len(entries) == 0 && w.Status().Spooled == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
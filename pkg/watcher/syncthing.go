@@ -0,0 +1,34 @@
+package watcher
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Syncthing keeps its folder marker, ignore patterns and old file versions
+// in the synced folder and downloads files to a temporary name, renaming
+// them into place once complete.
+var syncthingNames = map[string]bool{
+	".stfolder":   true,
+	".stignore":   true,
+	".stversions": true,
+}
+
+// IsSyncthingArtifact reports whether path is one of Syncthing's own files
+// or directories, or lies within one, rather than a synced document. A
+// document is only picked up once Syncthing has renamed it into place.
+func IsSyncthingArtifact(path string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(path), "/") {
+		if syncthingNames[elem] {
+			return true
+		}
+	}
+	base := filepath.Base(path)
+	return strings.HasSuffix(base, ".tmp") &&
+		(strings.HasPrefix(base, ".syncthing.") || strings.HasPrefix(base, "~syncthing~"))
+}
+
+// ignored reports whether the watcher leaves path alone.
+func ignored(path string) bool {
+	return IsSidecar(path) || IsPartial(path) || IsSyncthingArtifact(path)
+}
@@ -0,0 +1,55 @@
+package watcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSyncthingArtifact(t *testing.T) {
+	for path, want := range map[string]bool{
+		"consume/.stfolder":                  true,
+		"consume/.stignore":                  true,
+		"consume/.stversions/a~20240101.pdf": true,
+		"consume/.syncthing.scan.pdf.tmp":    true,
+		"consume/~syncthing~scan.pdf.tmp":    true,
+		"consume/scan.pdf":                   false,
+		"consume/scan.sync-conflict-1.pdf":   false,
+		"consume/.syncthing.scan.pdf":        false,
+	} {
+		assert.Equal(t, want, IsSyncthingArtifact(filepath.FromSlash(path)), path)
+	}
+}
+
+func TestScanSkipsSyncthingArtifacts(t *testing.T) {
+	var mu sync.Mutex
+	var uploaded []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, header, err := r.FormFile("document")
+		if assert.NoError(t, err) {
+			mu.Lock()
+			uploaded = append(uploaded, header.Filename)
+			mu.Unlock()
+		}
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+
+	watchDir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(watchDir, ".stfolder"), 0755))
+	assert.NoError(t, os.Mkdir(filepath.Join(watchDir, ".stversions"), 0755))
+	for _, name := range []string{".stignore", ".stversions/old~20240101-120000.pdf", ".syncthing.half.pdf.tmp", "done.pdf"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(watchDir, name), []byte("pdf"), 0644))
+	}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: watchDir}})
+	assert.NoError(t, w.Scan(context.Background()))
+	assert.Equal(t, []string{"done.pdf"}, uploaded)
+	assert.Equal(t, 0, w.Status().Folders[0].Failed)
+}
@@ -0,0 +1,48 @@
+package watcher
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of the upload pipeline. Without a configured
+// OpenTelemetry tracer provider the spans are no-ops.
+var tracer = otel.Tracer("github.com/c-yco/go-paperless-uploader/pkg/watcher")
+
+// startTrace starts the root span of a newly scheduled job.
+func (j *job) startTrace(ctx context.Context) {
+	_, j.span = tracer.Start(ctx, "document", trace.WithAttributes(
+		attribute.String("file", j.path),
+		attribute.String("folder", j.folder.Path),
+		attribute.String("id", j.id),
+	))
+}
+
+// startSpan starts a child span of the job's root span.
+func (j job) startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	if j.span != nil {
+		ctx = trace.ContextWithSpan(ctx, j.span)
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(attribute.Int("attempt", j.attempt)))
+}
+
+// endTrace ends the job's root span, recording err.
+func (j job) endTrace(err error) {
+	if j.span == nil {
+		return
+	}
+	endSpan(j.span, err)
+}
+
+// endSpan ends span, marking it as failed if err is set.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
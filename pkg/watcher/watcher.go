@@ -0,0 +1,1186 @@
+// Package watcher watches folders for new documents and uploads them to
+// Paperless-ngx.
+package watcher
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/atrest"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Consumption tasks are polled at taskPollInterval for at most taskTimeout
+// when tracking consumption.
+const (
+	taskPollInterval = 2 * time.Second
+	taskTimeout      = 5 * time.Minute
+)
+
+// queueSize is the number of files that can wait for upload before the
+// watcher stops reading file system events.
+const queueSize = 1024
+
+// Folder is a directory watched for new documents.
+type Folder struct {
+	Path string
+	// SettleDelay is how long to wait after a file is detected before
+	// uploading it.
+	SettleDelay time.Duration
+	// Tags are the tag IDs applied to documents from this folder.
+	Tags []int
+	// TagNames are the configured tag names, used for logging.
+	TagNames []string
+	// PostUploadAction is "delete", "move" or empty to leave the file.
+	PostUploadAction string
+	// ProcessedFolder is where files are moved for the "move" action.
+	ProcessedFolder string
+	// FailedFolder is where files are moved once all upload attempts have
+	// failed. Empty leaves them in place.
+	FailedFolder string
+	// Metadata, if set, returns additional metadata for a file. Its tags
+	// are added to Tags.
+	Metadata func(filePath string) (paperless.UploadOptions, error)
+	// PostUploadActionFor, if set, returns the post-upload action of a
+	// file, "delete", "move" or empty to leave it; ok false keeps
+	// PostUploadAction.
+	PostUploadActionFor func(filePath string) (action string, ok bool)
+	// Client, if set, uploads the documents from this folder instead of
+	// the watcher's client, e.g. with the API key of another user.
+	Client *paperless.Client
+	// EncryptionKey, a 32 byte AES key, encrypts files moved to
+	// ProcessedFolder, FailedFolder or DuplicatesFolder, which get the
+	// suffix ".enc".
+	EncryptionKey []byte
+	// OnDuplicate is what happens to a file Paperless does not consume
+	// because it already has the document: DuplicateSuccess,
+	// DuplicateMove, DuplicateReupload or DuplicateFail. With any of them
+	// the post-upload action waits for the consumption. Empty runs the
+	// post-upload action right away and only logs the rejection.
+	OnDuplicate string
+	// DuplicatesFolder is where DuplicateMove moves files.
+	DuplicatesFolder string
+}
+
+// Watcher uploads files that appear in a set of folders.
+type Watcher struct {
+	client  *paperless.Client
+	folders []Folder
+
+	// DryRun logs what would be uploaded and which post-upload action would
+	// run without contacting the server or touching the files.
+	DryRun bool
+	// MaxRetries is how often a failed upload is retried before giving up.
+	MaxRetries int
+	// RetryDelay is the delay before the first retry. It doubles with every
+	// further attempt.
+	RetryDelay time.Duration
+	// TrackConsumption waits for the consumption task of every upload in
+	// the background and emits EventConsumed or EventConsumeFailed.
+	TrackConsumption bool
+	// Receipts writes a Receipt next to every uploaded file that is moved
+	// or left in place once its document was created. It implies
+	// TrackConsumption.
+	Receipts bool
+	// AfterConsumption, if set, is called with the ID of every document
+	// created from an upload, e.g. to set metadata the upload cannot. The
+	// folder is the watch folder, path the uploaded file, which may be
+	// gone. Errors are logged. It implies TrackConsumption.
+	AfterConsumption func(client *paperless.Client, documentID int, folder, path string) error
+	// ErrorReports writes an ErrorReport next to every file that failed for
+	// good, in the failed folder if it was moved there, and removes it once
+	// the file was uploaded.
+	ErrorReports bool
+	// Profile names the configuration in error reports, e.g. its file.
+	Profile string
+	// VerifyChecksum defers the deletion of files with the "delete"
+	// post-upload action until Paperless created their document and the
+	// MD5 checksum of its original file matches theirs. Files failing the
+	// check, or whose document was not created, are moved to the failed
+	// folder or left in place. It implies TrackConsumption for these files.
+	VerifyChecksum bool
+	// MaxPending limits the files waiting, being uploaded or having their
+	// consumption tracked. Further files are left in the folders until the
+	// backlog has halved, then the folders are rescanned. Zero leaves the
+	// backlog limited only by the queue size.
+	MaxPending int
+	// FallbackDir is a Paperless consume directory, e.g. a mounted share,
+	// files are copied to once the API has been unreachable for
+	// FallbackAfter; until then such files are retried even beyond
+	// MaxRetries. The API is still tried first for every file, so uploads
+	// go through it again as soon as it answers. Copied files are consumed
+	// without their metadata and tags.
+	FallbackDir   string
+	FallbackAfter time.Duration
+	// BreakerThreshold is the number of consecutive uploads failing because
+	// Paperless is unreachable or answers with a server error after which
+	// the circuit opens: further uploads are held instead of failing one
+	// after the other, and the watcher's client pings the server every
+	// BreakerProbe until it answers. Zero disables the circuit breaker.
+	BreakerThreshold int
+	BreakerProbe     time.Duration
+	// SpoolDir, if set, keeps files coming while Paperless is down: a file
+	// whose upload fails because the server is unreachable or answers with
+	// a server error, or that arrives while the circuit is open, is stored
+	// in SpoolDir with its resolved metadata instead of being retried.
+	// Files the folder leaves in place are copied, others moved. Spooled
+	// files are uploaded one at a time, in the order they were spooled,
+	// once the server answers again, also after a restart. It takes
+	// precedence over FallbackDir.
+	SpoolDir string
+	// Recent, if set, skips files identical to one uploaded recently; they
+	// get the post-upload action as if uploaded.
+	Recent RecentUploads
+	// Instance, if set, makes the watcher claim every file before uploading
+	// it, so instances sharing folders, e.g. on a network share, upload each
+	// file once: a Claim naming Instance, which must differ between the
+	// instances, is stored next to the file, and files claimed by another
+	// instance are skipped. Claims not renewed for ClaimTimeout, because
+	// their instance stopped, are taken over when the file is found again.
+	Instance     string
+	ClaimTimeout time.Duration
+	// Logger receives the watcher's log records. Nil uses the application
+	// logger, which is slog.Default unless the CLI configured its own.
+	Logger *slog.Logger
+
+	queue     chan job
+	listeners []func(Event)
+	sources   []Source
+	// pings is served by the event loop to prove it is responsive.
+	pings chan chan struct{}
+	// idle is signalled when the last pending file is done.
+	idle chan struct{}
+	// rescan is signalled when the backlog has drained after files were
+	// left in the folders because it was full, or by Rescan.
+	rescan chan struct{}
+
+	mu     sync.Mutex
+	status Status
+	// pending counts the scheduled files until they and the consumption
+	// tracking of their upload are done.
+	pending int
+	// overflow is set when files were left in the folders because the
+	// backlog was full.
+	overflow bool
+	// resume is closed by Resume; it is nil while processing is not
+	// paused.
+	resume chan struct{}
+	// apiDownSince is when uploads started failing because the API was
+	// unreachable; zero while it is reachable.
+	apiDownSince time.Time
+	// outageFailures counts the consecutive uploads failing with an
+	// outage.
+	outageFailures int
+	// circuit is closed when the server recovers; it is nil while the
+	// circuit is closed.
+	circuit      chan struct{}
+	circuitSince time.Time
+	active       map[string]bool
+	folderStats  map[string]*FolderStatus
+	// delayed holds the timers of jobs waiting for their settle or retry
+	// delay, with the function queueing the job.
+	delayed map[*delayedJob]bool
+	// claims holds the files claimed for Instance.
+	claims map[string]bool
+	// spooler offers the spooled files while running with SpoolDir.
+	spooler *spoolSource
+}
+
+// delayedJob is a job waiting for its settle or retry delay.
+type delayedJob struct {
+	timer   *time.Timer
+	enqueue func()
+}
+
+// job is a file waiting to be uploaded.
+type job struct {
+	// id correlates the log records and events of one file.
+	id      string
+	folder  Folder
+	path    string
+	attempt int
+	// checksum is the SHA-256 of the file, computed before the first
+	// attempt.
+	checksum string
+	// opts are the options the file was uploaded with, kept for uploading
+	// it again, as the metadata of received files is gone once uploaded.
+	opts paperless.UploadOptions
+	// reuploaded is set once the file was uploaded again after Paperless
+	// rejected it as a duplicate.
+	reuploaded bool
+	// span is the root span of the file's trace.
+	span trace.Span
+	// source offered file, unless the job was found by Scan.
+	source Source
+	file   File
+	// history records the failed attempts.
+	history []Attempt
+}
+
+// complete tells the source of j about its outcome.
+func (j job) complete(err error) {
+	if j.source != nil {
+		j.source.Complete(j.file, err)
+	}
+}
+
+func newJob(folder Folder, path string) job {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return job{id: hex.EncodeToString(b), folder: folder, path: path}
+}
+
+// logger returns the logger for records not tied to a file.
+func (w *Watcher) logger() *slog.Logger {
+	if w.Logger != nil {
+		return w.Logger
+	}
+	return logging.Logger()
+}
+
+// log returns the logger with the fields identifying j.
+func (w *Watcher) log(j job) *slog.Logger {
+	return w.logger().With(logging.KeyID, j.id, logging.KeyFile, j.path, logging.KeyFolder, j.folder.Path)
+}
+
+// Status is a snapshot of the watcher's runtime state.
+type Status struct {
+	// Watching is true once the folders are being watched.
+	Watching  bool      `json:"watching"`
+	StartedAt time.Time `json:"started_at"`
+	// QueueDepth counts files waiting to settle or to be uploaded.
+	QueueDepth int `json:"queue_depth"`
+	// InFlight counts uploads currently in progress.
+	InFlight int `json:"in_flight"`
+	// RetryBacklog counts failed uploads waiting for their next attempt.
+	RetryBacklog int `json:"retry_backlog"`
+	// Paused is true while no new uploads are started.
+	Paused bool `json:"paused"`
+	// CircuitOpen is true while uploads are held because Paperless is
+	// down.
+	CircuitOpen bool `json:"circuit_open"`
+	// Spooled counts files waiting in the spool for Paperless to return.
+	Spooled int            `json:"spooled"`
+	Folders []FolderStatus `json:"folders"`
+}
+
+// FolderStatus holds the upload statistics of a single folder.
+type FolderStatus struct {
+	Path            string    `json:"path"`
+	Uploaded        int       `json:"uploaded"`
+	Failed          int       `json:"failed"`
+	LastSuccess     time.Time `json:"last_success"`
+	LastSuccessFile string    `json:"last_success_file,omitempty"`
+	LastFailure     time.Time `json:"last_failure"`
+	LastFailureFile string    `json:"last_failure_file,omitempty"`
+	LastError       string    `json:"last_error,omitempty"`
+}
+
+// New creates a new Watcher for the given folders.
+func New(client *paperless.Client, folders []Folder) *Watcher {
+	w := &Watcher{
+		client:       client,
+		folders:      folders,
+		MaxRetries:   3,
+		RetryDelay:   30 * time.Second,
+		queue:        make(chan job, queueSize),
+		pings:        make(chan chan struct{}),
+		idle:         make(chan struct{}, 1),
+		rescan:       make(chan struct{}, 1),
+		active:       make(map[string]bool),
+		folderStats:  make(map[string]*FolderStatus),
+		delayed:      make(map[*delayedJob]bool),
+		claims:       make(map[string]bool),
+		ClaimTimeout: 10 * time.Minute,
+		BreakerProbe: defaultBreakerProbe,
+	}
+	for _, folder := range folders {
+		w.folderStats[folder.Path] = &FolderStatus{Path: folder.Path}
+	}
+	return w
+}
+
+// Status returns a snapshot of the watcher's runtime state.
+func (w *Watcher) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := w.status
+	status.QueueDepth += len(w.queue)
+	status.Folders = nil
+	for _, folder := range w.folders {
+		status.Folders = append(status.Folders, *w.folderStats[folder.Path])
+	}
+	return status
+}
+
+// Run creates the folders if necessary, uploads the files already in them
+// and then watches them, and the added sources, for new files until ctx is
+// cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	folders, err := w.prepareFolders()
+	if err != nil {
+		return err
+	}
+
+	// The sources stop with the event loop.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sources := append([]Source{newFolderSource(w, folders)}, w.sources...)
+	if w.SpoolDir != "" && !w.DryRun {
+		w.spooler = newSpoolSource(w)
+		sources = append(sources, w.spooler)
+	}
+	offers, err := w.startSources(ctx, sources)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.worker(ctx)
+	}()
+	defer w.releaseClaims()
+	defer wg.Wait()
+	if w.Instance != "" {
+		go w.renewClaims(ctx)
+	}
+
+	w.setWatching(true)
+	defer w.setWatching(false)
+	w.emit(Event{Type: EventWatching})
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case o := <-offers:
+			w.accept(ctx, o)
+		case reply := <-w.pings:
+			close(reply)
+		}
+	}
+}
+
+// Scan uploads the files currently in the folders and returns once they are
+// done, including their retries and the consumption tracking of their
+// uploads, or when ctx is cancelled. New files are not watched for.
+func (w *Watcher) Scan(ctx context.Context) error {
+	folders, err := w.prepareFolders()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.worker(ctx)
+	}()
+	if w.Instance != "" {
+		go w.renewClaims(ctx)
+	}
+	scan := func() {
+		for _, folder := range folders {
+			w.processExisting(ctx, folder)
+		}
+	}
+	scan()
+
+	// A rescan is signalled before the backlog becomes idle, so files left
+	// in the folders are picked up before returning.
+	for ctx.Err() == nil {
+		select {
+		case <-w.rescan:
+			scan()
+			continue
+		default:
+		}
+		if w.pendingJobs() == 0 {
+			break
+		}
+		select {
+		case <-w.idle:
+		case <-w.rescan:
+			scan()
+		case <-ctx.Done():
+		}
+	}
+	cancel()
+	wg.Wait()
+	w.releaseClaims()
+	return nil
+}
+
+func (w *Watcher) pendingJobs() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.pending
+}
+
+// jobDone marks a scheduled file as done.
+func (w *Watcher) jobDone() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// Files processed without being scheduled were never counted.
+	if w.pending == 0 {
+		return
+	}
+	w.pending--
+	if w.overflow && w.pending <= w.MaxPending/2 {
+		w.overflow = false
+		select {
+		case w.rescan <- struct{}{}:
+		default:
+		}
+	}
+	if w.pending == 0 {
+		select {
+		case w.idle <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// prepareFolders creates missing folders and returns the folders to watch.
+// In dry-run mode missing folders are skipped.
+func (w *Watcher) prepareFolders() ([]Folder, error) {
+	var folders []Folder
+	for _, folder := range w.folders {
+		if _, err := os.Stat(folder.Path); os.IsNotExist(err) {
+			if w.DryRun {
+				w.logger().Info("[dry-run] Watch folder not found, would create it", logging.KeyFolder, folder.Path)
+				continue
+			}
+			w.logger().Info("Watch folder not found, creating it", logging.KeyFolder, folder.Path)
+			if err := os.MkdirAll(folder.Path, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create watch folder: %v", err)
+			}
+		}
+		folders = append(folders, folder)
+	}
+	return folders, nil
+}
+
+// Alive reports whether the event loop of a running watcher answers within
+// timeout.
+func (w *Watcher) Alive(timeout time.Duration) bool {
+	reply := make(chan struct{})
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case w.pings <- reply:
+	case <-timer.C:
+		return false
+	}
+	select {
+	case <-reply:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (w *Watcher) setWatching(watching bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.Watching = watching
+	if watching {
+		w.status.StartedAt = time.Now()
+	}
+}
+
+// backlogFull reports whether MaxPending files are pending, in which case
+// new files are left in the folders until the backlog has drained.
+func (w *Watcher) backlogFull() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.MaxPending <= 0 || w.pending < w.MaxPending {
+		return false
+	}
+	w.overflow = true
+	return true
+}
+
+// isActive reports whether path is waiting or being uploaded.
+func (w *Watcher) isActive(path string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.active[path]
+}
+
+func (w *Watcher) processExisting(ctx context.Context, folder Folder) {
+	w.walkFolder(folder, func(path string) bool {
+		j := newJob(folder, path)
+		w.emit(Event{Type: EventDetected, ID: j.id, Folder: folder.Path, Path: path})
+		w.schedule(ctx, j, 0, false)
+		return true
+	})
+}
+
+// schedule queues j after delay. Files that are already waiting or being
+// uploaded are skipped, unless the job is a retry of that file.
+func (w *Watcher) schedule(ctx context.Context, j job, delay time.Duration, retry bool) {
+	w.mu.Lock()
+	if w.active[j.path] && !retry {
+		w.mu.Unlock()
+		return
+	}
+	w.active[j.path] = true
+	if retry {
+		w.status.RetryBacklog++
+	} else {
+		w.status.QueueDepth++
+		w.pending++
+	}
+	w.mu.Unlock()
+
+	if j.span == nil {
+		j.startTrace(ctx)
+	}
+	// The wait span covers the settle or retry delay and the time spent in
+	// the queue.
+	waitName := "stabilize"
+	if retry {
+		waitName = "retry_wait"
+	}
+	_, wait := j.startSpan(ctx, waitName)
+
+	enqueue := func() {
+		select {
+		case w.queue <- j:
+			wait.End()
+		case <-ctx.Done():
+			endSpan(wait, ctx.Err())
+			j.endTrace(ctx.Err())
+			w.jobDone()
+		}
+		w.mu.Lock()
+		if retry {
+			w.status.RetryBacklog--
+		} else {
+			w.status.QueueDepth--
+		}
+		w.mu.Unlock()
+	}
+	if delay <= 0 {
+		enqueue()
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	d := &delayedJob{enqueue: enqueue}
+	d.timer = time.AfterFunc(delay, func() {
+		if w.undelay(d) {
+			enqueue()
+		}
+	})
+	w.delayed[d] = true
+}
+
+// undelay removes d from the delayed jobs and reports whether it was still
+// there, i.e. its job was not flushed.
+func (w *Watcher) undelay(d *delayedJob) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.delayed[d] {
+		return false
+	}
+	delete(w.delayed, d)
+	return true
+}
+
+// Flush queues the files waiting for their settle or retry delay right
+// away and returns their number.
+func (w *Watcher) Flush() int {
+	w.mu.Lock()
+	var flushed []func()
+	for d := range w.delayed {
+		d.timer.Stop()
+		flushed = append(flushed, d.enqueue)
+	}
+	clear(w.delayed)
+	w.mu.Unlock()
+	for _, enqueue := range flushed {
+		go enqueue()
+	}
+	if len(flushed) > 0 {
+		w.logger().Info("Flushed delayed files", "count", len(flushed))
+	}
+	return len(flushed)
+}
+
+// Pause stops starting new uploads until Resume is called. The upload in
+// progress completes; new files are still detected and queued.
+func (w *Watcher) Pause() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.resume != nil {
+		return
+	}
+	w.resume = make(chan struct{})
+	w.status.Paused = true
+	w.logger().Info("Processing paused")
+}
+
+// Resume continues processing after Pause.
+func (w *Watcher) Resume() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.resume == nil {
+		return
+	}
+	close(w.resume)
+	w.resume = nil
+	w.status.Paused = false
+	w.logger().Info("Processing resumed")
+}
+
+// Rescan makes a running watcher look for files in its folders that were
+// not picked up, e.g. because they were copied in while it was stopped.
+func (w *Watcher) Rescan() {
+	select {
+	case w.rescan <- struct{}{}:
+	default:
+	}
+}
+
+// waitResumed blocks while processing is paused. It returns false if ctx
+// was cancelled first.
+func (w *Watcher) waitResumed(ctx context.Context) bool {
+	w.mu.Lock()
+	resume := w.resume
+	w.mu.Unlock()
+	if resume == nil {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-resume:
+		return true
+	}
+}
+
+// worker uploads queued files until ctx is cancelled.
+func (w *Watcher) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-w.queue:
+			// Pause may have been called while waiting for the job.
+			if !w.waitResumed(ctx) || !w.waitCircuit(ctx) {
+				j.endTrace(ctx.Err())
+				w.jobDone()
+				return
+			}
+			w.process(ctx, j)
+		}
+	}
+}
+
+// process uploads a single file and runs the post-upload action. Failed
+// uploads are retried with exponential backoff.
+func (w *Watcher) process(ctx context.Context, j job) {
+	if j.folder.PostUploadActionFor != nil {
+		if action, ok := j.folder.PostUploadActionFor(j.path); ok {
+			j.folder.PostUploadAction = action
+		}
+	}
+	folder, filePath := j.folder, j.path
+	log := w.log(j)
+	if w.DryRun {
+		log.Info("[dry-run] Would upload file", "tags", folder.TagNames)
+		log.Info("[dry-run] " + DescribePostUpload(folder, filePath))
+		w.finish(j, nil)
+		j.endTrace(nil)
+		j.complete(nil)
+		w.jobDone()
+		return
+	}
+	if w.Instance != "" && !w.holdsClaim(filePath) {
+		other, err := w.claim(filePath)
+		if err == nil && other != nil {
+			if other.Uploaded {
+				log.Info("File already uploaded by another instance, skipping", "instance", other.Instance)
+			} else {
+				log.Info("File claimed by another instance, skipping", "instance", other.Instance)
+			}
+			w.mu.Lock()
+			delete(w.active, filePath)
+			w.mu.Unlock()
+			j.endTrace(nil)
+			j.complete(nil)
+			w.jobDone()
+			return
+		}
+		if err != nil {
+			log.Warn("Uploading without a claim", logging.KeyError, err)
+		}
+	}
+
+	spooled := w.spooler != nil && j.source == Source(w.spooler)
+	if w.SpoolDir != "" && !spooled && w.circuitOpen() && w.spool(j, uploadOptions(folder, filePath), errCircuitOpen) {
+		return
+	}
+
+	w.mu.Lock()
+	w.status.InFlight++
+	w.mu.Unlock()
+	w.emit(Event{Type: EventUploadStarted, ID: j.id, Folder: folder.Path, Path: filePath, Attempt: j.attempt})
+	_, span := j.startSpan(ctx, "preprocess")
+	if j.checksum == "" {
+		if sum, err := fileChecksum(filePath); err != nil {
+			log.Debug("Failed to hash file", logging.KeyError, err)
+		} else {
+			j.checksum = sum
+			w.emit(Event{Type: EventHashed, ID: j.id, Folder: folder.Path, Path: filePath, Checksum: sum})
+		}
+	}
+	if w.Recent != nil && j.checksum != "" {
+		if original, at, ok := w.Recent.RecentUpload(j.checksum); ok {
+			span.End()
+			w.mu.Lock()
+			w.status.InFlight--
+			w.mu.Unlock()
+			w.skipDuplicate(ctx, j, original, at)
+			return
+		}
+	}
+	opts := uploadOptions(folder, filePath)
+	j.opts = opts
+	span.End()
+	var size int64
+	opts.Progress = func(sent, total int64) {
+		size = total
+		w.emit(Event{Type: EventUploadProgress, ID: j.id, Folder: folder.Path, Path: filePath, Attempt: j.attempt, Sent: sent, Total: total})
+	}
+	_, span = j.startSpan(ctx, "upload")
+	start := time.Now()
+	taskID, err := w.clientFor(folder).UploadFile(filePath, opts)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	span.SetAttributes(attribute.Int64("size", size), attribute.String("task_id", taskID))
+	endSpan(span, err)
+	w.mu.Lock()
+	w.status.InFlight--
+	w.mu.Unlock()
+	w.recordOutcome(ctx, err)
+	if err != nil && w.SpoolDir != "" && isOutage(err) && ctx.Err() == nil {
+		if spooled {
+			log.Warn("Paperless unavailable, leaving document spooled", logging.KeyDuration, elapsed, logging.KeyError, err)
+			w.mu.Lock()
+			delete(w.active, filePath)
+			w.mu.Unlock()
+			w.releaseClaim(filePath, false)
+			j.endTrace(err)
+			j.complete(err)
+			w.jobDone()
+			return
+		}
+		opts.Progress = nil
+		if w.spool(j, opts, err) {
+			return
+		}
+	}
+	// fallbackDest is the copy in the fallback consume directory of a file
+	// that could not be uploaded. Until the outage is long enough for the
+	// fallback, fallbackWait is the time left and the file is retried
+	// beyond MaxRetries.
+	var (
+		fallbackDest string
+		fallbackWait time.Duration
+	)
+	if w.FallbackDir != "" {
+		if outage := w.apiOutage(err); err != nil && paperless.IsUnavailable(err) {
+			if fallbackWait = w.FallbackAfter - outage; fallbackWait <= 0 {
+				if dest, copyErr := copyToFallback(w.FallbackDir, filePath); copyErr != nil {
+					log.Error("Failed to copy document to the fallback consume directory", logging.KeyError, copyErr)
+				} else {
+					log.Warn("Paperless API unreachable, copied document to the consume directory", logging.KeyStatus, "uploaded", "dest", dest, "outage", outage.Round(time.Second))
+					fallbackDest, err = dest, nil
+				}
+			}
+		}
+	}
+
+	if err != nil {
+		j.history = append(j.history, newAttempt(err, elapsed))
+		// Documents Paperless does not accept fail without retries.
+		rejected := paperless.IsRejected(err)
+		if (j.attempt < w.MaxRetries || fallbackWait > 0) && ctx.Err() == nil && !rejected {
+			delay := w.RetryDelay << min(j.attempt, 16)
+			if fallbackWait > 0 && fallbackWait < delay {
+				delay = fallbackWait
+			}
+			log.Warn("Failed to upload document, retrying", logging.KeyStatus, "retry", "attempt", j.attempt+1, "max_attempts", w.MaxRetries+1, "retry_in", delay, logging.KeyDuration, elapsed, logging.KeyError, err)
+			w.emit(Event{Type: EventRetryScheduled, ID: j.id, Folder: folder.Path, Path: filePath, Attempt: j.attempt, Duration: elapsed, Err: err})
+			j.attempt++
+			w.schedule(ctx, j, delay, true)
+			return
+		}
+		if rejected {
+			log.Error("Paperless does not accept the document, not retrying", logging.KeyStatus, "failed", "attempt", j.attempt+1, logging.KeyDuration, elapsed, logging.KeyError, err)
+		} else {
+			log.Error("Failed to upload document", logging.KeyStatus, "failed", "attempt", j.attempt+1, logging.KeyDuration, elapsed, logging.KeyError, err)
+		}
+		var dest string
+		if folder.FailedFolder != "" {
+			var moveErr error
+			if dest, moveErr = MoveToFailed(folder, filePath, j.attempt+1, err); moveErr != nil {
+				log.Error(moveErr.Error())
+				dest = ""
+			}
+		}
+		if w.ErrorReports {
+			report := filePath
+			if dest != "" {
+				report = dest
+			}
+			w.writeErrorReport(j, report, err)
+		}
+		w.releaseClaim(filePath, false)
+		w.finish(j, err)
+		j.endTrace(err)
+		w.emit(Event{Type: EventUploadFailed, ID: j.id, Folder: folder.Path, Path: filePath, Attempt: j.attempt, Duration: elapsed, Err: err})
+		if dest != "" {
+			w.emit(Event{Type: EventMoved, ID: j.id, Folder: folder.Path, Path: filePath, Dest: dest})
+		}
+		j.complete(err)
+		w.jobDone()
+		return
+	}
+	if fallbackDest == "" {
+		log.Info("Successfully uploaded document", logging.KeyStatus, "uploaded", "task_id", taskID, logging.KeyDuration, elapsed)
+	}
+	w.addRecentUpload(j)
+	if w.ErrorReports {
+		if err := RemoveErrorReport(filePath); err != nil {
+			log.Warn("Failed to remove error report", logging.KeyError, err)
+		}
+	}
+	// The post-upload action of a file being verified, or whose fate
+	// depends on whether Paperless takes it as a duplicate, waits for the
+	// consumption. The file stays active, so it is not picked up again
+	// while it waits in the folder.
+	pending := (w.verifies(folder) || folder.OnDuplicate != "") && fallbackDest == ""
+	if !pending {
+		w.finish(j, nil)
+	}
+	w.emit(Event{Type: EventUploaded, ID: j.id, Folder: folder.Path, Path: filePath, Attempt: j.attempt, Total: size, Duration: elapsed, TaskID: taskID, Dest: fallbackDest})
+	if pending {
+		go w.trackConsumption(j, taskID, filePath, true)
+		return
+	}
+	current := w.postUpload(ctx, j)
+	j.endTrace(nil)
+	j.complete(nil)
+	if (w.TrackConsumption || w.Receipts || w.AfterConsumption != nil) && fallbackDest == "" {
+		go w.trackConsumption(j, taskID, current, false)
+		return
+	}
+	w.jobDone()
+}
+
+// postUpload runs the post-upload action of an uploaded file and returns
+// where the file is now, empty if it is gone.
+func (w *Watcher) postUpload(ctx context.Context, j job) string {
+	folder, filePath := j.folder, j.path
+	_, span := j.startSpan(ctx, "post_upload")
+	span.SetAttributes(attribute.String("action", folder.PostUploadAction))
+	dest, err := HandlePostUpload(folder, filePath)
+	endSpan(span, err)
+	current := filePath
+	if err == nil {
+		switch folder.PostUploadAction {
+		case "delete":
+			current = ""
+			w.emit(Event{Type: EventDeleted, ID: j.id, Folder: folder.Path, Path: filePath})
+		case "move":
+			current = dest
+			w.emit(Event{Type: EventMoved, ID: j.id, Folder: folder.Path, Path: filePath, Dest: dest})
+		}
+	}
+	w.releaseClaim(filePath, current == filePath)
+	return current
+}
+
+// clientFor returns the client uploading the documents from folder.
+func (w *Watcher) clientFor(folder Folder) *paperless.Client {
+	if folder.Client != nil {
+		return folder.Client
+	}
+	return w.client
+}
+
+// verifies reports whether the documents from folder are checked against
+// the files before these are deleted.
+func (w *Watcher) verifies(folder Folder) bool {
+	return w.VerifyChecksum && folder.PostUploadAction == "delete"
+}
+
+// trackConsumption waits for the consumption task of j and emits the
+// outcome. With receipts enabled, the receipt is written next to current.
+// With pending, the post-upload action of j has not run yet; it runs once
+// the document was created and, if the folder verifies documents, verified
+// to match the file. The folder's OnDuplicate decides about files
+// Paperless rejects as duplicates.
+func (w *Watcher) trackConsumption(j job, taskID, current string, pending bool) {
+	defer w.jobDone()
+	w.awaitConsumption(j, taskID, current, pending)
+}
+
+// awaitConsumption is trackConsumption for a job that is already counted,
+// e.g. one uploaded again as a duplicate.
+func (w *Watcher) awaitConsumption(j job, taskID, current string, pending bool) {
+	log := w.log(j)
+	e := Event{ID: j.id, Folder: j.folder.Path, Path: j.path, TaskID: taskID}
+	client := w.clientFor(j.folder)
+	task, err := client.WaitForTask(taskID, taskPollInterval, taskTimeout)
+	switch {
+	case err != nil:
+		e.Type, e.Err = EventConsumeFailed, err
+	case task.Status != paperless.TaskSuccess:
+		e.Type, e.Err = EventConsumeFailed, fmt.Errorf("consumption failed: %s", task.Result)
+	default:
+		e.Type, e.DocumentID, e.URL = EventConsumed, task.DocumentID, client.DocumentURL(task.DocumentID)
+	}
+	if e.Err != nil {
+		if pending && j.folder.OnDuplicate != "" && err == nil {
+			if documentID, ok := task.Duplicate(); ok {
+				w.handleDuplicate(j, taskID, documentID, e.Err)
+				return
+			}
+		}
+		log.Warn("Paperless did not create the document", "task_id", taskID, logging.KeyError, e.Err)
+		w.emit(e)
+		if pending {
+			w.keepUnverified(j, e.Err)
+		}
+		return
+	}
+	log.Info("Paperless created document", "task_id", taskID, "document_id", e.DocumentID, "url", e.URL)
+	if pending {
+		if w.verifies(j.folder) {
+			if err := verifyDocument(client, e.DocumentID, j.path); err != nil {
+				w.emit(e)
+				w.emit(Event{Type: EventVerifyFailed, ID: j.id, Folder: j.folder.Path, Path: j.path, TaskID: taskID, DocumentID: e.DocumentID, URL: e.URL, Err: err})
+				w.keepUnverified(j, err)
+				return
+			}
+			log.Info("Document matches the uploaded file", "document_id", e.DocumentID)
+		}
+		w.finish(j, nil)
+		current = w.postUpload(context.Background(), j)
+		j.endTrace(nil)
+		j.complete(nil)
+	}
+	if w.AfterConsumption != nil {
+		if err := w.AfterConsumption(client, e.DocumentID, j.folder.Path, j.path); err != nil {
+			log.Error("Failed to update the document after consumption", "document_id", e.DocumentID, logging.KeyError, err)
+		} else {
+			log.Info("Updated the document after consumption", "document_id", e.DocumentID)
+		}
+	}
+	if w.Receipts && current != "" {
+		receipt := Receipt{Source: j.path, DocumentID: e.DocumentID, URL: e.URL, TaskID: taskID, SHA256: j.checksum, Tags: j.opts.Tags, ConsumedAt: time.Now()}
+		if err := WriteReceipt(current, receipt); err != nil {
+			log.Error("Failed to write receipt", logging.KeyError, err)
+		}
+	}
+	w.emit(e)
+}
+
+// verifyDocument checks that the original file Paperless stored for the
+// document has the MD5 checksum of the file at path.
+func verifyDocument(client *paperless.Client, documentID int, path string) error {
+	md, err := client.GetDocumentMetadata(documentID)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, md.OriginalChecksum) {
+		return fmt.Errorf("checksum mismatch: document %d has %s, the file %s", documentID, md.OriginalChecksum, sum)
+	}
+	return nil
+}
+
+// keepUnverified keeps a file whose document was not created or could not
+// be verified, moving it to the failed folder if there is one, instead of
+// running its post-upload action.
+func (w *Watcher) keepUnverified(j job, err error) {
+	log := w.log(j)
+	log.Error("Document not created as expected, keeping the file", logging.KeyError, err)
+	report := j.path
+	if j.folder.FailedFolder != "" {
+		if dest, moveErr := MoveToFailed(j.folder, j.path, j.attempt+1, err); moveErr != nil {
+			log.Error(moveErr.Error())
+		} else {
+			report = dest
+			w.emit(Event{Type: EventMoved, ID: j.id, Folder: j.folder.Path, Path: j.path, Dest: dest})
+		}
+	}
+	if w.ErrorReports {
+		j.history = append(j.history, newAttempt(err, 0))
+		w.writeErrorReport(j, report, err)
+	}
+	w.releaseClaim(j.path, true)
+	w.finish(j, err)
+	j.endTrace(err)
+	j.complete(err)
+}
+
+// fileChecksum returns the hex encoded SHA-256 of the file at path.
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// uploadOptions returns the upload options for a file in folder. Files whose
+// metadata cannot be derived are uploaded with the folder's tags only.
+func uploadOptions(folder Folder, filePath string) paperless.UploadOptions {
+	opts := paperless.UploadOptions{}
+	if folder.Metadata != nil {
+		md, err := folder.Metadata(filePath)
+		if err != nil {
+			logging.Warnf("Failed to derive metadata for %s, uploading without it: %v", filePath, err)
+		} else {
+			opts = md
+		}
+	}
+	tags := append([]int{}, folder.Tags...)
+	for _, id := range opts.Tags {
+		if !slices.Contains(tags, id) {
+			tags = append(tags, id)
+		}
+	}
+	opts.Tags = tags
+	return opts
+}
+
+// finish records the final outcome of a job.
+func (w *Watcher) finish(j job, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.active, j.path)
+
+	stats, ok := w.folderStats[j.folder.Path]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if err != nil {
+		stats.Failed++
+		stats.LastFailure = now
+		stats.LastFailureFile = j.path
+		stats.LastError = err.Error()
+		return
+	}
+	stats.Uploaded++
+	stats.LastSuccess = now
+	stats.LastSuccessFile = j.path
+}
+
+// folderFor returns the folder containing filePath. Files outside every
+// configured folder get a default folder with a one second settle delay.
+func (w *Watcher) folderFor(filePath string) Folder {
+	dir := filepath.Clean(filepath.Dir(filePath))
+	for _, folder := range w.folders {
+		if filepath.Clean(folder.Path) == dir {
+			return folder
+		}
+	}
+	return Folder{Path: dir, SettleDelay: time.Second}
+}
+
+// DescribePostUpload returns a human readable description of the post-upload
+// action that would run for filePath.
+func DescribePostUpload(folder Folder, filePath string) string {
+	switch folder.PostUploadAction {
+	case "delete":
+		return fmt.Sprintf("Would delete %s", filePath)
+	case "move":
+		if encrypts(folder, filePath) {
+			return fmt.Sprintf("Would encrypt %s to %s", filePath, filepath.Join(folder.ProcessedFolder, filepath.Base(filePath)+atrest.Suffix))
+		}
+		return fmt.Sprintf("Would move %s to %s", filePath, filepath.Join(folder.ProcessedFolder, filepath.Base(filePath)))
+	default:
+		return fmt.Sprintf("Would leave %s in place", filePath)
+	}
+}
+
+// HandlePostUpload runs the folder's post-upload action on filePath and
+// returns the new path of moved files. Errors are logged as well.
+func HandlePostUpload(folder Folder, filePath string) (string, error) {
+	switch folder.PostUploadAction {
+	case "delete":
+		if err := os.Remove(filePath); err != nil {
+			logging.Errorf("Failed to delete file %s: %v", filePath, err)
+			return "", err
+		}
+		logging.Infof("Deleted file %s", filePath)
+	case "move":
+		if _, err := os.Stat(folder.ProcessedFolder); os.IsNotExist(err) {
+			if err := os.MkdirAll(folder.ProcessedFolder, 0755); err != nil {
+				logging.Errorf("Failed to create processed folder '%s': %v", folder.ProcessedFolder, err)
+				return "", err
+			}
+		}
+		newPath := filepath.Join(folder.ProcessedFolder, filepath.Base(filePath))
+		if encrypts(folder, filePath) {
+			newPath += atrest.Suffix
+			if err := atrest.EncryptFile(folder.EncryptionKey, filePath, newPath); err != nil {
+				logging.Errorf("Failed to encrypt file %s to %s: %v", filePath, newPath, err)
+				return "", err
+			}
+			logging.Infof("Encrypted file %s to %s", filePath, newPath)
+			return newPath, nil
+		}
+		if err := os.Rename(filePath, newPath); err != nil {
+			logging.Errorf("Failed to move file %s to %s: %v", filePath, newPath, err)
+			return "", err
+		}
+		logging.Infof("Moved file %s to %s", filePath, newPath)
+		return newPath, nil
+	}
+	return "", nil
+}
+
+// encrypts reports whether filePath is encrypted when moved out of folder.
+// Files that already are, e.g. retried failed files, are moved as they are.
+func encrypts(folder Folder, filePath string) bool {
+	return len(folder.EncryptionKey) > 0 && !strings.HasSuffix(filePath, atrest.Suffix)
+}
@@ -0,0 +1,975 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c-yco/go-paperless-uploader/internal/atrest"
+	"github.com/c-yco/go-paperless-uploader/internal/logging"
+	"github.com/c-yco/go-paperless-uploader/pkg/paperless"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestHandlePostUpload(t *testing.T) {
+	t.Run("delete action", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		filePath := filepath.Join(tmpDir, "test.txt")
+		err := os.WriteFile(filePath, []byte("content"), 0644)
+		assert.NoError(t, err)
+
+		HandlePostUpload(Folder{PostUploadAction: "delete"}, filePath)
+
+		_, err = os.Stat(filePath)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("move action", func(t *testing.T) {
+		tmpDir := t.TempDir()
+
+		filePath := filepath.Join(tmpDir, "test.txt")
+		err := os.WriteFile(filePath, []byte("content"), 0644)
+		assert.NoError(t, err)
+
+		processedDir := filepath.Join(tmpDir, "processed")
+		HandlePostUpload(Folder{PostUploadAction: "move", ProcessedFolder: processedDir}, filePath)
+
+		_, err = os.Stat(filePath)
+		assert.True(t, os.IsNotExist(err))
+
+		_, err = os.Stat(filepath.Join(processedDir, "test.txt"))
+		assert.NoError(t, err)
+	})
+}
+
+func TestFolderFor(t *testing.T) {
+	w := New(nil, []Folder{
+		{Path: "consume", SettleDelay: 2 * time.Second},
+		{Path: "scanner/", SettleDelay: 10 * time.Second},
+	})
+
+	assert.Equal(t, 2*time.Second, w.folderFor(filepath.Join("consume", "a.pdf")).SettleDelay)
+	assert.Equal(t, 10*time.Second, w.folderFor(filepath.Join("scanner", "b.pdf")).SettleDelay)
+	assert.Equal(t, time.Second, w.folderFor(filepath.Join("other", "c.pdf")).SettleDelay)
+}
+
+func TestDryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "scan.pdf")
+	assert.NoError(t, os.WriteFile(filePath, []byte("content"), 0644))
+
+	// A nil client would panic if the dry run tried to upload.
+	folder := Folder{Path: tmpDir, PostUploadAction: "delete"}
+	w := New(nil, []Folder{folder})
+	w.DryRun = true
+	w.process(context.Background(), job{folder: folder, path: filePath})
+
+	_, err := os.Stat(filePath)
+	assert.NoError(t, err)
+}
+
+func TestLogger(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "scan.pdf")
+
+	var buf bytes.Buffer
+	folder := Folder{Path: tmpDir}
+	w := New(nil, []Folder{folder})
+	w.DryRun = true
+	w.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+	j := newJob(folder, filePath)
+	w.process(context.Background(), j)
+
+	var record map[string]interface{}
+	assert.NoError(t, json.NewDecoder(&buf).Decode(&record))
+	assert.Equal(t, "[dry-run] Would upload file", record["msg"])
+	assert.Equal(t, filePath, record["file"])
+	assert.Equal(t, tmpDir, record["folder"])
+	assert.Equal(t, j.id, record["id"])
+	assert.Len(t, j.id, 8)
+}
+
+func TestDescribePostUpload(t *testing.T) {
+	assert.Equal(t, "Would delete a.pdf", DescribePostUpload(Folder{PostUploadAction: "delete"}, "a.pdf"))
+	assert.Equal(t, "Would move in/a.pdf to "+filepath.Join("done", "a.pdf"), DescribePostUpload(Folder{PostUploadAction: "move", ProcessedFolder: "done"}, "in/a.pdf"))
+	assert.Equal(t, "Would leave a.pdf in place", DescribePostUpload(Folder{}, "a.pdf"))
+}
+
+func TestRun(t *testing.T) {
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	watchDir := filepath.Join(tmpDir, "consume")
+	processedDir := filepath.Join(tmpDir, "processed")
+	assert.NoError(t, os.MkdirAll(watchDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(watchDir, "existing.pdf"), []byte("pdf"), 0644))
+
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{
+		Path:             watchDir,
+		SettleDelay:      10 * time.Millisecond,
+		PostUploadAction: "move",
+		ProcessedFolder:  processedDir,
+	}})
+	assert.False(t, w.Status().Watching)
+	assert.False(t, w.Alive(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	assert.Eventually(t, func() bool { return uploads.Load() == 1 && w.Status().Watching }, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, w.Alive(time.Second))
+	folders := w.Status().Folders
+	assert.Len(t, folders, 1)
+	assert.Equal(t, watchDir, folders[0].Path)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(watchDir, "new.pdf"), []byte("pdf"), 0644))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(processedDir, "new.pdf"))
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), uploads.Load())
+	status := w.Status()
+	assert.Equal(t, 2, status.Folders[0].Uploaded)
+	assert.Equal(t, filepath.Join(watchDir, "new.pdf"), status.Folders[0].LastSuccessFile)
+	assert.Zero(t, status.QueueDepth)
+	assert.Zero(t, status.InFlight)
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.False(t, w.Status().Watching)
+}
+
+func TestPause(t *testing.T) {
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	watchDir := t.TempDir()
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: watchDir, SettleDelay: 10 * time.Millisecond}})
+	w.Pause()
+	assert.True(t, w.Status().Paused)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	assert.Eventually(t, func() bool { return w.Status().Watching }, 5*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(watchDir, "scan.pdf"), []byte("pdf"), 0644))
+	time.Sleep(200 * time.Millisecond)
+	assert.Zero(t, uploads.Load())
+	assert.FileExists(t, filepath.Join(watchDir, "scan.pdf"))
+
+	w.Resume()
+	assert.False(t, w.Status().Paused)
+	assert.Eventually(t, func() bool { return uploads.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestRescan(t *testing.T) {
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	watchDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(watchDir, "scan.pdf"), []byte("pdf"), 0644))
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: watchDir}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	assert.Eventually(t, func() bool { return uploads.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Files left in place are only picked up again by a rescan.
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), uploads.Load())
+	w.Rescan()
+	assert.Eventually(t, func() bool { return uploads.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestFlush(t *testing.T) {
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	watchDir := t.TempDir()
+	// The initial scan uploads existing files right away; once it has,
+	// new files are only found through their events.
+	assert.NoError(t, os.WriteFile(filepath.Join(watchDir, "existing.pdf"), []byte("pdf"), 0644))
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: watchDir, SettleDelay: time.Hour, PostUploadAction: "delete"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+	assert.Eventually(t, func() bool { return uploads.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(watchDir, "scan.pdf"), []byte("pdf"), 0644))
+	// The file is queued before its timer is started.
+	assert.Eventually(t, func() bool { return w.Flush() == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return uploads.Load() == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, w.Flush())
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestScan(t *testing.T) {
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/tasks/") {
+			w.Write([]byte(`{"results": [{"task_id": "task-1", "status": "SUCCESS", "related_document": "42"}]}`))
+			return
+		}
+		// The first upload fails and is retried.
+		if uploads.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+
+	watchDir := t.TempDir()
+	for _, name := range []string{"a.pdf", "b.pdf"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(watchDir, name), []byte("pdf"), 0644))
+	}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: watchDir, PostUploadAction: "delete"}})
+	w.RetryDelay = 10 * time.Millisecond
+	w.TrackConsumption = true
+	var consumed atomic.Int32
+	w.OnEvent(func(e Event) {
+		if e.Type == EventConsumed {
+			consumed.Add(1)
+		}
+	})
+
+	assert.NoError(t, w.Scan(context.Background()))
+	assert.Equal(t, int32(3), uploads.Load())
+	assert.Equal(t, int32(2), consumed.Load())
+	assert.NoFileExists(t, filepath.Join(watchDir, "a.pdf"))
+	assert.NoFileExists(t, filepath.Join(watchDir, "b.pdf"))
+	assert.Equal(t, 2, w.Status().Folders[0].Uploaded)
+	assert.False(t, w.Status().Watching)
+}
+
+func TestFolderClient(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		keys = make(map[string]string)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		_, header, err := r.FormFile("document")
+		assert.NoError(t, err)
+		mu.Lock()
+		keys[header.Filename] = r.Header.Get("Authorization")
+		mu.Unlock()
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+
+	shared, alice := t.TempDir(), t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(shared, "a.pdf"), []byte("pdf"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(alice, "b.pdf"), []byte("pdf"), 0644))
+	w := New(paperless.NewClient(server.URL, "shared_key"), []Folder{
+		{Path: shared},
+		{Path: alice, Client: paperless.NewClient(server.URL, "alice_key")},
+	})
+	assert.NoError(t, w.Scan(context.Background()))
+	assert.Equal(t, map[string]string{"a.pdf": "Token shared_key", "b.pdf": "Token alice_key"}, keys)
+}
+
+func TestScanBacklog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+
+	watchDir := t.TempDir()
+	for i := range 7 {
+		assert.NoError(t, os.WriteFile(filepath.Join(watchDir, fmt.Sprintf("%d.pdf", i)), []byte("pdf"), 0644))
+	}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: watchDir, PostUploadAction: "delete"}})
+	w.MaxPending = 2
+	var (
+		detected   atomic.Int32
+		maxPending int
+	)
+	w.OnEvent(func(e Event) {
+		if e.Type == EventDetected {
+			detected.Add(1)
+			// Listeners run without the lock held.
+			maxPending = max(maxPending, w.pendingJobs()+1)
+		}
+	})
+
+	// Files beyond the backlog are picked up by rescans.
+	assert.NoError(t, w.Scan(context.Background()))
+	assert.Equal(t, int32(7), detected.Load())
+	assert.Equal(t, 7, w.Status().Folders[0].Uploaded)
+	assert.LessOrEqual(t, maxPending, 2)
+	entries, err := os.ReadDir(watchDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRetry(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "database is locked")
+	}))
+	defer server.Close()
+
+	watchDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(watchDir, "scan.pdf"), []byte("pdf"), 0644))
+
+	failedDir := filepath.Join(t.TempDir(), "failed")
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: watchDir, TagNames: []string{"inbox"}, FailedFolder: failedDir}})
+	w.MaxRetries = 2
+	w.RetryDelay = 10 * time.Millisecond
+	w.ErrorReports = true
+	w.Profile = "config.yaml"
+	var (
+		mu     sync.Mutex
+		events []EventType
+	)
+	w.OnEvent(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Type != EventUploadProgress {
+			events = append(events, e.Type)
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	assert.Eventually(t, func() bool { return w.Status().Folders[0].Failed == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(3), attempts.Load())
+	status := w.Status()
+	assert.Zero(t, status.RetryBacklog)
+	assert.Equal(t, filepath.Join(watchDir, "scan.pdf"), status.Folders[0].LastFailureFile)
+	assert.NotEmpty(t, status.Folders[0].LastError)
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 10
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []EventType{
+		EventWatching,
+		EventDetected,
+		EventUploadStarted, EventHashed, EventRetryScheduled,
+		EventUploadStarted, EventRetryScheduled,
+		EventUploadStarted, EventUploadFailed,
+		EventMoved,
+	}, events)
+	mu.Unlock()
+
+	// The file was moved to the failed folder together with its record.
+	failed, err := ListFailed(failedDir)
+	assert.NoError(t, err)
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, filepath.Join(failedDir, "scan.pdf"), failed[0].Path)
+		assert.Equal(t, watchDir, failed[0].Record.Folder)
+		assert.Equal(t, []string{"inbox"}, failed[0].Record.TagNames)
+		assert.Equal(t, 3, failed[0].Record.Attempts)
+	}
+
+	// Next to it is its error report.
+	reportPath := filepath.Join(failedDir, "scan.pdf"+errorReportSuffix)
+	assert.Eventually(t, func() bool { _, err := os.Stat(reportPath); return err == nil }, 5*time.Second, 10*time.Millisecond)
+	data, err := os.ReadFile(reportPath)
+	assert.NoError(t, err)
+	var report ErrorReport
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, filepath.Join(watchDir, "scan.pdf"), report.File)
+	assert.Equal(t, "config.yaml", report.Profile)
+	assert.Equal(t, http.StatusInternalServerError, report.StatusCode)
+	assert.Equal(t, "database is locked", report.ResponseBody)
+	if assert.Len(t, report.Attempts, 3) {
+		assert.Equal(t, http.StatusInternalServerError, report.Attempts[0].StatusCode)
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestRejectedNotRetried(t *testing.T) {
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "scan.pdf")
+	assert.NoError(t, os.WriteFile(filePath, []byte("content"), 0644))
+	failedDir := filepath.Join(tmpDir, "failed")
+	folder := Folder{Path: tmpDir, FailedFolder: failedDir}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{folder})
+	w.MaxRetries = 3
+	var events []EventType
+	w.OnEvent(func(e Event) {
+		if e.Type != EventUploadProgress {
+			events = append(events, e.Type)
+		}
+	})
+	ctx := context.Background()
+	w.schedule(ctx, newJob(folder, filePath), 0, false)
+	w.process(ctx, <-w.queue)
+
+	assert.Equal(t, int32(1), uploads.Load())
+	assert.Equal(t, []EventType{EventUploadStarted, EventHashed, EventUploadFailed, EventMoved}, events)
+	assert.FileExists(t, filepath.Join(failedDir, "scan.pdf"))
+}
+
+func TestSidecarsRedacted(t *testing.T) {
+	logging.AddSecret("sidecar-secret-token")
+	path := filepath.Join(t.TempDir(), "a.pdf")
+	assert.NoError(t, WriteErrorReport(path, ErrorReport{
+		Error:        "401 for token sidecar-secret-token",
+		ResponseBody: `{"detail": "sidecar-secret-token"}`,
+		Attempts:     []Attempt{{Error: "401 for token sidecar-secret-token"}},
+	}))
+	assert.NoError(t, WriteFailedRecord(path, FailedRecord{Error: "401 for token sidecar-secret-token"}))
+	for _, suffix := range []string{errorReportSuffix, failedSuffix} {
+		data, err := os.ReadFile(path + suffix)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(data), "sidecar-secret-token", suffix)
+		assert.Contains(t, string(data), "REDACTED", suffix)
+	}
+}
+
+func TestMoveToFailedUniqueName(t *testing.T) {
+	tmpDir := t.TempDir()
+	failedDir := filepath.Join(tmpDir, "failed")
+	folder := Folder{Path: tmpDir, FailedFolder: failedDir}
+	for i := 0; i < 2; i++ {
+		filePath := filepath.Join(tmpDir, "scan.pdf")
+		assert.NoError(t, os.WriteFile(filePath, []byte("pdf"), 0644))
+		dest, err := MoveToFailed(folder, filePath, 1, errors.New("boom"))
+		assert.NoError(t, err)
+		assert.FileExists(t, dest)
+	}
+
+	failed, err := ListFailed(failedDir)
+	assert.NoError(t, err)
+	assert.Len(t, failed, 2)
+	for _, f := range failed {
+		assert.Equal(t, "boom", f.Record.Error)
+	}
+	assert.FileExists(t, filepath.Join(failedDir, "scan-1.pdf"))
+}
+
+func TestEncryptAtRest(t *testing.T) {
+	tmpDir := t.TempDir()
+	key := bytes.Repeat([]byte{7}, 32)
+	folder := Folder{
+		Path:             tmpDir,
+		PostUploadAction: "move",
+		ProcessedFolder:  filepath.Join(tmpDir, "done"),
+		FailedFolder:     filepath.Join(tmpDir, "failed"),
+		EncryptionKey:    key,
+	}
+	assert.NoError(t, os.MkdirAll(folder.ProcessedFolder, 0755))
+
+	filePath := filepath.Join(tmpDir, "scan.pdf")
+	assert.Equal(t, "Would encrypt "+filePath+" to "+filepath.Join(folder.ProcessedFolder, "scan.pdf.enc"), DescribePostUpload(folder, filePath))
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, os.WriteFile(filePath, []byte("%PDF-1.4"), 0644))
+		dest, err := MoveToFailed(folder, filePath, 1, errors.New("boom"))
+		assert.NoError(t, err)
+		assert.NoFileExists(t, filePath)
+		assert.True(t, strings.HasSuffix(dest, ".pdf.enc"), dest)
+	}
+	assert.FileExists(t, filepath.Join(folder.FailedFolder, "scan-1.pdf.enc"))
+	failed, err := ListFailed(folder.FailedFolder)
+	assert.NoError(t, err)
+	assert.Len(t, failed, 2)
+
+	// Encrypted files are moved as they are.
+	newPath, err := HandlePostUpload(folder, failed[0].Path)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(folder.ProcessedFolder, filepath.Base(failed[0].Path)), newPath)
+
+	var plain bytes.Buffer
+	f, err := os.Open(newPath)
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, atrest.Decrypt(key, &plain, f))
+	assert.Equal(t, "%PDF-1.4", plain.String())
+}
+
+func TestUploadOptions(t *testing.T) {
+	folder := Folder{Tags: []int{1, 2}}
+	assert.Equal(t, []int{1, 2}, uploadOptions(folder, "a.pdf").Tags)
+
+	folder.Metadata = func(filePath string) (paperless.UploadOptions, error) {
+		return paperless.UploadOptions{Title: "Bill " + filePath, Tags: []int{2, 3}}, nil
+	}
+	opts := uploadOptions(folder, "a.pdf")
+	assert.Equal(t, "Bill a.pdf", opts.Title)
+	assert.Equal(t, []int{1, 2, 3}, opts.Tags)
+
+	folder.Metadata = func(filePath string) (paperless.UploadOptions, error) {
+		return paperless.UploadOptions{Title: "ignored"}, errors.New("bad date")
+	}
+	opts = uploadOptions(folder, "a.pdf")
+	assert.Empty(t, opts.Title)
+	assert.Equal(t, []int{1, 2}, opts.Tags)
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "scan.pdf")
+	assert.NoError(t, os.WriteFile(filePath, []byte("content"), 0644))
+
+	folder := Folder{Path: tmpDir}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{folder})
+	ctx := context.Background()
+	w.schedule(ctx, newJob(folder, filePath), 0, false)
+	w.process(ctx, <-w.queue)
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	assert.Equal(t, []string{"stabilize", "preprocess", "upload", "post_upload", "document"}, names)
+	root := recorder.Ended()[4]
+	for _, span := range recorder.Ended()[:4] {
+		assert.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID())
+	}
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/tasks/") {
+			w.Write([]byte(`{"results": [{"task_id": "task-1", "status": "SUCCESS", "related_document": "42"}]}`))
+			return
+		}
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "scan.pdf")
+	assert.NoError(t, os.WriteFile(filePath, []byte("content"), 0644))
+
+	folder := Folder{Path: tmpDir, PostUploadAction: "move", ProcessedFolder: filepath.Join(tmpDir, "processed"), Tags: []int{3, 5}}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{folder})
+	w.Receipts = true
+	events := make(chan Event, 10)
+	w.OnEvent(func(e Event) {
+		if e.Type != EventUploadProgress {
+			events <- e
+		}
+	})
+	ctx := context.Background()
+	w.schedule(ctx, newJob(folder, filePath), 0, false)
+	w.process(ctx, <-w.queue)
+
+	var got []Event
+	for len(got) < 5 {
+		select {
+		case e := <-events:
+			got = append(got, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("missing events, got %v", got)
+		}
+	}
+	assert.Equal(t, EventUploadStarted, got[0].Type)
+	assert.Equal(t, EventHashed, got[1].Type)
+	assert.Equal(t, "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73", got[1].Checksum)
+	assert.Equal(t, EventUploaded, got[2].Type)
+	assert.Equal(t, EventMoved, got[3].Type)
+	assert.Equal(t, filepath.Join(tmpDir, "processed", "scan.pdf"), got[3].Dest)
+	assert.Equal(t, EventConsumed, got[4].Type)
+	assert.Equal(t, 42, got[4].DocumentID)
+	assert.Equal(t, server.URL+"/documents/42/details", got[4].URL)
+	assert.Equal(t, "task-1", got[4].TaskID)
+
+	// The receipt was written next to the moved file.
+	data, err := os.ReadFile(got[3].Dest + ".uploaded.json")
+	assert.NoError(t, err)
+	var receipt Receipt
+	assert.NoError(t, json.Unmarshal(data, &receipt))
+	assert.Equal(t, filePath, receipt.Source)
+	assert.Equal(t, 42, receipt.DocumentID)
+	assert.Equal(t, got[4].URL, receipt.URL)
+	assert.Equal(t, got[1].Checksum, receipt.SHA256)
+	assert.Equal(t, []int{3, 5}, receipt.Tags)
+	assert.True(t, IsSidecar(got[3].Dest+".uploaded.json"))
+	assert.True(t, IsSidecar(got[3].Dest+".receipt.json"))
+	for _, e := range got {
+		assert.Equal(t, got[0].ID, e.ID)
+	}
+}
+
+func TestAfterConsumption(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/tasks/") {
+			w.Write([]byte(`[{"task_id": "task-1", "status": "SUCCESS", "related_document": "42"}]`))
+			return
+		}
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "scan.pdf")
+	assert.NoError(t, os.WriteFile(filePath, []byte("content"), 0644))
+
+	folder := Folder{Path: tmpDir, PostUploadAction: "delete"}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{folder})
+	var applied []string
+	w.AfterConsumption = func(client *paperless.Client, documentID int, folder, path string) error {
+		applied = append(applied, fmt.Sprintf("%d %s %s", documentID, folder, path))
+		return nil
+	}
+	consumed := make(chan Event, 1)
+	w.OnEvent(func(e Event) {
+		if e.Type == EventConsumed {
+			consumed <- e
+		}
+	})
+	ctx := context.Background()
+	w.schedule(ctx, newJob(folder, filePath), 0, false)
+	w.process(ctx, <-w.queue)
+
+	select {
+	case e := <-consumed:
+		assert.Equal(t, 42, e.DocumentID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("document not consumed")
+	}
+	// The hook ran before the document was reported as consumed.
+	assert.Equal(t, []string{fmt.Sprintf("42 %s %s", tmpDir, filePath)}, applied)
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	good := md5.Sum([]byte("good"))
+	documents := map[string]string{"good.pdf": "1", "bad.pdf": "2"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/documents/post_document/":
+			_, header, err := r.FormFile("document")
+			assert.NoError(t, err)
+			fmt.Fprintf(w, `"task-%s"`, header.Filename)
+		case r.URL.Path == "/api/tasks/":
+			name := strings.TrimPrefix(r.URL.Query().Get("task_id"), "task-")
+			if id, ok := documents[name]; ok {
+				fmt.Fprintf(w, `[{"task_id": "task-%s", "status": "SUCCESS", "related_document": "%s"}]`, name, id)
+				return
+			}
+			fmt.Fprintf(w, `[{"task_id": "task-%s", "status": "FAILURE", "result": "duplicate"}]`, name)
+		case r.URL.Path == "/api/documents/1/metadata/":
+			fmt.Fprintf(w, `{"original_checksum": "%s"}`, hex.EncodeToString(good[:]))
+		case r.URL.Path == "/api/documents/2/metadata/":
+			w.Write([]byte(`{"original_checksum": "00000000000000000000000000000000"}`))
+		}
+	}))
+	defer server.Close()
+
+	watchDir, failedDir := t.TempDir(), t.TempDir()
+	for _, name := range []string{"good.pdf", "bad.pdf", "rejected.pdf"} {
+		content := "good"
+		if name != "good.pdf" {
+			content = name
+		}
+		assert.NoError(t, os.WriteFile(filepath.Join(watchDir, name), []byte(content), 0644))
+	}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: watchDir, PostUploadAction: "delete", FailedFolder: failedDir}})
+	w.VerifyChecksum = true
+	var (
+		mu     sync.Mutex
+		events = make(map[EventType][]string)
+	)
+	w.OnEvent(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events[e.Type] = append(events[e.Type], filepath.Base(e.Path))
+	})
+
+	assert.NoError(t, w.Scan(context.Background()))
+	assert.NoFileExists(t, filepath.Join(watchDir, "good.pdf"))
+	assert.Equal(t, []string{"good.pdf"}, events[EventDeleted])
+	assert.Equal(t, []string{"bad.pdf"}, events[EventVerifyFailed])
+	assert.FileExists(t, filepath.Join(failedDir, "bad.pdf"))
+	assert.FileExists(t, filepath.Join(failedDir, "rejected.pdf"))
+	failed, err := ListFailed(failedDir)
+	assert.NoError(t, err)
+	assert.Len(t, failed, 2)
+	assert.Contains(t, failed[0].Record.Error, "checksum mismatch: document 2 has 00000000000000000000000000000000")
+	assert.Equal(t, "consumption failed: duplicate", failed[1].Record.Error)
+	assert.Equal(t, 1, w.Status().Folders[0].Uploaded)
+	assert.Equal(t, 2, w.Status().Folders[0].Failed)
+}
+
+func TestOnDuplicate(t *testing.T) {
+	for _, policy := range DuplicatePolicies {
+		t.Run(policy, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				uploads []string
+			)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				switch r.URL.Path {
+				case "/api/documents/post_document/":
+					file, _, err := r.FormFile("document")
+					assert.NoError(t, err)
+					content, _ := io.ReadAll(file)
+					uploads = append(uploads, r.FormValue("title")+": "+strings.SplitN(string(content), "\n", 2)[0])
+					fmt.Fprintf(w, `"task-%d"`, len(uploads))
+				case "/api/tasks/":
+					if r.URL.Query().Get("task_id") == "task-1" {
+						w.Write([]byte(`[{"task_id": "task-1", "status": "FAILURE", "result": "Not consuming scan.pdf: It is a duplicate of Bill (#12)."}]`))
+						return
+					}
+					w.Write([]byte(`[{"task_id": "task-2", "status": "SUCCESS", "related_document": "13"}]`))
+				}
+			}))
+			defer server.Close()
+
+			dir := t.TempDir()
+			folder := Folder{
+				Path:             filepath.Join(dir, "consume"),
+				PostUploadAction: "move",
+				ProcessedFolder:  filepath.Join(dir, "processed"),
+				FailedFolder:     filepath.Join(dir, "failed"),
+				OnDuplicate:      policy,
+				DuplicatesFolder: filepath.Join(dir, "duplicates"),
+			}
+			assert.NoError(t, os.Mkdir(folder.Path, 0755))
+			assert.NoError(t, os.WriteFile(filepath.Join(folder.Path, "scan.pdf"), []byte("%PDF-1.7"), 0644))
+			w := New(paperless.NewClient(server.URL, "test_key"), []Folder{folder})
+			var events []Event
+			w.OnEvent(func(e Event) {
+				if e.Type == EventDuplicate || e.Type == EventConsumed || e.Type == EventConsumeFailed {
+					events = append(events, e)
+				}
+			})
+			assert.NoError(t, w.Scan(context.Background()))
+
+			assert.NoFileExists(t, filepath.Join(folder.Path, "scan.pdf"))
+			switch policy {
+			case DuplicateSuccess:
+				assert.FileExists(t, filepath.Join(dir, "processed", "scan.pdf"))
+			case DuplicateMove:
+				assert.FileExists(t, filepath.Join(dir, "duplicates", "scan.pdf"))
+			case DuplicateReupload:
+				assert.FileExists(t, filepath.Join(dir, "processed", "scan.pdf"))
+				assert.Equal(t, []string{": %PDF-1.7", "scan (duplicate of #12): %PDF-1.7"}, uploads)
+				assert.Equal(t, EventConsumed, events[1].Type)
+				assert.Equal(t, 13, events[1].DocumentID)
+			case DuplicateFail:
+				assert.FileExists(t, filepath.Join(dir, "failed", "scan.pdf"))
+				assert.Equal(t, EventConsumeFailed, events[0].Type)
+				assert.ErrorContains(t, events[0].Err, "It is a duplicate of Bill (#12)")
+				return
+			}
+			assert.Equal(t, EventDuplicate, events[0].Type)
+			assert.Equal(t, 12, events[0].DocumentID)
+			assert.Equal(t, server.URL+"/documents/12/details", events[0].URL)
+		})
+	}
+}
+
+func TestReuploadKeepsMetadata(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		uploads []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/documents/post_document/":
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			uploads = append(uploads, r.FormValue("title")+" "+strings.Join(r.MultipartForm.Value["tags"], ",")+" "+r.FormValue("correspondent"))
+			fmt.Fprintf(w, `"task-%d"`, len(uploads))
+		case "/api/tasks/":
+			if r.URL.Query().Get("task_id") == "task-1" {
+				w.Write([]byte(`[{"task_id": "task-1", "status": "FAILURE", "result": "Not consuming scan.pdf: It is a duplicate of Bill (#12)."}]`))
+				return
+			}
+			w.Write([]byte(`[{"task_id": "task-2", "status": "SUCCESS", "related_document": "13"}]`))
+		}
+	}))
+	defer server.Close()
+
+	// Like the metadata posted with received files, the metadata is only
+	// known until the file was uploaded.
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "scan.pdf")
+	assert.NoError(t, os.WriteFile(filePath, []byte("%PDF-1.7"), 0644))
+	correspondent := 4
+	received := map[string]paperless.UploadOptions{filePath: {Title: "Bill", Tags: []int{7}, Correspondent: &correspondent}}
+	var calls int
+	folder := Folder{Path: dir, Tags: []int{1}, OnDuplicate: DuplicateReupload, Metadata: func(path string) (paperless.UploadOptions, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return received[path], nil
+	}}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{folder})
+	w.OnEvent(func(e Event) {
+		if e.Type == EventUploaded {
+			mu.Lock()
+			delete(received, e.Path)
+			mu.Unlock()
+		}
+	})
+	assert.NoError(t, w.Scan(context.Background()))
+
+	assert.Equal(t, []string{"Bill 1,7 4", "Bill (duplicate of #12) 1,7 4"}, uploads)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDeliver(t *testing.T) {
+	dir := t.TempDir()
+	dest, err := Deliver(dir, `C:\scans\invoice?.pdf`, strings.NewReader("pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "invoice_.pdf"), dest)
+	dest, err = Deliver(dir, "invoice_.pdf", strings.NewReader("pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "invoice_-1.pdf"), dest)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	assert.Equal(t, "document", SafeFileName("../.."))
+	assert.True(t, IsPartial(filepath.Join(dir, ".scan.pdf.123"+partialSuffix)))
+	assert.False(t, IsPartial(filepath.Join(dir, "scan.pdf")))
+}
+
+func TestPostUploadActionFor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`"task-1"`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	for _, name := range []string{"keep.pdf", "delete.pdf"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+	folder := Folder{Path: dir, PostUploadAction: "delete"}
+	folder.PostUploadActionFor = func(filePath string) (string, bool) {
+		return "", filepath.Base(filePath) == "keep.pdf"
+	}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{folder})
+	assert.NoError(t, w.Scan(context.Background()))
+	assert.FileExists(t, filepath.Join(dir, "keep.pdf"))
+	assert.NoFileExists(t, filepath.Join(dir, "delete.pdf"))
+}
+
+type recentUploads map[string]string
+
+func (r recentUploads) RecentUpload(checksum string) (string, time.Time, bool) {
+	path, ok := r[checksum]
+	return path, time.Now(), ok
+}
+
+func (r recentUploads) AddRecentUpload(checksum, path string) error {
+	r[checksum] = path
+	return nil
+}
+
+func TestRecentUploads(t *testing.T) {
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	watchDir := filepath.Join(tmpDir, "consume")
+	processedDir := filepath.Join(tmpDir, "processed")
+	assert.NoError(t, os.MkdirAll(watchDir, 0755))
+	for _, name := range []string{"a.pdf", "b.pdf", "c.pdf"} {
+		content := "scan"
+		if name == "c.pdf" {
+			content = "another scan"
+		}
+		assert.NoError(t, os.WriteFile(filepath.Join(watchDir, name), []byte(content), 0644))
+	}
+	w := New(paperless.NewClient(server.URL, "test_key"), []Folder{{Path: watchDir, PostUploadAction: "move", ProcessedFolder: processedDir}})
+	w.Recent = recentUploads{}
+	var (
+		mu         sync.Mutex
+		duplicates []Event
+	)
+	w.OnEvent(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Type == EventDuplicate {
+			duplicates = append(duplicates, e)
+		}
+	})
+	assert.NoError(t, w.Scan(context.Background()))
+
+	// The second copy is not uploaded, but moved like the first.
+	assert.Equal(t, int32(2), uploads.Load())
+	for _, name := range []string{"a.pdf", "b.pdf", "c.pdf"} {
+		assert.FileExists(t, filepath.Join(processedDir, name))
+	}
+	if assert.Len(t, duplicates, 1) {
+		assert.Equal(t, filepath.Join(watchDir, "b.pdf"), duplicates[0].Path)
+		assert.Equal(t, filepath.Join(watchDir, "a.pdf"), duplicates[0].Original)
+		assert.NotEmpty(t, duplicates[0].Checksum)
+	}
+	assert.Equal(t, 2, w.Status().Folders[0].Uploaded)
+}